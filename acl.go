@@ -0,0 +1,181 @@
+package radix
+
+import (
+	"bufio"
+	"strings"
+
+	"github.com/mediocregopher/radix/v3/resp"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+// ACLSelector describes a selector of an ACL user, as returned as part of the
+// ACL GETUSER command in redis 7 and later. A selector grants its permissions
+// independently of the user's root permissions.
+type ACLSelector struct {
+	// Commands describes the commands which can be performed, in the same
+	// form as given to ACL SETUSER (e.g. "+@all -debug").
+	Commands string
+
+	// Keys and Channels are the key and channel patterns which can be
+	// accessed, including their prefix (e.g. "~foo:*", "%R~bar:*", "&baz").
+	Keys     []string
+	Channels []string
+}
+
+// ACLUser describes an ACL user, and is used as the receiver for ACLGetUser.
+type ACLUser struct {
+	// Flags are the user's flags (e.g. "on", "allkeys", "nopass").
+	Flags []string
+
+	// Passwords are the SHA256 hashes of the user's passwords.
+	Passwords []string
+
+	ACLSelector
+
+	// Selectors are the user's additional selectors, if any.
+	Selectors []ACLSelector
+}
+
+// aclStrings unmarshals a RESP message which may be either an array of
+// strings or a single space separated string into a []string. Redis 6 returns
+// some fields in ACL GETUSER as arrays, and redis 7 returns them as strings.
+func aclStrings(rm resp2.RawMessage) ([]string, error) {
+	var ss []string
+	if len(rm) > 0 && rm[0] == resp2.ArrayPrefix[0] {
+		err := rm.UnmarshalInto(resp2.Any{I: &ss})
+		return ss, err
+	}
+
+	var s string
+	if err := rm.UnmarshalInto(resp2.Any{I: &s}); err != nil {
+		return nil, err
+	}
+	return strings.Fields(s), nil
+}
+
+// unmarshalACLFields reads a flat key/value RESP array, calling fn with each
+// key and its value.
+func unmarshalACLFields(br *bufio.Reader, fn func(string, resp2.RawMessage) error) error {
+	var ah resp2.ArrayHeader
+	if err := ah.UnmarshalRESP(br); err != nil {
+		return err
+	}
+
+	var retErr error
+	for i := 0; i < ah.N/2; i++ {
+		var key string
+		if err := (resp2.Any{I: &key}).UnmarshalRESP(br); err != nil {
+			return err
+		}
+		var val resp2.RawMessage
+		if err := val.UnmarshalRESP(br); err != nil {
+			return err
+		}
+		if err := fn(key, val); err != nil && retErr == nil {
+			retErr = resp.ErrDiscarded{Err: err}
+		}
+	}
+	return retErr
+}
+
+// UnmarshalRESP implements the method for the resp.Unmarshaler interface.
+func (s *ACLSelector) UnmarshalRESP(br *bufio.Reader) error {
+	return unmarshalACLFields(br, s.setField)
+}
+
+func (s *ACLSelector) setField(key string, val resp2.RawMessage) error {
+	var err error
+	switch key {
+	case "commands":
+		err = val.UnmarshalInto(resp2.Any{I: &s.Commands})
+	case "keys":
+		s.Keys, err = aclStrings(val)
+	case "channels":
+		s.Channels, err = aclStrings(val)
+	}
+	return err
+}
+
+// UnmarshalRESP implements the method for the resp.Unmarshaler interface.
+func (u *ACLUser) UnmarshalRESP(br *bufio.Reader) error {
+	return unmarshalACLFields(br, func(key string, val resp2.RawMessage) error {
+		switch key {
+		case "flags":
+			return val.UnmarshalInto(resp2.Any{I: &u.Flags})
+		case "passwords":
+			return val.UnmarshalInto(resp2.Any{I: &u.Passwords})
+		case "selectors":
+			return val.UnmarshalInto((*aclSelectors)(&u.Selectors))
+		default:
+			return u.ACLSelector.setField(key, val)
+		}
+	})
+}
+
+type aclSelectors []ACLSelector
+
+func (ss *aclSelectors) UnmarshalRESP(br *bufio.Reader) error {
+	var ah resp2.ArrayHeader
+	if err := ah.UnmarshalRESP(br); err != nil {
+		return err
+	}
+	*ss = make([]ACLSelector, ah.N)
+	for i := range *ss {
+		if err := (*ss)[i].UnmarshalRESP(br); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ACLList returns an Action which performs ACL LIST, unmarshaling the rules of
+// each user into rcv.
+func ACLList(rcv *[]string) CmdAction {
+	return Cmd(rcv, "ACL", "LIST")
+}
+
+// ACLGetUser returns an Action which performs ACL GETUSER for the given user,
+// unmarshaling the result into rcv.
+//
+// If the user doesn't exist redis returns a nil reply, which can be detected by
+// wrapping rcv in a MaybeNil and using Cmd directly:
+//
+//	mn := radix.MaybeNil{Rcv: new(radix.ACLUser)}
+//	err := client.Do(radix.Cmd(&mn, "ACL", "GETUSER", "alice"))
+//
+func ACLGetUser(rcv *ACLUser, username string) CmdAction {
+	return Cmd(rcv, "ACL", "GETUSER", username)
+}
+
+// ACLSetUser returns an Action which performs ACL SETUSER for the given user,
+// creating it if it doesn't exist and applying the given rules to it (e.g.
+// "on", ">password", "~cache:*", "+get").
+func ACLSetUser(username string, rules ...string) CmdAction {
+	return Cmd(nil, "ACL", append([]string{"SETUSER", username}, rules...)...)
+}
+
+// ACLDelUser returns an Action which performs ACL DELUSER for the given users,
+// unmarshaling the number of users which were deleted into rcv, which may be
+// nil.
+func ACLDelUser(rcv *int, usernames ...string) CmdAction {
+	if rcv == nil {
+		return Cmd(nil, "ACL", append([]string{"DELUSER"}, usernames...)...)
+	}
+	return Cmd(rcv, "ACL", append([]string{"DELUSER"}, usernames...)...)
+}
+
+// ACLCat returns an Action which performs ACL CAT, unmarshaling the result into
+// rcv. If category is empty then the names of all categories are returned,
+// otherwise the names of all commands within that category are.
+func ACLCat(rcv *[]string, category string) CmdAction {
+	if category == "" {
+		return Cmd(rcv, "ACL", "CAT")
+	}
+	return Cmd(rcv, "ACL", "CAT", category)
+}
+
+// ACLWhoAmI returns an Action which performs ACL WHOAMI, unmarshaling the name
+// of the user the connection is authenticated as into rcv.
+func ACLWhoAmI(rcv *string) CmdAction {
+	return Cmd(rcv, "ACL", "WHOAMI")
+}
@@ -0,0 +1,97 @@
+package radix
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mediocregopher/radix/v3/resp"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+func TestACLGetUser(t *T) {
+	redis6 := respArr(
+		"flags", respArr("on", "allchannels"),
+		"passwords", respArr("abc"),
+		"commands", "+@all -debug",
+		"keys", respArr("foo:*", "bar:*"),
+		"channels", respArr("*"),
+	)
+	redis7 := respArr(
+		"flags", respArr("on"),
+		"passwords", resp2.Any{I: []string{}},
+		"commands", "+@all -debug",
+		"keys", "~foo:* %R~bar:*",
+		"channels", "&*",
+		"selectors", respArr(
+			respArr(
+				"commands", "-@all +get",
+				"keys", "~baz",
+				"channels", "",
+			),
+		),
+	)
+
+	var reply resp.Marshaler
+	conn := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		assert.Equal(t, []string{"ACL", "GETUSER", "alice"}, args)
+		return reply
+	})
+
+	reply = redis6
+	var u ACLUser
+	require.NoError(t, conn.Do(ACLGetUser(&u, "alice")))
+	assert.Equal(t, ACLUser{
+		Flags:     []string{"on", "allchannels"},
+		Passwords: []string{"abc"},
+		ACLSelector: ACLSelector{
+			Commands: "+@all -debug",
+			Keys:     []string{"foo:*", "bar:*"},
+			Channels: []string{"*"},
+		},
+	}, u)
+
+	reply = redis7
+	u = ACLUser{}
+	require.NoError(t, conn.Do(ACLGetUser(&u, "alice")))
+	assert.Equal(t, ACLUser{
+		Flags:     []string{"on"},
+		Passwords: []string{},
+		ACLSelector: ACLSelector{
+			Commands: "+@all -debug",
+			Keys:     []string{"~foo:*", "%R~bar:*"},
+			Channels: []string{"&*"},
+		},
+		Selectors: []ACLSelector{{
+			Commands: "-@all +get",
+			Keys:     []string{"~baz"},
+			Channels: []string{},
+		}},
+	}, u)
+
+	reply = resp2.RawMessage("*-1\r\n")
+	mn := MaybeNil{Rcv: new(ACLUser)}
+	require.NoError(t, conn.Do(Cmd(&mn, "ACL", "GETUSER", "alice")))
+	assert.True(t, mn.Nil)
+}
+
+func TestACLCmds(t *T) {
+	var got []string
+	conn := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		got = args
+		return 1
+	})
+
+	require.NoError(t, conn.Do(ACLSetUser("alice", "on", ">pass", "~foo:*")))
+	assert.Equal(t, []string{"ACL", "SETUSER", "alice", "on", ">pass", "~foo:*"}, got)
+
+	var n int
+	require.NoError(t, conn.Do(ACLDelUser(&n, "alice", "bob")))
+	assert.Equal(t, []string{"ACL", "DELUSER", "alice", "bob"}, got)
+	assert.Equal(t, 1, n)
+	require.NoError(t, conn.Do(ACLDelUser(nil, "alice")))
+
+	assert.Empty(t, ACLCat(nil, "").Keys())
+	assert.Empty(t, ACLSetUser("alice").Keys())
+}
@@ -7,9 +7,11 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"net"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/xerrors"
 
@@ -52,6 +54,7 @@ var noKeyCmds = map[string]bool{
 	"READWRITE": true,
 	"ASKING":    true,
 
+	"ACL":    true,
 	"AUTH":   true,
 	"ECHO":   true,
 	"PING":   true,
@@ -61,7 +64,6 @@ var noKeyCmds = map[string]bool{
 
 	"KEYS":      true,
 	"MIGRATE":   true,
-	"OBJECT":    true,
 	"RANDOMKEY": true,
 	"WAIT":      true,
 	"SCAN":      true,
@@ -70,6 +72,8 @@ var noKeyCmds = map[string]bool{
 	"EVALSHA": true,
 	"SCRIPT":  true,
 
+	"FUNCTION": true,
+
 	"BGREWRITEAOF": true,
 	"BGSAVE":       true,
 	"CLIENT":       true,
@@ -82,6 +86,7 @@ var noKeyCmds = map[string]bool{
 	"INFO":         true,
 	"LASTSAVE":     true,
 	"MONITOR":      true,
+	"PUBSUB":       true,
 	"ROLE":         true,
 	"SAVE":         true,
 	"SHUTDOWN":     true,
@@ -97,6 +102,147 @@ var noKeyCmds = map[string]bool{
 	"WATCH":   true,
 }
 
+// readOnlyCmds contains all commands which never modify the dataset, and can
+// therefore be performed on a replica.
+var readOnlyCmds = map[string]bool{
+	"EXISTS":    true,
+	"TYPE":      true,
+	"TTL":       true,
+	"PTTL":      true,
+	"DUMP":      true,
+	"OBJECT":    true,
+	"KEYS":      true,
+	"SCAN":      true,
+	"RANDOMKEY": true,
+	"DBSIZE":    true,
+
+	"GET":      true,
+	"MGET":     true,
+	"GETRANGE": true,
+	"SUBSTR":   true,
+	"STRLEN":   true,
+	"GETBIT":   true,
+	"BITCOUNT": true,
+	"BITPOS":   true,
+
+	"BITFIELD_RO": true,
+	"EVAL_RO":     true,
+	"EVALSHA_RO":  true,
+	"SORT_RO":     true,
+
+	"HGET":    true,
+	"HMGET":   true,
+	"HGETALL": true,
+	"HKEYS":   true,
+	"HVALS":   true,
+	"HLEN":    true,
+	"HEXISTS": true,
+	"HSTRLEN": true,
+	"HSCAN":   true,
+
+	"LRANGE": true,
+	"LLEN":   true,
+	"LINDEX": true,
+	"LPOS":   true,
+
+	"SMEMBERS":    true,
+	"SISMEMBER":   true,
+	"SMISMEMBER":  true,
+	"SCARD":       true,
+	"SRANDMEMBER": true,
+	"SINTER":      true,
+	"SUNION":      true,
+	"SDIFF":       true,
+	"SSCAN":       true,
+
+	"ZRANGE":           true,
+	"ZREVRANGE":        true,
+	"ZRANGEBYSCORE":    true,
+	"ZREVRANGEBYSCORE": true,
+	"ZRANGEBYLEX":      true,
+	"ZREVRANGEBYLEX":   true,
+	"ZSCORE":           true,
+	"ZMSCORE":          true,
+	"ZCARD":            true,
+	"ZCOUNT":           true,
+	"ZLEXCOUNT":        true,
+	"ZRANK":            true,
+	"ZREVRANK":         true,
+	"ZSCAN":            true,
+
+	"GEOPOS":               true,
+	"GEODIST":              true,
+	"GEOHASH":              true,
+	"GEORADIUS_RO":         true,
+	"GEORADIUSBYMEMBER_RO": true,
+	"GEOSEARCH":            true,
+
+	"XRANGE":    true,
+	"XREVRANGE": true,
+	"XLEN":      true,
+	"XINFO":     true,
+	"XPENDING":  true,
+}
+
+// ReadOnlyAction is an Action which is aware of whether or not it modifies the
+// dataset it acts on. Clients which can perform Actions on replicas, such as
+// ReplicaSet, will use this to determine if an Action can be performed on a
+// replica rather than the primary.
+//
+// NOTE that the Actions returned by Cmd, FlatCmd and Pipeline all implicitly
+// implement this interface, with the return of ReadOnly being determined by the
+// commands being performed. Use ReadOnly to mark any other Action as read-only.
+type ReadOnlyAction interface {
+	Action
+	ReadOnly() bool
+}
+
+func isReadOnly(a Action) bool {
+	roa, ok := a.(ReadOnlyAction)
+	return ok && roa.ReadOnly()
+}
+
+type readOnlyAction struct {
+	Action
+}
+
+func (roa readOnlyAction) unwrapAction() Action {
+	return roa.Action
+}
+
+func (readOnlyAction) ReadOnly() bool {
+	return true
+}
+
+type readOnlyCmdAction struct {
+	CmdAction
+}
+
+func (roa readOnlyCmdAction) unwrapAction() Action {
+	return roa.CmdAction
+}
+
+func (readOnlyCmdAction) ReadOnly() bool {
+	return true
+}
+
+func (roa readOnlyCmdAction) ReceiveAttributes(attrs map[string]interface{}) {
+	receiveAttributes(roa.CmdAction, attrs)
+}
+
+// ReadOnly wraps the given Action such that it implements ReadOnlyAction, with
+// its ReadOnly method always returning true. This can be used to mark Actions
+// which only read data (e.g. a WithConn or EvalScript) so that they may be
+// performed on a replica.
+//
+// If the given Action is a CmdAction then the returned Action will be as well.
+func ReadOnly(a Action) Action {
+	if cmdA, ok := a.(CmdAction); ok {
+		return readOnlyCmdAction{cmdA}
+	}
+	return readOnlyAction{a}
+}
+
 func cmdString(m resp.Marshaler) string {
 	// we go way out of the way here to display the command as it would be sent
 	// to redis. This is pretty similar logic to what the stub does as well
@@ -182,6 +328,11 @@ func Cmd(rcv interface{}, cmd string, args ...string) CmdAction {
 // FlatCmd also supports encoding.Text/BinaryMarshalers. It does _not_ currently
 // support resp.Marshaler.
 //
+// If all of the arguments are strings, []bytes, or [][]bytes, and at least one
+// []byte is large (4KB or more), then the large []bytes will be written
+// directly to the connection when the command is performed, without first being
+// copied into an intermediate buffer.
+//
 // The receiver to FlatCmd follows the same rules as for Cmd.
 func FlatCmd(rcv interface{}, cmd, key string, args ...interface{}) CmdAction {
 	c := getCmdAction()
@@ -212,6 +363,19 @@ func findStreamsKeys(args []string) []string {
 	return nil
 }
 
+// numKeysArgs returns the keys of commands whose first argument is the number
+// of keys which follow it, e.g. LMPOP.
+func numKeysArgs(args []string) []string {
+	if len(args) == 0 {
+		return nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 || n > len(args)-1 {
+		return nil
+	}
+	return args[1 : 1+n]
+}
+
 func (c *cmdAction) Keys() []string {
 	if c.flat {
 		return c.flatKey[:]
@@ -220,7 +384,8 @@ func (c *cmdAction) Keys() []string {
 	cmd := strings.ToUpper(c.cmd)
 	if cmd == "BITOP" && len(c.args) > 1 { // antirez why you do this
 		return c.args[1:]
-	} else if cmd == "XINFO" {
+	} else if cmd == "XINFO" || cmd == "OBJECT" || cmd == "MEMORY" {
+		// the key follows the subcommand, if there is one
 		if len(c.args) < 2 {
 			return nil
 		}
@@ -229,6 +394,21 @@ func (c *cmdAction) Keys() []string {
 		return c.args[1:2]
 	} else if cmd == "XREAD" || cmd == "XREADGROUP" { // antirez why you still do this
 		return findStreamsKeys(c.args)
+	} else if cmd == "LMPOP" || cmd == "ZMPOP" {
+		return numKeysArgs(c.args)
+	} else if cmd == "BLMPOP" || cmd == "BZMPOP" {
+		// the timeout comes before numkeys
+		if len(c.args) < 2 {
+			return nil
+		}
+		return numKeysArgs(c.args[1:])
+	} else if cmd == "FCALL" || cmd == "FCALL_RO" {
+		if len(c.args) < 2 {
+			return nil
+		}
+		return numKeysArgs(c.args[1:])
+	} else if cmd == "ZRANGESTORE" && len(c.args) > 1 {
+		return c.args[:2]
 	} else if noKeyCmds[cmd] || len(c.args) == 0 {
 		return nil
 	}
@@ -265,8 +445,189 @@ func (c *cmdAction) MarshalRESP(w io.Writer) error {
 	return err
 }
 
+// zeroCopyMinSize is the size a []byte argument must be before it is written
+// directly to the connection by marshalBuffers, rather than copied.
+const zeroCopyMinSize = 4096
+
+// marshalBuffers implements the buffersMarshaler interface. Only FlatCmds
+// whose arguments are all strings, []bytes, or [][]bytes, and which have at
+// least one []byte argument of zeroCopyMinSize or larger, can be marshaled this
+// way.
+func (c *cmdAction) marshalBuffers(scratch *[]byte) (net.Buffers, bool) {
+	if !c.flat {
+		return nil, false
+	}
+
+	var numElems int
+	var hasLarge bool
+	for _, arg := range c.flatArgs {
+		switch arg := arg.(type) {
+		case string:
+			numElems++
+		case []byte:
+			numElems++
+			hasLarge = hasLarge || len(arg) >= zeroCopyMinSize
+		case [][]byte:
+			numElems += len(arg)
+			for _, b := range arg {
+				hasLarge = hasLarge || len(b) >= zeroCopyMinSize
+			}
+		default:
+			return nil, false
+		}
+	}
+	if !hasLarge {
+		return nil, false
+	}
+
+	// everything but the large values is written into scratch, with segments
+	// recording where the large values go relative to it. The net.Buffers is
+	// only built once scratch is complete, since scratch may be reallocated as
+	// it grows.
+	type segment struct {
+		scratchEnd int
+		b          []byte
+	}
+	var segments []segment
+
+	buf := *scratch
+	buf = append(buf, resp2.ArrayPrefix...)
+	buf = strconv.AppendInt(buf, int64(numElems+2), 10)
+	buf = append(buf, "\r\n"...)
+	appendHeader := func(n int) {
+		buf = append(buf, resp2.BulkStringPrefix...)
+		buf = strconv.AppendInt(buf, int64(n), 10)
+		buf = append(buf, "\r\n"...)
+	}
+	appendStr := func(str string) {
+		appendHeader(len(str))
+		buf = append(buf, str...)
+		buf = append(buf, "\r\n"...)
+	}
+	appendBytes := func(b []byte) {
+		appendHeader(len(b))
+		if len(b) < zeroCopyMinSize {
+			buf = append(buf, b...)
+		} else {
+			segments = append(segments, segment{scratchEnd: len(buf), b: b})
+		}
+		buf = append(buf, "\r\n"...)
+	}
+
+	appendStr(c.cmd)
+	appendStr(c.flatKey[0])
+	for _, arg := range c.flatArgs {
+		switch arg := arg.(type) {
+		case string:
+			appendStr(arg)
+		case []byte:
+			appendBytes(arg)
+		case [][]byte:
+			for _, b := range arg {
+				appendBytes(b)
+			}
+		}
+	}
+	*scratch = buf
+
+	bufs := make(net.Buffers, 0, len(segments)*2+1)
+	var start int
+	for _, seg := range segments {
+		bufs = append(bufs, buf[start:seg.scratchEnd], seg.b)
+		start = seg.scratchEnd
+	}
+	return append(bufs, buf[start:]), true
+}
+
+// approxSize returns an approximation of the number of bytes the command will
+// take up once marshaled. It is used to limit the size of batches of commands
+// which are written together.
+func (c *cmdAction) approxSize() int {
+	// each bulk string has a header and trailing CRLF, which we assume takes
+	// around 8 bytes
+	const overhead = 8
+	size := overhead + len(c.cmd)
+	if !c.flat {
+		for i := range c.args {
+			size += overhead + len(c.args[i])
+		}
+		return size
+	}
+
+	size += overhead + len(c.flatKey[0])
+	for _, arg := range c.flatArgs {
+		switch arg := arg.(type) {
+		case string:
+			size += overhead + len(arg)
+		case []byte:
+			size += overhead + len(arg)
+		case resp2.RawMessage:
+			size += len(arg)
+		default:
+			// anything more complicated is impractical to measure without
+			// actually marshaling it, just assume it's small.
+			size += 2 * overhead
+		}
+	}
+	return size
+}
+
+// blockTimeout returns the timeout declared in the arguments of a blocking
+// command, or -1 if the command will block indefinitely. If the timeout can't
+// be determined then zero is returned. false is returned if the command isn't
+// a blocking one.
+func (c *cmdAction) blockTimeout() (time.Duration, bool) {
+	cmd := strings.ToUpper(c.cmd)
+	if !blockingCmds[cmd] {
+		return 0, false
+	}
+
+	args := c.args
+	if c.flat {
+		args = make([]string, 0, len(c.flatArgs)+1)
+		args = append(args, c.flatKey[0])
+		for _, arg := range c.flatArgs {
+			args = append(args, fmt.Sprint(arg))
+		}
+	}
+	if len(args) == 0 {
+		return 0, true
+	}
+
+	timeoutStr, unit := args[len(args)-1], time.Second
+	switch cmd {
+	case "XREAD", "XREADGROUP":
+		// these only block if the BLOCK option is given
+		i := 0
+		for ; i < len(args) && !strings.EqualFold(args[i], "BLOCK"); i++ {
+		}
+		if i+1 >= len(args) {
+			return 0, false
+		}
+		timeoutStr, unit = args[i+1], time.Millisecond
+	case "WAIT":
+		unit = time.Millisecond
+	case "BLMPOP", "BZMPOP":
+		timeoutStr = args[0]
+	case "SAVE":
+		return 0, true
+	}
+
+	f, err := strconv.ParseFloat(timeoutStr, 64)
+	if err != nil || f < 0 {
+		return 0, true
+	} else if f == 0 {
+		return -1, true
+	}
+	return time.Duration(f * float64(unit)), true
+}
+
 func (c *cmdAction) UnmarshalRESP(br *bufio.Reader) error {
 	if err := (resp2.Any{I: c.rcv}).UnmarshalRESP(br); err != nil {
+		var ue *resp2.UnmarshalError
+		if xerrors.As(err, &ue) {
+			ue.Cmd = c.cmd
+		}
 		return err
 	}
 	cmdActionPool.Put(c)
@@ -288,6 +649,10 @@ func (c *cmdAction) ClusterCanRetry() bool {
 	return true
 }
 
+func (c *cmdAction) ReadOnly() bool {
+	return readOnlyCmds[strings.ToUpper(c.cmd)]
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 
 // MaybeNil is a type which wraps a receiver. It will first detect if what's
@@ -295,14 +660,31 @@ func (c *cmdAction) ClusterCanRetry() bool {
 // set Nil to true. If not the return value will be unmarshalled into Rcv
 // normally. If the response being received is an empty array then the EmptyArray
 // field will be set and Rcv unmarshalled into normally.
+//
+// This allows distinguishing a missing value (e.g. GET on a key which doesn't
+// exist) from an empty one, which would otherwise both leave a string receiver
+// as "". Rcv may be nil if only Nil is of interest.
+//
+// To detect nil elements within an array reply, e.g. from MGET or HMGET, use a
+// Tuple of *MaybeNil.
+//
+// Nil and EmptyArray are reset on every unmarshal, so a MaybeNil may be reused.
 type MaybeNil struct {
 	Nil        bool
 	EmptyArray bool
 	Rcv        interface{}
 }
 
+// ReceiveAttributes implements the method for the resp.AttributesReceiver
+// interface, passing the attributes on to Rcv if it implements the interface
+// too.
+func (mn *MaybeNil) ReceiveAttributes(attrs map[string]interface{}) {
+	receiveAttributes(mn.Rcv, attrs)
+}
+
 // UnmarshalRESP implements the method for the resp.Unmarshaler interface.
 func (mn *MaybeNil) UnmarshalRESP(br *bufio.Reader) error {
+	mn.Nil, mn.EmptyArray = false, false
 	var rm resp2.RawMessage
 	err := rm.UnmarshalRESP(br)
 	switch {
@@ -532,6 +914,78 @@ func (p pipeline) Keys() []string {
 	return keys
 }
 
+func (p pipeline) ReadOnly() bool {
+	for _, cmd := range p {
+		if !isReadOnly(cmd) {
+			return false
+		}
+	}
+	return true
+}
+
+// chunkLen returns the number of CmdActions in the first chunk of the
+// pipeline, given the maximum number of commands and approximate number of
+// bytes a chunk may have. Zero means no limit. A chunk always has at least one
+// CmdAction in it.
+//
+// A MULTI/EXEC transaction is never split across chunks, as the Conn would be
+// left inside of it if a later chunk isn't performed. The chunk is instead
+// ended before the MULTI or, if the chunk starts with it, extended to the EXEC.
+func (p pipeline) chunkLen(maxCmds, maxBytes int) int {
+	n := len(p)
+	if maxCmds > 0 && maxCmds < n {
+		n = maxCmds
+	}
+	if maxBytes > 0 {
+		var size int
+		for i, cmd := range p[:n] {
+			// the size of custom CmdActions can't be known without marshaling
+			// them, so they're assumed to be small.
+			if cmdA, ok := cmd.(*cmdAction); ok {
+				size += cmdA.approxSize()
+			}
+			if size > maxBytes && i > 0 {
+				n = i
+				break
+			}
+		}
+	}
+	if n == len(p) {
+		return n
+	}
+
+	multiAt := -1
+	for i, cmd := range p[:n] {
+		switch pipelineCmdName(cmd) {
+		case "MULTI":
+			multiAt = i
+		case "EXEC", "DISCARD":
+			multiAt = -1
+		}
+	}
+	if multiAt > 0 {
+		return multiAt
+	} else if multiAt == 0 {
+		for ; n < len(p); n++ {
+			if name := pipelineCmdName(p[n]); name == "EXEC" || name == "DISCARD" {
+				return n + 1
+			}
+		}
+	}
+	return n
+}
+
+// pipelineCmdName returns the upper-cased name of the command the CmdAction
+// performs, or "" if it doesn't perform exactly one.
+func pipelineCmdName(cmd CmdAction) string {
+	if cmdA, ok := cmd.(*cmdAction); ok {
+		return strings.ToUpper(cmdA.cmd)
+	} else if cmds := ActionProperties(cmd).Commands; len(cmds) == 1 {
+		return cmds[0]
+	}
+	return ""
+}
+
 func (p pipeline) Run(c Conn) error {
 	if err := c.Encode(p); err != nil {
 		return err
@@ -553,6 +1007,176 @@ func (p pipeline) drain(c Conn, n int) {
 	}
 }
 
+type chunkedPipeline struct {
+	pipeline
+	maxCmds, maxBytes int
+}
+
+// ChunkedPipeline is like Pipeline, but splits the CmdActions into chunks of at
+// most maxCmds commands, or approximately maxBytes bytes, which are each
+// written and then read before the next chunk is written. Zero means no limit.
+// All chunks are performed on the same Conn.
+//
+// This bounds the memory used for very large pipelines, both on the client and
+// in the server's output buffer for the connection, at the cost of a round-trip
+// per chunk. A MULTI/EXEC transaction is never split across chunks.
+//
+// As with Pipeline, the first error encountered is returned, and the responses
+// of the CmdActions following it are discarded. Those CmdActions are still
+// performed though, including those in later chunks, unless the error left the
+// Conn unusable (e.g. a network error), in which case the Conn is discarded.
+//
+// See also PoolPipelineChunks, which does this for all pipelines performed on a
+// Pool.
+func ChunkedPipeline(maxCmds, maxBytes int, cmds ...CmdAction) Action {
+	return chunkedPipeline{pipeline: pipeline(cmds), maxCmds: maxCmds, maxBytes: maxBytes}
+}
+
+func (p chunkedPipeline) Run(c Conn) error {
+	var firstErr error
+	for rest := p.pipeline; len(rest) > 0; {
+		n := rest.chunkLen(p.maxCmds, p.maxBytes)
+		chunk := rest[:n]
+		rest = rest[n:]
+
+		if err := c.Encode(chunk); err != nil {
+			discardConn(c, err)
+			return err
+		}
+
+		for _, cmd := range chunk {
+			var err error
+			if firstErr == nil {
+				err = c.Decode(cmd)
+			} else {
+				err = c.Decode(&resp2.Any{})
+			}
+
+			if err == nil {
+				continue
+			} else if !xerrors.As(err, new(resp.ErrDiscarded)) {
+				// the rest of the responses can't be read, so the Conn is
+				// left in an unknown state.
+				discardConn(c, err)
+				return decodeErr(cmd, err)
+			} else if firstErr == nil {
+				firstErr = decodeErr(cmd, err)
+			}
+		}
+	}
+	return firstErr
+}
+
+// chunkPipeline returns the Action with the given chunk limits applied, if
+// it's a pipeline created using Pipeline or PartialPipeline. Otherwise the
+// Action is returned as-is.
+func chunkPipeline(a Action, maxCmds, maxBytes int) Action {
+	switch a := a.(type) {
+	case pipeline:
+		return chunkedPipeline{pipeline: a, maxCmds: maxCmds, maxBytes: maxBytes}
+	case partialPipeline:
+		a.maxCmds, a.maxBytes = maxCmds, maxBytes
+		return a
+	default:
+		return a
+	}
+}
+
+// PipelineResults holds the error of each CmdAction of a pipeline created using
+// PartialPipeline, in the order the CmdActions were given. The error of a
+// CmdAction which succeeded is nil.
+type PipelineResults []error
+
+// Err returns the first non-nil error in PipelineResults, or nil if all
+// CmdActions succeeded.
+func (r PipelineResults) Err() error {
+	for _, err := range r {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Failed returns the indices of the CmdActions which failed.
+func (r PipelineResults) Failed() []int {
+	var failed []int
+	for i, err := range r {
+		if err != nil {
+			failed = append(failed, i)
+		}
+	}
+	return failed
+}
+
+type partialPipeline struct {
+	pipeline
+	res *PipelineResults
+
+	// set by chunkPipeline
+	maxCmds, maxBytes int
+}
+
+// PartialPipeline is like Pipeline, but rather than stopping at the first
+// CmdAction which returns an error, the error is recorded in res and the rest
+// of the CmdActions are still read. Once the Action has been performed res
+// will hold the error of each CmdAction, and the successful CmdActions will
+// have unmarshaled their responses into their receivers as normal.
+//
+// Errors which leave the Conn unusable, e.g. network errors, are still
+// returned from the Action's Run method. In that case every CmdAction whose
+// response wasn't read is given that error in res. Otherwise Run returns nil,
+// and res must be checked for errors.
+//
+// Unlike Pipeline, when chunked by PoolPipelineChunks a PartialPipeline
+// continues on to the following chunks after a CmdAction fails.
+func PartialPipeline(res *PipelineResults, cmds ...CmdAction) Action {
+	return partialPipeline{pipeline: pipeline(cmds), res: res}
+}
+
+func (p partialPipeline) Run(c Conn) error {
+	res := make(PipelineResults, len(p.pipeline))
+	*p.res = res
+
+	for offset := 0; offset < len(p.pipeline); {
+		chunk := p.pipeline[offset:]
+		chunk = chunk[:chunk.chunkLen(p.maxCmds, p.maxBytes)]
+		if err := runPartialChunk(c, chunk, res[offset:]); err != nil {
+			return err
+		}
+		offset += len(chunk)
+	}
+	return nil
+}
+
+// runPartialChunk performs the given CmdActions as a single pipeline, storing
+// the error of each in res. Errors which leave the Conn unusable are also
+// stored for all subsequent CmdActions, and returned.
+func runPartialChunk(c Conn, chunk pipeline, res PipelineResults) error {
+	fail := func(i int, err error) error {
+		for j := i; j < len(res); j++ {
+			res[j] = err
+		}
+		return err
+	}
+
+	if err := c.Encode(chunk); err != nil {
+		return fail(0, err)
+	}
+
+	for i, cmd := range chunk {
+		err := c.Decode(cmd)
+		if err == nil {
+			continue
+		} else if xerrors.As(err, new(resp.ErrDiscarded)) {
+			res[i] = decodeErr(cmd, err)
+			continue
+		}
+		return fail(i, decodeErr(cmd, err))
+	}
+	return nil
+}
+
 func decodeErr(cmd CmdAction, err error) error {
 	c, ok := cmd.(*cmdAction)
 	if ok {
@@ -595,6 +1219,9 @@ func (p pipeline) MarshalRESP(w io.Writer) error {
 type withConn struct {
 	key [1]string // use array to avoid allocation in Keys
 	fn  func(Conn) error
+
+	// ctx is set if the withConn was created by WithConnContext.
+	ctx *withConnCtx
 }
 
 // WithConn is used to perform a set of independent Actions on the same Conn.
@@ -610,7 +1237,7 @@ type withConn struct {
 // Conn, it doesn't make them transactional. Use MULTI/WATCH/EXEC within a
 // WithConn for transactions, or use EvalScript
 func WithConn(key string, fn func(Conn) error) Action {
-	return &withConn{[1]string{key}, fn}
+	return &withConn{key: [1]string{key}, fn: fn}
 }
 
 func (wc *withConn) Keys() []string {
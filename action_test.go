@@ -4,7 +4,9 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"strconv"
 	. "testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -145,6 +147,69 @@ func TestFlatCmdActionEmpty(t *T) {
 	require.True(t, nilVal.EmptyArray)
 }
 
+func TestCmdActionUnmarshalError(t *T) {
+	conn := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		return []string{"1", "two", "3"}
+	})
+
+	var into []int
+	err := conn.Do(Cmd(&into, "LRANGE", "foo", "0", "-1"))
+	require.Error(t, err)
+
+	var ue *resp2.UnmarshalError
+	require.True(t, xerrors.As(err, &ue))
+	assert.Equal(t, "LRANGE", ue.Cmd)
+	assert.Equal(t, []int{1}, ue.Path)
+	assert.Contains(t, err.Error(), "LRANGE reply: can't unmarshal bulk-string into int at index [1]")
+
+	// the connection should still be usable
+	var into2 []string
+	require.NoError(t, conn.Do(Cmd(&into2, "LRANGE", "foo", "0", "-1")))
+	assert.Equal(t, []string{"1", "two", "3"}, into2)
+}
+
+func TestFlatCmdActionMarshalBuffers(t *T) {
+	large := bytes.Repeat([]byte("a"), zeroCopyMinSize)
+	small := []byte("bar")
+
+	type test struct {
+		args   []interface{}
+		expOK  bool
+		expLen int // number of buffers
+	}
+	tests := []test{
+		{args: []interface{}{small}, expOK: false},
+		{args: []interface{}{1, large}, expOK: false},
+		{args: []interface{}{large}, expOK: true, expLen: 3},
+		{args: []interface{}{"foo", small, large, "baz"}, expOK: true, expLen: 3},
+		{args: []interface{}{[][]byte{large, small, large}}, expOK: true, expLen: 5},
+	}
+
+	for i, test := range tests {
+		c := FlatCmd(nil, "RPUSH", "key", test.args...).(*cmdAction)
+		scratch := []byte{}
+		bufs, ok := c.marshalBuffers(&scratch)
+		if !assert.Equal(t, test.expOK, ok, "test:%d", i) || !ok {
+			continue
+		}
+		assert.Len(t, bufs, test.expLen, "test:%d", i)
+
+		// the large values must not have been copied
+		for _, b := range bufs {
+			if len(b) == len(large) {
+				assert.True(t, &b[0] == &large[0], "test:%d", i)
+			}
+		}
+
+		exp := new(bytes.Buffer)
+		require.NoError(t, c.MarshalRESP(exp))
+		got := new(bytes.Buffer)
+		_, err := bufs.WriteTo(got)
+		require.NoError(t, err)
+		assert.Equal(t, exp.String(), got.String(), "test:%d", i)
+	}
+}
+
 func ExampleFlatCmd() {
 	client, err := NewPool("tcp", "127.0.0.1:6379", 10) // or any other client
 	if err != nil {
@@ -171,6 +236,67 @@ func ExampleFlatCmd() {
 	}
 }
 
+func TestCmdActionBlockTimeout(t *T) {
+	type test struct {
+		a        Action
+		blocking bool
+		exp      time.Duration
+	}
+
+	tests := []test{
+		{a: Cmd(nil, "GET", "foo")},
+		{a: Cmd(nil, "BLPOP", "foo", "bar", "1.5"), blocking: true, exp: 1500 * time.Millisecond},
+		{a: Cmd(nil, "brpop", "foo", "0"), blocking: true, exp: -1},
+		{a: FlatCmd(nil, "BLMOVE", "foo", "bar", "LEFT", "RIGHT", 2), blocking: true, exp: 2 * time.Second},
+		{a: Cmd(nil, "BLMPOP", "3", "1", "foo", "LEFT"), blocking: true, exp: 3 * time.Second},
+		{a: Cmd(nil, "WAIT", "1", "250"), blocking: true, exp: 250 * time.Millisecond},
+		{a: Cmd(nil, "XREAD", "COUNT", "1", "STREAMS", "foo", "0")},
+		{a: Cmd(nil, "XREAD", "BLOCK", "100", "STREAMS", "foo", "$"), blocking: true, exp: 100 * time.Millisecond},
+		{a: Cmd(nil, "XREADGROUP", "GROUP", "g", "c", "BLOCK", "0", "STREAMS", "foo", ">"), blocking: true, exp: -1},
+		{a: Cmd(nil, "SAVE"), blocking: true},
+		{a: Cmd(nil, "BLPOP", "foo", "bar"), blocking: true},
+	}
+
+	for _, test := range tests {
+		d, blocking := test.a.(*cmdAction).blockTimeout()
+		assert.Equal(t, test.blocking, blocking, test.a)
+		assert.Equal(t, test.exp, d, test.a)
+	}
+}
+
+func TestCmdActionMPopKeys(t *T) {
+	tests := []struct {
+		a   CmdAction
+		exp []string
+	}{
+		{a: Cmd(nil, "LMPOP", "2", "a", "b", "LEFT"), exp: []string{"a", "b"}},
+		{a: Cmd(nil, "ZMPOP", "1", "a", "MIN"), exp: []string{"a"}},
+		{a: Cmd(nil, "BLMPOP", "1.5", "2", "a", "b", "LEFT"), exp: []string{"a", "b"}},
+		{a: Cmd(nil, "BZMPOP", "0", "1", "a", "MAX"), exp: []string{"a"}},
+		{a: Cmd(nil, "BLMPOP", "0")},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.exp, test.a.Keys(), test.a)
+	}
+}
+
+func TestCmdActionRawMessage(t *T) {
+	conn := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		return args
+	})
+
+	var raw resp2.RawMessage
+	arg := resp2.RawMessage("$3\r\nbar\r\n")
+	require.NoError(t, conn.Do(FlatCmd(&raw, "ECHO", "foo", arg)))
+	assert.Equal(t, "*3\r\n$4\r\nECHO\r\n$3\r\nfoo\r\n$3\r\nbar\r\n", string(raw))
+
+	// the captured reply can be replayed as-is
+	var into []string
+	require.NoError(t, raw.UnmarshalInto(resp2.Any{I: &into}))
+	assert.Equal(t, []string{"ECHO", "foo", "bar"}, into)
+}
+
 func TestEvalAction(t *T) {
 	getSet := NewEvalScript(1, `
 		local prev = redis.call("GET", KEYS[1])
@@ -389,6 +515,29 @@ func ExampleWithConn_transaction() {
 	fmt.Printf("the value of key %q was %q\n", key, prevVal)
 }
 
+func TestReadOnly(t *T) {
+	assert.True(t, isReadOnly(Cmd(nil, "GET", "foo")))
+	assert.True(t, isReadOnly(Cmd(nil, "hgetall", "foo")))
+	assert.False(t, isReadOnly(Cmd(nil, "SET", "foo", "bar")))
+	assert.True(t, isReadOnly(FlatCmd(nil, "MGET", "foo", "bar")))
+	assert.False(t, isReadOnly(WithConn("foo", nil)))
+
+	assert.True(t, isReadOnly(Pipeline(
+		Cmd(nil, "GET", "foo"),
+		Cmd(nil, "TTL", "foo"),
+	)))
+	assert.False(t, isReadOnly(Pipeline(
+		Cmd(nil, "GET", "foo"),
+		Cmd(nil, "INCR", "foo"),
+	)))
+
+	assert.True(t, isReadOnly(ReadOnly(WithConn("foo", nil))))
+	roCmd := ReadOnly(Cmd(nil, "EVAL", "return 1", "0"))
+	assert.True(t, isReadOnly(roCmd))
+	_, isCmdAction := roCmd.(CmdAction)
+	assert.True(t, isCmdAction)
+}
+
 func TestMaybeNil(t *T) {
 	mntests := []struct {
 		b       string
@@ -427,6 +576,21 @@ func TestMaybeNil(t *T) {
 			}
 		}
 	}
+
+	// a MaybeNil can be reused, and can be used to find nil elements of an
+	// array.
+	var a, b string
+	mnA, mnB := MaybeNil{Rcv: &a}, MaybeNil{Rcv: &b}
+	br := bufio.NewReader(bytes.NewBufferString("*2\r\n$-1\r\n$0\r\n\r\n*2\r\n$1\r\na\r\n$-1\r\n"))
+	require.NoError(t, Tuple{&mnA, &mnB}.UnmarshalRESP(br))
+	assert.True(t, mnA.Nil)
+	assert.False(t, mnB.Nil)
+	assert.Equal(t, "", b)
+
+	require.NoError(t, Tuple{&mnA, &mnB}.UnmarshalRESP(br))
+	assert.False(t, mnA.Nil)
+	assert.Equal(t, "a", a)
+	assert.True(t, mnB.Nil)
 }
 
 func ExampleMaybeNil() {
@@ -528,3 +692,134 @@ func BenchmarkWithConnKeys(b *B) {
 		benchCmdActionKeys = WithConn("a", func(Conn) error { return nil }).Keys()
 	}
 }
+
+func TestPartialPipeline(t *T) {
+	stub := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		if args[0] == "INCR" {
+			return resp2.Error{E: xerrors.New("ERR value is not an integer or out of range")}
+		}
+		return args[1]
+	})
+
+	var res PipelineResults
+	var a, c string
+	var b int
+	err := stub.Do(PartialPipeline(&res,
+		Cmd(&a, "ECHO", "foo"),
+		Cmd(&b, "INCR", "bar"),
+		Cmd(&c, "ECHO", "baz"),
+	))
+	require.NoError(t, err)
+	assert.Len(t, res, 3)
+	assert.Equal(t, []int{1}, res.Failed())
+	assert.Equal(t, res[1], res.Err())
+	assert.Contains(t, res.Err().Error(), "not an integer")
+	assert.Equal(t, "foo", a)
+	assert.Equal(t, "baz", c)
+
+	require.NoError(t, stub.Do(PartialPipeline(&res, Cmd(&a, "ECHO", "bar"))))
+	assert.Equal(t, PipelineResults{nil}, res)
+	assert.NoError(t, res.Err())
+	assert.Equal(t, "bar", a)
+}
+
+type encodeCountConn struct {
+	Conn
+	encodes int
+}
+
+func (ec *encodeCountConn) Encode(m resp.Marshaler) error {
+	ec.encodes++
+	return ec.Conn.Encode(m)
+}
+
+func (ec *encodeCountConn) Do(a Action) error {
+	return a.Run(ec)
+}
+
+func TestChunkedPipeline(t *T) {
+	stub := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		if args[1] == "err" {
+			return resp2.Error{E: xerrors.New("ERR bad")}
+		}
+		return args[1]
+	})
+
+	newCmds := func(n int, out []string) []CmdAction {
+		cmds := make([]CmdAction, n)
+		for i := range cmds {
+			cmds[i] = Cmd(&out[i], "ECHO", strconv.Itoa(i))
+		}
+		return cmds
+	}
+
+	t.Run("count", func(t *T) {
+		conn := &encodeCountConn{Conn: stub}
+		out := make([]string, 10)
+		require.NoError(t, conn.Do(ChunkedPipeline(3, 0, newCmds(10, out)...)))
+		assert.Equal(t, 4, conn.encodes)
+		for i := range out {
+			assert.Equal(t, strconv.Itoa(i), out[i])
+		}
+	})
+
+	t.Run("bytes", func(t *T) {
+		conn := &encodeCountConn{Conn: stub}
+		out := make([]string, 10)
+		// each command is approximately 21 bytes
+		require.NoError(t, conn.Do(ChunkedPipeline(0, 60, newCmds(10, out)...)))
+		assert.Equal(t, 5, conn.encodes)
+		assert.Equal(t, "9", out[9])
+	})
+
+	t.Run("err", func(t *T) {
+		conn := &encodeCountConn{Conn: stub}
+		out := make([]string, 10)
+		cmds := newCmds(10, out)
+		cmds[1] = Cmd(nil, "ECHO", "err")
+		cmds[7] = Cmd(nil, "ECHO", "err")
+
+		// every chunk is still performed, with the first error returned
+		err := conn.Do(ChunkedPipeline(3, 0, cmds...))
+		var respErr resp2.Error
+		require.True(t, xerrors.As(err, &respErr))
+		assert.Equal(t, 4, conn.encodes)
+		assert.Equal(t, "0", out[0])
+		assert.Empty(t, out[2])
+
+		// and the Conn can still be used
+		var s string
+		require.NoError(t, conn.Do(Cmd(&s, "ECHO", "foo")))
+		assert.Equal(t, "foo", s)
+	})
+
+	t.Run("multi", func(t *T) {
+		out := make([]string, 10)
+		cmds := newCmds(10, out)
+		cmds[2] = Cmd(nil, "MULTI")
+		cmds[4] = Cmd(nil, "EXEC")
+		cmds[6] = Cmd(nil, "MULTI")
+		cmds[9] = Cmd(nil, "EXEC")
+		p := pipeline(cmds)
+
+		// the first chunk ends before the MULTI, rather than within it
+		assert.Equal(t, 2, p.chunkLen(3, 0))
+		// a chunk starting with MULTI is extended to the EXEC
+		assert.Equal(t, 3, p[2:].chunkLen(2, 0))
+		assert.Equal(t, 2, p[4:].chunkLen(2, 0))
+		assert.Equal(t, 4, p[6:].chunkLen(1, 0))
+	})
+
+	t.Run("partial", func(t *T) {
+		conn := &encodeCountConn{Conn: stub}
+		out := make([]string, 5)
+		cmds := newCmds(5, out)
+		cmds[1] = Cmd(nil, "ECHO", "err")
+
+		var res PipelineResults
+		require.NoError(t, conn.Do(chunkPipeline(PartialPipeline(&res, cmds...), 2, 0)))
+		assert.Equal(t, 3, conn.encodes)
+		assert.Equal(t, []int{1}, res.Failed())
+		assert.Equal(t, "4", out[4])
+	})
+}
@@ -0,0 +1,57 @@
+package radix
+
+// AffinityAction is an Action which has an affinity key. Clients which support
+// key affinity, such as a Pool created with PoolKeyAffinity, will always
+// perform Actions with the same affinity key on the same connection, one at a
+// time and in the order they were given.
+type AffinityAction interface {
+	Action
+	AffinityKey() string
+}
+
+func actionAffinityKey(a Action) (string, bool) {
+	for {
+		if aa, ok := a.(AffinityAction); ok {
+			return aa.AffinityKey(), true
+		} else if wa, ok := a.(wrappedAction); ok {
+			a = wa.unwrapAction()
+		} else {
+			return "", false
+		}
+	}
+}
+
+type affinityAction struct {
+	Action
+	key string
+}
+
+func (aa affinityAction) unwrapAction() Action {
+	return aa.Action
+}
+
+func (aa affinityAction) AffinityKey() string {
+	return aa.key
+}
+
+func (aa affinityAction) ReadOnly() bool {
+	return isReadOnly(aa.Action)
+}
+
+func (aa affinityAction) ClusterCanRetry() bool {
+	return canClusterRetry(aa.Action)
+}
+
+// WithAffinityKey wraps the given Action such that it implements
+// AffinityAction, with its AffinityKey method returning the given key. Clients
+// which don't support key affinity perform the returned Action as normal.
+//
+// The key needn't be one of the keys the Action operates on, e.g. it could be
+// the ID of a user whose keys are all operated on by the Action.
+//
+// NOTE that the returned Action is never a CmdAction, even if the given one is,
+// so that a Pool will perform it on its affinity connection rather than
+// implicitly pipelining it.
+func WithAffinityKey(a Action, key string) Action {
+	return affinityAction{Action: a, key: key}
+}
@@ -0,0 +1,268 @@
+package radix
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mediocregopher/radix/v3/resp"
+)
+
+// AuditRedacted is what redacted arguments are replaced with in AuditEntries.
+const AuditRedacted = "[REDACTED]"
+
+// AuditEntry describes a single command performed on a Conn wrapped by an
+// Auditor.
+type AuditEntry struct {
+	// Time is when the command was written to the connection.
+	Time time.Time
+
+	// Args is the command's name followed by its arguments, with any which are
+	// redacted replaced by AuditRedacted.
+	Args []string
+
+	// Addr is the address of the redis instance the command was performed on.
+	Addr string
+
+	// Duration is how long it took between the command being written and its
+	// reply being read.
+	Duration time.Duration
+
+	// Err is the error encountered while performing the command, if any. This
+	// may be an error returned by redis, or a network error.
+	Err error
+}
+
+// String returns a single line description of the AuditEntry, suitable for
+// logging.
+func (ae AuditEntry) String() string {
+	var b strings.Builder
+	b.WriteString(ae.Time.UTC().Format(time.RFC3339Nano))
+	b.WriteString(" addr=")
+	b.WriteString(ae.Addr)
+	b.WriteString(" cmd=")
+	b.WriteString(strings.Join(ae.Args, " "))
+	b.WriteString(" duration=")
+	b.WriteString(ae.Duration.String())
+	if ae.Err != nil {
+		b.WriteString(" err=")
+		b.WriteString(ae.Err.Error())
+	} else {
+		b.WriteString(" ok")
+	}
+	return b.String()
+}
+
+type auditOpts struct {
+	redactions map[string]func([]string)
+}
+
+// AuditOpt is an optional behavior which can be applied to the NewAuditor
+// function to effect an Auditor's behavior.
+type AuditOpt func(*auditOpts)
+
+// AuditRedactArgs tells the Auditor to redact the arguments of the given
+// command at index from, and every step indexes after that, where the command's
+// name is at index 0. For example, AuditRedactArgs("HSET", 3, 2) redacts every
+// field value of an HSET, and AuditRedactArgs("AUTH", 1, 1) redacts all
+// arguments of an AUTH.
+//
+// A from of 0 or less removes any redaction for the command, including the
+// default ones.
+func AuditRedactArgs(cmd string, from, step int) AuditOpt {
+	if from <= 0 {
+		return AuditRedactFunc(cmd, nil)
+	}
+	if step <= 0 {
+		step = 1
+	}
+	return AuditRedactFunc(cmd, func(args []string) {
+		for i := from; i < len(args); i += step {
+			args[i] = AuditRedacted
+		}
+	})
+}
+
+// AuditRedactFunc tells the Auditor to redact the given command using fn, which
+// will be given a copy of the command's name and arguments that it can modify
+// in place. This can be used for commands whose sensitive arguments aren't at
+// fixed positions. A nil fn removes any redaction for the command.
+func AuditRedactFunc(cmd string, fn func(args []string)) AuditOpt {
+	return func(ao *auditOpts) {
+		cmd = strings.ToUpper(cmd)
+		if fn == nil {
+			delete(ao.redactions, cmd)
+			return
+		}
+		ao.redactions[cmd] = fn
+	}
+}
+
+// auditRedactHello redacts the password given to the AUTH option of HELLO.
+func auditRedactHello(args []string) {
+	for i := 1; i < len(args)-2; i++ {
+		if strings.EqualFold(args[i], "AUTH") {
+			args[i+2] = AuditRedacted
+		}
+	}
+}
+
+// Auditor passes every command performed on the Conns it wraps to a function,
+// along with its destination and outcome, so that an audit trail can be kept.
+// Arguments of commands which may be sensitive, such as passwords or values
+// being stored, are redacted.
+//
+// As with Recorder, commands which are performed while dialing (e.g. AUTH,
+// SELECT) are not seen when using ConnFunc, since they are performed before the
+// Conn is wrapped.
+type Auditor struct {
+	ao auditOpts
+	fn func(AuditEntry)
+}
+
+// NewAuditor initializes and returns an Auditor which will call fn with an
+// AuditEntry for every command, once its reply has been read. fn is called
+// synchronously, and so should not block.
+//
+// NewAuditor takes in a number of options which can overwrite its default
+// behavior. The default options NewAuditor uses are:
+//
+//	AuditRedactArgs("AUTH", 1, 1)
+//	AuditRedactArgs("SET", 2, 1)
+//	AuditRedactArgs("SETNX", 2, 1)
+//	AuditRedactArgs("SETEX", 3, 1)
+//	AuditRedactArgs("PSETEX", 3, 1)
+//	AuditRedactArgs("GETSET", 2, 1)
+//	AuditRedactArgs("APPEND", 2, 1)
+//	AuditRedactArgs("MSET", 2, 2)
+//	AuditRedactArgs("MSETNX", 2, 2)
+//	AuditRedactArgs("HSET", 3, 2)
+//	AuditRedactArgs("HSETNX", 3, 1)
+//	AuditRedactArgs("HMSET", 3, 2)
+//
+// The password given to the AUTH option of HELLO is also redacted by default.
+func NewAuditor(fn func(AuditEntry), opts ...AuditOpt) *Auditor {
+	a := &Auditor{
+		ao: auditOpts{redactions: map[string]func([]string){}},
+		fn: fn,
+	}
+
+	defaultAuditOpts := []AuditOpt{
+		AuditRedactArgs("AUTH", 1, 1),
+		AuditRedactFunc("HELLO", auditRedactHello),
+		AuditRedactArgs("SET", 2, 1),
+		AuditRedactArgs("SETNX", 2, 1),
+		AuditRedactArgs("SETEX", 3, 1),
+		AuditRedactArgs("PSETEX", 3, 1),
+		AuditRedactArgs("GETSET", 2, 1),
+		AuditRedactArgs("APPEND", 2, 1),
+		AuditRedactArgs("MSET", 2, 2),
+		AuditRedactArgs("MSETNX", 2, 2),
+		AuditRedactArgs("HSET", 3, 2),
+		AuditRedactArgs("HSETNX", 3, 1),
+		AuditRedactArgs("HMSET", 3, 2),
+	}
+	for _, opt := range append(defaultAuditOpts, opts...) {
+		if opt != nil {
+			opt(&(a.ao))
+		}
+	}
+	return a
+}
+
+func (a *Auditor) redact(args []string) []string {
+	if len(args) == 0 {
+		return args
+	}
+	fn := a.ao.redactions[strings.ToUpper(args[0])]
+	if fn == nil {
+		return args
+	}
+	args = append([]string(nil), args...)
+	fn(args)
+	return args
+}
+
+// Wrap returns a Conn which performs all commands on the given Conn, auditing
+// them.
+func (a *Auditor) Wrap(conn Conn) Conn {
+	var addr string
+	if netConn := conn.NetConn(); netConn != nil {
+		if remoteAddr := netConn.RemoteAddr(); remoteAddr != nil {
+			addr = remoteAddr.String()
+		}
+	}
+	return &auditConn{Conn: conn, a: a, addr: addr}
+}
+
+// ConnFunc wraps the given ConnFunc such that all Conns it creates are
+// wrapped using Wrap.
+func (a *Auditor) ConnFunc(cf ConnFunc) ConnFunc {
+	return func(network, addr string) (Conn, error) {
+		conn, err := cf(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return a.Wrap(conn), nil
+	}
+}
+
+type auditConn struct {
+	Conn
+	a    *Auditor
+	addr string
+
+	// l protects pending, which are the entries for commands which have been
+	// encoded but whose replies haven't been decoded yet.
+	l       sync.Mutex
+	pending []AuditEntry
+}
+
+func (ac *auditConn) Do(a Action) error {
+	return a.Run(ac)
+}
+
+func (ac *auditConn) Encode(m resp.Marshaler) error {
+	cmds, err := unmarshalCmds(m)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	entries := make([]AuditEntry, len(cmds))
+	for i, cmd := range cmds {
+		entries[i] = AuditEntry{Time: now, Args: ac.a.redact(cmd), Addr: ac.addr}
+	}
+
+	if err := ac.Conn.Encode(m); err != nil {
+		for _, entry := range entries {
+			entry.Err = err
+			ac.a.fn(entry)
+		}
+		return err
+	}
+
+	ac.l.Lock()
+	ac.pending = append(ac.pending, entries...)
+	ac.l.Unlock()
+	return nil
+}
+
+func (ac *auditConn) Decode(u resp.Unmarshaler) error {
+	err := ac.Conn.Decode(u)
+
+	ac.l.Lock()
+	if len(ac.pending) == 0 {
+		// the reply wasn't for any command, e.g. a pubsub message
+		ac.l.Unlock()
+		return err
+	}
+	entry := ac.pending[0]
+	ac.pending = ac.pending[1:]
+	ac.l.Unlock()
+
+	entry.Duration = time.Since(entry.Time)
+	entry.Err = err
+	ac.a.fn(entry)
+	return err
+}
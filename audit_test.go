@@ -0,0 +1,55 @@
+package radix
+
+import (
+	. "testing"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+func TestAuditor(t *T) {
+	var entries []AuditEntry
+	auditor := NewAuditor(func(e AuditEntry) {
+		entries = append(entries, e)
+	}, AuditRedactArgs("GET", 1, 1), AuditRedactArgs("SET", 0, 0))
+
+	conn := auditor.Wrap(Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		if args[0] == "BAD" {
+			return resp2.Error{E: errors.New("ERR unknown command")}
+		}
+		return resp2.SimpleString{S: "OK"}
+	}))
+
+	require.NoError(t, conn.Do(Cmd(nil, "AUTH", "user", "pass")))
+	require.NoError(t, conn.Do(Pipeline(
+		Cmd(nil, "HSET", "h", "f1", "v1", "f2", "v2"),
+		Cmd(nil, "HELLO", "3", "AUTH", "user", "pass"),
+		Cmd(nil, "GET", "k"),
+		Cmd(nil, "SET", "k", "v"),
+	)))
+	assert.Error(t, conn.Do(Cmd(nil, "BAD")))
+
+	require.Len(t, entries, 6)
+	for i, exp := range [][]string{
+		{"AUTH", AuditRedacted, AuditRedacted},
+		{"HSET", "h", "f1", AuditRedacted, "f2", AuditRedacted},
+		{"HELLO", "3", "AUTH", "user", AuditRedacted},
+		{"GET", AuditRedacted},
+		{"SET", "k", "v"},
+		{"BAD"},
+	} {
+		assert.Equal(t, exp, entries[i].Args, "entry:%d", i)
+		assert.Equal(t, "127.0.0.1:6379", entries[i].Addr)
+		assert.False(t, entries[i].Time.IsZero())
+	}
+	for _, e := range entries[:5] {
+		assert.NoError(t, e.Err)
+	}
+	assert.Error(t, entries[5].Err)
+	assert.Contains(t, entries[5].String(), "cmd=BAD")
+	assert.Contains(t, entries[5].String(), "err=ERR unknown command")
+}
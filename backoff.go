@@ -0,0 +1,52 @@
+package radix
+
+import (
+	"math"
+	mrand "math/rand"
+	"time"
+)
+
+// Backoff determines how long to wait between consecutive failed attempts at
+// something, e.g. reconnecting to a redis instance. It's used by Pool,
+// Sentinel and PersistentPubSub, see PoolReconnectBackoff and friends.
+//
+// Implementations must be safe for concurrent use.
+type Backoff interface {
+	// Next returns how long to wait after the given number of consecutive
+	// failed attempts, starting at 1.
+	Next(attempts int) time.Duration
+}
+
+// BackoffFunc is a function which implements the Backoff interface.
+type BackoffFunc func(attempts int) time.Duration
+
+// Next implements the method for the Backoff interface.
+func (bf BackoffFunc) Next(attempts int) time.Duration {
+	return bf(attempts)
+}
+
+// ConstantBackoff returns a Backoff which always waits for the given duration.
+func ConstantBackoff(d time.Duration) Backoff {
+	return BackoffFunc(func(int) time.Duration { return d })
+}
+
+// ExponentialBackoff returns a Backoff which waits for initial after the first
+// failed attempt, and twice as long after each one after that, up to max.
+//
+// jitter is the fraction, between 0 and 1, by which each wait is randomly
+// shortened, so that many clients which fail at the same time (e.g. because the
+// redis instance they're connected to restarted) don't all retry at the same
+// time. With a jitter of 0 the waits are deterministic.
+func ExponentialBackoff(initial, max time.Duration, jitter float64) Backoff {
+	return BackoffFunc(func(attempts int) time.Duration {
+		if attempts < 1 {
+			attempts = 1
+		}
+		d := float64(initial) * math.Pow(2, float64(attempts-1))
+		if d > float64(max) {
+			d = float64(max)
+		}
+		d -= d * jitter * mrand.Float64()
+		return time.Duration(d)
+	})
+}
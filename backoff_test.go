@@ -0,0 +1,64 @@
+package radix
+
+import (
+	"sync"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+)
+
+func TestExponentialBackoff(t *T) {
+	b := ExponentialBackoff(100*time.Millisecond, time.Second, 0)
+	for attempts, exp := range map[int]time.Duration{
+		0:  100 * time.Millisecond,
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		3:  400 * time.Millisecond,
+		4:  800 * time.Millisecond,
+		5:  time.Second,
+		50: time.Second,
+	} {
+		assert.Equal(t, exp, b.Next(attempts), "attempts:%d", attempts)
+	}
+
+	b = ExponentialBackoff(100*time.Millisecond, time.Second, 0.5)
+	for i := 0; i < 100; i++ {
+		d := b.Next(3)
+		assert.True(t, d > 200*time.Millisecond && d <= 400*time.Millisecond, "d:%v", d)
+	}
+}
+
+func TestPoolReconnectBackoff(t *T) {
+	var l sync.Mutex
+	var dials int
+	var backoffs []int
+	connFunc := func(network, addr string) (Conn, error) {
+		l.Lock()
+		defer l.Unlock()
+		// fail the second and third dials.
+		if dials++; dials == 2 || dials == 3 {
+			return nil, errors.New("dial failed")
+		}
+		return Stub(network, addr, nil), nil
+	}
+
+	pool, err := NewPool("tcp", "127.0.0.1:6379", 3,
+		PoolConnFunc(connFunc),
+		PoolReconnectBackoff(BackoffFunc(func(attempts int) time.Duration {
+			l.Lock()
+			defer l.Unlock()
+			backoffs = append(backoffs, attempts)
+			return time.Millisecond
+		})),
+	)
+	require.NoError(t, err)
+	<-pool.initDone
+	defer pool.Close()
+
+	l.Lock()
+	defer l.Unlock()
+	assert.Equal(t, []int{1, 2}, backoffs)
+}
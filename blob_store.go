@@ -0,0 +1,338 @@
+package radix
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"strconv"
+	"sync"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+// ErrBlobCorrupt is returned by BlobStore when a chunk of a blob doesn't match
+// the checksum recorded for it in the blob's manifest.
+var ErrBlobCorrupt = errors.New("blob chunk failed checksum verification")
+
+// BlobStoreOpts are the options given to NewBlobStore.
+type BlobStoreOpts struct {
+	// ChunkSize is the maximum size, in bytes, of each chunk a blob is split
+	// into. The default, if ChunkSize is 0, is 256KiB.
+	ChunkSize int
+
+	// Concurrency is the maximum number of chunks which will be read or
+	// written at once by a single call. The default, if Concurrency is 0, is 4.
+	Concurrency int
+
+	// TTL, if non-zero, is the TTL given to blobs when they're stored.
+	TTL time.Duration
+}
+
+// BlobStore stores blobs, i.e. large binary values, by splitting them into
+// chunks which are each stored in their own key, so that no single command or
+// reply needs to hold the whole of a large value. Chunks are read and written
+// in parallel, and checked against CRC-32C checksums when read.
+//
+// Each blob has a manifest, a hash stored at the blob's key, which records the
+// blob's size, chunk size and checksums, along with a randomly generated
+// version. Chunks are stored at keys of the form "key:version:index", and so
+// are distributed across a Cluster rather than all being kept on one node.
+// Storing a blob writes all of its chunks under a new version before
+// atomically replacing the manifest, so readers never see a partially
+// written blob.
+//
+// A BlobStore is safe for concurrent use.
+type BlobStore struct {
+	c    Client
+	opts BlobStoreOpts
+}
+
+// NewBlobStore returns a BlobStore which stores blobs using the given Client.
+func NewBlobStore(c Client, opts BlobStoreOpts) *BlobStore {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = 256 * 1024
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	return &BlobStore{c: c, opts: opts}
+}
+
+var blobCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// blobManifest describes a stored blob.
+type blobManifest struct {
+	version   string
+	size      int64
+	chunkSize int64
+	checksums []uint32
+}
+
+func (m blobManifest) chunkKey(key string, i int) string {
+	return key + ":" + m.version + ":" + strconv.Itoa(i)
+}
+
+func (m blobManifest) args() []string {
+	checksums := make([]byte, len(m.checksums)*4)
+	for i, sum := range m.checksums {
+		binary.BigEndian.PutUint32(checksums[i*4:], sum)
+	}
+	return []string{
+		"version", m.version,
+		"size", strconv.FormatInt(m.size, 10),
+		"chunkSize", strconv.FormatInt(m.chunkSize, 10),
+		"checksums", hex.EncodeToString(checksums),
+	}
+}
+
+func parseBlobManifest(fields map[string]string) (blobManifest, error) {
+	var m blobManifest
+	var err error
+	m.version = fields["version"]
+	if m.size, err = strconv.ParseInt(fields["size"], 10, 64); err != nil {
+		return m, errors.Errorf("parsing blob size: %w", err)
+	} else if m.chunkSize, err = strconv.ParseInt(fields["chunkSize"], 10, 64); err != nil {
+		return m, errors.Errorf("parsing blob chunk size: %w", err)
+	}
+
+	checksums, err := hex.DecodeString(fields["checksums"])
+	if err != nil {
+		return m, errors.Errorf("parsing blob checksums: %w", err)
+	}
+	numChunks := (m.size + m.chunkSize - 1) / m.chunkSize
+	if int64(len(checksums)) != numChunks*4 {
+		return m, errors.Errorf("blob manifest has %d bytes of checksums for %d chunks", len(checksums), numChunks)
+	}
+	m.checksums = make([]uint32, numChunks)
+	for i := range m.checksums {
+		m.checksums[i] = binary.BigEndian.Uint32(checksums[i*4:])
+	}
+	return m, nil
+}
+
+// parallel calls fn with each index in [0, n), with at most Concurrency calls
+// running at once, and returns the first error encountered. No further calls
+// are started once an error is encountered.
+func (bs *BlobStore) parallel(n int, fn func(i int) error) error {
+	var (
+		wg    sync.WaitGroup
+		l     sync.Mutex
+		err   error
+		semCh = make(chan struct{}, bs.opts.Concurrency)
+	)
+	for i := 0; i < n; i++ {
+		semCh <- struct{}{}
+		l.Lock()
+		stop := err != nil
+		l.Unlock()
+		if stop {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-semCh }()
+			if fnErr := fn(i); fnErr != nil {
+				l.Lock()
+				if err == nil {
+					err = fnErr
+				}
+				l.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return err
+}
+
+// blobReplaceScript replaces the manifest at KEYS[1] with the fields in ARGV,
+// after the first which is the TTL in milliseconds, returning the version and
+// checksums of the replaced manifest. If ARGV only contains the TTL the
+// manifest is deleted.
+var blobReplaceScript = NewEvalScript(1, `
+	local old = redis.call("HMGET", KEYS[1], "version", "checksums")
+	redis.call("DEL", KEYS[1])
+	if #ARGV > 1 then
+		redis.call("HMSET", KEYS[1], unpack(ARGV, 2))
+		if ARGV[1] ~= "0" then
+			redis.call("PEXPIRE", KEYS[1], ARGV[1])
+		end
+	end
+	return old
+`)
+
+// replaceManifest replaces the manifest of the blob at key, or deletes it if
+// newArgs is nil, and deletes the chunks of the blob it replaced.
+func (bs *BlobStore) replaceManifest(key string, newArgs []string) error {
+	var oldVersion, oldChecksums string
+	oldVersionMN := MaybeNil{Rcv: &oldVersion}
+	keysAndArgs := append([]string{key, durationMS(bs.opts.TTL)}, newArgs...)
+	if err := bs.c.Do(blobReplaceScript.Cmd(Tuple{&oldVersionMN, &oldChecksums}, keysAndArgs...)); err != nil {
+		return err
+	} else if oldVersionMN.Nil {
+		return nil
+	}
+
+	// each checksum is 4 bytes, hex encoded.
+	oldManifest := blobManifest{version: oldVersion}
+	return bs.parallel(len(oldChecksums)/8, func(i int) error {
+		return bs.c.Do(Cmd(nil, "DEL", oldManifest.chunkKey(key, i)))
+	})
+}
+
+// Put stores the value as the blob at key, replacing any existing blob there.
+// Once the new blob has been stored the chunks of the one it replaced are
+// deleted, and an error doing so will be returned even though the new blob was
+// stored successfully.
+func (bs *BlobStore) Put(key string, value []byte) error {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+
+	chunkSize := bs.opts.ChunkSize
+	m := blobManifest{
+		version:   hex.EncodeToString(b),
+		size:      int64(len(value)),
+		chunkSize: int64(chunkSize),
+		checksums: make([]uint32, (len(value)+chunkSize-1)/chunkSize),
+	}
+
+	err := bs.parallel(len(m.checksums), func(i int) error {
+		end := (i + 1) * chunkSize
+		if end > len(value) {
+			end = len(value)
+		}
+		chunk := value[i*chunkSize : end]
+		m.checksums[i] = crc32.Checksum(chunk, blobCRCTable)
+
+		if bs.opts.TTL > 0 {
+			return bs.c.Do(FlatCmd(nil, "SET", m.chunkKey(key, i), chunk, "PX", durationMS(bs.opts.TTL)))
+		}
+		return bs.c.Do(FlatCmd(nil, "SET", m.chunkKey(key, i), chunk))
+	})
+	if err != nil {
+		// clean up whatever chunks were written, on a best-effort basis.
+		bs.parallel(len(m.checksums), func(i int) error {
+			return bs.c.Do(Cmd(nil, "DEL", m.chunkKey(key, i)))
+		})
+		return err
+	}
+
+	return bs.replaceManifest(key, m.args())
+}
+
+// manifest returns the manifest of the blob at key, or false if there isn't
+// one.
+func (bs *BlobStore) manifest(key string) (blobManifest, bool, error) {
+	var fields map[string]string
+	if err := bs.c.Do(Cmd(&fields, "HGETALL", key)); err != nil {
+		return blobManifest{}, false, err
+	} else if len(fields) == 0 {
+		return blobManifest{}, false, nil
+	}
+	m, err := parseBlobManifest(fields)
+	return m, err == nil, err
+}
+
+// errBlobChunkMissing is returned when reading a chunk which doesn't exist,
+// which happens if the blob was replaced or deleted while being read.
+var errBlobChunkMissing = errors.New("blob chunk missing")
+
+// readChunks reads chunks [first, last] of the blob at key into buf, which must
+// be large enough to hold them, verifying each one.
+func (bs *BlobStore) readChunks(key string, m blobManifest, first, last int, buf []byte) error {
+	return bs.parallel(last-first+1, func(i int) error {
+		i += first
+		var chunk []byte
+		mn := MaybeNil{Rcv: &chunk}
+		if err := bs.c.Do(Cmd(&mn, "GET", m.chunkKey(key, i))); err != nil {
+			return err
+		} else if mn.Nil {
+			return errBlobChunkMissing
+		} else if crc32.Checksum(chunk, blobCRCTable) != m.checksums[i] {
+			return errors.Errorf("chunk %d of blob %q: %w", i, key, ErrBlobCorrupt)
+		}
+		copy(buf[int64(i-first)*m.chunkSize:], chunk)
+		return nil
+	})
+}
+
+// GetRange returns up to length bytes of the blob at key, starting at offset.
+// Only the chunks which overlap the range are read, though each of them is
+// read in full so that it can be verified. false is returned if there is no
+// blob at key.
+//
+// If the blob is replaced or deleted while it's being read it will be read
+// again, using its new manifest.
+func (bs *BlobStore) GetRange(key string, offset, length int64) ([]byte, bool, error) {
+	for attempt := 0; ; attempt++ {
+		m, ok, err := bs.manifest(key)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+
+		if offset < 0 {
+			offset = 0
+		}
+		if end := m.size - offset; length > end {
+			length = end
+		}
+		if length <= 0 {
+			return []byte{}, true, nil
+		}
+
+		first, last := int(offset/m.chunkSize), int((offset+length-1)/m.chunkSize)
+		buf := make([]byte, int64(last-first+1)*m.chunkSize)
+		err = bs.readChunks(key, m, first, last, buf)
+		if errors.Is(err, errBlobChunkMissing) && attempt < 2 {
+			continue
+		} else if err != nil {
+			return nil, false, errors.Errorf("reading blob %q: %w", key, err)
+		}
+
+		start := offset - int64(first)*m.chunkSize
+		return buf[start : start+length], true, nil
+	}
+}
+
+// Get returns the blob stored at key, or false if there isn't one.
+//
+// If the blob is replaced or deleted while it's being read it will be read
+// again, using its new manifest.
+func (bs *BlobStore) Get(key string) ([]byte, bool, error) {
+	return bs.GetRange(key, 0, 1<<63-1)
+}
+
+// Delete deletes the blob at key, along with all of its chunks.
+func (bs *BlobStore) Delete(key string) error {
+	return bs.replaceManifest(key, nil)
+}
+
+// Expire sets the TTL of the blob at key, and of all of its chunks. If ttl is
+// zero the blob's TTL is removed, so that it doesn't expire.
+func (bs *BlobStore) Expire(key string, ttl time.Duration) error {
+	m, ok, err := bs.manifest(key)
+	if err != nil || !ok {
+		return err
+	}
+
+	expire := func(k string) CmdAction {
+		if ttl <= 0 {
+			return Cmd(nil, "PERSIST", k)
+		}
+		return Cmd(nil, "PEXPIRE", k, durationMS(ttl))
+	}
+
+	// chunks are expired before the manifest, so they never expire before it
+	// does.
+	if err := bs.parallel(len(m.checksums), func(i int) error {
+		return bs.c.Do(expire(m.chunkKey(key, i)))
+	}); err != nil {
+		return err
+	}
+	return bs.c.Do(expire(key))
+}
@@ -0,0 +1,151 @@
+package radix
+
+import (
+	"strings"
+	"sync"
+	. "testing"
+	"time"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBlobStoreStub returns a Stub which implements the commands used by
+// BlobStore, including its script, along with the strings and hashes it
+// stores and the keys which have been given a TTL.
+func newBlobStoreStub() (Client, map[string]string, map[string]map[string]string, map[string]bool, *sync.Mutex) {
+	var l sync.Mutex
+	strs := map[string]string{}
+	hashes := map[string]map[string]string{}
+	ttls := map[string]bool{}
+	stub := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		l.Lock()
+		defer l.Unlock()
+		switch args[0] {
+		case "SET":
+			strs[args[1]] = args[2]
+			ttls[args[1]] = len(args) > 3
+			return "OK"
+		case "GET":
+			if v, ok := strs[args[1]]; ok {
+				return v
+			}
+			return nil
+		case "DEL":
+			delete(strs, args[1])
+			delete(ttls, args[1])
+			return 1
+		case "HGETALL":
+			var res []string
+			for k, v := range hashes[args[1]] {
+				res = append(res, k, v)
+			}
+			return res
+		case "PEXPIRE":
+			ttls[args[1]] = true
+			return 1
+		case "PERSIST":
+			ttls[args[1]] = false
+			return 1
+		case "EVALSHA":
+			if args[1] != blobReplaceScript.sum {
+				return resp2.Error{E: errors.New("NOSCRIPT")}
+			}
+			key, ttl, fields := args[3], args[4], args[5:]
+			old := []interface{}{nil, nil}
+			if h, ok := hashes[key]; ok {
+				old = []interface{}{h["version"], h["checksums"]}
+			}
+			delete(hashes, key)
+			delete(ttls, key)
+			if len(fields) > 0 {
+				hashes[key] = map[string]string{}
+				for i := 0; i < len(fields); i += 2 {
+					hashes[key][fields[i]] = fields[i+1]
+				}
+				ttls[key] = ttl != "0"
+			}
+			return old
+		}
+		return resp2.Error{E: errors.Errorf("unexpected command %q", args)}
+	})
+	return stub, strs, hashes, ttls, &l
+}
+
+func TestBlobStore(t *T) {
+	c, strs, hashes, ttls, l := newBlobStoreStub()
+	bs := NewBlobStore(c, BlobStoreOpts{ChunkSize: 4, Concurrency: 3})
+
+	numChunks := func() int {
+		l.Lock()
+		defer l.Unlock()
+		return len(strs)
+	}
+
+	_, ok, err := bs.Get("blob")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	value := []byte("the quick brown fox jumps over the lazy dog")
+	require.NoError(t, bs.Put("blob", value))
+	assert.Equal(t, 11, numChunks())
+
+	got, ok, err := bs.Get("blob")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, value, got)
+
+	for _, test := range []struct {
+		offset, length int64
+		exp            string
+	}{
+		{4, 5, "quick"},
+		{0, 3, "the"},
+		{40, 10, "dog"},
+		{50, 10, ""},
+	} {
+		got, ok, err := bs.GetRange("blob", test.offset, test.length)
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, test.exp, string(got))
+	}
+
+	// replacing a blob deletes the chunks of the old one
+	value = []byte("jumped")
+	require.NoError(t, bs.Put("blob", value))
+	assert.Equal(t, 2, numChunks())
+	got, _, err = bs.Get("blob")
+	require.NoError(t, err)
+	assert.Equal(t, value, got)
+
+	// corrupted chunks are detected
+	l.Lock()
+	for k := range strs {
+		if strings.HasSuffix(k, ":1") {
+			strs[k] = "ep"
+		}
+	}
+	l.Unlock()
+	_, _, err = bs.Get("blob")
+	assert.True(t, errors.Is(err, ErrBlobCorrupt))
+	got, _, err = bs.GetRange("blob", 0, 4)
+	require.NoError(t, err)
+	assert.Equal(t, "jump", string(got))
+
+	require.NoError(t, bs.Expire("blob", time.Minute))
+	l.Lock()
+	assert.Len(t, ttls, 3)
+	for k, ttl := range ttls {
+		assert.True(t, ttl, k)
+	}
+	l.Unlock()
+
+	require.NoError(t, bs.Delete("blob"))
+	assert.Equal(t, 0, numChunks())
+	l.Lock()
+	assert.Empty(t, hashes)
+	l.Unlock()
+}
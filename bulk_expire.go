@@ -0,0 +1,146 @@
+package radix
+
+import (
+	"strconv"
+	"time"
+)
+
+// BulkExpireProgress describes the progress of a BulkExpire call so far.
+type BulkExpireProgress struct {
+	// Scanned is the number of keys which have been scanned so far.
+	Scanned int
+
+	// Changed is the number of keys whose expiration has been changed so far.
+	// When using DryRun this is always zero.
+	Changed int
+}
+
+// BulkExpireOpts are used to configure the behavior of BulkExpire.
+type BulkExpireOpts struct {
+	// Scan is used to scan the keyspace, and is most usefully given a Pattern.
+	// Command defaults to "SCAN", and it may only be "SCAN".
+	Scan ScanOpts
+
+	// TTL is the expiration which is set on each key, using PEXPIRE. If zero
+	// then PERSIST is used to remove the expiration of each key instead.
+	TTL time.Duration
+
+	// OnlyWithoutTTL causes the TTL to only be set on keys which don't already
+	// have one, using the NX option of PEXPIRE. This requires redis 7 or
+	// later.
+	OnlyWithoutTTL bool
+
+	// BatchSize is the number of keys whose expirations are changed at a
+	// time, in a single pipeline. Defaults to 100.
+	BatchSize int
+
+	// BatchInterval is the amount of time to wait in between batches, and is
+	// used to limit the load put on redis.
+	BatchInterval time.Duration
+
+	// DryRun causes the keys to be scanned without their expirations being
+	// changed, which is useful for finding how many keys would be affected.
+	DryRun bool
+
+	// Progress, if set, is called after each batch.
+	Progress func(BulkExpireProgress)
+}
+
+// BulkExpire scans the keyspace, setting or removing the expiration of each key
+// found, and returns the final progress once the scan is complete. This is
+// useful for retrofitting TTLs onto an existing set of keys.
+//
+// If the Client is a *Cluster then every primary in the cluster is scanned,
+// and the expiration of each key is changed individually rather than in a
+// pipeline, since the keys of a batch may belong to different slots.
+//
+// The first error encountered stops the scan and is returned, along with the
+// progress made up to that point.
+func BulkExpire(c Client, opts BulkExpireOpts) (BulkExpireProgress, error) {
+	if opts.Scan.Command == "" {
+		opts.Scan.Command = "SCAN"
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+
+	cluster, isCluster := c.(*Cluster)
+	var s Scanner
+	if isCluster {
+		s = cluster.NewScanner(opts.Scan)
+	} else {
+		s = NewScanner(c, opts.Scan)
+	}
+
+	var prog BulkExpireProgress
+	keys := make([]string, 0, opts.BatchSize)
+	changed := make([]int, opts.BatchSize)
+	cmds := make([]CmdAction, 0, opts.BatchSize)
+
+	flush := func() error {
+		defer func() { keys = keys[:0] }()
+		if len(keys) == 0 {
+			return nil
+		} else if prog.Scanned > 0 && opts.BatchInterval > 0 {
+			time.Sleep(opts.BatchInterval)
+		}
+
+		prog.Scanned += len(keys)
+		if !opts.DryRun {
+			cmds = cmds[:0]
+			for i, key := range keys {
+				changed[i] = 0
+				cmds = append(cmds, bulkExpireCmd(&changed[i], key, opts))
+			}
+
+			var err error
+			if isCluster {
+				for _, cmd := range cmds {
+					if err = c.Do(cmd); err != nil {
+						break
+					}
+				}
+			} else {
+				err = c.Do(Pipeline(cmds...))
+			}
+			if err != nil {
+				return err
+			}
+
+			for i := range keys {
+				prog.Changed += changed[i]
+			}
+		}
+
+		if opts.Progress != nil {
+			opts.Progress(prog)
+		}
+		return nil
+	}
+
+	var key string
+	var err error
+	for err == nil && s.Next(&key) {
+		if keys = append(keys, key); len(keys) >= opts.BatchSize {
+			err = flush()
+		}
+	}
+	if err == nil {
+		err = flush()
+	}
+	if closeErr := s.Close(); err == nil {
+		err = closeErr
+	}
+	return prog, err
+}
+
+func bulkExpireCmd(rcv *int, key string, opts BulkExpireOpts) CmdAction {
+	if opts.TTL <= 0 {
+		return Cmd(rcv, "PERSIST", key)
+	}
+	ms := strconv.FormatInt(int64(opts.TTL/time.Millisecond), 10)
+	if opts.OnlyWithoutTTL {
+		return Cmd(rcv, "PEXPIRE", key, ms, "NX")
+	}
+	return Cmd(rcv, "PEXPIRE", key, ms)
+}
@@ -0,0 +1,57 @@
+package radix
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBulkExpire(t *T) {
+	var cmds [][]string
+	c := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		switch args[0] {
+		case "SCAN":
+			if args[1] == "0" {
+				return []interface{}{"1", []string{"a", "b", "c"}}
+			}
+			return []interface{}{"0", []string{"d", "e"}}
+		default:
+			cmds = append(cmds, args)
+			if args[1] == "b" {
+				return 0 // pretend b already has a TTL
+			}
+			return 1
+		}
+	})
+
+	var progs []BulkExpireProgress
+	prog, err := BulkExpire(c, BulkExpireOpts{
+		TTL:            2 * time.Second,
+		OnlyWithoutTTL: true,
+		BatchSize:      2,
+		Progress: func(p BulkExpireProgress) {
+			progs = append(progs, p)
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, BulkExpireProgress{Scanned: 5, Changed: 4}, prog)
+	assert.Equal(t, []BulkExpireProgress{
+		{Scanned: 2, Changed: 1},
+		{Scanned: 4, Changed: 3},
+		{Scanned: 5, Changed: 4},
+	}, progs)
+	assert.Len(t, cmds, 5)
+	assert.Equal(t, []string{"PEXPIRE", "a", "2000", "NX"}, cmds[0])
+
+	cmds = nil
+	prog, err = BulkExpire(c, BulkExpireOpts{DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, BulkExpireProgress{Scanned: 5}, prog)
+	assert.Empty(t, cmds)
+
+	_, err = BulkExpire(c, BulkExpireOpts{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"PERSIST", "a"}, cmds[0])
+}
@@ -0,0 +1,242 @@
+//go:build go1.18
+// +build go1.18
+
+package radix
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	mrand "math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+// CacheAsideOpts are the options given to NewCacheAside.
+type CacheAsideOpts struct {
+	// TTL is how long loaded values are cached for.
+	//
+	// The default, if TTL is 0, is 1 minute.
+	TTL time.Duration
+
+	// LockTTL, if greater than zero, enables stampede protection using a lock
+	// per key: when a key isn't cached only the caller holding the key's lock
+	// calls the loader, while other callers wait for the value to be cached.
+	// LockTTL is how long the lock is held for at most, and so should be
+	// longer than the loader generally takes. If the lock expires before the
+	// value is cached then another caller will take it and load the value.
+	//
+	// The lock is taken using SingleFlight, and is held in the key suffixed
+	// with ":lock". The context given to the loader is cancelled once the
+	// lock expires.
+	LockTTL time.Duration
+
+	// LockRetryInterval is how often a caller waiting for another to load a
+	// key's value checks whether it's been cached.
+	//
+	// The default, if LockRetryInterval is 0, is 50 milliseconds.
+	LockRetryInterval time.Duration
+
+	// EarlyExpirationBeta, if greater than zero, enables probabilistic early
+	// expiration (also known as XFetch): a cached value may be treated as
+	// expired, and loaded again, shortly before it actually expires, with the
+	// probability increasing as the expiry approaches and the longer the
+	// loader took to load it. This way a popular key is generally reloaded by
+	// a single caller before it expires, rather than by many at once after.
+	// 1 is a good value, larger values cause values to be reloaded earlier.
+	//
+	// When enabled the time taken to load each value is stored alongside it,
+	// so all CacheAsides sharing the same keys must have the same setting.
+	EarlyExpirationBeta float64
+
+	// NotFoundTTL, if greater than zero, enables negative caching: if the
+	// loader returns ErrCacheNotFound, or an error wrapping it, then this is
+	// recorded using CacheNotFound, with NotFoundTTL as the TTL, and Get
+	// returns ErrCacheNotFound without calling the loader until it expires.
+	NotFoundTTL time.Duration
+
+	// Marshal and Unmarshal are used to encode values in order to cache them.
+	//
+	// The defaults, if Marshal or Unmarshal are nil, are json.Marshal and
+	// json.Unmarshal.
+	Marshal   func(v interface{}) ([]byte, error)
+	Unmarshal func(b []byte, v interface{}) error
+}
+
+// CacheAside caches values of type T which are loaded from some slower
+// source, using the cache-aside pattern: a value is read from its key in redis,
+// and only if it's not there is it loaded, using the loader given to
+// NewCacheAside, and then cached with a TTL.
+//
+// CacheAside can optionally protect against cache stampedes, where many
+// callers load the same value at once when it's not cached, see
+// CacheAsideOpts.LockTTL and EarlyExpirationBeta.
+//
+// CacheAside requires Go 1.18 or later.
+type CacheAside[T any] struct {
+	c      Client
+	opts   CacheAsideOpts
+	loader func(ctx context.Context, key string) (T, error)
+}
+
+// NewCacheAside returns a CacheAside which caches values in the given Client,
+// loading them using the given loader when they aren't cached. The key given
+// to the loader is the key the value is cached in.
+//
+// Any changes on opts after calling NewCacheAside will have no effect.
+func NewCacheAside[T any](c Client, opts CacheAsideOpts, loader func(ctx context.Context, key string) (T, error)) *CacheAside[T] {
+	if opts.TTL == 0 {
+		opts.TTL = 1 * time.Minute
+	}
+	if opts.LockRetryInterval == 0 {
+		opts.LockRetryInterval = 50 * time.Millisecond
+	}
+	if opts.Marshal == nil {
+		opts.Marshal = json.Marshal
+	}
+	if opts.Unmarshal == nil {
+		opts.Unmarshal = json.Unmarshal
+	}
+	return &CacheAside[T]{c: c, opts: opts, loader: loader}
+}
+
+type cacheState int
+
+const (
+	cacheMiss cacheState = iota
+	cacheHit
+	// cacheHitRefresh is a hit which early expiration has decided should be
+	// loaded again.
+	cacheHitRefresh
+)
+
+// Get returns the value cached in the given key, loading and caching it first
+// if it's not cached. Errors returned from the loader are returned as-is, and
+// nothing is cached, except for ErrCacheNotFound if NotFoundTTL is set.
+//
+// If the value was loaded but couldn't be cached then both the value and an
+// error are returned.
+func (ca *CacheAside[T]) Get(ctx context.Context, key string) (T, error) {
+	v, state, err := ca.get(key)
+	if err != nil || state == cacheHit {
+		return v, err
+	} else if ca.opts.LockTTL <= 0 {
+		return ca.load(ctx, key)
+	}
+
+	sfOpts := SingleFlightOpts{
+		TTL:           ca.opts.LockTTL,
+		RetryInterval: ca.opts.LockRetryInterval,
+		// if the value is being reloaded early then the cached value is still
+		// valid, and can be used while another caller reloads it.
+		NoWait: state == cacheHitRefresh,
+	}
+	for {
+		var loadErr error
+		ran, err := SingleFlight(ctx, ca.c, key+":lock", sfOpts, func(ctx context.Context) error {
+			// the value may have been cached while the lock was being taken.
+			if v, state, loadErr = ca.get(key); loadErr == nil && state != cacheHit {
+				v, loadErr = ca.load(ctx, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return v, err
+		} else if ran {
+			return v, loadErr
+		} else if sfOpts.NoWait {
+			return v, nil
+		} else if v, state, err = ca.get(key); err != nil || state != cacheMiss {
+			return v, err
+		}
+	}
+}
+
+// Set caches the given value in the given key, e.g. after it's been written to
+// the source which the loader loads from (write-through).
+func (ca *CacheAside[T]) Set(key string, v T) error {
+	return ca.set(key, v, 0)
+}
+
+// Invalidate removes the value cached in the given key, if any, so that it's
+// loaded again the next time Get is called.
+func (ca *CacheAside[T]) Invalidate(key string) error {
+	return ca.c.Do(Cmd(nil, "DEL", key))
+}
+
+func (ca *CacheAside[T]) get(key string) (T, cacheState, error) {
+	var v T
+	var b []byte
+	mn := MaybeNotFound{Rcv: &b}
+	if ca.opts.EarlyExpirationBeta <= 0 {
+		if err := ca.c.Do(Cmd(&mn, "GET", key)); err != nil || mn.Nil {
+			return v, cacheMiss, err
+		} else if mn.NotFound {
+			return v, cacheHit, ErrCacheNotFound
+		} else if err := ca.opts.Unmarshal(b, &v); err != nil {
+			return v, cacheMiss, errors.Errorf("unmarshaling value of %q: %w", key, err)
+		}
+		return v, cacheHit, nil
+	}
+
+	var pttl int64
+	if err := ca.c.Do(Pipeline(Cmd(&mn, "GET", key), Cmd(&pttl, "PTTL", key))); err != nil || mn.Nil {
+		return v, cacheMiss, err
+	} else if mn.NotFound {
+		return v, cacheHit, ErrCacheNotFound
+	}
+
+	// the value is prefixed with the time it took to load it, in ms.
+	i := strings.IndexByte(string(b), ':')
+	if i < 0 {
+		return v, cacheMiss, errors.Errorf("value of %q is missing its load time", key)
+	}
+	deltaMS, err := strconv.ParseInt(string(b[:i]), 10, 64)
+	if err != nil {
+		return v, cacheMiss, errors.Errorf("parsing load time of %q: %w", key, err)
+	} else if err := ca.opts.Unmarshal(b[i+1:], &v); err != nil {
+		return v, cacheMiss, errors.Errorf("unmarshaling value of %q: %w", key, err)
+	}
+
+	// XFetch: reload if now - delta * beta * ln(rand) >= expiry.
+	if pttl >= 0 {
+		early := -float64(deltaMS) * ca.opts.EarlyExpirationBeta * math.Log(1-mrand.Float64())
+		if early >= float64(pttl) {
+			return v, cacheHitRefresh, nil
+		}
+	}
+	return v, cacheHit, nil
+}
+
+func (ca *CacheAside[T]) load(ctx context.Context, key string) (T, error) {
+	start := time.Now()
+	v, err := ca.loader(ctx, key)
+	if errors.Is(err, ErrCacheNotFound) && ca.opts.NotFoundTTL > 0 {
+		if cacheErr := ca.c.Do(CacheNotFound(key, ca.opts.NotFoundTTL)); cacheErr != nil {
+			return v, errors.Errorf("caching not found result of %q: %w", key, cacheErr)
+		}
+		return v, err
+	} else if err != nil {
+		return v, err
+	} else if err := ca.set(key, v, time.Since(start)); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+func (ca *CacheAside[T]) set(key string, v T, delta time.Duration) error {
+	b, err := ca.opts.Marshal(v)
+	if err != nil {
+		return errors.Errorf("marshaling value of %q: %w", key, err)
+	}
+	if ca.opts.EarlyExpirationBeta > 0 {
+		b = append([]byte(strconv.FormatInt(delta.Milliseconds(), 10)+":"), b...)
+	}
+	if err := ca.c.Do(FlatCmd(nil, "SET", key, b, "PX", durationMS(ca.opts.TTL))); err != nil {
+		return errors.Errorf("caching value of %q: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+//go:build go1.18
+// +build go1.18
+
+package radix
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+)
+
+func TestCacheAside(t *T) {
+	type user struct{ Name string }
+	ctx := context.Background()
+
+	t.Run("basic", func(t *T) {
+		var loads int64
+		ca := NewCacheAside(newCacheStub(), CacheAsideOpts{}, func(ctx context.Context, key string) (user, error) {
+			atomic.AddInt64(&loads, 1)
+			if key == "missing" {
+				return user{}, errors.New("not found")
+			}
+			return user{Name: key}, nil
+		})
+
+		for i := 0; i < 3; i++ {
+			u, err := ca.Get(ctx, "alice")
+			require.NoError(t, err)
+			assert.Equal(t, user{Name: "alice"}, u)
+		}
+		assert.Equal(t, int64(1), loads)
+
+		_, err := ca.Get(ctx, "missing")
+		assert.Error(t, err)
+		_, err = ca.Get(ctx, "missing")
+		assert.Error(t, err)
+		assert.Equal(t, int64(3), loads)
+
+		require.NoError(t, ca.Set("alice", user{Name: "Alice"}))
+		u, err := ca.Get(ctx, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, user{Name: "Alice"}, u)
+
+		require.NoError(t, ca.Invalidate("alice"))
+		u, err = ca.Get(ctx, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, user{Name: "alice"}, u)
+		assert.Equal(t, int64(4), loads)
+	})
+
+	t.Run("lock", func(t *T) {
+		var loads int64
+		ca := NewCacheAside(newCacheStub(), CacheAsideOpts{
+			LockTTL:           time.Second,
+			LockRetryInterval: time.Millisecond,
+		}, func(ctx context.Context, key string) (user, error) {
+			atomic.AddInt64(&loads, 1)
+			time.Sleep(20 * time.Millisecond)
+			return user{Name: key}, nil
+		})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				u, err := ca.Get(ctx, "bob")
+				assert.NoError(t, err)
+				assert.Equal(t, user{Name: "bob"}, u)
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int64(1), loads)
+	})
+
+	t.Run("notFound", func(t *T) {
+		var loads int64
+		ca := NewCacheAside(newCacheStub(), CacheAsideOpts{
+			NotFoundTTL: time.Minute,
+		}, func(ctx context.Context, key string) (user, error) {
+			atomic.AddInt64(&loads, 1)
+			return user{}, errors.Errorf("loading %q: %w", key, ErrCacheNotFound)
+		})
+
+		_, err := ca.Get(ctx, "nobody")
+		assert.True(t, errors.Is(err, ErrCacheNotFound))
+		_, err = ca.Get(ctx, "nobody")
+		assert.Equal(t, ErrCacheNotFound, err)
+		assert.Equal(t, int64(1), loads)
+	})
+
+	t.Run("earlyExpiration", func(t *T) {
+		var loads int64
+		ca := NewCacheAside(newCacheStub(), CacheAsideOpts{
+			TTL:                 50 * time.Millisecond,
+			EarlyExpirationBeta: 1,
+		}, func(ctx context.Context, key string) (int64, error) {
+			time.Sleep(20 * time.Millisecond)
+			return atomic.AddInt64(&loads, 1), nil
+		})
+
+		v, err := ca.Get(ctx, "k")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), v)
+
+		// with a load time of 20ms, and only 50ms to live, the value will
+		// generally be reloaded before it expires.
+		var reloadedEarly bool
+		for start := time.Now(); time.Since(start) < 45*time.Millisecond; {
+			if v, err = ca.Get(ctx, "k"); err != nil || v > 1 {
+				reloadedEarly = true
+				break
+			}
+		}
+		require.NoError(t, err)
+		assert.True(t, reloadedEarly)
+	})
+}
@@ -0,0 +1,172 @@
+package radix
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+// SingleFlightOpts are the options given to SingleFlight.
+type SingleFlightOpts struct {
+	// TTL is the longest time the lock is held for. If the callback given to
+	// SingleFlight takes longer than this then it may be run by another
+	// caller at the same time, so the context given to the callback is
+	// cancelled once the TTL elapses.
+	//
+	// The default, if TTL is 0, is 10 seconds.
+	TTL time.Duration
+
+	// RetryInterval is how often a caller waiting for the lock to be released
+	// checks whether it has been.
+	//
+	// The default, if RetryInterval is 0, is 50 milliseconds.
+	RetryInterval time.Duration
+
+	// NoWait causes SingleFlight to return immediately if the lock is held by
+	// another caller, rather than waiting for it to be released.
+	NoWait bool
+}
+
+// SingleFlight ensures that, across all processes sharing the given Client,
+// only one caller at a time runs fn for the given key. It does this by taking
+// a lock held in the key using SET NX, with a TTL, and releasing it once fn
+// returns.
+//
+// If the lock is taken then fn is called, and true is returned along with fn's
+// error. Otherwise SingleFlight waits until the lock is released, or expires,
+// and returns false, at which point the caller can generally read the result
+// of the other caller's fn (e.g. a cached value) rather than running fn
+// itself.
+//
+// If ctx is done while waiting then ctx.Err() is returned.
+func SingleFlight(ctx context.Context, c Client, key string, opts SingleFlightOpts, fn func(ctx context.Context) error) (bool, error) {
+	if opts.TTL == 0 {
+		opts.TTL = 10 * time.Second
+	}
+	if opts.RetryInterval == 0 {
+		opts.RetryInterval = 50 * time.Millisecond
+	}
+
+	token, ok, err := acquireLock(c, key, opts.TTL)
+	if err != nil {
+		return false, err
+	} else if ok {
+		fnCtx, cancel := context.WithTimeout(ctx, opts.TTL)
+		defer cancel()
+		defer releaseLock(c, key, token)
+		return true, fn(fnCtx)
+	} else if opts.NoWait {
+		return false, nil
+	}
+
+	for {
+		if err := waitRetry(ctx, opts.RetryInterval, nil, nil); err != nil {
+			return false, err
+		}
+
+		var n int
+		if err := c.Do(Cmd(&n, "EXISTS", key)); err != nil {
+			return false, err
+		} else if n == 0 {
+			return false, nil
+		}
+	}
+}
+
+// acquireLock attempts to take the lock held in the given key, returning the
+// token it was taken with if it was.
+func acquireLock(c Client, key string, ttl time.Duration) (string, bool, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", false, err
+	}
+	token := hex.EncodeToString(b)
+
+	var mn MaybeNil
+	if err := c.Do(Cmd(&mn, "SET", key, token, "NX", "PX", durationMS(ttl))); err != nil {
+		return "", false, err
+	}
+	return token, !mn.Nil, nil
+}
+
+// releaseLock releases the lock held in the given key, but only if it's still
+// held with the given token, i.e. it hasn't expired and been taken by someone
+// else.
+func releaseLock(c Client, key, token string) error {
+	return c.Do(CompareAndDelete(nil, key, token))
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// CacheNotFoundSentinel is the value stored by CacheNotFound to record that a
+// value doesn't exist. It's chosen so as not to clash with any value which
+// would normally be cached.
+const CacheNotFoundSentinel = "\x00radix:not-found\x00"
+
+// ErrCacheNotFound indicates that a value doesn't exist, as recorded by
+// CacheNotFound. It's also used by CacheAside, see CacheAsideOpts.NotFoundTTL.
+var ErrCacheNotFound = errors.New("not found")
+
+var cacheNotFoundRaw = []byte("$" + strconv.Itoa(len(CacheNotFoundSentinel)) + "\r\n" + CacheNotFoundSentinel + "\r\n")
+
+// CacheNotFound returns an Action which records in the given key that its
+// value doesn't exist in whatever source values are loaded from, using
+// CacheNotFoundSentinel. This is known as negative caching, and prevents
+// repeated lookups of values which don't exist from all reaching the source.
+// The ttl is generally shorter than that used for values which do exist, so
+// that a value which is created is noticed quickly.
+//
+// MaybeNotFound can be used to read the key.
+func CacheNotFound(key string, ttl time.Duration) Action {
+	return Cmd(nil, "SET", key, CacheNotFoundSentinel, "PX", durationMS(ttl))
+}
+
+// MaybeNotFound is like MaybeNil, but it also detects values stored by
+// CacheNotFound. If the value is CacheNotFoundSentinel then NotFound is set to
+// true and Rcv is left untouched.
+//
+// Nil, EmptyArray and NotFound are reset on every unmarshal, so a MaybeNotFound
+// may be reused.
+type MaybeNotFound struct {
+	// Nil and EmptyArray are as in MaybeNil.
+	Nil        bool
+	EmptyArray bool
+
+	// NotFound is set to true if the value was stored by CacheNotFound.
+	NotFound bool
+
+	Rcv interface{}
+}
+
+var _ resp.Unmarshaler = (*MaybeNotFound)(nil)
+
+// UnmarshalRESP implements the method for the resp.Unmarshaler interface.
+func (mnf *MaybeNotFound) UnmarshalRESP(br *bufio.Reader) error {
+	mnf.Nil, mnf.EmptyArray, mnf.NotFound = false, false, false
+	var rm resp2.RawMessage
+	err := rm.UnmarshalRESP(br)
+	switch {
+	case err != nil:
+		return err
+	case bytes.Equal(rm, cacheNotFoundRaw):
+		mnf.NotFound = true
+		return nil
+	case rm.IsNil():
+		mnf.Nil = true
+		return nil
+	case rm.IsEmptyArray():
+		mnf.EmptyArray = true
+		fallthrough
+	default:
+		return rm.UnmarshalInto(resp2.Any{I: mnf.Rcv})
+	}
+}
@@ -0,0 +1,159 @@
+package radix
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+)
+
+// newCacheStub returns a Stub which implements the commands used for caching,
+// including key expiry.
+func newCacheStub() Client {
+	var l sync.Mutex
+	type value struct {
+		v         string
+		expiresAt time.Time
+	}
+	m := map[string]value{}
+	get := func(k string) (value, bool) {
+		v, ok := m[k]
+		if ok && !v.expiresAt.IsZero() && time.Now().After(v.expiresAt) {
+			delete(m, k)
+			return v, false
+		}
+		return v, ok
+	}
+
+	return Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		l.Lock()
+		defer l.Unlock()
+		switch args[0] {
+		case "GET":
+			if v, ok := get(args[1]); ok {
+				return v.v
+			}
+			return nil
+		case "SET":
+			v := value{v: args[2]}
+			for i := 3; i < len(args); i++ {
+				switch args[i] {
+				case "NX":
+					if _, ok := get(args[1]); ok {
+						return nil
+					}
+				case "PX":
+					ms, _ := strconv.Atoi(args[i+1])
+					v.expiresAt = time.Now().Add(time.Duration(ms) * time.Millisecond)
+					i++
+				}
+			}
+			m[args[1]] = v
+			return "OK"
+		case "PTTL":
+			if v, ok := get(args[1]); !ok {
+				return -2
+			} else if v.expiresAt.IsZero() {
+				return -1
+			} else {
+				return time.Until(v.expiresAt).Milliseconds()
+			}
+		case "EXISTS":
+			if _, ok := get(args[1]); ok {
+				return 1
+			}
+			return 0
+		case "DEL":
+			var n int
+			for _, k := range args[1:] {
+				if _, ok := get(k); ok {
+					delete(m, k)
+					n++
+				}
+			}
+			return n
+		case "EVALSHA":
+			// only compareAndDeleteScript is supported
+			if v, ok := get(args[3]); ok && v.v == args[4] {
+				delete(m, args[3])
+				return 1
+			}
+			return 0
+		}
+		return errors.Errorf("unsupported command %q", args[0])
+	})
+}
+
+func TestSingleFlight(t *T) {
+	c := newCacheStub()
+	ctx := context.Background()
+	opts := SingleFlightOpts{TTL: time.Second, RetryInterval: time.Millisecond}
+
+	var calls, ran int64
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := SingleFlight(ctx, c, "lock", opts, func(ctx context.Context) error {
+				atomic.AddInt64(&calls, 1)
+				time.Sleep(20 * time.Millisecond)
+				return nil
+			})
+			assert.NoError(t, err)
+			if ok {
+				atomic.AddInt64(&ran, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(1), calls)
+	assert.Equal(t, int64(1), ran)
+
+	// the lock is released, and fn's error is returned
+	fnErr := errors.New("fn failed")
+	ok, err := SingleFlight(ctx, c, "lock", opts, func(context.Context) error { return fnErr })
+	assert.True(t, ok)
+	assert.Equal(t, fnErr, err)
+
+	// NoWait returns immediately if the lock is held
+	require.NoError(t, c.Do(Cmd(nil, "SET", "lock", "other")))
+	opts.NoWait = true
+	ok, err = SingleFlight(ctx, c, "lock", opts, func(context.Context) error { return nil })
+	assert.False(t, ok)
+	assert.NoError(t, err)
+
+	// waiting is cancelled with the context
+	opts.NoWait = false
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = SingleFlight(ctx, c, "lock", opts, func(context.Context) error { return nil })
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestCacheNotFound(t *T) {
+	c := newCacheStub()
+	require.NoError(t, c.Do(CacheNotFound("a", time.Minute)))
+	require.NoError(t, c.Do(Cmd(nil, "SET", "b", "foo")))
+
+	var s string
+	mnf := MaybeNotFound{Rcv: &s}
+	require.NoError(t, c.Do(Cmd(&mnf, "GET", "a")))
+	assert.True(t, mnf.NotFound)
+	assert.False(t, mnf.Nil)
+	assert.Empty(t, s)
+
+	require.NoError(t, c.Do(Cmd(&mnf, "GET", "b")))
+	assert.False(t, mnf.NotFound)
+	assert.Equal(t, "foo", s)
+
+	require.NoError(t, c.Do(Cmd(&mnf, "GET", "c")))
+	assert.False(t, mnf.NotFound)
+	assert.True(t, mnf.Nil)
+}
@@ -1,7 +1,9 @@
 package radix
 
 import (
+	"net"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -48,18 +50,70 @@ func (d *dedupe) do(fn func()) {
 // Action will be retried on the correct node.
 //
 // NOTE that the Actions which are returned by Cmd, FlatCmd, and EvalScript.Cmd
-// all implicitly implement this interface.
+// all implicitly implement this interface. Actions wrapped by ReadOnly,
+// WithMetadata and the like are retried if the Action they wrap can be.
 type ClusterCanRetryAction interface {
 	Action
 	ClusterCanRetry() bool
 }
 
+// canClusterRetry returns whether the given Action, or the Action it wraps,
+// is a ClusterCanRetryAction whose ClusterCanRetry method returns true.
+func canClusterRetry(a Action) bool {
+	for {
+		if ccra, ok := a.(ClusterCanRetryAction); ok {
+			return ccra.ClusterCanRetry()
+		} else if wa, ok := a.(wrappedAction); ok {
+			a = wa.unwrapAction()
+		} else {
+			return false
+		}
+	}
+}
+
+// ClusterRedirectError is returned from Cluster when an Action received a MOVED
+// or ASK error which could not be followed, either because the Action isn't a
+// ClusterCanRetryAction or because it was redirected too many times.
+//
+// The original resp2.Error can be retrieved from Err using errors.As.
+type ClusterRedirectError struct {
+	// Kind is either "MOVED" or "ASK".
+	Kind string
+
+	// Slot and Addr are the slot and node address given by the redirect.
+	Slot uint16
+	Addr string
+
+	Err error
+}
+
+func (e *ClusterRedirectError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap implements the errors.Wrapper interface.
+func (e *ClusterRedirectError) Unwrap() error {
+	return e.Err
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 
 type clusterOpts struct {
 	pf              ClientFunc
+	secondaryPF     ClientFunc
+	addrPF          map[string]ClientFunc
 	clusterDownWait time.Duration
 	syncEvery       time.Duration
+	latencyEvery    time.Duration
+	eventCh         chan<- ClusterEvent
+	preferHostnames bool
+	remapAddr       func(string) string
+	commandGetKeys  bool
+	routes          []func(Action, []string) string
+	initTopo        ClusterTopo
+	staticTopo      bool
+	zoneFn          func(ClusterNode) string
+	preferZone      string
 	ct              trace.ClusterTrace
 }
 
@@ -80,6 +134,36 @@ func ClusterPoolFunc(pf ClientFunc) ClusterOpt {
 	}
 }
 
+// ClusterSecondaryPoolFunc tells the Cluster to use the given ClientFunc when
+// creating pools of connections to secondary cluster members, rather than the
+// one given by ClusterPoolFunc. This can be used to, for example, give
+// secondaries smaller pools than primaries, or to enable READONLY mode only on
+// connections to secondaries.
+//
+// If a secondary is promoted to primary (or vice-versa) its pool will be
+// recreated using the appropriate ClientFunc during the next synchronization.
+func ClusterSecondaryPoolFunc(pf ClientFunc) ClusterOpt {
+	return func(co *clusterOpts) {
+		co.secondaryPF = pf
+	}
+}
+
+// ClusterAddrPoolFunc tells the Cluster to use the given ClientFunc when
+// creating a pool of connections to the cluster member at the given address,
+// regardless of that member's role. This overrides both ClusterPoolFunc and
+// ClusterSecondaryPoolFunc, and can be used to, for example, give larger pools
+// to the members responsible for hot slots.
+//
+// This option may be given multiple times for different addresses.
+func ClusterAddrPoolFunc(addr string, pf ClientFunc) ClusterOpt {
+	return func(co *clusterOpts) {
+		if co.addrPF == nil {
+			co.addrPF = map[string]ClientFunc{}
+		}
+		co.addrPF[addr] = pf
+	}
+}
+
 // ClusterSyncEvery tells the Cluster to synchronize itself with the cluster's
 // topology at the given interval. On every synchronization Cluster will ask the
 // cluster for its topology and make/destroy its connections as necessary.
@@ -102,6 +186,208 @@ func ClusterOnDownDelayActionsBy(d time.Duration) ClusterOpt {
 	}
 }
 
+// ClusterLatencyBasedReads tells the Cluster to measure the round-trip time of
+// every node in the cluster at the given interval, by timing a PING to each,
+// and to use those measurements when choosing which node to perform an Action
+// on in DoSecondary.
+//
+// When enabled, DoSecondary will perform Actions on whichever of the primary
+// and its secondaries currently has the lowest latency, skipping any nodes
+// which failed their most recent PING. Measurements are smoothed, and reads
+// will only switch away from a healthy node when another node is significantly
+// faster, so that reads don't flap between nodes with similar latencies.
+//
+// If the interval is 0 then latency-based reads are disabled, and DoSecondary
+// will choose a random secondary.
+func ClusterLatencyBasedReads(interval time.Duration) ClusterOpt {
+	return func(co *clusterOpts) {
+		co.latencyEvery = interval
+	}
+}
+
+// ClusterNodeZoneFunc tells the Cluster to call the given function with every
+// node in the cluster's topology, whenever it's synchronized, and to use the
+// returned string as the availability zone of the node (see the Zone field of
+// ClusterNode). For example the zone could be derived from the hostname
+// announced by each node, or looked up by address in a static mapping, see
+// ClusterNodeZones.
+//
+// The function is called after the node's address has been modified according
+// to ClusterPreferHostnames and ClusterRemapAddrs. If this option isn't used
+// the zones given in the topology passed to ClusterInitialTopo or
+// ClusterStaticTopo are used, if any.
+func ClusterNodeZoneFunc(fn func(node ClusterNode) string) ClusterOpt {
+	return func(co *clusterOpts) {
+		co.zoneFn = fn
+	}
+}
+
+// ClusterNodeZones is like ClusterNodeZoneFunc, but uses the given mapping of
+// node address to availability zone.
+func ClusterNodeZones(zones map[string]string) ClusterOpt {
+	return ClusterNodeZoneFunc(func(node ClusterNode) string {
+		return zones[node.Addr]
+	})
+}
+
+// ClusterPreferZone tells the Cluster to prefer nodes in the given
+// availability zone when choosing which node to perform an Action on in
+// DoSecondary, e.g. so that reads don't incur the cost of crossing zones.
+// Zones are assigned to nodes using ClusterNodeZoneFunc or ClusterNodeZones.
+//
+// DoSecondary will choose a secondary in the given zone if there is one,
+// otherwise the primary if it's in the zone, and otherwise falls back to its
+// usual behavior. If ClusterLatencyBasedReads is used then the lowest-latency
+// node in the zone is chosen, as long as one of them is healthy.
+func ClusterPreferZone(zone string) ClusterOpt {
+	return func(co *clusterOpts) {
+		co.preferZone = zone
+	}
+}
+
+// ClusterPreferHostnames tells the Cluster to connect to nodes using the
+// hostname they announce (see the cluster-announce-hostname configuration
+// parameter in redis 7.0 and above), rather than their IP. Nodes which don't
+// announce a hostname are connected to using their IP as usual.
+//
+// The addresses returned from Topo, and used with the Client method, will be
+// the hostname-based addresses.
+func ClusterPreferHostnames() ClusterOpt {
+	return func(co *clusterOpts) {
+		co.preferHostnames = true
+	}
+}
+
+// ClusterRemapAddrs tells the Cluster to pass the address of every node, as
+// reported by the cluster, through the given function, and to use the
+// returned address instead. This is useful when the Cluster is running outside
+// of the network the cluster is announcing addresses for, e.g. when the cluster
+// is running inside of docker or kubernetes, or behind a NAT.
+//
+// If ClusterPreferHostnames is also used then the function will be given the
+// hostname-based address of nodes which announce a hostname.
+//
+// Addresses given in MOVED and ASK errors are remapped as well.
+func ClusterRemapAddrs(fn func(addr string) string) ClusterOpt {
+	return func(co *clusterOpts) {
+		co.remapAddr = fn
+	}
+}
+
+// ClusterInitialTopo tells NewCluster to use the given ClusterTopo as the
+// cluster's topology, rather than discovering it using CLUSTER SLOTS, which
+// allows the Cluster to be created without waiting for discovery. The
+// ClusterTopo would usually be one previously returned by Topo and saved, see
+// ClusterTopo's docs.
+//
+// The topology is still synchronized periodically as normal, so if the given
+// ClusterTopo is out of date it will be corrected by the first sync. When this
+// option is used the addresses given to NewCluster aren't used, and may be
+// empty.
+func ClusterInitialTopo(tt ClusterTopo) ClusterOpt {
+	tt = append(ClusterTopo(nil), tt...)
+	for i := range tt {
+		tt[i].Slots = append([][2]uint16(nil), tt[i].Slots...)
+	}
+	return func(co *clusterOpts) {
+		co.initTopo = tt
+		co.staticTopo = false
+	}
+}
+
+// ClusterStaticTopo is like ClusterInitialTopo, except that the Cluster never
+// discovers the topology itself, and always uses the given one. This allows
+// the Cluster to be used in environments where CLUSTER commands are blocked.
+//
+// MOVED and ASK redirects are still followed, but don't cause the topology to
+// change, so if the cluster is resharded a new Cluster must be created with an
+// updated topology.
+func ClusterStaticTopo(tt ClusterTopo) ClusterOpt {
+	return func(co *clusterOpts) {
+		ClusterInitialTopo(tt)(co)
+		co.staticTopo = true
+	}
+}
+
+// ClusterCommandGetKeys tells the Cluster to ask redis where the keys of a
+// command are, using COMMAND INFO and COMMAND GETKEYS, rather than assuming
+// the first argument is the key. This allows module commands, and any other
+// commands whose keys aren't where radix expects them, to be routed to the
+// correct node.
+//
+// The result of COMMAND INFO is cached for each command, so it's only
+// performed once per command. COMMAND GETKEYS is only performed for commands
+// whose keys can't be determined from COMMAND INFO alone, and is performed
+// every time such a command is. Commands unknown to redis are routed as usual.
+//
+// This only applies to Actions created by Cmd. Actions created by FlatCmd are
+// always routed by the key given to FlatCmd.
+func ClusterCommandGetKeys() ClusterOpt {
+	return func(co *clusterOpts) {
+		co.commandGetKeys = true
+	}
+}
+
+// ClusterRouteFunc tells the Cluster to call the given function for every
+// Action performed using Do or DoSecondary, along with the keys the Action
+// was found to act on. If the function returns an address then the Action is
+// sent to that node, rather than to the node which would normally be chosen.
+// If it returns "" then the Action is routed as usual.
+//
+// This option, along with ClusterRouteCommands and ClusterRouteKeyPrefix, may
+// be given multiple times, in which case each is called in the order given and
+// the first address returned is used.
+//
+// NOTE that MOVED and ASK redirects are still followed, so overriding the
+// route of an Action which acts on keys owned by a different node will only
+// result in a redirect. Overrides are most useful for commands which don't act
+// on keys, or when redis is behind a proxy which is aware of the overrides.
+func ClusterRouteFunc(fn func(a Action, keys []string) string) ClusterOpt {
+	return func(co *clusterOpts) {
+		co.routes = append(co.routes, fn)
+	}
+}
+
+// ClusterRouteCommands tells the Cluster to send Actions which only perform
+// the given commands (e.g. "CONFIG", "CLIENT") to the node at the given
+// address, which could be one of the addresses NewCluster was given in order
+// to pin administrative commands to a seed node. Commands are matched
+// case-insensitively, using ActionProperties. See ClusterRouteFunc.
+func ClusterRouteCommands(addr string, cmds ...string) ClusterOpt {
+	cmdSet := make(map[string]bool, len(cmds))
+	for _, cmd := range cmds {
+		cmdSet[strings.ToUpper(cmd)] = true
+	}
+	return ClusterRouteFunc(func(a Action, _ []string) string {
+		props := ActionProperties(a)
+		if len(props.Commands) == 0 {
+			return ""
+		}
+		for _, cmd := range props.Commands {
+			if !cmdSet[cmd] {
+				return ""
+			}
+		}
+		return addr
+	})
+}
+
+// ClusterRouteKeyPrefix tells the Cluster to send Actions whose keys all have
+// the given prefix to the node at the given address. See ClusterRouteFunc.
+func ClusterRouteKeyPrefix(prefix, addr string) ClusterOpt {
+	return ClusterRouteFunc(func(_ Action, keys []string) string {
+		if len(keys) == 0 {
+			return ""
+		}
+		for _, key := range keys {
+			if !strings.HasPrefix(key, prefix) {
+				return ""
+			}
+		}
+		return addr
+	})
+}
+
 // ClusterWithTrace tells the Cluster to trace itself with the given
 // ClusterTrace. Note that ClusterTrace will block every point that you set to
 // trace.
@@ -120,6 +406,9 @@ type Cluster struct {
 	// See https://golang.org/pkg/sync/atomic/#pkg-note-BUG
 	lastClusterdown int64 // unix timestamp in milliseconds, atomic
 
+	// stats contains atomic fields, and so must also be at the beginning.
+	stats clusterStats
+
 	co clusterOpts
 
 	// used to deduplicate calls to sync
@@ -127,9 +416,29 @@ type Cluster struct {
 
 	l              sync.RWMutex
 	pools          map[string]Client
+	poolSecondary  map[string]bool // role each pool was created for
 	primTopo, topo ClusterTopo
 	secondaries    map[string]map[string]ClusterNode
 
+	// maps the address of each node as reported by the cluster to the address
+	// the Cluster actually uses for it, if they differ. See
+	// ClusterPreferHostnames and ClusterRemapAddrs.
+	remappedAddrs map[string]string
+
+	// only set if ClusterLatencyBasedReads is used
+	latency *clusterLatency
+
+	// held while a change is made and its ClusterEvents written, so that
+	// events are written in the order the changes occurred. If l is also
+	// needed it must be locked first.
+	eventL sync.Mutex
+
+	// only set if ClusterCommandGetKeys is used
+	cmdKeys *commandKeys
+
+	// serverInfo caches the ServerInfo of the cluster, see ServerInfo.
+	serverInfo serverInfoCache
+
 	closeCh   chan struct{}
 	closeWG   sync.WaitGroup
 	closeOnce sync.Once
@@ -158,7 +467,9 @@ var DefaultClusterConnFunc = func(network, addr string) (Conn, error) {
 
 // NewCluster initializes and returns a Cluster instance. It will try every
 // address given until it finds a usable one. From there it uses CLUSTER SLOTS
-// to discover the cluster topology and make all the necessary connections.
+// to discover the cluster topology and make all the necessary connections. If
+// ClusterInitialTopo or ClusterStaticTopo are used then the given topology is
+// used instead, and the addresses aren't needed.
 //
 // NewCluster takes in a number of options which can overwrite its default
 // behavior. The default options NewCluster uses are:
@@ -169,10 +480,11 @@ var DefaultClusterConnFunc = func(network, addr string) (Conn, error) {
 //
 func NewCluster(clusterAddrs []string, opts ...ClusterOpt) (*Cluster, error) {
 	c := &Cluster{
-		syncDedupe: newDedupe(),
-		pools:      map[string]Client{},
-		closeCh:    make(chan struct{}),
-		ErrCh:      make(chan error, 1),
+		syncDedupe:    newDedupe(),
+		pools:         map[string]Client{},
+		poolSecondary: map[string]bool{},
+		closeCh:       make(chan struct{}),
+		ErrCh:         make(chan error, 1),
 	}
 
 	defaultClusterOpts := []ClusterOpt{
@@ -190,25 +502,44 @@ func NewCluster(clusterAddrs []string, opts ...ClusterOpt) (*Cluster, error) {
 		}
 	}
 
-	// make a pool to base the cluster on
-	for _, addr := range clusterAddrs {
-		p, err := c.co.pf("tcp", addr)
-		if err != nil {
-			continue
+	var err error
+	if c.co.initTopo != nil {
+		if err = c.co.initTopo.validate(); err == nil {
+			c.co.initTopo.sort()
+			err = c.setTopo(c.co.initTopo)
+		}
+	} else {
+		// make a pool to base the cluster on
+		for _, addr := range clusterAddrs {
+			p, err := c.clientFunc(addr, false)("tcp", addr)
+			if err != nil {
+				continue
+			}
+			c.pools[addr] = p
+			break
 		}
-		c.pools[addr] = p
-		break
+		err = c.Sync()
 	}
 
-	if err := c.Sync(); err != nil {
+	if err != nil {
 		for _, p := range c.pools {
 			p.Close()
 		}
 		return nil, err
 	}
 
+	if c.co.commandGetKeys {
+		c.cmdKeys = newCommandKeys()
+	}
+
 	c.syncEvery(c.co.syncEvery)
 
+	if c.co.latencyEvery > 0 {
+		c.latency = newClusterLatency()
+		c.measureLatency()
+		c.measureLatencyEvery(c.co.latencyEvery)
+	}
+
 	return c, nil
 }
 
@@ -219,23 +550,6 @@ func (c *Cluster) err(err error) {
 	}
 }
 
-func assertKeysSlot(keys []string) error {
-	var ok bool
-	var prevKey string
-	var slot uint16
-	for _, key := range keys {
-		thisSlot := ClusterSlot([]byte(key))
-		if !ok {
-			ok = true
-		} else if slot != thisSlot {
-			return errors.Errorf("keys %q and %q do not belong to the same slot", prevKey, key)
-		}
-		prevKey = key
-		slot = thisSlot
-	}
-	return nil
-}
-
 // may return nil, nil if no pool for the addr
 func (c *Cluster) rpool(addr string) (Client, error) {
 	c.l.RLock()
@@ -276,6 +590,35 @@ func (c *Cluster) Client(addr string) (Client, error) {
 	return cl, nil
 }
 
+// clientFunc returns the ClientFunc which should be used to create a pool for
+// the given address, taking into account the role of the node at that address.
+func (c *Cluster) clientFunc(addr string, secondary bool) ClientFunc {
+	if pf, ok := c.co.addrPF[addr]; ok {
+		return pf
+	} else if secondary && c.co.secondaryPF != nil {
+		return c.co.secondaryPF
+	}
+	return c.co.pf
+}
+
+// roleDependentPool returns true if the pool for the given address must be
+// recreated when the role of the node at that address changes.
+func (c *Cluster) roleDependentPool(addr string) bool {
+	_, ok := c.co.addrPF[addr]
+	return !ok && c.co.secondaryPF != nil
+}
+
+func (c *Cluster) isSecondary(addr string) bool {
+	c.l.RLock()
+	defer c.l.RUnlock()
+	for _, node := range c.topo {
+		if node.Addr == addr {
+			return node.SecondaryOfAddr != ""
+		}
+	}
+	return false
+}
+
 // if addr is "" returns a random pool. If addr is given but there's no pool for
 // it one will be created on-the-fly
 func (c *Cluster) pool(addr string) (Client, error) {
@@ -287,10 +630,14 @@ func (c *Cluster) pool(addr string) (Client, error) {
 	// if the pool isn't available make it on-the-fly. This behavior isn't
 	// _great_, but theoretically the syncEvery process should clean up any
 	// extraneous pools which aren't really needed
+	return c.newPool(addr, c.isSecondary(addr))
+}
 
+func (c *Cluster) newPool(addr string, secondary bool) (Client, error) {
 	// it's important that the cluster pool set isn't locked while this is
 	// happening, because this could block for a while
-	if p, err = c.co.pf("tcp", addr); err != nil {
+	p, err := c.clientFunc(addr, secondary)("tcp", addr)
+	if err != nil {
 		return nil, err
 	}
 
@@ -304,6 +651,7 @@ func (c *Cluster) pool(addr string) (Client, error) {
 		return p2, nil
 	}
 	c.pools[addr] = p
+	c.poolSecondary[addr] = secondary
 	c.l.Unlock()
 	return p, nil
 }
@@ -316,6 +664,14 @@ func (c *Cluster) Topo() ClusterTopo {
 	return c.topo
 }
 
+// ServerInfo returns the ServerInfo of the servers making up the Cluster. It is
+// retrieved from a random node using INFO server the first time it's needed,
+// and cached from then on; all nodes of a cluster are assumed to be running
+// the same server.
+func (c *Cluster) ServerInfo() (ServerInfo, error) {
+	return c.serverInfo.get(c)
+}
+
 func (c *Cluster) getTopo(p Client) (ClusterTopo, error) {
 	var tt ClusterTopo
 	err := p.Do(Cmd(&tt, "CLUSTER", "SLOTS"))
@@ -327,11 +683,83 @@ func (c *Cluster) getTopo(p Client) (ClusterTopo, error) {
 	return tt, err
 }
 
+// remapTopo returns a copy of the given ClusterTopo with all node addresses
+// modified according to the ClusterPreferHostnames and ClusterRemapAddrs
+// options, as well as a mapping of each original address to its new address.
+func (c *Cluster) remapTopo(tt ClusterTopo) (ClusterTopo, map[string]string) {
+	if !c.co.preferHostnames && c.co.remapAddr == nil {
+		return tt, nil
+	}
+
+	m := make(map[string]string, len(tt))
+	for _, node := range tt {
+		addr := node.Addr
+		if _, port, err := net.SplitHostPort(addr); c.co.preferHostnames && node.Hostname != "" && err == nil {
+			addr = net.JoinHostPort(node.Hostname, port)
+		}
+		if c.co.remapAddr != nil {
+			addr = c.co.remapAddr(addr)
+		}
+		m[node.Addr] = addr
+	}
+
+	newTT := make(ClusterTopo, len(tt))
+	for i, node := range tt {
+		node.Addr = m[node.Addr]
+		if node.SecondaryOfAddr != "" {
+			if addr, ok := m[node.SecondaryOfAddr]; ok {
+				node.SecondaryOfAddr = addr
+			}
+		}
+		newTT[i] = node
+	}
+	return newTT, m
+}
+
+// zoneTopo returns a copy of the given ClusterTopo with the Zone of each node
+// set by the ClusterNodeZoneFunc option, if it was used.
+func (c *Cluster) zoneTopo(tt ClusterTopo) ClusterTopo {
+	if c.co.zoneFn == nil {
+		return tt
+	}
+	newTT := make(ClusterTopo, len(tt))
+	for i, node := range tt {
+		node.Zone = c.co.zoneFn(node)
+		newTT[i] = node
+	}
+	return newTT
+}
+
+// redirectAddr returns the address which should be used for an address given
+// in a MOVED or ASK error.
+func (c *Cluster) redirectAddr(addr string) string {
+	c.l.RLock()
+	remappedAddr, ok := c.remappedAddrs[addr]
+	c.l.RUnlock()
+	if ok {
+		return remappedAddr
+	} else if c.co.remapAddr != nil {
+		return c.co.remapAddr(addr)
+	}
+	return addr
+}
+
 // Sync will synchronize the Cluster with the actual cluster, making new pools
 // to new instances and removing ones from instances no longer in the cluster.
 // This will be called periodically automatically, but you can manually call it
 // at any time as well
+//
+// If ClusterStaticTopo was used then the topology isn't discovered, and the
+// Cluster is synchronized with the static topology instead.
 func (c *Cluster) Sync() error {
+	if c.co.staticTopo {
+		var err error
+		c.syncDedupe.do(func() {
+			err = c.setTopo(c.co.initTopo)
+		})
+		return err
+	}
+
 	p, err := c.pool("")
 	if err != nil {
 		return err
@@ -398,22 +826,79 @@ func (c *Cluster) sync(p Client) error {
 	if err != nil {
 		return err
 	}
+	return c.setTopo(tt)
+}
 
+// setTopo makes the given ClusterTopo the Cluster's topology, making new pools
+// to new instances and removing ones from instances no longer in it.
+func (c *Cluster) setTopo(tt ClusterTopo) error {
+	tt, remappedAddrs := c.remapTopo(tt)
+	tt = c.zoneTopo(tt)
+
+	// pools for nodes which are new to the topology, and pools which must be
+	// swapped in because the role of their node changed. Neither are
+	// registered until the whole topology has been connected to, so that they
+	// can all be closed if any connection fails.
+	added := map[string]Client{}
+	replacements := map[string]Client{}
+	closeNew := func() {
+		for _, p := range added {
+			p.Close()
+		}
+		for _, p := range replacements {
+			p.Close()
+		}
+	}
 	for _, t := range tt {
-		// call pool just to ensure one exists for this addr
-		if _, err := c.pool(t.Addr); err != nil {
-			return errors.Errorf("error connecting to %s: %w", t.Addr, err)
+		secondary := t.SecondaryOfAddr != ""
+		c.l.RLock()
+		_, ok := c.pools[t.Addr]
+		wasSecondary := c.poolSecondary[t.Addr]
+		c.l.RUnlock()
+
+		if !ok {
+			if _, ok := added[t.Addr]; ok {
+				continue
+			}
+			// it's important that the cluster pool set isn't locked while this
+			// is happening, because this could block for a while
+			p, err := c.clientFunc(t.Addr, secondary)("tcp", t.Addr)
+			if err != nil {
+				closeNew()
+				return errors.Errorf("error connecting to %s: %w", t.Addr, err)
+			}
+			added[t.Addr] = p
+		} else if wasSecondary != secondary && c.roleDependentPool(t.Addr) {
+			p, err := c.clientFunc(t.Addr, secondary)("tcp", t.Addr)
+			if err != nil {
+				closeNew()
+				return errors.Errorf("error connecting to %s: %w", t.Addr, err)
+			}
+			replacements[t.Addr] = p
 		}
 	}
 
-	c.traceTopoChanged(c.topo, tt)
+	c.traceTopoChanged(c.Topo(), tt)
 
 	var toclose []Client
 	func() {
 		c.l.Lock()
 		defer c.l.Unlock()
+		c.eventL.Lock()
+		defer c.eventL.Unlock()
+
+		// the events are written while the topology is locked, so that those
+		// of concurrent syncs can't be interleaved or reordered.
+		if c.co.eventCh != nil {
+			for _, e := range topoEvents(c.topo, tt) {
+				c.event(e)
+			}
+			c.event(ClusterEvent{Type: ClusterSynced})
+		}
+
 		c.topo = tt
 		c.primTopo = tt.Primaries()
+		c.remappedAddrs = remappedAddrs
 
 		c.secondaries = make(map[string]map[string]ClusterNode, len(c.primTopo))
 		for _, node := range c.topo {
@@ -428,18 +913,43 @@ func (c *Cluster) sync(p Client) error {
 		}
 
 		tm := tt.Map()
+
+		// someone else may have made a pool for a new node in the meantime,
+		// in which case theirs is kept.
+		for addr, p := range added {
+			if _, ok := c.pools[addr]; ok {
+				toclose = append(toclose, p)
+				continue
+			}
+			c.pools[addr] = p
+			c.poolSecondary[addr] = tm[addr].SecondaryOfAddr != ""
+		}
+
 		for addr, p := range c.pools {
 			if _, ok := tm[addr]; !ok {
 				toclose = append(toclose, p)
 				delete(c.pools, addr)
+				delete(c.poolSecondary, addr)
+			} else if newP, ok := replacements[addr]; ok {
+				toclose = append(toclose, p)
+				c.pools[addr] = newP
+				c.poolSecondary[addr] = tm[addr].SecondaryOfAddr != ""
+				delete(replacements, addr)
 			}
 		}
+
+		// any replacements left over are for pools which have since gone away
+		for _, p := range replacements {
+			toclose = append(toclose, p)
+		}
 	}()
 
 	for _, p := range toclose {
 		p.Close()
 	}
 
+	c.stats.synced(tt)
+
 	return nil
 }
 
@@ -478,9 +988,27 @@ func (c *Cluster) addrForKey(key string) string {
 }
 
 func (c *Cluster) secondaryAddrForKey(key string) string {
+	primAddr := c.addrForKey(key)
+	if c.latency != nil {
+		if addr := c.latency.preferredFor(primAddr); addr != "" {
+			return addr
+		}
+	}
+
 	c.l.RLock()
 	defer c.l.RUnlock()
-	primAddr := c.addrForKey(key)
+	if zone := c.co.preferZone; zone != "" {
+		for addr, node := range c.secondaries[primAddr] {
+			if node.Zone == zone {
+				return addr
+			}
+		}
+		for _, node := range c.primTopo {
+			if node.Addr == primAddr && node.Zone == zone {
+				return primAddr
+			}
+		}
+	}
 	for addr := range c.secondaries[primAddr] {
 		return addr
 	}
@@ -517,9 +1045,15 @@ const doAttempts = 5
 // This method handles MOVED and ASK errors automatically in most cases, see
 // ClusterCanRetryAction's docs for more.
 func (c *Cluster) Do(a Action) error {
+	if err := checkServerFeatures(c, actionFeatures(a)...); err != nil {
+		return err
+	}
+
 	var addr, key string
-	keys := a.Keys()
-	if len(keys) == 0 {
+	keys, err := c.actionKeys(a)
+	if err != nil {
+		return err
+	} else if len(keys) == 0 {
 		// that's ok, key will then just be ""
 	} else if err := assertKeysSlot(keys); err != nil {
 		return err
@@ -527,11 +1061,18 @@ func (c *Cluster) Do(a Action) error {
 		key = keys[0]
 		addr = c.addrForKey(key)
 	}
+	a = guardSlots(a)
 
+	if routed := c.route(a, keys); routed != "" {
+		addr = routed
+	}
 	return c.doInner(a, addr, key, false, doAttempts)
 }
 
 // DoSecondary is like Do but executes the Action on a random secondary for the affected keys.
+// If ClusterLatencyBasedReads is used the Action is instead executed on the
+// lowest-latency node for the affected keys, which may be the primary. If
+// ClusterPreferZone is used nodes in the preferred zone are chosen first.
 //
 // For DoSecondary to work, all connections must be created in read-only mode, by using a
 // custom ClusterPoolFunc that executes the READONLY command on each new connection.
@@ -540,9 +1081,15 @@ func (c *Cluster) Do(a Action) error {
 //
 // If the Action can not be handled by a secondary the Action will be send to the primary instead.
 func (c *Cluster) DoSecondary(a Action) error {
+	if err := checkServerFeatures(c, actionFeatures(a)...); err != nil {
+		return err
+	}
+
 	var addr, key string
-	keys := a.Keys()
-	if len(keys) == 0 {
+	keys, err := c.actionKeys(a)
+	if err != nil {
+		return err
+	} else if len(keys) == 0 {
 		// that's ok, key will then just be ""
 	} else if err := assertKeysSlot(keys); err != nil {
 		return err
@@ -550,10 +1097,25 @@ func (c *Cluster) DoSecondary(a Action) error {
 		key = keys[0]
 		addr = c.secondaryAddrForKey(key)
 	}
+	a = guardSlots(a)
 
+	if routed := c.route(a, keys); routed != "" {
+		addr = routed
+	}
 	return c.doInner(a, addr, key, false, doAttempts)
 }
 
+// route returns the address given by the first of the Cluster's route
+// overrides to return one for the Action, if any.
+func (c *Cluster) route(a Action, keys []string) string {
+	for _, fn := range c.co.routes {
+		if addr := fn(a, keys); addr != "" {
+			return addr
+		}
+	}
+	return ""
+}
+
 func (c *Cluster) getClusterDownSince() int64 {
 	return atomic.LoadInt64(&c.lastClusterdown)
 }
@@ -620,7 +1182,7 @@ func (c *Cluster) setClusterDown(down bool) (changed bool) {
 	return changed
 }
 
-func (c *Cluster) traceRedirected(addr, key string, moved, ask bool, count int, final bool) {
+func (c *Cluster) traceRedirected(a Action, addr, key string, moved, ask bool, count int, final bool) {
 	if c.co.ct.Redirected != nil {
 		c.co.ct.Redirected(trace.ClusterRedirected{
 			Addr:          addr,
@@ -629,6 +1191,7 @@ func (c *Cluster) traceRedirected(addr, key string, moved, ask bool, count int,
 			Ask:           ask,
 			RedirectCount: count,
 			Final:         final,
+			Metadata:      ActionMetadata(a),
 		})
 	}
 }
@@ -661,6 +1224,7 @@ func (c *Cluster) doInner(a Action, addr, key string, ask bool, attempts int) er
 	}
 
 	err = p.Do(thisA)
+	c.stats.node(addr).record(err)
 	if err == nil {
 		c.setClusterDown(false)
 		return nil
@@ -673,19 +1237,34 @@ func (c *Cluster) doInner(a Action, addr, key string, ask bool, attempts int) er
 
 	msg := respErr.Error()
 
-	clusterDown := strings.HasPrefix(msg, "CLUSTERDOWN ")
+	clusterDown := respErr.Kind() == resp2.ErrorKindClusterDown
 	clusterDownChanged := c.setClusterDown(clusterDown)
 	if clusterDown && c.co.clusterDownWait > 0 && clusterDownChanged {
 		return c.doInner(a, addr, key, ask, 1)
 	}
 
 	// if the error was a MOVED or ASK we can potentially retry
-	moved := strings.HasPrefix(msg, "MOVED ")
-	ask = strings.HasPrefix(msg, "ASK ")
+	moved := respErr.Prefix() == "MOVED"
+	ask = respErr.Prefix() == "ASK"
 	if !moved && !ask {
 		return err
 	}
 
+	msgParts := strings.Split(msg, " ")
+	if len(msgParts) < 3 {
+		return errors.Errorf("malformed MOVED/ASK error %q", msg)
+	}
+	slot, perr := strconv.ParseUint(msgParts[1], 10, 16)
+	if perr != nil {
+		return errors.Errorf("malformed MOVED/ASK error %q", msg)
+	}
+	redirErr := &ClusterRedirectError{
+		Kind: msgParts[0],
+		Slot: uint16(slot),
+		Addr: msgParts[2],
+		Err:  err,
+	}
+
 	// if we get an ASK there's no need to do a sync quite yet, we can continue
 	// normally. But MOVED always prompts a sync. In the section after this one
 	// we figure out what address to use based on the returned error so the sync
@@ -699,19 +1278,16 @@ func (c *Cluster) doInner(a Action, addr, key string, ask bool, attempts int) er
 		}
 	}
 
-	if ccra, ok := a.(ClusterCanRetryAction); !ok || !ccra.ClusterCanRetry() {
-		return err
+	if !canClusterRetry(a) {
+		return redirErr
 	}
 
-	msgParts := strings.Split(msg, " ")
-	if len(msgParts) < 3 {
-		return errors.Errorf("malformed MOVED/ASK error %q", msg)
-	}
-	ogAddr, addr := addr, msgParts[2]
+	ogAddr, addr := addr, c.redirectAddr(redirErr.Addr)
 
-	c.traceRedirected(ogAddr, key, moved, ask, doAttempts-attempts+1, attempts <= 1)
+	c.traceRedirected(a, ogAddr, key, moved, ask, doAttempts-attempts+1, attempts <= 1)
 	if attempts--; attempts <= 0 {
-		return errors.New("cluster action redirected too many times")
+		redirErr.Err = errors.Errorf("cluster action redirected too many times: %w", err)
+		return redirErr
 	}
 
 	return c.doInner(a, addr, key, ask, attempts)
@@ -720,7 +1296,7 @@ func (c *Cluster) doInner(a Action, addr, key string, ask bool, attempts int) er
 // Close cleans up all goroutines spawned by Cluster and closes all of its
 // Pools.
 func (c *Cluster) Close() error {
-	closeErr := errClientClosed
+	closeErr := ErrClientClosed
 	c.closeOnce.Do(func() {
 		close(c.closeCh)
 		c.closeWG.Wait()
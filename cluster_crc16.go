@@ -55,10 +55,16 @@ func CRC16(buf []byte) uint16 {
 // ClusterSlot returns the slot number the key belongs to in any redis cluster,
 // taking into account key hash tags
 func ClusterSlot(key []byte) uint16 {
+	return CRC16(keyHashTag(key)) % numSlots
+}
+
+// keyHashTag returns the part of the key which is hashed to determine where it
+// belongs, which is the key's hash tag if it has one, or else the whole key.
+func keyHashTag(key []byte) []byte {
 	if start := bytes.Index(key, []byte("{")); start >= 0 {
 		if end := bytes.Index(key[start+1:], []byte("}")); end > 0 {
-			key = key[start+1 : start+1+end]
+			return key[start+1 : start+1+end]
 		}
 	}
-	return CRC16(key) % numSlots
+	return key
 }
@@ -0,0 +1,135 @@
+package radix
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CrossSlotError is returned by Cluster, in place of performing an Action,
+// when the keys of the Action don't all belong to the same slot. Redis cluster
+// would reject such an Action with a CROSSSLOT error, which is much harder to
+// make sense of, especially if it happens part way through a transaction.
+//
+// Within a WithConn every Action performed on the Conn is checked against the
+// slot of the WithConn's key (or the first key used on the Conn, if no key was
+// given).
+type CrossSlotError struct {
+	// Keys are the keys which were checked, and Slots the slot each of them
+	// belongs to.
+	Keys  []string
+	Slots []uint16
+}
+
+func (e *CrossSlotError) Error() string {
+	// only the first key of each slot is listed, as there may be many keys
+	var parts []string
+	seen := map[uint16]bool{}
+	for i, key := range e.Keys {
+		if slot := e.Slots[i]; !seen[slot] {
+			seen[slot] = true
+			parts = append(parts, fmt.Sprintf("%q (slot %d)", key, slot))
+		}
+	}
+	return fmt.Sprintf("keys do not belong to the same slot: %s", strings.Join(parts, ", "))
+}
+
+func assertKeysSlot(keys []string) error {
+	var ok bool
+	var slot uint16
+	for _, key := range keys {
+		thisSlot := ClusterSlot([]byte(key))
+		if !ok {
+			ok = true
+		} else if slot != thisSlot {
+			return newCrossSlotError(keys)
+		}
+		slot = thisSlot
+	}
+	return nil
+}
+
+func newCrossSlotError(keys []string) *CrossSlotError {
+	slots := make([]uint16, len(keys))
+	for i, key := range keys {
+		slots[i] = ClusterSlot([]byte(key))
+	}
+	return &CrossSlotError{Keys: keys, Slots: slots}
+}
+
+// slotGuardConn wraps the Conn given to a WithConn's callback when performed
+// by Cluster, and returns a CrossSlotError from Do if an Action's keys don't
+// belong to the same slot as the keys used on it previously.
+//
+// If the check fails in the middle of a MULTI then a DISCARD is sent before
+// returning the error, so that the Conn isn't left in a transaction.
+type slotGuardConn struct {
+	Conn
+	slotKey string
+	inMulti bool
+}
+
+func (sc *slotGuardConn) Do(a Action) error {
+	props := ActionProperties(a)
+	keys := props.Keys
+	if sc.slotKey != "" {
+		keys = append([]string{sc.slotKey}, keys...)
+	}
+
+	if err := assertKeysSlot(keys); err != nil {
+		if sc.inMulti {
+			sc.inMulti = false
+			if discardErr := sc.Conn.Do(Cmd(nil, "DISCARD")); discardErr != nil {
+				return discardErr
+			}
+		}
+		return err
+	} else if sc.slotKey == "" && len(keys) > 0 {
+		sc.slotKey = keys[0]
+	}
+
+	for _, cmd := range props.Commands {
+		switch cmd {
+		case "MULTI":
+			sc.inMulti = true
+		case "EXEC", "DISCARD":
+			sc.inMulti = false
+		}
+	}
+	return sc.Conn.Do(a)
+}
+
+// guardSlots returns the Action wrapped such that the Conn given to its
+// callback is a slotGuardConn, if it's a WithConn, possibly itself wrapped by
+// WithPriority or the like. Otherwise the Action is returned as-is.
+func guardSlots(a Action) Action {
+	for inner := a; ; {
+		switch ia := inner.(type) {
+		case *withConn:
+			return slotGuardAction{Action: a, slotKey: ia.key[0]}
+		case wrappedAction:
+			inner = ia.unwrapAction()
+		default:
+			return a
+		}
+	}
+}
+
+// slotGuardAction wraps the Conn an Action is run on in a slotGuardConn. The
+// Conn is wrapped at the outermost layer, rather than replacing the WithConn,
+// so that any wrappers around the WithConn are kept.
+type slotGuardAction struct {
+	Action
+	slotKey string
+}
+
+func (sga slotGuardAction) unwrapAction() Action {
+	return sga.Action
+}
+
+func (sga slotGuardAction) ReadOnly() bool {
+	return isReadOnly(sga.Action)
+}
+
+func (sga slotGuardAction) Run(conn Conn) error {
+	return sga.Action.Run(&slotGuardConn{Conn: conn, slotKey: sga.slotKey})
+}
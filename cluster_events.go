@@ -0,0 +1,161 @@
+package radix
+
+// ClusterEventType describes the kind of change a ClusterEvent is reporting.
+type ClusterEventType int
+
+// All possible ClusterEventType values.
+const (
+	// ClusterNodeAdded indicates a node has been added to the cluster's
+	// topology. Addr is the address of the new node.
+	ClusterNodeAdded ClusterEventType = iota
+
+	// ClusterNodeRemoved indicates a node is no longer part of the cluster's
+	// topology. Addr is the address of the removed node.
+	ClusterNodeRemoved
+
+	// ClusterSlotsMoved indicates a range of slots is now served by a
+	// different primary. Addr is the new primary, PrevAddr is the previous
+	// one, and Slots contains the range which was moved.
+	ClusterSlotsMoved
+
+	// ClusterFailover indicates a secondary has been promoted to be a
+	// primary. Addr is the promoted node, PrevAddr is the primary it used to
+	// be a secondary of.
+	ClusterFailover
+
+	// ClusterNodeUnhealthy indicates a node has failed a health check. Addr
+	// is the node's address and Err is the error encountered.
+	ClusterNodeUnhealthy
+
+	// ClusterNodeRecovered indicates a node which had previously failed a
+	// health check is healthy again. Addr is the node's address.
+	ClusterNodeRecovered
+
+	// ClusterSynced indicates that the Cluster has successfully synchronized
+	// itself with the cluster's topology.
+	ClusterSynced
+)
+
+func (t ClusterEventType) String() string {
+	switch t {
+	case ClusterNodeAdded:
+		return "node added"
+	case ClusterNodeRemoved:
+		return "node removed"
+	case ClusterSlotsMoved:
+		return "slots moved"
+	case ClusterFailover:
+		return "failover"
+	case ClusterNodeUnhealthy:
+		return "node unhealthy"
+	case ClusterNodeRecovered:
+		return "node recovered"
+	case ClusterSynced:
+		return "synced"
+	default:
+		return "unknown"
+	}
+}
+
+// ClusterEvent describes a change in a Cluster's topology or in the health of
+// one of its nodes. Which fields are set depends on the Type, see the docs on
+// the ClusterEventType values for details.
+type ClusterEvent struct {
+	Type     ClusterEventType
+	Addr     string
+	PrevAddr string
+	Slots    [2]uint16
+	Err      error
+}
+
+// ClusterEvents tells the Cluster to write a ClusterEvent to the given channel
+// whenever its topology or the health of one of its nodes changes. Events are
+// written in the order they occur, with the events describing a single
+// synchronization written one after the other, followed by a ClusterSynced
+// event. If the channel is not ready to receive an event (e.g. it's unbuffered
+// and nothing is reading, or its buffer is full) the event is dropped rather
+// than blocking the Cluster.
+//
+// NOTE that the events produced by the Cluster's initial synchronization are
+// included, so a ClusterNodeAdded event will be written for every node when
+// the Cluster is created. Health events are only produced when
+// ClusterLatencyBasedReads is used, since that is what performs health checks.
+//
+// The channel is never closed by the Cluster.
+func ClusterEvents(ch chan<- ClusterEvent) ClusterOpt {
+	return func(co *clusterOpts) {
+		co.eventCh = ch
+	}
+}
+
+func (c *Cluster) event(e ClusterEvent) {
+	if c.co.eventCh == nil {
+		return
+	}
+	select {
+	case c.co.eventCh <- e:
+	default:
+	}
+}
+
+// topoEvents returns the ClusterEvents describing the changes between the two
+// topologies.
+func topoEvents(prevTopo, newTopo ClusterTopo) []ClusterEvent {
+	var events []ClusterEvent
+	prevTopoMap, newTopoMap := prevTopo.Map(), newTopo.Map()
+
+	for _, node := range newTopo {
+		prevNode, ok := prevTopoMap[node.Addr]
+		if !ok {
+			events = append(events, ClusterEvent{Type: ClusterNodeAdded, Addr: node.Addr})
+		} else if prevNode.SecondaryOfAddr != "" && node.SecondaryOfAddr == "" {
+			events = append(events, ClusterEvent{
+				Type:     ClusterFailover,
+				Addr:     node.Addr,
+				PrevAddr: prevNode.SecondaryOfAddr,
+			})
+		}
+	}
+	for _, node := range prevTopo {
+		if _, ok := newTopoMap[node.Addr]; !ok {
+			events = append(events, ClusterEvent{Type: ClusterNodeRemoved, Addr: node.Addr})
+		}
+	}
+
+	// slots which haven't got a primary in either topology (e.g. during the
+	// initial sync) aren't considered to have moved.
+	var prevOwners, newOwners [numSlots]string
+	slotOwners := func(owners *[numSlots]string, tt ClusterTopo) {
+		for _, node := range tt.Primaries() {
+			for _, slots := range node.Slots {
+				for s := slots[0]; s < slots[1]; s++ {
+					owners[s] = node.Addr
+				}
+			}
+		}
+	}
+	slotOwners(&prevOwners, prevTopo)
+	slotOwners(&newOwners, newTopo)
+
+	moved := func(s int) bool {
+		return prevOwners[s] != "" && newOwners[s] != "" && prevOwners[s] != newOwners[s]
+	}
+	for s := 0; s < numSlots; s++ {
+		if !moved(s) {
+			continue
+		}
+		start := s
+		for s+1 < numSlots && moved(s+1) &&
+			prevOwners[s+1] == prevOwners[start] && newOwners[s+1] == newOwners[start] {
+			s++
+		}
+		events = append(events, ClusterEvent{
+			Type:     ClusterSlotsMoved,
+			Addr:     newOwners[start],
+			PrevAddr: prevOwners[start],
+			Slots:    [2]uint16{uint16(start), uint16(s + 1)},
+		})
+	}
+
+	return events
+}
@@ -0,0 +1,114 @@
+package radix
+
+import (
+	"sync"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopoEvents(t *T) {
+	prevTopo := ClusterTopo{
+		{Addr: "a:6379", Slots: [][2]uint16{{0, 8192}}},
+		{Addr: "a2:6379", Slots: [][2]uint16{{0, 8192}}, SecondaryOfAddr: "a:6379"},
+		{Addr: "b:6379", Slots: [][2]uint16{{8192, numSlots}}},
+		{Addr: "b2:6379", Slots: [][2]uint16{{8192, numSlots}}, SecondaryOfAddr: "b:6379"},
+	}
+	newTopo := ClusterTopo{
+		{Addr: "a:6379", Slots: [][2]uint16{{0, 8000}}},
+		{Addr: "b2:6379", Slots: [][2]uint16{{8000, numSlots}}},
+		{Addr: "b3:6379", Slots: [][2]uint16{{8000, numSlots}}, SecondaryOfAddr: "b2:6379"},
+	}
+
+	assert.Equal(t, []ClusterEvent{
+		{Type: ClusterFailover, Addr: "b2:6379", PrevAddr: "b:6379"},
+		{Type: ClusterNodeAdded, Addr: "b3:6379"},
+		{Type: ClusterNodeRemoved, Addr: "a2:6379"},
+		{Type: ClusterNodeRemoved, Addr: "b:6379"},
+		{Type: ClusterSlotsMoved, Addr: "b2:6379", PrevAddr: "a:6379", Slots: [2]uint16{8000, 8192}},
+		{Type: ClusterSlotsMoved, Addr: "b2:6379", PrevAddr: "b:6379", Slots: [2]uint16{8192, numSlots}},
+	}, topoEvents(prevTopo, newTopo))
+
+	assert.Empty(t, topoEvents(newTopo, newTopo))
+}
+
+func TestClusterEvents(t *T) {
+	ch := make(chan ClusterEvent, 64)
+	c, scl := newTestCluster(ClusterEvents(ch))
+	defer c.Close()
+
+	// the initial sync should produce an added event for every node
+	var added []string
+	for e := range ch {
+		if e.Type == ClusterSynced {
+			break
+		}
+		require.Equal(t, ClusterNodeAdded, e.Type)
+		added = append(added, e.Addr)
+	}
+	var expAdded []string
+	for _, node := range c.Topo() {
+		expAdded = append(expAdded, node.Addr)
+	}
+	assert.ElementsMatch(t, expAdded, added)
+
+	src, dst := scl.stubForSlot(0), scl.stubForSlot(numSlots-1)
+	scl.migrateSlotRange(dst.addr, 0, 10)
+	require.NoError(t, c.Sync())
+	assert.Equal(t, ClusterEvent{
+		Type:     ClusterSlotsMoved,
+		Addr:     dst.addr,
+		PrevAddr: src.addr,
+		Slots:    [2]uint16{0, 10},
+	}, <-ch)
+	assert.Equal(t, ClusterEvent{Type: ClusterSynced}, <-ch)
+}
+
+func TestClusterEventsOrder(t *T) {
+	ch := make(chan ClusterEvent, 10000)
+	c, scl := newTestCluster(ClusterEvents(ch))
+	defer c.Close()
+
+	src, dst := scl.stubForSlot(0), scl.stubForSlot(numSlots-1)
+	topoA := c.Topo()
+	scl.migrateSlotRange(dst.addr, 0, 10)
+	topoB := scl.topo()
+
+	// drain the events of the initial sync
+	for e := range ch {
+		if e.Type == ClusterSynced {
+			break
+		}
+	}
+
+	// concurrently flip between the two topologies. However the syncs are
+	// interleaved, the events must describe each change from the topology
+	// the previous events left off at.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				tt := topoA
+				if (i+j)%2 == 0 {
+					tt = topoB
+				}
+				assert.NoError(t, c.setTopo(tt))
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(ch)
+
+	owner := src.addr
+	for e := range ch {
+		if e.Type != ClusterSlotsMoved {
+			continue
+		}
+		require.Equal(t, owner, e.PrevAddr)
+		owner = e.Addr
+	}
+	assert.Equal(t, c.addrForKey(clusterSlotKeys[0]), owner)
+}
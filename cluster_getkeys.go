@@ -0,0 +1,148 @@
+package radix
+
+import (
+	"strings"
+	"sync"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+// commandKeySpec describes where the keys of a command are, as returned by
+// COMMAND INFO.
+type commandKeySpec struct {
+	// known is false if the server doesn't know the command.
+	known bool
+
+	// movable is true if the keys can't be found using firstKey, lastKey and
+	// step, and COMMAND GETKEYS must be used instead.
+	movable bool
+
+	firstKey, lastKey, step int
+}
+
+// commandKeys finds the keys of commands using COMMAND INFO and COMMAND
+// GETKEYS, see ClusterCommandGetKeys. The result of COMMAND INFO is cached
+// for every command.
+type commandKeys struct {
+	l     sync.Mutex
+	specs map[string]commandKeySpec
+}
+
+func newCommandKeys() *commandKeys {
+	return &commandKeys{specs: map[string]commandKeySpec{}}
+}
+
+// clusterKnownKeysCmds are the commands whose keys are already found correctly
+// by cmdAction's Keys method, which are never looked up using COMMAND.
+var clusterKnownKeysCmds = map[string]bool{
+	"BITOP":       true,
+	"XINFO":       true,
+	"OBJECT":      true,
+	"MEMORY":      true,
+	"XGROUP":      true,
+	"XREAD":       true,
+	"XREADGROUP":  true,
+	"LMPOP":       true,
+	"ZMPOP":       true,
+	"BLMPOP":      true,
+	"BZMPOP":      true,
+	"ZRANGESTORE": true,
+	"COMMAND":     true,
+}
+
+func (ck *commandKeys) spec(client Client, cmd string) (commandKeySpec, error) {
+	ck.l.Lock()
+	spec, ok := ck.specs[cmd]
+	ck.l.Unlock()
+	if ok {
+		return spec, nil
+	}
+
+	var infos []resp2.RawMessage
+	if err := client.Do(Cmd(&infos, "COMMAND", "INFO", cmd)); err != nil {
+		return commandKeySpec{}, err
+	} else if len(infos) != 1 {
+		return commandKeySpec{}, errors.Errorf("expected one COMMAND INFO reply for %q, got %d", cmd, len(infos))
+	}
+
+	if !infos[0].IsNil() {
+		var fields []resp2.RawMessage
+		var flags []string
+		if err := infos[0].UnmarshalInto(resp2.Any{I: &fields}); err != nil {
+			return commandKeySpec{}, err
+		} else if len(fields) < 6 {
+			return commandKeySpec{}, errors.Errorf("malformed COMMAND INFO reply for %q", cmd)
+		} else if err := fields[2].UnmarshalInto(resp2.Any{I: &flags}); err != nil {
+			return commandKeySpec{}, err
+		}
+		for i, into := range []*int{&spec.firstKey, &spec.lastKey, &spec.step} {
+			if err := fields[3+i].UnmarshalInto(resp2.Any{I: into}); err != nil {
+				return commandKeySpec{}, err
+			}
+		}
+		for _, flag := range flags {
+			spec.movable = spec.movable || flag == "movablekeys"
+		}
+		spec.known = true
+	}
+
+	ck.l.Lock()
+	ck.specs[cmd] = spec
+	ck.l.Unlock()
+	return spec, nil
+}
+
+func (ck *commandKeys) keys(client Client, c *cmdAction) ([]string, error) {
+	spec, err := ck.spec(client, strings.ToUpper(c.cmd))
+	if err != nil {
+		return nil, errors.Errorf("looking up keys of %q: %w", c.cmd, err)
+	} else if !spec.known {
+		return c.Keys(), nil
+	} else if spec.movable {
+		var keys []string
+		args := append([]string{"GETKEYS", c.cmd}, c.args...)
+		err := client.Do(Cmd(&keys, "COMMAND", args...))
+		if errors.As(err, new(resp2.Error)) {
+			// COMMAND GETKEYS returns an error if the command has no keys
+			return nil, nil
+		} else if err != nil {
+			return nil, errors.Errorf("getting keys of %q: %w", c.cmd, err)
+		}
+		return keys, nil
+	} else if spec.firstKey <= 0 || spec.step <= 0 {
+		return nil, nil
+	}
+
+	// positions given by COMMAND INFO include the command name, and a negative
+	// lastKey is relative to the end of the arguments.
+	lastKey := spec.lastKey
+	if lastKey < 0 {
+		lastKey = len(c.args) + 1 + lastKey
+	}
+	var keys []string
+	for i := spec.firstKey; i <= lastKey && i <= len(c.args); i += spec.step {
+		keys = append(keys, c.args[i-1])
+	}
+	return keys, nil
+}
+
+// actionKeys returns the keys of the given Action, using COMMAND GETKEYS if
+// ClusterCommandGetKeys was given.
+func (c *Cluster) actionKeys(a Action) ([]string, error) {
+	cmdA, ok := a.(*cmdAction)
+	if !ok || c.cmdKeys == nil || cmdA.flat {
+		return a.Keys(), nil
+	}
+	cmd := strings.ToUpper(cmdA.cmd)
+	if clusterKnownKeysCmds[cmd] || noKeyCmds[cmd] {
+		return a.Keys(), nil
+	}
+
+	client, err := c.rpool("")
+	if err != nil {
+		return nil, err
+	}
+	return c.cmdKeys.keys(client, cmdA)
+}
@@ -0,0 +1,181 @@
+package radix
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// latencyEWMAWeight is the weight given to each new RTT measurement when
+	// updating a node's smoothed RTT.
+	latencyEWMAWeight = 0.3
+
+	// latencySwitchRatio determines how much faster a node must be than the
+	// currently preferred node before reads are switched over to it. This
+	// prevents reads from flapping between nodes with similar latencies.
+	latencySwitchRatio = 0.8
+)
+
+type nodeLatency struct {
+	rtt     time.Duration // smoothed, 0 if never successfully measured
+	healthy bool
+}
+
+// clusterLatency tracks the RTT of every node in the cluster, and uses them to
+// determine which node reads for each primary's slots should be sent to.
+type clusterLatency struct {
+	l         sync.RWMutex
+	nodes     map[string]nodeLatency
+	preferred map[string]string // primary addr -> addr to read from
+}
+
+func newClusterLatency() *clusterLatency {
+	return &clusterLatency{
+		nodes:     map[string]nodeLatency{},
+		preferred: map[string]string{},
+	}
+}
+
+// record updates the smoothed RTT of the node at addr with the given
+// measurement. If err is not nil the node is marked as unhealthy instead.
+// Returns true if the node's health changed, including if a node which was
+// never measured before is unhealthy.
+func (cl *clusterLatency) record(addr string, rtt time.Duration, err error) bool {
+	cl.l.Lock()
+	defer cl.l.Unlock()
+	nl, seen := cl.nodes[addr]
+	changed := (seen && nl.healthy == (err != nil)) || (!seen && err != nil)
+	if err != nil {
+		nl.healthy = false
+	} else if !nl.healthy || nl.rtt == 0 {
+		nl.rtt, nl.healthy = rtt, true
+	} else {
+		nl.rtt += time.Duration(latencyEWMAWeight * float64(rtt-nl.rtt))
+	}
+	cl.nodes[addr] = nl
+	return changed
+}
+
+// choose updates the preferred read node for each primary in the topology,
+// considering the primary and all of its secondaries, or only those in the
+// given zone if any of them are healthy. Nodes which are no longer in the
+// topology are forgotten.
+func (cl *clusterLatency) choose(tt ClusterTopo, zone string) {
+	candidates := map[string][]string{}
+	zoneCandidates := map[string][]string{}
+	for _, node := range tt {
+		primAddr := node.Addr
+		if node.SecondaryOfAddr != "" {
+			primAddr = node.SecondaryOfAddr
+		}
+		candidates[primAddr] = append(candidates[primAddr], node.Addr)
+		if zone != "" && node.Zone == zone {
+			zoneCandidates[primAddr] = append(zoneCandidates[primAddr], node.Addr)
+		}
+	}
+
+	cl.l.Lock()
+	defer cl.l.Unlock()
+
+	tm := tt.Map()
+	for addr := range cl.nodes {
+		if _, ok := tm[addr]; !ok {
+			delete(cl.nodes, addr)
+		}
+	}
+
+	preferred := make(map[string]string, len(candidates))
+	for primAddr, addrs := range candidates {
+		for _, addr := range zoneCandidates[primAddr] {
+			if cl.nodes[addr].healthy {
+				addrs = zoneCandidates[primAddr]
+				break
+			}
+		}
+
+		var best string
+		var currIsCandidate bool
+		curr := cl.preferred[primAddr]
+		for _, addr := range addrs {
+			currIsCandidate = currIsCandidate || addr == curr
+			nl := cl.nodes[addr]
+			if !nl.healthy {
+				continue
+			} else if best == "" || nl.rtt < cl.nodes[best].rtt {
+				best = addr
+			}
+		}
+
+		// only switch away from the currently preferred node if it's unhealthy
+		// or the best node is significantly faster
+		if currNL := cl.nodes[curr]; currIsCandidate && currNL.healthy {
+			bestRTT := float64(cl.nodes[best].rtt)
+			if bestRTT >= latencySwitchRatio*float64(currNL.rtt) {
+				best = curr
+			}
+		}
+
+		if best != "" {
+			preferred[primAddr] = best
+		}
+	}
+	cl.preferred = preferred
+}
+
+// preferredFor returns the address reads for the primary's slots should be
+// sent to, or empty string if no node is known to be healthy.
+func (cl *clusterLatency) preferredFor(primAddr string) string {
+	cl.l.RLock()
+	defer cl.l.RUnlock()
+	return cl.preferred[primAddr]
+}
+
+// measureLatency PINGs every node in the Cluster's topology concurrently,
+// records their RTTs, and then updates the preferred read nodes.
+func (c *Cluster) measureLatency() {
+	tt := c.Topo()
+	var wg sync.WaitGroup
+	for _, node := range tt {
+		client, _ := c.rpool(node.Addr)
+		if client == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(addr string, client Client) {
+			defer wg.Done()
+			start := time.Now()
+			err := client.Do(Cmd(nil, "PING"))
+
+			c.eventL.Lock()
+			defer c.eventL.Unlock()
+			if !c.latency.record(addr, time.Since(start), err) {
+				return
+			} else if err != nil {
+				c.event(ClusterEvent{Type: ClusterNodeUnhealthy, Addr: addr, Err: err})
+			} else {
+				c.event(ClusterEvent{Type: ClusterNodeRecovered, Addr: addr})
+			}
+		}(node.Addr, client)
+	}
+	wg.Wait()
+	c.latency.choose(tt, c.co.preferZone)
+}
+
+func (c *Cluster) measureLatencyEvery(d time.Duration) {
+	c.closeWG.Add(1)
+	go func() {
+		defer c.closeWG.Done()
+		t := time.NewTicker(d)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				c.measureLatency()
+			case <-c.closeCh:
+				return
+			}
+		}
+	}()
+}
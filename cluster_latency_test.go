@@ -0,0 +1,105 @@
+package radix
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+)
+
+func TestClusterLatency(t *T) {
+	tt := ClusterTopo{
+		{Addr: "prim:6379", Slots: [][2]uint16{{0, numSlots}}},
+		{Addr: "sec1:6379", Slots: [][2]uint16{{0, numSlots}}, SecondaryOfAddr: "prim:6379"},
+		{Addr: "sec2:6379", Slots: [][2]uint16{{0, numSlots}}, SecondaryOfAddr: "prim:6379"},
+	}
+
+	cl := newClusterLatency()
+	assert.Empty(t, cl.preferredFor("prim:6379"))
+
+	measure := func(prim, sec1, sec2 time.Duration) {
+		for addr, rtt := range map[string]time.Duration{
+			"prim:6379": prim, "sec1:6379": sec1, "sec2:6379": sec2,
+		} {
+			var err error
+			if rtt < 0 {
+				err = errors.New("ping failed")
+			}
+			cl.record(addr, rtt, err)
+		}
+		cl.choose(tt, "")
+	}
+
+	// the lowest latency node is chosen initially
+	measure(5*time.Millisecond, 2*time.Millisecond, 3*time.Millisecond)
+	assert.Equal(t, "sec1:6379", cl.preferredFor("prim:6379"))
+
+	// sec2 becoming slightly faster shouldn't cause a switch
+	for i := 0; i < 10; i++ {
+		measure(5*time.Millisecond, 2*time.Millisecond, 1900*time.Microsecond)
+	}
+	assert.Equal(t, "sec1:6379", cl.preferredFor("prim:6379"))
+
+	// but sec2 becoming much faster should
+	for i := 0; i < 10; i++ {
+		measure(5*time.Millisecond, 2*time.Millisecond, 500*time.Microsecond)
+	}
+	assert.Equal(t, "sec2:6379", cl.preferredFor("prim:6379"))
+
+	// if sec2 becomes unhealthy then sec1 should be used
+	measure(5*time.Millisecond, 2*time.Millisecond, -1)
+	assert.Equal(t, "sec1:6379", cl.preferredFor("prim:6379"))
+
+	// if all nodes are unhealthy then there's no preference
+	measure(-1, -1, -1)
+	assert.Empty(t, cl.preferredFor("prim:6379"))
+
+	// record reports changes in health
+	errDown := errors.New("ping failed")
+	assert.True(t, cl.record("new:6379", 0, errDown))
+	assert.False(t, cl.record("new:6379", 0, errDown))
+	assert.True(t, cl.record("new:6379", time.Millisecond, nil))
+	assert.False(t, cl.record("new:6379", time.Millisecond, nil))
+	assert.True(t, cl.record("new:6379", 0, errDown))
+	assert.False(t, cl.record("newer:6379", time.Millisecond, nil))
+
+	// nodes in the preferred zone are chosen over faster ones, as long as
+	// they're healthy
+	tt[0].Zone, tt[1].Zone, tt[2].Zone = "a", "a", "b"
+	measure(5*time.Millisecond, 2*time.Millisecond, time.Millisecond)
+	cl.choose(tt, "a")
+	assert.Equal(t, "sec1:6379", cl.preferredFor("prim:6379"))
+	measure(-1, -1, time.Millisecond)
+	cl.choose(tt, "a")
+	assert.Equal(t, "sec2:6379", cl.preferredFor("prim:6379"))
+
+	// nodes which leave the topology are forgotten
+	cl.choose(tt[:1], "")
+	cl.l.RLock()
+	assert.Len(t, cl.nodes, 1)
+	cl.l.RUnlock()
+}
+
+func TestClusterLatencyBasedReads(t *T) {
+	c, _ := newTestCluster(ClusterLatencyBasedReads(time.Hour))
+	defer c.Close()
+
+	// every primary should have some preferred node from its own set of nodes
+	for _, node := range c.Topo().Primaries() {
+		addr := c.latency.preferredFor(node.Addr)
+		require.NotEmpty(t, addr)
+		if addr != node.Addr {
+			assert.Contains(t, c.secondaries[node.Addr], addr)
+		}
+	}
+
+	key := clusterSlotKeys[0]
+	value := randStr()
+	require.NoError(t, c.Do(Cmd(nil, "SET", key, value)))
+
+	var res string
+	require.NoError(t, c.DoSecondary(Cmd(&res, "GET", key)))
+	assert.Equal(t, value, res)
+}
@@ -0,0 +1,591 @@
+package radix
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+type clusterPubSubOpts struct {
+	cf             ConnFunc
+	errCh          chan<- error
+	resyncInterval time.Duration
+}
+
+// ClusterPubSubOpt is an optional behavior which can be applied to the
+// NewClusterPubSub function to effect a ClusterPubSub's behavior.
+type ClusterPubSubOpt func(*clusterPubSubOpts)
+
+// ClusterPubSubConnFunc tells the ClusterPubSub to use the given ConnFunc when
+// connecting to the cluster's nodes.
+func ClusterPubSubConnFunc(cf ConnFunc) ClusterPubSubOpt {
+	return func(co *clusterPubSubOpts) {
+		co.cf = cf
+	}
+}
+
+// ClusterPubSubErrCh takes a channel which asynchronous errors encountered by
+// the ClusterPubSub, e.g. while re-establishing subscriptions, can be read off
+// of. If the channel blocks the error will be dropped.
+func ClusterPubSubErrCh(errCh chan<- error) ClusterPubSubOpt {
+	return func(co *clusterPubSubOpts) {
+		co.errCh = errCh
+	}
+}
+
+// ClusterPubSubResyncInterval tells the ClusterPubSub how often to check its
+// subscriptions against the Cluster's topology, re-establishing any which have
+// been lost or whose channels' slots have moved to another node.
+func ClusterPubSubResyncInterval(d time.Duration) ClusterPubSubOpt {
+	return func(co *clusterPubSubOpts) {
+		co.resyncInterval = d
+	}
+}
+
+// clusterPubSubConn is a connection used by ClusterPubSub, along with what's
+// subscribed on it.
+type clusterPubSubConn struct {
+	*pubSubConn
+	addr string
+
+	// closedCh is closed once the pubSubConn has been closed, for any reason.
+	closedCh chan struct{}
+
+	// subbed and psubbed are the channels and patterns subscribed to using the
+	// connection, ssubbed are the shard channels.
+	subbed, psubbed, ssubbed map[string]bool
+}
+
+func (cc *clusterPubSubConn) isClosed() bool {
+	select {
+	case <-cc.closedCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// ClusterPubSub is a PubSubConn for a redis cluster, which subscribes to
+// channels on the cluster's nodes as needed. It additionally supports sharded
+// pubsub, see SSubscribe.
+//
+// Channels and patterns subscribed to using Subscribe and PSubscribe, whose
+// messages are propagated to every node, are all subscribed to on a single
+// connection to any of the cluster's primaries. Shard channels subscribed to
+// using SSubscribe are subscribed to on a connection to the primary serving
+// the channel's slot, with one connection per primary.
+//
+// Subscriptions are re-established in the background whenever a connection is
+// lost, e.g. because its node failed over, and whenever a shard channel's slot
+// is moved to another primary, either because redis has unsubscribed the
+// connection from it or because the Cluster's topology has changed. Messages
+// published while a subscription is being re-established may be missed, and
+// messages published while a shard channel is being moved may be received
+// twice.
+//
+// Messages from all connections are written to the msgChs given to the
+// subscribe methods, so a single msgCh may be used for every subscription to
+// receive all messages as one stream.
+type ClusterPubSub struct {
+	cluster *Cluster
+	co      clusterPubSubOpts
+
+	// csL protects subs, psubs and ssubs, which are the subscriptions which
+	// should be established.
+	csL                sync.RWMutex
+	subs, psubs, ssubs chanSet
+
+	// l protects everything else, and is held while subscriptions are being
+	// established.
+	l           sync.Mutex
+	closed      bool
+	conn        *clusterPubSubConn
+	shardConns  map[string]*clusterPubSubConn
+	shardSubbed map[string]string // channel -> addr
+
+	lostL sync.Mutex
+	lost  map[string]string // channel -> addr
+
+	// msgCh is subscribed to every channel on every connection, messages read
+	// off of it are published to the subscribed msgChs.
+	msgCh    chan PubSubMessage
+	resyncCh chan struct{}
+	closeCh  chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewClusterPubSub initializes and returns a ClusterPubSub which subscribes to
+// channels on the given Cluster's nodes. Connections are only created once
+// they're needed. The Cluster is used for its topology only, and is not closed
+// when the ClusterPubSub is.
+//
+// NewClusterPubSub takes in a number of options which can overwrite its
+// default behavior. The default options NewClusterPubSub uses are:
+//
+//	ClusterPubSubConnFunc(DefaultConnFunc)
+//	ClusterPubSubResyncInterval(1 * time.Second)
+//
+func NewClusterPubSub(cluster *Cluster, opts ...ClusterPubSubOpt) *ClusterPubSub {
+	cps := &ClusterPubSub{
+		cluster:     cluster,
+		subs:        chanSet{},
+		psubs:       chanSet{},
+		ssubs:       chanSet{},
+		shardConns:  map[string]*clusterPubSubConn{},
+		shardSubbed: map[string]string{},
+		lost:        map[string]string{},
+		msgCh:       make(chan PubSubMessage),
+		resyncCh:    make(chan struct{}, 1),
+		closeCh:     make(chan struct{}),
+	}
+
+	defaultClusterPubSubOpts := []ClusterPubSubOpt{
+		ClusterPubSubConnFunc(DefaultConnFunc),
+		ClusterPubSubResyncInterval(1 * time.Second),
+	}
+	for _, opt := range append(defaultClusterPubSubOpts, opts...) {
+		if opt != nil {
+			opt(&(cps.co))
+		}
+	}
+
+	cps.wg.Add(2)
+	go cps.publishLoop()
+	go cps.resyncLoop()
+	return cps
+}
+
+func (cps *ClusterPubSub) err(err error) {
+	select {
+	case cps.co.errCh <- err:
+	default:
+	}
+}
+
+func (cps *ClusterPubSub) publishLoop() {
+	defer cps.wg.Done()
+	for {
+		select {
+		case m := <-cps.msgCh:
+			cps.publish(m)
+		case <-cps.closeCh:
+			return
+		}
+	}
+}
+
+func (cps *ClusterPubSub) publish(m PubSubMessage) {
+	cps.csL.RLock()
+	defer cps.csL.RUnlock()
+
+	var subs map[chan<- PubSubMessage]bool
+	switch m.Type {
+	case "pmessage":
+		subs = cps.psubs[m.Pattern]
+	case "smessage":
+		subs = cps.ssubs[m.Channel]
+	default:
+		subs = cps.subs[m.Channel]
+	}
+
+	for ch := range subs {
+		ch <- m
+	}
+}
+
+func (cps *ClusterPubSub) triggerResync() {
+	select {
+	case cps.resyncCh <- struct{}{}:
+	default:
+	}
+}
+
+func (cps *ClusterPubSub) resyncLoop() {
+	defer cps.wg.Done()
+	t := time.NewTicker(cps.co.resyncInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-cps.resyncCh:
+		case <-cps.closeCh:
+			return
+		}
+
+		cps.l.Lock()
+		if !cps.closed {
+			if err := cps.resync(); err != nil {
+				cps.err(err)
+			}
+		}
+		cps.l.Unlock()
+	}
+}
+
+// dial creates a connection to the given node. NOTE l _must_ be held.
+func (cps *ClusterPubSub) dial(addr string) (*clusterPubSubConn, error) {
+	conn, err := cps.co.cf("tcp", addr)
+	if err != nil {
+		return nil, errors.Errorf("connecting to %s: %w", addr, err)
+	}
+
+	onSUnsubscribed := func(channel string) {
+		cps.lostL.Lock()
+		cps.lost[channel] = addr
+		cps.lostL.Unlock()
+		cps.triggerResync()
+	}
+
+	closeErrCh := make(chan error, 1)
+	cc := &clusterPubSubConn{
+		pubSubConn: newPubSubConn(conn, closeErrCh, onSUnsubscribed),
+		addr:       addr,
+		closedCh:   make(chan struct{}),
+		subbed:     map[string]bool{},
+		psubbed:    map[string]bool{},
+		ssubbed:    map[string]bool{},
+	}
+
+	go func() {
+		if err := <-closeErrCh; err != nil {
+			cps.err(errors.Errorf("connection to %s closed: %w", addr, err))
+		}
+		close(cc.closedCh)
+		cps.triggerResync()
+	}()
+	return cc, nil
+}
+
+// resync establishes all subscriptions which should be established, and removes
+// those which shouldn't. NOTE l _must_ be held.
+func (cps *ClusterPubSub) resync() error {
+	cps.csL.RLock()
+	subs := make([]string, 0, len(cps.subs))
+	for channel := range cps.subs {
+		subs = append(subs, channel)
+	}
+	psubs := make([]string, 0, len(cps.psubs))
+	for pattern := range cps.psubs {
+		psubs = append(psubs, pattern)
+	}
+	ssubs := make([]string, 0, len(cps.ssubs))
+	for channel := range cps.ssubs {
+		ssubs = append(ssubs, channel)
+	}
+	cps.csL.RUnlock()
+
+	if err := cps.resyncSubs(subs, psubs); err != nil {
+		return err
+	}
+	return cps.resyncShardSubs(ssubs)
+}
+
+func (cps *ClusterPubSub) resyncSubs(subs, psubs []string) error {
+	topo := cps.cluster.Topo().Primaries()
+	if cc := cps.conn; cc != nil && (cc.isClosed() || len(subs)+len(psubs) == 0 || !topoHasAddr(topo, cc.addr)) {
+		cc.Close()
+		cps.conn = nil
+	}
+	if len(subs)+len(psubs) == 0 {
+		return nil
+	}
+
+	if cps.conn == nil {
+		if len(topo) == 0 {
+			return errors.New("no primaries in cluster topology")
+		}
+		cc, err := cps.dial(topo[rand.Intn(len(topo))].Addr)
+		if err != nil {
+			return err
+		}
+		cps.conn = cc
+	}
+	cc := cps.conn
+
+	if add, del := diffSubs(cc.subbed, subs); len(add)+len(del) > 0 {
+		if err := cc.Subscribe(cps.msgCh, add...); err != nil {
+			return err
+		} else if err := cc.Unsubscribe(cps.msgCh, del...); err != nil {
+			return err
+		}
+		updateSubbed(cc.subbed, add, del)
+	}
+	if add, del := diffSubs(cc.psubbed, psubs); len(add)+len(del) > 0 {
+		if err := cc.PSubscribe(cps.msgCh, add...); err != nil {
+			return err
+		} else if err := cc.PUnsubscribe(cps.msgCh, del...); err != nil {
+			return err
+		}
+		updateSubbed(cc.psubbed, add, del)
+	}
+	return nil
+}
+
+func (cps *ClusterPubSub) resyncShardSubs(ssubs []string) error {
+	cps.lostL.Lock()
+	lost := cps.lost
+	cps.lost = map[string]string{}
+	cps.lostL.Unlock()
+
+	if len(lost) > 0 {
+		// redis unsubscribing a channel means its slot was moved, so the
+		// Cluster's topology needs updating before it's subscribed to again.
+		if err := cps.cluster.Sync(); err != nil {
+			cps.err(errors.Errorf("syncing cluster topology: %w", err))
+		}
+		for channel, addr := range lost {
+			if cc := cps.shardConns[addr]; cc != nil {
+				delete(cc.ssubbed, channel)
+			}
+			if cps.shardSubbed[channel] == addr {
+				delete(cps.shardSubbed, channel)
+			}
+		}
+	}
+
+	for addr, cc := range cps.shardConns {
+		if !cc.isClosed() {
+			continue
+		}
+		cc.Close()
+		delete(cps.shardConns, addr)
+		for channel, subAddr := range cps.shardSubbed {
+			if subAddr == addr {
+				delete(cps.shardSubbed, channel)
+			}
+		}
+	}
+
+	// work out which node each channel should be subscribed to on, and which
+	// channels need to be unsubscribed from the node they currently are.
+	want := map[string]bool{}
+	toSub := map[string][]string{}
+	toUnsub := map[string][]string{}
+	for _, channel := range ssubs {
+		want[channel] = true
+		addr := cps.cluster.addrForKey(channel)
+		if addr == "" {
+			return errors.Errorf("no primary serving slot of shard channel %q", channel)
+		}
+		if subAddr, ok := cps.shardSubbed[channel]; ok && subAddr != addr {
+			toUnsub[subAddr] = append(toUnsub[subAddr], channel)
+		} else if ok {
+			continue
+		}
+		toSub[addr] = append(toSub[addr], channel)
+	}
+	for channel, addr := range cps.shardSubbed {
+		if !want[channel] {
+			toUnsub[addr] = append(toUnsub[addr], channel)
+		}
+	}
+
+	for addr, channels := range toUnsub {
+		cc := cps.shardConns[addr]
+		if cc == nil {
+			continue
+		}
+		for _, channel := range channels {
+			delete(cps.shardSubbed, channel)
+			delete(cc.ssubbed, channel)
+		}
+		if len(cc.ssubbed) == 0 {
+			cc.Close()
+			delete(cps.shardConns, addr)
+		} else if err := cc.SUnsubscribe(cps.msgCh, channels...); err != nil {
+			return err
+		}
+	}
+
+	for _, addr := range sortedKeys(toSub) {
+		channels := toSub[addr]
+		cc := cps.shardConns[addr]
+		if cc == nil {
+			var err error
+			if cc, err = cps.dial(addr); err != nil {
+				return err
+			}
+			cps.shardConns[addr] = cc
+		}
+		if err := cc.SSubscribe(cps.msgCh, channels...); err != nil {
+			return err
+		}
+		for _, channel := range channels {
+			cc.ssubbed[channel] = true
+			cps.shardSubbed[channel] = addr
+		}
+	}
+	return nil
+}
+
+func topoHasAddr(topo ClusterTopo, addr string) bool {
+	for _, node := range topo {
+		if node.Addr == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// diffSubs returns the elements of want which aren't in subbed, and the
+// elements of subbed which aren't in want.
+func diffSubs(subbed map[string]bool, want []string) (add, del []string) {
+	wantM := make(map[string]bool, len(want))
+	for _, s := range want {
+		wantM[s] = true
+		if !subbed[s] {
+			add = append(add, s)
+		}
+	}
+	for s := range subbed {
+		if !wantM[s] {
+			del = append(del, s)
+		}
+	}
+	return add, del
+}
+
+func updateSubbed(subbed map[string]bool, add, del []string) {
+	for _, s := range add {
+		subbed[s] = true
+	}
+	for _, s := range del {
+		delete(subbed, s)
+	}
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// update applies fn to the subscriptions which should be established, and then
+// establishes them. If establishing them fails the error is returned, but the
+// subscriptions are kept and will be established in the background.
+func (cps *ClusterPubSub) update(fn func()) error {
+	cps.l.Lock()
+	defer cps.l.Unlock()
+	if cps.closed {
+		return errors.New("closed")
+	}
+
+	cps.csL.Lock()
+	fn()
+	cps.csL.Unlock()
+	return cps.resync()
+}
+
+// Subscribe implements the method for the PubSubConn interface.
+func (cps *ClusterPubSub) Subscribe(msgCh chan<- PubSubMessage, channels ...string) error {
+	return cps.update(func() {
+		for _, channel := range channels {
+			cps.subs.add(channel, msgCh)
+		}
+	})
+}
+
+// Unsubscribe implements the method for the PubSubConn interface.
+func (cps *ClusterPubSub) Unsubscribe(msgCh chan<- PubSubMessage, channels ...string) error {
+	return cps.update(func() {
+		for _, channel := range channels {
+			cps.subs.del(channel, msgCh)
+		}
+	})
+}
+
+// PSubscribe implements the method for the PubSubConn interface.
+func (cps *ClusterPubSub) PSubscribe(msgCh chan<- PubSubMessage, patterns ...string) error {
+	return cps.update(func() {
+		for _, pattern := range patterns {
+			cps.psubs.add(pattern, msgCh)
+		}
+	})
+}
+
+// PUnsubscribe implements the method for the PubSubConn interface.
+func (cps *ClusterPubSub) PUnsubscribe(msgCh chan<- PubSubMessage, patterns ...string) error {
+	return cps.update(func() {
+		for _, pattern := range patterns {
+			cps.psubs.del(pattern, msgCh)
+		}
+	})
+}
+
+// SSubscribe is like Subscribe, but it subscribes msgCh to a set of shard
+// channels using SSUBSCRIBE, each on the primary serving the channel's slot.
+// msgCh will receive a PubSubMessage with a Type of "smessage" for every
+// message published to any of the channels using SPUBLISH.
+func (cps *ClusterPubSub) SSubscribe(msgCh chan<- PubSubMessage, channels ...string) error {
+	return cps.update(func() {
+		for _, channel := range channels {
+			cps.ssubs.add(channel, msgCh)
+		}
+	})
+}
+
+// SUnsubscribe is like Unsubscribe, but it unsubscribes msgCh from a set of
+// shard channels.
+func (cps *ClusterPubSub) SUnsubscribe(msgCh chan<- PubSubMessage, channels ...string) error {
+	return cps.update(func() {
+		for _, channel := range channels {
+			cps.ssubs.del(channel, msgCh)
+		}
+	})
+}
+
+// Ping implements the method for the PubSubConn interface. It performs a PING
+// on every connection the ClusterPubSub has open.
+func (cps *ClusterPubSub) Ping() error {
+	cps.l.Lock()
+	defer cps.l.Unlock()
+	if cps.closed {
+		return errors.New("closed")
+	}
+
+	if cps.conn != nil {
+		if err := cps.conn.Ping(); err != nil {
+			return err
+		}
+	}
+	for _, cc := range cps.shardConns {
+		if err := cc.Ping(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close implements the method for the PubSubConn interface. All of the
+// ClusterPubSub's connections are closed.
+func (cps *ClusterPubSub) Close() error {
+	cps.l.Lock()
+	if cps.closed {
+		cps.l.Unlock()
+		return errors.New("closed")
+	}
+	cps.closed = true
+
+	var closeErr error
+	if cps.conn != nil {
+		closeErr = cps.conn.Close()
+	}
+	for _, cc := range cps.shardConns {
+		if err := cc.Close(); closeErr == nil && err != nil {
+			closeErr = err
+		}
+	}
+	cps.l.Unlock()
+
+	close(cps.closeCh)
+	cps.wg.Wait()
+	return closeErr
+}
+
+var _ PubSubConn = new(ClusterPubSub)
@@ -0,0 +1,120 @@
+package radix
+
+import (
+	"sync"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClusterPubSub(t *T) {
+	c, scl := newTestCluster()
+	defer c.Close()
+
+	var l sync.Mutex
+	var dials int
+	inChs := map[Conn]chan<- PubSubMessage{}
+	connFunc := func(network, addr string) (Conn, error) {
+		conn, inCh := PubSubStub(network, addr, func([]string) interface{} {
+			return "OK"
+		})
+		l.Lock()
+		defer l.Unlock()
+		dials++
+		inChs[conn] = inCh
+		return conn, nil
+	}
+	numDials := func() int {
+		l.Lock()
+		defer l.Unlock()
+		return dials
+	}
+
+	cps := NewClusterPubSub(c,
+		ClusterPubSubConnFunc(connFunc),
+		ClusterPubSubResyncInterval(time.Hour),
+	)
+	defer cps.Close()
+
+	msgCh := make(chan PubSubMessage, 1)
+	waitFor := func(fn func() bool) {
+		for i := 0; ; i++ {
+			require.True(t, i < 100)
+			cps.l.Lock()
+			ok := fn()
+			cps.l.Unlock()
+			if ok {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// connOf returns the Conn the ClusterPubSub is using for the given shard
+	// channel, or for other channels if channel is empty.
+	connOf := func(channel string) Conn {
+		cps.l.Lock()
+		defer cps.l.Unlock()
+		if channel == "" {
+			return cps.conn.conn
+		}
+		return cps.shardConns[cps.shardSubbed[channel]].conn
+	}
+
+	assertMsg := func(conn Conn, m PubSubMessage) {
+		l.Lock()
+		inCh := inChs[conn]
+		l.Unlock()
+		inCh <- m
+		select {
+		case got := <-msgCh:
+			assert.Equal(t, m, got)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %+v", m)
+		}
+	}
+
+	// shard channels are subscribed to on the primary serving their slot
+	fooAddr := c.addrForKey("foo")
+	require.NoError(t, cps.SSubscribe(msgCh, "foo"))
+	assert.Equal(t, 1, numDials())
+	fooMsg := PubSubMessage{Type: "smessage", Channel: "foo", Message: []byte("a")}
+	assertMsg(connOf("foo"), fooMsg)
+
+	// other channels are all subscribed to on a single connection
+	require.NoError(t, cps.Subscribe(msgCh, "bar"))
+	require.NoError(t, cps.PSubscribe(msgCh, "b*"))
+	require.Equal(t, 2, numDials())
+	assertMsg(connOf(""), PubSubMessage{Type: "message", Channel: "bar", Message: []byte("b")})
+	assertMsg(connOf(""), PubSubMessage{Type: "pmessage", Pattern: "b*", Channel: "baz", Message: []byte("c")})
+
+	// moving the shard channel's slot moves its subscription
+	var dstAddr string
+	for _, node := range c.Topo().Primaries() {
+		if node.Addr != fooAddr {
+			dstAddr = node.Addr
+			break
+		}
+	}
+	fooSlot := ClusterSlot([]byte("foo"))
+	scl.migrateSlotRange(dstAddr, fooSlot, fooSlot+1)
+	require.NoError(t, c.Sync())
+	cps.triggerResync()
+	waitFor(func() bool { return cps.shardSubbed["foo"] == dstAddr })
+	assertMsg(connOf("foo"), fooMsg)
+
+	// losing a connection causes it to be re-established
+	connOf("").Close()
+	waitFor(func() bool {
+		return numDials() == 4 && cps.conn != nil && cps.conn.subbed["bar"]
+	})
+	assertMsg(connOf(""), PubSubMessage{Type: "message", Channel: "bar", Message: []byte("d")})
+
+	// unsubscribing from everything on a connection closes it
+	require.NoError(t, cps.SUnsubscribe(msgCh, "foo"))
+	cps.l.Lock()
+	assert.Empty(t, cps.shardConns)
+	cps.l.Unlock()
+}
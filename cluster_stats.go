@@ -0,0 +1,165 @@
+package radix
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+// clusterNodeCounters counts the Actions a Cluster has performed on a single
+// node.
+type clusterNodeCounters struct {
+	// Atomic fields must be at the beginning of the struct since they must be
+	// correctly aligned or else access may cause panics on 32-bit architectures
+	// See https://golang.org/pkg/sync/atomic/#pkg-note-BUG
+	actions, errors, moved, asked uint64
+}
+
+func (cnc *clusterNodeCounters) record(err error) {
+	atomic.AddUint64(&cnc.actions, 1)
+	if err == nil {
+		return
+	}
+
+	var respErr resp2.Error
+	if !errors.As(err, &respErr) {
+		atomic.AddUint64(&cnc.errors, 1)
+		return
+	}
+	switch respErr.Prefix() {
+	case "MOVED":
+		atomic.AddUint64(&cnc.moved, 1)
+	case "ASK":
+		atomic.AddUint64(&cnc.asked, 1)
+	default:
+		atomic.AddUint64(&cnc.errors, 1)
+	}
+}
+
+// clusterStats holds the counters used to produce a Cluster's ClusterStats.
+type clusterStats struct {
+	// Atomic fields must be at the beginning of the struct since they must be
+	// correctly aligned or else access may cause panics on 32-bit architectures
+	// See https://golang.org/pkg/sync/atomic/#pkg-note-BUG
+	lastSync int64 // unix timestamp in nanoseconds
+
+	l     sync.RWMutex
+	nodes map[string]*clusterNodeCounters
+}
+
+func (cs *clusterStats) node(addr string) *clusterNodeCounters {
+	cs.l.RLock()
+	cnc := cs.nodes[addr]
+	cs.l.RUnlock()
+	if cnc != nil {
+		return cnc
+	}
+
+	cs.l.Lock()
+	defer cs.l.Unlock()
+	if cs.nodes == nil {
+		cs.nodes = map[string]*clusterNodeCounters{}
+	}
+	if cnc = cs.nodes[addr]; cnc == nil {
+		cnc = new(clusterNodeCounters)
+		cs.nodes[addr] = cnc
+	}
+	return cnc
+}
+
+// synced records that the Cluster synced with the given topology, discarding
+// the counters of any nodes no longer in it.
+func (cs *clusterStats) synced(tt ClusterTopo) {
+	atomic.StoreInt64(&cs.lastSync, time.Now().UnixNano())
+
+	tm := tt.Map()
+	cs.l.Lock()
+	defer cs.l.Unlock()
+	for addr := range cs.nodes {
+		if _, ok := tm[addr]; !ok {
+			delete(cs.nodes, addr)
+		}
+	}
+}
+
+// ClusterNodeStats describes a single node of a Cluster, see ClusterStats.
+type ClusterNodeStats struct {
+	// Node is the node as it appears in the Cluster's topology.
+	Node ClusterNode
+
+	// Pool is the PoolStats of the node's pool. It's nil if the node has no
+	// pool yet, or if the pool isn't a *Pool (see ClusterPoolFunc).
+	Pool *PoolStats
+
+	// Actions is the number of Actions performed on the node, and Errors the
+	// number of those which returned an error. MOVED and ASK errors aren't
+	// counted in Errors, but in Moved and Asked.
+	Actions, Errors, Moved, Asked uint64
+
+	// ErrorRate is Errors as a fraction of Actions, or 0 if no Actions have
+	// been performed on the node.
+	ErrorRate float64
+}
+
+// ClusterStats describes the state of a Cluster at a point in time, see
+// Cluster.Stats.
+type ClusterStats struct {
+	// LastSync is the time the Cluster last successfully synced its topology
+	// with the cluster.
+	LastSync time.Time
+
+	// Moved and Asked are the total number of MOVED and ASK errors received
+	// across all nodes.
+	Moved, Asked uint64
+
+	// Nodes holds the ClusterNodeStats of every node in the Cluster's
+	// topology, keyed by address.
+	Nodes map[string]ClusterNodeStats
+}
+
+// Stats returns a snapshot of the Cluster's ClusterStats. Counts are kept for
+// as long as a node remains in the Cluster's topology.
+func (c *Cluster) Stats() ClusterStats {
+	cs := ClusterStats{Nodes: map[string]ClusterNodeStats{}}
+	if lastSync := atomic.LoadInt64(&c.stats.lastSync); lastSync > 0 {
+		cs.LastSync = time.Unix(0, lastSync)
+	}
+
+	c.l.RLock()
+	topo := c.topo
+	pools := make(map[string]Client, len(c.pools))
+	for addr, p := range c.pools {
+		pools[addr] = p
+	}
+	c.l.RUnlock()
+
+	for _, node := range topo {
+		ns := ClusterNodeStats{Node: node}
+		if p, ok := pools[node.Addr].(interface{ Stats() PoolStats }); ok {
+			ps := p.Stats()
+			ns.Pool = &ps
+		}
+
+		c.stats.l.RLock()
+		cnc := c.stats.nodes[node.Addr]
+		c.stats.l.RUnlock()
+		if cnc != nil {
+			ns.Actions = atomic.LoadUint64(&cnc.actions)
+			ns.Errors = atomic.LoadUint64(&cnc.errors)
+			ns.Moved = atomic.LoadUint64(&cnc.moved)
+			ns.Asked = atomic.LoadUint64(&cnc.asked)
+		}
+		if ns.Actions > 0 {
+			ns.ErrorRate = float64(ns.Errors) / float64(ns.Actions)
+		}
+
+		cs.Moved += ns.Moved
+		cs.Asked += ns.Asked
+		cs.Nodes[node.Addr] = ns
+	}
+	return cs
+}
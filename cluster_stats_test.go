@@ -0,0 +1,60 @@
+package radix
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+)
+
+func TestClusterStats(t *T) {
+	scl := newStubCluster(testTopo)
+	start := time.Now()
+	c := scl.newCluster(ClusterPoolFunc(func(network, addr string) (Client, error) {
+		connFunc := func(string, string) (Conn, error) {
+			for _, s := range scl.stubs {
+				if s.addr == addr {
+					return s.newConn(), nil
+				}
+			}
+			return nil, errors.Errorf("unknown addr: %q", addr)
+		}
+		return NewPool(network, addr, 1, PoolConnFunc(connFunc))
+	}))
+	defer c.Close()
+
+	stats := c.Stats()
+	assert.False(t, stats.LastSync.Before(start))
+	assert.Len(t, stats.Nodes, len(c.Topo()))
+	for _, node := range c.Topo() {
+		ns := stats.Nodes[node.Addr]
+		assert.Equal(t, node, ns.Node)
+		require.NotNil(t, ns.Pool, "addr:%q", node.Addr)
+		assert.Equal(t, 1, ns.Pool.OpenConns)
+	}
+
+	stub0, stub16k := scl.stubForSlot(0), scl.stubForSlot(16000)
+	require.NotEqual(t, stub0.addr, stub16k.addr)
+	k := clusterSlotKeys[0]
+	require.NoError(t, c.Do(Cmd(nil, "SET", k, "foo")))
+	require.NoError(t, c.doInner(Cmd(nil, "GET", k), stub16k.addr, k, false, doAttempts))
+	require.Error(t, c.Do(Cmd(nil, "UNKNOWN", k)))
+
+	stats = c.Stats()
+	assert.Equal(t, uint64(1), stats.Moved)
+	assert.Equal(t, uint64(0), stats.Asked)
+
+	// SET, GET after the redirect, and UNKNOWN
+	ns0 := stats.Nodes[stub0.addr]
+	assert.Equal(t, uint64(3), ns0.Actions)
+	assert.Equal(t, uint64(1), ns0.Errors)
+	assert.InDelta(t, 1.0/3, ns0.ErrorRate, 0.001)
+
+	ns16k := stats.Nodes[stub16k.addr]
+	assert.Equal(t, uint64(1), ns16k.Actions)
+	assert.Equal(t, uint64(1), ns16k.Moved)
+	assert.Equal(t, uint64(0), ns16k.Errors)
+	assert.Equal(t, 0.0, ns16k.ErrorRate)
+}
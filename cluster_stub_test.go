@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	. "testing"
 
 	errors "golang.org/x/xerrors"
@@ -54,6 +55,7 @@ func (sd *clusterDatasetStub) slotRanges() [][2]uint16 {
 type clusterNodeStub struct {
 	addr, id                       string
 	secondaryOfAddr, secondaryOfID string // set if secondary
+	config                         *sync.Map
 	*clusterDatasetStub
 	*clusterStub
 }
@@ -141,7 +143,7 @@ func (s *clusterNodeStub) newConn() Conn {
 		}
 
 		switch cmd {
-		case "GET":
+		case "GET", "GETEX":
 			k := args[1]
 			return s.withKey(k, asking, readonly, func(slot clusterSlotStub) interface{} {
 				s, ok := slot.kv[k]
@@ -206,6 +208,75 @@ func (s *clusterNodeStub) newConn() Conn {
 				return []interface{}{"1", keys}
 			}
 			return []interface{}{"0", []string{}}
+		case "CONFIG":
+			switch strings.ToUpper(args[1]) {
+			case "GET":
+				v, ok := s.config.Load(args[2])
+				if !ok {
+					return []string{}
+				}
+				return []string{args[2], v.(string)}
+			case "SET":
+				// secondaries reject the "fail" value, to test rollbacks
+				for i := 2; i < len(args); i += 2 {
+					if args[i+1] == "fail" && s.secondaryOfAddr != "" {
+						return resp2.Error{E: errors.New("ERR CONFIG SET failed")}
+					}
+				}
+				for i := 2; i < len(args); i += 2 {
+					s.config.Store(args[i], args[i+1])
+				}
+				return resp2.SimpleString{S: "OK"}
+			}
+		case "PUBSUB":
+			// every node pretends to have one subscriber to every channel,
+			// as well as to a channel named after itself
+			switch strings.ToUpper(args[1]) {
+			case "CHANNELS", "SHARDCHANNELS":
+				return []string{"all", s.addr}
+			case "NUMSUB", "SHARDNUMSUB":
+				var res []interface{}
+				for _, ch := range args[2:] {
+					res = append(res, ch, 1)
+				}
+				return res
+			}
+		case "COMMAND":
+			// the stub knows of two module commands: MOD.SET, which takes an
+			// option before its key, and MOD.KEYS, which takes a number of keys
+			// like EVAL.
+			switch strings.ToUpper(args[1]) {
+			case "INFO":
+				atomic.AddInt64(&s.clusterStub.commandInfoCalls, 1)
+				switch strings.ToUpper(args[2]) {
+				case "MOD.SET":
+					return []interface{}{[]interface{}{"mod.set", 4, []string{"write"}, 2, 2, 1}}
+				case "MOD.KEYS":
+					return []interface{}{[]interface{}{"mod.keys", -2, []string{"readonly", "movablekeys"}, 0, 0, 0}}
+				}
+				return []interface{}{nil}
+			case "GETKEYS":
+				if strings.ToUpper(args[2]) == "MOD.KEYS" {
+					n, _ := strconv.Atoi(args[3])
+					return args[4 : 4+n]
+				}
+			}
+		case "MOD.SET":
+			k := args[2]
+			return s.withKey(k, asking, readonly, func(slot clusterSlotStub) interface{} {
+				slot.kv[k] = args[3]
+				return resp2.SimpleString{S: "OK"}
+			})
+		case "MOD.KEYS":
+			n, _ := strconv.Atoi(args[1])
+			return s.withKeys(args[2:2+n], asking, readonly, func(slot clusterSlotStub) interface{} {
+				return s.addr
+			})
+		case "INFO":
+			if len(args) > 1 && strings.EqualFold(args[1], "modules") {
+				return "# Modules\r\n"
+			}
+			return "# Server\r\nredis_version:7.2.4\r\nredis_mode:cluster\r\n"
 		case "READONLY":
 			readonly = true
 			return resp2.SimpleString{S: "OK"}
@@ -226,6 +297,8 @@ func (s *clusterNodeStub) Close() error {
 ////////////////////////////////////////////////////////////////////////////////
 
 type clusterStub struct {
+	commandInfoCalls int64 // atomic, must be first for alignment
+
 	stubs map[string]*clusterNodeStub // addr -> stub
 }
 
@@ -258,6 +331,7 @@ func newStubCluster(tt ClusterTopo) *clusterStub {
 			id:                 t.ID,
 			secondaryOfAddr:    t.SecondaryOfAddr,
 			secondaryOfID:      t.SecondaryOfID,
+			config:             new(sync.Map),
 			clusterDatasetStub: sd,
 			clusterStub:        sc,
 		}
@@ -1,12 +1,17 @@
 package radix
 
 import (
+	"strings"
+	"sync"
+	"sync/atomic"
 	. "testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
 
+	"github.com/mediocregopher/radix/v3/resp"
 	"github.com/mediocregopher/radix/v3/trace"
 )
 
@@ -193,6 +198,87 @@ func TestClusterDoWhenDown(t *T) {
 	assert.False(t, isDown)
 }
 
+func TestClusterRedirectError(t *T) {
+	c, scl := newTestCluster()
+	defer c.Close()
+	stub0 := scl.stubForSlot(0)
+	stub16k := scl.stubForSlot(16000)
+	k := clusterSlotKeys[0]
+
+	assertRedirectErr := func(err error) {
+		var redirErr *ClusterRedirectError
+		require.True(t, errors.As(err, &redirErr))
+		assert.Equal(t, "MOVED", redirErr.Kind)
+		assert.Equal(t, uint16(0), redirErr.Slot)
+		assert.Equal(t, stub0.addr, redirErr.Addr)
+
+		var respErr resp.Error
+		require.True(t, errors.As(err, &respErr))
+		assert.Equal(t, "MOVED", respErr.Prefix())
+	}
+
+	// an Action which can't be retried should get the redirect error back
+	// as-is
+	{
+		a := WithConn(k, func(conn Conn) error {
+			return conn.Do(Cmd(nil, "GET", k))
+		})
+		err := c.doInner(a, stub16k.addr, k, false, doAttempts)
+		assertRedirectErr(err)
+		assert.Equal(t, "MOVED 0 "+stub0.addr, err.Error())
+	}
+
+	// an Action which runs out of attempts should as well
+	{
+		err := c.doInner(Cmd(nil, "GET", k), stub16k.addr, k, false, 1)
+		assertRedirectErr(err)
+	}
+}
+
+func TestClusterDoWrappedRedirect(t *T) {
+	c, scl := newTestCluster()
+	defer c.Close()
+	stub16k := scl.stubForSlot(16000)
+
+	k, v := clusterSlotKeys[0], randStr()
+	require.Nil(t, c.Do(Cmd(nil, "SET", k, v)))
+
+	wrappers := map[string]func(Action) Action{
+		"WithMetadata": func(a Action) Action {
+			return WithMetadata(a, Metadata{"tenant": "a"})
+		},
+		"RequireFeatures": func(a Action) Action {
+			return RequireFeatures(a, FeatureGetEx)
+		},
+		"WithPriority": func(a Action) Action {
+			return WithPriority(a, PriorityHigh)
+		},
+		"WithAffinityKey": func(a Action) Action {
+			return WithAffinityKey(a, "user")
+		},
+	}
+
+	for name, wrap := range wrappers {
+		t.Run(name, func(t *T) {
+			var vgot string
+			a := wrap(Cmd(&vgot, "GET", k))
+			require.Nil(t, c.doInner(a, stub16k.addr, k, false, doAttempts))
+			assert.Equal(t, v, vgot)
+		})
+	}
+
+	// the built-in helpers which require features must be redirected as well
+	t.Run("GetEx", func(t *T) {
+		var vgot string
+		a := GetEx(&vgot, k, GetExOpts{})
+		ccra, ok := a.(ClusterCanRetryAction)
+		require.True(t, ok)
+		assert.True(t, ccra.ClusterCanRetry())
+		require.Nil(t, c.doInner(a, stub16k.addr, k, false, doAttempts))
+		assert.Equal(t, v, vgot)
+	})
+}
+
 func BenchmarkClusterDo(b *B) {
 	c, _ := newTestCluster()
 	defer c.Close()
@@ -274,6 +360,300 @@ func TestClusterDoSecondary(t *T) {
 	assert.Equal(t, 2, redirects)
 }
 
+func TestClusterPreferZone(t *T) {
+	zoneFn := ClusterNodeZoneFunc(func(node ClusterNode) string {
+		if node.SecondaryOfAddr != "" {
+			return "secondaries"
+		}
+		return "primaries"
+	})
+
+	key := clusterSlotKeys[0]
+	for zone, expSecondary := range map[string]bool{
+		"primaries":   false,
+		"secondaries": true,
+		"other":       true,
+	} {
+		c, _ := newTestCluster(zoneFn, ClusterPreferZone(zone))
+		for _, node := range c.Topo() {
+			assert.Equal(t, node.SecondaryOfAddr != "", node.Zone == "secondaries")
+		}
+		assert.Equal(t, expSecondary, c.isSecondary(c.secondaryAddrForKey(key)), zone)
+		c.Close()
+	}
+}
+
+func TestClusterPoolFuncPerRole(t *T) {
+	scl := newStubCluster(testTopo)
+	var l sync.Mutex
+	roles := map[string]string{}
+	recordingFunc := func(role string) ClientFunc {
+		pf := scl.clientFunc()
+		return func(network, addr string) (Client, error) {
+			l.Lock()
+			roles[addr] = role
+			l.Unlock()
+			return pf(network, addr)
+		}
+	}
+
+	var hotAddr string
+	for _, node := range testTopo.Primaries() {
+		hotAddr = node.Addr
+		break
+	}
+
+	c := scl.newCluster(
+		ClusterPoolFunc(recordingFunc("primary")),
+		ClusterSecondaryPoolFunc(recordingFunc("secondary")),
+		ClusterAddrPoolFunc(hotAddr, recordingFunc("hot")),
+	)
+	defer c.Close()
+
+	assertRoles := func() {
+		l.Lock()
+		defer l.Unlock()
+		for _, node := range c.Topo() {
+			switch {
+			case node.Addr == hotAddr:
+				assert.Equal(t, "hot", roles[node.Addr], node.Addr)
+			case node.SecondaryOfAddr != "":
+				assert.Equal(t, "secondary", roles[node.Addr], node.Addr)
+			default:
+				assert.Equal(t, "primary", roles[node.Addr], node.Addr)
+			}
+		}
+	}
+	assertRoles()
+
+	// fail over a primary which isn't the hot one, its pool and its
+	// secondary's pool should both be recreated for their new roles
+	var prim, sec *clusterNodeStub
+	for _, s := range scl.stubs {
+		if s.secondaryOfAddr != "" && s.secondaryOfAddr != hotAddr {
+			prim, sec = scl.stubs[s.secondaryOfAddr], s
+			break
+		}
+	}
+	prim.secondaryOfAddr, prim.secondaryOfID = sec.addr, sec.id
+	sec.secondaryOfAddr, sec.secondaryOfID = "", ""
+
+	require.NoError(t, c.Sync())
+	assertRoles()
+	l.Lock()
+	assert.Equal(t, "secondary", roles[prim.addr])
+	assert.Equal(t, "primary", roles[sec.addr])
+	l.Unlock()
+}
+
+type closeRecordingClient struct {
+	Client
+	closed *int32
+}
+
+func (c closeRecordingClient) Close() error {
+	atomic.AddInt32(c.closed, 1)
+	return c.Client.Close()
+}
+
+func TestClusterSetTopoErr(t *T) {
+	scl := newStubCluster(testTopo)
+	pf := scl.clientFunc()
+	var closed int32
+	c := scl.newCluster(ClusterPoolFunc(func(network, addr string) (Client, error) {
+		switch addr {
+		case "new-ok":
+			return closeRecordingClient{Client: scl.randStub().newConn(), closed: &closed}, nil
+		case "new-err":
+			return nil, errors.New("can't connect")
+		}
+		return pf(network, addr)
+	}))
+	defer c.Close()
+
+	prevTopo := c.Topo()
+	prim := prevTopo.Primaries()[0]
+	tt := append(ClusterTopo{}, prevTopo...)
+	tt = append(tt,
+		ClusterNode{Addr: "new-ok", SecondaryOfAddr: prim.Addr, SecondaryOfID: prim.ID},
+		ClusterNode{Addr: "new-err", SecondaryOfAddr: prim.Addr, SecondaryOfID: prim.ID},
+	)
+
+	require.Error(t, c.setTopo(tt))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&closed))
+	assert.Equal(t, prevTopo, c.Topo())
+	c.l.RLock()
+	assert.Len(t, c.pools, len(prevTopo))
+	assert.NotContains(t, c.pools, "new-ok")
+	c.l.RUnlock()
+}
+
+func TestClusterRemapAddrs(t *T) {
+	const prefix = "external-"
+	scl := newStubCluster(testTopo)
+	pf := scl.clientFunc()
+	var addrs []string
+	for _, addr := range scl.addrs() {
+		addrs = append(addrs, prefix+addr)
+	}
+	c, err := NewCluster(addrs,
+		ClusterPoolFunc(func(network, addr string) (Client, error) {
+			if !strings.HasPrefix(addr, prefix) {
+				return nil, errors.Errorf("addr %q wasn't remapped", addr)
+			}
+			return pf(network, strings.TrimPrefix(addr, prefix))
+		}),
+		ClusterRemapAddrs(func(addr string) string {
+			return prefix + addr
+		}),
+	)
+	require.NoError(t, err)
+	defer c.Close()
+
+	for _, node := range c.Topo() {
+		assert.True(t, strings.HasPrefix(node.Addr, prefix), node.Addr)
+		if node.SecondaryOfAddr != "" {
+			assert.True(t, strings.HasPrefix(node.SecondaryOfAddr, prefix), node.SecondaryOfAddr)
+		}
+	}
+
+	key := clusterSlotKeys[0]
+	value := randStr()
+	require.NoError(t, c.Do(Cmd(nil, "SET", key, value)))
+
+	// moving the slot without syncing will cause a MOVED, whose address must
+	// also be remapped
+	var redirects int
+	c.co.ct.Redirected = func(trace.ClusterRedirected) { redirects++ }
+	dst := scl.stubForSlot(numSlots - 1)
+	scl.migrateSlotRange(dst.addr, 0, 1)
+
+	var res string
+	require.NoError(t, c.Do(Cmd(&res, "GET", key)))
+	assert.Equal(t, value, res)
+	assert.Equal(t, 1, redirects)
+}
+
+func TestClusterInitialTopo(t *T) {
+	scl := newStubCluster(testTopo)
+	for _, static := range []bool{false, true} {
+		opt := ClusterInitialTopo(scl.topo())
+		if static {
+			opt = ClusterStaticTopo(scl.topo())
+		}
+		c, err := NewCluster(nil, ClusterPoolFunc(scl.clientFunc()), opt)
+		require.NoError(t, err)
+
+		assert.Equal(t, scl.topo(), c.Topo())
+		key := clusterSlotKeys[0]
+		require.NoError(t, c.Do(Cmd(nil, "SET", key, "a")))
+
+		// after moving a slot the topology is only updated if it isn't static,
+		// but redirects are followed either way.
+		prevTopo, srcAddr := c.Topo(), c.addrForKey(key)
+		slot := ClusterSlot([]byte(key))
+		scl.migrateSlotRange(scl.stubForSlot(numSlots-1).addr, slot, slot+1)
+		require.NoError(t, c.Sync())
+		if static {
+			assert.Equal(t, prevTopo, c.Topo())
+		} else {
+			assert.Equal(t, scl.topo(), c.Topo())
+		}
+
+		var res string
+		require.NoError(t, c.Do(Cmd(&res, "GET", key)))
+		assert.Equal(t, "a", res)
+		scl.migrateSlotRange(srcAddr, slot, slot+1)
+		c.Close()
+	}
+
+	_, err := NewCluster(nil, ClusterStaticTopo(ClusterTopo{{Addr: "127.0.0.1:7000"}}))
+	assert.Error(t, err)
+}
+
+func TestClusterCommandGetKeys(t *T) {
+	var redirects int
+	c, scl := newTestCluster(
+		ClusterCommandGetKeys(),
+		ClusterWithTrace(trace.ClusterTrace{
+			Redirected: func(trace.ClusterRedirected) { redirects++ },
+		}),
+	)
+	defer c.Close()
+
+	// pick the option and key so that they're on different nodes, meaning
+	// routing by the first argument would be redirected.
+	opt, key := clusterSlotKeys[0], clusterSlotKeys[numSlots-1]
+	require.NotEqual(t, c.addrForKey(opt), c.addrForKey(key))
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, c.Do(Cmd(nil, "MOD.SET", opt, key, "bar")))
+	}
+	var val string
+	require.NoError(t, c.Do(Cmd(&val, "GET", key)))
+	assert.Equal(t, "bar", val)
+
+	var addr string
+	require.NoError(t, c.Do(Cmd(&addr, "MOD.KEYS", "2", "{"+key+"}a", "{"+key+"}b")))
+	assert.Equal(t, c.addrForKey(key), addr)
+
+	assert.Equal(t, 0, redirects)
+
+	// GET, MOD.SET and MOD.KEYS should each have been looked up once
+	assert.Equal(t, int64(3), atomic.LoadInt64(&scl.commandInfoCalls))
+
+	// without the option the first argument is used as the key
+	c2, _ := newTestCluster()
+	defer c2.Close()
+	keys, err := c2.actionKeys(Cmd(nil, "MOD.SET", opt, key, "bar"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{opt}, keys)
+}
+
+func TestClusterRoute(t *T) {
+	scl := newStubCluster(testTopo)
+	addrs := scl.addrs()
+	seed, other := addrs[0], addrs[len(addrs)-1]
+
+	var redirects int
+	c := scl.newCluster(
+		ClusterRouteCommands(seed, "addr"),
+		ClusterRouteKeyPrefix("pinned:", other),
+		ClusterRouteFunc(func(a Action, keys []string) string {
+			if len(keys) == 0 {
+				return other
+			}
+			return ""
+		}),
+		ClusterWithTrace(trace.ClusterTrace{
+			Redirected: func(trace.ClusterRedirected) { redirects++ },
+		}),
+	)
+	defer c.Close()
+
+	// ADDR has no keys, so it would also match the last override, but the
+	// first one takes precedence.
+	var addr string
+	require.NoError(t, c.Do(Cmd(&addr, "ADDR")))
+	assert.Equal(t, seed, addr)
+	require.NoError(t, c.Do(Pipeline(Cmd(&addr, "ADDR"), Cmd(nil, "PING"))))
+	assert.Equal(t, other, addr)
+
+	// pinning a key to a node which doesn't own it results in a redirect
+	var key string
+	for _, k := range clusterSlotKeys {
+		if key = "pinned:" + k; c.addrForKey(key) != other {
+			break
+		}
+	}
+	require.NotEqual(t, other, c.addrForKey(key))
+	require.NoError(t, c.Do(Cmd(nil, "SET", key, "foo")))
+	assert.Equal(t, 1, redirects)
+
+	require.NoError(t, c.Do(Cmd(nil, "SET", clusterSlotKeys[0], "foo")))
+	assert.Equal(t, 1, redirects)
+}
+
 var clusterAddrs []string
 
 func ExampleClusterPoolFunc_defaultClusterConnFunc() {
@@ -281,3 +661,66 @@ func ExampleClusterPoolFunc_defaultClusterConnFunc() {
 		return NewPool(network, addr, 4, PoolConnFunc(DefaultClusterConnFunc))
 	}))
 }
+
+func TestClusterCrossSlot(t *T) {
+	c, _ := newTestCluster()
+	defer c.Close()
+
+	err := c.Do(Cmd(nil, "MGET", "{a}1", "b", "{a}2"))
+	var csErr *CrossSlotError
+	require.True(t, errors.As(err, &csErr))
+	assert.Equal(t, []string{"{a}1", "b", "{a}2"}, csErr.Keys)
+	assert.Equal(t, []uint16{ClusterSlot([]byte("a")), ClusterSlot([]byte("b")), ClusterSlot([]byte("a"))}, csErr.Slots)
+	assert.Equal(t, `keys do not belong to the same slot: "{a}1" (slot 15495), "b" (slot 3300)`, err.Error())
+
+	// within a WithConn every Action is checked against the WithConn's key
+	err = c.Do(WithConn("{a}1", func(conn Conn) error {
+		if err := conn.Do(Cmd(nil, "SET", "{a}2", "foo")); err != nil {
+			return err
+		}
+		return conn.Do(Cmd(nil, "SET", "b", "foo"))
+	}))
+	require.True(t, errors.As(err, &csErr))
+	assert.Equal(t, []string{"{a}1", "b"}, csErr.Keys)
+
+	// as is a WithConn which has been wrapped
+	wrappers := map[string]func(Action) Action{
+		"WithPriority": func(a Action) Action {
+			return WithPriority(a, PriorityHigh)
+		},
+		"WithMetadata": func(a Action) Action {
+			return WithMetadata(a, Metadata{"tenant": "a"})
+		},
+		"WithAffinityKey": func(a Action) Action {
+			return WithAffinityKey(a, "user")
+		},
+	}
+	for name, wrap := range wrappers {
+		t.Run(name, func(t *T) {
+			err := c.Do(wrap(WithConn("{a}1", func(conn Conn) error {
+				return conn.Do(Cmd(nil, "SET", "b", "foo"))
+			})))
+			var csErr *CrossSlotError
+			require.True(t, errors.As(err, &csErr))
+			assert.Equal(t, []string{"{a}1", "b"}, csErr.Keys)
+		})
+	}
+}
+
+func TestSlotGuardConnDiscard(t *T) {
+	var cmds []string
+	stub := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		cmds = append(cmds, args[0])
+		return "OK"
+	})
+
+	// with no key given the slot is set by the first key used
+	conn := &slotGuardConn{Conn: stub}
+	require.NoError(t, conn.Do(Cmd(nil, "MULTI")))
+	require.NoError(t, conn.Do(Cmd(nil, "SET", "{a}2", "foo")))
+	err := conn.Do(Cmd(nil, "SET", "b", "foo"))
+	var csErr *CrossSlotError
+	require.True(t, errors.As(err, &csErr))
+	assert.Equal(t, []string{"{a}2", "b"}, csErr.Keys)
+	assert.Equal(t, []string{"MULTI", "SET", "DISCARD"}, cmds)
+}
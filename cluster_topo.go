@@ -2,6 +2,7 @@ package radix
 
 import (
 	"bufio"
+	"encoding/json"
 	"io"
 	"net"
 	"sort"
@@ -16,18 +17,65 @@ import (
 type ClusterNode struct {
 	// older versions of redis might not actually send back the id, so it may be
 	// blank
-	Addr, ID string
+	Addr string `json:"addr"`
+	ID   string `json:"id,omitempty"`
 	// start is inclusive, end is exclusive
-	Slots [][2]uint16
+	Slots [][2]uint16 `json:"slots"`
 	// address and id this node is the secondary of, if it's a secondary
-	SecondaryOfAddr, SecondaryOfID string
+	SecondaryOfAddr string `json:"secondaryOfAddr,omitempty"`
+	SecondaryOfID   string `json:"secondaryOfID,omitempty"`
+	// the hostname announced by the node, if any. Only redis 7.0 and above
+	// announce hostnames, and only if cluster-announce-hostname is set.
+	Hostname string `json:"hostname,omitempty"`
+	// the availability zone the node is in, if known. Zones aren't reported by
+	// redis, see ClusterNodeZoneFunc and ClusterPreferZone.
+	Zone string `json:"zone,omitempty"`
 }
 
 // ClusterTopo describes the cluster topology at a given moment. It will be
 // sorted first by slot number of each node and then by secondary status, so
 // primaries will come before secondaries.
+//
+// A ClusterTopo can be marshaled to and from JSON, e.g. to save the topology
+// returned by Cluster.Topo so that it can later be given to NewCluster using
+// ClusterInitialTopo or ClusterStaticTopo.
 type ClusterTopo []ClusterNode
 
+// UnmarshalJSON implements the json.Unmarshaler interface. The unmarshaled
+// nodes are checked to each have an address and valid slots, and are sorted
+// before they are returned.
+func (tt *ClusterTopo) UnmarshalJSON(b []byte) error {
+	var nodes []ClusterNode
+	if err := json.Unmarshal(b, &nodes); err != nil {
+		return err
+	}
+	newTT := ClusterTopo(nodes)
+	if err := newTT.validate(); err != nil {
+		return err
+	}
+	newTT.sort()
+	*tt = newTT
+	return nil
+}
+
+// validate returns an error if any node in the ClusterTopo is missing its
+// address, or has no slots or invalid slots.
+func (tt ClusterTopo) validate() error {
+	for _, node := range tt {
+		if node.Addr == "" {
+			return errors.New("cluster node has no address")
+		} else if len(node.Slots) == 0 {
+			return errors.Errorf("cluster node %q has no slots", node.Addr)
+		}
+		for _, slots := range node.Slots {
+			if slots[0] >= slots[1] || slots[1] > numSlots {
+				return errors.Errorf("cluster node %q has invalid slot range %v", node.Addr, slots)
+			}
+		}
+	}
+	return nil
+}
+
 // MarshalRESP implements the resp.Marshaler interface, and will marshal the
 // ClusterTopo in the same format as the return from CLUSTER SLOTS
 func (tt ClusterTopo) MarshalRESP(w io.Writer) error {
@@ -159,10 +207,13 @@ func (tss topoSlotSet) MarshalRESP(w io.Writer) error {
 
 	for _, n := range tss.nodes {
 		host, port, _ := net.SplitHostPort(n.Addr)
-		node := []string{host, port}
-		if n.ID != "" {
+		node := []interface{}{host, port}
+		if n.ID != "" || n.Hostname != "" {
 			node = append(node, n.ID)
 		}
+		if n.Hostname != "" {
+			node = append(node, []string{"hostname", n.Hostname})
+		}
 		marshal(resp2.Any{I: node})
 	}
 
@@ -187,22 +238,36 @@ func (tss *topoSlotSet) UnmarshalRESP(br *bufio.Reader) error {
 
 	var primaryNode ClusterNode
 	for i := 0; i < arrHead.N; i++ {
-		var nodeStrs []string
-		if err := (resp2.Any{I: &nodeStrs}).UnmarshalRESP(br); err != nil {
+		var nodeHead resp2.ArrayHeader
+		if err := nodeHead.UnmarshalRESP(br); err != nil {
 			return err
-		} else if len(nodeStrs) < 2 {
-			return errors.Errorf("malformed node array: %#v", nodeStrs)
 		}
-		ip, port := nodeStrs[0], nodeStrs[1]
-		var id string
-		if len(nodeStrs) > 2 {
-			id = nodeStrs[2]
+
+		// the node array is the ip, port, and id, followed (in redis 7.0 and
+		// above) by a map of metadata, and possibly more fields in the future
+		// which are discarded.
+		var nodeStrs [3]string
+		var metadata map[string]string
+		for j := 0; j < nodeHead.N; j++ {
+			var into interface{}
+			if j < len(nodeStrs) {
+				into = &nodeStrs[j]
+			} else if j == len(nodeStrs) {
+				into = &metadata
+			}
+			if err := (resp2.Any{I: into}).UnmarshalRESP(br); err != nil {
+				return err
+			}
+		}
+		if nodeHead.N < 2 {
+			return errors.Errorf("malformed node array: %#v", nodeStrs[:nodeHead.N])
 		}
 
 		node := ClusterNode{
-			Addr:  ip + ":" + port,
-			ID:    id,
-			Slots: [][2]uint16{tss.slots},
+			Addr:     nodeStrs[0] + ":" + nodeStrs[1],
+			ID:       nodeStrs[2],
+			Slots:    [][2]uint16{tss.slots},
+			Hostname: metadata["hostname"],
 		}
 
 		if i == 0 {
@@ -3,6 +3,7 @@ package radix
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	. "testing"
 
 	"github.com/mediocregopher/radix/v3/resp"
@@ -145,6 +146,33 @@ func TestClusterTopo(t *T) {
 	assert.Equal(t, testTopoExp, testTopo2)
 }
 
+func TestClusterTopoJSON(t *T) {
+	b, err := json.Marshal(testTopo)
+	require.NoError(t, err)
+
+	// reverse the nodes, to make sure they're sorted when unmarshaled
+	var nodes []ClusterNode
+	require.NoError(t, json.Unmarshal(b, &nodes))
+	for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	}
+	b, err = json.Marshal(nodes)
+	require.NoError(t, err)
+
+	var tt ClusterTopo
+	require.NoError(t, json.Unmarshal(b, &tt))
+	assert.Equal(t, testTopo, tt)
+
+	for _, invalid := range []string{
+		`[{"slots":[[0,16384]]}]`,
+		`[{"addr":"127.0.0.1:7000"}]`,
+		`[{"addr":"127.0.0.1:7000","slots":[[0,16385]]}]`,
+		`[{"addr":"127.0.0.1:7000","slots":[[5,5]]}]`,
+	} {
+		assert.Error(t, json.Unmarshal([]byte(invalid), &tt), invalid)
+	}
+}
+
 // Test parsing a topology where a node in the cluster has two different sets of
 // slots, as well as a secondary
 func TestClusterTopoSplitSlots(t *T) {
@@ -197,3 +225,43 @@ func TestClusterTopoSplitSlots(t *T) {
 	}
 
 }
+
+// Test parsing a topology from redis 7.0 and above, which includes a map of
+// metadata for each node, possibly including an announced hostname
+func TestClusterTopoHostnames(t *T) {
+	clusterSlotsResp := respArr(
+		respArr(0, 16383,
+			respArr("10.0.0.1", 7000, "3ff1ddc420cfceeb4c42dc4b1f8f85c3acf984fe",
+				respArr("hostname", "node-a.example.com"),
+			),
+			respArr("10.0.0.2", 7000, "073a013f8886b6cf4c1b018612102601534912e9",
+				respArr(), "some future field",
+			),
+		),
+	)
+	expTopo := ClusterTopo{
+		ClusterNode{
+			Slots: [][2]uint16{{0, 16384}},
+			Addr:  "10.0.0.1:7000", ID: "3ff1ddc420cfceeb4c42dc4b1f8f85c3acf984fe",
+			Hostname: "node-a.example.com",
+		},
+		ClusterNode{
+			Slots: [][2]uint16{{0, 16384}},
+			Addr:  "10.0.0.2:7000", ID: "073a013f8886b6cf4c1b018612102601534912e9",
+			SecondaryOfAddr: "10.0.0.1:7000",
+			SecondaryOfID:   "3ff1ddc420cfceeb4c42dc4b1f8f85c3acf984fe",
+		},
+	}
+
+	buf := new(bytes.Buffer)
+	require.Nil(t, clusterSlotsResp.MarshalRESP(buf))
+	var tt ClusterTopo
+	require.Nil(t, tt.UnmarshalRESP(bufio.NewReader(buf)))
+	assert.Equal(t, expTopo, tt)
+
+	buf.Reset()
+	require.Nil(t, expTopo.MarshalRESP(buf))
+	var tt2 ClusterTopo
+	require.Nil(t, tt2.UnmarshalRESP(bufio.NewReader(buf)))
+	assert.Equal(t, expTopo, tt2)
+}
@@ -0,0 +1,94 @@
+// Command radixbench generates load against a redis server using radix, and
+// reports the throughput and latency percentiles which were achieved. It can be
+// used to validate the performance of radix, and of different radix Client
+// configurations, on a particular set of infrastructure.
+//
+// Example:
+//
+//	radixbench -addr 127.0.0.1:6379 -mode pool -c 50 -n 1000000
+//
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+	"github.com/mediocregopher/radix/v3/loadgen"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:6379", "Address of the redis server, or of any node if using cluster mode")
+	mode := flag.String("mode", "pool", "Client to use: conn, pool, pipeline, mux, or cluster")
+	concurrency := flag.Int("c", 10, "Number of go-routines performing commands concurrently")
+	requests := flag.Int("n", 100000, "Total number of commands to perform, 0 for no limit")
+	duration := flag.Duration("d", 0, "Maximum amount of time to generate load for, 0 for no limit")
+	poolSize := flag.Int("pool-size", 10, "Number of connections used by the pool and cluster modes")
+	pipelineSize := flag.Int("p", 10, "Number of commands per pipeline in pipeline mode")
+	valSize := flag.Int("size", 16, "Size in bytes of the values which are SET")
+	flag.Parse()
+
+	if *requests <= 0 && *duration <= 0 {
+		log.Fatal("at least one of -n or -d must be set")
+	}
+
+	client, err := newClient(*mode, *addr, *poolSize)
+	if err != nil {
+		log.Fatalf("creating %s client: %v", *mode, err)
+	}
+	defer client.Close()
+
+	opts := []loadgen.Opt{
+		loadgen.Concurrency(*concurrency),
+		loadgen.Requests(*requests),
+		loadgen.Duration(*duration),
+		loadgen.Cmd(loadgen.SetCmdFunc(*valSize)),
+	}
+	if *mode == "pipeline" {
+		opts = append(opts, loadgen.PipelineSize(*pipelineSize))
+	} else if *mode == "conn" {
+		// a single Conn can't be used concurrently
+		opts = append(opts, loadgen.Concurrency(1))
+	}
+
+	res := loadgen.Run(client, opts...)
+	printResult(os.Stdout, *mode, res)
+	if res.Err != nil {
+		log.Printf("%d commands failed, first error: %v", res.Errors, res.Err)
+		os.Exit(1)
+	}
+}
+
+func newClient(mode, addr string, poolSize int) (radix.Client, error) {
+	switch mode {
+	case "conn":
+		return radix.Dial("tcp", addr)
+	case "pool", "pipeline":
+		return radix.NewPool("tcp", addr, poolSize)
+	case "mux":
+		return radix.NewMuxClient("tcp", addr)
+	case "cluster":
+		return radix.NewCluster([]string{addr}, radix.ClusterPoolFunc(
+			func(network, addr string) (radix.Client, error) {
+				return radix.NewPool(network, addr, poolSize)
+			},
+		))
+	default:
+		return nil, fmt.Errorf("unknown mode %q", mode)
+	}
+}
+
+func printResult(w io.Writer, mode string, res loadgen.Result) {
+	fmt.Fprintf(w, "mode:       %s\n", mode)
+	fmt.Fprintf(w, "commands:   %d\n", res.Commands)
+	fmt.Fprintf(w, "errors:     %d\n", res.Errors)
+	fmt.Fprintf(w, "elapsed:    %v\n", res.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "throughput: %.0f cmds/sec\n", res.Throughput())
+	for _, p := range []float64{50, 90, 99, 99.9, 100} {
+		fmt.Fprintf(w, "%-11s %v\n", fmt.Sprintf("p%v:", p), res.Percentile(p))
+	}
+}
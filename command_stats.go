@@ -0,0 +1,217 @@
+package radix
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBucketBounds are the upper bounds of the buckets of a
+// latencyHistogram. Each bound is 25% larger than the previous, from 10µs up to
+// at least one minute, so that percentiles can be estimated to within 25% for
+// any latency. Latencies greater than the last bound are counted in an
+// additional, unbounded, bucket.
+var latencyBucketBounds = func() []time.Duration {
+	var bounds []time.Duration
+	for b := float64(10 * time.Microsecond); ; b *= 1.25 {
+		bounds = append(bounds, time.Duration(b))
+		if time.Duration(b) >= time.Minute {
+			return bounds
+		}
+	}
+}()
+
+// latencyHistogram counts latencies into buckets. All fields are updated
+// atomically, so that recording never blocks.
+type latencyHistogram struct {
+	// Atomic fields must be at the beginning of the struct since they must be
+	// correctly aligned or else access may cause panics on 32-bit architectures
+	// See https://golang.org/pkg/sync/atomic/#pkg-note-BUG
+	count, errors uint64
+	sum, max      int64 // time.Duration
+	buckets       []uint64
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{buckets: make([]uint64, len(latencyBucketBounds)+1)}
+}
+
+func (h *latencyHistogram) record(d time.Duration, err error) {
+	atomic.AddUint64(&h.count, 1)
+	if err != nil {
+		atomic.AddUint64(&h.errors, 1)
+	}
+	atomic.AddInt64(&h.sum, int64(d))
+	for {
+		max := atomic.LoadInt64(&h.max)
+		if int64(d) <= max || atomic.CompareAndSwapInt64(&h.max, max, int64(d)) {
+			break
+		}
+	}
+	i := sort.Search(len(latencyBucketBounds), func(i int) bool {
+		return d <= latencyBucketBounds[i]
+	})
+	atomic.AddUint64(&h.buckets[i], 1)
+}
+
+// LatencyBucket is a bucket of a latency histogram.
+type LatencyBucket struct {
+	// UpperBound is the largest latency counted in the bucket. The final
+	// bucket of a histogram has an UpperBound of math.MaxInt64.
+	UpperBound time.Duration
+
+	// Count is the number of latencies counted in the bucket, i.e. which were
+	// greater than the UpperBound of the previous bucket.
+	Count uint64
+}
+
+// CommandStats describes the commands of a single name performed through a
+// StatsClient.
+type CommandStats struct {
+	// Count is the number of times the command was performed, and Errors the
+	// number of those which returned an error (including errors returned by
+	// redis, e.g. WRONGTYPE).
+	Count, Errors uint64
+
+	// Mean and Max are the mean and maximum latency of the command.
+	Mean, Max time.Duration
+
+	// Buckets is a histogram of the latencies of the command, with buckets
+	// whose upper bounds increase exponentially. This can be used to export
+	// the histogram to a metrics system. Buckets are the same for all
+	// commands, and empty buckets are included.
+	Buckets []LatencyBucket
+}
+
+func (h *latencyHistogram) snapshot() CommandStats {
+	cs := CommandStats{
+		Count:   atomic.LoadUint64(&h.count),
+		Errors:  atomic.LoadUint64(&h.errors),
+		Max:     time.Duration(atomic.LoadInt64(&h.max)),
+		Buckets: make([]LatencyBucket, len(h.buckets)),
+	}
+	if cs.Count > 0 {
+		cs.Mean = time.Duration(atomic.LoadInt64(&h.sum) / int64(cs.Count))
+	}
+	for i := range h.buckets {
+		cs.Buckets[i].Count = atomic.LoadUint64(&h.buckets[i])
+		if i < len(latencyBucketBounds) {
+			cs.Buckets[i].UpperBound = latencyBucketBounds[i]
+		} else {
+			cs.Buckets[i].UpperBound = math.MaxInt64
+		}
+	}
+	return cs
+}
+
+// Percentile returns an estimate of the given percentile (e.g. 99 for p99) of
+// the command's latency, interpolated from its histogram. Estimates are within
+// 25% of the actual value, and never more than Max. Returns 0 if the command
+// hasn't been performed.
+func (cs CommandStats) Percentile(p float64) time.Duration {
+	var total uint64
+	for _, b := range cs.Buckets {
+		total += b.Count
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := p / 100 * float64(total)
+	var cum uint64
+	var lower time.Duration
+	for _, b := range cs.Buckets {
+		if b.Count > 0 && float64(cum+b.Count) >= rank {
+			upper := b.UpperBound
+			if upper > cs.Max {
+				upper = cs.Max
+			}
+			frac := (rank - float64(cum)) / float64(b.Count)
+			d := lower + time.Duration(frac*float64(upper-lower))
+			if d < lower {
+				d = lower
+			}
+			return d
+		}
+		cum += b.Count
+		lower = b.UpperBound
+	}
+	return cs.Max
+}
+
+// StatsClient wraps a Client, recording the latency of every Action performed
+// through it, by the name of the command it performs. Latencies are recorded
+// into histograms, so the memory used doesn't grow with the number of Actions
+// performed, and recording doesn't block other Actions.
+//
+// Actions which perform multiple commands (e.g. Pipeline) are recorded under
+// "PIPELINE", and those whose commands aren't known ahead of time (e.g.
+// WithConn) are recorded under "".
+type StatsClient struct {
+	Client
+
+	l     sync.RWMutex
+	stats map[string]*latencyHistogram
+}
+
+// NewStatsClient returns a StatsClient which wraps the given Client. Closing
+// the StatsClient closes the Client.
+func NewStatsClient(c Client) *StatsClient {
+	return &StatsClient{Client: c, stats: map[string]*latencyHistogram{}}
+}
+
+// Do implements the method for the Client interface, performing the Action on
+// the wrapped Client and recording its latency.
+func (sc *StatsClient) Do(a Action) error {
+	var name string
+	switch cmds := ActionProperties(a).Commands; len(cmds) {
+	case 0:
+	case 1:
+		name = cmds[0]
+	default:
+		name = "PIPELINE"
+	}
+
+	start := time.Now()
+	err := sc.Client.Do(a)
+	sc.histogram(name).record(time.Since(start), err)
+	return err
+}
+
+func (sc *StatsClient) histogram(name string) *latencyHistogram {
+	sc.l.RLock()
+	h := sc.stats[name]
+	sc.l.RUnlock()
+	if h != nil {
+		return h
+	}
+
+	sc.l.Lock()
+	defer sc.l.Unlock()
+	if h = sc.stats[name]; h == nil {
+		h = newLatencyHistogram()
+		sc.stats[name] = h
+	}
+	return h
+}
+
+// Stats returns a snapshot of the CommandStats of every command which has been
+// performed, keyed by command name.
+func (sc *StatsClient) Stats() map[string]CommandStats {
+	sc.l.RLock()
+	defer sc.l.RUnlock()
+	m := make(map[string]CommandStats, len(sc.stats))
+	for name, h := range sc.stats {
+		m[name] = h.snapshot()
+	}
+	return m
+}
+
+// Reset discards all recorded stats.
+func (sc *StatsClient) Reset() {
+	sc.l.Lock()
+	defer sc.l.Unlock()
+	sc.stats = map[string]*latencyHistogram{}
+}
@@ -0,0 +1,62 @@
+package radix
+
+import (
+	"math"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+)
+
+func TestLatencyHistogram(t *T) {
+	h := newLatencyHistogram()
+	for i := 1; i <= 100; i++ {
+		h.record(time.Duration(i)*time.Millisecond, nil)
+	}
+	h.record(2*time.Minute, errors.New("slow"))
+
+	cs := h.snapshot()
+	assert.Equal(t, uint64(101), cs.Count)
+	assert.Equal(t, uint64(1), cs.Errors)
+	assert.Equal(t, 2*time.Minute, cs.Max)
+	assert.Equal(t, time.Duration(math.MaxInt64), cs.Buckets[len(cs.Buckets)-1].UpperBound)
+	assert.Equal(t, uint64(1), cs.Buckets[len(cs.Buckets)-1].Count)
+
+	for _, p := range []float64{10, 50, 90} {
+		expected := float64(time.Duration(p) * time.Millisecond)
+		assert.InEpsilon(t, expected, float64(cs.Percentile(p)), 0.25, "p%v", p)
+	}
+	assert.Equal(t, 2*time.Minute, cs.Percentile(100))
+	assert.Zero(t, CommandStats{}.Percentile(50))
+}
+
+func TestStatsClient(t *T) {
+	sc := NewStatsClient(Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		if args[0] == "INCR" {
+			return errors.New("ERR not an integer")
+		}
+		time.Sleep(time.Millisecond)
+		return "OK"
+	}))
+	defer sc.Close()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sc.Do(Cmd(nil, "SET", "foo", "bar")))
+	}
+	require.Error(t, sc.Do(Cmd(nil, "INCR", "foo")))
+	require.NoError(t, sc.Do(Pipeline(Cmd(nil, "SET", "a", "1"), Cmd(nil, "GET", "a"))))
+
+	stats := sc.Stats()
+	assert.Len(t, stats, 3)
+	assert.Equal(t, uint64(3), stats["SET"].Count)
+	assert.Zero(t, stats["SET"].Errors)
+	assert.True(t, stats["SET"].Mean >= time.Millisecond)
+	assert.True(t, stats["SET"].Percentile(50) >= time.Millisecond)
+	assert.Equal(t, uint64(1), stats["INCR"].Errors)
+	assert.Equal(t, uint64(1), stats["PIPELINE"].Count)
+
+	sc.Reset()
+	assert.Empty(t, sc.Stats())
+}
@@ -0,0 +1,87 @@
+package radix
+
+import (
+	"sort"
+
+	errors "golang.org/x/xerrors"
+)
+
+// ConfigGet returns an Action which performs CONFIG GET with the given
+// glob-style pattern (e.g. "maxmemory*"), unmarshaling the matching parameters
+// and their values into rcv.
+func ConfigGet(rcv *map[string]string, pattern string) CmdAction {
+	return Cmd(rcv, "CONFIG", "GET", pattern)
+}
+
+// ConfigSet returns an Action which performs CONFIG SET with the given
+// parameters and their values. Parameters are given to redis in sorted order.
+//
+// NOTE that setting more than one parameter in a single CONFIG SET requires
+// redis 7 or later. In redis 7 and later the parameters are set atomically: if
+// any of them can't be set then none of them are.
+func ConfigSet(params map[string]string) CmdAction {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	args := make([]string, 1, 1+len(params)*2)
+	args[0] = "SET"
+	for _, k := range keys {
+		args = append(args, k, params[k])
+	}
+	return Cmd(nil, "CONFIG", args...)
+}
+
+// ClusterConfigSet performs CONFIG SET with the given parameters on every node
+// in the Cluster, primaries and secondaries alike.
+//
+// Prior to setting the parameters on a node their current values are
+// retrieved. If setting the parameters fails on any node then the previous
+// values are restored on all nodes which they were already set on, and an error
+// describing the failure is returned. An error during this rollback is also
+// included in the returned error.
+func ClusterConfigSet(c *Cluster, params map[string]string) error {
+	type applied struct {
+		addr string
+		prev map[string]string
+	}
+	var done []applied
+
+	rollback := func(err error) error {
+		for i := len(done) - 1; i >= 0; i-- {
+			client, cerr := c.Client(done[i].addr)
+			if cerr == nil {
+				cerr = client.Do(ConfigSet(done[i].prev))
+			}
+			if cerr != nil {
+				return errors.Errorf("rolling back CONFIG SET on %q failed with %v, after: %w", done[i].addr, cerr, err)
+			}
+		}
+		return err
+	}
+
+	for _, node := range c.Topo() {
+		client, err := c.Client(node.Addr)
+		if err != nil {
+			return rollback(errors.Errorf("getting client for %q: %w", node.Addr, err))
+		}
+
+		prev := make(map[string]string, len(params))
+		for k := range params {
+			var m map[string]string
+			if err := client.Do(ConfigGet(&m, k)); err != nil {
+				return rollback(errors.Errorf("performing CONFIG GET on %q: %w", node.Addr, err))
+			} else if v, ok := m[k]; ok {
+				prev[k] = v
+			}
+		}
+
+		if err := client.Do(ConfigSet(params)); err != nil {
+			return rollback(errors.Errorf("performing CONFIG SET on %q: %w", node.Addr, err))
+		}
+		done = append(done, applied{addr: node.Addr, prev: prev})
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package radix
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigGetSet(t *T) {
+	var got []string
+	conn := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		got = args
+		if args[1] == "GET" {
+			return []string{"maxmemory", "10", "maxmemory-policy", "noeviction"}
+		}
+		return "OK"
+	})
+
+	var m map[string]string
+	require.NoError(t, conn.Do(ConfigGet(&m, "maxmemory*")))
+	assert.Equal(t, []string{"CONFIG", "GET", "maxmemory*"}, got)
+	assert.Equal(t, map[string]string{"maxmemory": "10", "maxmemory-policy": "noeviction"}, m)
+
+	require.NoError(t, conn.Do(ConfigSet(map[string]string{"b": "2", "a": "1"})))
+	assert.Equal(t, []string{"CONFIG", "SET", "a", "1", "b", "2"}, got)
+}
+
+func TestClusterConfigSet(t *T) {
+	scl := newStubCluster(testTopo)
+	c := scl.newCluster()
+	defer c.Close()
+
+	assertConfig := func(k, v string) {
+		for _, node := range c.Topo() {
+			client, err := c.Client(node.Addr)
+			require.NoError(t, err)
+			var m map[string]string
+			require.NoError(t, client.Do(ConfigGet(&m, k)))
+			assert.Equal(t, v, m[k], "node %q", node.Addr)
+		}
+	}
+
+	require.NoError(t, ClusterConfigSet(c, map[string]string{"maxmemory": "10"}))
+	assertConfig("maxmemory", "10")
+
+	// the secondaries will fail to set the value, all nodes which it was set
+	// on should be rolled back
+	err := ClusterConfigSet(c, map[string]string{"maxmemory": "fail"})
+	assert.Error(t, err)
+	assertConfig("maxmemory", "10")
+}
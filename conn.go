@@ -7,9 +7,14 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/internal/bytesutil"
 	"github.com/mediocregopher/radix/v3/resp"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
 )
 
 // Conn is a Client wrapping a single network connection which synchronously
@@ -30,7 +35,9 @@ type Conn interface {
 	// Encode and Decode should _not_ be called at the same time as Do.
 	//
 	// If either Encode or Decode encounter a net.Error the Conn will be
-	// automatically closed.
+	// automatically closed. Such errors are returned as the *net.OpError
+	// given by the network connection, and can also be matched against
+	// ErrTimeout and ErrConnClosed using errors.Is.
 	//
 	// Encode is expected to encode an entire resp message, not a partial one.
 	// In other words, when sending commands to redis, Encode should only be
@@ -66,15 +73,41 @@ func wrapDefaultConnFunc(addr string) ConnFunc {
 type connWrap struct {
 	net.Conn
 	brw *bufio.ReadWriter
+
+	// inline is set by DialInlineCommands.
+	inline bool
+
+	// lenient is set by DialLenientDecoding.
+	lenient *lenientDecoder
 }
 
 // NewConn takes an existing net.Conn and wraps it to support the Conn interface
 // of this package. The Read and Write methods on the original net.Conn should
 // not be used after calling this method.
 func NewConn(conn net.Conn) Conn {
+	return newConnWithBufferSizes(conn, 0, 0)
+}
+
+// newConnWithBufferSizes is like NewConn, but uses the given sizes for the
+// read and write buffers. A size of zero indicates the bufio default.
+func newConnWithBufferSizes(conn net.Conn, readSize, writeSize int) Conn {
+	var br *bufio.Reader
+	if readSize > 0 {
+		br = bufio.NewReaderSize(conn, readSize)
+	} else {
+		br = bufio.NewReader(conn)
+	}
+
+	var bw *bufio.Writer
+	if writeSize > 0 {
+		bw = bufio.NewWriterSize(conn, writeSize)
+	} else {
+		bw = bufio.NewWriter(conn)
+	}
+
 	return &connWrap{
 		Conn: conn,
-		brw:  bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)),
+		brw:  bufio.NewReadWriter(br, bw),
 	}
 }
 
@@ -82,15 +115,72 @@ func (cw *connWrap) Do(a Action) error {
 	return a.Run(cw)
 }
 
+// buffersMarshaler is implemented by resp.Marshalers which can sometimes be
+// marshaled into a net.Buffers, allowing large []byte values to be written
+// directly to the connection (using writev where possible) instead of being
+// copied into the connection's write buffer. scratch may be used to hold all
+// data besides those large values. If false is returned then MarshalRESP
+// should be used instead.
+type buffersMarshaler interface {
+	resp.Marshaler
+	marshalBuffers(scratch *[]byte) (net.Buffers, bool)
+}
+
 func (cw *connWrap) Encode(m resp.Marshaler) error {
+	if tc, ok := cw.Conn.(*timeoutConn); ok {
+		tc.startBlocking(m)
+	}
+
+	if cw.inline {
+		if err := writeInline(cw.brw, m); err != nil {
+			return wrapNetErr(err)
+		}
+		return wrapNetErr(cw.brw.Flush())
+	}
+
+	if bm, ok := m.(buffersMarshaler); ok {
+		scratch := bytesutil.GetBytes()
+		defer bytesutil.PutBytes(scratch)
+		if bufs, ok := bm.marshalBuffers(scratch); ok {
+			return wrapNetErr(cw.writeBuffers(bufs))
+		}
+	}
+
 	if err := m.MarshalRESP(cw.brw); err != nil {
+		return wrapNetErr(err)
+	}
+	return wrapNetErr(cw.brw.Flush())
+}
+
+func (cw *connWrap) writeBuffers(bufs net.Buffers) error {
+	if err := cw.brw.Flush(); err != nil {
+		return err
+	}
+
+	// net.Buffers only uses writev when writing directly to one of the net
+	// package's own connection types, so timeoutConn needs to be unwrapped.
+	if tc, ok := cw.Conn.(*timeoutConn); ok {
+		if tc.writeTimeout > 0 {
+			tc.Conn.SetWriteDeadline(time.Now().Add(tc.writeTimeout))
+		}
+		_, err := bufs.WriteTo(tc.Conn)
 		return err
 	}
-	return cw.brw.Flush()
+	_, err := bufs.WriteTo(cw.Conn)
+	return err
 }
 
 func (cw *connWrap) Decode(u resp.Unmarshaler) error {
-	return u.UnmarshalRESP(cw.brw.Reader)
+	var err error
+	if cw.lenient != nil {
+		err = cw.lenient.decode(cw.brw.Reader, u)
+	} else {
+		err = decodeAttributed(cw.brw.Reader, u)
+	}
+	if tc, ok := cw.Conn.(*timeoutConn); ok {
+		tc.endBlocking()
+	}
+	return wrapNetErr(err)
 }
 
 func (cw *connWrap) NetConn() net.Conn {
@@ -99,10 +189,24 @@ func (cw *connWrap) NetConn() net.Conn {
 
 type dialOpts struct {
 	connectTimeout, readTimeout, writeTimeout time.Duration
+	blockingReadTimeout                       time.Duration
+	readBufSize, writeBufSize                 int
 	authUser, authPass                        string
 	selectDB                                  string
+	clientName                                string
+	libName, libVer                           string
+	noEvict, noTouch                          bool
 	useTLSConfig                              bool
 	tlsConfig                                 *tls.Config
+	keepAlive                                 KeepAliveConfig
+	addrAttemptTimeout, addrRaceDelay         time.Duration
+	initActions                               []Action
+	initErrFn                                 func(Action, error) error
+	inline                                    bool
+	lenientFn                                 func(UnsupportedFrame)
+	lenient                                   bool
+	credsFn                                   CredentialsFunc
+	credsRefreshBefore                        time.Duration
 }
 
 // DialOpt is an optional behavior which can be applied to the Dial function to
@@ -125,6 +229,45 @@ func DialReadTimeout(d time.Duration) DialOpt {
 	}
 }
 
+// DialBlockingReadTimeout determines the deadline to set when reading the
+// response to a blocking command, e.g. BLPOP or XREAD with the BLOCK option.
+// The deadline is extended by the timeout given in the command's arguments, so
+// that the command won't time out on the client before it does on the server.
+// Blocking commands which block indefinitely have no deadline set.
+//
+// When a Pipeline contains blocking commands the deadline is used for reading
+// all of its responses, and is extended by the longest of their timeouts.
+//
+// If not set then the value given to DialReadTimeout is used.
+func DialBlockingReadTimeout(d time.Duration) DialOpt {
+	return func(do *dialOpts) {
+		do.blockingReadTimeout = d
+	}
+}
+
+// DialReadBufferSize sets the size of the buffer used when reading from a
+// dialed connection. Larger buffers reduce the number of system calls needed
+// to read large responses, at the expense of memory used by every connection.
+//
+// If not set then the default size of the bufio package is used.
+func DialReadBufferSize(size int) DialOpt {
+	return func(do *dialOpts) {
+		do.readBufSize = size
+	}
+}
+
+// DialWriteBufferSize sets the size of the buffer used when writing to a
+// dialed connection. Larger buffers reduce the number of system calls needed
+// to write large commands or pipelines, at the expense of memory used by every
+// connection.
+//
+// If not set then the default size of the bufio package is used.
+func DialWriteBufferSize(size int) DialOpt {
+	return func(do *dialOpts) {
+		do.writeBufSize = size
+	}
+}
+
 // DialWriteTimeout determines the deadline to set when writing to a dialed
 // connection. If not set then SetWriteDeadline is never called.
 func DialWriteTimeout(d time.Duration) DialOpt {
@@ -143,6 +286,45 @@ func DialTimeout(d time.Duration) DialOpt {
 	}
 }
 
+// KeepAliveConfig describes the TCP keepalive behavior of a connection, see
+// DialKeepAlive.
+type KeepAliveConfig struct {
+	// Enable enables TCP keepalive. If false then the other fields are
+	// ignored.
+	Enable bool
+
+	// Idle is how long the connection must be idle before the first keepalive
+	// probe is sent. Zero uses the Go runtime's default of 15 seconds.
+	Idle time.Duration
+
+	// Interval is the time between keepalive probes. Zero uses the Go runtime's
+	// default of 15 seconds.
+	//
+	// Interval is only supported when built with go 1.23 or later, prior to
+	// that Idle is used as the interval as well.
+	Interval time.Duration
+
+	// Count is the number of unacknowledged probes after which the connection
+	// is considered dead. Zero uses the Go runtime's default of 9.
+	//
+	// Count is only supported when built with go 1.23 or later, prior to that
+	// the operating system's default is used.
+	Count int
+}
+
+// DialKeepAlive configures TCP keepalive on the connection, which is used to
+// detect, and keep alive, connections which sit idle for long periods of time.
+// Idle connections are commonly dropped silently by NATs and load balancers,
+// which without keepalive wouldn't be noticed until the connection is next
+// used.
+//
+// Keepalive is applied to TLS connections as well.
+func DialKeepAlive(cfg KeepAliveConfig) DialOpt {
+	return func(do *dialOpts) {
+		do.keepAlive = cfg
+	}
+}
+
 const defaultAuthUser = "default"
 
 // DialAuthPass will cause Dial to perform an AUTH command once the connection
@@ -169,6 +351,66 @@ func DialAuthUser(user, pass string) DialOpt {
 	}
 }
 
+// DialCredentials will cause Dial to call fn for the user and pass to perform
+// an AUTH command with once the connection is created, in place of those given
+// to DialAuthUser or by a redis URI. This is useful for credentials which are
+// short-lived tokens, such as those used by IAM authentication on AWS
+// ElastiCache, or Azure AD authentication on Azure Cache for Redis, which must
+// be fetched fresh when needed.
+//
+// If the Credentials returned by fn have an Expiry then the connection is
+// re-authenticated, using the Credentials returned by a new call to fn, once
+// it's within refreshBefore of the Expiry. This happens just before the next
+// command is written to the connection, so that long-lived connections remain
+// authenticated. If re-authentication fails then the connection is closed,
+// and so will be replaced by a Pool.
+//
+// Connections which are subscribed to pubsub channels can't perform AUTH, and
+// so aren't re-authenticated.
+func DialCredentials(fn CredentialsFunc, refreshBefore time.Duration) DialOpt {
+	return func(do *dialOpts) {
+		do.credsFn = fn
+		do.credsRefreshBefore = refreshBefore
+	}
+}
+
+// DialInlineCommands will cause the Conn to write commands using the inline
+// command protocol, i.e. as a single line of space separated arguments, rather
+// than as RESP arrays. This is only useful for talking to servers or devices
+// which implement a redis-like protocol but don't understand RESP requests;
+// replies are still expected to be RESP.
+//
+// Arguments are quoted and escaped where necessary, as redis expects, so they
+// may contain any bytes. Inline commands are limited in length by redis (64KB
+// by default), and large arguments can't be written directly to the connection
+// as they are with RESP, so this should not be used with redis itself.
+func DialInlineCommands() DialOpt {
+	return func(do *dialOpts) {
+		do.inline = true
+	}
+}
+
+// DialLenientDecoding will cause the Conn to tolerate replies containing RESP
+// types which radix doesn't support, such as those introduced by RESP3, rather
+// than failing to decode them. This is useful when talking to modules or
+// redis-compatible servers which send such types even to RESP2 clients.
+//
+// Frames of unsupported types are degraded into bulk strings containing their
+// raw bytes, e.g. a RESP3 null will be decoded as the string "_\r\n". RESP3
+// attributes, and push frames which aren't nested in a reply, are dropped
+// entirely, although attributes preceding a reply are still given to its
+// receiver as described by resp.AttributesReceiver. In either case fn, if not
+// nil, is called with the frame so that it may be logged.
+//
+// Every reply is buffered in full before being decoded, so this option has a
+// cost for large replies.
+func DialLenientDecoding(fn func(UnsupportedFrame)) DialOpt {
+	return func(do *dialOpts) {
+		do.lenient = true
+		do.lenientFn = fn
+	}
+}
+
 // DialSelectDB will cause Dial to perform a SELECT command once the connection
 // is created, using the given database index.
 //
@@ -180,6 +422,93 @@ func DialSelectDB(db int) DialOpt {
 	}
 }
 
+// DialClientName will cause Dial to perform a CLIENT SETNAME command once the
+// connection is created, using the given name. This allows the connection to be
+// identified in the output of CLIENT LIST on the server.
+//
+// Note that redis does not allow spaces in connection names.
+func DialClientName(name string) DialOpt {
+	return func(do *dialOpts) {
+		do.clientName = name
+	}
+}
+
+// DialLibInfo will cause Dial to perform a CLIENT SETINFO command once the
+// connection is created, setting the LIB-NAME and LIB-VER attributes of the
+// connection to the given values. Either value may be empty, in which case it
+// won't be set.
+//
+// CLIENT SETINFO was added in redis 7.2. Any error returned by redis for the
+// command is ignored, so this option is safe to use with older versions.
+func DialLibInfo(name, ver string) DialOpt {
+	return func(do *dialOpts) {
+		do.libName = name
+		do.libVer = ver
+	}
+}
+
+// DialNoEvict will cause Dial to perform a CLIENT NO-EVICT ON command once the
+// connection is created, so that the connection is excluded from client
+// eviction when redis is under memory pressure (see the maxmemory-clients
+// configuration). This is useful for connections used for monitoring or
+// administration, which should keep working in that case.
+//
+// CLIENT NO-EVICT was added in redis 7.0. Any error returned by redis for the
+// command is ignored, so this option is safe to use with older versions.
+func DialNoEvict() DialOpt {
+	return func(do *dialOpts) {
+		do.noEvict = true
+	}
+}
+
+// DialNoTouch will cause Dial to perform a CLIENT NO-TOUCH ON command once the
+// connection is created, so that commands performed on the connection don't
+// alter the LRU/LFU stats of the keys they access. This is useful for
+// connections used for monitoring or cache-warming, which would otherwise skew
+// which keys get evicted.
+//
+// CLIENT NO-TOUCH was added in redis 7.2. Any error returned by redis for the
+// command is ignored, so this option is safe to use with older versions.
+func DialNoTouch() DialOpt {
+	return func(do *dialOpts) {
+		do.noTouch = true
+	}
+}
+
+// DialInitActions will cause Dial to perform the given Actions, in order, once
+// the connection is created. This can be used for any setup which isn't
+// covered by the other DialOpts, e.g. CLIENT TRACKING or module configuration.
+// The Actions are performed after those of all other DialOpts (AUTH, SELECT,
+// etc...).
+//
+// Since the same Actions are performed on every connection created with the
+// DialOpt, they should not have receivers, or at least should be safe to
+// perform concurrently.
+//
+// DialInitActions may be given multiple times, with each call's Actions being
+// performed after the previous call's. If any of the Actions returns an error
+// then the connection is closed and Dial returns the error, unless
+// DialInitErrHandler is also used.
+func DialInitActions(actions ...Action) DialOpt {
+	return func(do *dialOpts) {
+		do.initActions = append(do.initActions, actions...)
+	}
+}
+
+// DialInitErrHandler sets the function which is called when one of the Actions
+// given to DialInitActions returns an error. If the function returns nil then
+// the remaining Actions are performed and the connection is used as normal,
+// otherwise the connection is closed and Dial returns the function's error.
+//
+// This can be used to log and ignore errors from Actions which aren't critical,
+// e.g. ones which aren't supported by every server. The function should still
+// return the error if it leaves the connection unusable, e.g. a network error.
+func DialInitErrHandler(fn func(a Action, err error) error) DialOpt {
+	return func(do *dialOpts) {
+		do.initErrFn = fn
+	}
+}
+
 // DialUseTLS will cause Dial to perform a TLS handshake using the provided
 // config. If config is nil the config is interpreted as equivalent to the zero
 // configuration. See https://golang.org/pkg/crypto/tls/#Config
@@ -193,15 +522,90 @@ func DialUseTLS(config *tls.Config) DialOpt {
 type timeoutConn struct {
 	net.Conn
 	readTimeout, writeTimeout time.Duration
+	blockingReadTimeout       time.Duration
+
+	// blockTimeout is set while waiting on the responses to a blocking
+	// command, or to a pipeline containing one. It is the read timeout to use
+	// for those responses, or -1 if no deadline should be set. blockReplies is
+	// the number of those responses which have yet to be read.
+	blockTimeout int64
+	blockReplies int64
 }
 
 func (tc *timeoutConn) Read(b []byte) (int, error) {
-	if tc.readTimeout > 0 {
+	switch blockTimeout := time.Duration(atomic.LoadInt64(&tc.blockTimeout)); {
+	case blockTimeout < 0:
+		tc.Conn.SetReadDeadline(time.Time{})
+	case blockTimeout > 0:
+		tc.Conn.SetReadDeadline(time.Now().Add(blockTimeout))
+	case tc.readTimeout > 0:
 		tc.Conn.SetReadDeadline(time.Now().Add(tc.readTimeout))
 	}
 	return tc.Conn.Read(b)
 }
 
+// startBlocking sets blockTimeout if the given message is a blocking command,
+// or a pipeline containing at least one, in which case the longest timeout of
+// its blocking commands is used for all of its responses. It does nothing if no
+// blocking read timeout was configured, in which case reads never have a
+// deadline anyway.
+func (tc *timeoutConn) startBlocking(m resp.Marshaler) {
+	if tc.blockingReadTimeout <= 0 {
+		return
+	}
+
+	var cmds []CmdAction
+	switch m := m.(type) {
+	case *cmdAction:
+		cmds = []CmdAction{m}
+	case pipeline:
+		cmds = m
+	default:
+		return
+	}
+
+	var d time.Duration
+	var blocking bool
+	for _, cmd := range cmds {
+		cmdA, ok := cmd.(*cmdAction)
+		if !ok {
+			continue
+		}
+		cmdD, ok := cmdA.blockTimeout()
+		if !ok {
+			continue
+		}
+		blocking = true
+		if cmdD < 0 || d < 0 {
+			d = -1
+		} else if cmdD > d {
+			d = cmdD
+		}
+	}
+	if !blocking {
+		return
+	} else if d >= 0 {
+		d += tc.blockingReadTimeout
+	}
+	atomic.StoreInt64(&tc.blockTimeout, int64(d))
+	atomic.StoreInt64(&tc.blockReplies, int64(len(cmds)))
+}
+
+// endBlocking unsets blockTimeout once the responses it was set for have been
+// read.
+func (tc *timeoutConn) endBlocking() {
+	if atomic.LoadInt64(&tc.blockReplies) <= 0 {
+		return
+	} else if atomic.AddInt64(&tc.blockReplies, -1) > 0 {
+		return
+	}
+	if atomic.SwapInt64(&tc.blockTimeout, 0) != 0 && tc.readTimeout <= 0 {
+		// the deadline set for the blocking command would otherwise apply to
+		// subsequent reads.
+		tc.Conn.SetReadDeadline(time.Time{})
+	}
+}
+
 func (tc *timeoutConn) Write(b []byte) (int, error) {
 	if tc.writeTimeout > 0 {
 		tc.Conn.SetWriteDeadline(time.Now().Add(tc.writeTimeout))
@@ -211,6 +615,7 @@ func (tc *timeoutConn) Write(b []byte) (int, error) {
 
 var defaultDialOpts = []DialOpt{
 	DialTimeout(10 * time.Second),
+	DialKeepAlive(KeepAliveConfig{Enable: true, Idle: 10 * time.Second}),
 }
 
 func parseRedisURL(urlStr string) (string, []DialOpt) {
@@ -269,6 +674,7 @@ func parseRedisURL(urlStr string) (string, []DialOpt) {
 // The default options Dial uses are:
 //
 //	DialTimeout(10 * time.Second)
+//	DialKeepAlive(KeepAliveConfig{Enable: true, Idle: 10 * time.Second})
 //
 func Dial(network, addr string, opts ...DialOpt) (Conn, error) {
 	var do dialOpts
@@ -283,13 +689,25 @@ func Dial(network, addr string, opts ...DialOpt) (Conn, error) {
 		opt(&do)
 	}
 
+	var creds Credentials
+	if do.credsFn != nil {
+		var err error
+		if creds, err = do.credsFn(); err != nil {
+			return nil, errors.Errorf("fetching credentials: %w", err)
+		}
+		do.authUser, do.authPass = creds.User, creds.Pass
+	}
+
 	var netConn net.Conn
 	var err error
 	dialer := net.Dialer{}
 	if do.connectTimeout > 0 {
 		dialer.Timeout = do.connectTimeout
 	}
-	if do.useTLSConfig {
+	setDialerKeepAlive(&dialer, do.keepAlive)
+	if do.dialsAddrs(network, addr) {
+		netConn, err = dialAddrs(dialer, network, addr, do)
+	} else if do.useTLSConfig {
 		netConn, err = tls.DialWithDialer(&dialer, network, addr, do.tlsConfig)
 	} else {
 		netConn, err = dialer.Dial(network, addr)
@@ -299,46 +717,71 @@ func Dial(network, addr string, opts ...DialOpt) (Conn, error) {
 		return nil, err
 	}
 
-	// If the netConn is a net.TCPConn (or some wrapper for it) and so can have
-	// keepalive enabled, do so with a sane (though slightly aggressive)
-	// default.
-	{
-		type keepaliveConn interface {
-			SetKeepAlive(bool) error
-			SetKeepAlivePeriod(time.Duration) error
+	if do.blockingReadTimeout == 0 {
+		do.blockingReadTimeout = do.readTimeout
+	}
+
+	conn := newConnWithBufferSizes(&timeoutConn{
+		readTimeout:         do.readTimeout,
+		writeTimeout:        do.writeTimeout,
+		blockingReadTimeout: do.blockingReadTimeout,
+		Conn:                netConn,
+	}, do.readBufSize, do.writeBufSize)
+	if do.inline {
+		conn.(*connWrap).inline = true
+	}
+	if do.lenient {
+		conn.(*connWrap).lenient = newLenientDecoder(do.lenientFn)
+	}
+
+	if err := auth(conn, do.authUser, do.authPass); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if !creds.Expiry.IsZero() {
+		conn = newCredsConn(conn, do.credsFn, do.credsRefreshBefore, creds.Expiry)
+	}
+
+	if do.selectDB != "" {
+		if err := conn.Do(Cmd(nil, "SELECT", do.selectDB)); err != nil {
+			conn.Close()
+			return nil, err
 		}
+	}
 
-		if kaConn, ok := netConn.(keepaliveConn); ok {
-			if err = kaConn.SetKeepAlive(true); err != nil {
-				netConn.Close()
-				return nil, err
-			} else if err = kaConn.SetKeepAlivePeriod(10 * time.Second); err != nil {
-				netConn.Close()
-				return nil, err
-			}
+	if do.clientName != "" {
+		if err := conn.Do(Cmd(nil, "CLIENT", "SETNAME", do.clientName)); err != nil {
+			conn.Close()
+			return nil, err
 		}
 	}
 
-	conn := NewConn(&timeoutConn{
-		readTimeout:  do.readTimeout,
-		writeTimeout: do.writeTimeout,
-		Conn:         netConn,
-	})
+	if err := setLibInfo(conn, do.libName, do.libVer); err != nil {
+		conn.Close()
+		return nil, err
+	}
 
-	if do.authUser != "" && do.authUser != defaultAuthUser {
-		if err := conn.Do(Cmd(nil, "AUTH", do.authUser, do.authPass)); err != nil {
+	if do.noEvict {
+		if err := doOptional(conn, "CLIENT", "NO-EVICT", "ON"); err != nil {
 			conn.Close()
 			return nil, err
 		}
-	} else if do.authPass != "" {
-		if err := conn.Do(Cmd(nil, "AUTH", do.authPass)); err != nil {
+	}
+
+	if do.noTouch {
+		if err := doOptional(conn, "CLIENT", "NO-TOUCH", "ON"); err != nil {
 			conn.Close()
 			return nil, err
 		}
 	}
 
-	if do.selectDB != "" {
-		if err := conn.Do(Cmd(nil, "SELECT", do.selectDB)); err != nil {
+	for _, a := range do.initActions {
+		err := conn.Do(a)
+		if err != nil && do.initErrFn != nil {
+			err = do.initErrFn(a, err)
+		}
+		if err != nil {
 			conn.Close()
 			return nil, err
 		}
@@ -346,3 +789,40 @@ func Dial(network, addr string, opts ...DialOpt) (Conn, error) {
 
 	return conn, nil
 }
+
+// auth performs an AUTH command with the given user and pass, if either is
+// set.
+func auth(conn Conn, user, pass string) error {
+	if user != "" && user != defaultAuthUser {
+		return conn.Do(Cmd(nil, "AUTH", user, pass))
+	} else if pass != "" {
+		return conn.Do(Cmd(nil, "AUTH", pass))
+	}
+	return nil
+}
+
+// setLibInfo performs CLIENT SETINFO for each non-empty attribute. Errors
+// returned by redis itself are ignored, since older versions don't support the
+// command, but network errors are returned.
+func setLibInfo(conn Conn, libName, libVer string) error {
+	for _, attr := range [][2]string{{"LIB-NAME", libName}, {"LIB-VER", libVer}} {
+		if attr[1] == "" {
+			continue
+		}
+		if err := doOptional(conn, "CLIENT", "SETINFO", attr[0], attr[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// doOptional performs the given command, ignoring any error returned by redis
+// itself, which is useful for commands which older versions don't support.
+// Network errors are still returned.
+func doOptional(conn Conn, cmd string, args ...string) error {
+	err := conn.Do(Cmd(nil, cmd, args...))
+	if err != nil && !errors.As(err, new(resp2.Error)) {
+		return err
+	}
+	return nil
+}
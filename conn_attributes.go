@@ -0,0 +1,187 @@
+package radix
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/internal/bytesutil"
+	"github.com/mediocregopher/radix/v3/resp"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+// Attributed is a helper type which can be used as the receiver of an Action
+// in order to also receive the RESP3 attributes which preceded the reply. The
+// reply will be unmarshaled into Rcv normally, and Attributes will be set to
+// the reply's attributes, or nil if it had none. See resp.AttributesReceiver.
+//
+// Attributes are only sent by redis on connections which have been switched to
+// RESP3, e.g. by performing HELLO 3 using DialInitActions.
+type Attributed struct {
+	Rcv        interface{}
+	Attributes map[string]interface{}
+}
+
+// ReceiveAttributes implements the method for the resp.AttributesReceiver
+// interface.
+func (a *Attributed) ReceiveAttributes(attrs map[string]interface{}) {
+	a.Attributes = attrs
+}
+
+// UnmarshalRESP implements the method for the resp.Unmarshaler interface.
+func (a *Attributed) UnmarshalRESP(br *bufio.Reader) error {
+	return resp2.Any{I: a.Rcv}.UnmarshalRESP(br)
+}
+
+// receiveAttributes gives the attributes to the given receiver, if it
+// implements resp.AttributesReceiver.
+func receiveAttributes(rcv interface{}, attrs map[string]interface{}) {
+	if ar, ok := rcv.(resp.AttributesReceiver); ok {
+		ar.ReceiveAttributes(attrs)
+	}
+}
+
+// ReceiveAttributes implements the method for the resp.AttributesReceiver
+// interface, passing the attributes on to the receiver if it implements the
+// interface too.
+func (c *cmdAction) ReceiveAttributes(attrs map[string]interface{}) {
+	receiveAttributes(c.rcv, attrs)
+}
+
+// decodeAttributed reads any attributes preceding the next reply on br, giving
+// them to u if it implements resp.AttributesReceiver, and then unmarshals the
+// reply into u.
+func decodeAttributed(br *bufio.Reader, u resp.Unmarshaler) error {
+	attrs, err := readAttributes(br)
+	if err != nil {
+		return err
+	} else if ar, ok := u.(resp.AttributesReceiver); ok {
+		ar.ReceiveAttributes(attrs)
+	}
+	return u.UnmarshalRESP(br)
+}
+
+// mergeAttributes merges the attributes in src into dst, which may be nil,
+// returning the result.
+func mergeAttributes(dst, src map[string]interface{}) map[string]interface{} {
+	if dst == nil {
+		return src
+	}
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+// readAttributes reads any attribute frames which are next on br, returning
+// them merged together, or nil if there aren't any.
+func readAttributes(br *bufio.Reader) (map[string]interface{}, error) {
+	var attrs map[string]interface{}
+	for {
+		if b, err := br.Peek(1); err != nil || b[0] != '|' {
+			return attrs, err
+		}
+		v, err := readRESP3Value(br)
+		if err != nil {
+			return nil, err
+		}
+		attrs = mergeAttributes(attrs, v.(map[string]interface{}))
+	}
+}
+
+// readRESP3Value reads a single frame of any RESP2 or RESP3 type off br and
+// returns it as one of the types described by resp.AttributesReceiver.
+func readRESP3Value(br *bufio.Reader) (interface{}, error) {
+	line, err := appendLine(nil, br)
+	if err != nil {
+		return nil, err
+	} else if len(line) < 3 || !bytes.HasSuffix(line, delim) {
+		return nil, errors.Errorf("malformed frame header %q", line)
+	}
+	prefix, body := line[0], string(line[1:len(line)-2])
+
+	switch prefix {
+	case '+':
+		return body, nil
+	case '-':
+		return resp2.Error{E: errors.New(body)}, nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '_':
+		return nil, nil
+	case ',':
+		return strconv.ParseFloat(body, 64)
+	case '#':
+		return body == "t", nil
+	case '(':
+		i, ok := new(big.Int).SetString(body, 10)
+		if !ok {
+			return nil, errors.Errorf("malformed big number %q", body)
+		}
+		return i, nil
+	case '$', '!', '=':
+		n, err := parseFrameLen(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		b, err := bytesutil.ReadNAppend(br, nil, int(n)+2)
+		if err != nil {
+			return nil, err
+		}
+		str := string(b[:n])
+		if prefix == '!' {
+			return resp2.Error{E: errors.New(str)}, nil
+		} else if prefix == '=' && len(str) >= 4 {
+			// verbatim strings are prefixed by their format, e.g. "txt:"
+			str = str[4:]
+		}
+		return str, nil
+	case '*', '~', '>':
+		n, err := parseFrameLen(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		vals := make([]interface{}, 0, sizeHint(n))
+		for i := int64(0); i < n; i++ {
+			v, err := readRESP3Value(br)
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, v)
+		}
+		return vals, nil
+	case '%', '|':
+		n, err := parseFrameLen(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		m := make(map[string]interface{}, sizeHint(n))
+		for i := int64(0); i < n; i++ {
+			k, err := readRESP3Value(br)
+			if err != nil {
+				return nil, err
+			}
+			v, err := readRESP3Value(br)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(k)] = v
+		}
+		return m, nil
+	default:
+		return nil, errors.Errorf("unknown type prefix %q", prefix)
+	}
+}
+
+// sizeHint returns the capacity to preallocate for n elements, which were
+// given by the server and so can't be trusted.
+func sizeHint(n int64) int {
+	if n > 1024 {
+		return 1024
+	}
+	return int(n)
+}
@@ -0,0 +1,89 @@
+package radix
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+// writeInline marshals m, which must marshal as one or more RESP arrays of bulk
+// strings (as all commands do), and writes each array to w as an inline
+// command.
+func writeInline(w io.Writer, m resp.Marshaler) error {
+	buf := new(bytes.Buffer)
+	if err := m.MarshalRESP(buf); err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(buf)
+	var line []byte
+	for buf.Len() > 0 || br.Buffered() > 0 {
+		var ah resp2.ArrayHeader
+		if err := ah.UnmarshalRESP(br); err != nil {
+			return errors.Errorf("encoding inline command: %w", err)
+		}
+
+		line = line[:0]
+		for i := 0; i < ah.N; i++ {
+			var bs resp2.BulkStringBytes
+			if err := bs.UnmarshalRESP(br); err != nil {
+				return errors.Errorf("encoding inline command: %w", err)
+			}
+			if i > 0 {
+				line = append(line, ' ')
+			}
+			line = appendInlineArg(line, bs.B)
+		}
+		line = append(line, '\r', '\n')
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendInlineArg appends the argument to b, quoted if necessary according to
+// the rules redis uses to split inline commands (see sdssplitargs).
+func appendInlineArg(b, arg []byte) []byte {
+	quote := len(arg) == 0
+	for _, c := range arg {
+		if c <= ' ' || c >= 0x7f || c == '"' || c == '\'' || c == '\\' {
+			quote = true
+			break
+		}
+	}
+	if !quote {
+		return append(b, arg...)
+	}
+
+	const hex = "0123456789abcdef"
+	b = append(b, '"')
+	for _, c := range arg {
+		switch c {
+		case '\\', '"':
+			b = append(b, '\\', c)
+		case '\n':
+			b = append(b, '\\', 'n')
+		case '\r':
+			b = append(b, '\\', 'r')
+		case '\t':
+			b = append(b, '\\', 't')
+		case '\a':
+			b = append(b, '\\', 'a')
+		case '\b':
+			b = append(b, '\\', 'b')
+		default:
+			if c < ' ' || c >= 0x7f {
+				b = append(b, '\\', 'x', hex[c>>4], hex[c&0xf])
+			} else {
+				b = append(b, c)
+			}
+		}
+	}
+	return append(b, '"')
+}
@@ -0,0 +1,207 @@
+package radix
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/internal/bytesutil"
+	"github.com/mediocregopher/radix/v3/resp"
+)
+
+// UnsupportedFrame describes a RESP frame which was received on a Conn created
+// with DialLenientDecoding, but which is of a type radix doesn't support.
+type UnsupportedFrame struct {
+	// Prefix is the byte denoting the frame's type, e.g. '_' for a RESP3 null
+	// or '~' for a RESP3 set.
+	Prefix byte
+
+	// Raw is the entire frame, as it was read off the connection.
+	Raw []byte
+
+	// Dropped is true if the frame was dropped entirely, rather than being
+	// degraded into a bulk string. This is the case for RESP3 attributes, and
+	// for RESP3 push frames which aren't nested in another frame.
+	Dropped bool
+}
+
+// lenientDecoder reads frames off a connection and rewrites them into frames
+// radix's RESP2 Unmarshalers can understand, see DialLenientDecoding.
+type lenientDecoder struct {
+	fn func(UnsupportedFrame)
+
+	// attrs holds the attributes preceding the reply being decoded.
+	attrs map[string]interface{}
+
+	// buf holds the rewritten frame, which is read back from br.
+	buf []byte
+	r   *bytes.Reader
+	br  *bufio.Reader
+}
+
+func newLenientDecoder(fn func(UnsupportedFrame)) *lenientDecoder {
+	r := bytes.NewReader(nil)
+	return &lenientDecoder{
+		fn: fn,
+		r:  r,
+		br: bufio.NewReader(r),
+	}
+}
+
+func (ld *lenientDecoder) decode(br *bufio.Reader, u resp.Unmarshaler) error {
+	var err error
+	ld.attrs = nil
+	if ld.buf, err = ld.appendFrame(ld.buf[:0], br, true); err != nil {
+		return err
+	} else if ar, ok := u.(resp.AttributesReceiver); ok {
+		ar.ReceiveAttributes(ld.attrs)
+	}
+	ld.r.Reset(ld.buf)
+	ld.br.Reset(ld.r)
+	return u.UnmarshalRESP(ld.br)
+}
+
+func (ld *lenientDecoder) unsupported(prefix byte, raw []byte, dropped bool) {
+	if ld.fn != nil {
+		ld.fn(UnsupportedFrame{Prefix: prefix, Raw: raw, Dropped: dropped})
+	}
+}
+
+// appendFrame reads a single frame off br and appends it to dst, with any
+// frames of unsupported types replaced by bulk strings containing their raw
+// bytes.
+func (ld *lenientDecoder) appendFrame(dst []byte, br *bufio.Reader, topLevel bool) ([]byte, error) {
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return dst, err
+		}
+
+		switch prefix := b[0]; prefix {
+		case '+', '-', ':', ',', '(':
+			return appendLine(dst, br)
+		case '$', '=':
+			start := len(dst)
+			if dst, err = appendLine(dst, br); err != nil {
+				return dst, err
+			}
+			n, err := parseFrameLen(dst[start:])
+			if err != nil || n < 0 {
+				return dst, err
+			}
+			return bytesutil.ReadNAppend(br, dst, int(n)+2)
+		case '*', '%':
+			start := len(dst)
+			if dst, err = appendLine(dst, br); err != nil {
+				return dst, err
+			}
+			n, err := parseFrameLen(dst[start:])
+			if err != nil {
+				return dst, err
+			} else if prefix == '%' {
+				n *= 2
+			}
+			for i := int64(0); i < n; i++ {
+				if dst, err = ld.appendFrame(dst, br, false); err != nil {
+					return dst, err
+				}
+			}
+			return dst, nil
+		default:
+			raw, err := appendRawFrame(nil, br)
+			if err != nil {
+				return dst, err
+			}
+
+			// attributes precede the frame they describe, and push frames
+			// aren't replies at all, so rather than being degraded they're
+			// dropped and the frame after them is used. Attributes of the
+			// reply itself are also kept, see resp.AttributesReceiver.
+			if prefix == '|' && topLevel {
+				v, err := readRESP3Value(bufio.NewReader(bytes.NewReader(raw)))
+				if err != nil {
+					return dst, err
+				}
+				ld.attrs = mergeAttributes(ld.attrs, v.(map[string]interface{}))
+			}
+			if prefix == '|' || (prefix == '>' && topLevel) {
+				ld.unsupported(prefix, raw, true)
+				continue
+			}
+
+			ld.unsupported(prefix, raw, false)
+			dst = append(dst, '$')
+			dst = strconv.AppendInt(dst, int64(len(raw)), 10)
+			dst = append(dst, delim...)
+			dst = append(dst, raw...)
+			return append(dst, delim...), nil
+		}
+	}
+}
+
+var delim = []byte{'\r', '\n'}
+
+// appendRawFrame reads a single frame of any RESP2 or RESP3 type off br and
+// appends it to dst as-is.
+func appendRawFrame(dst []byte, br *bufio.Reader) ([]byte, error) {
+	start := len(dst)
+	dst, err := appendLine(dst, br)
+	if err != nil {
+		return dst, err
+	}
+
+	var numFrames int64
+	switch prefix := dst[start]; prefix {
+	case '+', '-', ':', '_', ',', '#', '(':
+		return dst, nil
+	case '$', '!', '=':
+		n, err := parseFrameLen(dst[start:])
+		if err != nil || n < 0 {
+			return dst, err
+		}
+		return bytesutil.ReadNAppend(br, dst, int(n)+2)
+	case '*', '~', '>':
+		if numFrames, err = parseFrameLen(dst[start:]); err != nil {
+			return dst, err
+		}
+	case '%', '|':
+		if numFrames, err = parseFrameLen(dst[start:]); err != nil {
+			return dst, err
+		}
+		numFrames *= 2
+	default:
+		return dst, errors.Errorf("unknown type prefix %q", prefix)
+	}
+
+	for i := int64(0); i < numFrames; i++ {
+		if dst, err = appendRawFrame(dst, br); err != nil {
+			return dst, err
+		}
+	}
+	return dst, nil
+}
+
+// appendLine reads a line, including its trailing CRLF, off br and appends it
+// to dst.
+func appendLine(dst []byte, br *bufio.Reader) ([]byte, error) {
+	for {
+		b, err := br.ReadSlice('\n')
+		dst = append(dst, b...)
+		if err != bufio.ErrBufferFull {
+			return dst, err
+		}
+	}
+}
+
+// parseFrameLen parses the length out of a frame's header line, as returned by
+// appendLine.
+func parseFrameLen(line []byte) (int64, error) {
+	if len(line) < 3 || !bytes.HasSuffix(line, delim) {
+		return 0, errors.Errorf("malformed frame header %q", line)
+	} else if line[1] == '?' {
+		return 0, errors.Errorf("streamed frames are not supported, got %q", line)
+	}
+	return bytesutil.ParseInt(line[1 : len(line)-2])
+}
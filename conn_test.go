@@ -1,13 +1,23 @@
 package radix
 
 import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+	"math/big"
+	"net"
 	"regexp"
 	"strings"
+	"sync"
 	. "testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp/resp2"
 )
 
 func TestCloseBehavior(t *T) {
@@ -134,3 +144,389 @@ func TestDialSelect(t *T) {
 		}
 	}
 }
+
+func TestDialClientName(t *T) {
+	name := randStr()
+	c := dial(DialClientName(name), DialLibInfo("radix", "v3"))
+	defer c.Close()
+
+	var out string
+	require.Nil(t, c.Do(Cmd(&out, "CLIENT", "GETNAME")))
+	assert.Equal(t, name, out)
+}
+
+func TestDialNoEvictNoTouch(t *T) {
+	// these are safe to use regardless of the redis version
+	c := dial(DialNoEvict(), DialNoTouch())
+	defer c.Close()
+	require.Nil(t, c.Do(Cmd(nil, "PING")))
+}
+
+// respServer starts a TCP server which reads commands and writes the raw RESP
+// reply returned by fn for each. It returns the server's address.
+func respServer(t *T, fn func(args []string) string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					var args []string
+					if err := (resp2.Any{I: &args}).UnmarshalRESP(br); err != nil {
+						return
+					} else if _, err := io.WriteString(conn, fn(args)); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestDialInitActions(t *T) {
+	var l sync.Mutex
+	var cmds []string
+	addr := respServer(t, func(args []string) string {
+		l.Lock()
+		cmds = append(cmds, strings.Join(args, " "))
+		l.Unlock()
+		if args[0] == "FAIL" {
+			return "-ERR failed\r\n"
+		}
+		return "+OK\r\n"
+	})
+	getCmds := func() []string {
+		l.Lock()
+		defer l.Unlock()
+		res := cmds
+		cmds = nil
+		return res
+	}
+
+	conn, err := Dial("tcp", addr,
+		DialSelectDB(1),
+		DialInitActions(Cmd(nil, "CLIENT", "TRACKING", "ON")),
+		DialInitActions(Cmd(nil, "MODULE.CONFIG", "foo"), Cmd(nil, "PING")),
+	)
+	require.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, []string{"SELECT 1", "CLIENT TRACKING ON", "MODULE.CONFIG foo", "PING"}, getCmds())
+
+	_, err = Dial("tcp", addr, DialInitActions(Cmd(nil, "FAIL"), Cmd(nil, "PING")))
+	assert.True(t, errors.As(err, new(resp2.Error)))
+	assert.Equal(t, []string{"FAIL"}, getCmds())
+
+	var handled []error
+	conn, err = Dial("tcp", addr,
+		DialInitActions(Cmd(nil, "FAIL"), Cmd(nil, "PING")),
+		DialInitErrHandler(func(a Action, err error) error {
+			handled = append(handled, err)
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, []string{"FAIL", "PING"}, getCmds())
+	assert.Len(t, handled, 1)
+}
+
+func TestDoOptional(t *T) {
+	conn := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		if args[1] == "NO-TOUCH" {
+			return resp2.Error{E: errors.New("ERR unknown subcommand")}
+		}
+		return "OK"
+	})
+	assert.NoError(t, doOptional(conn, "CLIENT", "NO-EVICT", "ON"))
+	assert.NoError(t, doOptional(conn, "CLIENT", "NO-TOUCH", "ON"))
+
+	conn.Close()
+	assert.Error(t, doOptional(conn, "CLIENT", "NO-EVICT", "ON"))
+}
+
+func TestConnBufferSizes(t *T) {
+	netConn, _ := net.Pipe()
+	defer netConn.Close()
+
+	cw := newConnWithBufferSizes(netConn, 0, 0).(*connWrap)
+	assert.Equal(t, 4096, cw.brw.Reader.Size())
+	assert.Equal(t, 4096, cw.brw.Writer.Size())
+
+	cw = newConnWithBufferSizes(netConn, 16*1024, 512).(*connWrap)
+	assert.Equal(t, 16*1024, cw.brw.Reader.Size())
+	assert.Equal(t, 512, cw.brw.Writer.Size())
+}
+
+func TestConnEncodeBuffers(t *T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := NewConn(&timeoutConn{Conn: client, writeTimeout: time.Second})
+	defer conn.Close()
+
+	large := []byte(strings.Repeat("a", zeroCopyMinSize))
+	exp := new(bytes.Buffer)
+	require.NoError(t, FlatCmd(nil, "PING", "").MarshalRESP(exp))
+	require.NoError(t, FlatCmd(nil, "SET", "foo", large).MarshalRESP(exp))
+
+	gotCh := make(chan []byte)
+	go func() {
+		got := make([]byte, exp.Len())
+		_, err := io.ReadFull(server, got)
+		assert.NoError(t, err)
+		gotCh <- got
+	}()
+
+	// the first command is small and is buffered normally, the second must
+	// still be written after it.
+	require.NoError(t, conn.Encode(FlatCmd(nil, "PING", "")))
+	require.NoError(t, conn.Encode(FlatCmd(nil, "SET", "foo", large)))
+	assert.Equal(t, exp.String(), string(<-gotCh))
+}
+
+func TestConnInline(t *T) {
+	for in, exp := range map[string]string{
+		"foo":      "foo",
+		"":         `""`,
+		"foo bar":  `"foo bar"`,
+		`say "hi"`: `"say \"hi\""`,
+		"it's":     `"it's"`,
+		"a\\b":     `"a\\b"`,
+		"line\r\n": `"line\r\n"`,
+		"\x00\xff": `"\x00\xff"`,
+	} {
+		assert.Equal(t, exp, string(appendInlineArg(nil, []byte(in))), "in:%q", in)
+	}
+
+	client, server := net.Pipe()
+	defer server.Close()
+	cw := NewConn(client).(*connWrap)
+	cw.inline = true
+	defer cw.Close()
+
+	linesCh := make(chan string)
+	go func() {
+		br := bufio.NewReader(server)
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				return
+			}
+			linesCh <- line
+			server.Write([]byte("+OK\r\n"))
+		}
+	}()
+
+	var res string
+	errCh := make(chan error, 1)
+	go func() { errCh <- cw.Do(FlatCmd(&res, "SET", "foo", "bar baz")) }()
+	assert.Equal(t, "SET foo \"bar baz\"\r\n", <-linesCh)
+	require.NoError(t, <-errCh)
+	assert.Equal(t, "OK", res)
+
+	go func() { errCh <- cw.Do(Pipeline(Cmd(nil, "GET", "foo"), Cmd(nil, "GET", ""))) }()
+	assert.Equal(t, "GET foo\r\n", <-linesCh)
+	assert.Equal(t, "GET \"\"\r\n", <-linesCh)
+	require.NoError(t, <-errCh)
+}
+
+func TestConnLenientDecoding(t *T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	var frames []UnsupportedFrame
+	cw := NewConn(client).(*connWrap)
+	cw.lenient = newLenientDecoder(func(f UnsupportedFrame) {
+		frames = append(frames, f)
+	})
+	defer cw.Close()
+
+	go func() {
+		server.Write([]byte(
+			"_\r\n" +
+				"*5\r\n:1\r\n,1.5\r\n%1\r\n+a\r\n$1\r\nb\r\n~1\r\n:1\r\n|1\r\n+a\r\n:1\r\n:2\r\n" +
+				">2\r\n$7\r\nmessage\r\n$2\r\nhi\r\n" +
+				"|1\r\n+ttl\r\n:3\r\n+OK\r\n",
+		))
+	}()
+
+	var s string
+	require.NoError(t, cw.Decode(resp2.Any{I: &s}))
+	assert.Equal(t, "_\r\n", s)
+
+	var arr []interface{}
+	require.NoError(t, cw.Decode(resp2.Any{I: &arr}))
+	assert.Equal(t, []interface{}{
+		int64(1),
+		1.5,
+		map[string]interface{}{"a": []byte("b")},
+		[]byte("~1\r\n:1\r\n"),
+		int64(2),
+	}, arr)
+
+	// attributes preceding a reply are given to its receiver, rather than
+	// being dropped.
+	attributed := Attributed{Rcv: &s}
+	require.NoError(t, cw.Decode(&attributed))
+	assert.Equal(t, "OK", s)
+	assert.Equal(t, map[string]interface{}{"ttl": int64(3)}, attributed.Attributes)
+
+	assert.Equal(t, []UnsupportedFrame{
+		{Prefix: '_', Raw: []byte("_\r\n")},
+		{Prefix: '~', Raw: []byte("~1\r\n:1\r\n")},
+		{Prefix: '|', Raw: []byte("|1\r\n+a\r\n:1\r\n"), Dropped: true},
+		{Prefix: '>', Raw: []byte(">2\r\n$7\r\nmessage\r\n$2\r\nhi\r\n"), Dropped: true},
+		{Prefix: '|', Raw: []byte("|1\r\n+ttl\r\n:3\r\n"), Dropped: true},
+	}, frames)
+}
+
+func TestConnAttributes(t *T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := NewConn(client)
+	defer conn.Close()
+
+	// every other Action which unmarshals into a receiver passes the
+	// attributes on to it as well.
+	otherActions := map[string]func(rcv interface{}) Action{
+		"FlatCmd": func(rcv interface{}) Action {
+			return FlatCmd(rcv, "GET", "c")
+		},
+		"EvalScript": func(rcv interface{}) Action {
+			return NewEvalScript(0, "return 1").Cmd(rcv)
+		},
+		"ReadOnly": func(rcv interface{}) Action {
+			return ReadOnly(Cmd(rcv, "GET", "c"))
+		},
+		"WithMetadata": func(rcv interface{}) Action {
+			return WithMetadata(Cmd(rcv, "GET", "c"), Metadata{"tenant": "a"})
+		},
+		"RequireFeatures": func(rcv interface{}) Action {
+			return RequireFeatures(Cmd(rcv, "GET", "c"), FeatureGetEx)
+		},
+		"MaybeNil": func(rcv interface{}) Action {
+			return Cmd(&MaybeNil{Rcv: rcv}, "GET", "c")
+		},
+	}
+
+	replies := []string{
+		"|2\r\n+key-popularity\r\n%2\r\n$1\r\na\r\n,0.5\r\n$1\r\nb\r\n,inf\r\n" +
+			"+flags\r\n~3\r\n#t\r\n_\r\n(18446744073709551616\r\n" +
+			"|1\r\n+ttl\r\n=8\r\ntxt:3600\r\n" +
+			"$3\r\nfoo\r\n",
+		"$3\r\nbar\r\n",
+	}
+	for range otherActions {
+		replies = append(replies, "|1\r\n+ttl\r\n:1\r\n$3\r\nbaz\r\n")
+	}
+
+	go func() {
+		br := bufio.NewReader(server)
+		for _, reply := range replies {
+			var rm resp2.RawMessage
+			if err := rm.UnmarshalRESP(br); err != nil {
+				return
+			} else if _, err := server.Write([]byte(reply)); err != nil {
+				return
+			}
+		}
+	}()
+
+	bigNum, _ := new(big.Int).SetString("18446744073709551616", 10)
+	attributed := Attributed{Rcv: new(string)}
+	require.NoError(t, conn.Do(Cmd(&attributed, "GET", "a")))
+	assert.Equal(t, "foo", *attributed.Rcv.(*string))
+	assert.Equal(t, map[string]interface{}{
+		"key-popularity": map[string]interface{}{"a": 0.5, "b": math.Inf(1)},
+		"flags":          []interface{}{true, nil, bigNum},
+		"ttl":            "3600",
+	}, attributed.Attributes)
+
+	// Attributes is reset for replies without any.
+	require.NoError(t, conn.Do(Cmd(&attributed, "GET", "b")))
+	assert.Equal(t, "bar", *attributed.Rcv.(*string))
+	assert.Nil(t, attributed.Attributes)
+
+	for name, mkAction := range otherActions {
+		attributed := Attributed{Rcv: new(string)}
+		require.NoError(t, conn.Do(mkAction(&attributed)), name)
+		assert.Equal(t, "baz", *attributed.Rcv.(*string), name)
+		assert.Equal(t, map[string]interface{}{"ttl": int64(1)}, attributed.Attributes, name)
+	}
+}
+
+type deadlineRecordingConn struct {
+	net.Conn
+	readDeadlines []time.Time
+}
+
+func (c *deadlineRecordingConn) SetReadDeadline(t time.Time) error {
+	c.readDeadlines = append(c.readDeadlines, t)
+	return c.Conn.SetReadDeadline(t)
+}
+
+func TestConnBlockingReadTimeout(t *T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		// respond to every command with a nil reply
+		br := bufio.NewReader(server)
+		for {
+			var rm resp2.RawMessage
+			if err := rm.UnmarshalRESP(br); err != nil {
+				return
+			} else if _, err := server.Write([]byte("$-1\r\n")); err != nil {
+				return
+			}
+		}
+	}()
+
+	dc := &deadlineRecordingConn{Conn: client}
+	conn := NewConn(&timeoutConn{
+		Conn:                dc,
+		readTimeout:         time.Second,
+		blockingReadTimeout: 2 * time.Second,
+	})
+	defer conn.Close()
+
+	assertDeadline := func(exp time.Duration) {
+		require.NotEmpty(t, dc.readDeadlines)
+		last := dc.readDeadlines[len(dc.readDeadlines)-1]
+		if exp < 0 {
+			assert.True(t, last.IsZero())
+		} else {
+			assert.WithinDuration(t, time.Now().Add(exp), last, 500*time.Millisecond)
+		}
+		dc.readDeadlines = nil
+	}
+
+	require.NoError(t, conn.Do(Cmd(nil, "GET", "foo")))
+	assertDeadline(time.Second)
+
+	require.NoError(t, conn.Do(Cmd(nil, "BLPOP", "foo", "10")))
+	assertDeadline(12 * time.Second)
+
+	require.NoError(t, conn.Do(Cmd(nil, "BLPOP", "foo", "0")))
+	assertDeadline(-1)
+
+	// normal commands go back to using the normal timeout
+	require.NoError(t, conn.Do(Cmd(nil, "GET", "foo")))
+	assertDeadline(time.Second)
+
+	// pipelines use the longest timeout of the blocking commands they contain
+	require.NoError(t, conn.Do(Pipeline(
+		Cmd(nil, "GET", "foo"),
+		Cmd(nil, "BLPOP", "foo", "10"),
+		Cmd(nil, "BRPOP", "foo", "5"),
+	)))
+	assertDeadline(12 * time.Second)
+
+	require.NoError(t, conn.Do(Cmd(nil, "GET", "foo")))
+	assertDeadline(time.Second)
+}
@@ -0,0 +1,335 @@
+// Package debug contains an http.Handler which renders the internal state of
+// radix Clients, i.e. their stats, topology, in-flight Actions and recent
+// errors, as either JSON or HTML. It's intended to be mounted under a path like
+// /debug/redis in a service, for quick triage in production.
+package debug
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+// HandlerOpts are the options given to NewHandler.
+type HandlerOpts struct {
+	// MaxErrors is the number of the most recent errors which are kept and
+	// rendered.
+	//
+	// The default, if MaxErrors is 0, is 100.
+	MaxErrors int
+}
+
+// InFlight describes an Action which is currently being performed.
+type InFlight struct {
+	Commands []string
+	Keys     []string
+	Started  time.Time
+	Elapsed  time.Duration
+}
+
+// Error describes an error returned from an Action.
+type Error struct {
+	Client   string
+	Time     time.Time
+	Commands []string
+	Keys     []string
+	Err      string
+}
+
+// Client describes the state of a single Client registered with a Handler.
+// Stats which don't apply to the Client are left empty.
+type Client struct {
+	Name string
+
+	// Type is the Go type of the Client, e.g. "*radix.Pool".
+	Type string
+
+	Pool     *radix.PoolStats              `json:",omitempty"`
+	Cluster  *radix.ClusterStats           `json:",omitempty"`
+	Commands map[string]radix.CommandStats `json:",omitempty"`
+
+	// InFlight holds the Actions currently being performed, longest running
+	// first.
+	InFlight []InFlight
+}
+
+// Snapshot describes the state of all Clients registered with a Handler.
+type Snapshot struct {
+	Time    time.Time
+	Clients []Client
+
+	// Errors holds the most recent errors, most recent first.
+	Errors []Error
+}
+
+type inFlight struct {
+	client string
+	InFlight
+}
+
+// Handler is an http.Handler which renders a Snapshot of the Clients
+// registered with it. The Snapshot is rendered as JSON if the request has a
+// "format=json" query parameter or accepts "application/json", and as HTML
+// otherwise.
+type Handler struct {
+	opts HandlerOpts
+
+	l        sync.Mutex
+	clients  map[string]radix.Client
+	nextID   uint64
+	inFlight map[uint64]inFlight
+	errs     []Error // ring buffer
+	errsNext int
+}
+
+var _ http.Handler = new(Handler)
+
+// NewHandler initializes and returns a Handler.
+func NewHandler(opts HandlerOpts) *Handler {
+	if opts.MaxErrors == 0 {
+		opts.MaxErrors = 100
+	}
+	return &Handler{
+		opts:     opts,
+		clients:  map[string]radix.Client{},
+		inFlight: map[uint64]inFlight{},
+	}
+}
+
+// Register registers the Client under the given name, replacing any Client
+// previously registered under it.
+//
+// The stats of Clients of certain types are rendered: *radix.Pool,
+// *radix.Cluster, and *radix.StatsClient (along with those of the Client it
+// wraps).
+//
+// The returned Client wraps the given one, and should be used in its place in
+// order for its in-flight Actions and errors to be rendered. Closing it closes
+// the given Client, but doesn't unregister it, see Unregister.
+func (h *Handler) Register(name string, c radix.Client) radix.Client {
+	h.l.Lock()
+	defer h.l.Unlock()
+	h.clients[name] = c
+	return &trackedClient{Client: c, h: h, name: name}
+}
+
+// Unregister unregisters the Client registered under the given name, if any.
+func (h *Handler) Unregister(name string) {
+	h.l.Lock()
+	defer h.l.Unlock()
+	delete(h.clients, name)
+}
+
+type trackedClient struct {
+	radix.Client
+	h    *Handler
+	name string
+}
+
+func (tc *trackedClient) Do(a radix.Action) error {
+	// the Properties must be copied, since they may belong to an Action which
+	// is reused once performed.
+	props := radix.ActionProperties(a)
+	commands := append([]string(nil), props.Commands...)
+	keys := append([]string(nil), props.Keys...)
+
+	id := tc.h.begin(tc.name, commands, keys)
+	err := tc.Client.Do(a)
+	tc.h.end(id, err)
+	return err
+}
+
+func (h *Handler) begin(name string, commands, keys []string) uint64 {
+	h.l.Lock()
+	defer h.l.Unlock()
+	id := h.nextID
+	h.nextID++
+	h.inFlight[id] = inFlight{
+		client: name,
+		InFlight: InFlight{
+			Commands: commands,
+			Keys:     keys,
+			Started:  time.Now(),
+		},
+	}
+	return id
+}
+
+func (h *Handler) end(id uint64, err error) {
+	h.l.Lock()
+	defer h.l.Unlock()
+	inf := h.inFlight[id]
+	delete(h.inFlight, id)
+	if err == nil {
+		return
+	}
+
+	e := Error{
+		Client:   inf.client,
+		Time:     time.Now(),
+		Commands: inf.Commands,
+		Keys:     inf.Keys,
+		Err:      err.Error(),
+	}
+	if len(h.errs) < h.opts.MaxErrors {
+		h.errs = append(h.errs, e)
+	} else {
+		h.errs[h.errsNext] = e
+	}
+	h.errsNext = (h.errsNext + 1) % h.opts.MaxErrors
+}
+
+// Snapshot returns a Snapshot of the Clients registered with the Handler.
+func (h *Handler) Snapshot() Snapshot {
+	now := time.Now()
+	s := Snapshot{Time: now}
+
+	h.l.Lock()
+	clients := make(map[string]radix.Client, len(h.clients))
+	for name, c := range h.clients {
+		clients[name] = c
+	}
+	inFlights := map[string][]InFlight{}
+	for _, inf := range h.inFlight {
+		inf.Elapsed = now.Sub(inf.Started)
+		inFlights[inf.client] = append(inFlights[inf.client], inf.InFlight)
+	}
+	for i := range h.errs {
+		// iterate backwards from the most recently written error.
+		j := (h.errsNext - 1 - i + 2*len(h.errs)) % len(h.errs)
+		s.Errors = append(s.Errors, h.errs[j])
+	}
+	h.l.Unlock()
+
+	// stats are gathered without the lock held, since they may take locks
+	// of their own.
+	for name, c := range clients {
+		sc := Client{Name: name, Type: fmt.Sprintf("%T", c), InFlight: inFlights[name]}
+		sort.Slice(sc.InFlight, func(i, j int) bool {
+			return sc.InFlight[i].Started.Before(sc.InFlight[j].Started)
+		})
+		fillStats(&sc, c)
+		s.Clients = append(s.Clients, sc)
+	}
+	sort.Slice(s.Clients, func(i, j int) bool {
+		return s.Clients[i].Name < s.Clients[j].Name
+	})
+	return s
+}
+
+func fillStats(sc *Client, c radix.Client) {
+	switch c := c.(type) {
+	case *radix.Pool:
+		ps := c.Stats()
+		sc.Pool = &ps
+	case *radix.Cluster:
+		cs := c.Stats()
+		sc.Cluster = &cs
+	case *radix.StatsClient:
+		sc.Commands = c.Stats()
+		fillStats(sc, c.Client)
+	}
+}
+
+// Publish publishes the Handler's Snapshot as an expvar under the given name,
+// so that it's included in the output of expvar's handler (generally mounted
+// at /debug/vars). Like expvar.Publish, Publish panics if the name is already
+// in use.
+func (h *Handler) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return h.Snapshot()
+	}))
+}
+
+func wantsJSON(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "json" ||
+		strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// ServeHTTP implements the method for the http.Handler interface.
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	s := h.Snapshot()
+	if wantsJSON(r) {
+		rw.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(rw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(s); err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := htmlTpl.Execute(rw, s); err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var htmlTpl = template.Must(template.New("").Funcs(template.FuncMap{
+	"join": strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>radix</title>
+<style>
+body { font-family: monospace; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 6px; text-align: left; }
+</style>
+</head>
+<body>
+<p>Snapshot taken at {{.Time.Format "2006-01-02T15:04:05.000Z07:00"}}</p>
+{{range .Clients}}
+<h2>{{.Name}} <small>({{.Type}})</small></h2>
+{{with .Pool}}
+<h3>Pool</h3>
+<table>
+<tr><th>Open</th><th>Idle</th><th>In use</th><th>Waiters</th><th>Created</th><th>Closed</th><th>Dial failures</th><th>Avg checkout wait</th></tr>
+<tr><td>{{.OpenConns}}</td><td>{{.IdleConns}}</td><td>{{.InUseConns}}</td><td>{{.Waiters}}</td><td>{{.TotalCreated}}</td><td>{{.TotalClosed}}</td><td>{{.DialFailures}}</td><td>{{.AvgCheckoutWait}}</td></tr>
+</table>
+{{end}}
+{{with .Cluster}}
+<h3>Cluster</h3>
+<p>Last synced at {{.LastSync.Format "2006-01-02T15:04:05.000Z07:00"}}, {{.Moved}} MOVED, {{.Asked}} ASK</p>
+<table>
+<tr><th>Addr</th><th>Secondary of</th><th>Slots</th><th>Open</th><th>In use</th><th>Actions</th><th>Errors</th><th>Error rate</th><th>MOVED</th><th>ASK</th></tr>
+{{range .Nodes}}
+<tr><td>{{.Node.Addr}}</td><td>{{.Node.SecondaryOfAddr}}</td><td>{{.Node.Slots}}</td>{{with .Pool}}<td>{{.OpenConns}}</td><td>{{.InUseConns}}</td>{{else}}<td></td><td></td>{{end}}<td>{{.Actions}}</td><td>{{.Errors}}</td><td>{{printf "%.4f" .ErrorRate}}</td><td>{{.Moved}}</td><td>{{.Asked}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{with .Commands}}
+<h3>Commands</h3>
+<table>
+<tr><th>Command</th><th>Count</th><th>Errors</th><th>Mean</th><th>p99</th><th>Max</th></tr>
+{{range $name, $cs := .}}
+<tr><td>{{$name}}</td><td>{{$cs.Count}}</td><td>{{$cs.Errors}}</td><td>{{$cs.Mean}}</td><td>{{$cs.Percentile 99}}</td><td>{{$cs.Max}}</td></tr>
+{{end}}
+</table>
+{{end}}
+<h3>In flight</h3>
+<table>
+<tr><th>Commands</th><th>Keys</th><th>Elapsed</th></tr>
+{{range .InFlight}}
+<tr><td>{{join .Commands " "}}</td><td>{{join .Keys " "}}</td><td>{{.Elapsed}}</td></tr>
+{{end}}
+</table>
+{{end}}
+<h2>Recent errors</h2>
+<table>
+<tr><th>Time</th><th>Client</th><th>Commands</th><th>Keys</th><th>Error</th></tr>
+{{range .Errors}}
+<tr><td>{{.Time.Format "2006-01-02T15:04:05.000Z07:00"}}</td><td>{{.Client}}</td><td>{{join .Commands " "}}</td><td>{{join .Keys " "}}</td><td>{{.Err}}</td></tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,95 @@
+package debug
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+func TestHandler(t *T) {
+	unblockCh := make(chan struct{})
+	pool, err := radix.NewPool("tcp", "127.0.0.1:6379", 2, radix.PoolConnFunc(
+		func(network, addr string) (radix.Conn, error) {
+			return radix.Stub(network, addr, func(args []string) interface{} {
+				switch args[0] {
+				case "BLOCK":
+					<-unblockCh
+				case "FAIL":
+					return errors.New("ERR failed")
+				}
+				return "OK"
+			}), nil
+		},
+	))
+	require.NoError(t, err)
+
+	h := NewHandler(HandlerOpts{MaxErrors: 2})
+	c := h.Register("pool", radix.NewStatsClient(pool))
+	defer c.Close()
+
+	require.NoError(t, c.Do(radix.Cmd(nil, "SET", "foo", "bar")))
+	for i := 0; i < 3; i++ {
+		require.Error(t, c.Do(radix.Cmd(nil, "FAIL", "key"+strconv.Itoa(i))))
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.Do(radix.Cmd(nil, "BLOCK", "baz")) }()
+	for len(h.Snapshot().Clients[0].InFlight) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	s := h.Snapshot()
+	require.Len(t, s.Clients, 1)
+	sc := s.Clients[0]
+	assert.Equal(t, "pool", sc.Name)
+	assert.Equal(t, "*radix.StatsClient", sc.Type)
+	require.NotNil(t, sc.Pool)
+	assert.Equal(t, 2, sc.Pool.OpenConns)
+	assert.Equal(t, uint64(1), sc.Commands["SET"].Count)
+	assert.Equal(t, uint64(3), sc.Commands["FAIL"].Errors)
+	require.Len(t, sc.InFlight, 1)
+	assert.Equal(t, []string{"BLOCK"}, sc.InFlight[0].Commands)
+	assert.Equal(t, []string{"baz"}, sc.InFlight[0].Keys)
+
+	// only the most recent errors are kept.
+	require.Len(t, s.Errors, 2)
+	assert.Equal(t, []string{"key2"}, s.Errors[0].Keys)
+	assert.Equal(t, []string{"key1"}, s.Errors[1].Keys)
+	assert.Equal(t, "pool", s.Errors[0].Client)
+	assert.Contains(t, s.Errors[0].Err, "ERR failed")
+
+	t.Run("JSON", func(t *T) {
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest("GET", "/debug/redis?format=json", nil))
+		assert.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+
+		var got Snapshot
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &got))
+		require.Len(t, got.Clients, 1)
+		assert.Equal(t, 2, got.Clients[0].Pool.OpenConns)
+		assert.Len(t, got.Errors, 2)
+	})
+
+	t.Run("HTML", func(t *T) {
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest("GET", "/debug/redis", nil))
+		assert.True(t, strings.HasPrefix(rw.Header().Get("Content-Type"), "text/html"))
+		body := rw.Body.String()
+		assert.Contains(t, body, "*radix.StatsClient")
+		assert.Contains(t, body, "ERR failed")
+		assert.Contains(t, body, "BLOCK")
+	})
+
+	close(unblockCh)
+	require.NoError(t, <-errCh)
+	assert.Empty(t, h.Snapshot().Clients[0].InFlight)
+}
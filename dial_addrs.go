@@ -0,0 +1,173 @@
+package radix
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+// DialAddrAttemptTimeout limits how long Dial will spend connecting to any
+// single IP address when the host being dialed resolves to more than one.
+// Once an attempt times out the next address is tried, so that a dead address
+// doesn't consume the whole of the DialConnectTimeout.
+//
+// If neither this nor DialAddrRaceDelay are set then the host is dialed as
+// normal by net.Dialer, which divides the connect timeout between the
+// addresses it tries.
+func DialAddrAttemptTimeout(d time.Duration) DialOpt {
+	return func(do *dialOpts) {
+		do.addrAttemptTimeout = d
+	}
+}
+
+// DialAddrRaceDelay causes Dial to race connection attempts when the host being
+// dialed resolves to more than one IP address, in the style of RFC 6555 (Happy
+// Eyeballs). The first address is dialed immediately, and each subsequent
+// address is dialed once the given delay has passed or the previous attempt
+// has failed, whichever comes first. The first attempt to succeed is used and
+// the rest are cancelled.
+//
+// If not set then addresses are tried one at a time.
+func DialAddrRaceDelay(d time.Duration) DialOpt {
+	return func(do *dialOpts) {
+		do.addrRaceDelay = d
+	}
+}
+
+type addrDialResult struct {
+	conn net.Conn
+	err  error
+}
+
+// dialAddrs dials the host:port addr, trying each of the IP addresses the host
+// resolves to as configured by DialAddrAttemptTimeout and DialAddrRaceDelay.
+// TLS is performed on the resulting connection if configured.
+func dialAddrs(dialer net.Dialer, network, addr string, do dialOpts) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if do.connectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, do.connectTimeout)
+		defer cancel()
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		isV4 := ip.IP.To4() != nil
+		if (network == "tcp4" && !isV4) || (network == "tcp6" && isV4) {
+			continue
+		}
+		addrs = append(addrs, net.JoinHostPort(ip.String(), port))
+	}
+	if len(addrs) == 0 {
+		return nil, errors.Errorf("no addresses for host %q match network %q", host, network)
+	}
+
+	netConn, err := raceDialAddrs(ctx, dialer, network, addrs, do)
+	if err != nil {
+		return nil, err
+	} else if !do.useTLSConfig {
+		return netConn, nil
+	}
+
+	tlsConfig := do.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+	}
+	tlsConn := tls.Client(netConn, tlsConfig)
+	if deadline, ok := ctx.Deadline(); ok {
+		tlsConn.SetDeadline(deadline)
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+func raceDialAddrs(ctx context.Context, dialer net.Dialer, network string, addrs []string, do dialOpts) (net.Conn, error) {
+	// the Dialer's own timeout would apply to every attempt, but the overall
+	// timeout is already applied by ctx.
+	dialer.Timeout = do.addrAttemptTimeout
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resCh := make(chan addrDialResult, len(addrs))
+	dial := func(addr string) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		resCh <- addrDialResult{conn: conn, err: err}
+	}
+
+	var pending int
+	var firstErr error
+	next := 0
+	for {
+		if next < len(addrs) {
+			go dial(addrs[next])
+			next++
+			pending++
+		}
+
+		var raceC <-chan time.Time
+		if do.addrRaceDelay > 0 && next < len(addrs) {
+			timer := time.NewTimer(do.addrRaceDelay)
+			raceC = timer.C
+			defer timer.Stop()
+		}
+
+		select {
+		case res := <-resCh:
+			pending--
+			if res.err == nil {
+				// any attempts still in flight are cancelled, but may have
+				// succeeded in the meantime and so need closing.
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						if res := <-resCh; res.conn != nil {
+							res.conn.Close()
+						}
+					}
+				}(pending)
+				return res.conn, nil
+			} else if firstErr == nil {
+				firstErr = res.err
+			}
+			if pending == 0 && next == len(addrs) {
+				return nil, firstErr
+			}
+		case <-raceC:
+		}
+	}
+}
+
+// dialsAddrs returns whether dialAddrs should be used to dial the given
+// address, rather than leaving it to net.Dialer.
+func (do dialOpts) dialsAddrs(network, addr string) bool {
+	if do.addrAttemptTimeout <= 0 && do.addrRaceDelay <= 0 {
+		return false
+	}
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return false
+	}
+	host, _, err := net.SplitHostPort(addr)
+	return err == nil && net.ParseIP(host) == nil
+}
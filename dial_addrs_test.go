@@ -0,0 +1,91 @@
+package radix
+
+import (
+	"context"
+	"net"
+	"syscall"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func acceptAll(t *T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	return l
+}
+
+// closedAddr returns an address which nothing is listening on.
+func closedAddr(t *T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestDialAddrs(t *T) {
+	l := acceptAll(t)
+	defer l.Close()
+	good, bad := l.Addr().String(), closedAddr(t)
+
+	t.Run("sequential", func(t *T) {
+		conn, err := raceDialAddrs(context.Background(), net.Dialer{}, "tcp", []string{bad, good}, dialOpts{
+			addrAttemptTimeout: time.Second,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, good, conn.RemoteAddr().String())
+		conn.Close()
+
+		_, err = raceDialAddrs(context.Background(), net.Dialer{}, "tcp", []string{bad, bad}, dialOpts{
+			addrAttemptTimeout: time.Second,
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("race", func(t *T) {
+		// the Control function is called prior to connecting, so can be used to
+		// make the first address hang.
+		slow := closedAddr(t)
+		dialer := net.Dialer{Control: func(_, addr string, _ syscall.RawConn) error {
+			if addr == slow {
+				time.Sleep(time.Second)
+			}
+			return nil
+		}}
+		start := time.Now()
+		conn, err := raceDialAddrs(context.Background(), dialer, "tcp", []string{slow, good}, dialOpts{
+			addrRaceDelay: 10 * time.Millisecond,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, good, conn.RemoteAddr().String())
+		assert.True(t, time.Since(start) < time.Second)
+		conn.Close()
+	})
+
+	t.Run("dialsAddrs", func(t *T) {
+		do := dialOpts{addrAttemptTimeout: time.Second}
+		assert.True(t, do.dialsAddrs("tcp", "localhost:6379"))
+		assert.False(t, do.dialsAddrs("tcp", "127.0.0.1:6379"))
+		assert.False(t, do.dialsAddrs("unix", "/tmp/redis.sock"))
+		assert.False(t, dialOpts{}.dialsAddrs("tcp", "localhost:6379"))
+	})
+
+	t.Run("Dial", func(t *T) {
+		_, port, _ := net.SplitHostPort(good)
+		conn, err := Dial("tcp", net.JoinHostPort("localhost", port), DialAddrAttemptTimeout(time.Second))
+		require.NoError(t, err)
+		conn.Close()
+	})
+}
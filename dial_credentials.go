@@ -0,0 +1,135 @@
+package radix
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp"
+)
+
+// Credentials are the user and pass used to authenticate a connection, see
+// DialCredentials.
+type Credentials struct {
+	// User may be empty, in which case only Pass is given to AUTH.
+	User, Pass string
+
+	// Expiry is when the Credentials stop being valid. It may be zero if they
+	// don't expire.
+	Expiry time.Time
+}
+
+// CredentialsFunc returns the Credentials to authenticate a connection with.
+// It's called every time a connection is created or re-authenticated, and so
+// should cache Credentials if fetching them is expensive.
+type CredentialsFunc func() (Credentials, error)
+
+// credsConn wraps a Conn, re-authenticating it before its Credentials expire.
+//
+// Re-authentication happens on Encode, but only when the responses to all
+// previously encoded commands have been decoded, so that the response to the
+// AUTH isn't confused with that of another command.
+//
+// Encode and Decode may be called from different goroutines, as MuxClient
+// does, so long as each is only called from one goroutine at a time.
+type credsConn struct {
+	// pending is the number of encoded commands whose responses haven't been
+	// decoded yet. It's accessed atomically, and must be first for alignment.
+	pending int64
+
+	Conn
+	fn            CredentialsFunc
+	refreshBefore time.Duration
+	refreshAt     time.Time
+
+	// closed is set if re-authentication failed, after which the connection
+	// is closed, and further Encodes fail with the network error that causes.
+	closed bool
+}
+
+func newCredsConn(conn Conn, fn CredentialsFunc, refreshBefore time.Duration, expiry time.Time) Conn {
+	return &credsConn{
+		Conn:          conn,
+		fn:            fn,
+		refreshBefore: refreshBefore,
+		refreshAt:     expiry.Add(-refreshBefore),
+	}
+}
+
+func (cc *credsConn) Do(a Action) error {
+	return a.Run(cc)
+}
+
+func (cc *credsConn) Encode(m resp.Marshaler) error {
+	if cmd, ok := m.(*cmdAction); ok && isSubscribeCmd(cmd.cmd) {
+		// once subscribed the connection can't perform AUTH.
+		cc.refreshAt = time.Time{}
+	} else if !cc.closed && atomic.LoadInt64(&cc.pending) == 0 && !cc.refreshAt.IsZero() && !time.Now().Before(cc.refreshAt) {
+		if err := cc.reauth(); err != nil {
+			cc.closed = true
+			cc.Conn.Close()
+			return errors.Errorf("re-authenticating connection: %w", err)
+		}
+	}
+
+	// pending is incremented before the commands are written, so that their
+	// responses can't be decoded before it is.
+	n := int64(numMarshalerCmds(m))
+	atomic.AddInt64(&cc.pending, n)
+	if err := cc.Conn.Encode(m); err != nil {
+		atomic.AddInt64(&cc.pending, -n)
+		return err
+	}
+	return nil
+}
+
+func (cc *credsConn) Decode(u resp.Unmarshaler) error {
+	// pending is only decremented once the response has been read, so that a
+	// concurrent Encode doesn't re-authenticate while it's being read.
+	err := cc.Conn.Decode(u)
+	for {
+		n := atomic.LoadInt64(&cc.pending)
+		if n <= 0 || atomic.CompareAndSwapInt64(&cc.pending, n, n-1) {
+			return err
+		}
+	}
+}
+
+// numMarshalerCmds returns the number of commands, and therefore responses,
+// which the given Marshaler being encoded on a Conn results in.
+func numMarshalerCmds(m resp.Marshaler) int {
+	switch m := m.(type) {
+	case pipeline:
+		return len(m)
+	case *pipelinerPipeline:
+		return len(m.pipeline)
+	default:
+		return 1
+	}
+}
+
+func (cc *credsConn) reauth() error {
+	creds, err := cc.fn()
+	if err != nil {
+		return errors.Errorf("fetching credentials: %w", err)
+	} else if err := auth(cc.Conn, creds.User, creds.Pass); err != nil {
+		return err
+	}
+
+	cc.refreshAt = time.Time{}
+	if !creds.Expiry.IsZero() {
+		cc.refreshAt = creds.Expiry.Add(-cc.refreshBefore)
+	}
+	return nil
+}
+
+func isSubscribeCmd(cmd string) bool {
+	switch strings.ToUpper(cmd) {
+	case "SUBSCRIBE", "PSUBSCRIBE", "SSUBSCRIBE":
+		return true
+	default:
+		return false
+	}
+}
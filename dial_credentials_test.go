@@ -0,0 +1,140 @@
+package radix
+
+import (
+	"strconv"
+	"sync"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+func TestCredsConn(t *T) {
+	var auths [][]string
+	stub := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		if args[0] == "AUTH" {
+			auths = append(auths, args[1:])
+		}
+		return "OK"
+	})
+
+	var n int
+	var fnErr error
+	fn := func() (Credentials, error) {
+		n++
+		return Credentials{
+			User:   "user",
+			Pass:   "token" + strconv.Itoa(n),
+			Expiry: time.Now().Add(50 * time.Millisecond),
+		}, fnErr
+	}
+
+	creds, err := fn()
+	require.NoError(t, err)
+	conn := newCredsConn(stub, fn, 40*time.Millisecond, creds.Expiry)
+
+	require.NoError(t, conn.Do(Cmd(nil, "GET", "foo")))
+	assert.Empty(t, auths)
+
+	time.Sleep(15 * time.Millisecond)
+	require.NoError(t, conn.Do(Pipeline(Cmd(nil, "GET", "foo"), Cmd(nil, "GET", "bar"))))
+	assert.Equal(t, [][]string{{"user", "token2"}}, auths)
+
+	// the new Credentials don't need refreshing yet.
+	require.NoError(t, conn.Do(Cmd(nil, "GET", "foo")))
+	assert.Len(t, auths, 1)
+
+	time.Sleep(15 * time.Millisecond)
+	fnErr = errors.New("no token for you")
+	err = conn.Do(Cmd(nil, "GET", "foo"))
+	assert.Contains(t, err.Error(), "no token for you")
+	assert.Len(t, auths, 1)
+
+	// the connection is closed once re-authentication fails.
+	fnErr = nil
+	assert.Error(t, conn.Do(Cmd(nil, "GET", "foo")))
+	assert.Len(t, auths, 1)
+
+	t.Run("Subscribed", func(t *T) {
+		stub := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+			if args[0] == "AUTH" {
+				auths = append(auths, args[1:])
+			}
+			return "OK"
+		})
+		conn := newCredsConn(stub, fn, 0, time.Now())
+		require.NoError(t, conn.Encode(Cmd(nil, "SUBSCRIBE", "foo")))
+		require.NoError(t, conn.Encode(Cmd(nil, "PING")))
+		assert.Len(t, auths, 1)
+	})
+	t.Run("Pipeline", func(t *T) {
+		var auths int
+		stub := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+			if args[0] == "AUTH" {
+				auths++
+			}
+			return "OK"
+		})
+		// the Credentials always need refreshing.
+		fn := func() (Credentials, error) {
+			return Credentials{Pass: "token", Expiry: time.Now()}, nil
+		}
+		conn := newCredsConn(stub, fn, 0, time.Now())
+
+		p := Pipeline(Cmd(nil, "GET", "foo"), Cmd(nil, "GET", "bar"))
+		require.NoError(t, conn.Encode(p.(resp.Marshaler)))
+		assert.Equal(t, 1, auths)
+
+		// with only one of the pipeline's responses decoded there's still one
+		// outstanding, so the connection mustn't be re-authenticated yet.
+		require.NoError(t, conn.Decode(&resp2.Any{}))
+		require.NoError(t, conn.Encode(Cmd(nil, "GET", "baz")))
+		assert.Equal(t, 1, auths)
+
+		require.NoError(t, conn.Decode(&resp2.Any{}))
+		require.NoError(t, conn.Decode(&resp2.Any{}))
+		require.NoError(t, conn.Encode(Cmd(nil, "GET", "baz")))
+		assert.Equal(t, 2, auths)
+	})
+}
+
+func TestCredsConnMuxClient(t *T) {
+	fn := func() (Credentials, error) {
+		// the Credentials always need refreshing.
+		return Credentials{Pass: "token", Expiry: time.Now()}, nil
+	}
+	connFunc := func(network, addr string) (Conn, error) {
+		stub := Stub(network, addr, func(args []string) interface{} {
+			if args[0] == "AUTH" {
+				return "OK"
+			}
+			return args[1]
+		})
+		return newCredsConn(stub, fn, 0, time.Now()), nil
+	}
+
+	m, err := NewMuxClient("tcp", "127.0.0.1:6379", MuxClientConnFunc(connFunc))
+	require.NoError(t, err)
+	defer m.Close()
+
+	// the response to an AUTH must never be received by another command.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := strconv.Itoa(i) + "-" + strconv.Itoa(j)
+				var res string
+				assert.NoError(t, m.Do(Cmd(&res, "ECHO", key)))
+				assert.Equal(t, key, res)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,232 @@
+package radix
+
+import (
+	"sync"
+	"time"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+type dnsFailoverOpts struct {
+	pf                ClientFunc
+	verifyRoleTimeout time.Duration
+	backoff           Backoff
+}
+
+// DNSFailoverOpt is an optional behavior which can be applied to the
+// NewDNSFailover function to effect a DNSFailover's behavior.
+type DNSFailoverOpt func(*dnsFailoverOpts)
+
+// DNSFailoverPoolFunc tells the DNSFailover to use the given ClientFunc when
+// creating the Client to the endpoint.
+func DNSFailoverPoolFunc(pf ClientFunc) DNSFailoverOpt {
+	return func(do *dnsFailoverOpts) {
+		do.pf = pf
+	}
+}
+
+// DNSFailoverVerifyRole tells the DNSFailover to check, using ROLE, that the
+// endpoint has become a primary before resuming writes after a failover. The
+// DNS record of the endpoint may take some time to be updated, and until it is
+// new Clients will keep connecting to the old primary, which is now a replica.
+// New Clients are created, using DNSFailoverBackoff in between, until the
+// endpoint is a primary or the timeout elapses, at which point the failover
+// is abandoned and the next READONLY error will start another.
+func DNSFailoverVerifyRole(timeout time.Duration) DNSFailoverOpt {
+	return func(do *dnsFailoverOpts) {
+		do.verifyRoleTimeout = timeout
+	}
+}
+
+// DNSFailoverBackoff sets the Backoff used to determine how long to wait
+// between attempts at verifying the role of the endpoint, see
+// DNSFailoverVerifyRole.
+func DNSFailoverBackoff(b Backoff) DNSFailoverOpt {
+	return func(do *dnsFailoverOpts) {
+		do.backoff = b
+	}
+}
+
+// DNSFailover is a Client for a primary endpoint whose DNS record is updated to
+// point at the new primary when a failover happens, as is the case for the
+// primary endpoint of an AWS ElastiCache replication group with cluster mode
+// disabled.
+//
+// When such a failover happens the existing connections remain connected to
+// the old primary, which is demoted to a replica, and writes on them fail with
+// READONLY errors. DNSFailover detects these errors, and replaces its Client
+// with a new one, which re-resolves the endpoint's address as it creates its
+// connections. The write which failed is then retried on the new Client, if it
+// was created by Cmd, FlatCmd or EvalScript.Cmd, otherwise the READONLY error
+// is returned.
+type DNSFailover struct {
+	do   dnsFailoverOpts
+	addr string
+
+	// l protects client and closed. It's write-locked for the entire duration
+	// of a failover, so that Actions wait for it to complete rather than
+	// being performed on the old primary.
+	l      sync.RWMutex
+	client Client
+	closed bool
+
+	// Any errors encountered internally will be written to this channel. If
+	// nothing is reading the channel the errors will be dropped. The channel
+	// will be closed when the Close method is called.
+	ErrCh chan error
+}
+
+var _ Client = new(DNSFailover)
+
+// NewDNSFailover initializes and returns a DNSFailover for the given endpoint
+// address.
+//
+// NewDNSFailover takes in a number of options which can overwrite its default
+// behavior. The default options NewDNSFailover uses are:
+//
+//	DNSFailoverPoolFunc(DefaultClientFunc)
+//	DNSFailoverBackoff(ExponentialBackoff(100 * time.Millisecond, 2 * time.Second, 0.5))
+//
+func NewDNSFailover(addr string, opts ...DNSFailoverOpt) (*DNSFailover, error) {
+	df := &DNSFailover{
+		addr:  addr,
+		ErrCh: make(chan error, 1),
+	}
+
+	defaultDNSFailoverOpts := []DNSFailoverOpt{
+		DNSFailoverPoolFunc(DefaultClientFunc),
+		DNSFailoverBackoff(ExponentialBackoff(100*time.Millisecond, 2*time.Second, 0.5)),
+	}
+	for _, opt := range append(defaultDNSFailoverOpts, opts...) {
+		if opt != nil {
+			opt(&(df.do))
+		}
+	}
+
+	var err error
+	if df.client, err = df.do.pf("tcp", addr); err != nil {
+		return nil, err
+	}
+	return df, nil
+}
+
+func (df *DNSFailover) err(err error) {
+	select {
+	case df.ErrCh <- err:
+	default:
+	}
+}
+
+func isReadOnlyErr(err error) bool {
+	var respErr resp2.Error
+	return errors.As(err, &respErr) && respErr.Kind() == resp2.ErrorKindReadOnly
+}
+
+// Do implements the method for the Client interface.
+func (df *DNSFailover) Do(a Action) error {
+	df.l.RLock()
+	if df.closed {
+		df.l.RUnlock()
+		return ErrClientClosed
+	}
+	client := df.client
+	df.l.RUnlock()
+
+	err := client.Do(a)
+	if !isReadOnlyErr(err) {
+		return err
+	} else if !df.failover(client) {
+		return err
+	} else if !canClusterRetry(a) {
+		return err
+	}
+
+	df.l.RLock()
+	client = df.client
+	df.l.RUnlock()
+	return client.Do(a)
+}
+
+// failover replaces the given Client, which returned a READONLY error, with a
+// new one, returning whether it succeeded. If the Client has already been
+// replaced by a concurrent call then nothing is done.
+func (df *DNSFailover) failover(prev Client) bool {
+	df.l.Lock()
+	defer df.l.Unlock()
+	if df.closed {
+		return false
+	} else if df.client != prev {
+		return true
+	}
+
+	client, err := df.newPrimaryClient()
+	if err != nil {
+		df.err(errors.Errorf("failing over to %q: %w", df.addr, err))
+		return false
+	}
+	df.client = client
+	prev.Close()
+	return true
+}
+
+// newPrimaryClient creates a new Client to the endpoint, verifying that it's
+// connected to a primary if DNSFailoverVerifyRole is used.
+func (df *DNSFailover) newPrimaryClient() (Client, error) {
+	var deadline time.Time
+	if df.do.verifyRoleTimeout > 0 {
+		deadline = time.Now().Add(df.do.verifyRoleTimeout)
+	}
+
+	for attempts := 1; ; attempts++ {
+		client, err := df.do.pf("tcp", df.addr)
+		if err == nil && deadline.IsZero() {
+			return client, nil
+		} else if err == nil {
+			var primary bool
+			if primary, err = isPrimary(client); err == nil && primary {
+				return client, nil
+			} else if err == nil {
+				err = errors.New("endpoint is not yet a primary")
+			}
+			client.Close()
+		}
+
+		wait := df.do.backoff.Next(attempts)
+		if deadline.IsZero() || time.Now().Add(wait).After(deadline) {
+			return nil, err
+		}
+		time.Sleep(wait)
+	}
+}
+
+// isPrimary returns whether the Client is connected to a primary, using ROLE.
+func isPrimary(client Client) (bool, error) {
+	var role []interface{}
+	if err := client.Do(Cmd(&role, "ROLE")); err != nil {
+		return false, err
+	} else if len(role) == 0 {
+		return false, errors.New("empty ROLE response")
+	}
+	switch r := role[0].(type) {
+	case string:
+		return r == "master", nil
+	case []byte:
+		return string(r) == "master", nil
+	default:
+		return false, errors.Errorf("unexpected ROLE response %#v", role)
+	}
+}
+
+// Close implements the method for the Client interface.
+func (df *DNSFailover) Close() error {
+	df.l.Lock()
+	defer df.l.Unlock()
+	if df.closed {
+		return ErrClientClosed
+	}
+	df.closed = true
+	close(df.ErrCh)
+	return df.client.Close()
+}
@@ -0,0 +1,85 @@
+package radix
+
+import (
+	"sync"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+func TestDNSFailover(t *T) {
+	roleStub := func(role string) Conn {
+		return Stub("tcp", "primary.example.com:6379", func(args []string) interface{} {
+			switch {
+			case args[0] == "ROLE":
+				return []interface{}{role, 0, []string{}}
+			case args[0] == "SET" && role != "master":
+				return resp2.Error{E: errors.New("READONLY You can't write against a read only replica.")}
+			}
+			return "OK"
+		})
+	}
+
+	// the endpoint starts off pointing at the old primary, and takes a couple
+	// of attempts to be pointed at the new one.
+	var l sync.Mutex
+	roles := []string{"slave", "slave", "slave", "master"}
+	pf := func(network, addr string) (Client, error) {
+		l.Lock()
+		defer l.Unlock()
+		role := roles[0]
+		if len(roles) > 1 {
+			roles = roles[1:]
+		}
+		return roleStub(role), nil
+	}
+
+	df, err := NewDNSFailover("primary.example.com:6379",
+		DNSFailoverPoolFunc(pf),
+		DNSFailoverVerifyRole(time.Second),
+		DNSFailoverBackoff(ConstantBackoff(time.Millisecond)),
+	)
+	require.NoError(t, err)
+	defer df.Close()
+
+	// reads work fine on the replica.
+	require.NoError(t, df.Do(Cmd(nil, "GET", "foo")))
+
+	// the write is retried once the endpoint has become a primary.
+	require.NoError(t, df.Do(Cmd(nil, "SET", "foo", "bar")))
+	l.Lock()
+	assert.Equal(t, []string{"master"}, roles)
+	l.Unlock()
+
+	// Actions which can't be retried get the READONLY error.
+	df.l.Lock()
+	df.client = roleStub("slave")
+	df.l.Unlock()
+	err = df.Do(WithConn("foo", func(conn Conn) error {
+		return conn.Do(Cmd(nil, "SET", "foo", "bar"))
+	}))
+	assert.True(t, isReadOnlyErr(err))
+	require.NoError(t, df.Do(Cmd(nil, "SET", "foo", "bar")))
+
+	t.Run("VerifyRoleTimeout", func(t *T) {
+		pf := func(network, addr string) (Client, error) {
+			return roleStub("slave"), nil
+		}
+		df, err := NewDNSFailover("primary.example.com:6379",
+			DNSFailoverPoolFunc(pf),
+			DNSFailoverVerifyRole(20*time.Millisecond),
+			DNSFailoverBackoff(ConstantBackoff(5*time.Millisecond)),
+		)
+		require.NoError(t, err)
+		defer df.Close()
+
+		err = df.Do(Cmd(nil, "SET", "foo", "bar"))
+		assert.True(t, isReadOnlyErr(err))
+		assert.Contains(t, (<-df.ErrCh).Error(), "not yet a primary")
+	})
+}
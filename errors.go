@@ -0,0 +1,94 @@
+package radix
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	errors "golang.org/x/xerrors"
+)
+
+// ErrClientClosed is returned from a Client's methods once Close has been
+// called on it.
+var ErrClientClosed = errors.New("client is closed")
+
+// ErrConnClosed can be matched using errors.Is against errors returned from a
+// Conn which was used after its underlying network connection was closed.
+var ErrConnClosed = errors.New("connection is closed")
+
+// ErrTimeout can be matched using errors.Is against errors returned from a
+// Conn whose underlying network connection timed out, e.g. because of the
+// DialReadTimeout or DialWriteTimeout options.
+var ErrTimeout = errors.New("i/o timeout")
+
+// ErrUnsupported can be matched using errors.Is against errors returned when
+// an Action requires a ServerFeature which the server is known not to support.
+// Such errors are always of type *UnsupportedError.
+var ErrUnsupported = errors.New("unsupported by server")
+
+// UnsupportedError is returned by Pool and Cluster in place of performing an
+// Action which requires a ServerFeature the server doesn't support, see
+// RequireFeatures.
+type UnsupportedError struct {
+	Feature ServerFeature
+	Server  ServerInfo
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s %s does not support %s", e.Server.Flavor, e.Server.Version, e.Feature)
+}
+
+// Is implements the method for the (x)errors.Is function.
+func (e *UnsupportedError) Is(target error) bool {
+	return target == ErrUnsupported
+}
+
+// netErrorCause replaces the Err field of a *net.OpError returned from a Conn,
+// so that the error can be matched against ErrTimeout and ErrConnClosed while
+// remaining a *net.OpError. The original cause can be retrieved using
+// errors.As or errors.Is.
+type netErrorCause struct {
+	err                error
+	timeout, temporary bool
+}
+
+// wrapNetErr returns a copy of err with its cause wrapped in a netErrorCause
+// if it's a *net.OpError, otherwise err is returned as-is.
+func wrapNetErr(err error) error {
+	opErr, ok := err.(*net.OpError)
+	if !ok {
+		return err
+	} else if _, ok := opErr.Err.(netErrorCause); ok {
+		return err
+	}
+	wrapped := *opErr
+	wrapped.Err = netErrorCause{
+		err:       opErr.Err,
+		timeout:   opErr.Timeout(),
+		temporary: opErr.Temporary(),
+	}
+	return &wrapped
+}
+
+func (e netErrorCause) Error() string   { return e.err.Error() }
+func (e netErrorCause) Timeout() bool   { return e.timeout }
+func (e netErrorCause) Temporary() bool { return e.temporary }
+
+// Unwrap implements the errors.Wrapper interface.
+func (e netErrorCause) Unwrap() error {
+	return e.err
+}
+
+// Is implements the method for the (x)errors.Is function.
+func (e netErrorCause) Is(target error) bool {
+	switch target {
+	case ErrTimeout:
+		return e.timeout
+	case ErrConnClosed:
+		// net.ErrClosed was only introduced in go 1.16, prior to that checking
+		// the message was the only way to do this.
+		return strings.Contains(e.err.Error(), "use of closed network connection")
+	default:
+		return false
+	}
+}
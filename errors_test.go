@@ -0,0 +1,27 @@
+package radix
+
+import (
+	"net"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+)
+
+func TestNetErrorIs(t *T) {
+	conn := Stub("tcp", "127.0.0.1:6379", func([]string) interface{} { return nil })
+
+	require.NoError(t, conn.NetConn().SetReadDeadline(time.Now().Add(-time.Second)))
+	err := conn.Decode(nil)
+	assert.True(t, errors.Is(err, ErrTimeout))
+	assert.False(t, errors.Is(err, ErrConnClosed))
+	assert.True(t, err.(net.Error).Timeout())
+	assert.IsType(t, (*net.OpError)(nil), err)
+
+	require.NoError(t, conn.Close())
+	err = conn.Encode(Cmd(nil, "PING"))
+	assert.True(t, errors.Is(err, ErrConnClosed))
+	assert.False(t, errors.Is(err, ErrTimeout))
+}
@@ -0,0 +1,173 @@
+package radix
+
+import (
+	"strconv"
+	"time"
+)
+
+// FeatureAction is an Action which requires the server to support certain
+// ServerFeatures. Pool and Cluster check these against their ServerInfo before
+// performing the Action, and return an *UnsupportedError if the server is
+// known not to support any of them.
+type FeatureAction interface {
+	Action
+	Features() []ServerFeature
+}
+
+func actionFeatures(a Action) []ServerFeature {
+	for {
+		if fa, ok := a.(FeatureAction); ok {
+			return fa.Features()
+		} else if wa, ok := a.(wrappedAction); ok {
+			a = wa.unwrapAction()
+		} else {
+			return nil
+		}
+	}
+}
+
+type featureAction struct {
+	Action
+	features []ServerFeature
+}
+
+func (fa featureAction) unwrapAction() Action {
+	return fa.Action
+}
+
+func (fa featureAction) Features() []ServerFeature {
+	return fa.features
+}
+
+func (fa featureAction) ReadOnly() bool {
+	return isReadOnly(fa.Action)
+}
+
+func (fa featureAction) ClusterCanRetry() bool {
+	return canClusterRetry(fa.Action)
+}
+
+type featureCmdAction struct {
+	CmdAction
+	features []ServerFeature
+}
+
+func (fa featureCmdAction) unwrapAction() Action {
+	return fa.CmdAction
+}
+
+func (fa featureCmdAction) Features() []ServerFeature {
+	return fa.features
+}
+
+func (fa featureCmdAction) ReadOnly() bool {
+	return isReadOnly(fa.CmdAction)
+}
+
+func (fa featureCmdAction) ClusterCanRetry() bool {
+	return canClusterRetry(fa.CmdAction)
+}
+
+func (fa featureCmdAction) ReceiveAttributes(attrs map[string]interface{}) {
+	receiveAttributes(fa.CmdAction, attrs)
+}
+
+// RequireFeatures wraps the given Action such that it implements
+// FeatureAction, with its Features method returning the given ServerFeatures.
+// The Action is otherwise performed as normal.
+//
+// If the given Action is a CmdAction then the returned Action will be as well.
+// NOTE that, as with any custom CmdAction, a Pool will not implicitly pipeline
+// the returned Action.
+func RequireFeatures(a Action, fs ...ServerFeature) Action {
+	if cmdA, ok := a.(CmdAction); ok {
+		return featureCmdAction{CmdAction: cmdA, features: fs}
+	}
+	return featureAction{Action: a, features: fs}
+}
+
+func requireFeatureCmd(f ServerFeature, rcv interface{}, cmd string, args ...string) CmdAction {
+	return featureCmdAction{CmdAction: Cmd(rcv, cmd, args...), features: []ServerFeature{f}}
+}
+
+// GetExOpts are the optional arguments to GetEx. At most one of its fields
+// may be set.
+type GetExOpts struct {
+	// TTL, if non-zero, sets the key to expire after the given duration.
+	TTL time.Duration
+
+	// ExpireAt, if non-zero, sets the key to expire at the given time.
+	ExpireAt time.Time
+
+	// Persist removes any expiration the key has.
+	Persist bool
+}
+
+// GetEx returns a CmdAction which performs GETEX, unmarshaling the value of
+// key into rcv while optionally changing its expiration.
+//
+// GETEX requires FeatureGetEx (redis 6.2 or later).
+func GetEx(rcv interface{}, key string, opts GetExOpts) CmdAction {
+	args := []string{key}
+	switch {
+	case opts.TTL != 0:
+		args = append(args, "PX", strconv.FormatInt(opts.TTL.Milliseconds(), 10))
+	case !opts.ExpireAt.IsZero():
+		ms := opts.ExpireAt.UnixNano() / int64(time.Millisecond)
+		args = append(args, "PXAT", strconv.FormatInt(ms, 10))
+	case opts.Persist:
+		args = append(args, "PERSIST")
+	}
+	return requireFeatureCmd(FeatureGetEx, rcv, "GETEX", args...)
+}
+
+// ObjectFreq returns a CmdAction which performs OBJECT FREQ, unmarshaling the
+// access frequency of the value at key into rcv. The server must be using an
+// LFU maxmemory-policy, otherwise it will return an error.
+//
+// OBJECT FREQ requires FeatureObjectFreq (redis 4.0 or later).
+func ObjectFreq(rcv *int64, key string) CmdAction {
+	return requireFeatureCmd(FeatureObjectFreq, rcv, "OBJECT", "FREQ", key)
+}
+
+// FunctionLoad returns a CmdAction which performs FUNCTION LOAD with the given
+// library code, unmarshaling the name of the loaded library into rcv. If
+// replace is true then an existing library of the same name is replaced.
+//
+// FUNCTION LOAD requires FeatureFunctions (redis 7 or later).
+func FunctionLoad(rcv *string, code string, replace bool) CmdAction {
+	if replace {
+		return requireFeatureCmd(FeatureFunctions, rcv, "FUNCTION", "LOAD", "REPLACE", code)
+	}
+	return requireFeatureCmd(FeatureFunctions, rcv, "FUNCTION", "LOAD", code)
+}
+
+// FunctionDelete returns a CmdAction which performs FUNCTION DELETE, deleting
+// the library of the given name.
+//
+// FUNCTION DELETE requires FeatureFunctions (redis 7 or later).
+func FunctionDelete(library string) CmdAction {
+	return requireFeatureCmd(FeatureFunctions, nil, "FUNCTION", "DELETE", library)
+}
+
+func fcall(cmd string, rcv interface{}, fn string, keys []string, args []string) CmdAction {
+	cmdArgs := make([]string, 0, 2+len(keys)+len(args))
+	cmdArgs = append(cmdArgs, fn, strconv.Itoa(len(keys)))
+	cmdArgs = append(cmdArgs, keys...)
+	cmdArgs = append(cmdArgs, args...)
+	return requireFeatureCmd(FeatureFunctions, rcv, cmd, cmdArgs...)
+}
+
+// FCall returns a CmdAction which performs FCALL, calling the function fn with
+// the given keys and args and unmarshaling its result into rcv.
+//
+// FCALL requires FeatureFunctions (redis 7 or later).
+func FCall(rcv interface{}, fn string, keys []string, args ...string) CmdAction {
+	return fcall("FCALL", rcv, fn, keys, args)
+}
+
+// FCallRO is like FCall, but performs FCALL_RO, which may only call functions
+// flagged as no-writes and so may be performed on a replica.
+func FCallRO(rcv interface{}, fn string, keys []string, args ...string) CmdAction {
+	return ReadOnly(fcall("FCALL_RO", rcv, fn, keys, args)).(CmdAction)
+}
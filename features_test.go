@@ -0,0 +1,99 @@
+package radix
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	errors "golang.org/x/xerrors"
+)
+
+func TestFeatureCmds(t *T) {
+	type test struct {
+		a    CmdAction
+		exp  []string
+		keys []string
+		f    ServerFeature
+	}
+
+	expireAt := time.Unix(1700000000, 0)
+	tests := []test{
+		{
+			a:    GetEx(nil, "foo", GetExOpts{}),
+			exp:  []string{"GETEX", "foo"},
+			keys: []string{"foo"},
+			f:    FeatureGetEx,
+		},
+		{
+			a:    GetEx(nil, "foo", GetExOpts{TTL: 2 * time.Second}),
+			exp:  []string{"GETEX", "foo", "PX", "2000"},
+			keys: []string{"foo"},
+			f:    FeatureGetEx,
+		},
+		{
+			a:    GetEx(nil, "foo", GetExOpts{ExpireAt: expireAt}),
+			exp:  []string{"GETEX", "foo", "PXAT", "1700000000000"},
+			keys: []string{"foo"},
+			f:    FeatureGetEx,
+		},
+		{
+			a:    ObjectFreq(nil, "foo"),
+			exp:  []string{"OBJECT", "FREQ", "foo"},
+			keys: []string{"foo"},
+			f:    FeatureObjectFreq,
+		},
+		{
+			a:   FunctionLoad(nil, "#!lua name=lib", true),
+			exp: []string{"FUNCTION", "LOAD", "REPLACE", "#!lua name=lib"},
+			f:   FeatureFunctions,
+		},
+		{
+			a:    FCall(nil, "fn", []string{"a", "b"}, "1"),
+			exp:  []string{"FCALL", "fn", "2", "a", "b", "1"},
+			keys: []string{"a", "b"},
+			f:    FeatureFunctions,
+		},
+		{
+			a:    FCallRO(nil, "fn", []string{"a"}),
+			exp:  []string{"FCALL_RO", "fn", "1", "a"},
+			keys: []string{"a"},
+			f:    FeatureFunctions,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.exp[0], func(t *T) {
+			var args []string
+			stub := Stub("tcp", "127.0.0.1:6379", func(a []string) interface{} {
+				args = a
+				return nil
+			})
+			assert.NoError(t, stub.Do(test.a))
+			assert.Equal(t, test.exp, args)
+			assert.Equal(t, test.keys, test.a.Keys())
+			assert.Equal(t, []ServerFeature{test.f}, actionFeatures(test.a))
+		})
+	}
+
+	assert.True(t, isReadOnly(FCallRO(nil, "fn", nil)))
+}
+
+func TestRequireFeatures(t *T) {
+	a := RequireFeatures(Cmd(nil, "PING"), FeatureRESP3)
+	_, isCmd := a.(CmdAction)
+	assert.True(t, isCmd)
+	assert.Equal(t, []ServerFeature{FeatureRESP3}, actionFeatures(WithPriority(a, PriorityHigh)))
+	assert.Nil(t, actionFeatures(Cmd(nil, "PING")))
+
+	scl := newStubCluster(testTopo)
+	c := scl.newCluster()
+	defer c.Close()
+
+	assert.NoError(t, c.Do(RequireFeatures(Cmd(nil, "PING"), FeatureShardedPubSub)))
+	err := c.Do(RequireFeatures(Cmd(nil, "PING"), ModuleFeature("search")))
+	assert.True(t, errors.Is(err, ErrUnsupported))
+
+	si, err := c.ServerInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, ServerInfo{Flavor: ServerFlavorRedis, Version: "7.2.4", RedisVersion: "7.2.4", Mode: "cluster"}, si)
+}
@@ -0,0 +1,263 @@
+package radix
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type fireAndForgetOpts struct {
+	cf         ConnFunc
+	queueSize  int
+	batchSize  int
+	retryAfter time.Duration
+	errCh      chan<- error
+}
+
+// FireAndForgetOpt is an optional behavior which can be applied to the
+// NewFireAndForget function to effect a FireAndForget's behavior.
+type FireAndForgetOpt func(*fireAndForgetOpts)
+
+// FireAndForgetConnFunc tells the FireAndForget to use the given ConnFunc when
+// creating its connection.
+func FireAndForgetConnFunc(cf ConnFunc) FireAndForgetOpt {
+	return func(opts *fireAndForgetOpts) {
+		opts.cf = cf
+	}
+}
+
+// FireAndForgetQueueSize sets the number of CmdActions which may be queued
+// waiting to be written. CmdActions given to Send while the queue is full are
+// dropped.
+func FireAndForgetQueueSize(size int) FireAndForgetOpt {
+	return func(opts *fireAndForgetOpts) {
+		opts.queueSize = size
+	}
+}
+
+// FireAndForgetBatchSize sets the maximum number of queued CmdActions which are
+// written to the connection in a single write.
+func FireAndForgetBatchSize(size int) FireAndForgetOpt {
+	return func(opts *fireAndForgetOpts) {
+		opts.batchSize = size
+	}
+}
+
+// FireAndForgetRetryAfter sets how long the FireAndForget waits after failing
+// to reconnect before trying again. CmdActions sent in the meantime are queued
+// as normal, and dropped if the queue fills up.
+func FireAndForgetRetryAfter(d time.Duration) FireAndForgetOpt {
+	return func(opts *fireAndForgetOpts) {
+		opts.retryAfter = d
+	}
+}
+
+// FireAndForgetErrCh takes a channel which asynchronous errors encountered by
+// the FireAndForget, e.g. while writing or reconnecting, can be read off of. If
+// the channel blocks the error will be dropped. The channel will be closed
+// when the FireAndForget is closed.
+func FireAndForgetErrCh(errCh chan<- error) FireAndForgetOpt {
+	return func(opts *fireAndForgetOpts) {
+		opts.errCh = errCh
+	}
+}
+
+// FireAndForgetStats are counters describing the CmdActions given to a
+// FireAndForget, see its Stats method.
+type FireAndForgetStats struct {
+	// Sent is the number of CmdActions written to the connection.
+	Sent uint64
+
+	// Dropped is the number of CmdActions which were dropped because the
+	// queue was full.
+	Dropped uint64
+
+	// Failed is the number of CmdActions which were dropped because they
+	// couldn't be written to the connection.
+	Failed uint64
+}
+
+// FireAndForget performs CmdActions on a dedicated connection which has had
+// CLIENT REPLY OFF performed on it, so that the server never replies and the
+// caller never waits on a round-trip. It's intended for non-critical writes,
+// e.g. incrementing metrics counters, where the latency of waiting on a
+// response, or on a connection from a busy Pool, isn't worth paying.
+//
+// CmdActions are queued and written in batches by a background go-routine.
+// Since no replies are read, any values a CmdAction would unmarshal into its
+// receiver are lost, as are any errors the server returns.
+//
+// NOTE that CLIENT REPLY requires redis 3.2 or later, and isn't supported by
+// most proxies.
+type FireAndForget struct {
+	// Atomic fields must be at the beginning of the struct since they must be
+	// correctly aligned or else access may cause panics on 32-bit architectures
+	// See https://golang.org/pkg/sync/atomic/#pkg-note-BUG
+	sent, dropped, failed uint64 // atomic
+
+	opts          fireAndForgetOpts
+	network, addr string
+	conn          Conn
+
+	l       sync.RWMutex
+	closed  bool
+	queue   chan CmdAction
+	closeWG sync.WaitGroup
+}
+
+// NewFireAndForget creates a FireAndForget which will perform CmdActions on
+// the redis instance at the given address. The connection is created
+// synchronously, and if it fails the error is returned.
+//
+// NewFireAndForget takes in a number of options which can overwrite its
+// default behavior. The default options NewFireAndForget uses are:
+//
+//	FireAndForgetConnFunc(DefaultConnFunc)
+//	FireAndForgetQueueSize(1024)
+//	FireAndForgetBatchSize(128)
+//	FireAndForgetRetryAfter(1 * time.Second)
+//
+func NewFireAndForget(network, addr string, opts ...FireAndForgetOpt) (*FireAndForget, error) {
+	f := &FireAndForget{network: network, addr: addr}
+	defaultFireAndForgetOpts := []FireAndForgetOpt{
+		FireAndForgetConnFunc(DefaultConnFunc),
+		FireAndForgetQueueSize(1024),
+		FireAndForgetBatchSize(128),
+		FireAndForgetRetryAfter(1 * time.Second),
+	}
+	for _, opt := range append(defaultFireAndForgetOpts, opts...) {
+		opt(&f.opts)
+	}
+
+	conn, err := f.dial()
+	if err != nil {
+		return nil, err
+	}
+	f.conn = conn
+	f.queue = make(chan CmdAction, f.opts.queueSize)
+
+	f.closeWG.Add(1)
+	go func() {
+		defer f.closeWG.Done()
+		f.spin()
+	}()
+	return f, nil
+}
+
+func (f *FireAndForget) dial() (Conn, error) {
+	conn, err := f.opts.cf(f.network, f.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// CLIENT REPLY OFF itself doesn't get a reply, so there's nothing to read.
+	if err := conn.Encode(Cmd(nil, "CLIENT", "REPLY", "OFF")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (f *FireAndForget) err(err error) {
+	select {
+	case f.opts.errCh <- err:
+	default:
+	}
+}
+
+// Send queues the given CmdAction to be written to the FireAndForget's
+// connection, and returns immediately. If the queue is full, or the
+// FireAndForget has been closed, the CmdAction is dropped and false is
+// returned.
+func (f *FireAndForget) Send(a CmdAction) bool {
+	f.l.RLock()
+	defer f.l.RUnlock()
+	if f.closed {
+		atomic.AddUint64(&f.dropped, 1)
+		return false
+	}
+
+	select {
+	case f.queue <- a:
+		return true
+	default:
+		atomic.AddUint64(&f.dropped, 1)
+		return false
+	}
+}
+
+// Stats returns the FireAndForgetStats accumulated since the FireAndForget was
+// created.
+func (f *FireAndForget) Stats() FireAndForgetStats {
+	return FireAndForgetStats{
+		Sent:    atomic.LoadUint64(&f.sent),
+		Dropped: atomic.LoadUint64(&f.dropped),
+		Failed:  atomic.LoadUint64(&f.failed),
+	}
+}
+
+func (f *FireAndForget) spin() {
+	batch := make(pipeline, 0, f.opts.batchSize)
+	for a := range f.queue {
+		batch = append(batch[:0], a)
+	fill:
+		for len(batch) < f.opts.batchSize {
+			select {
+			case a, ok := <-f.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, a)
+			default:
+				break fill
+			}
+		}
+		f.write(batch)
+	}
+	if f.conn != nil {
+		f.conn.Close()
+	}
+}
+
+// write writes the batch to the connection, reconnecting first if a previous
+// write failed. If the batch can't be written it's dropped.
+func (f *FireAndForget) write(batch pipeline) {
+	if f.conn == nil {
+		conn, err := f.dial()
+		if err != nil {
+			atomic.AddUint64(&f.failed, uint64(len(batch)))
+			f.err(err)
+			time.Sleep(f.opts.retryAfter)
+			return
+		}
+		f.conn = conn
+	}
+
+	if err := f.conn.Encode(batch); err != nil {
+		atomic.AddUint64(&f.failed, uint64(len(batch)))
+		f.err(err)
+		f.conn.Close()
+		f.conn = nil
+		return
+	}
+	atomic.AddUint64(&f.sent, uint64(len(batch)))
+}
+
+// Close stops the FireAndForget from accepting new CmdActions, waits for those
+// already queued to be written, and closes its connection.
+func (f *FireAndForget) Close() error {
+	f.l.Lock()
+	if f.closed {
+		f.l.Unlock()
+		return ErrClientClosed
+	}
+	f.closed = true
+	close(f.queue)
+	f.l.Unlock()
+
+	f.closeWG.Wait()
+	if f.opts.errCh != nil {
+		close(f.opts.errCh)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package radix
+
+import (
+	"sync"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp"
+)
+
+type hookEncodeConn struct {
+	Conn
+	hook func() error
+}
+
+func (hc *hookEncodeConn) Encode(m resp.Marshaler) error {
+	if err := hc.hook(); err != nil {
+		return err
+	}
+	return hc.Conn.Encode(m)
+}
+
+func TestFireAndForget(t *T) {
+	var l sync.Mutex
+	var cmds [][]string
+	var dials int
+	blockedCh, releaseCh := make(chan struct{}), make(chan struct{})
+	connFn := func(network, addr string) (Conn, error) {
+		dials++
+		var encodes int
+		firstConn := dials == 1
+		return &hookEncodeConn{
+			Conn: Stub(network, addr, func(args []string) interface{} {
+				l.Lock()
+				defer l.Unlock()
+				cmds = append(cmds, args)
+				return nil
+			}),
+			// the first connection blocks on its first write after CLIENT
+			// REPLY OFF, and then fails it
+			hook: func() error {
+				if encodes++; firstConn && encodes == 2 {
+					blockedCh <- struct{}{}
+					<-releaseCh
+					return errors.New("write failed")
+				}
+				return nil
+			},
+		}, nil
+	}
+
+	errCh := make(chan error, 1)
+	f, err := NewFireAndForget("tcp", "127.0.0.1:6379",
+		FireAndForgetConnFunc(connFn),
+		FireAndForgetQueueSize(2),
+		FireAndForgetErrCh(errCh),
+	)
+	require.NoError(t, err)
+
+	require.True(t, f.Send(Cmd(nil, "INCR", "a")))
+	<-blockedCh
+	assert.True(t, f.Send(Cmd(nil, "INCR", "b")))
+	assert.True(t, f.Send(Cmd(nil, "INCR", "b")))
+	assert.False(t, f.Send(Cmd(nil, "INCR", "c")))
+	close(releaseCh)
+
+	// the first write fails, at which point the FireAndForget reconnects and
+	// writes the following CmdActions on the new connection.
+	assert.Error(t, <-errCh)
+	require.NoError(t, f.Close())
+	assert.False(t, f.Send(Cmd(nil, "INCR", "d")))
+
+	assert.Equal(t, FireAndForgetStats{Sent: 2, Dropped: 2, Failed: 1}, f.Stats())
+	assert.Equal(t, 2, dials)
+	assert.Equal(t, [][]string{
+		{"CLIENT", "REPLY", "OFF"},
+		{"CLIENT", "REPLY", "OFF"},
+		{"INCR", "b"},
+		{"INCR", "b"},
+	}, cmds)
+}
@@ -0,0 +1,299 @@
+package radix
+
+import (
+	"bufio"
+	"math"
+	"strconv"
+
+	errors "golang.org/x/xerrors"
+)
+
+// The constants redis uses when computing distances between coordinates, and
+// the latitude limit of its geohashes.
+const (
+	geoEarthRadius = 6372797.560856
+	geoLatLimit    = 85.05112878
+)
+
+// geoUnitMeters are the number of meters in each of the units redis accepts.
+var geoUnitMeters = map[string]float64{
+	"m":  1,
+	"km": 1000,
+	"mi": 1609.34,
+	"ft": 0.3048,
+}
+
+// GeoSearchQuery describes the area searched by GeoSearchStream. It
+// corresponds to the arguments of GEOSEARCH.
+type GeoSearchQuery struct {
+	// FromMember, if set, is the member whose position the area is centered
+	// on. Otherwise Longitude and Latitude are used.
+	FromMember          string
+	Longitude, Latitude float64
+
+	// Radius, if non-zero, searches a circular area with the given radius.
+	// Otherwise a rectangular area of the given Width and Height is searched.
+	Radius        float64
+	Width, Height float64
+
+	// Unit is the unit Radius, Width and Height are given in, and which the
+	// Dist of each GeoSearchMember is returned in. It may be "m", "km", "mi" or
+	// "ft". The default, if Unit is empty, is "m".
+	Unit string
+}
+
+// GeoSearchMember is a member of a geospatial index found by GeoSearchStream.
+type GeoSearchMember struct {
+	Name                string
+	Longitude, Latitude float64
+
+	// Dist is the member's distance from the center of the searched area, in
+	// the query's Unit.
+	Dist float64
+}
+
+// geoSearchMember unmarshals a single member of a GEOSEARCH reply made using
+// WITHCOORD.
+type geoSearchMember struct {
+	GeoSearchMember
+}
+
+func (m *geoSearchMember) UnmarshalRESP(br *bufio.Reader) error {
+	var coord []string
+	if err := (Tuple{&m.Name, &coord}).UnmarshalRESP(br); err != nil {
+		return err
+	} else if len(coord) != 2 {
+		return errors.Errorf("expected coordinate pair for %q, got %d elements", m.Name, len(coord))
+	}
+
+	var err error
+	if m.Longitude, err = strconv.ParseFloat(coord[0], 64); err != nil {
+		return errors.Errorf("parsing longitude of %q: %w", m.Name, err)
+	} else if m.Latitude, err = strconv.ParseFloat(coord[1], 64); err != nil {
+		return errors.Errorf("parsing latitude of %q: %w", m.Name, err)
+	}
+	return nil
+}
+
+// GeoSearchStreamOpts are optional parameters to GeoSearchStream.
+type GeoSearchStreamOpts struct {
+	// MaxPerQuery is the maximum number of members a single GEOSEARCH will
+	// return. The default, if MaxPerQuery is 0, is 1000.
+	MaxPerQuery int
+}
+
+// geoTile is a rectangular area, in degrees, which is searched by a single
+// GEOSEARCH. Members are considered to be within a tile if they're within the
+// half-open ranges [minLon, maxLon) and [minLat, maxLat), so that members on
+// the boundary between two tiles are only found in one of them.
+type geoTile struct {
+	minLon, minLat, maxLon, maxLat float64
+}
+
+// geoMinTileSpan is the span, in degrees, of a tile below which it won't be
+// split any further, which is roughly the precision of a geohash. Tiles this
+// small are searched without a COUNT, as all of their members may share the
+// same position.
+const geoMinTileSpan = 1e-6
+
+// GeoSearchStream searches the geospatial index at key for members within the
+// area described by the query, calling fn with each one found. It's intended
+// for searches which may find far too many members for a single GEOSEARCH
+// reply to be reasonable, e.g. millions of them.
+//
+// Rather than performing a single GEOSEARCH, the area is split into tiles,
+// each of which is searched using GEOSEARCH BYBOX with a COUNT of
+// opts.MaxPerQuery. Tiles containing more members than that are split into
+// four smaller tiles and searched again, so no single reply contains more than
+// opts.MaxPerQuery members, and members are passed to fn as each tile is
+// searched. Members found by the GEOSEARCH of a tile are filtered to those
+// which are within the tile and the query's area, so each member is passed to
+// fn only once.
+//
+// Members are not passed to fn in any particular order. If fn returns an error
+// the search is stopped and that error is returned. Since the search is made
+// up of many GEOSEARCHes, members added or removed while it's in progress may
+// or may not be found. Members very close to the edge of the query's area may
+// be found even though GEOSEARCH wouldn't have found them, or vice-versa, due
+// to the imprecision of their encoded positions.
+//
+// GEOSEARCH requires redis 6.2 or later.
+func GeoSearchStream(c Client, key string, q GeoSearchQuery, opts GeoSearchStreamOpts, fn func(GeoSearchMember) error) error {
+	if q.Unit == "" {
+		q.Unit = "m"
+	}
+	unit, ok := geoUnitMeters[q.Unit]
+	if !ok {
+		return errors.Errorf("unknown unit %q", q.Unit)
+	} else if q.Radius <= 0 && (q.Width <= 0 || q.Height <= 0) {
+		return errors.New("either a Radius, or a Width and Height, must be given")
+	}
+	if opts.MaxPerQuery <= 0 {
+		opts.MaxPerQuery = 1000
+	}
+
+	if q.FromMember != "" {
+		var pos [][]float64
+		if err := c.Do(Cmd(&pos, "GEOPOS", key, q.FromMember)); err != nil {
+			return err
+		} else if len(pos) != 1 || len(pos[0]) != 2 {
+			return errors.Errorf("member %q not found", q.FromMember)
+		}
+		q.Longitude, q.Latitude = pos[0][0], pos[0][1]
+	}
+
+	var halfWidth, halfHeight float64
+	if q.Radius > 0 {
+		halfWidth, halfHeight = q.Radius*unit, q.Radius*unit
+	} else {
+		halfWidth, halfHeight = q.Width*unit/2, q.Height*unit/2
+	}
+
+	// contains reports whether a position is within the query's area, along
+	// with its distance from the center in meters.
+	contains := func(lon, lat float64) (float64, bool) {
+		dist := geoDistance(q.Longitude, q.Latitude, lon, lat)
+		if q.Radius > 0 {
+			return dist, dist <= halfWidth
+		}
+		if geoDistance(q.Longitude, q.Latitude, q.Longitude, lat) > halfHeight {
+			return dist, false
+		}
+		return dist, geoDistance(q.Longitude, lat, lon, lat) <= halfWidth
+	}
+
+	var members []geoSearchMember
+	tiles := geoBoundingTiles(q.Longitude, q.Latitude, halfWidth, halfHeight)
+	for len(tiles) > 0 {
+		tile := tiles[len(tiles)-1]
+		tiles = tiles[:len(tiles)-1]
+
+		splittable := tile.maxLat-tile.minLat > geoMinTileSpan
+		if err := c.Do(tile.search(&members, key, opts.MaxPerQuery, splittable)); err != nil {
+			return err
+		} else if splittable && len(members) > opts.MaxPerQuery {
+			tiles = append(tiles, tile.split()...)
+			continue
+		}
+
+		for _, m := range members {
+			if !tile.contains(m.Longitude, m.Latitude) {
+				continue
+			}
+			dist, ok := contains(m.Longitude, m.Latitude)
+			if !ok {
+				continue
+			}
+			m.Dist = dist / unit
+			if err := fn(m.GeoSearchMember); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// geoBoundingTiles returns the tiles which together cover the area around the
+// given center, splitting it into two if it crosses the antimeridian.
+func geoBoundingTiles(lon, lat, halfWidth, halfHeight float64) []geoTile {
+	// widen the area slightly, so that imprecision in the conversion to
+	// degrees doesn't exclude anything.
+	const slack = 1.01
+	dLat := geoDegrees(halfHeight*slack) + geoMinTileSpan
+	minLat := math.Max(lat-dLat, -geoLatLimit)
+	maxLat := math.Min(lat+dLat, geoLatLimit)
+
+	// a degree of longitude is shortest furthest from the equator, which is
+	// where the area spans the most of them.
+	widestLat := math.Max(math.Abs(minLat), math.Abs(maxLat))
+	cos := math.Cos(widestLat * math.Pi / 180)
+	dLon := 180.0
+	if cos > 0 {
+		dLon = geoDegrees(halfWidth*slack)/cos + geoMinTileSpan
+	}
+
+	// maxLat is exclusive for tiles, so nudge it up to include members right on
+	// the edge.
+	maxLat = math.Nextafter(maxLat, math.Inf(1))
+	if dLon >= 180 {
+		return []geoTile{{-180, minLat, 180, maxLat}}
+	}
+
+	minLon, maxLon := lon-dLon, lon+dLon
+	switch {
+	case minLon < -180:
+		return []geoTile{
+			{-180, minLat, maxLon, maxLat},
+			{minLon + 360, minLat, 180, maxLat},
+		}
+	case maxLon > 180:
+		return []geoTile{
+			{minLon, minLat, 180, maxLat},
+			{-180, minLat, maxLon - 360, maxLat},
+		}
+	default:
+		return []geoTile{{minLon, minLat, maxLon, maxLat}}
+	}
+}
+
+func (t geoTile) contains(lon, lat float64) bool {
+	// there's nothing east of 180, so it's the one inclusive boundary.
+	inLon := lon >= t.minLon && (lon < t.maxLon || (t.maxLon == 180 && lon == 180))
+	return inLon && lat >= t.minLat && lat < t.maxLat
+}
+
+func (t geoTile) split() []geoTile {
+	midLon, midLat := (t.minLon+t.maxLon)/2, (t.minLat+t.maxLat)/2
+	return []geoTile{
+		{t.minLon, t.minLat, midLon, midLat},
+		{midLon, t.minLat, t.maxLon, midLat},
+		{t.minLon, midLat, midLon, t.maxLat},
+		{midLon, midLat, t.maxLon, t.maxLat},
+	}
+}
+
+// search returns a CmdAction which performs a GEOSEARCH of a box covering the
+// tile, returning at most max+1 members if limit is true.
+func (t geoTile) search(rcv *[]geoSearchMember, key string, max int, limit bool) CmdAction {
+	lon, lat := (t.minLon+t.maxLon)/2, (t.minLat+t.maxLat)/2
+
+	// the tile is widest at whichever of its edges is closest to the equator,
+	// and boxes are widened slightly so that they cover all of the tile.
+	equatorLat := math.Min(math.Abs(t.minLat), math.Abs(t.maxLat))
+	if t.minLat < 0 && t.maxLat > 0 {
+		equatorLat = 0
+	}
+	width := geoDistance(t.minLon, equatorLat, lon, equatorLat) * 2 * 1.01
+	height := geoDistance(lon, t.minLat, lon, t.maxLat) * 1.01
+
+	args := []string{
+		key,
+		"FROMLONLAT", geoFormat(lon), geoFormat(lat),
+		"BYBOX", geoFormat(width), geoFormat(height), "m",
+		"WITHCOORD",
+	}
+	if limit {
+		args = append(args, "COUNT", strconv.Itoa(max+1), "ANY")
+	}
+	*rcv = (*rcv)[:0]
+	return Cmd(rcv, "GEOSEARCH", args...)
+}
+
+func geoFormat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// geoDegrees converts a distance along a great circle, in meters, to degrees.
+func geoDegrees(meters float64) float64 {
+	return meters / geoEarthRadius * 180 / math.Pi
+}
+
+// geoDistance returns the distance in meters between two positions, computed
+// the same way redis computes it.
+func geoDistance(lon1, lat1, lon2, lat2 float64) float64 {
+	lat1r, lat2r := lat1*math.Pi/180, lat2*math.Pi/180
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((lon2 - lon1) * math.Pi / 180 / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2 * geoEarthRadius * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,106 @@
+package radix
+
+import (
+	"math/rand"
+	"strconv"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeoSearchStream(t *T) {
+	type point struct{ lon, lat float64 }
+	points := map[string]point{}
+	for i := 0; i < 2000; i++ {
+		points["m"+strconv.Itoa(i)] = point{
+			lon: 13.4 + rand.Float64()*0.2 - 0.1,
+			lat: 52.5 + rand.Float64()*0.2 - 0.1,
+		}
+	}
+	// many members sharing a single position can't be split into tiles
+	for i := 0; i < 60; i++ {
+		points["same"+strconv.Itoa(i)] = point{lon: 13.4, lat: 52.5}
+	}
+
+	var searches int
+	stub := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		parse := func(s string) float64 {
+			f, err := strconv.ParseFloat(s, 64)
+			require.NoError(t, err)
+			return f
+		}
+		switch args[0] {
+		case "GEOPOS":
+			p, ok := points[args[2]]
+			if !ok {
+				return []interface{}{nil}
+			}
+			return [][]string{{geoFormat(p.lon), geoFormat(p.lat)}}
+		case "GEOSEARCH":
+			searches++
+			require.Equal(t, []string{"FROMLONLAT", "BYBOX", "m", "WITHCOORD"},
+				[]string{args[2], args[5], args[8], args[9]})
+			lon, lat := parse(args[3]), parse(args[4])
+			w, h := parse(args[6]), parse(args[7])
+			count := -1
+			if len(args) > 10 {
+				count, _ = strconv.Atoi(args[11])
+			}
+			res := []interface{}{}
+			for name, p := range points {
+				if len(res) == count {
+					break
+				} else if geoDistance(lon, lat, lon, p.lat) > h/2 || geoDistance(lon, p.lat, p.lon, p.lat) > w/2 {
+					continue
+				}
+				res = append(res, []interface{}{name, []string{geoFormat(p.lon), geoFormat(p.lat)}})
+			}
+			return res
+		}
+		return nil
+	})
+
+	search := func(q GeoSearchQuery) map[string]GeoSearchMember {
+		searches = 0
+		found := map[string]GeoSearchMember{}
+		err := GeoSearchStream(stub, "geo", q, GeoSearchStreamOpts{MaxPerQuery: 50}, func(m GeoSearchMember) error {
+			_, dup := found[m.Name]
+			assert.False(t, dup, "duplicate member %q", m.Name)
+			found[m.Name] = m
+			return nil
+		})
+		require.NoError(t, err)
+		require.True(t, searches > 1)
+		return found
+	}
+
+	t.Run("Radius", func(t *T) {
+		found := search(GeoSearchQuery{FromMember: "same0", Radius: 3, Unit: "km"})
+		var expected int
+		for name, p := range points {
+			dist := geoDistance(13.4, 52.5, p.lon, p.lat) / 1000
+			if dist > 3 {
+				continue
+			}
+			expected++
+			if assert.Contains(t, found, name) {
+				assert.InDelta(t, dist, found[name].Dist, 1e-9)
+			}
+		}
+		assert.Len(t, found, expected)
+	})
+
+	t.Run("Box", func(t *T) {
+		found := search(GeoSearchQuery{Longitude: 13.42, Latitude: 52.48, Width: 8000, Height: 4000})
+		var expected int
+		for name, p := range points {
+			if geoDistance(13.42, 52.48, 13.42, p.lat) > 2000 || geoDistance(13.42, p.lat, p.lon, p.lat) > 4000 {
+				continue
+			}
+			expected++
+			assert.Contains(t, found, name)
+		}
+		assert.Len(t, found, expected)
+	})
+}
@@ -0,0 +1,133 @@
+package radix
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+// hedgeSampleSize is the number of recent latencies which the hedging delay is
+// calculated from, and hedgeRecalcEvery is how often, in samples, it's
+// recalculated.
+const (
+	hedgeSampleSize  = 1000
+	hedgeRecalcEvery = 100
+)
+
+// hedger keeps track of the latencies of recent commands, and uses them to
+// decide how long to wait before sending a duplicate of a command to another
+// node.
+type hedger struct {
+	// Atomic fields must be at the beginning of the struct since they must be
+	// correctly aligned or else access may cause panics on 32-bit architectures
+	// See https://golang.org/pkg/sync/atomic/#pkg-note-BUG
+	delay int64 // atomic, time.Duration
+
+	percentile float64
+	minDelay   time.Duration
+
+	l       sync.Mutex
+	samples []time.Duration
+	next    int
+	count   int
+}
+
+func newHedger(percentile float64, minDelay time.Duration) *hedger {
+	return &hedger{
+		delay:      int64(minDelay),
+		percentile: percentile,
+		minDelay:   minDelay,
+		samples:    make([]time.Duration, 0, hedgeSampleSize),
+	}
+}
+
+func (h *hedger) getDelay() time.Duration {
+	return time.Duration(atomic.LoadInt64(&h.delay))
+}
+
+func (h *hedger) observe(d time.Duration) {
+	h.l.Lock()
+	defer h.l.Unlock()
+
+	if len(h.samples) < hedgeSampleSize {
+		h.samples = append(h.samples, d)
+	} else {
+		h.samples[h.next] = d
+		h.next = (h.next + 1) % hedgeSampleSize
+	}
+
+	if h.count++; h.count%hedgeRecalcEvery != 0 {
+		return
+	}
+
+	sorted := make([]time.Duration, len(h.samples))
+	copy(sorted, h.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	delay := sorted[int(h.percentile/100*float64(len(sorted)-1))]
+	if delay < h.minDelay {
+		delay = h.minDelay
+	}
+	atomic.StoreInt64(&h.delay, int64(delay))
+}
+
+type hedgeRes struct {
+	raw resp2.RawMessage
+	err error
+}
+
+// do performs the command on the first Client and, if it hasn't completed
+// within the hedging delay, performs a duplicate of it on the second Client.
+// Whichever replies first is unmarshaled into the command's receiver.
+//
+// Each attempt uses its own copy of the command which receives into a
+// RawMessage, so that the attempts don't race on the receiver.
+func (h *hedger) do(c *cmdAction, first, second Client) error {
+	resCh := make(chan hedgeRes, 2)
+	attempt := func(client Client) {
+		cp := new(cmdAction)
+		*cp = *c
+		var res hedgeRes
+		cp.rcv = &res.raw
+
+		start := time.Now()
+		if res.err = client.Do(cp); res.err == nil || errors.As(res.err, new(resp2.Error)) {
+			h.observe(time.Since(start))
+		}
+		resCh <- res
+	}
+
+	go attempt(first)
+
+	t := getTimer(h.getDelay())
+	defer putTimer(t)
+
+	pending := 1
+	var res hedgeRes
+	select {
+	case res = <-resCh:
+		pending--
+	case <-t.C:
+		go attempt(second)
+		pending++
+		res = <-resCh
+		pending--
+	}
+
+	// if the first result was a network error, rather than a reply from
+	// redis, give the other attempt a chance.
+	if res.err != nil && !errors.As(res.err, new(resp2.Error)) && pending > 0 {
+		if other := <-resCh; other.err == nil {
+			res = other
+		}
+	}
+
+	if res.err != nil {
+		return res.err
+	}
+	return res.raw.UnmarshalInto(resp2.Any{I: c.rcv})
+}
@@ -6,6 +6,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"math"
 	"strconv"
 	"sync"
 
@@ -56,10 +57,18 @@ func GetBytes() *[]byte {
 	return bytePool.Get().(*[]byte)
 }
 
+// MaxPooledBytes is the capacity above which byte slices given to PutBytes are
+// dropped rather than pooled, so that a few large values don't cause the pool
+// to retain large amounts of memory.
+const MaxPooledBytes = 64 * 1024
+
 // PutBytes puts the given byte slice pointer into a pool that can be accessed via GetBytes.
 //
 // After calling PutBytes the given pointer and byte slice must not be accessed anymore.
 func PutBytes(b *[]byte) {
+	if cap(*b) > MaxPooledBytes {
+		return
+	}
 	*b = (*b)[:0]
 	bytePool.Put(b)
 }
@@ -84,7 +93,12 @@ func ParseInt(b []byte) (int64, error) {
 	}
 
 	if neg {
+		if n > 1<<63 {
+			return 0, errors.Errorf("-%d overflows int64 in parseInt", n)
+		}
 		return -int64(n), nil
+	} else if n > 1<<63-1 {
+		return 0, errors.Errorf("%d overflows int64 in parseInt", n)
 	}
 
 	return int64(n), nil
@@ -105,8 +119,12 @@ func ParseUint(b []byte) (uint64, error) {
 			return 0, errors.Errorf("invalid character %c at position %d in parseUint", c, i)
 		}
 
+		d := uint64(c - '0')
+		if n > (math.MaxUint64-d)/10 {
+			return 0, errors.Errorf("%s overflows uint64 in parseUint", b)
+		}
 		n *= 10
-		n += uint64(c - '0')
+		n += d
 	}
 
 	return n, nil
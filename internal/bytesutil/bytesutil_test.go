@@ -5,6 +5,7 @@ import (
 	"bytes"
 	crand "crypto/rand"
 	"io"
+	"math"
 	"math/rand"
 	. "testing"
 	"time"
@@ -77,3 +78,37 @@ func TestReadNDiscard(t *T) {
 	// edge cases
 	assert(testT{n: 0, discarder: true})
 }
+
+func TestPutBytesMaxPooled(t *T) {
+	// large slices should be dropped rather than being pooled. sync.Pool makes
+	// no guarantees, so all that can be checked is that a large slice is never
+	// returned.
+	for i := 0; i < 100; i++ {
+		b := make([]byte, 0, MaxPooledBytes+1)
+		PutBytes(&b)
+		got := GetBytes()
+		assert.True(t, cap(*got) <= MaxPooledBytes)
+		PutBytes(got)
+	}
+}
+
+func TestParseIntOverflow(t *T) {
+	i, err := ParseInt([]byte("9223372036854775807"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(math.MaxInt64), i)
+
+	i, err = ParseInt([]byte("-9223372036854775808"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(math.MinInt64), i)
+
+	ui, err := ParseUint([]byte("18446744073709551615"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(math.MaxUint64), ui)
+
+	for _, str := range []string{"9223372036854775808", "-9223372036854775809", "99999999999999999999"} {
+		_, err = ParseInt([]byte(str))
+		assert.Error(t, err, str)
+	}
+	_, err = ParseUint([]byte("18446744073709551616"))
+	assert.Error(t, err)
+}
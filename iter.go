@@ -0,0 +1,131 @@
+//go:build go1.23
+// +build go1.23
+
+package radix
+
+import (
+	"context"
+	"iter"
+)
+
+// This file contains iterator functions, for use with range-over-func, which
+// wrap the Scanner, StreamReader and PubSubConn types. All of them stop once
+// the given Context is canceled, in which case the Context's error is yielded
+// as the final element. Iterators require go1.23 or later.
+
+// ScanIter returns an iterator over the keys returned by the given Scanner,
+// e.g.
+//
+//	for key, err := range radix.ScanIter(ctx, radix.NewScanner(client, radix.ScanAllKeys)) {
+//		if err != nil {
+//			// handle error
+//		}
+//		// do something with key
+//	}
+//
+// The Scanner is closed once iteration ends, whether it has been exhausted or
+// not. If closing it returns an error then that error is yielded with an empty
+// key as the final element.
+func ScanIter(ctx context.Context, s Scanner) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		var key string
+		for s.Next(&key) {
+			if err := ctx.Err(); err != nil {
+				s.Close()
+				yield("", err)
+				return
+			} else if !yield(key, nil) {
+				s.Close()
+				return
+			}
+		}
+		if err := s.Close(); err != nil {
+			yield("", err)
+		}
+	}
+}
+
+// StreamIterEntry is the element yielded by StreamIter, and describes a single
+// entry read from a stream.
+type StreamIterEntry struct {
+	// Stream is the name of the stream the entry was read from.
+	Stream string
+
+	StreamEntry
+}
+
+// StreamIter returns an iterator over all entries read by the given
+// StreamReader. The iterator continues reading until the Context is canceled,
+// the StreamReader returns an error, or the loop is broken out of. An error from
+// the StreamReader is yielded as the final element.
+//
+// Since the StreamReader may block while waiting for new entries (see
+// StreamReaderOpts.Block) cancellation of the Context may not be noticed
+// until that block is over.
+func StreamIter(ctx context.Context, sr StreamReader) iter.Seq2[StreamIterEntry, error] {
+	return func(yield func(StreamIterEntry, error) bool) {
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(StreamIterEntry{}, err)
+				return
+			}
+
+			stream, entries, ok := sr.Next()
+			if !ok {
+				yield(StreamIterEntry{}, sr.Err())
+				return
+			}
+			for _, entry := range entries {
+				if !yield(StreamIterEntry{Stream: stream, StreamEntry: entry}, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// PubSubIter returns an iterator over all messages published to the given
+// channels. The PubSubConn is subscribed to the channels when iteration starts,
+// and unsubscribed from them when it ends. Iteration continues until the
+// Context is canceled or the loop is broken out of. If subscribing fails then
+// the error is yielded as the only element.
+//
+// The PubSubConn is not closed once iteration ends, and may be used for
+// other subscriptions concurrently.
+func PubSubIter(ctx context.Context, pconn PubSubConn, channels ...string) iter.Seq2[PubSubMessage, error] {
+	return func(yield func(PubSubMessage, error) bool) {
+		msgCh := make(chan PubSubMessage)
+		if err := pconn.Subscribe(msgCh, channels...); err != nil {
+			yield(PubSubMessage{}, err)
+			return
+		}
+
+		defer func() {
+			// msgCh must still be read from until Unsubscribe returns.
+			doneCh := make(chan struct{})
+			go func() {
+				for {
+					select {
+					case <-msgCh:
+					case <-doneCh:
+						return
+					}
+				}
+			}()
+			pconn.Unsubscribe(msgCh, channels...)
+			close(doneCh)
+		}()
+
+		for {
+			select {
+			case msg := <-msgCh:
+				if !yield(msg, nil) {
+					return
+				}
+			case <-ctx.Done():
+				yield(PubSubMessage{}, ctx.Err())
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+//go:build go1.23
+// +build go1.23
+
+package radix
+
+import (
+	"context"
+	"strconv"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+)
+
+func TestScanIter(t *T) {
+	stub := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		if args[1] == "0" {
+			return []interface{}{"1", []string{"a", "b"}}
+		}
+		return []interface{}{"0", []string{"c"}}
+	})
+
+	var keys []string
+	for key, err := range ScanIter(context.Background(), NewScanner(stub, ScanAllKeys)) {
+		require.NoError(t, err)
+		keys = append(keys, key)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, keys)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	keys = keys[:0]
+	var gotErr error
+	for key, err := range ScanIter(ctx, NewScanner(stub, ScanAllKeys)) {
+		if err != nil {
+			gotErr = err
+			break
+		}
+		keys = append(keys, key)
+		cancel()
+	}
+	assert.Equal(t, []string{"a"}, keys)
+	assert.Equal(t, context.Canceled, gotErr)
+}
+
+type testStreamReader struct {
+	n   int
+	err error
+}
+
+func (sr *testStreamReader) Err() error {
+	return sr.err
+}
+
+func (sr *testStreamReader) Next() (string, []StreamEntry, bool) {
+	if sr.n--; sr.n < 0 {
+		return "", nil, false
+	}
+	return "s" + strconv.Itoa(sr.n), []StreamEntry{
+		{ID: StreamEntryID{Time: uint64(sr.n)}},
+		{ID: StreamEntryID{Time: uint64(sr.n), Seq: 1}},
+	}, true
+}
+
+func TestStreamIter(t *T) {
+	srErr := errors.New("read failed")
+	sr := &testStreamReader{n: 2, err: srErr}
+
+	var got []StreamIterEntry
+	var gotErr error
+	for entry, err := range StreamIter(context.Background(), sr) {
+		if err != nil {
+			gotErr = err
+			break
+		}
+		got = append(got, entry)
+	}
+	assert.Equal(t, srErr, gotErr)
+	assert.Equal(t, []StreamIterEntry{
+		{Stream: "s1", StreamEntry: StreamEntry{ID: StreamEntryID{Time: 1}}},
+		{Stream: "s1", StreamEntry: StreamEntry{ID: StreamEntryID{Time: 1, Seq: 1}}},
+		{Stream: "s0", StreamEntry: StreamEntry{ID: StreamEntryID{Time: 0}}},
+		{Stream: "s0", StreamEntry: StreamEntry{ID: StreamEntryID{Time: 0, Seq: 1}}},
+	}, got)
+}
+
+func TestPubSubIter(t *T) {
+	// the PubSubConn may PING once it's no longer subscribed to anything.
+	conn, stubCh := PubSubStub("tcp", "127.0.0.1:6379", func([]string) interface{} {
+		return "PONG"
+	})
+	pconn := PubSub(conn)
+	defer pconn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// messages published before the iterator has subscribed are dropped, so
+	// publish continuously and check that consecutive messages are received.
+	go func() {
+		for i := 0; ; i++ {
+			msg := PubSubMessage{Type: "message", Channel: "foo", Message: []byte(strconv.Itoa(i))}
+			select {
+			case stubCh <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var msgs []int
+	for msg, err := range PubSubIter(ctx, pconn, "foo") {
+		require.NoError(t, err)
+		i, err := strconv.Atoi(string(msg.Message))
+		require.NoError(t, err)
+		if msgs = append(msgs, i); len(msgs) == 3 {
+			break
+		}
+	}
+	assert.Equal(t, []int{msgs[0], msgs[0] + 1, msgs[0] + 2}, msgs)
+
+	cancel()
+	var gotErr error
+	for _, err := range PubSubIter(ctx, pconn, "foo") {
+		gotErr = err
+	}
+	assert.Equal(t, context.Canceled, gotErr)
+}
@@ -0,0 +1,23 @@
+//go:build !go1.23
+// +build !go1.23
+
+package radix
+
+import (
+	"net"
+	"time"
+)
+
+// setDialerKeepAlive applies the KeepAliveConfig to the net.Dialer. Prior to go
+// 1.23 only the keepalive period can be configured, which is used for both the
+// idle time and the interval between probes.
+func setDialerKeepAlive(dialer *net.Dialer, cfg KeepAliveConfig) {
+	if !cfg.Enable {
+		dialer.KeepAlive = -1
+		return
+	}
+	dialer.KeepAlive = cfg.Idle
+	if dialer.KeepAlive == 0 {
+		dialer.KeepAlive = 15 * time.Second
+	}
+}
@@ -0,0 +1,20 @@
+//go:build go1.23
+// +build go1.23
+
+package radix
+
+import "net"
+
+// setDialerKeepAlive applies the KeepAliveConfig to the net.Dialer.
+func setDialerKeepAlive(dialer *net.Dialer, cfg KeepAliveConfig) {
+	if !cfg.Enable {
+		dialer.KeepAlive = -1
+		return
+	}
+	dialer.KeepAliveConfig = net.KeepAliveConfig{
+		Enable:   true,
+		Idle:     cfg.Idle,
+		Interval: cfg.Interval,
+		Count:    cfg.Count,
+	}
+}
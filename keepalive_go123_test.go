@@ -0,0 +1,48 @@
+//go:build go1.23
+// +build go1.23
+
+package radix
+
+import (
+	"net"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialKeepAlive(t *T) {
+	var dialer net.Dialer
+	setDialerKeepAlive(&dialer, KeepAliveConfig{Enable: true, Idle: time.Minute, Interval: 5 * time.Second, Count: 3})
+	assert.Equal(t, net.KeepAliveConfig{Enable: true, Idle: time.Minute, Interval: 5 * time.Second, Count: 3}, dialer.KeepAliveConfig)
+
+	dialer = net.Dialer{}
+	setDialerKeepAlive(&dialer, KeepAliveConfig{})
+	assert.Equal(t, time.Duration(-1), dialer.KeepAlive)
+
+	// make sure a connection can actually be dialed with keepalive configured,
+	// including the default.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	for _, opts := range [][]DialOpt{
+		nil,
+		{DialKeepAlive(KeepAliveConfig{Enable: true, Idle: time.Minute, Interval: 5 * time.Second, Count: 3})},
+		{DialKeepAlive(KeepAliveConfig{})},
+	} {
+		conn, err := Dial("tcp", l.Addr().String(), opts...)
+		require.NoError(t, err)
+		conn.Close()
+	}
+}
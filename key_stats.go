@@ -0,0 +1,170 @@
+package radix
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// KeyStats describes a single key, as returned by GetKeyStats.
+type KeyStats struct {
+	Key string
+
+	// Type is the type of the key's value, as returned by TYPE. It will be
+	// "none" if the key doesn't exist.
+	Type string
+
+	// Encoding is the internal encoding of the key's value, as returned by
+	// OBJECT ENCODING (e.g. "listpack", "hashtable").
+	Encoding string
+
+	// MemoryUsage is the number of bytes the key and its value take up, as
+	// returned by MEMORY USAGE.
+	MemoryUsage int64
+
+	// TTL is the remaining time to live of the key, or -1 if the key has no
+	// expiration.
+	TTL time.Duration
+}
+
+func keyStats(c Client, key string, samples int) (KeyStats, error) {
+	memArgs := []string{"USAGE", key}
+	if samples > 0 {
+		memArgs = append(memArgs, "SAMPLES", strconv.Itoa(samples))
+	}
+
+	ks := KeyStats{Key: key}
+	var pttl int64
+	err := c.Do(Pipeline(
+		Cmd(&ks.Type, "TYPE", key),
+		Cmd(&MaybeNil{Rcv: &ks.Encoding}, "OBJECT", "ENCODING", key),
+		Cmd(&MaybeNil{Rcv: &ks.MemoryUsage}, "MEMORY", memArgs...),
+		Cmd(&pttl, "PTTL", key),
+	))
+	if err != nil {
+		return KeyStats{}, err
+	}
+
+	if pttl < 0 {
+		ks.TTL = -1
+	} else {
+		ks.TTL = time.Duration(pttl) * time.Millisecond
+	}
+	return ks, nil
+}
+
+// GetKeyStats returns the KeyStats for the given key, which are retrieved
+// using a single pipeline. If the key doesn't exist then the returned KeyStats
+// will have a Type of "none".
+func GetKeyStats(c Client, key string) (KeyStats, error) {
+	return keyStats(c, key, 0)
+}
+
+// BigKeysOpts are used to configure the behavior of FindBigKeys.
+type BigKeysOpts struct {
+	// Scan is used to scan the keyspace. Command defaults to "SCAN", and it
+	// may only be "SCAN".
+	Scan ScanOpts
+
+	// TopN is the number of keys which are returned for each type. Defaults
+	// to 10.
+	TopN int
+
+	// Concurrency is the number of go-routines which will retrieve the
+	// KeyStats of scanned keys concurrently. Defaults to 4.
+	Concurrency int
+
+	// Samples is passed as the SAMPLES argument of MEMORY USAGE, and is the
+	// number of elements of nested values which are sampled in order to
+	// estimate their size. Zero uses redis' default, and larger values are
+	// more accurate but slower.
+	Samples int
+}
+
+// FindBigKeys scans the entire keyspace, or all keys matching the given
+// pattern, and returns the TopN keys of each type which use the most memory,
+// in descending order of MemoryUsage. The returned map is keyed by type.
+//
+// If the Client is a *Cluster then every primary in the cluster is scanned.
+//
+// Keys which are deleted while being scanned are ignored. The first error
+// encountered stops the scan and is returned.
+func FindBigKeys(c Client, opts BigKeysOpts) (map[string][]KeyStats, error) {
+	if opts.Scan.Command == "" {
+		opts.Scan.Command = "SCAN"
+	}
+	if opts.TopN <= 0 {
+		opts.TopN = 10
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+
+	var s Scanner
+	if cluster, ok := c.(*Cluster); ok {
+		s = cluster.NewScanner(opts.Scan)
+	} else {
+		s = NewScanner(c, opts.Scan)
+	}
+
+	var l sync.Mutex
+	var err error
+	res := map[string][]KeyStats{}
+	add := func(ks KeyStats) {
+		top := res[ks.Type]
+		i := sort.Search(len(top), func(i int) bool {
+			return top[i].MemoryUsage < ks.MemoryUsage
+		})
+		if i >= opts.TopN {
+			return
+		}
+		top = append(top, KeyStats{})
+		copy(top[i+1:], top[i:])
+		top[i] = ks
+		if len(top) > opts.TopN {
+			top = top[:opts.TopN]
+		}
+		res[ks.Type] = top
+	}
+
+	keyCh := make(chan string, opts.Concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keyCh {
+				ks, ksErr := keyStats(c, key, opts.Samples)
+				l.Lock()
+				if ksErr != nil && err == nil {
+					err = ksErr
+				} else if ksErr == nil && ks.Type != "none" {
+					add(ks)
+				}
+				l.Unlock()
+			}
+		}()
+	}
+
+	var key string
+	for s.Next(&key) {
+		l.Lock()
+		failed := err != nil
+		l.Unlock()
+		if failed {
+			break
+		}
+		keyCh <- key
+	}
+	close(keyCh)
+	wg.Wait()
+
+	if closeErr := s.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
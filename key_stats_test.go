@@ -0,0 +1,93 @@
+package radix
+
+import (
+	"strconv"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func keyStatsStub() Client {
+	// keys are named by their type and size
+	keys := map[string][2]string{
+		"s1": {"string", "10"}, "s2": {"string", "30"}, "s3": {"string", "20"},
+		"h1": {"hash", "100"}, "h2": {"hash", "50"},
+		"l1": {"list", "5"},
+	}
+	return Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		switch args[0] {
+		case "SCAN":
+			var ks []string
+			for k := range keys {
+				ks = append(ks, k)
+			}
+			return []interface{}{"0", ks}
+		case "TYPE":
+			if k, ok := keys[args[1]]; ok {
+				return k[0]
+			}
+			return "none"
+		case "OBJECT":
+			if _, ok := keys[args[2]]; ok {
+				return "listpack"
+			}
+			return nil
+		case "MEMORY":
+			if k, ok := keys[args[2]]; ok {
+				n, _ := strconv.Atoi(k[1])
+				return n
+			}
+			return nil
+		case "PTTL":
+			if args[1] == "s1" {
+				return 1500
+			} else if _, ok := keys[args[1]]; ok {
+				return -1
+			}
+			return -2
+		}
+		return nil
+	})
+}
+
+func TestGetKeyStats(t *T) {
+	c := keyStatsStub()
+
+	ks, err := GetKeyStats(c, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, KeyStats{
+		Key:         "s1",
+		Type:        "string",
+		Encoding:    "listpack",
+		MemoryUsage: 10,
+		TTL:         1500 * time.Millisecond,
+	}, ks)
+
+	ks, err = GetKeyStats(c, "nope")
+	require.NoError(t, err)
+	assert.Equal(t, KeyStats{Key: "nope", Type: "none", TTL: -1}, ks)
+
+	assert.Equal(t, []string{"foo"}, Cmd(nil, "MEMORY", "USAGE", "foo").Keys())
+	assert.Equal(t, []string{"foo"}, Cmd(nil, "OBJECT", "ENCODING", "foo").Keys())
+	assert.Empty(t, Cmd(nil, "MEMORY", "STATS").Keys())
+}
+
+func TestFindBigKeys(t *T) {
+	// a single Stub can't be used concurrently
+	res, err := FindBigKeys(keyStatsStub(), BigKeysOpts{TopN: 2, Concurrency: 1})
+	require.NoError(t, err)
+
+	names := map[string][]string{}
+	for typ, kss := range res {
+		for _, ks := range kss {
+			names[typ] = append(names[typ], ks.Key)
+		}
+	}
+	assert.Equal(t, map[string][]string{
+		"string": {"s2", "s3"},
+		"hash":   {"h1", "h2"},
+		"list":   {"l1"},
+	}, names)
+}
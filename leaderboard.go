@@ -0,0 +1,314 @@
+package radix
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+// LeaderboardOpts are the options given to NewLeaderboard.
+type LeaderboardOpts struct {
+	// Ascending ranks members with lower scores first, e.g. for a leaderboard
+	// of completion times. By default members with higher scores are ranked
+	// first.
+	Ascending bool
+
+	// TieBreakFirst ranks members with the same score in the order they
+	// reached it, the first to do so being ranked first. By default members
+	// with the same score are ranked by their name, as redis does.
+	//
+	// Ties are broken by storing the time, at a resolution of one second, in
+	// the fractional part of each member's score, and so when TieBreakFirst is
+	// used scores must be integers, and their absolute values less than 2^20
+	// (about a million), or, if a Period is used, less than 2^52 divided by the
+	// Period in seconds.
+	TieBreakFirst bool
+
+	// Period, if non-zero, gives the leaderboard a separate sorted set for each
+	// period of time, e.g. one per day, aligned to the zero time (so days start
+	// at midnight UTC). Members are only ranked against those in the same
+	// period.
+	Period time.Duration
+
+	// Retain is the number of periods a period's sorted set is kept for, from
+	// the start of the period, before it expires.
+	//
+	// The default, if Retain is 0, is 2, i.e. the current and previous periods
+	// are kept.
+	Retain int
+}
+
+// LeaderboardEntry is a member of a Leaderboard along with its score and rank.
+// Rank is 0 for the first ranked member.
+type LeaderboardEntry struct {
+	Member string
+	Score  float64
+	Rank   int64
+}
+
+// Leaderboard ranks members by their score using a sorted set, providing the
+// queries most commonly needed of a leaderboard, such as paging through the
+// top members and finding the members ranked around a given one.
+//
+// A Leaderboard is safe for concurrent use.
+type Leaderboard struct {
+	c    Client
+	key  string
+	opts LeaderboardOpts
+
+	// at is the time the Leaderboard is viewed at, see At. If zero the current
+	// time is used.
+	at time.Time
+}
+
+// tieBreakEpoch is the time which TieBreakFirst times are measured from when
+// there's no Period.
+var tieBreakEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// NewLeaderboard returns a Leaderboard which keeps its scores in the sorted set
+// at key, or, if opts.Period is set, in sorted sets whose keys are key suffixed
+// with ":" and the start of the period as a unix timestamp.
+func NewLeaderboard(c Client, key string, opts LeaderboardOpts) *Leaderboard {
+	if opts.Retain <= 0 {
+		opts.Retain = 2
+	}
+	return &Leaderboard{c: c, key: key, opts: opts}
+}
+
+// At returns a view of the Leaderboard as of the given time. If the Leaderboard
+// has a Period then the view uses the sorted set for the period containing t,
+// e.g. to query a previous day's leaderboard, and when TieBreakFirst is used
+// scores set using the view are considered to have been reached at t.
+func (lb *Leaderboard) At(t time.Time) *Leaderboard {
+	lb2 := *lb
+	lb2.at = t
+	return &lb2
+}
+
+func (lb *Leaderboard) now() time.Time {
+	if lb.at.IsZero() {
+		return time.Now()
+	}
+	return lb.at
+}
+
+func (lb *Leaderboard) periodStart() time.Time {
+	return lb.now().Truncate(lb.opts.Period)
+}
+
+// Key returns the key of the sorted set the Leaderboard is currently using.
+func (lb *Leaderboard) Key() string {
+	if lb.opts.Period <= 0 {
+		return lb.key
+	}
+	return lb.key + ":" + strconv.FormatInt(lb.periodStart().Unix(), 10)
+}
+
+// tieBreakSpan returns the number of seconds over which times are encoded
+// when using TieBreakFirst, and the time they're encoded relative to.
+func (lb *Leaderboard) tieBreakSpan() (int64, time.Time) {
+	if lb.opts.Period <= 0 {
+		return 1 << 32, tieBreakEpoch
+	}
+	span := int64(lb.opts.Period / time.Second)
+	if span < 1 {
+		span = 1
+	}
+	return span, lb.periodStart()
+}
+
+// tieBreakFrac returns the fractional part added to scores when using
+// TieBreakFirst, which is in the range [0, 1).
+func (lb *Leaderboard) tieBreakFrac() float64 {
+	span, start := lb.tieBreakSpan()
+	rel := int64(lb.now().Sub(start) / time.Second)
+	if rel < 0 {
+		rel = 0
+	} else if rel >= span {
+		rel = span - 1
+	}
+	if !lb.opts.Ascending {
+		rel = span - 1 - rel
+	}
+	return float64(rel) / float64(span)
+}
+
+func (lb *Leaderboard) checkScore(score float64) error {
+	if !lb.opts.TieBreakFirst {
+		return nil
+	}
+	span, _ := lb.tieBreakSpan()
+	if score != math.Trunc(score) {
+		return errors.Errorf("score %v is not an integer, as required by TieBreakFirst", score)
+	} else if math.Abs(score) >= float64(int64(1)<<52)/float64(span) {
+		return errors.Errorf("score %v is too large to be used with TieBreakFirst", score)
+	}
+	return nil
+}
+
+// score converts a score stored in the sorted set into the one which was set.
+func (lb *Leaderboard) score(stored float64) float64 {
+	if lb.opts.TieBreakFirst {
+		return math.Floor(stored)
+	}
+	return stored
+}
+
+func formatScore(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// expireAt returns the unix time, in milliseconds, at which the current
+// period's sorted set should expire, or an empty string if there's no Period.
+func (lb *Leaderboard) expireAt() string {
+	if lb.opts.Period <= 0 {
+		return ""
+	}
+	expireAt := lb.periodStart().Add(lb.opts.Period * time.Duration(lb.opts.Retain))
+	return strconv.FormatInt(expireAt.UnixNano()/int64(time.Millisecond), 10)
+}
+
+func (lb *Leaderboard) doWrite(key string, cmd CmdAction) error {
+	if expireAt := lb.expireAt(); expireAt != "" {
+		return lb.c.Do(Pipeline(cmd, Cmd(nil, "PEXPIREAT", key, expireAt)))
+	}
+	return lb.c.Do(cmd)
+}
+
+// Set sets the member's score, adding the member if it isn't already on the
+// Leaderboard.
+func (lb *Leaderboard) Set(member string, score float64) error {
+	if err := lb.checkScore(score); err != nil {
+		return err
+	}
+	stored := score
+	if lb.opts.TieBreakFirst {
+		stored += lb.tieBreakFrac()
+	}
+	key := lb.Key()
+	return lb.doWrite(key, Cmd(nil, "ZADD", key, formatScore(stored), member))
+}
+
+var leaderboardIncrScript = NewEvalScript(1, `
+	local old = tonumber(redis.call("ZSCORE", KEYS[1], ARGV[1]) or "0")
+	local score = math.floor(old) + tonumber(ARGV[2])
+	redis.call("ZADD", KEYS[1], string.format("%.17g", score + tonumber(ARGV[3])), ARGV[1])
+	if ARGV[4] ~= "" then
+		redis.call("PEXPIREAT", KEYS[1], ARGV[4])
+	end
+	return string.format("%.17g", score)
+`)
+
+// Incr increments the member's score by delta, adding the member with a score
+// of delta if it isn't already on the Leaderboard, and returns its new score.
+// When TieBreakFirst is used the member is considered to have reached its new
+// score now.
+func (lb *Leaderboard) Incr(member string, delta float64) (float64, error) {
+	if err := lb.checkScore(delta); err != nil {
+		return 0, err
+	}
+	key := lb.Key()
+
+	var score float64
+	if !lb.opts.TieBreakFirst {
+		err := lb.doWrite(key, Cmd(&score, "ZINCRBY", key, formatScore(delta), member))
+		return score, err
+	}
+
+	err := lb.c.Do(leaderboardIncrScript.Cmd(&score, key,
+		member, formatScore(delta), formatScore(lb.tieBreakFrac()), lb.expireAt()))
+	return score, err
+}
+
+// Remove removes the member from the Leaderboard.
+func (lb *Leaderboard) Remove(member string) error {
+	return lb.c.Do(Cmd(nil, "ZREM", lb.Key(), member))
+}
+
+// Len returns the number of members on the Leaderboard.
+func (lb *Leaderboard) Len() (int64, error) {
+	var n int64
+	err := lb.c.Do(Cmd(&n, "ZCARD", lb.Key()))
+	return n, err
+}
+
+func (lb *Leaderboard) rankCmd() string {
+	if lb.opts.Ascending {
+		return "ZRANK"
+	}
+	return "ZREVRANK"
+}
+
+func (lb *Leaderboard) rangeCmd() string {
+	if lb.opts.Ascending {
+		return "ZRANGE"
+	}
+	return "ZREVRANGE"
+}
+
+// Entry returns the member's score and rank. false is returned if the member
+// isn't on the Leaderboard.
+func (lb *Leaderboard) Entry(member string) (LeaderboardEntry, bool, error) {
+	key := lb.Key()
+	var score float64
+	var rank int64
+	mnScore := MaybeNil{Rcv: &score}
+	err := lb.c.Do(Pipeline(
+		Cmd(&mnScore, "ZSCORE", key, member),
+		Cmd(&rank, lb.rankCmd(), key, member),
+	))
+	if err != nil || mnScore.Nil {
+		return LeaderboardEntry{}, false, err
+	}
+	return LeaderboardEntry{Member: member, Score: lb.score(score), Rank: rank}, true, nil
+}
+
+// Top returns up to count members, in rank order, starting at the given rank.
+// Pages of the Leaderboard can be retrieved by increasing offset by count for
+// each page.
+func (lb *Leaderboard) Top(offset, count int) ([]LeaderboardEntry, error) {
+	if count <= 0 {
+		return nil, nil
+	}
+	return lb.rangeEntries(int64(offset), int64(offset+count-1))
+}
+
+// Around returns the member along with up to n members ranked either side of
+// it, in rank order. nil is returned if the member isn't on the Leaderboard.
+//
+// The member's rank and the members around it are retrieved separately, so if
+// the Leaderboard is modified in between the member may not be in the middle
+// of those returned.
+func (lb *Leaderboard) Around(member string, n int) ([]LeaderboardEntry, error) {
+	var rank int64
+	mnRank := MaybeNil{Rcv: &rank}
+	if err := lb.c.Do(Cmd(&mnRank, lb.rankCmd(), lb.Key(), member)); err != nil || mnRank.Nil {
+		return nil, err
+	}
+	start := rank - int64(n)
+	if start < 0 {
+		start = 0
+	}
+	return lb.rangeEntries(start, rank+int64(n))
+}
+
+func (lb *Leaderboard) rangeEntries(start, stop int64) ([]LeaderboardEntry, error) {
+	var members []ZMember
+	err := lb.c.Do(Cmd(zMembers{rcv: &members}, lb.rangeCmd(), lb.Key(),
+		strconv.FormatInt(start, 10), strconv.FormatInt(stop, 10), "WITHSCORES"))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]LeaderboardEntry, len(members))
+	for i, m := range members {
+		entries[i] = LeaderboardEntry{
+			Member: m.Member,
+			Score:  lb.score(m.Score),
+			Rank:   start + int64(i),
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,219 @@
+package radix
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	. "testing"
+	"time"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLeaderboardStub returns a Stub which implements the sorted set commands
+// used by Leaderboard, including its script, and records the expiry set on
+// each key.
+func newLeaderboardStub() (Client, map[string]string) {
+	var l sync.Mutex
+	zsets := map[string]map[string]float64{}
+	expires := map[string]string{}
+
+	zset := func(key string) map[string]float64 {
+		if zsets[key] == nil {
+			zsets[key] = map[string]float64{}
+		}
+		return zsets[key]
+	}
+	sorted := func(key string, rev bool) []string {
+		z := zset(key)
+		members := make([]string, 0, len(z))
+		for m := range z {
+			members = append(members, m)
+		}
+		sort.Slice(members, func(i, j int) bool {
+			mi, mj := members[i], members[j]
+			if rev {
+				mi, mj = mj, mi
+			}
+			if z[mi] != z[mj] {
+				return z[mi] < z[mj]
+			}
+			return mi < mj
+		})
+		return members
+	}
+	rank := func(key, member string, rev bool) interface{} {
+		for i, m := range sorted(key, rev) {
+			if m == member {
+				return i
+			}
+		}
+		return nil
+	}
+
+	stub := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		l.Lock()
+		defer l.Unlock()
+		switch args[0] {
+		case "ZADD":
+			score, _ := strconv.ParseFloat(args[2], 64)
+			zset(args[1])[args[3]] = score
+			return 1
+		case "ZINCRBY":
+			delta, _ := strconv.ParseFloat(args[2], 64)
+			zset(args[1])[args[3]] += delta
+			return formatScore(zset(args[1])[args[3]])
+		case "EVALSHA":
+			if args[1] != leaderboardIncrScript.sum {
+				return resp2.Error{E: errors.New("NOSCRIPT")}
+			}
+			key, member := args[3], args[4]
+			delta, _ := strconv.ParseFloat(args[5], 64)
+			frac, _ := strconv.ParseFloat(args[6], 64)
+			score := math.Floor(zset(key)[member]) + delta
+			zset(key)[member] = score + frac
+			if args[7] != "" {
+				expires[key] = args[7]
+			}
+			return formatScore(score)
+		case "ZREM":
+			delete(zset(args[1]), args[2])
+			return 1
+		case "ZCARD":
+			return len(zset(args[1]))
+		case "ZSCORE":
+			if score, ok := zset(args[1])[args[2]]; ok {
+				return formatScore(score)
+			}
+			return nil
+		case "ZRANK", "ZREVRANK":
+			return rank(args[1], args[2], args[0] == "ZREVRANK")
+		case "ZRANGE", "ZREVRANGE":
+			members := sorted(args[1], args[0] == "ZREVRANGE")
+			start, _ := strconv.Atoi(args[2])
+			stop, _ := strconv.Atoi(args[3])
+			var res []string
+			for i := start; i <= stop && i < len(members); i++ {
+				res = append(res, members[i], formatScore(zset(args[1])[members[i]]))
+			}
+			return res
+		case "PEXPIREAT":
+			expires[args[1]] = args[2]
+			return 1
+		}
+		return resp2.Error{E: errors.Errorf("unexpected command %q", args)}
+	})
+	return stub, expires
+}
+
+func TestLeaderboard(t *T) {
+	entriesOf := func(entries []LeaderboardEntry) []string {
+		var members []string
+		for _, e := range entries {
+			members = append(members, e.Member)
+		}
+		return members
+	}
+
+	t.Run("Paging", func(t *T) {
+		c, _ := newLeaderboardStub()
+		lb := NewLeaderboard(c, "lb", LeaderboardOpts{})
+		for i, m := range []string{"a", "b", "c", "d", "e"} {
+			require.NoError(t, lb.Set(m, float64(i)))
+		}
+		score, err := lb.Incr("a", 10)
+		require.NoError(t, err)
+		assert.Equal(t, float64(10), score)
+
+		top, err := lb.Top(0, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []LeaderboardEntry{
+			{Member: "a", Score: 10, Rank: 0},
+			{Member: "e", Score: 4, Rank: 1},
+		}, top)
+		top, err = lb.Top(2, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"d", "c"}, entriesOf(top))
+
+		around, err := lb.Around("d", 1)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"e", "d", "c"}, entriesOf(around))
+		assert.Equal(t, int64(1), around[0].Rank)
+		around, err = lb.Around("a", 1)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "e"}, entriesOf(around))
+		around, err = lb.Around("z", 1)
+		require.NoError(t, err)
+		assert.Nil(t, around)
+
+		require.NoError(t, lb.Remove("e"))
+		n, err := lb.Len()
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), n)
+
+		entry, ok, err := lb.Entry("c")
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, LeaderboardEntry{Member: "c", Score: 2, Rank: 2}, entry)
+		_, ok, err = lb.Entry("e")
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("TieBreakFirst", func(t *T) {
+		for _, asc := range []bool{false, true} {
+			c, _ := newLeaderboardStub()
+			lb := NewLeaderboard(c, "lb", LeaderboardOpts{Ascending: asc, TieBreakFirst: true})
+			now := time.Now()
+
+			// c, a and b reach the same score in that order, which isn't the
+			// order of their names.
+			require.NoError(t, lb.At(now).Set("c", 5))
+			require.NoError(t, lb.At(now.Add(time.Second)).Set("a", 3))
+			score, err := lb.At(now.Add(2*time.Second)).Incr("a", 2)
+			require.NoError(t, err)
+			assert.Equal(t, float64(5), score)
+			require.NoError(t, lb.At(now.Add(3*time.Second)).Set("b", 5))
+
+			top, err := lb.Top(0, 3)
+			require.NoError(t, err)
+			assert.Equal(t, []LeaderboardEntry{
+				{Member: "c", Score: 5, Rank: 0},
+				{Member: "a", Score: 5, Rank: 1},
+				{Member: "b", Score: 5, Rank: 2},
+			}, top)
+
+			assert.Error(t, lb.Set("d", 1.5))
+			assert.Error(t, lb.Set("d", 1<<21))
+		}
+	})
+
+	t.Run("Period", func(t *T) {
+		c, expires := newLeaderboardStub()
+		lb := NewLeaderboard(c, "lb", LeaderboardOpts{Period: 24 * time.Hour})
+		day := time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+		today, yesterday := lb.At(day.Add(time.Hour)), lb.At(day.Add(-time.Hour))
+		assert.Equal(t, "lb:"+strconv.FormatInt(day.Unix(), 10), today.Key())
+
+		require.NoError(t, today.Set("a", 1))
+		require.NoError(t, yesterday.Set("b", 1))
+		_, err := yesterday.Incr("a", 2)
+		require.NoError(t, err)
+
+		top, err := today.Top(0, 10)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a"}, entriesOf(top))
+		top, err = yesterday.Top(0, 10)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, entriesOf(top))
+
+		// sets are kept for two days from the start of their day
+		expireAt := day.Add(48*time.Hour).UnixNano() / int64(time.Millisecond)
+		assert.Equal(t, strconv.FormatInt(expireAt, 10), expires[today.Key()])
+	})
+}
@@ -0,0 +1,172 @@
+package radix
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+// ListConsumerOpts are the options given to ConsumeList. Source and
+// Destination are required.
+type ListConsumerOpts struct {
+	// Source is the list which values are popped from.
+	Source string
+
+	// Destination is the list which each value is atomically pushed onto as
+	// it's popped from Source, e.g. a "processing" list which can be used to
+	// recover values whose processing didn't complete. It may be the same as
+	// Source, in which case the list is rotated.
+	Destination string
+
+	// SourceSide and DestinationSide are the sides of Source and Destination
+	// that values are popped from and pushed to, "LEFT" or "RIGHT". They
+	// default to "RIGHT" and "LEFT" respectively, which is the behavior of
+	// BRPOPLPUSH.
+	SourceSide, DestinationSide string
+
+	// UseBRPOPLPUSH causes BRPOPLPUSH to be used rather than BLMOVE, which
+	// was added in redis 6.2. SourceSide and DestinationSide must be left as
+	// their defaults if this is set.
+	UseBRPOPLPUSH bool
+
+	// Block is the longest time each blocking command will wait for a value.
+	// Each command's timeout is shortened to fit within the deadline of the
+	// context given to ConsumeList, if it has one, and ConsumeList notices the
+	// context being cancelled within Block of it happening.
+	//
+	// The default, if Block is 0, is 5 seconds. The Client given to
+	// ConsumeList must not time out commands in less than Block.
+	Block time.Duration
+
+	// RetryAfter is how long to wait before trying again after a command
+	// fails, e.g. due to a network error.
+	//
+	// The default, if RetryAfter is 0, is 1 second.
+	RetryAfter time.Duration
+
+	// RemoveOnSuccess causes each value to be removed from Destination, using
+	// LREM, once the callback given to ConsumeList has returned nil for it. If
+	// the LREM can't be performed before the context given to ConsumeList is
+	// done then the value is left in Destination.
+	RemoveOnSuccess bool
+
+	// ErrCh, if set, will have errors which ConsumeList recovers from written
+	// to it. If the channel blocks the error will be dropped.
+	ErrCh chan<- error
+}
+
+func (opts ListConsumerOpts) withDefaults() ListConsumerOpts {
+	if opts.SourceSide == "" {
+		opts.SourceSide = "RIGHT"
+	}
+	if opts.DestinationSide == "" {
+		opts.DestinationSide = "LEFT"
+	}
+	if opts.Block == 0 {
+		opts.Block = 5 * time.Second
+	}
+	if opts.RetryAfter == 0 {
+		opts.RetryAfter = 1 * time.Second
+	}
+	return opts
+}
+
+// minListConsumerBlock is the shortest timeout a blocking command will be
+// given by ConsumeList, since a timeout of zero would block indefinitely.
+const minListConsumerBlock = time.Millisecond
+
+// ConsumeList pops values from a list one at a time using BLMOVE (or
+// BRPOPLPUSH), as described by ListConsumerOpts, and calls fn with each one.
+// Since each value is pushed onto opts.Destination as it's popped, it isn't
+// lost if the process dies before fn is done with it.
+//
+// ConsumeList blocks until ctx is done, in which case ctx.Err() is returned, or
+// until fn returns an error, in which case that error is returned and the
+// value fn was called with is left in opts.Destination.
+//
+// Errors returned when performing commands are written to opts.ErrCh, if set,
+// and the command is retried after opts.RetryAfter. When c is a Pool or Cluster
+// connections which fail are replaced as normal, so ConsumeList will continue
+// once the server is reachable again.
+func ConsumeList(ctx context.Context, c Client, opts ListConsumerOpts, fn func(ctx context.Context, value string) error) error {
+	opts = opts.withDefaults()
+	if opts.Source == "" || opts.Destination == "" {
+		return errors.New("ListConsumerOpts.Source and Destination are required")
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var value string
+		mn := MaybeNil{Rcv: &value}
+		if err := c.Do(listConsumerCmd(ctx, &mn, opts)); err != nil {
+			if err := waitRetry(ctx, opts.RetryAfter, opts.ErrCh, err); err != nil {
+				return err
+			}
+			continue
+		} else if mn.Nil {
+			continue
+		}
+
+		if err := fn(ctx, value); err != nil {
+			return err
+		} else if !opts.RemoveOnSuccess {
+			continue
+		}
+
+		for {
+			err := c.Do(Cmd(nil, "LREM", opts.Destination, "1", value))
+			if err == nil {
+				break
+			} else if err := waitRetry(ctx, opts.RetryAfter, opts.ErrCh, err); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// listConsumerCmd returns the blocking command to perform, with its timeout
+// limited to the deadline of ctx.
+func listConsumerCmd(ctx context.Context, rcv interface{}, opts ListConsumerOpts) CmdAction {
+	block := opts.Block
+	if deadline, ok := ctx.Deadline(); ok {
+		if untilDeadline := time.Until(deadline); untilDeadline < block {
+			block = untilDeadline
+		}
+	}
+	if block < minListConsumerBlock {
+		block = minListConsumerBlock
+	}
+	timeout := strconv.FormatFloat(block.Seconds(), 'f', -1, 64)
+
+	if opts.UseBRPOPLPUSH {
+		return Cmd(rcv, "BRPOPLPUSH", opts.Source, opts.Destination, timeout)
+	}
+	return Cmd(rcv, "BLMOVE", opts.Source, opts.Destination,
+		opts.SourceSide, opts.DestinationSide, timeout)
+}
+
+// waitRetry writes the error to errCh, if it's set and doesn't block, and
+// waits for the given duration, returning ctx.Err() if ctx is done in the
+// meantime.
+func waitRetry(ctx context.Context, d time.Duration, errCh chan<- error, err error) error {
+	if errCh != nil {
+		select {
+		case errCh <- err:
+		default:
+		}
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
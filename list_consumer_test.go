@@ -0,0 +1,107 @@
+package radix
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+)
+
+func TestConsumeList(t *T) {
+	var l sync.Mutex
+	lists := map[string][]string{"src": {"c", "b", "a"}}
+	var timeouts []float64
+	failNext := true
+	client := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		l.Lock()
+		defer l.Unlock()
+		switch args[0] {
+		case "BLMOVE":
+			if failNext {
+				failNext = false
+				return errors.New("network error")
+			}
+			f, _ := strconv.ParseFloat(args[5], 64)
+			timeouts = append(timeouts, f)
+			src := lists[args[1]]
+			if len(src) == 0 {
+				return nil
+			}
+			v := src[len(src)-1]
+			lists[args[1]] = src[:len(src)-1]
+			lists[args[2]] = append([]string{v}, lists[args[2]]...)
+			return v
+		case "LREM":
+			dst := lists[args[1]]
+			for i := range dst {
+				if dst[i] == args[3] {
+					lists[args[1]] = append(dst[:i:i], dst[i+1:]...)
+					return 1
+				}
+			}
+			return 0
+		}
+		return errors.New("unexpected command")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	var got []string
+	err := ConsumeList(ctx, client, ListConsumerOpts{
+		Source:          "src",
+		Destination:     "dst",
+		RetryAfter:      time.Millisecond,
+		RemoveOnSuccess: true,
+		ErrCh:           errCh,
+	}, func(_ context.Context, v string) error {
+		l.Lock()
+		assert.Equal(t, v, lists["dst"][0])
+		l.Unlock()
+		if got = append(got, v); len(got) == 3 {
+			cancel()
+		}
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, []string{"a", "b", "c"}, got)
+	assert.Error(t, <-errCh)
+
+	l.Lock()
+	assert.Empty(t, lists["src"])
+	assert.Empty(t, lists["dst"])
+	// each timeout is limited by the context's deadline, and so is under 5s
+	for _, timeout := range timeouts {
+		assert.True(t, timeout > 0 && timeout < 5, "timeout: %v", timeout)
+	}
+	l.Unlock()
+
+	// an error from the callback stops consumption and leaves the value in
+	// the destination.
+	l.Lock()
+	lists["src"] = []string{"d"}
+	l.Unlock()
+	errFn := errors.New("fn failed")
+	err = ConsumeList(context.Background(), client, ListConsumerOpts{
+		Source: "src", Destination: "dst",
+	}, func(context.Context, string) error { return errFn })
+	assert.Equal(t, errFn, err)
+	l.Lock()
+	assert.Equal(t, []string{"d"}, lists["dst"])
+	l.Unlock()
+
+	// a context which is done part way through a block results in a short
+	// timeout.
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	cmd := listConsumerCmd(ctx, nil, ListConsumerOpts{Source: "a", Destination: "b"}.withDefaults())
+	d, ok := cmd.(*cmdAction).blockTimeout()
+	require.True(t, ok)
+	assert.True(t, d > 0 && d <= 50*time.Millisecond, "timeout: %v", d)
+}
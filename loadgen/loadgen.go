@@ -0,0 +1,250 @@
+// Package loadgen contains helpers for generating load against a redis server
+// using a radix.Client, and measuring the throughput and latency the Client
+// achieves. It is used by the radixbench command, but can also be used directly
+// in order to validate the performance of a particular Client configuration on
+// a particular set of infrastructure.
+package loadgen
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+// CmdFunc returns the CmdAction to perform for the i'th command performed by
+// the given worker. It is called concurrently from all workers.
+type CmdFunc func(worker, i int) radix.CmdAction
+
+// SetCmdFunc returns a CmdFunc which SETs a key unique to each worker to a
+// value of the given size.
+func SetCmdFunc(valSize int) CmdFunc {
+	val := make([]byte, valSize)
+	for i := range val {
+		val[i] = 'a'
+	}
+	return func(worker, i int) radix.CmdAction {
+		return radix.FlatCmd(nil, "SET", "loadgen:"+strconv.Itoa(worker), val)
+	}
+}
+
+type opts struct {
+	concurrency  int
+	requests     int
+	duration     time.Duration
+	pipelineSize int
+	cmdFn        CmdFunc
+}
+
+// Opt is an optional behavior which can be applied to the Run function to
+// effect how load is generated.
+type Opt func(*opts)
+
+// Concurrency sets the number of go-routines which will concurrently perform
+// commands.
+func Concurrency(n int) Opt {
+	return func(o *opts) {
+		o.concurrency = n
+	}
+}
+
+// Requests sets the total number of commands which will be performed, across
+// all go-routines. If zero then there is no limit, and Duration must be set.
+func Requests(n int) Opt {
+	return func(o *opts) {
+		o.requests = n
+	}
+}
+
+// Duration sets the maximum amount of time load will be generated for. If zero
+// then there is no limit, and Requests must be set.
+func Duration(d time.Duration) Opt {
+	return func(o *opts) {
+		o.duration = d
+	}
+}
+
+// PipelineSize sets the number of commands which will be performed together
+// in a single radix.Pipeline. If 1 or less then commands are performed
+// individually.
+func PipelineSize(n int) Opt {
+	return func(o *opts) {
+		o.pipelineSize = n
+	}
+}
+
+// Cmd sets the CmdFunc used to generate the commands which are performed.
+func Cmd(fn CmdFunc) Opt {
+	return func(o *opts) {
+		o.cmdFn = fn
+	}
+}
+
+// Result describes the outcome of a call to Run.
+type Result struct {
+	// Commands is the number of commands which were performed successfully.
+	Commands int
+
+	// Errors is the number of commands which returned an error, and Err is
+	// the first of those errors.
+	Errors int
+	Err    error
+
+	// Elapsed is the total amount of time which load was generated for.
+	Elapsed time.Duration
+
+	// Latencies contains the latency of every successful call to the
+	// Client's Do method, sorted in ascending order. When pipelining each
+	// latency is that of the whole pipeline.
+	Latencies []time.Duration
+}
+
+// Throughput returns the number of successful commands performed per second.
+func (r Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Commands) / r.Elapsed.Seconds()
+}
+
+// Percentile returns the latency at the given percentile, which should be
+// between 0 and 100 (e.g. 99.9). It returns 0 if there are no latencies.
+func (r Result) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p/100*float64(len(r.Latencies)))) - 1
+	if i < 0 {
+		i = 0
+	} else if i >= len(r.Latencies) {
+		i = len(r.Latencies) - 1
+	}
+	return r.Latencies[i]
+}
+
+type workerResult struct {
+	commands, errors int
+	err              error
+	latencies        []time.Duration
+}
+
+// Run generates load against the given Client until either the configured
+// number of commands have been performed or the configured duration has
+// elapsed, whichever comes first, and returns the Result.
+//
+// Run takes in a number of options which can overwrite its default behavior.
+// The default options Run uses are:
+//
+//	Concurrency(10)
+//	Requests(100000)
+//	Duration(0)
+//	PipelineSize(1)
+//	Cmd(SetCmdFunc(16))
+//
+func Run(client radix.Client, userOpts ...Opt) Result {
+	var o opts
+	defaultOpts := []Opt{
+		Concurrency(10),
+		Requests(100000),
+		Duration(0),
+		PipelineSize(1),
+		Cmd(SetCmdFunc(16)),
+	}
+	for _, opt := range append(defaultOpts, userOpts...) {
+		opt(&o)
+	}
+	if o.concurrency < 1 {
+		o.concurrency = 1
+	}
+	if o.pipelineSize < 1 {
+		o.pipelineSize = 1
+	}
+
+	// remaining is shared by all workers, each takes a batch of commands off
+	// of it at a time.
+	var remainingL sync.Mutex
+	remaining := o.requests
+	take := func() int {
+		if o.requests <= 0 {
+			return o.pipelineSize
+		}
+		remainingL.Lock()
+		defer remainingL.Unlock()
+		n := o.pipelineSize
+		if n > remaining {
+			n = remaining
+		}
+		remaining -= n
+		return n
+	}
+
+	var deadline time.Time
+	start := time.Now()
+	if o.duration > 0 {
+		deadline = start.Add(o.duration)
+	}
+
+	results := make([]workerResult, o.concurrency)
+	var wg sync.WaitGroup
+	for w := range results {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			results[w] = work(client, o, w, take, deadline)
+		}(w)
+	}
+	wg.Wait()
+
+	res := Result{Elapsed: time.Since(start)}
+	for _, wr := range results {
+		res.Commands += wr.commands
+		res.Errors += wr.errors
+		if res.Err == nil {
+			res.Err = wr.err
+		}
+		res.Latencies = append(res.Latencies, wr.latencies...)
+	}
+	sort.Slice(res.Latencies, func(i, j int) bool {
+		return res.Latencies[i] < res.Latencies[j]
+	})
+	return res
+}
+
+func work(client radix.Client, o opts, w int, take func() int, deadline time.Time) workerResult {
+	var wr workerResult
+	cmds := make([]radix.CmdAction, 0, o.pipelineSize)
+	for i := 0; ; {
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return wr
+		}
+
+		n := take()
+		if n == 0 {
+			return wr
+		}
+
+		cmds = cmds[:0]
+		for j := 0; j < n; j, i = j+1, i+1 {
+			cmds = append(cmds, o.cmdFn(w, i))
+		}
+
+		var a radix.Action = cmds[0]
+		if len(cmds) > 1 {
+			a = radix.Pipeline(cmds...)
+		}
+
+		start := time.Now()
+		if err := client.Do(a); err != nil {
+			wr.errors += n
+			if wr.err == nil {
+				wr.err = err
+			}
+			continue
+		}
+		wr.latencies = append(wr.latencies, time.Since(start))
+		wr.commands += n
+	}
+}
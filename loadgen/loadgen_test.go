@@ -0,0 +1,53 @@
+package loadgen
+
+import (
+	"sync/atomic"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+func stubPool(t *T, calls *int64) *radix.Pool {
+	pool, err := radix.NewPool("tcp", "127.0.0.1:6379", 2, radix.PoolConnFunc(
+		func(network, addr string) (radix.Conn, error) {
+			return radix.Stub(network, addr, func(args []string) interface{} {
+				atomic.AddInt64(calls, 1)
+				return "OK"
+			}), nil
+		},
+	))
+	require.NoError(t, err)
+	return pool
+}
+
+func TestRun(t *T) {
+	var calls int64
+	pool := stubPool(t, &calls)
+	defer pool.Close()
+
+	res := Run(pool, Concurrency(3), Requests(100), PipelineSize(7))
+	require.NoError(t, res.Err)
+	assert.Equal(t, 100, res.Commands)
+	assert.Equal(t, int64(100), atomic.LoadInt64(&calls))
+	// each worker takes batches of 7 off of the shared 100, the last batch
+	// having only 2.
+	assert.Len(t, res.Latencies, 15)
+	assert.True(t, res.Throughput() > 0)
+	assert.Equal(t, res.Latencies[len(res.Latencies)-1], res.Percentile(100))
+	assert.Equal(t, res.Latencies[0], res.Percentile(0))
+}
+
+func TestRunDuration(t *T) {
+	var calls int64
+	pool := stubPool(t, &calls)
+	defer pool.Close()
+
+	res := Run(pool, Requests(0), Duration(50*time.Millisecond))
+	require.NoError(t, res.Err)
+	assert.NotZero(t, res.Commands)
+	assert.True(t, res.Elapsed >= 50*time.Millisecond)
+}
@@ -0,0 +1,146 @@
+package radix
+
+import "context"
+
+// Metadata is a set of arbitrary key/values which can be attached to an Action
+// using WithMetadata, e.g. the tenant, endpoint or request ID on whose behalf
+// the Action is being performed. The Metadata of an Action is passed along to
+// trace callbacks, so that logging and metrics can be labeled with it.
+type Metadata map[string]string
+
+// MetadataAction is an Action which carries Metadata.
+type MetadataAction interface {
+	Action
+	Metadata() Metadata
+}
+
+// wrappedAction is implemented by Actions which wrap another Action, such as
+// those returned by ReadOnly, WithPriority and WithMetadata, so that the
+// properties of the wrapped Action can still be found.
+type wrappedAction interface {
+	unwrapAction() Action
+}
+
+// ActionMetadata returns the Metadata attached to the given Action, including
+// all Metadata attached by nested calls to WithMetadata. If the same key was
+// attached more than once then the outermost value is used. Returns nil if the
+// Action has no Metadata.
+func ActionMetadata(a Action) Metadata {
+	var md Metadata
+	for a != nil {
+		if mda, ok := a.(MetadataAction); ok {
+			for k, v := range mda.Metadata() {
+				if _, ok := md[k]; ok {
+					continue
+				} else if md == nil {
+					md = Metadata{}
+				}
+				md[k] = v
+			}
+		}
+		wa, ok := a.(wrappedAction)
+		if !ok {
+			break
+		}
+		a = wa.unwrapAction()
+	}
+	return md
+}
+
+type metadataAction struct {
+	Action
+	md Metadata
+}
+
+func (mda metadataAction) unwrapAction() Action {
+	return mda.Action
+}
+
+func (mda metadataAction) Metadata() Metadata {
+	return mda.md
+}
+
+func (mda metadataAction) ReadOnly() bool {
+	return isReadOnly(mda.Action)
+}
+
+func (mda metadataAction) ClusterCanRetry() bool {
+	return canClusterRetry(mda.Action)
+}
+
+type metadataCmdAction struct {
+	CmdAction
+	md Metadata
+}
+
+func (mda metadataCmdAction) unwrapAction() Action {
+	return mda.CmdAction
+}
+
+func (mda metadataCmdAction) Metadata() Metadata {
+	return mda.md
+}
+
+func (mda metadataCmdAction) ReadOnly() bool {
+	return isReadOnly(mda.CmdAction)
+}
+
+func (mda metadataCmdAction) ClusterCanRetry() bool {
+	return canClusterRetry(mda.CmdAction)
+}
+
+func (mda metadataCmdAction) ReceiveAttributes(attrs map[string]interface{}) {
+	receiveAttributes(mda.CmdAction, attrs)
+}
+
+// WithMetadata wraps the given Action such that it carries the given Metadata,
+// which can be retrieved using ActionMetadata. The Action is otherwise
+// performed as normal.
+//
+// If the given Action is a CmdAction then the returned Action will be as well.
+// NOTE that, as with any custom CmdAction, a Pool will not implicitly pipeline
+// the returned Action.
+func WithMetadata(a Action, md Metadata) Action {
+	if cmdA, ok := a.(CmdAction); ok {
+		return metadataCmdAction{CmdAction: cmdA, md: md}
+	}
+	return metadataAction{Action: a, md: md}
+}
+
+type metadataCtxKey struct{}
+
+// ContextWithMetadata returns a copy of the given Context which carries the
+// given Metadata, merged with any Metadata the Context already carries. This
+// allows Metadata to be set once, e.g. by HTTP middleware, and later attached
+// to Actions using WithContextMetadata.
+func ContextWithMetadata(ctx context.Context, md Metadata) context.Context {
+	if prev := MetadataFromContext(ctx); len(prev) > 0 {
+		merged := make(Metadata, len(prev)+len(md))
+		for k, v := range prev {
+			merged[k] = v
+		}
+		for k, v := range md {
+			merged[k] = v
+		}
+		md = merged
+	}
+	return context.WithValue(ctx, metadataCtxKey{}, md)
+}
+
+// MetadataFromContext returns the Metadata carried by the given Context, or
+// nil if it carries none.
+func MetadataFromContext(ctx context.Context) Metadata {
+	md, _ := ctx.Value(metadataCtxKey{}).(Metadata)
+	return md
+}
+
+// WithContextMetadata is a shortcut for attaching the Metadata carried by the
+// given Context to the given Action using WithMetadata. If the Context carries
+// no Metadata then the Action is returned as-is.
+func WithContextMetadata(ctx context.Context, a Action) Action {
+	md := MetadataFromContext(ctx)
+	if len(md) == 0 {
+		return a
+	}
+	return WithMetadata(a, md)
+}
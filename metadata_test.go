@@ -0,0 +1,67 @@
+package radix
+
+import (
+	"context"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mediocregopher/radix/v3/trace"
+)
+
+func TestActionMetadata(t *T) {
+	assert.Nil(t, ActionMetadata(Cmd(nil, "GET", "foo")))
+
+	a := WithMetadata(Cmd(nil, "GET", "foo"), Metadata{"tenant": "a"})
+	_, isCmdAction := a.(CmdAction)
+	assert.True(t, isCmdAction)
+	assert.True(t, isReadOnly(a))
+	assert.Equal(t, Metadata{"tenant": "a"}, ActionMetadata(a))
+
+	// nested Metadata is merged, with the outermost value taking precedence,
+	// and is visible through other wrappers.
+	a = WithMetadata(WithPriority(ReadOnly(a), PriorityHigh), Metadata{
+		"tenant":  "b",
+		"request": "1",
+	})
+	assert.Equal(t, Metadata{"tenant": "b", "request": "1"}, ActionMetadata(a))
+	assert.Equal(t, PriorityHigh, actionPriority(a))
+	assert.True(t, isReadOnly(a))
+
+	ctx := ContextWithMetadata(context.Background(), Metadata{"tenant": "a"})
+	ctx = ContextWithMetadata(ctx, Metadata{"request": "2"})
+	a = WithContextMetadata(ctx, Cmd(nil, "SET", "foo", "bar"))
+	assert.Equal(t, Metadata{"tenant": "a", "request": "2"}, ActionMetadata(a))
+	assert.False(t, isReadOnly(a))
+
+	a = Cmd(nil, "GET", "foo")
+	assert.Equal(t, a, WithContextMetadata(context.Background(), a))
+}
+
+func TestPoolDoCompletedMetadata(t *T) {
+	mdCh := make(chan Metadata, 1)
+	connFunc := func(network, addr string) (Conn, error) {
+		return Stub(network, addr, func(args []string) interface{} {
+			return "OK"
+		}), nil
+	}
+	pool, err := NewPool("tcp", "127.0.0.1:6379", 1,
+		PoolConnFunc(connFunc),
+		PoolPingInterval(0),
+		PoolWithTrace(trace.PoolTrace{
+			DoCompleted: func(dc trace.PoolDoCompleted) {
+				mdCh <- dc.Metadata
+			},
+		}),
+	)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	md := Metadata{"endpoint": "/foo"}
+	require.NoError(t, pool.Do(WithMetadata(Cmd(nil, "SET", "foo", "bar"), md)))
+	assert.Equal(t, md, <-mdCh)
+
+	require.NoError(t, pool.Do(Cmd(nil, "SET", "foo", "bar")))
+	assert.Nil(t, <-mdCh)
+}
@@ -0,0 +1,585 @@
+package radix
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+// ErrMuxQueueFull is used by MuxClients created using the MuxClientOnFullErrAfter
+// option.
+var ErrMuxQueueFull = errors.New("mux client queue is full")
+
+type muxClientOpts struct {
+	cf                 ConnFunc
+	conns              int
+	maxBatch, maxBytes int
+	flushDelay         time.Duration
+	maxQueue           int
+	onFullWait         time.Duration
+	errOnFull          bool
+}
+
+// MuxClientOpt is an optional behavior which can be applied to the
+// NewMuxClient function to effect a MuxClient's behavior.
+type MuxClientOpt func(*muxClientOpts)
+
+// MuxClientConnFunc tells the MuxClient to use the given ConnFunc when creating
+// its connections.
+func MuxClientConnFunc(cf ConnFunc) MuxClientOpt {
+	return func(mo *muxClientOpts) {
+		mo.cf = cf
+	}
+}
+
+// MuxClientConns tells the MuxClient how many connections it should multiplex
+// commands over. Commands are spread across the connections in a round-robin
+// fashion.
+func MuxClientConns(n int) MuxClientOpt {
+	return func(mo *muxClientOpts) {
+		mo.conns = n
+	}
+}
+
+// MuxClientMaxBatch tells the MuxClient the maximum number of commands, and
+// the approximate maximum number of bytes those commands may take up, which it
+// will write to a connection in a single batch. Smaller batches reduce the
+// latency of the commands in each batch, larger batches reduce the number of
+// system calls needed to write them.
+//
+// If maxBytes is zero then batches are only limited by the number of commands.
+// If maxCmds is less than 1 it is treated as 1.
+func MuxClientMaxBatch(maxCmds, maxBytes int) MuxClientOpt {
+	return func(mo *muxClientOpts) {
+		mo.maxBatch = maxCmds
+		mo.maxBytes = maxBytes
+	}
+}
+
+// MuxClientFlushDelay tells the MuxClient to wait up to the given duration for
+// more commands to be given to it before writing a batch of commands which
+// isn't yet full (see MuxClientMaxBatch). Very short delays, on the order of
+// 20-150µs, can significantly reduce the number of system calls made under
+// high concurrency, at the expense of the latency of each command.
+//
+// If the delay is zero then commands are written as soon as the connection is
+// ready for them, batching together only those commands which are already
+// waiting.
+func MuxClientFlushDelay(d time.Duration) MuxClientOpt {
+	return func(mo *muxClientOpts) {
+		mo.flushDelay = d
+	}
+}
+
+// MuxClientMaxQueue tells the MuxClient the maximum number of commands which
+// may be queued on each of its connections, including those which have been
+// written but whose responses haven't yet been read. This prevents commands,
+// and the go-routines waiting on them, from piling up without limit when the
+// redis instance stalls. What happens to commands once the queue is full is
+// determined by MuxClientOnFullWait and MuxClientOnFullErrAfter.
+//
+// If n is zero then the queue is unlimited.
+func MuxClientMaxQueue(n int) MuxClientOpt {
+	return func(mo *muxClientOpts) {
+		mo.maxQueue = n
+	}
+}
+
+// MuxClientOnFullWait effects the MuxClient's behavior when the queue of a
+// connection is full (see MuxClientMaxQueue). The effect is to cause commands
+// to block until there is room in the queue, or until the Context given to
+// DoContext is canceled.
+func MuxClientOnFullWait() MuxClientOpt {
+	return func(mo *muxClientOpts) {
+		mo.onFullWait = -1
+		mo.errOnFull = false
+	}
+}
+
+// MuxClientOnFullErrAfter effects the MuxClient's behavior when the queue of a
+// connection is full (see MuxClientMaxQueue). The effect is to cause commands
+// to block until there is room in the queue, or until the duration has passed,
+// in which case ErrMuxQueueFull is returned. This allows load to be shed
+// while the redis instance is stalled.
+//
+// If wait is 0 then ErrMuxQueueFull is returned immediately upon a full
+// queue.
+func MuxClientOnFullErrAfter(wait time.Duration) MuxClientOpt {
+	return func(mo *muxClientOpts) {
+		mo.onFullWait = wait
+		mo.errOnFull = true
+	}
+}
+
+// MuxClient is a Client which multiplexes the commands of all go-routines using
+// it over a small, fixed number of connections, rather than giving each
+// go-routine exclusive use of a connection as Pool does.
+//
+// Each connection has a writer go-routine, which writes commands to the
+// connection in batches as they are given to Do, and a reader go-routine,
+// which reads responses and hands them back to the waiting calls to Do. This
+// keeps the number of connections small while still allowing high throughput
+// from many concurrent go-routines.
+//
+// Actions which are created by Cmd or FlatCmd are multiplexed, with the
+// exception of blocking commands (e.g. BLPOP). All other Actions, including
+// blocking commands, are performed with exclusive use of a connection: the
+// connection waits for all commands already written to it to complete, the
+// Action is performed, and then multiplexing continues. Long running Actions
+// will therefore block other commands on the same connection, and should be
+// performed using a separate Pool.
+//
+// If a connection encounters a network error all commands which were waiting
+// on it will return that error, and the connection will be replaced the next
+// time it is used.
+type MuxClient struct {
+	// Atomic fields must be at the beginning of the struct since they must be
+	// correctly aligned or else access may cause panics on 32-bit architectures
+	// See https://golang.org/pkg/sync/atomic/#pkg-note-BUG
+	next uint64 // atomic, used for round-robin selection of connections
+
+	mo            muxClientOpts
+	network, addr string
+
+	l      sync.RWMutex
+	conns  []*muxConn
+	closed bool
+}
+
+var _ Client = new(MuxClient)
+
+// NewMuxClient creates a MuxClient whose connections are created using the
+// given network and address. All connections are created before NewMuxClient
+// returns, and an error is returned if any fail to be created.
+//
+// NewMuxClient takes in a number of options which can overwrite its default
+// behavior. The default options NewMuxClient uses are:
+//
+//	MuxClientConnFunc(DefaultConnFunc)
+//	MuxClientConns(1)
+//	MuxClientMaxBatch(128, 0)
+//	MuxClientFlushDelay(0)
+//	MuxClientMaxQueue(0)
+//	MuxClientOnFullWait()
+func NewMuxClient(network, addr string, opts ...MuxClientOpt) (*MuxClient, error) {
+	m := &MuxClient{
+		network: network,
+		addr:    addr,
+	}
+
+	defaultMuxClientOpts := []MuxClientOpt{
+		MuxClientConnFunc(DefaultConnFunc),
+		MuxClientConns(1),
+		MuxClientMaxBatch(128, 0),
+		MuxClientFlushDelay(0),
+		MuxClientMaxQueue(0),
+		MuxClientOnFullWait(),
+	}
+
+	for _, opt := range append(defaultMuxClientOpts, opts...) {
+		if opt != nil {
+			opt(&(m.mo))
+		}
+	}
+
+	if m.mo.conns < 1 {
+		m.mo.conns = 1
+	}
+	if m.mo.maxBatch < 1 {
+		m.mo.maxBatch = 1
+	}
+
+	m.conns = make([]*muxConn, m.mo.conns)
+	for i := range m.conns {
+		mc, err := m.newMuxConn()
+		if err != nil {
+			for _, mc := range m.conns[:i] {
+				mc.close(ErrClientClosed)
+			}
+			return nil, err
+		}
+		m.conns[i] = mc
+	}
+
+	return m, nil
+}
+
+func (m *MuxClient) newMuxConn() (*muxConn, error) {
+	conn, err := m.mo.cf(m.network, m.addr)
+	if err != nil {
+		return nil, err
+	}
+	return newMuxConn(conn, m.mo), nil
+}
+
+// conn returns the next muxConn to use, replacing it first if it has died.
+func (m *MuxClient) conn() (*muxConn, error) {
+	i := int(atomic.AddUint64(&m.next, 1) % uint64(m.mo.conns))
+
+	m.l.RLock()
+	if m.closed {
+		m.l.RUnlock()
+		return nil, ErrClientClosed
+	}
+	mc := m.conns[i]
+	m.l.RUnlock()
+
+	if !mc.isDead() {
+		return mc, nil
+	}
+
+	m.l.Lock()
+	defer m.l.Unlock()
+	if m.closed {
+		return nil, ErrClientClosed
+	} else if mc = m.conns[i]; !mc.isDead() {
+		// someone else replaced it already
+		return mc, nil
+	}
+
+	newMC, err := m.newMuxConn()
+	if err != nil {
+		return nil, err
+	}
+	m.conns[i] = newMC
+	return newMC, nil
+}
+
+// muxable returns true if the given Action can be multiplexed with others over
+// the same connection.
+func muxable(a Action) bool {
+	cmdA, ok := a.(*cmdAction)
+	return ok && !blockingCmds[strings.ToUpper(cmdA.cmd)]
+}
+
+// Do implements the method for the Client interface.
+func (m *MuxClient) Do(a Action) error {
+	return m.DoContext(context.Background(), a)
+}
+
+// DoContext is like Do, but if the queue of the connection the Action would be
+// performed on is full (see MuxClientMaxQueue) then it will stop waiting for
+// room in the queue once the Context is canceled, and return the Context's
+// error. Once the Action has been queued the Context has no effect, as the
+// command may already have been written to the connection.
+func (m *MuxClient) DoContext(ctx context.Context, a Action) error {
+	mc, err := m.conn()
+	if err != nil {
+		return err
+	}
+	return mc.do(ctx, a, !muxable(a))
+}
+
+// Close implements the method for the Client interface. Any commands which are
+// still waiting on a response will return an error.
+func (m *MuxClient) Close() error {
+	m.l.Lock()
+	defer m.l.Unlock()
+	if m.closed {
+		return ErrClientClosed
+	}
+	m.closed = true
+	for _, mc := range m.conns {
+		mc.close(ErrClientClosed)
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type muxReq struct {
+	a         Action
+	exclusive bool
+	size      int // only set if there is a maxBytes limit
+	resCh     chan error
+}
+
+var muxReqPool = sync.Pool{
+	New: func() interface{} {
+		// using a buffer of 1 is faster than no buffer in most cases
+		return &muxReq{resCh: make(chan error, 1)}
+	},
+}
+
+type muxConn struct {
+	conn Conn
+	mo   muxClientOpts
+
+	// queue limits the number of requests which are queued or pending, it's
+	// nil if there's no limit.
+	queue chan struct{}
+
+	// reqCh is read by the writer, which passes written requests on to the
+	// reader via pendingCh.
+	reqCh     chan *muxReq
+	pendingCh chan *muxReq
+	pendingWG sync.WaitGroup
+
+	// l protects dead, which is set once the writer has stopped accepting
+	// requests.
+	l    sync.RWMutex
+	dead bool
+
+	deadCh   chan struct{}
+	deadOnce sync.Once
+	deadErr  error
+}
+
+func newMuxConn(conn Conn, mo muxClientOpts) *muxConn {
+	mc := &muxConn{
+		conn:      conn,
+		mo:        mo,
+		reqCh:     make(chan *muxReq, mo.maxBatch),
+		pendingCh: make(chan *muxReq, mo.maxBatch),
+		deadCh:    make(chan struct{}),
+	}
+	if mo.maxQueue > 0 {
+		mc.queue = make(chan struct{}, mo.maxQueue)
+	}
+	go mc.writeLoop()
+	go mc.readLoop()
+	return mc
+}
+
+// close closes the underlying connection and causes all pending and future
+// requests to return the given error.
+func (mc *muxConn) close(err error) {
+	mc.deadOnce.Do(func() {
+		mc.deadErr = err
+		mc.conn.Close()
+		close(mc.deadCh)
+	})
+}
+
+func (mc *muxConn) isDead() bool {
+	select {
+	case <-mc.deadCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// enqueue waits for there to be room in the queue, as determined by the
+// MuxClientOnFull options.
+func (mc *muxConn) enqueue(ctx context.Context) error {
+	select {
+	case mc.queue <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if mc.mo.errOnFull && mc.mo.onFullWait <= 0 {
+		return ErrMuxQueueFull
+	}
+
+	var timerCh <-chan time.Time
+	if mc.mo.errOnFull {
+		timer := getTimer(mc.mo.onFullWait)
+		defer putTimer(timer)
+		timerCh = timer.C
+	}
+
+	select {
+	case mc.queue <- struct{}{}:
+		return nil
+	case <-timerCh:
+		return ErrMuxQueueFull
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-mc.deadCh:
+		return mc.deadErr
+	}
+}
+
+func (mc *muxConn) do(ctx context.Context, a Action, exclusive bool) error {
+	if mc.queue != nil {
+		if err := mc.enqueue(ctx); err != nil {
+			return err
+		}
+		defer func() { <-mc.queue }()
+	}
+
+	req := muxReqPool.Get().(*muxReq)
+	req.a, req.exclusive, req.size = a, exclusive, 0
+	if !exclusive && mc.mo.maxBytes > 0 {
+		req.size = a.(*cmdAction).approxSize()
+	}
+
+	mc.l.RLock()
+	if mc.dead {
+		mc.l.RUnlock()
+		muxReqPool.Put(req)
+		return mc.deadErr
+	}
+	select {
+	case mc.reqCh <- req:
+	case <-mc.deadCh:
+		mc.l.RUnlock()
+		muxReqPool.Put(req)
+		return mc.deadErr
+	}
+	mc.l.RUnlock()
+
+	err := <-req.resCh
+	req.a = nil
+	muxReqPool.Put(req)
+	return err
+}
+
+func (mc *muxConn) writeLoop() {
+	wConn := &ioErrConn{Conn: mc.conn}
+	batch := make(pipeline, 0, mc.mo.maxBatch)
+	reqs := make([]*muxReq, 0, mc.mo.maxBatch)
+
+	var timer *time.Timer
+	if mc.mo.flushDelay > 0 {
+		timer = getTimer(time.Hour)
+		timer.Stop()
+		defer putTimer(timer)
+	}
+
+	defer func() {
+		close(mc.pendingCh)
+
+		// once dead is set no more requests will be added to reqCh, so it can
+		// be safely drained.
+		mc.l.Lock()
+		mc.dead = true
+		mc.l.Unlock()
+		for {
+			select {
+			case req := <-mc.reqCh:
+				req.resCh <- mc.deadErr
+			default:
+				return
+			}
+		}
+	}()
+
+	// next is an exclusive request which was encountered while gathering a
+	// batch, and which must be performed before any further requests.
+	var next *muxReq
+	for {
+		req := next
+		if next = nil; req == nil {
+			select {
+			case req = <-mc.reqCh:
+			case <-mc.deadCh:
+				return
+			}
+		}
+
+		if req.exclusive {
+			if !mc.runExclusive(wConn, req) {
+				return
+			}
+			continue
+		}
+
+		// gather up as many requests as are immediately available, or which
+		// become available within the flush delay, stopping at any exclusive
+		// one.
+		reqs, batch = append(reqs[:0], req), append(batch[:0], req.a.(CmdAction))
+		size := req.size
+		var timerCh <-chan time.Time
+		if timer != nil {
+			timer.Reset(mc.mo.flushDelay)
+			timerCh = timer.C
+		}
+	gather:
+		for len(reqs) < mc.mo.maxBatch && (mc.mo.maxBytes <= 0 || size < mc.mo.maxBytes) {
+			if timerCh == nil {
+				select {
+				case req = <-mc.reqCh:
+				default:
+					break gather
+				}
+			} else {
+				select {
+				case req = <-mc.reqCh:
+				case <-timerCh:
+					timerCh = nil
+					break gather
+				case <-mc.deadCh:
+					break gather
+				}
+			}
+
+			if req.exclusive {
+				next = req
+				break gather
+			}
+			reqs, batch = append(reqs, req), append(batch, req.a.(CmdAction))
+			size += req.size
+		}
+		if timer != nil && timerCh != nil && !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+
+		if !mc.writeBatch(wConn, batch, reqs) {
+			if next != nil {
+				next.resCh <- mc.deadErr
+			}
+			return
+		}
+	}
+}
+
+// runExclusive performs the exclusive request, returning false if the
+// connection has died.
+func (mc *muxConn) runExclusive(wConn *ioErrConn, req *muxReq) bool {
+	mc.pendingWG.Wait()
+	if mc.isDead() {
+		req.resCh <- mc.deadErr
+		return false
+	}
+	// req mustn't be touched once its result has been sent, as the caller
+	// will have put it back in muxReqPool.
+	err := req.a.Run(wConn)
+	if cErr := withConnCanceled(req.a); cErr != nil {
+		wConn.discard(cErr)
+	}
+	req.resCh <- err
+	if wConn.lastIOErr != nil {
+		mc.close(wConn.lastIOErr)
+		return false
+	}
+	return true
+}
+
+// writeBatch hands the requests off to the reader and writes their commands
+// to the connection, returning false if the connection has died.
+func (mc *muxConn) writeBatch(wConn *ioErrConn, batch pipeline, reqs []*muxReq) bool {
+	mc.pendingWG.Add(len(reqs))
+	for _, req := range reqs {
+		mc.pendingCh <- req
+	}
+	if err := wConn.Encode(batch); err != nil {
+		mc.close(err)
+		return false
+	}
+	return true
+}
+
+func (mc *muxConn) readLoop() {
+	rConn := &ioErrConn{Conn: mc.conn}
+	for req := range mc.pendingCh {
+		if mc.isDead() {
+			req.resCh <- mc.deadErr
+		} else if err := rConn.Decode(req.a.(CmdAction)); rConn.lastIOErr != nil {
+			mc.close(rConn.lastIOErr)
+			req.resCh <- mc.deadErr
+		} else {
+			req.resCh <- err
+		}
+		mc.pendingWG.Done()
+	}
+}
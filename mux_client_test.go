@@ -0,0 +1,230 @@
+package radix
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mediocregopher/radix/v3/resp"
+)
+
+// muxClientStub returns a ConnFunc which creates stub Conns backed by a shared
+// in-memory key-value store, along with a function which returns the Conns
+// created so far.
+func muxClientStub() (ConnFunc, func() []Conn) {
+	var l sync.Mutex
+	m := map[string]string{}
+	var conns []Conn
+
+	cf := func(network, addr string) (Conn, error) {
+		conn := Stub(network, addr, func(args []string) interface{} {
+			l.Lock()
+			defer l.Unlock()
+			switch args[0] {
+			case "SET":
+				m[args[1]] = args[2]
+				return "OK"
+			case "GET":
+				return m[args[1]]
+			case "INCR":
+				i, _ := strconv.Atoi(m[args[1]])
+				m[args[1]] = strconv.Itoa(i + 1)
+				return i + 1
+			default:
+				return "OK"
+			}
+		})
+		l.Lock()
+		conns = append(conns, conn)
+		l.Unlock()
+		return conn, nil
+	}
+
+	getConns := func() []Conn {
+		l.Lock()
+		defer l.Unlock()
+		return append([]Conn(nil), conns...)
+	}
+	return cf, getConns
+}
+
+func TestMuxClient(t *T) {
+	cf, getConns := muxClientStub()
+	m, err := NewMuxClient("tcp", "127.0.0.1:6379", MuxClientConnFunc(cf), MuxClientConns(2))
+	require.NoError(t, err)
+	defer m.Close()
+	assert.Len(t, getConns(), 2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := "key" + strconv.Itoa(i)
+			for j := 0; j < 20; j++ {
+				val := strconv.Itoa(j)
+				assert.NoError(t, m.Do(Cmd(nil, "SET", key, val)))
+				var res string
+				assert.NoError(t, m.Do(Cmd(&res, "GET", key)))
+				assert.Equal(t, val, res)
+				assert.NoError(t, m.Do(Cmd(nil, "INCR", "counter")))
+
+				// every so often perform an Action requiring exclusive use of
+				// the connection
+				if j%5 == 0 {
+					assert.NoError(t, m.Do(WithConn(key, func(c Conn) error {
+						var res string
+						if err := c.Do(Cmd(&res, "GET", key)); err != nil {
+							return err
+						}
+						assert.Equal(t, val, res)
+						return nil
+					})))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var counter int
+	require.NoError(t, m.Do(Cmd(&counter, "GET", "counter")))
+	assert.Equal(t, 50*20, counter)
+}
+
+func TestMuxClientConnDeath(t *T) {
+	cf, getConns := muxClientStub()
+	m, err := NewMuxClient("tcp", "127.0.0.1:6379", MuxClientConnFunc(cf))
+	require.NoError(t, err)
+	defer m.Close()
+
+	require.NoError(t, m.Do(Cmd(nil, "SET", "foo", "bar")))
+
+	// closing the connection out from under the MuxClient should cause the
+	// next command to fail, and the one after to use a new connection
+	getConns()[0].Close()
+	assert.Error(t, m.Do(Cmd(nil, "GET", "foo")))
+
+	var res string
+	require.NoError(t, m.Do(Cmd(&res, "GET", "foo")))
+	assert.Equal(t, "bar", res)
+	assert.Len(t, getConns(), 2)
+
+	require.NoError(t, m.Close())
+	assert.Equal(t, ErrClientClosed, m.Do(Cmd(nil, "GET", "foo")))
+}
+
+type batchRecordingConn struct {
+	Conn
+	l       sync.Mutex
+	batches []int
+}
+
+func (c *batchRecordingConn) Encode(m resp.Marshaler) error {
+	if p, ok := m.(pipeline); ok {
+		c.l.Lock()
+		c.batches = append(c.batches, len(p))
+		c.l.Unlock()
+	}
+	return c.Conn.Encode(m)
+}
+
+func TestMuxClientBatching(t *T) {
+	cf, _ := muxClientStub()
+	test := func(t *T, n int, expBatches []int, opts ...MuxClientOpt) {
+		conn := new(batchRecordingConn)
+		opts = append(opts, MuxClientConnFunc(func(network, addr string) (Conn, error) {
+			var err error
+			conn.Conn, err = cf(network, addr)
+			return conn, err
+		}))
+		m, err := NewMuxClient("tcp", "127.0.0.1:6379", opts...)
+		require.NoError(t, err)
+		defer m.Close()
+
+		// the flush delay is long enough that, if the batch limits weren't
+		// honored, the commands would take much longer
+		start := time.Now()
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, m.Do(Cmd(nil, "SET", "foo", strings.Repeat("a", 50))))
+			}()
+		}
+		wg.Wait()
+		assert.True(t, time.Since(start) < 5*time.Second)
+
+		conn.l.Lock()
+		defer conn.l.Unlock()
+		assert.Equal(t, expBatches, conn.batches)
+	}
+
+	t.Run("maxCmds", func(t *T) {
+		test(t, 3, []int{3}, MuxClientFlushDelay(10*time.Second), MuxClientMaxBatch(3, 0))
+	})
+	t.Run("maxBytes", func(t *T) {
+		test(t, 2, []int{2}, MuxClientFlushDelay(10*time.Second), MuxClientMaxBatch(100, 100))
+	})
+}
+
+func TestMuxClientMaxQueue(t *T) {
+	// the stub blocks on GET until unblocked, so that the queue fills up.
+	unblockCh := make(chan struct{})
+	cf := func(network, addr string) (Conn, error) {
+		return Stub(network, addr, func(args []string) interface{} {
+			if args[0] == "GET" {
+				<-unblockCh
+			}
+			return "OK"
+		}), nil
+	}
+
+	newMuxClient := func(opts ...MuxClientOpt) *MuxClient {
+		opts = append([]MuxClientOpt{MuxClientConnFunc(cf), MuxClientMaxQueue(1)}, opts...)
+		m, err := NewMuxClient("tcp", "127.0.0.1:6379", opts...)
+		require.NoError(t, err)
+		return m
+	}
+
+	// fillQueue performs a GET, which occupies the queue until unblocked,
+	// returning the channel its result will be written to.
+	fillQueue := func(m *MuxClient) chan error {
+		errCh := make(chan error, 1)
+		go func() { errCh <- m.Do(Cmd(nil, "GET", "foo")) }()
+		time.Sleep(50 * time.Millisecond)
+		return errCh
+	}
+
+	t.Run("errAfter", func(t *T) {
+		m := newMuxClient(MuxClientOnFullErrAfter(10 * time.Millisecond))
+		defer m.Close()
+		errCh := fillQueue(m)
+		assert.Equal(t, ErrMuxQueueFull, m.Do(Cmd(nil, "SET", "foo", "bar")))
+		unblockCh <- struct{}{}
+		assert.NoError(t, <-errCh)
+		assert.NoError(t, m.Do(Cmd(nil, "SET", "foo", "bar")))
+	})
+
+	t.Run("wait", func(t *T) {
+		m := newMuxClient()
+		defer m.Close()
+		errCh := fillQueue(m)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.Equal(t, context.DeadlineExceeded, m.DoContext(ctx, Cmd(nil, "SET", "foo", "bar")))
+
+		setErrCh := make(chan error, 1)
+		go func() { setErrCh <- m.Do(Cmd(nil, "SET", "foo", "bar")) }()
+		unblockCh <- struct{}{}
+		assert.NoError(t, <-errCh)
+		assert.NoError(t, <-setErrCh)
+	})
+}
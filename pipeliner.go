@@ -21,6 +21,10 @@ var blockingCmds = map[string]bool{
 	"BZPOPMIN": true,
 	"BZPOPMAX": true,
 
+	"BLMOVE": true,
+	"BLMPOP": true,
+	"BZMPOP": true,
+
 	"XREAD":      true,
 	"XREADGROUP": true,
 
@@ -30,8 +34,9 @@ var blockingCmds = map[string]bool{
 type pipeliner struct {
 	c Client
 
-	limit  int
-	window time.Duration
+	limit    int
+	maxBytes int
+	window   time.Duration
 
 	// reqsBufCh contains buffers for collecting commands and acts as a semaphore
 	// to limit the number of concurrent flushes.
@@ -46,7 +51,7 @@ type pipeliner struct {
 
 var _ Client = (*pipeliner)(nil)
 
-func newPipeliner(c Client, concurrency, limit int, window time.Duration) *pipeliner {
+func newPipeliner(c Client, concurrency, limit, maxBytes int, window time.Duration) *pipeliner {
 	if concurrency < 1 {
 		concurrency = 1
 	}
@@ -54,8 +59,9 @@ func newPipeliner(c Client, concurrency, limit int, window time.Duration) *pipel
 	p := &pipeliner{
 		c: c,
 
-		limit:  limit,
-		window: window,
+		limit:    limit,
+		maxBytes: maxBytes,
+		window:   window,
 
 		reqsBufCh: make(chan []CmdAction, concurrency),
 
@@ -97,11 +103,14 @@ func (p *pipeliner) CanDo(a Action) bool {
 // If a is not a CmdAction, Do panics.
 func (p *pipeliner) Do(a Action) error {
 	req := getPipelinerCmd(a.(CmdAction)) // get this outside the lock to avoid
+	if p.maxBytes > 0 {
+		req.size = a.(*cmdAction).approxSize()
+	}
 
 	p.l.RLock()
 	if p.closed {
 		p.l.RUnlock()
-		return errClientClosed
+		return ErrClientClosed
 	}
 	p.reqCh <- req
 	p.l.RUnlock()
@@ -145,6 +154,7 @@ func (p *pipeliner) reqLoop() {
 		p.reqsBufCh <- reqs
 	}()
 
+	var size int
 	for {
 		select {
 		case req, ok := <-p.reqCh:
@@ -154,17 +164,18 @@ func (p *pipeliner) reqLoop() {
 			}
 
 			reqs = append(reqs, req)
+			size += req.size
 
-			if p.limit > 0 && len(reqs) == p.limit {
+			if (p.limit > 0 && len(reqs) == p.limit) || (p.maxBytes > 0 && size >= p.maxBytes) {
 				// if we reached the pipeline limit, execute now to avoid unnecessary waiting
 				t.Stop()
 
-				reqs = p.flush(reqs)
+				reqs, size = p.flush(reqs), 0
 			} else if len(reqs) == 1 {
 				t.Reset(p.window)
 			}
 		case <-t.C:
-			reqs = p.flush(reqs)
+			reqs, size = p.flush(reqs), 0
 		}
 	}
 }
@@ -195,6 +206,10 @@ type pipelinerCmd struct {
 
 	resCh chan error
 
+	// approximate size of the command, only set if the pipeliner has a
+	// maxBytes limit.
+	size int
+
 	unmarshalCalled bool
 	unmarshalErr    error
 }
@@ -207,6 +222,10 @@ func (p *pipelinerCmd) sendRes(err error) {
 	p.resCh <- err
 }
 
+func (p *pipelinerCmd) ReceiveAttributes(attrs map[string]interface{}) {
+	receiveAttributes(p.CmdAction, attrs)
+}
+
 func (p *pipelinerCmd) UnmarshalRESP(br *bufio.Reader) error {
 	p.unmarshalErr = p.CmdAction.UnmarshalRESP(br)
 	p.unmarshalCalled = true // important: we set this after unmarshalErr in case the call to UnmarshalRESP panics
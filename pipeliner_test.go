@@ -4,11 +4,14 @@ import (
 	"bufio"
 	"io"
 	"net"
+	"strings"
+	"sync"
 	. "testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
 )
 
 type panicingCmdAction struct {
@@ -142,6 +145,7 @@ func TestPipeliner(t *T) {
 		require.IsType(t, (*net.OpError)(nil), secondPopErr)
 		require.True(t, secondPopErr.(net.Error).Temporary())
 		require.True(t, secondPopErr.(net.Error).Timeout())
+		require.True(t, errors.Is(secondPopErr, ErrTimeout))
 		assert.Empty(t, secondPopResult)
 
 		thirdPopErr := <-thirdPopCmd.resCh
@@ -156,7 +160,7 @@ func TestPipeliner(t *T) {
 			conn := dial(dialOpts...)
 			defer conn.Close()
 
-			p := newPipeliner(conn, 0, 0, 0)
+			p := newPipeliner(conn, 0, 0, 0, 0)
 			defer p.Close()
 
 			testMarshalPanic(t, p)
@@ -166,7 +170,7 @@ func TestPipeliner(t *T) {
 			conn := dial(dialOpts...)
 			defer conn.Close()
 
-			p := newPipeliner(conn, 0, 0, 0)
+			p := newPipeliner(conn, 0, 0, 0, 0)
 			defer p.Close()
 
 			testUnmarshalPanic(t, p)
@@ -176,7 +180,7 @@ func TestPipeliner(t *T) {
 			conn := dial(dialOpts...)
 			defer conn.Close()
 
-			p := newPipeliner(conn, 0, 0, 0)
+			p := newPipeliner(conn, 0, 0, 0, 0)
 			defer p.Close()
 
 			testRecoverableError(t, p)
@@ -186,7 +190,7 @@ func TestPipeliner(t *T) {
 			conn := dial(dialOpts...)
 			defer conn.Close()
 
-			p := newPipeliner(conn, 0, 0, 0)
+			p := newPipeliner(conn, 0, 0, 0, 0)
 			defer p.Close()
 
 			testTimeout(t, p)
@@ -233,3 +237,40 @@ func TestPipeliner(t *T) {
 		})
 	})
 }
+
+type pipelineRecordingClient struct {
+	Conn
+	l     sync.Mutex
+	sizes []int
+}
+
+func (c *pipelineRecordingClient) Do(a Action) error {
+	c.l.Lock()
+	c.sizes = append(c.sizes, len(a.(*pipelinerPipeline).pipeline))
+	c.l.Unlock()
+	return c.Conn.Do(a)
+}
+
+func TestPipelinerMaxBytes(t *T) {
+	client := &pipelineRecordingClient{
+		Conn: Stub("tcp", "127.0.0.1:6379", func([]string) interface{} {
+			return "OK"
+		}),
+	}
+
+	// the window is long enough that only the byte limit could cause a flush
+	p := newPipeliner(client, 1, 0, 100, time.Hour)
+	defer p.Close()
+
+	val := strings.Repeat("a", 50)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, p.Do(Cmd(nil, "SET", "foo", val)))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, []int{2}, client.sizes)
+}
@@ -0,0 +1,284 @@
+package radix
+
+import (
+	"strings"
+
+	"github.com/mediocregopher/radix/v3/resp"
+)
+
+// PolicyViolationError is returned by Clients created with EnforcePolicy when
+// an Action would perform a command, or act on a key, which the policy
+// doesn't allow.
+type PolicyViolationError struct {
+	// Cmd is the uppercased name of the command which isn't allowed, or empty
+	// if it's a key which isn't allowed.
+	Cmd string
+
+	// Key is the key which isn't allowed, or empty if it's a command which
+	// isn't allowed.
+	Key string
+}
+
+func (e *PolicyViolationError) Error() string {
+	if e.Cmd != "" {
+		return "command " + e.Cmd + " is not allowed by policy"
+	}
+	return "key " + e.Key + " is not allowed by policy"
+}
+
+type policyOpts struct {
+	allowCmds, denyCmds map[string]bool
+	allowKeys, denyKeys []string
+}
+
+// PolicyOpt is an optional behavior which can be applied to the EnforcePolicy
+// function to determine what it allows.
+type PolicyOpt func(*policyOpts)
+
+func policyCmdSet(m map[string]bool, cmds []string) map[string]bool {
+	if m == nil {
+		m = map[string]bool{}
+	}
+	for _, cmd := range cmds {
+		m[strings.ToUpper(cmd)] = true
+	}
+	return m
+}
+
+// PolicyAllowCommands tells EnforcePolicy to only allow the given commands. If
+// it's used more than once the commands given to each are allowed. If it's not
+// used then all commands not denied by PolicyDenyCommands are allowed.
+func PolicyAllowCommands(cmds ...string) PolicyOpt {
+	return func(po *policyOpts) {
+		po.allowCmds = policyCmdSet(po.allowCmds, cmds)
+	}
+}
+
+// PolicyDenyCommands tells EnforcePolicy to not allow the given commands, even
+// if they're given to PolicyAllowCommands.
+func PolicyDenyCommands(cmds ...string) PolicyOpt {
+	return func(po *policyOpts) {
+		po.denyCmds = policyCmdSet(po.denyCmds, cmds)
+	}
+}
+
+// PolicyAllowKeys tells EnforcePolicy to only allow Actions whose keys all
+// match at least one of the given glob-style patterns, which are matched the
+// same way as redis matches the patterns given to KEYS or SCAN. If it's used
+// more than once the patterns given to each are allowed. If it's not used then
+// all keys not denied by PolicyDenyKeys are allowed.
+//
+// Some commands act on keys which aren't given as arguments, e.g. KEYS, SCAN,
+// RANDOMKEY or FLUSHDB, and so can't be checked against the patterns. These
+// should be denied, or not allowed, when key patterns are used.
+func PolicyAllowKeys(patterns ...string) PolicyOpt {
+	return func(po *policyOpts) {
+		po.allowKeys = append(po.allowKeys, patterns...)
+	}
+}
+
+// PolicyDenyKeys tells EnforcePolicy to not allow Actions with any keys which
+// match any of the given glob-style patterns, even if they match patterns given
+// to PolicyAllowKeys.
+func PolicyDenyKeys(patterns ...string) PolicyOpt {
+	return func(po *policyOpts) {
+		po.denyKeys = append(po.denyKeys, patterns...)
+	}
+}
+
+func (po *policyOpts) check(props Properties) error {
+	for _, cmd := range props.Commands {
+		if po.denyCmds[cmd] || (po.allowCmds != nil && !po.allowCmds[cmd]) {
+			return &PolicyViolationError{Cmd: cmd}
+		}
+	}
+	for _, key := range props.Keys {
+		if globMatchAny(po.denyKeys, key) ||
+			(po.allowKeys != nil && !globMatchAny(po.allowKeys, key)) {
+			return &PolicyViolationError{Key: key}
+		}
+	}
+	return nil
+}
+
+// EnforcePolicy wraps the given Client so that Actions which would perform a
+// command, or act on a key, which isn't allowed by the policy described by the
+// given options return a *PolicyViolationError rather than being sent. This
+// allows restricted Clients to be handed out, e.g. to the tenants of a
+// multi-tenant platform. With no options all Actions are allowed.
+//
+// Actions whose commands can't be known ahead of time, such as those created
+// by WithConn, are checked as each command is written to the connection.
+func EnforcePolicy(c Client, opts ...PolicyOpt) Client {
+	var po policyOpts
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&po)
+		}
+	}
+	return checkedClient{Client: c, check: po.check}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// checkedClient checks the Properties of every Action performed on it, only
+// performing those for which check returns nil.
+type checkedClient struct {
+	Client
+	check func(Properties) error
+}
+
+func (cc checkedClient) Do(a Action) error {
+	if props := ActionProperties(a); len(props.Commands) > 0 {
+		if err := cc.check(props); err != nil {
+			return err
+		}
+		return cc.Client.Do(a)
+	}
+	return cc.Client.Do(checkedAction{Action: a, check: cc.check})
+}
+
+// checkedAction wraps an Action whose commands aren't known ahead of time, so
+// that they can be checked as they're written.
+type checkedAction struct {
+	Action
+	check func(Properties) error
+}
+
+func (ca checkedAction) unwrapAction() Action {
+	return ca.Action
+}
+
+func (ca checkedAction) Run(c Conn) error {
+	return ca.Action.Run(checkedConn{Conn: c, check: ca.check})
+}
+
+type checkedConn struct {
+	Conn
+	check func(Properties) error
+}
+
+func (cc checkedConn) Encode(m resp.Marshaler) error {
+	if a, ok := m.(Action); ok {
+		if props := ActionProperties(a); len(props.Commands) > 0 {
+			if err := cc.check(props); err != nil {
+				return err
+			}
+			return cc.Conn.Encode(m)
+		}
+	}
+
+	// unlike with ProxyCompat, anything which can't be identified has to be
+	// unmarshaled to find its commands and keys, since otherwise checks could
+	// be bypassed by encoding commands directly.
+	cmds, err := unmarshalCmds(m)
+	if err != nil {
+		return err
+	}
+	for _, args := range cmds {
+		if len(args) == 0 {
+			continue
+		} else if err := cc.check(ActionProperties(Cmd(nil, args[0], args[1:]...))); err != nil {
+			return err
+		}
+	}
+	return cc.Conn.Encode(m)
+}
+
+func (cc checkedConn) Do(a Action) error {
+	return a.Run(cc)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func globMatchAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if globMatch(pattern, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch reports whether s matches the glob-style pattern, using the same
+// rules as redis: '*' matches any sequence of characters, '?' matches any
+// single character, '[...]' matches any character in the set (which may
+// contain ranges like a-z, and may be negated with a leading '^'), and '\'
+// escapes the character following it.
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			var match bool
+			if match, pattern = globMatchClass(pattern[1:], s[0]); !match {
+				return false
+			}
+			s = s[1:]
+		default:
+			if pattern[0] == '\\' && len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+// globMatchClass matches c against the character class at the start of
+// pattern, which has had its opening '[' removed, returning whether it matched
+// and the pattern after the class's closing ']'.
+func globMatchClass(pattern string, c byte) (bool, string) {
+	not := len(pattern) > 0 && pattern[0] == '^'
+	if not {
+		pattern = pattern[1:]
+	}
+
+	var match bool
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) > 1:
+			match = match || pattern[1] == c
+			pattern = pattern[2:]
+		case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+			lo, hi := pattern[0], pattern[2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			match = match || (c >= lo && c <= hi)
+			pattern = pattern[3:]
+		default:
+			match = match || pattern[0] == c
+			pattern = pattern[1:]
+		}
+	}
+	if len(pattern) > 0 {
+		pattern = pattern[1:] // the closing ']'
+	}
+	return match != not, pattern
+}
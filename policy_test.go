@@ -0,0 +1,77 @@
+package radix
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+)
+
+func TestGlobMatch(t *T) {
+	for _, test := range []struct {
+		pattern, s string
+		exp        bool
+	}{
+		{"foo", "foo", true},
+		{"foo", "fo", false},
+		{"*", "", true},
+		{"tenant:*", "tenant:a:b", true},
+		{"tenant:*", "other:a", false},
+		{"*:b", "tenant:a:b", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+	} {
+		assert.Equal(t, test.exp, globMatch(test.pattern, test.s), "pattern:%q s:%q", test.pattern, test.s)
+	}
+}
+
+func TestEnforcePolicy(t *T) {
+	var cmds []string
+	client := EnforcePolicy(Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		cmds = append(cmds, args[0])
+		return "OK"
+	}),
+		PolicyAllowCommands("GET", "SET"),
+		PolicyAllowCommands("del"),
+		PolicyDenyCommands("SET"),
+		PolicyAllowKeys("tenant1:*"),
+		PolicyDenyKeys("tenant1:secret:*"),
+	)
+
+	assertViolation := func(err error, cmd, key string) {
+		var violationErr *PolicyViolationError
+		require.True(t, errors.As(err, &violationErr), "err:%v", err)
+		assert.Equal(t, cmd, violationErr.Cmd)
+		assert.Equal(t, key, violationErr.Key)
+	}
+
+	require.NoError(t, client.Do(Cmd(nil, "GET", "tenant1:foo")))
+	require.NoError(t, client.Do(Cmd(nil, "DEL", "tenant1:foo")))
+	assertViolation(client.Do(Cmd(nil, "SET", "tenant1:foo", "bar")), "SET", "")
+	assertViolation(client.Do(Cmd(nil, "FLUSHALL")), "FLUSHALL", "")
+	assertViolation(client.Do(Cmd(nil, "GET", "tenant2:foo")), "", "tenant2:foo")
+	assertViolation(client.Do(Cmd(nil, "GET", "tenant1:secret:foo")), "", "tenant1:secret:foo")
+	assertViolation(client.Do(Pipeline(
+		Cmd(nil, "GET", "tenant1:foo"),
+		Cmd(nil, "GET", "tenant2:foo"),
+	)), "", "tenant2:foo")
+
+	err := client.Do(WithConn("tenant1:foo", func(c Conn) error {
+		if err := c.Do(Cmd(nil, "GET", "tenant1:foo")); err != nil {
+			return err
+		}
+		return c.Do(Cmd(nil, "GET", "tenant2:foo"))
+	}))
+	assertViolation(err, "", "tenant2:foo")
+
+	assert.Equal(t, []string{"GET", "DEL", "GET"}, cmds)
+}
@@ -1,8 +1,13 @@
 package radix
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"net"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -10,6 +15,7 @@ import (
 	errors "golang.org/x/xerrors"
 
 	"github.com/mediocregopher/radix/v3/resp"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
 	"github.com/mediocregopher/radix/v3/trace"
 )
 
@@ -21,8 +27,23 @@ var errPoolFull = errors.New("connection pool is full")
 // ioErrConn is a Conn which tracks the last net.Error which was seen either
 // during an Encode call or a Decode call
 type ioErrConn struct {
+	// active is set to 1 while the connection is performing an Action. It's
+	// atomic, and kept first so that it's correctly aligned.
+	active int32
+
 	Conn
 
+	// id is the index of the connection within the Pool which created it.
+	id int64
+
+	// budget, if set, tracks the errors seen on the connection. See
+	// PoolErrorBudget.
+	budget *errBudget
+
+	// conns, if set, is the set of open connections of the Pool which created
+	// the connection, which it's removed from when closed.
+	conns *sync.Map
+
 	// The most recent network error which occurred when either reading
 	// or writing. A critical network error is basically any non-application
 	// level error, e.g. a timeout, disconnect, etc... Close is automatically
@@ -42,9 +63,28 @@ func (ioc *ioErrConn) Encode(m resp.Marshaler) error {
 	if nerr, _ := err.(net.Error); nerr != nil {
 		ioc.lastIOErr = err
 	}
+	ioc.spendBudget(err)
 	return err
 }
 
+// discard marks the ioErrConn as having errored, so that it will be closed
+// rather than reused, if it hasn't errored already.
+func (ioc *ioErrConn) discard(err error) {
+	if ioc.lastIOErr == nil {
+		ioc.lastIOErr = errors.Errorf("connection discarded: %w", err)
+	}
+}
+
+// discardConn marks the Conn as having errored if it's an ioErrConn, so that
+// its Pool will close it rather than reuse it. Otherwise the Conn is closed.
+func discardConn(c Conn, err error) {
+	if ioc, ok := c.(*ioErrConn); ok {
+		ioc.discard(err)
+	} else {
+		c.Close()
+	}
+}
+
 func (ioc *ioErrConn) Decode(m resp.Unmarshaler) error {
 	if ioc.lastIOErr != nil {
 		return ioc.lastIOErr
@@ -55,15 +95,33 @@ func (ioc *ioErrConn) Decode(m resp.Unmarshaler) error {
 	} else if err != nil && !errors.As(err, new(resp.ErrDiscarded)) {
 		ioc.lastIOErr = err
 	}
+	ioc.spendBudget(err)
 	return err
 }
 
+// spendBudget records the error against the connection's error budget, if it
+// has one, and marks the connection as unusable if the budget is exceeded.
+// Error responses from redis are the result of the command, not the
+// connection, and so aren't counted.
+func (ioc *ioErrConn) spendBudget(err error) {
+	if err == nil || ioc.budget == nil || ioc.lastIOErr != nil {
+		return
+	} else if errors.As(err, new(resp2.Error)) {
+		return
+	} else if ioc.budget.spend(time.Now()) {
+		ioc.lastIOErr = &errBudgetExceeded{err: err}
+	}
+}
+
 func (ioc *ioErrConn) Do(a Action) error {
 	return a.Run(ioc)
 }
 
 func (ioc *ioErrConn) Close() error {
 	ioc.lastIOErr = io.EOF
+	if ioc.conns != nil {
+		ioc.conns.Delete(ioc)
+	}
 	return ioc.Conn.Close()
 }
 
@@ -79,7 +137,24 @@ type poolOpts struct {
 	errOnEmpty            error
 	pipelineConcurrency   int
 	pipelineLimit         int
+	pipelineMaxBytes      int
 	pipelineWindow        time.Duration
+	chunkCmds             int
+	chunkBytes            int
+	blockingSize          int
+	clientName            string
+	priorityLanes         bool
+	priorityReserve       int
+	warmUpTimeout         time.Duration
+	warmUpMin             int
+	errBudgetMax          int
+	errBudgetWindow       time.Duration
+	slowLog               slowLogOpts
+	reconnectBackoff      Backoff
+	resetConns            bool
+	resetInit             func(Conn) error
+	reauthRetry           bool
+	affinityConns         int
 	pt                    trace.PoolTrace
 }
 
@@ -213,6 +288,213 @@ func PoolPipelineWindow(window time.Duration, limit int) PoolOpt {
 	}
 }
 
+// PoolPipelineMaxBytes sets the approximate maximum number of bytes which
+// the commands in an internal pipeline may take up before the pipeline is
+// flushed, regardless of the time window or command limit given to
+// PoolPipelineWindow. This can be used to avoid large values causing large
+// writes, and the resulting latency for the other commands in the pipeline.
+//
+// If maxBytes is zero then pipelines are not limited by their size.
+func PoolPipelineMaxBytes(maxBytes int) PoolOpt {
+	return func(po *poolOpts) {
+		po.pipelineMaxBytes = maxBytes
+	}
+}
+
+// PoolPipelineChunks causes pipelines performed on the Pool, i.e. those created
+// using Pipeline or PartialPipeline, to be split into chunks of at most
+// maxCmds commands, or approximately maxBytes bytes, as with ChunkedPipeline.
+// This bounds the memory used by very large pipelines, and keeps them from
+// exceeding the server's output buffer limits.
+//
+// If both maxCmds and maxBytes are zero then pipelines are not chunked.
+func PoolPipelineChunks(maxCmds, maxBytes int) PoolOpt {
+	return func(po *poolOpts) {
+		po.chunkCmds = maxCmds
+		po.chunkBytes = maxBytes
+	}
+}
+
+// PoolBlockingConns tells the Pool to perform blocking commands (e.g. BLPOP,
+// or XREAD with the BLOCK option) on connections dedicated to them, rather
+// than on the Pool's normal connections. This prevents a long blocking command
+// from holding a connection which other Actions, including implicitly
+// pipelined ones, are waiting on.
+//
+// At most size blocking connections are open at once, and idle ones are kept
+// for reuse and pinged along with the Pool's normal connections (see
+// PoolPingInterval). If size blocking commands are already being performed then
+// further ones are performed on the Pool's normal connections, as they would
+// be without this option.
+//
+// If size is zero, the default, then blocking commands are performed on the
+// Pool's normal connections, like any other Action.
+func PoolBlockingConns(size int) PoolOpt {
+	return func(po *poolOpts) {
+		po.blockingSize = size
+	}
+}
+
+// PoolResetConns tells the Pool to perform a RESET command on every connection
+// which has been used by WithConn, before returning it to the pool. WithConn
+// may leave a connection in any state, e.g. in the middle of a MULTI, with a
+// WATCH in place, or with a different database SELECTed, which RESET clears
+// cheaply. Connections used by other Actions are left alone.
+//
+// RESET also reverts the connection's authentication, database and name, so
+// after it the Pool sets the connection's name again if PoolClientName is used,
+// and then calls init, if it's not nil, to restore anything else, e.g. by
+// performing AUTH and SELECT. If init returns an error the connection is
+// closed.
+//
+// RESET requires redis 6.2 or later. On older servers connections used by
+// WithConn are instead closed, and replaced by the Pool with new ones.
+func PoolResetConns(init func(Conn) error) PoolOpt {
+	return func(po *poolOpts) {
+		po.resetConns = true
+		po.resetInit = init
+	}
+}
+
+// PoolReauthRetry tells the Pool to handle connections which have lost their
+// authentication, e.g. because requirepass was enabled or the ACL user's
+// password was changed on a live server. When performing an Action returns a
+// NOAUTH or NOPERM error the connection it was performed on is closed, and the
+// Action is performed once more on a newly created connection, which will
+// authenticate using the Pool's ConnFunc, e.g. with the Credentials returned by
+// the CredentialsFunc given to DialCredentials.
+//
+// So that commands aren't performed twice, an Action is only retried on NOAUTH
+// if it wasn't created by WithConn, and on NOPERM if it was created by Cmd or
+// FlatCmd, since other commands in the Action may have succeeded. Other
+// connections in the pool which have also lost their authentication are
+// replaced as each one encounters an error.
+func PoolReauthRetry() PoolOpt {
+	return func(po *poolOpts) {
+		po.reauthRetry = true
+	}
+}
+
+// PoolKeyAffinity tells the Pool to perform Actions which have an affinity
+// key, as given by WithAffinityKey, on one of the given number of connections
+// dedicated to them, always choosing the same connection for the same key.
+// Actions with the same key are therefore performed one at a time, in the order
+// they were given, and keeping related Actions on one connection can improve
+// the locality of the work the server does for them.
+//
+// The connection is chosen using the cluster slot of the key, so keys sharing
+// a hash tag will share a connection. Each connection is created when it's
+// first needed, and is replaced if it encounters a network error. Actions
+// without an affinity key are performed on the Pool's normal connections.
+//
+// If conns is zero then affinity keys are ignored.
+func PoolKeyAffinity(conns int) PoolOpt {
+	return func(po *poolOpts) {
+		po.affinityConns = conns
+	}
+}
+
+// PoolClientName tells the Pool to perform a CLIENT SETNAME command on every
+// connection it creates, so that the Pool's connections can be identified in
+// the output of CLIENT LIST. Each connection's name will be the given name
+// suffixed with the index of the connection within the Pool, e.g. "myapp-0",
+// "myapp-1", etc...
+//
+// The index is incremented for every connection the Pool creates over its
+// lifetime, so it will continue to grow as connections are replaced.
+func PoolClientName(name string) PoolOpt {
+	return func(po *poolOpts) {
+		po.clientName = name
+	}
+}
+
+// PoolPriorityLanes tells the Pool to take the Priority of Actions into account
+// when handing out connections, see WithPriority. When no idle connection is
+// available, Actions waiting on one are given the next connection returned to
+// the Pool in order of Priority, highest first, and in the order they started
+// waiting within the same Priority.
+//
+// reserve is the number of idle connections which are kept aside for Actions
+// with PriorityHigh. Actions with a lower Priority won't take any of the last
+// reserve idle connections, and instead wait in the same way as if the Pool
+// were empty (see PoolOnEmptyWait and friends). This prevents batch jobs from
+// starving user-facing requests of connections.
+//
+// Implicitly pipelined Actions are performed with PriorityNormal.
+func PoolPriorityLanes(reserve int) PoolOpt {
+	return func(po *poolOpts) {
+		po.priorityLanes = true
+		po.priorityReserve = reserve
+	}
+}
+
+// PoolWarmUp tells NewPool to create all of the Pool's connections in
+// parallel before returning, rather than creating one and leaving the rest to
+// be created in the background. This way the first Actions performed on the
+// Pool don't have to wait on new connections being dialed, authenticated, etc.
+//
+// NewPool waits at most timeout for the connections to be created, after which
+// any still being created are added to the Pool in the background. If fewer
+// than minConns connections were created by then NewPool returns an error,
+// otherwise the Pool is returned as normal. minConns may be zero, in which case
+// NewPool never returns an error due to failed connections.
+//
+// If timeout is zero then warm-up is disabled.
+func PoolWarmUp(timeout time.Duration, minConns int) PoolOpt {
+	return func(po *poolOpts) {
+		po.warmUpTimeout = timeout
+		po.warmUpMin = minConns
+	}
+}
+
+// PoolErrorBudget tells the Pool to discard any connection which produces
+// maxErrs or more errors within the given window, and to immediately replace
+// it with a new connection. Connections which encounter a network or protocol
+// error which leaves them unusable are always discarded, but with this option
+// set they too are replaced immediately, rather than at the next refill event.
+//
+// Errors returned by redis itself, e.g. WRONGTYPE, are the result of the
+// command and not the connection, and so don't count towards the budget.
+//
+// Replacements can be tracked using the ConnReplaced callback of PoolTrace.
+//
+// If maxErrs is zero then connections are never discarded due to the number of
+// errors, nor replaced immediately.
+func PoolErrorBudget(maxErrs int, window time.Duration) PoolOpt {
+	return func(po *poolOpts) {
+		po.errBudgetMax = maxErrs
+		po.errBudgetWindow = window
+	}
+}
+
+// PoolSlowCommands tells the Pool to call fn for every Action which takes
+// longer than threshold to complete, e.g. in order to log it using
+// SlowCommand's String method. fn is called synchronously after the Action
+// completes, and so should not block.
+//
+// sampleRate is the fraction of Actions, between 0 and 1, which are checked
+// against the threshold. Checking an Action requires its Properties to be
+// copied before it's performed, so a sampleRate below 1 can be used to bound
+// the overhead of this option under high load.
+func PoolSlowCommands(threshold time.Duration, sampleRate float64, fn func(SlowCommand)) PoolOpt {
+	return func(po *poolOpts) {
+		po.slowLog = slowLogOpts{
+			threshold:  threshold,
+			sampleRate: sampleRate,
+			fn:         fn,
+		}
+	}
+}
+
+// PoolReconnectBackoff sets the Backoff used to determine how long the Pool
+// waits after failing to create a connection while filling itself during
+// initialization, before trying again.
+func PoolReconnectBackoff(b Backoff) PoolOpt {
+	return func(po *poolOpts) {
+		po.reconnectBackoff = b
+	}
+}
+
 // PoolWithTrace tells the Pool to trace itself with the given PoolTrace
 // Note that PoolTrace will block every point that you set to trace.
 func PoolWithTrace(pt trace.PoolTrace) PoolOpt {
@@ -244,6 +526,24 @@ type Pool struct {
 	// correctly aligned or else access may cause panics on 32-bit architectures
 	// See https://golang.org/pkg/sync/atomic/#pkg-note-BUG
 	totalConns int64 // atomic, must only be access using functions from sync/atomic
+	connIdx    int64 // atomic, incremented for every connection created
+	replaced   int64 // atomic, incremented for every connection replaced
+
+	// atomic, set to 1 once the server is found not to support RESET, see
+	// PoolResetConns.
+	resetUnsupported int64
+
+	// atomic, see PoolStats
+	created, closedConns, dialFailures int64
+	waiting, checkouts, checkoutWait   int64
+	inUse                              int64
+
+	// atomic, the number of open connections dedicated to blocking commands.
+	blockingOpen int64
+
+	// atomic, the number of Actions currently being performed by Do, plus
+	// poolDraining once Shutdown or Close has been called.
+	inFlight int64
 
 	opts          poolOpts
 	network, addr string
@@ -255,8 +555,37 @@ type Pool struct {
 	pool   chan *ioErrConn
 	closed bool
 
+	// blocking holds the idle connections dedicated to blocking commands, see
+	// PoolBlockingConns. It is protected by l in the same way as pool.
+	blocking chan *ioErrConn
+
+	// affinity holds the connections dedicated to Actions with an affinity
+	// key, see PoolKeyAffinity. Each element is a buffered channel of size 1
+	// which holds the slot's connection, or nil if it hasn't been created,
+	// while the connection isn't in use.
+	affinity []chan *ioErrConn
+
+	// shuttingDown is protected by l, and is set once Shutdown is called. No
+	// new Actions are accepted once it's set. drainedCh is closed once there
+	// are no Actions in flight after that.
+	shuttingDown bool
+	drainedCh    chan struct{}
+	drainedOnce  sync.Once
+
+	// conns contains all of the Pool's open connections, so that those which
+	// are active can be found by Shutdown.
+	conns sync.Map
+
+	// waitL protects waiters, which holds the channels of calls waiting on a
+	// connection, by Priority. It's only used with PoolPriorityLanes.
+	waitL   sync.Mutex
+	waiters [numPriorities][]chan *ioErrConn
+
 	pipeliner *pipeliner
 
+	// serverInfo caches the ServerInfo of the server, see ServerInfo.
+	serverInfo serverInfoCache
+
 	wg       sync.WaitGroup
 	closeCh  chan bool
 	initDone chan struct{} // used for tests
@@ -280,6 +609,7 @@ type Pool struct {
 //	PoolPingInterval(5 * time.Second / (size+1))
 //	PoolPipelineConcurrency(size)
 //	PoolPipelineWindow(150 * time.Microsecond, 0)
+//	PoolReconnectBackoff(ExponentialBackoff(100 * time.Millisecond, 5 * time.Second, 0.5))
 //
 // The recommended size of the pool depends on the number of concurrent
 // goroutines that will use the pool and whether implicit pipelining is
@@ -288,15 +618,15 @@ type Pool struct {
 // As a general rule, when implicit pipelining is enabled (the default)
 // the size of the pool can be kept low without problems to reduce resource
 // and file descriptor usage.
-//
 func NewPool(network, addr string, size int, opts ...PoolOpt) (*Pool, error) {
 	p := &Pool{
-		network:  network,
-		addr:     addr,
-		size:     size,
-		closeCh:  make(chan bool),
-		initDone: make(chan struct{}),
-		ErrCh:    make(chan error, 1),
+		network:   network,
+		addr:      addr,
+		size:      size,
+		closeCh:   make(chan bool),
+		initDone:  make(chan struct{}),
+		drainedCh: make(chan struct{}),
+		ErrCh:     make(chan error, 1),
 	}
 
 	defaultPoolOpts := []PoolOpt{
@@ -308,6 +638,7 @@ func NewPool(network, addr string, size int, opts ...PoolOpt) (*Pool, error) {
 		PoolPipelineConcurrency(size),
 		// NOTE if 150us is changed the benchmarks need to be updated too
 		PoolPipelineWindow(150*time.Microsecond, 0),
+		PoolReconnectBackoff(ExponentialBackoff(100*time.Millisecond, 5*time.Second, 0.5)),
 	}
 
 	for _, opt := range append(defaultPoolOpts, opts...) {
@@ -321,29 +652,53 @@ func NewPool(network, addr string, size int, opts ...PoolOpt) (*Pool, error) {
 
 	totalSize := size + p.opts.overflowSize
 	p.pool = make(chan *ioErrConn, totalSize)
+	if p.opts.blockingSize > 0 {
+		p.blocking = make(chan *ioErrConn, p.opts.blockingSize)
+	}
+	if p.opts.affinityConns > 0 {
+		p.affinity = make([]chan *ioErrConn, p.opts.affinityConns)
+		for i := range p.affinity {
+			p.affinity[i] = make(chan *ioErrConn, 1)
+			p.affinity[i] <- nil
+		}
+	}
 
-	// make one Conn synchronously to ensure there's actually a redis instance
-	// present. The rest will be created asynchronously.
-	ioc, err := p.newConn(trace.PoolConnCreatedReasonInitialization)
-	if err != nil {
-		return nil, err
+	// unless warming up, make one Conn synchronously to ensure there's
+	// actually a redis instance present. The rest will be created
+	// asynchronously.
+	created, waitWarmUp := 1, func() int { return 0 }
+	if p.opts.warmUpTimeout > 0 {
+		var err error
+		if created, waitWarmUp, err = p.warmUp(); err != nil {
+			return nil, err
+		}
+	} else {
+		ioc, err := p.newConn(trace.PoolConnCreatedReasonInitialization)
+		if err != nil {
+			return nil, err
+		}
+		p.put(ioc)
 	}
-	p.put(ioc)
 
 	p.wg.Add(1)
 	go func() {
 		startTime := time.Now()
 		defer p.wg.Done()
-		for i := 0; i < size-1; i++ {
+		created += waitWarmUp()
+		var failures int
+		for i := created; i < size; i++ {
 			ioc, err := p.newConn(trace.PoolConnCreatedReasonInitialization)
 			if err != nil {
 				p.err(err)
 				// if there was an error connecting to the instance than it
 				// might need a little breathing room, redis can sometimes get
 				// sad if too many connections are created simultaneously.
-				time.Sleep(100 * time.Millisecond)
+				failures++
+				time.Sleep(p.opts.reconnectBackoff.Next(failures))
 				continue
-			} else if !p.put(ioc) {
+			}
+			failures = 0
+			if !p.put(ioc) {
 				// if the connection wasn't put in it could be for two reasons:
 				// - the Pool has already started being used and is full.
 				// - Close was called.
@@ -363,14 +718,18 @@ func NewPool(network, addr string, size int, opts ...PoolOpt) (*Pool, error) {
 		}
 
 		p.pipeliner = newPipeliner(
-			p,
+			poolDirect{p},
 			p.opts.pipelineConcurrency,
 			p.opts.pipelineLimit,
+			p.opts.pipelineMaxBytes,
 			p.opts.pipelineWindow,
 		)
 	}
 	if p.opts.pingInterval > 0 && size > 0 {
-		p.atIntervalDo(p.opts.pingInterval, func() { p.Do(Cmd(nil, "PING")) })
+		p.atIntervalDo(p.opts.pingInterval, func() {
+			p.Do(Cmd(nil, "PING"))
+			p.pingBlocking()
+		})
 	}
 	if p.opts.refillInterval > 0 && size > 0 {
 		p.atIntervalDo(p.opts.refillInterval, p.doRefill)
@@ -381,6 +740,79 @@ func NewPool(network, addr string, size int, opts ...PoolOpt) (*Pool, error) {
 	return p, nil
 }
 
+// warmUp creates the Pool's connections in parallel, as described by
+// PoolWarmUp. It returns the number of connections created before the timeout,
+// and a function which waits for any still being created, returning the
+// number of those which were.
+func (p *Pool) warmUp() (int, func() int, error) {
+	resCh := make(chan error, p.size)
+	for i := 0; i < p.size; i++ {
+		go func() {
+			ioc, err := p.newConn(trace.PoolConnCreatedReasonInitialization)
+			if err == nil && !p.put(ioc) {
+				err = errPoolFull
+			}
+			resCh <- err
+		}()
+	}
+
+	var created, done int
+	var firstErr error
+	timer := time.NewTimer(p.opts.warmUpTimeout)
+	defer timer.Stop()
+wait:
+	for done < p.size {
+		select {
+		case err := <-resCh:
+			done++
+			if err == nil {
+				created++
+			} else if firstErr == nil {
+				firstErr = err
+			}
+		case <-timer.C:
+			break wait
+		}
+	}
+
+	if created < p.warmUpMin() {
+		// marking the Pool closed causes any connections still being created
+		// to be closed when they're put.
+		p.l.Lock()
+		p.closed = true
+		p.l.Unlock()
+		for len(p.pool) > 0 {
+			(<-p.pool).Close()
+		}
+		if firstErr == nil {
+			firstErr = errors.Errorf("timed out after %v", p.opts.warmUpTimeout)
+		}
+		return 0, nil, errors.Errorf(
+			"created %d of the required %d connections during warm-up: %w",
+			created, p.warmUpMin(), firstErr,
+		)
+	}
+
+	return created, func() int {
+		var created int
+		for ; done < p.size; done++ {
+			if err := <-resCh; err == nil {
+				created++
+			} else if err != errPoolFull {
+				p.err(err)
+			}
+		}
+		return created
+	}, nil
+}
+
+func (p *Pool) warmUpMin() int {
+	if p.opts.warmUpMin > p.size {
+		return p.size
+	}
+	return p.opts.warmUpMin
+}
+
 func (p *Pool) traceInitCompleted(elapsedTime time.Duration) {
 	if p.opts.pt.InitCompleted != nil {
 		p.opts.pt.InitCompleted(trace.PoolInitCompleted{
@@ -416,7 +848,10 @@ func (p *Pool) traceConnCreated(connectTime time.Duration, reason trace.PoolConn
 	}
 }
 
+// traceConnClosed is called whenever a connection is closed, and so also
+// counts closed connections for Stats.
 func (p *Pool) traceConnClosed(reason trace.PoolConnClosedReason) {
+	atomic.AddInt64(&p.closedConns, 1)
 	if p.opts.pt.ConnClosed != nil {
 		p.opts.pt.ConnClosed(trace.PoolConnClosed{
 			PoolCommon: p.traceCommon(),
@@ -427,15 +862,40 @@ func (p *Pool) traceConnClosed(reason trace.PoolConnClosedReason) {
 }
 
 func (p *Pool) newConn(reason trace.PoolConnCreatedReason) (*ioErrConn, error) {
+	ioc, err := p.dialConn(reason)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&p.totalConns, 1)
+	return ioc, nil
+}
+
+// dialConn is like newConn, but the created connection isn't counted as being
+// one of the Pool's normal connections.
+func (p *Pool) dialConn(reason trace.PoolConnCreatedReason) (*ioErrConn, error) {
 	start := time.Now()
+	id := atomic.AddInt64(&p.connIdx, 1) - 1
 	c, err := p.opts.cf(p.network, p.addr)
+	if err == nil && p.opts.clientName != "" {
+		name := p.opts.clientName + "-" + strconv.FormatInt(id, 10)
+		if err = c.Do(Cmd(nil, "CLIENT", "SETNAME", name)); err != nil {
+			c.Close()
+		}
+	}
 	elapsed := time.Since(start)
 	p.traceConnCreated(elapsed, reason, err)
 	if err != nil {
+		atomic.AddInt64(&p.dialFailures, 1)
 		return nil, err
 	}
+	atomic.AddInt64(&p.created, 1)
 	ioc := newIOErrConn(c)
-	atomic.AddInt64(&p.totalConns, 1)
+	ioc.id = id
+	ioc.conns = &p.conns
+	p.conns.Store(ioc, struct{}{})
+	if p.opts.errBudgetMax > 0 {
+		ioc.budget = &errBudget{max: p.opts.errBudgetMax, window: p.opts.errBudgetWindow}
+	}
 	return ioc, nil
 }
 
@@ -501,7 +961,7 @@ func (p *Pool) getExisting() (*ioErrConn, error) {
 	select {
 	case ioc, ok := <-p.pool:
 		if !ok {
-			return nil, errClientClosed
+			return nil, ErrClientClosed
 		}
 		return ioc, nil
 	default:
@@ -522,10 +982,12 @@ func (p *Pool) getExisting() (*ioErrConn, error) {
 		tc = t.C
 	}
 
+	atomic.AddInt64(&p.waiting, 1)
+	defer atomic.AddInt64(&p.waiting, -1)
 	select {
 	case ioc, ok := <-p.pool:
 		if !ok {
-			return nil, errClientClosed
+			return nil, ErrClientClosed
 		}
 		return ioc, nil
 	case <-tc:
@@ -533,8 +995,122 @@ func (p *Pool) getExisting() (*ioErrConn, error) {
 	}
 }
 
-func (p *Pool) get() (*ioErrConn, error) {
-	ioc, err := p.getExisting()
+// canTake returns whether a call with the given Priority may take an idle
+// connection straight out of the pool, rather than waiting behind others. waitL
+// must be held.
+func (p *Pool) canTake(prio Priority) bool {
+	for i := int(prio); i < numPriorities; i++ {
+		if len(p.waiters[i]) > 0 {
+			return false
+		}
+	}
+	return prio == PriorityHigh || len(p.pool) > p.opts.priorityReserve
+}
+
+// getPrioritized is the equivalent of getExisting used with PoolPriorityLanes.
+func (p *Pool) getPrioritized(prio Priority) (*ioErrConn, error) {
+	p.waitL.Lock()
+	if p.canTake(prio) {
+		select {
+		case ioc, ok := <-p.pool:
+			p.waitL.Unlock()
+			if !ok {
+				return nil, ErrClientClosed
+			}
+			return ioc, nil
+		default:
+		}
+	}
+
+	if p.opts.onEmptyWait == 0 {
+		p.waitL.Unlock()
+		return nil, p.opts.errOnEmpty
+	}
+
+	ch := make(chan *ioErrConn, 1)
+	p.waiters[prio] = append(p.waiters[prio], ch)
+	p.waitL.Unlock()
+
+	var tc <-chan time.Time
+	if p.opts.onEmptyWait > 0 {
+		t := getTimer(p.opts.onEmptyWait)
+		defer putTimer(t)
+
+		tc = t.C
+	}
+
+	var err error
+	atomic.AddInt64(&p.waiting, 1)
+	select {
+	case ioc := <-ch:
+		atomic.AddInt64(&p.waiting, -1)
+		return ioc, nil
+	case <-tc:
+		err = p.opts.errOnEmpty
+	case <-p.closeCh:
+		err = ErrClientClosed
+	}
+	atomic.AddInt64(&p.waiting, -1)
+
+	p.waitL.Lock()
+	defer p.waitL.Unlock()
+	for i, wch := range p.waiters[prio] {
+		if wch == ch {
+			p.waiters[prio] = append(p.waiters[prio][:i], p.waiters[prio][i+1:]...)
+			return nil, err
+		}
+	}
+
+	// the waiter was already removed, meaning a connection was handed to it
+	// in the meantime.
+	ioc := <-ch
+	if err == ErrClientClosed {
+		ioc.Close()
+		atomic.AddInt64(&p.totalConns, -1)
+		p.traceConnClosed(trace.PoolConnClosedReasonPoolClosed)
+		return nil, err
+	}
+	return ioc, nil
+}
+
+// putPrioritized is the equivalent of putting the connection in the pool used
+// with PoolPriorityLanes. It gives the connection to the highest priority call
+// waiting on one, if any is allowed to take it, or otherwise puts it in the
+// pool, returning false if the pool is full. waitL must not be held.
+//
+// Both happen under waitL so that a call can't start waiting in between,
+// after finding the pool empty, and miss the connection.
+func (p *Pool) putPrioritized(ioc *ioErrConn) bool {
+	p.waitL.Lock()
+	defer p.waitL.Unlock()
+	for i := numPriorities - 1; i >= 0; i-- {
+		if len(p.waiters[i]) == 0 {
+			continue
+		} else if Priority(i) != PriorityHigh && len(p.pool) < p.opts.priorityReserve {
+			break
+		}
+		ch := p.waiters[i][0]
+		p.waiters[i] = p.waiters[i][1:]
+		ch <- ioc
+		return true
+	}
+
+	select {
+	case p.pool <- ioc:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Pool) get(prio Priority) (*ioErrConn, error) {
+	var ioc *ioErrConn
+	var err error
+	if p.opts.priorityLanes {
+		ioc, err = p.getPrioritized(prio)
+	} else {
+		ioc, err = p.getExisting()
+	}
 	if err != nil {
 		return nil, err
 	} else if ioc != nil {
@@ -548,23 +1124,70 @@ func (p *Pool) get() (*ioErrConn, error) {
 func (p *Pool) put(ioc *ioErrConn) bool {
 	p.l.RLock()
 	if ioc.lastIOErr == nil && !p.closed {
-		select {
-		case p.pool <- ioc:
-			p.l.RUnlock()
-			return true
-		default:
+		if p.opts.priorityLanes {
+			if p.putPrioritized(ioc) {
+				p.l.RUnlock()
+				return true
+			}
+		} else {
+			select {
+			case p.pool <- ioc:
+				p.l.RUnlock()
+				return true
+			default:
+			}
 		}
 	}
 	p.l.RUnlock()
 
 	// the pool might close here, but that's fine, because all that's happening
 	// at this point is that the connection is being closed
+	ioErr := ioc.lastIOErr
 	ioc.Close()
-	p.traceConnClosed(trace.PoolConnClosedReasonPoolFull)
+	if errors.As(ioErr, new(*errBudgetExceeded)) {
+		p.traceConnClosed(trace.PoolConnClosedReasonErrorBudget)
+	} else {
+		p.traceConnClosed(trace.PoolConnClosedReasonPoolFull)
+	}
 	atomic.AddInt64(&p.totalConns, -1)
+	if ioErr != nil && p.opts.errBudgetMax > 0 {
+		p.replaceConn(ioErr)
+	}
 	return false
 }
 
+// replaceConn creates a new connection in the background to replace one which
+// was discarded due to the given error. See PoolErrorBudget.
+func (p *Pool) replaceConn(err error) {
+	p.l.RLock()
+	defer p.l.RUnlock()
+	if p.closed {
+		return
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		if atomic.LoadInt64(&p.totalConns) >= int64(p.size) {
+			return
+		}
+		ioc, newErr := p.newConn(trace.PoolConnCreatedReasonReplacement)
+		if newErr != nil {
+			p.err(newErr)
+			return
+		}
+		n := atomic.AddInt64(&p.replaced, 1)
+		if p.opts.pt.ConnReplaced != nil {
+			p.opts.pt.ConnReplaced(trace.PoolConnReplaced{
+				PoolCommon:   p.traceCommon(),
+				Err:          err,
+				Replacements: n,
+			})
+		}
+		p.put(ioc)
+	}()
+}
+
 // Do implements the Do method of the Client interface by retrieving a Conn out
 // of the pool, calling Run on the given Action with it, and returning the Conn
 // to the pool.
@@ -578,52 +1201,536 @@ func (p *Pool) put(ioc *ioErrConn) bool {
 //
 // Due to a limitation in the implementation, custom CmdAction implementations
 // are currently not automatically pipelined.
+//
+// Blocking commands created by Cmd or FlatCmd are not pipelined either, and if
+// the Pool was created with PoolBlockingConns they're performed on connections
+// dedicated to them.
+//
+// If the Pool was created with PoolKeyAffinity then Actions with an affinity
+// key, as given by WithAffinityKey, are performed on the connection dedicated
+// to that key, and are never pipelined.
+//
+// If the Pool was created with PoolPriorityLanes then the Priority of the Action,
+// as given by WithPriority, decides the order in which it's given a connection
+// relative to other waiting Actions.
 func (p *Pool) Do(a Action) error {
+	if atomic.AddInt64(&p.inFlight, 1)&poolDraining != 0 {
+		p.doneInFlight()
+		return ErrClientClosed
+	}
+	defer p.doneInFlight()
+
+	if err := checkServerFeatures(p, actionFeatures(a)...); err != nil {
+		return err
+	}
+
+	slowLog := p.slowLogStart(a)
 	startTime := time.Now()
-	if p.pipeliner != nil && p.pipeliner.CanDo(a) {
+	if key, ok := actionAffinityKey(a); ok && p.affinity != nil {
+		err := p.doAffinity(key, a)
+		p.traceDoCompleted(a, time.Since(startTime), err)
+		p.slowLogEnd(slowLog, a, 0, err)
+		return err
+	} else if ioc, err := p.getBlocking(a); ioc != nil || err != nil {
+		if err == nil {
+			err = p.doBlocking(ioc, a)
+		}
+		p.traceDoCompleted(a, time.Since(startTime), err)
+		p.slowLogEnd(slowLog, a, 0, err)
+		return err
+	} else if p.pipeliner != nil && p.pipeliner.CanDo(a) {
 		err := p.pipeliner.Do(a)
-		p.traceDoCompleted(time.Since(startTime), err)
+		p.traceDoCompleted(a, time.Since(startTime), err)
+		p.slowLogEnd(slowLog, a, 0, err)
 
 		return err
 	}
 
-	c, err := p.get()
+	doA := a
+	if p.opts.chunkCmds > 0 || p.opts.chunkBytes > 0 {
+		doA = chunkPipeline(a, p.opts.chunkCmds, p.opts.chunkBytes)
+	}
+
+	poolWait, err := p.doWait(doA)
+	p.traceDoCompleted(a, time.Since(startTime), err)
+	p.slowLogEnd(slowLog, a, poolWait, err)
+	return err
+}
+
+// do performs the Action on a Conn taken from the pool, without any of the
+// checks or tracing done by Do.
+func (p *Pool) do(a Action) error {
+	_, err := p.doWait(a)
+	return err
+}
+
+// doWait is like do, but also returns the time spent getting the Conn from the
+// pool.
+func (p *Pool) doWait(a Action) (time.Duration, error) {
+	start := time.Now()
+	c, err := p.get(actionPriority(a))
+	wait := time.Since(start)
+	if err != nil {
+		return wait, err
+	}
+	atomic.AddInt64(&p.checkoutWait, int64(wait))
+	atomic.AddInt64(&p.checkouts, 1)
+
+	p.setActive(c, true)
+	err = c.Do(a)
+	if err := withConnCanceled(a); err != nil {
+		c.discard(err)
+	}
+	authErr := p.opts.reauthRetry && isAuthErr(err)
+	if authErr {
+		c.discard(err)
+	}
+	if p.opts.resetConns && isWithConn(a) {
+		p.resetConn(c)
+	}
+	p.setActive(c, false)
+	p.put(c)
+
+	if authErr && reauthRetryable(a, err) {
+		err = p.doReauth(a)
+	}
+	return wait, err
+}
+
+// isAuthErr returns whether the error is a NOAUTH or NOPERM error returned by
+// redis.
+func isAuthErr(err error) bool {
+	var respErr resp2.Error
+	if !errors.As(err, &respErr) {
+		return false
+	}
+	msg := respErr.E.Error()
+	return strings.HasPrefix(msg, "NOAUTH ") || strings.HasPrefix(msg, "NOPERM ")
+}
+
+// reauthRetryable returns whether the Action, whose performance returned the
+// given auth error, can be retried, as described by PoolReauthRetry.
+func reauthRetryable(a Action, err error) bool {
+	var respErr resp2.Error
+	if errors.As(err, &respErr) && strings.HasPrefix(respErr.E.Error(), "NOPERM ") {
+		return isCmd(a)
+	}
+	return !isWithConn(a)
+}
+
+// doReauth performs the Action on a newly created connection, as described by
+// PoolReauthRetry.
+func (p *Pool) doReauth(a Action) error {
+	c, err := p.newConn(trace.PoolConnCreatedReasonReauth)
 	if err != nil {
 		return err
 	}
-
+	p.setActive(c, true)
 	err = c.Do(a)
+	if isAuthErr(err) {
+		c.discard(err)
+	}
+	p.setActive(c, false)
 	p.put(c)
-	p.traceDoCompleted(time.Since(startTime), err)
+	return err
+}
+
+func isWithConn(a Action) bool {
+	for {
+		switch aa := a.(type) {
+		case *withConn:
+			return true
+		case wrappedAction:
+			a = aa.unwrapAction()
+		default:
+			return false
+		}
+	}
+}
+
+var errConnNotReset = errors.New("connection used by WithConn can't be RESET")
+
+// resetConn performs RESET on the connection, as described by PoolResetConns.
+// If it fails the connection is marked as having errored, so that it will be
+// closed by put.
+func (p *Pool) resetConn(ioc *ioErrConn) {
+	if ioc.lastIOErr != nil {
+		return
+	} else if atomic.LoadInt64(&p.resetUnsupported) == 1 {
+		ioc.lastIOErr = errConnNotReset
+		return
+	}
+
+	var reply string
+	err := ioc.Do(Cmd(&reply, "RESET"))
+	if errors.As(err, new(resp2.Error)) {
+		atomic.StoreInt64(&p.resetUnsupported, 1)
+		err = errConnNotReset
+	} else if err == nil && reply != "RESET" {
+		err = errors.Errorf("unexpected reply to RESET: %q", reply)
+	}
+
+	if err == nil && p.opts.clientName != "" {
+		name := p.opts.clientName + "-" + strconv.FormatInt(ioc.id, 10)
+		err = ioc.Do(Cmd(nil, "CLIENT", "SETNAME", name))
+	}
+	if err == nil && p.opts.resetInit != nil {
+		err = p.opts.resetInit(ioc)
+	}
+	if err != nil && ioc.lastIOErr == nil {
+		ioc.lastIOErr = err
+	}
+}
+
+// isBlockingAction returns true if the Action is a blocking command, as
+// created by Cmd or FlatCmd.
+func isBlockingAction(a Action) bool {
+	cmdA, ok := a.(*cmdAction)
+	if !ok {
+		return false
+	}
+	_, blocking := cmdA.blockTimeout()
+	return blocking
+}
+
+// getBlocking returns one of the connections dedicated to blocking commands if
+// the Action is a blocking command, creating a new one if none are idle. nil is
+// returned if the Action isn't a blocking command, or if the maximum number of
+// blocking connections are already in use.
+func (p *Pool) getBlocking(a Action) (*ioErrConn, error) {
+	if p.blocking == nil || !isBlockingAction(a) {
+		return nil, nil
+	}
+
+	var ioc *ioErrConn
+	p.l.RLock()
+	if p.closed {
+		p.l.RUnlock()
+		return nil, ErrClientClosed
+	}
+	select {
+	case ioc = <-p.blocking:
+	default:
+	}
+	p.l.RUnlock()
+
+	if ioc != nil {
+		return ioc, nil
+	} else if atomic.AddInt64(&p.blockingOpen, 1) > int64(p.opts.blockingSize) {
+		atomic.AddInt64(&p.blockingOpen, -1)
+		return nil, nil
+	}
+
+	ioc, err := p.dialConn(trace.PoolConnCreatedReasonBlocking)
+	if err != nil {
+		atomic.AddInt64(&p.blockingOpen, -1)
+		return nil, err
+	}
+	return ioc, nil
+}
+
+// doBlocking performs the Action on the given connection, which was returned
+// from getBlocking, and then returns the connection to be reused.
+func (p *Pool) doBlocking(ioc *ioErrConn, a Action) error {
+	p.setActive(ioc, true)
+	err := ioc.Do(a)
+	p.setActive(ioc, false)
+	p.putBlocking(ioc)
+	return err
+}
+
+// putBlocking returns a connection dedicated to blocking commands to be reused,
+// or closes it if it has errored or the Pool has been closed.
+func (p *Pool) putBlocking(ioc *ioErrConn) {
+	p.l.RLock()
+	if ioc.lastIOErr == nil && !p.closed {
+		select {
+		case p.blocking <- ioc:
+			p.l.RUnlock()
+			return
+		default:
+		}
+	}
+	p.l.RUnlock()
+
+	ioc.Close()
+	atomic.AddInt64(&p.blockingOpen, -1)
+	p.traceConnClosed(trace.PoolConnClosedReasonPoolFull)
+}
+
+// pingBlocking pings one of the idle connections dedicated to blocking
+// commands, if there are any, so that they aren't closed by the server for
+// being idle, and so that ones which have died are closed.
+func (p *Pool) pingBlocking() {
+	if p.blocking == nil {
+		return
+	}
+
+	var ioc *ioErrConn
+	p.l.RLock()
+	if !p.closed {
+		select {
+		case ioc = <-p.blocking:
+		default:
+		}
+	}
+	p.l.RUnlock()
+	if ioc == nil {
+		return
+	}
+
+	if err := ioc.Do(Cmd(nil, "PING")); err != nil {
+		ioc.discard(err)
+	}
+	p.putBlocking(ioc)
+}
+
+// doAffinity performs the Action on the connection dedicated to the given
+// affinity key, waiting for any other Action using it to complete first, and
+// creating it if it hasn't been already.
+func (p *Pool) doAffinity(key string, a Action) error {
+	slot := p.affinity[PubSubPoolSlotHash(key, len(p.affinity))]
+	ioc := <-slot
 
+	p.l.RLock()
+	closed := p.closed
+	p.l.RUnlock()
+
+	var err error
+	if closed {
+		err = ErrClientClosed
+	} else if ioc == nil {
+		ioc, err = p.dialConn(trace.PoolConnCreatedReasonAffinity)
+	}
+	if err != nil {
+		slot <- ioc
+		return err
+	}
+
+	p.setActive(ioc, true)
+	err = ioc.Do(a)
+	if p.opts.resetConns && isWithConn(a) {
+		p.resetConn(ioc)
+	}
+	p.setActive(ioc, false)
+
+	p.l.RLock()
+	if p.closed {
+		ioc.Close()
+		p.traceConnClosed(trace.PoolConnClosedReasonPoolClosed)
+		ioc = nil
+	} else if ioc.lastIOErr != nil {
+		ioc.Close()
+		p.traceConnClosed(trace.PoolConnClosedReasonPoolFull)
+		ioc = nil
+	}
+	p.l.RUnlock()
+	slot <- ioc
 	return err
 }
 
-func (p *Pool) traceDoCompleted(elapsedTime time.Duration, err error) {
+// poolDraining is added to the Pool's inFlight count once it's no longer
+// accepting new Actions.
+const poolDraining = 1 << 62
+
+// doneInFlight decrements the Pool's inFlight count, closing drainedCh if it
+// was the last in-flight Action once the Pool stopped accepting new ones.
+func (p *Pool) doneInFlight() {
+	if atomic.AddInt64(&p.inFlight, -1) == poolDraining {
+		p.drainedOnce.Do(func() { close(p.drainedCh) })
+	}
+}
+
+// stopAccepting stops the Pool from accepting new Actions. It must be called
+// only once, while holding l.
+func (p *Pool) stopAccepting() {
+	if atomic.AddInt64(&p.inFlight, poolDraining) == poolDraining {
+		p.drainedOnce.Do(func() { close(p.drainedCh) })
+	}
+}
+
+func (p *Pool) setActive(ioc *ioErrConn, active bool) {
+	if active {
+		atomic.StoreInt32(&ioc.active, 1)
+		atomic.AddInt64(&p.inUse, 1)
+	} else {
+		atomic.StoreInt32(&ioc.active, 0)
+		atomic.AddInt64(&p.inUse, -1)
+	}
+}
+
+// poolDirect is used by the pipeliner to perform Actions on the Pool, so that
+// those Actions aren't rejected or counted as in-flight by Do.
+type poolDirect struct {
+	*Pool
+}
+
+func (pd poolDirect) Do(a Action) error {
+	return pd.Pool.do(a)
+}
+
+func (p *Pool) traceDoCompleted(a Action, elapsedTime time.Duration, err error) {
 	if p.opts.pt.DoCompleted != nil {
 		p.opts.pt.DoCompleted(trace.PoolDoCompleted{
 			PoolCommon:  p.traceCommon(),
 			AvailCount:  len(p.pool),
 			ElapsedTime: elapsedTime,
 			Err:         err,
+			Metadata:    ActionMetadata(a),
 		})
 	}
 }
 
+// ServerInfo returns the ServerInfo of the server the Pool is connected to. It
+// is retrieved using INFO server the first time it's needed, and cached from
+// then on.
+func (p *Pool) ServerInfo() (ServerInfo, error) {
+	return p.serverInfo.get(p)
+}
+
 // NumAvailConns returns the number of connections currently available in the
 // pool, as well as in the overflow buffer if that option is enabled.
 func (p *Pool) NumAvailConns() int {
 	return len(p.pool)
 }
 
+// PoolStats describes the state of a Pool at a point in time, see Pool.Stats.
+type PoolStats struct {
+	// OpenConns is the number of the Pool's normal connections which are
+	// currently open, whether idle or in use. It doesn't include connections
+	// dedicated to blocking commands (see PoolBlockingConns) or to affinity
+	// keys (see PoolKeyAffinity).
+	OpenConns int
+
+	// IdleConns is the number of connections available in the pool, and
+	// InUseConns the number currently performing an Action, including those
+	// dedicated to blocking commands.
+	IdleConns, InUseConns int
+
+	// Waiters is the number of Actions currently waiting for a connection to
+	// become available, see PoolOnEmptyWait.
+	Waiters int
+
+	// TotalCreated and TotalClosed are the number of connections which have
+	// been created and closed over the lifetime of the Pool, and DialFailures
+	// the number of connections which failed to be created.
+	TotalCreated, TotalClosed, DialFailures uint64
+
+	// AvgCheckoutWait is the average time Actions have spent getting a
+	// connection from the Pool, including any time spent waiting on one or
+	// creating one.
+	AvgCheckoutWait time.Duration
+}
+
+// Stats returns a snapshot of the Pool's PoolStats. It's cheap to call, and can
+// be used e.g. by health check endpoints.
+func (p *Pool) Stats() PoolStats {
+	ps := PoolStats{
+		OpenConns:    int(atomic.LoadInt64(&p.totalConns)),
+		IdleConns:    len(p.pool),
+		InUseConns:   int(atomic.LoadInt64(&p.inUse)),
+		Waiters:      int(atomic.LoadInt64(&p.waiting)),
+		TotalCreated: uint64(atomic.LoadInt64(&p.created)),
+		TotalClosed:  uint64(atomic.LoadInt64(&p.closedConns)),
+		DialFailures: uint64(atomic.LoadInt64(&p.dialFailures)),
+	}
+	if n := atomic.LoadInt64(&p.checkouts); n > 0 {
+		ps.AvgCheckoutWait = time.Duration(atomic.LoadInt64(&p.checkoutWait) / n)
+	}
+	return ps
+}
+
+// PoolShutdownError is returned from Shutdown when the Pool's in-flight Actions
+// did not complete before the given context was done, and so the connections
+// they were using had to be forcefully closed.
+type PoolShutdownError struct {
+	// Err is the error returned from the context which was passed into
+	// Shutdown.
+	Err error
+
+	// ConnIDs contains the index within the Pool of each connection which was
+	// forcefully closed. If PoolClientName was used these correspond to the
+	// suffixes of the connections' names.
+	ConnIDs []int64
+}
+
+func (e *PoolShutdownError) Error() string {
+	return fmt.Sprintf(
+		"pool shutdown did not complete (%v), force-closed %d connection(s) with in-flight actions: %v",
+		e.Err, len(e.ConnIDs), e.ConnIDs,
+	)
+}
+
+// Unwrap implements the errors.Wrapper interface.
+func (e *PoolShutdownError) Unwrap() error {
+	return e.Err
+}
+
+// Shutdown gracefully closes the Pool. Once called the Pool will stop accepting
+// new Actions, with Do returning an error for them, and will wait for all
+// in-flight Actions to complete before closing all connections as Close would.
+//
+// If the given context is done before all in-flight Actions have completed then
+// the connections being used by those Actions will be closed, causing those
+// Actions to return an error, and a *PoolShutdownError will be returned
+// listing the closed connections. The Pool is closed in all cases.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.l.Lock()
+	if p.closed || p.shuttingDown {
+		p.l.Unlock()
+		return ErrClientClosed
+	}
+	p.shuttingDown = true
+	p.stopAccepting()
+	p.l.Unlock()
+
+	var shutdownErr error
+	select {
+	case <-p.drainedCh:
+	case <-ctx.Done():
+		shutdownErr = p.forceCloseActive(ctx.Err())
+	}
+
+	if err := p.Close(); err != nil {
+		return err
+	}
+	return shutdownErr
+}
+
+// forceCloseActive closes all connections which are currently checked out of
+// the pool. The connections are closed directly, rather than through their
+// ioErrConn, as they are still being used in other go-routines.
+func (p *Pool) forceCloseActive(ctxErr error) error {
+	var ids []int64
+	p.conns.Range(func(k, _ interface{}) bool {
+		if ioc := k.(*ioErrConn); atomic.LoadInt32(&ioc.active) == 1 {
+			ioc.Conn.Close()
+			ids = append(ids, ioc.id)
+		}
+		return true
+	})
+	if len(ids) == 0 {
+		return nil
+	}
+
+	shutdownErr := &PoolShutdownError{Err: ctxErr, ConnIDs: ids}
+	sort.Slice(shutdownErr.ConnIDs, func(i, j int) bool {
+		return shutdownErr.ConnIDs[i] < shutdownErr.ConnIDs[j]
+	})
+	return shutdownErr
+}
+
 // Close implements the Close method of the Client
 func (p *Pool) Close() error {
 	p.l.Lock()
 	if p.closed {
 		p.l.Unlock()
-		return errClientClosed
+		return ErrClientClosed
 	}
 	p.closed = true
+	if !p.shuttingDown {
+		p.stopAccepting()
+	}
 	close(p.closeCh)
 
 	// at this point get and put won't work anymore, so it's safe to empty and
@@ -640,6 +1747,24 @@ emptyLoop:
 			break emptyLoop
 		}
 	}
+	for p.blocking != nil && len(p.blocking) > 0 {
+		(<-p.blocking).Close()
+		atomic.AddInt64(&p.blockingOpen, -1)
+		p.traceConnClosed(trace.PoolConnClosedReasonPoolClosed)
+	}
+	for _, slot := range p.affinity {
+		// slots whose connection is in use are emptied by doAffinity once
+		// the Action completes.
+		select {
+		case ioc := <-slot:
+			if ioc != nil {
+				ioc.Close()
+				p.traceConnClosed(trace.PoolConnClosedReasonPoolClosed)
+			}
+			slot <- nil
+		default:
+		}
+	}
 	p.l.Unlock()
 
 	if p.pipeliner != nil {
@@ -0,0 +1,39 @@
+package radix
+
+import (
+	"time"
+)
+
+// errBudgetExceeded is the error an ioErrConn is marked with once it has
+// exceeded its error budget, see PoolErrorBudget.
+type errBudgetExceeded struct {
+	err error
+}
+
+func (e *errBudgetExceeded) Error() string {
+	return "connection error budget exceeded: " + e.err.Error()
+}
+
+func (e *errBudgetExceeded) Unwrap() error {
+	return e.err
+}
+
+// errBudget tracks the times at which errors have occurred on a connection, in
+// order to decide whether max of them have occurred within window.
+type errBudget struct {
+	max    int
+	window time.Duration
+	errs   []time.Time
+}
+
+// spend records an error at the given time, and returns true if max errors
+// have now occurred within the window.
+func (eb *errBudget) spend(now time.Time) bool {
+	cutoff := now.Add(-eb.window)
+	i := 0
+	for i < len(eb.errs) && !eb.errs[i].After(cutoff) {
+		i++
+	}
+	eb.errs = append(eb.errs[i:], now)
+	return len(eb.errs) >= eb.max
+}
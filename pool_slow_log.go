@@ -0,0 +1,102 @@
+package radix
+
+import (
+	mrand "math/rand"
+	"strings"
+	"time"
+)
+
+// SlowCommand describes an Action which took longer than the threshold given
+// to PoolSlowCommands.
+type SlowCommand struct {
+	// Commands and Keys are the Properties of the Action.
+	Commands []string
+	Keys     []string
+
+	// Addr is the address of the redis instance the Action was performed on.
+	Addr string
+
+	// Duration is the total time the Action took, including PoolWait.
+	Duration time.Duration
+
+	// PoolWait is the time spent getting a connection from the Pool. It's zero
+	// for Actions which were implicitly pipelined or performed on a connection
+	// dedicated to blocking commands, which don't wait on the Pool directly.
+	PoolWait time.Duration
+
+	// Err is the error returned from the Action, if any.
+	Err error
+
+	// Metadata is the Metadata of the Action, see WithMetadata.
+	Metadata Metadata
+}
+
+// String returns a single line description of the SlowCommand, suitable for
+// logging.
+func (sc SlowCommand) String() string {
+	var b strings.Builder
+	b.WriteString("slow command ")
+	b.WriteString(strings.Join(sc.Commands, ","))
+	if len(sc.Keys) > 0 {
+		b.WriteString(" keys=")
+		b.WriteString(strings.Join(sc.Keys, ","))
+	}
+	b.WriteString(" addr=")
+	b.WriteString(sc.Addr)
+	b.WriteString(" duration=")
+	b.WriteString(sc.Duration.String())
+	b.WriteString(" pool_wait=")
+	b.WriteString(sc.PoolWait.String())
+	if sc.Err != nil {
+		b.WriteString(" err=")
+		b.WriteString(sc.Err.Error())
+	}
+	return b.String()
+}
+
+type slowLogOpts struct {
+	threshold  time.Duration
+	sampleRate float64
+	fn         func(SlowCommand)
+}
+
+// slowLogSample is a sample of an Action being performed on a Pool, taken
+// before it's performed since Actions may be reused once they have been.
+type slowLogSample struct {
+	start          time.Time
+	commands, keys []string
+}
+
+// slowLogStart returns a sample of the Action if it's been chosen for slow
+// command logging, or nil.
+func (p *Pool) slowLogStart(a Action) *slowLogSample {
+	so := p.opts.slowLog
+	if so.fn == nil || (so.sampleRate < 1 && mrand.Float64() >= so.sampleRate) {
+		return nil
+	}
+	props := ActionProperties(a)
+	return &slowLogSample{
+		start:    time.Now(),
+		commands: append([]string(nil), props.Commands...),
+		keys:     append([]string(nil), props.Keys...),
+	}
+}
+
+func (p *Pool) slowLogEnd(s *slowLogSample, a Action, poolWait time.Duration, err error) {
+	if s == nil {
+		return
+	}
+	d := time.Since(s.start)
+	if d < p.opts.slowLog.threshold {
+		return
+	}
+	p.opts.slowLog.fn(SlowCommand{
+		Commands: s.commands,
+		Keys:     s.keys,
+		Addr:     p.addr,
+		Duration: d,
+		PoolWait: poolWait,
+		Err:      err,
+		Metadata: ActionMetadata(a),
+	})
+}
@@ -1,7 +1,10 @@
 package radix
 
 import (
+	"context"
 	"io"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	. "testing"
@@ -97,14 +100,14 @@ func TestPool(t *T) {
 func TestPoolGet(t *T) {
 	getBlock := func(p *Pool) (time.Duration, error) {
 		start := time.Now()
-		_, err := p.get()
+		_, err := p.get(PriorityNormal)
 		return time.Since(start), err
 	}
 
 	// this one is a bit weird, cause it would block infinitely if we let it
 	t.Run("onEmptyWait", func(t *T) {
 		pool := testPool(1, PoolOnEmptyWait())
-		conn, err := pool.get()
+		conn, err := pool.get(PriorityNormal)
 		assert.NoError(t, err)
 
 		go func() {
@@ -289,7 +292,557 @@ func TestPoolClose(t *T) {
 	pool := testPool(1)
 	assert.NoError(t, pool.Do(Cmd(nil, "PING")))
 	assert.NoError(t, pool.Close())
-	assert.Error(t, errClientClosed, pool.Do(Cmd(nil, "PING")))
+	assert.Error(t, ErrClientClosed, pool.Do(Cmd(nil, "PING")))
+}
+
+func TestPoolClientName(t *T) {
+	var l sync.Mutex
+	var names []string
+	connFunc := func(network, addr string) (Conn, error) {
+		return Stub(network, addr, func(args []string) interface{} {
+			if len(args) == 3 && args[0] == "CLIENT" && args[1] == "SETNAME" {
+				l.Lock()
+				names = append(names, args[2])
+				l.Unlock()
+			}
+			return "OK"
+		}), nil
+	}
+
+	pool, err := NewPool("tcp", "127.0.0.1:6379", 3,
+		PoolConnFunc(connFunc),
+		PoolClientName("test"),
+	)
+	require.NoError(t, err)
+	<-pool.initDone
+	defer pool.Close()
+
+	l.Lock()
+	defer l.Unlock()
+	assert.ElementsMatch(t, []string{"test-0", "test-1", "test-2"}, names)
+}
+
+func TestPoolWarmUp(t *T) {
+	errDial := errors.New("dial failed")
+	connFunc := func(delay time.Duration, failEvery int64) ConnFunc {
+		var dials int64
+		return func(network, addr string) (Conn, error) {
+			time.Sleep(delay)
+			if n := atomic.AddInt64(&dials, 1); failEvery > 0 && n%failEvery == 0 {
+				return nil, errDial
+			}
+			return Stub(network, addr, func(args []string) interface{} {
+				return "OK"
+			}), nil
+		}
+	}
+
+	t.Run("parallel", func(t *T) {
+		start := time.Now()
+		pool, err := NewPool("tcp", "127.0.0.1:6379", 5,
+			PoolConnFunc(connFunc(100*time.Millisecond, 0)),
+			PoolWarmUp(5*time.Second, 5),
+		)
+		require.NoError(t, err)
+		defer pool.Close()
+		assert.Equal(t, 5, len(pool.pool))
+		assert.True(t, time.Since(start) < 400*time.Millisecond)
+		<-pool.initDone
+		assert.Equal(t, 5, pool.NumAvailConns())
+	})
+
+	t.Run("partial", func(t *T) {
+		pool, err := NewPool("tcp", "127.0.0.1:6379", 4,
+			PoolConnFunc(connFunc(0, 2)),
+			PoolWarmUp(5*time.Second, 2),
+		)
+		require.NoError(t, err)
+		defer pool.Close()
+		assert.Equal(t, 2, len(pool.pool))
+
+		_, err = NewPool("tcp", "127.0.0.1:6379", 4,
+			PoolConnFunc(connFunc(0, 2)),
+			PoolWarmUp(5*time.Second, 3),
+		)
+		assert.True(t, errors.Is(err, errDial))
+	})
+
+	t.Run("timeout", func(t *T) {
+		_, err := NewPool("tcp", "127.0.0.1:6379", 3,
+			PoolConnFunc(connFunc(200*time.Millisecond, 0)),
+			PoolWarmUp(10*time.Millisecond, 1),
+		)
+		assert.Error(t, err)
+
+		pool, err := NewPool("tcp", "127.0.0.1:6379", 3,
+			PoolConnFunc(connFunc(200*time.Millisecond, 0)),
+			PoolWarmUp(10*time.Millisecond, 0),
+		)
+		require.NoError(t, err)
+		defer pool.Close()
+		<-pool.initDone
+		assert.Equal(t, 3, pool.NumAvailConns())
+	})
+}
+
+func TestPoolErrorBudget(t *T) {
+	connFunc := func(network, addr string) (Conn, error) {
+		return Stub(network, addr, func(args []string) interface{} {
+			switch args[0] {
+			case "GET":
+				return "not a number"
+			case "ERR":
+				return resp2.Error{E: errors.New("ERR bad")}
+			}
+			return "OK"
+		}), nil
+	}
+
+	var l sync.Mutex
+	var closed []trace.PoolConnClosedReason
+	var replaced []trace.PoolConnReplaced
+	replacedCh := make(chan struct{}, 1)
+	pool, err := NewPool("tcp", "127.0.0.1:6379", 1,
+		PoolConnFunc(connFunc),
+		PoolPipelineWindow(0, 0),
+		PoolErrorBudget(3, time.Minute),
+		PoolWithTrace(trace.PoolTrace{
+			ConnClosed: func(cc trace.PoolConnClosed) {
+				l.Lock()
+				closed = append(closed, cc.Reason)
+				l.Unlock()
+			},
+			ConnReplaced: func(cr trace.PoolConnReplaced) {
+				l.Lock()
+				replaced = append(replaced, cr)
+				l.Unlock()
+				replacedCh <- struct{}{}
+			},
+		}),
+	)
+	require.NoError(t, err)
+	defer pool.Close()
+	<-pool.initDone
+
+	// error responses from redis don't count
+	for i := 0; i < 5; i++ {
+		assert.Error(t, pool.Do(Cmd(nil, "ERR")))
+	}
+
+	var i int
+	for j := 0; j < 3; j++ {
+		assert.Error(t, pool.Do(Cmd(&i, "GET", "foo")))
+	}
+	<-replacedCh
+
+	l.Lock()
+	assert.Equal(t, []trace.PoolConnClosedReason{trace.PoolConnClosedReasonErrorBudget}, closed)
+	require.Len(t, replaced, 1)
+	assert.Equal(t, int64(1), replaced[0].Replacements)
+	assert.True(t, errors.As(replaced[0].Err, new(*errBudgetExceeded)))
+	l.Unlock()
+
+	// the replacement has its own budget
+	require.NoError(t, pool.Do(Cmd(nil, "SET", "foo", "bar")))
+	assert.Error(t, pool.Do(Cmd(&i, "GET", "foo")))
+	assert.Equal(t, 1, pool.NumAvailConns())
+
+	// errors outside the window don't count
+	eb := errBudget{max: 2, window: time.Second}
+	now := time.Now()
+	assert.False(t, eb.spend(now))
+	assert.False(t, eb.spend(now.Add(2*time.Second)))
+	assert.True(t, eb.spend(now.Add(2500*time.Millisecond)))
+}
+
+func TestPoolShutdown(t *T) {
+	stubPool := func(t *T) *Pool {
+		connFunc := func(network, addr string) (Conn, error) {
+			return Stub(network, addr, func(args []string) interface{} {
+				return "OK"
+			}), nil
+		}
+		pool, err := NewPool("tcp", "127.0.0.1:6379", 2, PoolConnFunc(connFunc))
+		require.NoError(t, err)
+		<-pool.initDone
+		return pool
+	}
+
+	// blockingAction returns an Action which won't complete until unblockCh is
+	// closed, and a channel which is closed once the Action has started.
+	blockingAction := func(unblockCh chan struct{}) (Action, chan struct{}) {
+		startedCh := make(chan struct{})
+		return WithConn("", func(c Conn) error {
+			close(startedCh)
+			<-unblockCh
+			return c.Do(Cmd(nil, "PING"))
+		}), startedCh
+	}
+
+	t.Run("graceful", func(t *T) {
+		pool := stubPool(t)
+		unblockCh := make(chan struct{})
+		a, startedCh := blockingAction(unblockCh)
+
+		doErrCh := make(chan error, 1)
+		go func() { doErrCh <- pool.Do(a) }()
+		<-startedCh
+
+		shutdownErrCh := make(chan error, 1)
+		go func() { shutdownErrCh <- pool.Shutdown(context.Background()) }()
+
+		// give Shutdown time to start, new Actions should be rejected
+		time.Sleep(100 * time.Millisecond)
+		assert.Equal(t, ErrClientClosed, pool.Do(Cmd(nil, "PING")))
+
+		close(unblockCh)
+		assert.NoError(t, <-doErrCh)
+		assert.NoError(t, <-shutdownErrCh)
+		assert.Equal(t, 0, pool.NumAvailConns())
+	})
+
+	t.Run("forced", func(t *T) {
+		pool := stubPool(t)
+		unblockCh := make(chan struct{})
+		a, startedCh := blockingAction(unblockCh)
+
+		doErrCh := make(chan error, 1)
+		go func() { doErrCh <- pool.Do(a) }()
+		<-startedCh
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		err := pool.Shutdown(ctx)
+
+		var shutdownErr *PoolShutdownError
+		require.True(t, errors.As(err, &shutdownErr))
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		assert.Len(t, shutdownErr.ConnIDs, 1)
+
+		close(unblockCh)
+		assert.Error(t, <-doErrCh)
+		assert.Equal(t, ErrClientClosed, pool.Shutdown(context.Background()))
+	})
+}
+
+func TestPoolBlockingConns(t *T) {
+	var l sync.Mutex
+	var numConns int
+	unblockCh := make(chan struct{})
+	connFunc := func(network, addr string) (Conn, error) {
+		l.Lock()
+		numConns++
+		l.Unlock()
+		return Stub(network, addr, func(args []string) interface{} {
+			if args[0] == "BLPOP" {
+				<-unblockCh
+				return []string{args[1], "bar"}
+			}
+			return "OK"
+		}), nil
+	}
+
+	pool, err := NewPool("tcp", "127.0.0.1:6379", 1,
+		PoolConnFunc(connFunc),
+		PoolOnEmptyWait(),
+		PoolBlockingConns(1),
+	)
+	require.NoError(t, err)
+	<-pool.initDone
+	defer pool.Close()
+
+	blpop := func() <-chan error {
+		errCh := make(chan error, 1)
+		go func() { errCh <- pool.Do(Cmd(nil, "BLPOP", "foo", "0")) }()
+		return errCh
+	}
+
+	// while the BLPOP is blocked other Actions should be able to use the pool's
+	// only connection.
+	errCh := blpop()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, pool.Do(Cmd(nil, "SET", "foo", "bar")))
+	}
+	unblockCh <- struct{}{}
+	require.NoError(t, <-errCh)
+
+	// the dedicated connection should be reused.
+	errCh = blpop()
+	unblockCh <- struct{}{}
+	require.NoError(t, <-errCh)
+
+	// once the dedicated connection is in use further blocking commands use
+	// the pool's normal connections, rather than creating more.
+	errCh, errCh2 := blpop(), blpop()
+	for pool.Stats().InUseConns < 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	unblockCh <- struct{}{}
+	unblockCh <- struct{}{}
+	require.NoError(t, <-errCh)
+	require.NoError(t, <-errCh2)
+
+	l.Lock()
+	defer l.Unlock()
+	assert.Equal(t, 2, numConns)
+}
+
+func TestPoolKeyAffinity(t *T) {
+	var l sync.Mutex
+	var numConns int
+	connFunc := func(network, addr string) (Conn, error) {
+		l.Lock()
+		defer l.Unlock()
+		numConns++
+		id := numConns
+		return Stub(network, addr, func(args []string) interface{} {
+			return id
+		}), nil
+	}
+
+	pool, err := NewPool("tcp", "127.0.0.1:6379", 1,
+		PoolConnFunc(connFunc),
+		PoolKeyAffinity(4),
+	)
+	require.NoError(t, err)
+	<-pool.initDone
+	defer pool.Close()
+
+	connID := func(key string) int {
+		var id int
+		require.NoError(t, pool.Do(WithAffinityKey(Cmd(&id, "GET", key), key)))
+		return id
+	}
+
+	// affinity connections are only created once they're needed, and the
+	// same key is always performed on the same one.
+	ids := map[string]int{}
+	for i := 0; i < 20; i++ {
+		key := "key" + strconv.Itoa(i)
+		ids[key] = connID(key)
+	}
+	for key, id := range ids {
+		assert.Equal(t, id, connID(key), key)
+	}
+
+	distinct := map[int]bool{}
+	for _, id := range ids {
+		assert.NotEqual(t, 1, id)
+		distinct[id] = true
+	}
+	assert.Len(t, distinct, 4)
+
+	// keys sharing a hash tag share a connection.
+	assert.Equal(t, connID("{user1}.a"), connID("{user1}.b"))
+
+	// Actions without an affinity key use the Pool's normal connections.
+	var id int
+	require.NoError(t, pool.Do(Cmd(&id, "GET", "key0")))
+	assert.Equal(t, 1, id)
+
+	l.Lock()
+	defer l.Unlock()
+	assert.Equal(t, 5, numConns)
+}
+
+func TestPoolStats(t *T) {
+	var l sync.Mutex
+	var failDial bool
+	unblockCh := make(chan struct{})
+	connFunc := func(network, addr string) (Conn, error) {
+		l.Lock()
+		defer l.Unlock()
+		if failDial {
+			return nil, errors.New("dial failed")
+		}
+		return Stub(network, addr, func(args []string) interface{} {
+			if args[0] == "BLOCK" {
+				<-unblockCh
+			}
+			return "OK"
+		}), nil
+	}
+
+	pool, err := NewPool("tcp", "127.0.0.1:6379", 1,
+		PoolConnFunc(connFunc),
+		PoolOnEmptyWait(),
+		PoolPipelineWindow(0, 0),
+	)
+	require.NoError(t, err)
+	<-pool.initDone
+	defer pool.Close()
+
+	stats := pool.Stats()
+	assert.Equal(t, 1, stats.OpenConns)
+	assert.Equal(t, 1, stats.IdleConns)
+	assert.Equal(t, 0, stats.InUseConns)
+	assert.Equal(t, uint64(1), stats.TotalCreated)
+
+	// take the only connection, and then have another Action wait on it.
+	errCh := make(chan error, 2)
+	go func() { errCh <- pool.Do(Cmd(nil, "BLOCK")) }()
+	for pool.Stats().InUseConns == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	go func() { errCh <- pool.Do(Cmd(nil, "BLOCK")) }()
+	for pool.Stats().Waiters == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	stats = pool.Stats()
+	assert.Equal(t, 0, stats.IdleConns)
+	assert.Equal(t, 1, stats.InUseConns)
+	assert.Equal(t, 1, stats.Waiters)
+
+	time.Sleep(10 * time.Millisecond)
+	unblockCh <- struct{}{}
+	unblockCh <- struct{}{}
+	require.NoError(t, <-errCh)
+	require.NoError(t, <-errCh)
+
+	stats = pool.Stats()
+	assert.Equal(t, 1, stats.IdleConns)
+	assert.Equal(t, 0, stats.InUseConns)
+	assert.Equal(t, 0, stats.Waiters)
+	assert.True(t, stats.AvgCheckoutWait >= 5*time.Millisecond, "AvgCheckoutWait:%v", stats.AvgCheckoutWait)
+
+	// discard the connection, and then fail to create a new one.
+	ioc, err := pool.get(PriorityNormal)
+	require.NoError(t, err)
+	ioc.lastIOErr = errors.New("i am error")
+	pool.put(ioc)
+
+	l.Lock()
+	failDial = true
+	l.Unlock()
+	pool.doRefill()
+	assert.Equal(t, uint64(1), pool.Stats().DialFailures)
+
+	stats = pool.Stats()
+	assert.Equal(t, 0, stats.OpenConns)
+	assert.Equal(t, uint64(1), stats.TotalCreated)
+	assert.Equal(t, uint64(1), stats.TotalClosed)
+}
+
+func TestPoolSlowCommands(t *T) {
+	connFunc := func(network, addr string) (Conn, error) {
+		return Stub(network, addr, func(args []string) interface{} {
+			if args[0] == "SLOW" {
+				time.Sleep(20 * time.Millisecond)
+			}
+			return "OK"
+		}), nil
+	}
+
+	newPool := func(sampleRate float64, fn func(SlowCommand)) *Pool {
+		pool, err := NewPool("tcp", "127.0.0.1:6379", 1,
+			PoolConnFunc(connFunc),
+			PoolPipelineWindow(0, 0),
+			PoolSlowCommands(10*time.Millisecond, sampleRate, fn),
+		)
+		require.NoError(t, err)
+		<-pool.initDone
+		return pool
+	}
+
+	var l sync.Mutex
+	var slow []SlowCommand
+	pool := newPool(1, func(sc SlowCommand) {
+		l.Lock()
+		defer l.Unlock()
+		slow = append(slow, sc)
+	})
+	defer pool.Close()
+
+	require.NoError(t, pool.Do(Cmd(nil, "GET", "foo")))
+	require.NoError(t, pool.Do(WithMetadata(Cmd(nil, "SLOW", "bar"), Metadata{"op": "test"})))
+
+	l.Lock()
+	require.Len(t, slow, 1)
+	sc := slow[0]
+	l.Unlock()
+	assert.Equal(t, []string{"SLOW"}, sc.Commands)
+	assert.Equal(t, []string{"bar"}, sc.Keys)
+	assert.Equal(t, "127.0.0.1:6379", sc.Addr)
+	assert.True(t, sc.Duration >= 20*time.Millisecond, "Duration:%v", sc.Duration)
+	assert.True(t, sc.PoolWait < sc.Duration)
+	assert.Equal(t, "test", sc.Metadata["op"])
+	assert.Contains(t, sc.String(), "slow command SLOW keys=bar addr=127.0.0.1:6379")
+
+	// with a sampleRate of 0 nothing is ever checked.
+	pool0 := newPool(0, func(sc SlowCommand) { t.Fatalf("unexpected slow command: %v", sc) })
+	defer pool0.Close()
+	require.NoError(t, pool0.Do(Cmd(nil, "SLOW", "bar")))
+}
+
+func TestPoolResetConns(t *T) {
+	newPool := func(resetSupported bool, cmdsCh chan<- string, init func(Conn) error) *Pool {
+		connFunc := func(network, addr string) (Conn, error) {
+			return Stub(network, addr, func(args []string) interface{} {
+				cmdsCh <- strings.Join(args, " ")
+				if args[0] == "RESET" && !resetSupported {
+					return resp2.Error{E: errors.New("ERR unknown command 'RESET'")}
+				} else if args[0] == "RESET" {
+					return resp2.SimpleString{S: "RESET"}
+				}
+				return "OK"
+			}), nil
+		}
+		pool, err := NewPool("tcp", "127.0.0.1:6379", 1,
+			PoolConnFunc(connFunc),
+			PoolPipelineWindow(0, 0),
+			PoolClientName("test"),
+			PoolResetConns(init),
+			PoolOnEmptyCreateAfter(0),
+			PoolRefillInterval(time.Hour),
+		)
+		require.NoError(t, err)
+		<-pool.initDone
+		return pool
+	}
+
+	withConn := WithConn("", func(conn Conn) error {
+		return conn.Do(Cmd(nil, "SELECT", "1"))
+	})
+
+	t.Run("Supported", func(t *T) {
+		cmdsCh := make(chan string, 16)
+		pool := newPool(true, cmdsCh, func(conn Conn) error {
+			return conn.Do(Cmd(nil, "SELECT", "2"))
+		})
+		defer pool.Close()
+		assert.Equal(t, "CLIENT SETNAME test-0", <-cmdsCh)
+
+		require.NoError(t, pool.Do(Cmd(nil, "GET", "foo")))
+		assert.Equal(t, "GET foo", <-cmdsCh)
+
+		require.NoError(t, pool.Do(WithMetadata(withConn, Metadata{"foo": "bar"})))
+		assert.Equal(t, "SELECT 1", <-cmdsCh)
+		assert.Equal(t, "RESET", <-cmdsCh)
+		assert.Equal(t, "CLIENT SETNAME test-0", <-cmdsCh)
+		assert.Equal(t, "SELECT 2", <-cmdsCh)
+		assert.Empty(t, cmdsCh)
+		assert.Equal(t, uint64(0), pool.Stats().TotalClosed)
+	})
+
+	t.Run("Unsupported", func(t *T) {
+		cmdsCh := make(chan string, 16)
+		pool := newPool(false, cmdsCh, nil)
+		defer pool.Close()
+		assert.Equal(t, "CLIENT SETNAME test-0", <-cmdsCh)
+
+		require.NoError(t, pool.Do(withConn))
+		assert.Equal(t, "SELECT 1", <-cmdsCh)
+		assert.Equal(t, "RESET", <-cmdsCh)
+		assert.Equal(t, uint64(1), pool.Stats().TotalClosed)
+
+		// RESET isn't attempted again.
+		require.NoError(t, pool.Do(withConn))
+		assert.Equal(t, "CLIENT SETNAME test-1", <-cmdsCh)
+		assert.Equal(t, "SELECT 1", <-cmdsCh)
+		assert.Empty(t, cmdsCh)
+		assert.Equal(t, uint64(2), pool.Stats().TotalClosed)
+	})
 }
 
 func TestIoErrConn(t *T) {
@@ -316,3 +869,179 @@ func TestIoErrConn(t *T) {
 		require.Nil(t, err2)
 	})
 }
+
+func TestPoolPriorityLanes(t *T) {
+	stubPool := func(t *T, size, reserve int) *Pool {
+		connFunc := func(network, addr string) (Conn, error) {
+			return Stub(network, addr, func(args []string) interface{} {
+				return "OK"
+			}), nil
+		}
+		pool, err := NewPool("tcp", "127.0.0.1:6379", size,
+			PoolConnFunc(connFunc),
+			PoolOnEmptyWait(),
+			PoolPingInterval(0),
+			PoolPipelineWindow(0, 0),
+			PoolPriorityLanes(reserve),
+		)
+		require.NoError(t, err)
+		<-pool.initDone
+		return pool
+	}
+
+	// do performs an Action with the given Priority in the background. The
+	// Action sends its Priority on startedCh once it has a connection, and then
+	// waits for unblockCh to be closed.
+	do := func(pool *Pool, prio Priority, startedCh chan Priority, unblockCh chan struct{}) <-chan error {
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- pool.Do(WithPriority(WithConn("", func(c Conn) error {
+				startedCh <- prio
+				<-unblockCh
+				return c.Do(Cmd(nil, "PING"))
+			}), prio))
+		}()
+		return errCh
+	}
+
+	t.Run("order", func(t *T) {
+		pool := stubPool(t, 1, 0)
+		defer pool.Close()
+
+		startedCh := make(chan Priority, 4)
+		holdCh := make(chan struct{})
+		holdErrCh := do(pool, PriorityNormal, startedCh, holdCh)
+		assert.Equal(t, PriorityNormal, <-startedCh)
+
+		unblockCh := make(chan struct{})
+		close(unblockCh)
+		var errChs []<-chan error
+		for _, prio := range []Priority{PriorityLow, PriorityNormal, PriorityHigh} {
+			errChs = append(errChs, do(pool, prio, startedCh, unblockCh))
+			time.Sleep(50 * time.Millisecond)
+		}
+
+		close(holdCh)
+		require.NoError(t, <-holdErrCh)
+		for _, errCh := range errChs {
+			require.NoError(t, <-errCh)
+		}
+		assert.Equal(t, PriorityHigh, <-startedCh)
+		assert.Equal(t, PriorityNormal, <-startedCh)
+		assert.Equal(t, PriorityLow, <-startedCh)
+	})
+
+	t.Run("reserve", func(t *T) {
+		pool := stubPool(t, 2, 1)
+		defer pool.Close()
+
+		startedCh := make(chan Priority, 3)
+		holdCh := make(chan struct{})
+		holdErrCh := do(pool, PriorityLow, startedCh, holdCh)
+		assert.Equal(t, PriorityLow, <-startedCh)
+
+		// the only idle connection is reserved, so another low priority Action
+		// must wait, but a high priority one needn't.
+		unblockCh := make(chan struct{})
+		close(unblockCh)
+		lowErrCh := do(pool, PriorityLow, startedCh, unblockCh)
+		time.Sleep(50 * time.Millisecond)
+		assert.Len(t, startedCh, 0)
+
+		require.NoError(t, <-do(pool, PriorityHigh, startedCh, unblockCh))
+		assert.Equal(t, PriorityHigh, <-startedCh)
+		assert.Len(t, startedCh, 0)
+
+		close(holdCh)
+		require.NoError(t, <-holdErrCh)
+		require.NoError(t, <-lowErrCh)
+		assert.Equal(t, PriorityLow, <-startedCh)
+	})
+
+	t.Run("concurrent", func(t *T) {
+		pool := stubPool(t, 1, 0)
+		defer pool.Close()
+
+		// a call mustn't start waiting just as the only connection is put
+		// back, or it would wait forever.
+		for i := 0; i < 10000; i++ {
+			ioc, err := pool.get(PriorityNormal)
+			require.NoError(t, err)
+
+			errCh := make(chan error, 1)
+			go func(prio Priority) {
+				ioc, err := pool.get(prio)
+				if err == nil {
+					pool.put(ioc)
+				}
+				errCh <- err
+			}(Priority(i % numPriorities))
+			pool.put(ioc)
+
+			select {
+			case err := <-errCh:
+				require.NoError(t, err)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("call is stuck waiting on an idle connection (round %d)", i)
+			}
+		}
+	})
+}
+
+func TestPoolReauthRetry(t *T) {
+	var serverPass atomic.Value
+	serverPass.Store("a")
+	var dials int64
+	connFunc := func(network, addr string) (Conn, error) {
+		atomic.AddInt64(&dials, 1)
+		pass := serverPass.Load().(string)
+		return Stub(network, addr, func(args []string) interface{} {
+			if pass != serverPass.Load().(string) {
+				return resp2.Error{E: errors.New("NOAUTH Authentication required.")}
+			} else if args[0] == "FLUSHALL" {
+				return resp2.Error{E: errors.New("NOPERM this user has no permissions to run the 'flushall' command")}
+			}
+			return "OK"
+		}), nil
+	}
+
+	pool, err := NewPool("tcp", "127.0.0.1:6379", 1,
+		PoolConnFunc(connFunc),
+		PoolPipelineWindow(0, 0),
+		PoolOnEmptyCreateAfter(0),
+		PoolRefillInterval(time.Hour),
+		PoolReauthRetry(),
+	)
+	require.NoError(t, err)
+	defer pool.Close()
+	<-pool.initDone
+	require.Equal(t, int64(1), atomic.LoadInt64(&dials))
+
+	serverPass.Store("b")
+	require.NoError(t, pool.Do(Cmd(nil, "SET", "foo", "bar")))
+	assert.Equal(t, int64(2), atomic.LoadInt64(&dials))
+	assert.Equal(t, uint64(1), pool.Stats().TotalClosed)
+
+	// the new connection was put back in the pool
+	require.NoError(t, pool.Do(Cmd(nil, "SET", "foo", "bar")))
+	assert.Equal(t, int64(2), atomic.LoadInt64(&dials))
+
+	// WithConn isn't retried, but its connection is still replaced
+	serverPass.Store("c")
+	var calls int
+	err = pool.Do(WithConn("", func(conn Conn) error {
+		calls++
+		return conn.Do(Cmd(nil, "SET", "foo", "bar"))
+	}))
+	assert.True(t, isAuthErr(err))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, uint64(2), pool.Stats().TotalClosed)
+
+	// NOPERM is only retried for a single command
+	err = pool.Do(Cmd(nil, "FLUSHALL"))
+	assert.True(t, isAuthErr(err))
+	assert.Equal(t, int64(4), atomic.LoadInt64(&dials))
+	err = pool.Do(Pipeline(Cmd(nil, "SET", "foo", "bar"), Cmd(nil, "FLUSHALL")))
+	assert.True(t, isAuthErr(err))
+	assert.Equal(t, int64(5), atomic.LoadInt64(&dials))
+}
@@ -0,0 +1,86 @@
+package radix
+
+// Priority describes how urgently an Action should be performed, relative to
+// other Actions performed on the same Client. See WithPriority.
+type Priority int
+
+// Priorities which may be given to WithPriority. Actions which aren't given a
+// Priority are treated as having PriorityNormal.
+const (
+	// PriorityLow is intended for background and batch work, which can
+	// tolerate waiting behind everything else.
+	PriorityLow Priority = iota
+
+	// PriorityNormal is the Priority of all Actions by default.
+	PriorityNormal
+
+	// PriorityHigh is intended for latency sensitive, e.g. user-facing,
+	// Actions.
+	PriorityHigh
+
+	numPriorities = int(PriorityHigh) + 1
+)
+
+// PriorityAction is an Action which has a Priority. Clients which support
+// prioritizing Actions, such as a Pool created with PoolPriorityLanes, will use
+// this to decide the order in which Actions waiting on a connection are
+// performed.
+type PriorityAction interface {
+	Action
+	Priority() Priority
+}
+
+func actionPriority(a Action) Priority {
+	for {
+		if pa, ok := a.(PriorityAction); ok {
+			return clampPriority(pa.Priority())
+		} else if wa, ok := a.(wrappedAction); ok {
+			a = wa.unwrapAction()
+		} else {
+			return PriorityNormal
+		}
+	}
+}
+
+func clampPriority(prio Priority) Priority {
+	switch {
+	case prio < PriorityLow:
+		return PriorityLow
+	case prio > PriorityHigh:
+		return PriorityHigh
+	default:
+		return prio
+	}
+}
+
+type priorityAction struct {
+	Action
+	prio Priority
+}
+
+func (pa priorityAction) unwrapAction() Action {
+	return pa.Action
+}
+
+func (pa priorityAction) Priority() Priority {
+	return pa.prio
+}
+
+func (pa priorityAction) ReadOnly() bool {
+	return isReadOnly(pa.Action)
+}
+
+func (pa priorityAction) ClusterCanRetry() bool {
+	return canClusterRetry(pa.Action)
+}
+
+// WithPriority wraps the given Action such that it implements PriorityAction,
+// with its Priority method returning the given Priority. Clients which don't
+// support prioritizing Actions perform the returned Action as normal.
+//
+// NOTE that the returned Action is never a CmdAction, even if the given one is,
+// so that a Pool will perform it on a connection of its own rather than
+// implicitly pipelining it alongside Actions of other priorities.
+func WithPriority(a Action, prio Priority) Action {
+	return priorityAction{Action: a, prio: prio}
+}
@@ -0,0 +1,96 @@
+package radix
+
+import "strings"
+
+// Properties describes what an Action does, in terms of the commands it
+// performs and the keys it acts on, so that generic middleware (e.g. for key
+// prefixing, routing or metrics) can inspect any Action.
+type Properties struct {
+	// Commands are the names of the commands the Action performs, uppercased,
+	// in the order they're performed. Subcommands (e.g. the GET of CONFIG GET)
+	// are not included. Empty if the commands aren't known ahead of time, as is
+	// the case for WithConn.
+	Commands []string
+
+	// Keys are the keys the Action acts on, without duplicates.
+	Keys []string
+}
+
+// PropertiesAction is an Action which can describe its own Properties. All
+// Actions created by this package, i.e. by Cmd, FlatCmd, EvalScript, Pipeline
+// and WithConn, implement this interface.
+type PropertiesAction interface {
+	Action
+	Properties() Properties
+}
+
+// ActionProperties returns the Properties of the given Action. Actions wrapped
+// by ReadOnly, WithPriority or WithMetadata have the Properties of the Action
+// they wrap. If the Action doesn't implement PropertiesAction then only its
+// Keys are returned.
+//
+// The returned Properties must not be modified.
+func ActionProperties(a Action) Properties {
+	for {
+		if pa, ok := a.(PropertiesAction); ok {
+			return pa.Properties()
+		} else if wa, ok := a.(wrappedAction); ok {
+			a = wa.unwrapAction()
+		} else {
+			return Properties{Keys: nonEmptyKeys(a.Keys())}
+		}
+	}
+}
+
+func nonEmptyKeys(keys []string) []string {
+	for _, k := range keys {
+		if k != "" {
+			continue
+		}
+		filtered := make([]string, 0, len(keys))
+		for _, k := range keys {
+			if k != "" {
+				filtered = append(filtered, k)
+			}
+		}
+		return filtered
+	}
+	return keys
+}
+
+func (c *cmdAction) Properties() Properties {
+	return Properties{
+		Commands: []string{strings.ToUpper(c.cmd)},
+		Keys:     c.Keys(),
+	}
+}
+
+func (ec *evalAction) Properties() Properties {
+	return Properties{
+		Commands: []string{string(evalsha)},
+		Keys:     ec.keys,
+	}
+}
+
+// Properties returns the Properties of all of the Pipeline's commands, in
+// order. A MULTI/EXEC transaction performed as a Pipeline will therefore have
+// MULTI and EXEC in its Commands.
+func (p pipeline) Properties() Properties {
+	var props Properties
+	seen := map[string]bool{}
+	for _, cmd := range p {
+		cmdProps := ActionProperties(cmd)
+		props.Commands = append(props.Commands, cmdProps.Commands...)
+		for _, k := range cmdProps.Keys {
+			if !seen[k] {
+				seen[k] = true
+				props.Keys = append(props.Keys, k)
+			}
+		}
+	}
+	return props
+}
+
+func (wc *withConn) Properties() Properties {
+	return Properties{Keys: nonEmptyKeys(wc.key[:])}
+}
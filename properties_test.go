@@ -0,0 +1,60 @@
+package radix
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActionProperties(t *T) {
+	es := NewEvalScript(1, "return 1")
+	tests := []struct {
+		a   Action
+		exp Properties
+	}{
+		{
+			a:   Cmd(nil, "get", "foo"),
+			exp: Properties{Commands: []string{"GET"}, Keys: []string{"foo"}},
+		},
+		{
+			a:   FlatCmd(nil, "SET", "foo", 1),
+			exp: Properties{Commands: []string{"SET"}, Keys: []string{"foo"}},
+		},
+		{
+			a:   Cmd(nil, "PING"),
+			exp: Properties{Commands: []string{"PING"}},
+		},
+		{
+			a:   es.Cmd(nil, "foo", "bar"),
+			exp: Properties{Commands: []string{"EVALSHA"}, Keys: []string{"foo"}},
+		},
+		{
+			a: Pipeline(
+				Cmd(nil, "MULTI"),
+				Cmd(nil, "SET", "foo", "1"),
+				Cmd(nil, "MSET", "bar", "2", "foo", "3"),
+				Cmd(nil, "EXEC"),
+			),
+			exp: Properties{
+				Commands: []string{"MULTI", "SET", "MSET", "EXEC"},
+				Keys:     []string{"foo", "bar"},
+			},
+		},
+		{
+			a:   WithConn("foo", func(Conn) error { return nil }),
+			exp: Properties{Keys: []string{"foo"}},
+		},
+		{
+			a:   WithConn("", func(Conn) error { return nil }),
+			exp: Properties{Keys: []string{}},
+		},
+		{
+			a:   WithMetadata(WithPriority(ReadOnly(Cmd(nil, "GET", "foo")), PriorityLow), nil),
+			exp: Properties{Commands: []string{"GET"}, Keys: []string{"foo"}},
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.exp, ActionProperties(test.a))
+	}
+}
@@ -0,0 +1,153 @@
+package radix
+
+import (
+	"github.com/mediocregopher/radix/v3/resp"
+)
+
+// ProxyUnsupportedError is returned by Clients created with ProxyCompat or
+// NewProxyPool when an Action would perform a command which redis proxies,
+// like twemproxy or Envoy's redis filter, don't support.
+type ProxyUnsupportedError struct {
+	// Cmd is the uppercased name of the unsupported command.
+	Cmd string
+}
+
+func (e *ProxyUnsupportedError) Error() string {
+	return "command " + e.Cmd + " is not supported through a redis proxy"
+}
+
+// proxyUnsupportedCmds are the commands which twemproxy and/or Envoy don't
+// support, generally because they have state tied to a connection, don't act
+// on keys, or block.
+var proxyUnsupportedCmds = map[string]bool{
+	"MULTI":   true,
+	"EXEC":    true,
+	"DISCARD": true,
+	"WATCH":   true,
+	"UNWATCH": true,
+
+	"SELECT": true,
+	"MOVE":   true,
+	"SWAPDB": true,
+
+	"SUBSCRIBE":    true,
+	"PSUBSCRIBE":   true,
+	"SSUBSCRIBE":   true,
+	"UNSUBSCRIBE":  true,
+	"PUNSUBSCRIBE": true,
+	"SUNSUBSCRIBE": true,
+	"PUBLISH":      true,
+	"SPUBLISH":     true,
+
+	"BLPOP":      true,
+	"BRPOP":      true,
+	"BRPOPLPUSH": true,
+	"BLMOVE":     true,
+	"BLMPOP":     true,
+	"BZPOPMIN":   true,
+	"BZPOPMAX":   true,
+	"BZMPOP":     true,
+	"WAIT":       true,
+
+	"CLIENT":    true,
+	"CONFIG":    true,
+	"CLUSTER":   true,
+	"READONLY":  true,
+	"READWRITE": true,
+	"SCAN":      true,
+	"KEYS":      true,
+	"RANDOMKEY": true,
+	"DBSIZE":    true,
+	"FLUSHDB":   true,
+	"FLUSHALL":  true,
+	"SCRIPT":    true,
+	"MONITOR":   true,
+	"REPLICAOF": true,
+	"SLAVEOF":   true,
+	"SHUTDOWN":  true,
+}
+
+func proxyCheckCmds(cmds []string) error {
+	for _, cmd := range cmds {
+		if proxyUnsupportedCmds[cmd] {
+			return &ProxyUnsupportedError{Cmd: cmd}
+		}
+	}
+	return nil
+}
+
+type proxyClient struct {
+	Client
+}
+
+// ProxyCompat wraps the given Client so that it can be used with a redis
+// proxy, such as twemproxy or Envoy's redis filter. Actions which would
+// perform a command unsupported by such proxies (e.g. MULTI, SELECT,
+// SUBSCRIBE or blocking commands) return a *ProxyUnsupportedError rather than
+// being sent.
+//
+// Actions whose commands can't be known ahead of time, such as those created
+// by WithConn, are checked as each command is written to the connection.
+func ProxyCompat(c Client) Client {
+	return proxyClient{c}
+}
+
+func (pc proxyClient) Do(a Action) error {
+	if cmds := ActionProperties(a).Commands; len(cmds) > 0 {
+		if err := proxyCheckCmds(cmds); err != nil {
+			return err
+		}
+		return pc.Client.Do(a)
+	}
+	return pc.Client.Do(proxyAction{a})
+}
+
+// proxyAction wraps an Action whose commands aren't known ahead of time, so
+// that they can be checked as they're written.
+type proxyAction struct {
+	Action
+}
+
+func (pa proxyAction) unwrapAction() Action {
+	return pa.Action
+}
+
+func (pa proxyAction) Run(c Conn) error {
+	return pa.Action.Run(proxyConn{c})
+}
+
+type proxyConn struct {
+	Conn
+}
+
+func (pc proxyConn) Encode(m resp.Marshaler) error {
+	if a, ok := m.(Action); ok {
+		if err := proxyCheckCmds(ActionProperties(a).Commands); err != nil {
+			return err
+		}
+	}
+	return pc.Conn.Encode(m)
+}
+
+func (pc proxyConn) Do(a Action) error {
+	return a.Run(pc)
+}
+
+// NewProxyPool creates a Pool to the redis proxy at the given address, e.g.
+// twemproxy or an Envoy redis filter, and wraps it using ProxyCompat. The
+// Pool's pooling and implicit pipelining work as normal.
+//
+// Options which would perform commands unsupported by proxies are disabled:
+// PoolClientName has no effect, and PoolBlockingConns is always 0 (blocking
+// commands are rejected by ProxyCompat anyway).
+//
+// A proxy handles the topology of the redis instances behind it, so use this
+// rather than Cluster or Sentinel when connecting through one.
+func NewProxyPool(network, addr string, size int, opts ...PoolOpt) (Client, error) {
+	opts = append(opts, PoolClientName(""), PoolBlockingConns(0))
+	p, err := NewPool(network, addr, size, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return ProxyCompat(p), nil
+}
@@ -0,0 +1,52 @@
+package radix
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+)
+
+func TestProxyCompat(t *T) {
+	var cmds []string
+	connFunc := func(network, addr string) (Conn, error) {
+		return Stub(network, addr, func(args []string) interface{} {
+			cmds = append(cmds, args[0])
+			return "OK"
+		}), nil
+	}
+	client, err := NewProxyPool("tcp", "127.0.0.1:22121", 1,
+		PoolConnFunc(connFunc),
+		PoolPingInterval(0),
+		PoolClientName("ignored"),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	assertUnsupported := func(err error, cmd string) {
+		var unsupportedErr *ProxyUnsupportedError
+		require.True(t, errors.As(err, &unsupportedErr), "err:%v", err)
+		assert.Equal(t, cmd, unsupportedErr.Cmd)
+	}
+
+	require.NoError(t, client.Do(Cmd(nil, "SET", "foo", "bar")))
+	assertUnsupported(client.Do(Cmd(nil, "select", "1")), "SELECT")
+	assertUnsupported(client.Do(Cmd(nil, "BLPOP", "foo", "0")), "BLPOP")
+	assertUnsupported(client.Do(Pipeline(
+		Cmd(nil, "GET", "foo"),
+		Cmd(nil, "CLIENT", "LIST"),
+	)), "CLIENT")
+
+	err = client.Do(WithConn("foo", func(c Conn) error {
+		if err := c.Do(Cmd(nil, "GET", "foo")); err != nil {
+			return err
+		}
+		return c.Do(Cmd(nil, "MULTI"))
+	}))
+	assertUnsupported(err, "MULTI")
+
+	// CLIENT SETNAME shouldn't have been sent, nor any of the unsupported
+	// commands.
+	assert.Equal(t, []string{"SET", "GET"}, cmds)
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	errors "golang.org/x/xerrors"
@@ -16,7 +17,7 @@ import (
 
 // PubSubMessage describes a message being published to a subscribed channel
 type PubSubMessage struct {
-	Type    string // "message" or "pmessage"
+	Type    string // "message", "pmessage" or "smessage"
 	Pattern string // will be set if Type is "pmessage"
 	Channel string
 	Message []byte
@@ -31,7 +32,7 @@ func (m PubSubMessage) MarshalRESP(w io.Writer) error {
 		}
 	}
 
-	if m.Type == "message" {
+	if m.Type == "message" || m.Type == "smessage" {
 		marshal(resp2.ArrayHeader{N: 3})
 		marshal(resp2.BulkString{S: m.Type})
 	} else if m.Type == "pmessage" {
@@ -48,6 +49,21 @@ func (m PubSubMessage) MarshalRESP(w io.Writer) error {
 
 var errNotPubSubMessage = errors.New("message is not a PubSubMessage")
 
+// sunsubscribeReply is returned from PubSubMessage's UnmarshalRESP when an
+// sunsubscribe reply is read, which may be the reply to an SUNSUBSCRIBE or may
+// have been sent by redis because the channel's slot has been moved.
+type sunsubscribeReply struct {
+	channel string
+}
+
+func (r sunsubscribeReply) Error() string {
+	return "sunsubscribe reply for channel " + r.channel
+}
+
+func (r sunsubscribeReply) Unwrap() error {
+	return errNotPubSubMessage
+}
+
 // UnmarshalRESP implements the Unmarshaler interface
 func (m *PubSubMessage) UnmarshalRESP(br *bufio.Reader) error {
 	// This method will fully consume the message on the wire, regardless of if
@@ -84,8 +100,8 @@ func (m *PubSubMessage) UnmarshalRESP(br *bufio.Reader) error {
 	}
 
 	switch string(msgType.B) {
-	case "message":
-		m.Type = "message"
+	case "message", "smessage":
+		m.Type = string(msgType.B)
 		if ah.N != 3 {
 			return errors.New("message has wrong number of elements")
 		}
@@ -100,6 +116,17 @@ func (m *PubSubMessage) UnmarshalRESP(br *bufio.Reader) error {
 			return err
 		}
 		m.Pattern = pattern.S
+	case "sunsubscribe":
+		if ah.N != 3 {
+			return errors.New("message has wrong number of elements")
+		}
+		var channel resp2.BulkString
+		if err := channel.UnmarshalRESP(br); err != nil {
+			return err
+		} else if err := (resp2.Any{}).UnmarshalRESP(br); err != nil {
+			return err
+		}
+		return sunsubscribeReply{channel: channel.S}
 	default:
 		// if it's not a PubSubMessage then discard the rest of the array
 		for i := 1; i < ah.N; i++ {
@@ -184,7 +211,8 @@ func (cs chanSet) inverse() map[chan<- PubSubMessage][]string {
 //
 // NOTE the PubSubMessage channels should never block. If any channels block
 // when being written to they will block all other channels from receiving a
-// publish and block methods from returning.
+// publish and block methods from returning. See NewPubSubBuffer for a way of
+// controlling what happens when a consumer falls behind.
 type PubSubConn interface {
 	// Subscribe subscribes the PubSubConn to the given set of channels. msgCh
 	// will receieve a PubSubMessage for every publish written to any of the
@@ -227,11 +255,21 @@ type PubSubConn interface {
 }
 
 type pubSubConn struct {
+	// sunsubPending is the number of sunsubscribe replies expected in response
+	// to SUNSUBSCRIBE commands. atomic, must be first for alignment.
+	sunsubPending int64
+
 	conn Conn
 
 	csL   sync.RWMutex
 	subs  chanSet
 	psubs chanSet
+	ssubs chanSet
+
+	// onSUnsubscribed, if set, is called from the spin go-routine when redis
+	// unsubscribes the connection from a shard channel without it having been
+	// asked to, e.g. because the channel's slot was moved to another node.
+	onSUnsubscribed func(channel string)
 
 	// These are used for writing commands and waiting for their response (e.g.
 	// SUBSCRIBE, PING). See the do method for how that works.
@@ -258,12 +296,18 @@ func PubSub(rc Conn) PubSubConn {
 }
 
 func newPubSub(rc Conn, closeErrCh chan error) PubSubConn {
+	return newPubSubConn(rc, closeErrCh, nil)
+}
+
+func newPubSubConn(rc Conn, closeErrCh chan error, onSUnsubscribed func(string)) *pubSubConn {
 	c := &pubSubConn{
-		conn:       rc,
-		subs:       chanSet{},
-		psubs:      chanSet{},
-		cmdResCh:   make(chan error, 1),
-		closeErrCh: closeErrCh,
+		conn:            rc,
+		subs:            chanSet{},
+		psubs:           chanSet{},
+		ssubs:           chanSet{},
+		onSUnsubscribed: onSUnsubscribed,
+		cmdResCh:        make(chan error, 1),
+		closeErrCh:      closeErrCh,
 	}
 	go c.spin()
 
@@ -296,6 +340,8 @@ func (c *pubSubConn) publish(m PubSubMessage) {
 	var subs map[chan<- PubSubMessage]bool
 	if m.Type == "pmessage" {
 		subs = c.psubs[m.Pattern]
+	} else if m.Type == "smessage" {
+		subs = c.ssubs[m.Channel]
 	} else {
 		subs = c.subs[m.Channel]
 	}
@@ -309,9 +355,13 @@ func (c *pubSubConn) spin() {
 	for {
 		var m PubSubMessage
 		err := c.conn.Decode(&m)
+		var sunsub sunsubscribeReply
 		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
 			c.testEvent("timeout")
 			continue
+		} else if errors.As(err, &sunsub) {
+			c.sunsubscribed(sunsub.channel)
+			continue
 		} else if errors.Is(err, errNotPubSubMessage) {
 			c.cmdResCh <- nil
 			continue
@@ -323,6 +373,22 @@ func (c *pubSubConn) spin() {
 	}
 }
 
+// sunsubscribed handles an sunsubscribe reply read off the connection.
+func (c *pubSubConn) sunsubscribed(channel string) {
+	if atomic.AddInt64(&c.sunsubPending, -1) >= 0 {
+		c.cmdResCh <- nil
+		return
+	}
+	atomic.AddInt64(&c.sunsubPending, 1)
+
+	c.csL.Lock()
+	delete(c.ssubs, channel)
+	c.csL.Unlock()
+	if c.onSUnsubscribed != nil {
+		c.onSUnsubscribed(channel)
+	}
+}
+
 // NOTE cmdL _must_ be held to use do
 func (c *pubSubConn) do(exp int, cmd string, args ...string) error {
 	rcmd := Cmd(nil, cmd, args...)
@@ -348,6 +414,7 @@ func (c *pubSubConn) closeInner(cmdResErr error) error {
 		c.closeErr = c.conn.Close()
 		c.subs = nil
 		c.psubs = nil
+		c.ssubs = nil
 
 		if cmdResErr != nil {
 			select {
@@ -454,6 +521,55 @@ func (c *pubSubConn) PUnsubscribe(msgCh chan<- PubSubMessage, patterns ...string
 	return c.do(len(emptyPatterns), "PUNSUBSCRIBE", emptyPatterns...)
 }
 
+// SSubscribe is like Subscribe, but it subscribes msgCh to a set of shard
+// channels using SSUBSCRIBE. All of the channels must belong to slots served by
+// the node the pubSubConn is connected to. See ClusterPubSub.
+func (c *pubSubConn) SSubscribe(msgCh chan<- PubSubMessage, channels ...string) error {
+	c.cmdL.Lock()
+	defer c.cmdL.Unlock()
+
+	c.csL.RLock()
+	missing := c.ssubs.missing(channels)
+	c.csL.RUnlock()
+
+	if len(missing) > 0 {
+		if err := c.do(len(missing), "SSUBSCRIBE", missing...); err != nil {
+			return err
+		}
+	}
+
+	c.csL.Lock()
+	for _, channel := range channels {
+		c.ssubs.add(channel, msgCh)
+	}
+	c.csL.Unlock()
+
+	return nil
+}
+
+// SUnsubscribe is like Unsubscribe, but it unsubscribes msgCh from a set of
+// shard channels using SUNSUBSCRIBE.
+func (c *pubSubConn) SUnsubscribe(msgCh chan<- PubSubMessage, channels ...string) error {
+	c.cmdL.Lock()
+	defer c.cmdL.Unlock()
+
+	c.csL.Lock()
+	emptyChannels := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		if empty := c.ssubs.del(channel, msgCh); empty {
+			emptyChannels = append(emptyChannels, channel)
+		}
+	}
+	c.csL.Unlock()
+
+	if len(emptyChannels) == 0 {
+		return nil
+	}
+
+	atomic.AddInt64(&c.sunsubPending, int64(len(emptyChannels)))
+	return c.do(len(emptyChannels), "SUNSUBSCRIBE", emptyChannels...)
+}
+
 func (c *pubSubConn) Ping() error {
 	c.cmdL.Lock()
 	defer c.cmdL.Unlock()
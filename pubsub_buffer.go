@@ -0,0 +1,265 @@
+package radix
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+// ErrPubSubBufferFull is returned from PubSubBuffer's Err method when the
+// PubSubCloseOnOverflow policy is used and the buffer overflowed.
+var ErrPubSubBufferFull = errors.New("pubsub buffer is full")
+
+// PubSubOverflowPolicy describes what a PubSubBuffer does with a new
+// PubSubMessage when its buffer is full.
+type PubSubOverflowPolicy int
+
+// Enumeration of the possible PubSubOverflowPolicy values.
+const (
+	// PubSubBlock waits for there to be room in the buffer, for up to the
+	// duration given to PubSubBufferBlockTimeout, after which the new message
+	// is dropped. If no timeout was given then it waits indefinitely.
+	PubSubBlock PubSubOverflowPolicy = iota
+
+	// PubSubDropOldest drops the oldest message in the buffer to make room
+	// for the new one.
+	PubSubDropOldest
+
+	// PubSubDropNewest drops the new message.
+	PubSubDropNewest
+
+	// PubSubCloseOnOverflow drops the new message, along with all future
+	// messages, and closes the channel returned from the Done method once the
+	// messages already in the buffer have been delivered. The Err method will
+	// then return ErrPubSubBufferFull.
+	PubSubCloseOnOverflow
+)
+
+type pubSubBufferOpts struct {
+	size         int
+	policy       PubSubOverflowPolicy
+	blockTimeout time.Duration
+	onDrop       func(PubSubMessage)
+}
+
+// PubSubBufferOpt is an optional behavior which can be applied to the
+// NewPubSubBuffer function to effect a PubSubBuffer's behavior.
+type PubSubBufferOpt func(*pubSubBufferOpts)
+
+// PubSubBufferSize sets the number of messages which can be buffered while
+// waiting for the consumer to read them.
+func PubSubBufferSize(size int) PubSubBufferOpt {
+	return func(opts *pubSubBufferOpts) {
+		opts.size = size
+	}
+}
+
+// PubSubBufferOnOverflow sets what the PubSubBuffer does when a message is
+// received while its buffer is full.
+func PubSubBufferOnOverflow(policy PubSubOverflowPolicy) PubSubBufferOpt {
+	return func(opts *pubSubBufferOpts) {
+		opts.policy = policy
+	}
+}
+
+// PubSubBufferBlockTimeout sets how long the PubSubBlock policy will wait for
+// there to be room in the buffer before dropping a message.
+func PubSubBufferBlockTimeout(d time.Duration) PubSubBufferOpt {
+	return func(opts *pubSubBufferOpts) {
+		opts.blockTimeout = d
+	}
+}
+
+// PubSubBufferOnDrop sets a callback which will be called with every message
+// which is dropped by the PubSubBuffer. The callback is called synchronously,
+// and so should not block.
+func PubSubBufferOnDrop(fn func(PubSubMessage)) PubSubBufferOpt {
+	return func(opts *pubSubBufferOpts) {
+		opts.onDrop = fn
+	}
+}
+
+// PubSubBuffer sits between a PubSubConn and the consumer of its messages,
+// buffering messages so that a consumer which falls behind doesn't block the
+// PubSubConn from delivering messages to other channels. What happens when the
+// buffer is full is determined by the PubSubBufferOnOverflow option.
+//
+// The channel returned from the Ch method should be passed into a PubSubConn's
+// Subscribe and PSubscribe methods in place of the consumer's channel.
+type PubSubBuffer struct {
+	dropped uint64 // atomic, must be first for alignment
+
+	opts  pubSubBufferOpts
+	inCh  chan PubSubMessage
+	bufCh chan PubSubMessage
+	outCh chan<- PubSubMessage
+
+	closeCh   chan struct{}
+	closeOnce sync.Once
+	doneCh    chan struct{}
+
+	l   sync.Mutex
+	err error
+}
+
+// NewPubSubBuffer creates a PubSubBuffer which will deliver messages to the
+// given channel.
+//
+// NewPubSubBuffer takes in a number of options which can overwrite its default
+// behavior. The default options NewPubSubBuffer uses are:
+//
+//	PubSubBufferSize(128)
+//	PubSubBufferOnOverflow(PubSubBlock)
+//
+func NewPubSubBuffer(msgCh chan<- PubSubMessage, opts ...PubSubBufferOpt) *PubSubBuffer {
+	b := &PubSubBuffer{
+		inCh:    make(chan PubSubMessage),
+		outCh:   msgCh,
+		closeCh: make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+
+	defaultPubSubBufferOpts := []PubSubBufferOpt{
+		PubSubBufferSize(128),
+		PubSubBufferOnOverflow(PubSubBlock),
+	}
+	for _, opt := range append(defaultPubSubBufferOpts, opts...) {
+		opt(&(b.opts))
+	}
+
+	b.bufCh = make(chan PubSubMessage, b.opts.size)
+	go b.intake()
+	go b.deliver()
+	return b
+}
+
+// Ch returns the channel which should be passed into a PubSubConn's
+// Subscribe and PSubscribe methods.
+func (b *PubSubBuffer) Ch() chan<- PubSubMessage {
+	return b.inCh
+}
+
+// Done returns a channel which is closed once the PubSubBuffer has stopped
+// delivering messages, either because Close was called or because it
+// overflowed with the PubSubCloseOnOverflow policy, and all messages which were
+// in the buffer have been delivered. The channel given to NewPubSubBuffer is
+// never closed by the PubSubBuffer.
+func (b *PubSubBuffer) Done() <-chan struct{} {
+	return b.doneCh
+}
+
+// Dropped returns the number of messages which have been dropped so far.
+func (b *PubSubBuffer) Dropped() uint64 {
+	return atomic.LoadUint64(&b.dropped)
+}
+
+// Err returns ErrPubSubBufferFull if the PubSubCloseOnOverflow policy is
+// being used and the buffer has overflowed, otherwise nil.
+func (b *PubSubBuffer) Err() error {
+	b.l.Lock()
+	defer b.l.Unlock()
+	return b.err
+}
+
+// Close stops the PubSubBuffer. Messages already in the buffer will still be
+// delivered if the consumer is waiting to receive them, otherwise they're
+// dropped, so that the PubSubBuffer doesn't wait forever on a consumer which
+// has stopped reading.
+//
+// NOTE that Close must only be called once the channel returned from Ch has
+// been unsubscribed from all PubSubConns it was subscribed on. Calling Close
+// more than once does nothing.
+func (b *PubSubBuffer) Close() {
+	b.closeOnce.Do(func() {
+		close(b.inCh)
+		close(b.closeCh)
+	})
+}
+
+func (b *PubSubBuffer) drop(m PubSubMessage) {
+	atomic.AddUint64(&b.dropped, 1)
+	if b.opts.onDrop != nil {
+		b.opts.onDrop(m)
+	}
+}
+
+func (b *PubSubBuffer) intake() {
+	defer func() {
+		if b.Err() == nil {
+			close(b.bufCh)
+		}
+	}()
+
+	for m := range b.inCh {
+		if b.Err() != nil {
+			// the buffer has overflowed with PubSubCloseOnOverflow, but
+			// inCh must still be consumed so the PubSubConn isn't blocked.
+			b.drop(m)
+			continue
+		}
+
+		select {
+		case b.bufCh <- m:
+			continue
+		default:
+		}
+
+		switch b.opts.policy {
+		case PubSubDropOldest:
+			select {
+			case old := <-b.bufCh:
+				b.drop(old)
+			default:
+			}
+			select {
+			case b.bufCh <- m:
+			default:
+				b.drop(m)
+			}
+
+		case PubSubDropNewest:
+			b.drop(m)
+
+		case PubSubCloseOnOverflow:
+			b.drop(m)
+			b.l.Lock()
+			b.err = ErrPubSubBufferFull
+			b.l.Unlock()
+			close(b.bufCh)
+
+		default: // PubSubBlock
+			if b.opts.blockTimeout <= 0 {
+				b.bufCh <- m
+				continue
+			}
+			t := getTimer(b.opts.blockTimeout)
+			select {
+			case b.bufCh <- m:
+			case <-t.C:
+				b.drop(m)
+			}
+			putTimer(t)
+		}
+	}
+}
+
+func (b *PubSubBuffer) deliver() {
+	defer close(b.doneCh)
+	for m := range b.bufCh {
+		select {
+		case b.outCh <- m:
+			continue
+		case <-b.closeCh:
+		}
+
+		// Close has been called, so only deliver the message if the consumer
+		// is still reading.
+		select {
+		case b.outCh <- m:
+		default:
+			b.drop(m)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package radix
+
+import (
+	"strconv"
+	"sync/atomic"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPubSubBuffer(t *T) {
+	const n = 10
+	test := func(t *T, opts ...PubSubBufferOpt) ([]int, *PubSubBuffer) {
+		var onDropCount uint64
+		opts = append(opts, PubSubBufferSize(2), PubSubBufferOnDrop(func(PubSubMessage) {
+			atomic.AddUint64(&onDropCount, 1)
+		}))
+
+		msgCh := make(chan PubSubMessage)
+		b := NewPubSubBuffer(msgCh, opts...)
+		for i := 0; i < n; i++ {
+			b.Ch() <- PubSubMessage{Channel: "foo", Message: []byte(strconv.Itoa(i))}
+		}
+
+		var got []int
+	loop:
+		for {
+			select {
+			case m := <-msgCh:
+				i, _ := strconv.Atoi(string(m.Message))
+				got = append(got, i)
+			case <-b.Done():
+				break loop
+			case <-time.After(100 * time.Millisecond):
+				break loop
+			}
+		}
+		b.Close()
+		<-b.Done()
+
+		// the last message may still be being processed
+		for i := 0; i < 100 && uint64(len(got))+b.Dropped() < n; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		assert.Equal(t, uint64(n), uint64(len(got))+b.Dropped())
+		assert.Equal(t, b.Dropped(), atomic.LoadUint64(&onDropCount))
+		return got, b
+	}
+
+	t.Run("dropNewest", func(t *T) {
+		got, b := test(t, PubSubBufferOnOverflow(PubSubDropNewest))
+		assert.Equal(t, []int{0, 1}, got[:2])
+		assert.NotZero(t, b.Dropped())
+		assert.NoError(t, b.Err())
+	})
+
+	t.Run("dropOldest", func(t *T) {
+		got, b := test(t, PubSubBufferOnOverflow(PubSubDropOldest))
+		assert.Equal(t, n-1, got[len(got)-1])
+		assert.NotZero(t, b.Dropped())
+		assert.NoError(t, b.Err())
+	})
+
+	t.Run("block", func(t *T) {
+		got, b := test(t, PubSubBufferBlockTimeout(time.Millisecond))
+		assert.Equal(t, []int{0, 1}, got[:2])
+		assert.NotZero(t, b.Dropped())
+	})
+
+	t.Run("close", func(t *T) {
+		_, b := test(t, PubSubBufferOnOverflow(PubSubCloseOnOverflow))
+		assert.Equal(t, ErrPubSubBufferFull, b.Err())
+	})
+}
+
+func TestPubSubBufferCloseNotReading(t *T) {
+	// the consumer never reads from msgCh
+	msgCh := make(chan PubSubMessage)
+	b := NewPubSubBuffer(msgCh)
+	for i := 0; i < 3; i++ {
+		b.Ch() <- PubSubMessage{Channel: "foo", Message: []byte(strconv.Itoa(i))}
+	}
+
+	b.Close()
+	select {
+	case <-b.Done():
+	case <-time.After(time.Second):
+		t.Fatal("PubSubBuffer didn't stop after Close")
+	}
+	assert.Equal(t, uint64(3), b.Dropped())
+
+	// a second Close does nothing
+	assert.NotPanics(t, b.Close)
+}
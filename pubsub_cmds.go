@@ -0,0 +1,178 @@
+package radix
+
+import (
+	"sort"
+	"sync"
+
+	errors "golang.org/x/xerrors"
+)
+
+// PubSubChannels returns an Action which performs PUBSUB CHANNELS, unmarshaling
+// the names of all channels which have at least one subscriber, and which match
+// the given glob-style pattern, into rcv. If pattern is empty then all such
+// channels are returned.
+func PubSubChannels(rcv *[]string, pattern string) CmdAction {
+	return pubSubListCmd(rcv, "CHANNELS", pattern)
+}
+
+// PubSubShardChannels is like PubSubChannels, but performs PUBSUB
+// SHARDCHANNELS, which returns shard channels (see SSUBSCRIBE) instead.
+func PubSubShardChannels(rcv *[]string, pattern string) CmdAction {
+	return pubSubListCmd(rcv, "SHARDCHANNELS", pattern)
+}
+
+func pubSubListCmd(rcv *[]string, subCmd, pattern string) CmdAction {
+	if pattern == "" {
+		return Cmd(rcv, "PUBSUB", subCmd)
+	}
+	return Cmd(rcv, "PUBSUB", subCmd, pattern)
+}
+
+// PubSubNumSub returns an Action which performs PUBSUB NUMSUB, unmarshaling the
+// number of subscribers of each of the given channels into rcv.
+func PubSubNumSub(rcv *map[string]int, channels ...string) CmdAction {
+	return Cmd(rcv, "PUBSUB", append([]string{"NUMSUB"}, channels...)...)
+}
+
+// PubSubShardNumSub is like PubSubNumSub, but performs PUBSUB SHARDNUMSUB,
+// which counts the subscribers of shard channels (see SSUBSCRIBE) instead.
+func PubSubShardNumSub(rcv *map[string]int, channels ...string) CmdAction {
+	return Cmd(rcv, "PUBSUB", append([]string{"SHARDNUMSUB"}, channels...)...)
+}
+
+// PubSubNumPat returns an Action which performs PUBSUB NUMPAT, unmarshaling the
+// number of patterns which are subscribed to into rcv.
+func PubSubNumPat(rcv *int) CmdAction {
+	return Cmd(rcv, "PUBSUB", "NUMPAT")
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// eachNode calls fn concurrently with the Client for every node in the
+// Cluster, primaries and secondaries alike, and returns the first error
+// encountered, if any.
+func (c *Cluster) eachNode(fn func(addr string, client Client) error) error {
+	topo := c.Topo()
+	errCh := make(chan error, len(topo))
+	for _, node := range topo {
+		go func(addr string) {
+			client, err := c.Client(addr)
+			if err == nil {
+				err = fn(addr, client)
+			}
+			if err != nil {
+				err = errors.Errorf("node %q: %w", addr, err)
+			}
+			errCh <- err
+		}(node.Addr)
+	}
+
+	var err error
+	for range topo {
+		if thisErr := <-errCh; err == nil {
+			err = thisErr
+		}
+	}
+	return err
+}
+
+// each node in a cluster only knows about the subscriptions made on it, so the
+// cluster-wide helpers query every node and combine the results.
+
+func clusterPubSubChannels(c *Cluster, shard bool, pattern string) ([]string, error) {
+	if shard {
+		if err := checkServerFeatures(c, FeatureShardedPubSub); err != nil {
+			return nil, err
+		}
+	}
+
+	var l sync.Mutex
+	m := map[string]bool{}
+	err := c.eachNode(func(addr string, client Client) error {
+		var channels []string
+		a := PubSubChannels(&channels, pattern)
+		if shard {
+			a = PubSubShardChannels(&channels, pattern)
+		}
+		if err := client.Do(a); err != nil {
+			return err
+		}
+		l.Lock()
+		defer l.Unlock()
+		for _, ch := range channels {
+			m[ch] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	channels := make([]string, 0, len(m))
+	for ch := range m {
+		channels = append(channels, ch)
+	}
+	sort.Strings(channels)
+	return channels, nil
+}
+
+func clusterPubSubNumSub(c *Cluster, shard bool, channels []string) (map[string]int, error) {
+	if shard {
+		if err := checkServerFeatures(c, FeatureShardedPubSub); err != nil {
+			return nil, err
+		}
+	}
+
+	var l sync.Mutex
+	res := make(map[string]int, len(channels))
+	for _, ch := range channels {
+		res[ch] = 0
+	}
+	err := c.eachNode(func(addr string, client Client) error {
+		var m map[string]int
+		a := PubSubNumSub(&m, channels...)
+		if shard {
+			a = PubSubShardNumSub(&m, channels...)
+		}
+		if err := client.Do(a); err != nil {
+			return err
+		}
+		l.Lock()
+		defer l.Unlock()
+		for ch, n := range m {
+			res[ch] += n
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ClusterPubSubChannels performs PUBSUB CHANNELS on every node in the Cluster,
+// returning the sorted union of the channels which have at least one subscriber
+// on any node.
+func ClusterPubSubChannels(c *Cluster, pattern string) ([]string, error) {
+	return clusterPubSubChannels(c, false, pattern)
+}
+
+// ClusterPubSubShardChannels is like ClusterPubSubChannels, but for shard
+// channels.
+func ClusterPubSubShardChannels(c *Cluster, pattern string) ([]string, error) {
+	return clusterPubSubChannels(c, true, pattern)
+}
+
+// ClusterPubSubNumSub performs PUBSUB NUMSUB on every node in the Cluster,
+// returning the total number of subscribers of each of the given channels
+// across all nodes.
+func ClusterPubSubNumSub(c *Cluster, channels ...string) (map[string]int, error) {
+	return clusterPubSubNumSub(c, false, channels)
+}
+
+// ClusterPubSubShardNumSub is like ClusterPubSubNumSub, but for shard
+// channels. Shard channels may be subscribed to on a shard's primary or any of
+// its secondaries, so all of them are queried.
+func ClusterPubSubShardNumSub(c *Cluster, channels ...string) (map[string]int, error) {
+	return clusterPubSubNumSub(c, true, channels)
+}
@@ -0,0 +1,50 @@
+package radix
+
+import (
+	"sort"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPubSubCmds(t *T) {
+	var got []string
+	conn := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		got = args
+		switch args[1] {
+		case "NUMSUB", "SHARDNUMSUB":
+			return []interface{}{"a", 1, "b", 0}
+		default:
+			return []string{"a"}
+		}
+	})
+
+	var channels []string
+	require.NoError(t, conn.Do(PubSubChannels(&channels, "")))
+	assert.Equal(t, []string{"PUBSUB", "CHANNELS"}, got)
+	require.NoError(t, conn.Do(PubSubShardChannels(&channels, "a*")))
+	assert.Equal(t, []string{"PUBSUB", "SHARDCHANNELS", "a*"}, got)
+	assert.Equal(t, []string{"a"}, channels)
+
+	var m map[string]int
+	require.NoError(t, conn.Do(PubSubShardNumSub(&m, "a", "b")))
+	assert.Equal(t, []string{"PUBSUB", "SHARDNUMSUB", "a", "b"}, got)
+	assert.Equal(t, map[string]int{"a": 1, "b": 0}, m)
+}
+
+func TestClusterPubSubCmds(t *T) {
+	scl := newStubCluster(testTopo)
+	c := scl.newCluster()
+	defer c.Close()
+
+	exp := append([]string{"all"}, scl.addrs()...)
+	sort.Strings(exp)
+	channels, err := ClusterPubSubShardChannels(c, "")
+	require.NoError(t, err)
+	assert.Equal(t, exp, channels)
+
+	m, err := ClusterPubSubNumSub(c, "foo", "bar")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"foo": len(testTopo), "bar": len(testTopo)}, m)
+}
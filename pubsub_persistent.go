@@ -10,6 +10,7 @@ type persistentPubSubOpts struct {
 	connFn     ConnFunc
 	abortAfter int
 	errCh      chan<- error
+	backoff    Backoff
 }
 
 // PersistentPubSubOpt is an optional parameter which can be passed into
@@ -48,6 +49,14 @@ func PersistentPubSubErrCh(errCh chan<- error) PersistentPubSubOpt {
 	}
 }
 
+// PersistentPubSubReconnectBackoff sets the Backoff used to determine how long
+// PersistentPubSub waits after failing to reconnect, before trying again.
+func PersistentPubSubReconnectBackoff(b Backoff) PersistentPubSubOpt {
+	return func(opts *persistentPubSubOpts) {
+		opts.backoff = b
+	}
+}
+
 type pubSubCmd struct {
 	// msgCh can be set along with one of subscribe/unsubscribe/etc...
 	msgCh                                            chan<- PubSubMessage
@@ -93,6 +102,7 @@ type persistentPubSub struct {
 // default behavior. The default options PersistentPubSubWithOpts uses are:
 //
 //	PersistentPubSubConnFunc(DefaultConnFunc)
+//	PersistentPubSubReconnectBackoff(ExponentialBackoff(200 * time.Millisecond, 10 * time.Second, 0.5))
 //
 func PersistentPubSubWithOpts(
 	network, addr string, options ...PersistentPubSubOpt,
@@ -100,7 +110,8 @@ func PersistentPubSubWithOpts(
 	PubSubConn, error,
 ) {
 	opts := persistentPubSubOpts{
-		connFn: DefaultConnFunc,
+		connFn:  DefaultConnFunc,
+		backoff: ExponentialBackoff(200*time.Millisecond, 10*time.Second, 0.5),
 	}
 	for _, opt := range options {
 		opt(&opts)
@@ -179,7 +190,7 @@ func (p *persistentPubSub) refresh() error {
 		if p.opts.abortAfter > 0 && attempts >= p.opts.abortAfter {
 			return err
 		}
-		time.Sleep(200 * time.Millisecond)
+		time.Sleep(p.opts.backoff.Next(attempts))
 	}
 }
 
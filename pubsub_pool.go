@@ -0,0 +1,362 @@
+package radix
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+type pubSubPoolOpts struct {
+	cf         ConnFunc
+	abortAfter int
+	errCh      chan<- error
+	hashFn     PubSubPoolHashFunc
+}
+
+// PubSubPoolOpt is an optional behavior which can be applied to the
+// NewPubSubPool function to effect a PubSubPool's behavior.
+type PubSubPoolOpt func(*pubSubPoolOpts)
+
+// PubSubPoolConnFunc tells the PubSubPool to use the given ConnFunc when
+// creating its connections.
+func PubSubPoolConnFunc(cf ConnFunc) PubSubPoolOpt {
+	return func(opts *pubSubPoolOpts) {
+		opts.cf = cf
+	}
+}
+
+// PubSubPoolAbortAfter is equivalent to PersistentPubSubAbortAfter, and is
+// applied to each of the PubSubPool's connections.
+func PubSubPoolAbortAfter(attempts int) PubSubPoolOpt {
+	return func(opts *pubSubPoolOpts) {
+		opts.abortAfter = attempts
+	}
+}
+
+// PubSubPoolErrCh takes a channel which asynchronous errors encountered by any
+// of the PubSubPool's connections can be read off of. If the channel blocks the
+// error will be dropped. The channel will be closed when the PubSubPool is
+// closed.
+func PubSubPoolErrCh(errCh chan<- error) PubSubPoolOpt {
+	return func(opts *pubSubPoolOpts) {
+		opts.errCh = errCh
+	}
+}
+
+// PubSubPoolHashFunc assigns a channel or pattern to one of the n connections
+// of a PubSubPool, returning the index of the connection in [0, n).
+type PubSubPoolHashFunc func(s string, n int) int
+
+// PubSubPoolSlotHash is a PubSubPoolHashFunc which assigns a channel or
+// pattern to a connection using its cluster slot, modulo the number of
+// connections. Nearly all channels and patterns are assigned to a different
+// connection when the number of connections changes.
+func PubSubPoolSlotHash(s string, n int) int {
+	return int(ClusterSlot([]byte(s))) % n
+}
+
+// PubSubPoolRendezvousHash is a PubSubPoolHashFunc which assigns a channel or
+// pattern to a connection using rendezvous hashing, i.e. by hashing the
+// channel or pattern along with each connection's index and choosing the
+// connection with the highest hash. When a connection is added only about
+// 1/n of the channels and patterns are assigned to a different connection, all
+// of them to the new one. Assigning a channel or pattern takes O(n) time.
+func PubSubPoolRendezvousHash(s string, n int) int {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	sSum := h.Sum64()
+
+	var best int
+	var bestSum uint64
+	for i := 0; i < n; i++ {
+		// the hash of s is combined with the index and then mixed, using the
+		// finalizer from MurmurHash3, so that every bit of the index affects
+		// every bit of the result.
+		sum := sSum + uint64(i)*0x9e3779b97f4a7c15
+		sum ^= sum >> 33
+		sum *= 0xff51afd7ed558ccd
+		sum ^= sum >> 33
+		sum *= 0xc4ceb9fe1a85ec53
+		sum ^= sum >> 33
+		if i == 0 || sum > bestSum {
+			best, bestSum = i, sum
+		}
+	}
+	return best
+}
+
+// PubSubPoolHash tells the PubSubPool to use the given PubSubPoolHashFunc to
+// assign channels and patterns to its connections.
+func PubSubPoolHash(fn PubSubPoolHashFunc) PubSubPoolOpt {
+	return func(opts *pubSubPoolOpts) {
+		opts.hashFn = fn
+	}
+}
+
+// PubSubPool is a PubSubConn which spreads its subscriptions across multiple
+// connections, each of which behaves like one created by
+// PersistentPubSubWithOpts. This is useful when subscribing to a very large
+// number of channels, where the messages for all of them would be more than a
+// single connection could handle.
+//
+// Each channel and pattern is always assigned to the same connection, based on
+// its hash, see PubSubPoolHash. If a connection is lost then a new one is
+// created in its place, and the channels and patterns assigned to it are
+// re-subscribed to.
+type PubSubPool struct {
+	opts          pubSubPoolOpts
+	network, addr string
+
+	// l guards conns, which is only modified by AddConn, while subscriptions
+	// are being modified.
+	l      sync.RWMutex
+	conns  []PubSubConn
+	closed bool
+
+	// subs and psubs are the current subscriptions, guarded by subsL, which
+	// are tracked so they can be moved between connections by AddConn.
+	subsL       sync.Mutex
+	subs, psubs chanSet
+
+	errWG     sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+}
+
+var _ PubSubConn = new(PubSubPool)
+
+// NewPubSubPool creates a PubSubPool which will keep open the given number of
+// pubsub connections to the redis instance at the given address.
+//
+// NewPubSubPool takes in a number of options which can overwrite its default
+// behavior. The default options NewPubSubPool uses are:
+//
+//	PubSubPoolConnFunc(DefaultConnFunc)
+//	PubSubPoolHash(PubSubPoolSlotHash)
+//
+func NewPubSubPool(network, addr string, size int, opts ...PubSubPoolOpt) (*PubSubPool, error) {
+	if size < 1 {
+		size = 1
+	}
+
+	p := &PubSubPool{
+		network: network,
+		addr:    addr,
+		conns:   make([]PubSubConn, 0, size),
+		subs:    chanSet{},
+		psubs:   chanSet{},
+	}
+
+	defaultPubSubPoolOpts := []PubSubPoolOpt{
+		PubSubPoolConnFunc(DefaultConnFunc),
+		PubSubPoolHash(PubSubPoolSlotHash),
+	}
+	for _, opt := range append(defaultPubSubPoolOpts, opts...) {
+		opt(&(p.opts))
+	}
+
+	for i := 0; i < size; i++ {
+		conn, err := p.newConn()
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.conns = append(p.conns, conn)
+	}
+
+	return p, nil
+}
+
+func (p *PubSubPool) newConn() (PubSubConn, error) {
+	errCh := make(chan error, 1)
+	conn, err := PersistentPubSubWithOpts(p.network, p.addr,
+		PersistentPubSubConnFunc(p.opts.cf),
+		PersistentPubSubAbortAfter(p.opts.abortAfter),
+		PersistentPubSubErrCh(errCh),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	p.errWG.Add(1)
+	go func() {
+		defer p.errWG.Done()
+		for err := range errCh {
+			p.err(err)
+		}
+	}()
+	return conn, nil
+}
+
+// AddConn adds a new connection to the PubSubPool, and moves any channels and
+// patterns which are now assigned to it from the connections they were
+// previously subscribed to. How many are moved depends on the
+// PubSubPoolHashFunc, see PubSubPoolRendezvousHash.
+//
+// Each moved channel or pattern is subscribed to on the new connection before
+// being unsubscribed from on its previous one, so while it's being moved
+// messages may be received twice, but none will be missed. Subscriptions are
+// blocked while AddConn is in progress.
+func (p *PubSubPool) AddConn() error {
+	p.l.Lock()
+	defer p.l.Unlock()
+	if p.closed {
+		return ErrClientClosed
+	}
+
+	conn, err := p.newConn()
+	if err != nil {
+		return err
+	}
+	p.conns = append(p.conns, conn)
+	n := len(p.conns)
+
+	p.subsL.Lock()
+	defer p.subsL.Unlock()
+	for _, cs := range []struct {
+		chanSet
+		sub, unsub func(PubSubConn, chan<- PubSubMessage, ...string) error
+	}{
+		{p.subs, PubSubConn.Subscribe, PubSubConn.Unsubscribe},
+		{p.psubs, PubSubConn.PSubscribe, PubSubConn.PUnsubscribe},
+	} {
+		for s, msgChs := range cs.chanSet {
+			prev := p.opts.hashFn(s, n-1)
+			if p.opts.hashFn(s, n) == prev {
+				continue
+			}
+			for msgCh := range msgChs {
+				if err := cs.sub(conn, msgCh, s); err != nil {
+					return err
+				} else if err := cs.unsub(p.conns[prev], msgCh, s); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (p *PubSubPool) err(err error) {
+	select {
+	case p.opts.errCh <- err:
+	default:
+	}
+}
+
+// group splits the given channels or patterns up by the connection they are
+// assigned to.
+func (p *PubSubPool) group(ss []string) map[int][]string {
+	m := map[int][]string{}
+	for _, s := range ss {
+		i := p.opts.hashFn(s, len(p.conns))
+		m[i] = append(m[i], s)
+	}
+	return m
+}
+
+// each calls fn for each group of channels or patterns, concurrently, and
+// returns the first error encountered, if any.
+func (p *PubSubPool) each(ss []string, fn func(PubSubConn, []string) error) error {
+	p.l.RLock()
+	defer p.l.RUnlock()
+	groups := p.group(ss)
+	if len(groups) == 1 {
+		for i, ss := range groups {
+			return fn(p.conns[i], ss)
+		}
+	}
+
+	errCh := make(chan error, len(groups))
+	for i, ss := range groups {
+		go func(conn PubSubConn, ss []string) {
+			errCh <- fn(conn, ss)
+		}(p.conns[i], ss)
+	}
+
+	var err error
+	for range groups {
+		if thisErr := <-errCh; err == nil {
+			err = thisErr
+		}
+	}
+	return err
+}
+
+// track records the given channels or patterns as being subscribed to, or
+// not, by msgCh.
+func (p *PubSubPool) track(cs chanSet, msgCh chan<- PubSubMessage, ss []string, subbed bool) {
+	p.subsL.Lock()
+	defer p.subsL.Unlock()
+	for _, s := range ss {
+		if subbed {
+			cs.add(s, msgCh)
+		} else {
+			cs.del(s, msgCh)
+		}
+	}
+}
+
+// Subscribe implements the method for the PubSubConn interface.
+func (p *PubSubPool) Subscribe(msgCh chan<- PubSubMessage, channels ...string) error {
+	return p.each(channels, func(conn PubSubConn, channels []string) error {
+		p.track(p.subs, msgCh, channels, true)
+		return conn.Subscribe(msgCh, channels...)
+	})
+}
+
+// Unsubscribe implements the method for the PubSubConn interface.
+func (p *PubSubPool) Unsubscribe(msgCh chan<- PubSubMessage, channels ...string) error {
+	return p.each(channels, func(conn PubSubConn, channels []string) error {
+		p.track(p.subs, msgCh, channels, false)
+		return conn.Unsubscribe(msgCh, channels...)
+	})
+}
+
+// PSubscribe implements the method for the PubSubConn interface.
+func (p *PubSubPool) PSubscribe(msgCh chan<- PubSubMessage, patterns ...string) error {
+	return p.each(patterns, func(conn PubSubConn, patterns []string) error {
+		p.track(p.psubs, msgCh, patterns, true)
+		return conn.PSubscribe(msgCh, patterns...)
+	})
+}
+
+// PUnsubscribe implements the method for the PubSubConn interface.
+func (p *PubSubPool) PUnsubscribe(msgCh chan<- PubSubMessage, patterns ...string) error {
+	return p.each(patterns, func(conn PubSubConn, patterns []string) error {
+		p.track(p.psubs, msgCh, patterns, false)
+		return conn.PUnsubscribe(msgCh, patterns...)
+	})
+}
+
+// Ping implements the method for the PubSubConn interface. Every connection is
+// pinged, and the first error encountered is returned.
+func (p *PubSubPool) Ping() error {
+	p.l.RLock()
+	defer p.l.RUnlock()
+	var err error
+	for _, conn := range p.conns {
+		if thisErr := conn.Ping(); err == nil {
+			err = thisErr
+		}
+	}
+	return err
+}
+
+// Close implements the method for the PubSubConn interface.
+func (p *PubSubPool) Close() error {
+	p.closeOnce.Do(func() {
+		p.l.Lock()
+		defer p.l.Unlock()
+		p.closed = true
+		for _, conn := range p.conns {
+			if err := conn.Close(); p.closeErr == nil {
+				p.closeErr = err
+			}
+		}
+		p.errWG.Wait()
+		if p.opts.errCh != nil {
+			close(p.opts.errCh)
+		}
+	})
+	return p.closeErr
+}
@@ -0,0 +1,139 @@
+package radix
+
+import (
+	"strconv"
+	"sync"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPubSubPool(t *T) {
+	var l sync.Mutex
+	var stubs []*pubSubStub
+	var stubChs []chan<- PubSubMessage
+	connFunc := func(network, addr string) (Conn, error) {
+		conn, stubCh := PubSubStub(network, addr, func([]string) interface{} { return nil })
+		l.Lock()
+		defer l.Unlock()
+		stubs = append(stubs, conn.(*pubSubStub))
+		stubChs = append(stubChs, stubCh)
+		return conn, nil
+	}
+
+	p, err := NewPubSubPool("tcp", "127.0.0.1:6379", 4, PubSubPoolConnFunc(connFunc))
+	require.NoError(t, err)
+	defer p.Close()
+	require.Len(t, stubs, 4)
+
+	channels := make([]string, 100)
+	for i := range channels {
+		channels[i] = "channel" + strconv.Itoa(i)
+	}
+
+	msgCh := make(chan PubSubMessage, len(channels)*len(stubs))
+	require.NoError(t, p.Subscribe(msgCh, channels...))
+	require.NoError(t, p.Ping())
+
+	// the subscriptions should be spread across all connections, with each
+	// channel subscribed to on exactly one of them.
+	var total int
+	for _, stub := range stubs {
+		stub.l.Lock()
+		assert.NotEmpty(t, stub.subbed)
+		total += len(stub.subbed)
+		stub.l.Unlock()
+	}
+	assert.Equal(t, len(channels), total)
+
+	// publish every message to every connection, only the one which is
+	// subscribed should actually deliver it.
+	for i, stubCh := range stubChs {
+		for _, channel := range channels {
+			stubCh <- PubSubMessage{Channel: channel, Message: []byte("foo")}
+			<-stubs[i].mDoneCh
+		}
+	}
+
+	got := map[string]int{}
+	for range channels {
+		select {
+		case m := <-msgCh:
+			got[m.Channel]++
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for message")
+		}
+	}
+	for _, channel := range channels {
+		assert.Equal(t, 1, got[channel], channel)
+	}
+
+	require.NoError(t, p.Unsubscribe(msgCh, channels...))
+	for _, stub := range stubs {
+		stub.l.Lock()
+		assert.Empty(t, stub.subbed)
+		stub.l.Unlock()
+	}
+}
+
+func TestPubSubPoolAddConn(t *T) {
+	// with rendezvous hashing adding a connection only moves channels to the
+	// new connection, and only around 1/n of them.
+	var moved int
+	for i := 0; i < 1000; i++ {
+		s := "channel" + strconv.Itoa(i)
+		prev, curr := PubSubPoolRendezvousHash(s, 4), PubSubPoolRendezvousHash(s, 5)
+		if prev != curr {
+			assert.Equal(t, 4, curr)
+			moved++
+		}
+	}
+	assert.True(t, moved > 100 && moved < 300, "moved:%d", moved)
+
+	var l sync.Mutex
+	var stubs []*pubSubStub
+	connFunc := func(network, addr string) (Conn, error) {
+		conn, _ := PubSubStub(network, addr, func([]string) interface{} { return nil })
+		l.Lock()
+		defer l.Unlock()
+		stubs = append(stubs, conn.(*pubSubStub))
+		return conn, nil
+	}
+
+	p, err := NewPubSubPool("tcp", "127.0.0.1:6379", 2,
+		PubSubPoolConnFunc(connFunc),
+		PubSubPoolHash(PubSubPoolRendezvousHash),
+	)
+	require.NoError(t, err)
+	defer p.Close()
+
+	channels := make([]string, 100)
+	for i := range channels {
+		channels[i] = "channel" + strconv.Itoa(i)
+	}
+	msgCh := make(chan PubSubMessage)
+	require.NoError(t, p.Subscribe(msgCh, channels...))
+	require.NoError(t, p.PSubscribe(msgCh, "pattern*"))
+	require.NoError(t, p.AddConn())
+	require.Len(t, stubs, 3)
+
+	// each channel should be subscribed to on exactly the connection it's now
+	// assigned to.
+	for _, channel := range channels {
+		i := PubSubPoolRendezvousHash(channel, 3)
+		for j, stub := range stubs {
+			stub.l.Lock()
+			assert.Equal(t, i == j, stub.subbed[channel], "channel:%q conn:%d", channel, j)
+			stub.l.Unlock()
+		}
+	}
+	i := PubSubPoolRendezvousHash("pattern*", 3)
+	stubs[i].l.Lock()
+	assert.True(t, stubs[i].psubbed["pattern*"])
+	stubs[i].l.Unlock()
+
+	require.NoError(t, p.Close())
+	assert.Equal(t, ErrClientClosed, p.AddConn())
+}
@@ -0,0 +1,61 @@
+package radix
+
+import (
+	"encoding/json"
+)
+
+// Publish returns an Action which performs PUBLISH, unmarshaling the number of
+// clients which received the message into rcv, which may be nil.
+//
+// NOTE that in a redis cluster the number only includes the clients connected
+// to the node the message was published on, see SPublish.
+func Publish(rcv *int, channel string, message []byte) CmdAction {
+	return publishCmd(rcv, "PUBLISH", channel, message)
+}
+
+// SPublish is like Publish, but performs SPUBLISH, which publishes to a shard
+// channel (see SSUBSCRIBE) instead.
+func SPublish(rcv *int, channel string, message []byte) CmdAction {
+	return publishCmd(rcv, "SPUBLISH", channel, message)
+}
+
+func publishCmd(rcv *int, cmd, channel string, message []byte) CmdAction {
+	// a nil *int can't be unmarshaled into, unlike a nil interface{}.
+	if rcv == nil {
+		return FlatCmd(nil, cmd, channel, message)
+	}
+	return FlatCmd(rcv, cmd, channel, message)
+}
+
+// PublishJSON is like Publish, but the message is the JSON encoding of v.
+func PublishJSON(rcv *int, channel string, v interface{}) (CmdAction, error) {
+	message, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return Publish(rcv, channel, message), nil
+}
+
+// PublishBatch publishes each of the given messages to its Channel, using as
+// few pipelines as possible, and returns the number of clients which received
+// each one. It's intended for emitting events at a high frequency, where the
+// round trip of publishing each message individually would be too costly.
+//
+// Only the Channel and Message fields of each PubSubMessage are used. If c is a
+// Cluster the messages are pipelined per slot of their channel, as with any
+// other command, so messages published to different slots may be received out
+// of order.
+//
+// If an error is returned then some messages may have been published, and the
+// returned counts are not valid.
+func PublishBatch(c Client, msgs []PubSubMessage) ([]int, error) {
+	counts := make([]int, len(msgs))
+	cmds := make([]CmdAction, len(msgs))
+	for i, msg := range msgs {
+		cmds[i] = Publish(&counts[i], msg.Channel, msg.Message)
+	}
+	if err := doBatch(c, cmds); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
@@ -0,0 +1,45 @@
+package radix
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublish(t *T) {
+	subs := map[string]int{"foo": 2, "bar": 1}
+	var published [][]string
+	conn := Stub("", "", func(args []string) interface{} {
+		published = append(published, args)
+		return subs[args[1]]
+	})
+
+	var n int
+	require.NoError(t, conn.Do(Publish(&n, "foo", []byte("hi"))))
+	assert.Equal(t, 2, n)
+
+	require.NoError(t, conn.Do(SPublish(nil, "bar", []byte("hi"))))
+
+	a, err := PublishJSON(&n, "bar", map[string]int{"a": 1})
+	require.NoError(t, err)
+	require.NoError(t, conn.Do(a))
+	assert.Equal(t, 1, n)
+
+	counts, err := PublishBatch(conn, []PubSubMessage{
+		{Channel: "foo", Message: []byte("1")},
+		{Channel: "bar", Message: []byte("2")},
+		{Channel: "baz", Message: []byte("3")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 1, 0}, counts)
+
+	assert.Equal(t, [][]string{
+		{"PUBLISH", "foo", "hi"},
+		{"SPUBLISH", "bar", "hi"},
+		{"PUBLISH", "bar", `{"a":1}`},
+		{"PUBLISH", "foo", "1"},
+		{"PUBLISH", "bar", "2"},
+		{"PUBLISH", "baz", "3"},
+	}, published)
+}
@@ -0,0 +1,265 @@
+package radix
+
+import (
+	"sync"
+
+	errors "golang.org/x/xerrors"
+)
+
+type pubSubRouterOpts struct {
+	workers int
+	bufSize int
+	errCh   chan<- error
+}
+
+// PubSubRouterOpt is an optional behavior which can be applied to the
+// NewPubSubRouter function to effect a PubSubRouter's behavior.
+type PubSubRouterOpt func(*pubSubRouterOpts)
+
+// PubSubRouterWorkers sets the number of go-routines which will call handlers
+// concurrently. If more than one is used then messages may be handled in a
+// different order than they were published in.
+func PubSubRouterWorkers(n int) PubSubRouterOpt {
+	return func(opts *pubSubRouterOpts) {
+		opts.workers = n
+	}
+}
+
+// PubSubRouterBufferSize sets the number of messages which will be buffered
+// while waiting for a worker to handle them.
+func PubSubRouterBufferSize(size int) PubSubRouterOpt {
+	return func(opts *pubSubRouterOpts) {
+		opts.bufSize = size
+	}
+}
+
+// PubSubRouterErrCh takes a channel which errors encountered by the
+// PubSubRouter, including panics within handlers, can be read off of. If the
+// channel blocks the error will be dropped. The channel will be closed when the
+// PubSubRouter is closed.
+func PubSubRouterErrCh(errCh chan<- error) PubSubRouterOpt {
+	return func(opts *pubSubRouterOpts) {
+		opts.errCh = errCh
+	}
+}
+
+// PubSubHandler is a function which handles PubSubMessages routed to it by a
+// PubSubRouter.
+type PubSubHandler func(PubSubMessage)
+
+// PubSubRouter subscribes to channels and patterns on a PubSubConn, and routes
+// the PubSubMessages received for them to the handlers which were registered
+// for those channels and patterns.
+//
+// If a handler panics the panic is recovered from and written to the ErrCh
+// option as an error, if one was given, and the worker continues on.
+type PubSubRouter struct {
+	conn  PubSubConn
+	opts  pubSubRouterOpts
+	msgCh chan PubSubMessage
+
+	// subL is held while subscribing or unsubscribing, and protects closed.
+	subL   sync.Mutex
+	closed bool
+
+	// l protects subs and psubs, and is only held briefly so that workers
+	// aren't blocked while subscribing.
+	l     sync.RWMutex
+	subs  map[string][]PubSubHandler
+	psubs map[string][]PubSubHandler
+
+	workersWG sync.WaitGroup
+}
+
+// NewPubSubRouter creates a PubSubRouter which will subscribe to channels and
+// patterns on the given PubSubConn. The PubSubConn will not be closed by the
+// PubSubRouter.
+//
+// NewPubSubRouter takes in a number of options which can overwrite its default
+// behavior. The default options NewPubSubRouter uses are:
+//
+//	PubSubRouterWorkers(1)
+//	PubSubRouterBufferSize(128)
+//
+func NewPubSubRouter(conn PubSubConn, opts ...PubSubRouterOpt) *PubSubRouter {
+	r := &PubSubRouter{
+		conn:  conn,
+		subs:  map[string][]PubSubHandler{},
+		psubs: map[string][]PubSubHandler{},
+	}
+
+	defaultPubSubRouterOpts := []PubSubRouterOpt{
+		PubSubRouterWorkers(1),
+		PubSubRouterBufferSize(128),
+	}
+	for _, opt := range append(defaultPubSubRouterOpts, opts...) {
+		opt(&(r.opts))
+	}
+	if r.opts.workers < 1 {
+		r.opts.workers = 1
+	}
+
+	r.msgCh = make(chan PubSubMessage, r.opts.bufSize)
+	for i := 0; i < r.opts.workers; i++ {
+		r.workersWG.Add(1)
+		go func() {
+			defer r.workersWG.Done()
+			for m := range r.msgCh {
+				r.route(m)
+			}
+		}()
+	}
+	return r
+}
+
+func (r *PubSubRouter) err(err error) {
+	select {
+	case r.opts.errCh <- err:
+	default:
+	}
+}
+
+func (r *PubSubRouter) route(m PubSubMessage) {
+	r.l.RLock()
+	var handlers []PubSubHandler
+	if m.Type == "pmessage" {
+		handlers = r.psubs[m.Pattern]
+	} else {
+		handlers = r.subs[m.Channel]
+	}
+	r.l.RUnlock()
+
+	for _, h := range handlers {
+		r.handle(h, m)
+	}
+}
+
+func (r *PubSubRouter) handle(h PubSubHandler, m PubSubMessage) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			r.err(errors.Errorf("pubsub handler for channel %q panicked: %v", m.Channel, rec))
+		}
+	}()
+	h(m)
+}
+
+// add registers h in the given set of handlers, calling subFn if it's the
+// first handler for key.
+func (r *PubSubRouter) add(
+	set map[string][]PubSubHandler, key string, h PubSubHandler,
+	subFn func(chan<- PubSubMessage, ...string) error,
+) error {
+	r.subL.Lock()
+	defer r.subL.Unlock()
+	if r.closed {
+		return ErrClientClosed
+	}
+
+	// the handler is added prior to subscribing so that no messages are missed
+	r.l.Lock()
+	first := len(set[key]) == 0
+	set[key] = append(set[key], h)
+	r.l.Unlock()
+
+	if !first {
+		return nil
+	} else if err := subFn(r.msgCh, key); err != nil {
+		r.l.Lock()
+		delete(set, key)
+		r.l.Unlock()
+		return err
+	}
+	return nil
+}
+
+// remove removes all handlers for key from the given set of handlers, calling
+// unsubFn if there were any.
+func (r *PubSubRouter) remove(
+	set map[string][]PubSubHandler, key string,
+	unsubFn func(chan<- PubSubMessage, ...string) error,
+) error {
+	r.subL.Lock()
+	defer r.subL.Unlock()
+	if r.closed {
+		return ErrClientClosed
+	}
+
+	r.l.Lock()
+	n := len(set[key])
+	delete(set, key)
+	r.l.Unlock()
+
+	if n == 0 {
+		return nil
+	}
+	return unsubFn(r.msgCh, key)
+}
+
+// Handle registers the handler for the given channel, subscribing to the
+// channel if it isn't already. Multiple handlers may be registered for the same
+// channel, in which case they are called in the order they were registered.
+func (r *PubSubRouter) Handle(channel string, h PubSubHandler) error {
+	return r.add(r.subs, channel, h, r.conn.Subscribe)
+}
+
+// HandlePattern is like Handle, but registers the handler for all channels
+// matching the given glob-style pattern.
+//
+// NOTE that if a channel matches both a pattern and a channel which have had
+// handlers registered, then the handlers for both will be called.
+func (r *PubSubRouter) HandlePattern(pattern string, h PubSubHandler) error {
+	return r.add(r.psubs, pattern, h, r.conn.PSubscribe)
+}
+
+// Remove removes all handlers for the given channel and unsubscribes from it.
+func (r *PubSubRouter) Remove(channel string) error {
+	return r.remove(r.subs, channel, r.conn.Unsubscribe)
+}
+
+// RemovePattern removes all handlers for the given pattern and unsubscribes
+// from it.
+func (r *PubSubRouter) RemovePattern(pattern string) error {
+	return r.remove(r.psubs, pattern, r.conn.PUnsubscribe)
+}
+
+// Close unsubscribes from all channels and patterns which handlers have been
+// registered for, and waits for all handlers which are currently running to
+// return.
+func (r *PubSubRouter) Close() error {
+	r.subL.Lock()
+	if r.closed {
+		r.subL.Unlock()
+		return ErrClientClosed
+	}
+	r.closed = true
+
+	r.l.RLock()
+	channels, patterns := handlerKeys(r.subs), handlerKeys(r.psubs)
+	r.l.RUnlock()
+
+	var err error
+	if len(channels) > 0 {
+		err = r.conn.Unsubscribe(r.msgCh, channels...)
+	}
+	if len(patterns) > 0 {
+		if perr := r.conn.PUnsubscribe(r.msgCh, patterns...); err == nil {
+			err = perr
+		}
+	}
+	r.subL.Unlock()
+
+	close(r.msgCh)
+	r.workersWG.Wait()
+	if r.opts.errCh != nil {
+		close(r.opts.errCh)
+	}
+	return err
+}
+
+func handlerKeys(m map[string][]PubSubHandler) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	return ks
+}
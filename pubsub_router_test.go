@@ -0,0 +1,72 @@
+package radix
+
+import (
+	"sync"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPubSubRouter(t *T) {
+	conn, stubCh := PubSubStub("tcp", "127.0.0.1:6379", func([]string) interface{} { return nil })
+	pubsub := PubSub(conn)
+	defer pubsub.Close()
+
+	errCh := make(chan error, 1)
+	r := NewPubSubRouter(pubsub, PubSubRouterWorkers(2), PubSubRouterErrCh(errCh))
+
+	var l sync.Mutex
+	got := map[string][]string{}
+	gotCh := make(chan struct{}, 10)
+	handler := func(name string) PubSubHandler {
+		return func(m PubSubMessage) {
+			l.Lock()
+			got[name] = append(got[name], string(m.Message))
+			l.Unlock()
+			gotCh <- struct{}{}
+		}
+	}
+	waitFor := func(n int) {
+		for i := 0; i < n; i++ {
+			select {
+			case <-gotCh:
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for handler")
+			}
+		}
+	}
+
+	require.NoError(t, r.Handle("foo", handler("foo1")))
+	require.NoError(t, r.Handle("foo", handler("foo2")))
+	require.NoError(t, r.HandlePattern("b*", handler("b*")))
+	require.NoError(t, r.Handle("panic", func(PubSubMessage) { panic("oh no") }))
+
+	stubCh <- PubSubMessage{Channel: "foo", Message: []byte("a")}
+	stubCh <- PubSubMessage{Pattern: "b*", Channel: "bar", Message: []byte("b")}
+	stubCh <- PubSubMessage{Channel: "baz", Message: []byte("c")}
+	waitFor(3)
+
+	stubCh <- PubSubMessage{Channel: "panic", Message: []byte("d")}
+	select {
+	case err := <-errCh:
+		assert.Contains(t, err.Error(), "oh no")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for panic error")
+	}
+
+	require.NoError(t, r.Remove("foo"))
+	stubCh <- PubSubMessage{Channel: "foo", Message: []byte("e")}
+	stubCh <- PubSubMessage{Pattern: "b*", Channel: "bar", Message: []byte("f")}
+	waitFor(1)
+
+	require.NoError(t, r.Close())
+	l.Lock()
+	defer l.Unlock()
+	assert.Equal(t, map[string][]string{
+		"foo1": {"a"},
+		"foo2": {"a"},
+		"b*":   {"b", "f"},
+	}, got)
+}
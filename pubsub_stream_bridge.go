@@ -0,0 +1,370 @@
+package radix
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+// PubSubToStreamOpts are the options given to NewPubSubToStream. At least one
+// of Channels and Patterns is required.
+type PubSubToStreamOpts struct {
+	// Channels and Patterns are the channels and patterns which are subscribed
+	// to.
+	Channels, Patterns []string
+
+	// Stream is the stream which messages are added to. If it's empty then
+	// each message is added to the stream with the same name as the channel
+	// it was published to.
+	Stream string
+
+	// MaxLen, if greater than zero, causes each XADD to approximately trim the
+	// stream to MaxLen entries, using "MAXLEN ~".
+	MaxLen int64
+
+	// BatchSize is the maximum number of messages which are added to streams
+	// in a single pipeline. Messages are added as soon as they are received,
+	// so batches only fill up when messages are received faster than they can
+	// be added.
+	//
+	// The default, if BatchSize is 0, is 100.
+	BatchSize int
+
+	// BufferSize is the number of messages which are buffered while waiting to
+	// be added. Once the buffer is full the PubSubConn is blocked from
+	// delivering further messages, to it or any other subscriber, until there
+	// is room. This way messages aren't dropped when the streams can't be
+	// written to for a while, but it's best to use a PubSubConn dedicated to
+	// the PubSubToStream.
+	//
+	// The default, if BufferSize is 0, is 1000.
+	BufferSize int
+
+	// RetryAfter is how long to wait before trying to add a batch of messages
+	// again after doing so fails, e.g. due to a network error.
+	//
+	// The default, if RetryAfter is 0, is 1 second.
+	RetryAfter time.Duration
+
+	// ErrCh, if set, will have errors encountered while adding messages
+	// written to it. If the channel blocks the error will be dropped.
+	ErrCh chan<- error
+}
+
+// PubSubToStream republishes the messages received on a set of pubsub channels
+// and patterns into streams using XADD, so that they are durable and can be
+// read by consumers which weren't subscribed at the time they were published.
+//
+// Each message is added as an entry with the fields "channel" and "message",
+// as well as "pattern" for messages received via a pattern.
+type PubSubToStream struct {
+	ps   PubSubConn
+	c    Client
+	opts PubSubToStreamOpts
+
+	msgCh chan PubSubMessage
+
+	// ctx is cancelled when Close is called, after which batches which fail
+	// to be added are dropped rather than retried.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	closeOnce sync.Once
+	doneCh    chan struct{}
+}
+
+// NewPubSubToStream subscribes to the channels and patterns given in opts on
+// the given PubSubConn, and adds each message received to a stream using the
+// given Client.
+//
+// Any changes on opts after calling NewPubSubToStream will have no effect.
+func NewPubSubToStream(ps PubSubConn, c Client, opts PubSubToStreamOpts) (*PubSubToStream, error) {
+	if len(opts.Channels) == 0 && len(opts.Patterns) == 0 {
+		return nil, errors.New("PubSubToStreamOpts.Channels or Patterns is required")
+	}
+	if opts.BatchSize == 0 {
+		opts.BatchSize = 100
+	}
+	if opts.BufferSize == 0 {
+		opts.BufferSize = 1000
+	}
+	if opts.RetryAfter == 0 {
+		opts.RetryAfter = 1 * time.Second
+	}
+
+	b := &PubSubToStream{
+		ps:     ps,
+		c:      c,
+		opts:   opts,
+		msgCh:  make(chan PubSubMessage, opts.BufferSize),
+		doneCh: make(chan struct{}),
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	go b.spin()
+
+	if err := b.subscribe(); err != nil {
+		b.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *PubSubToStream) subscribe() error {
+	if len(b.opts.Channels) > 0 {
+		if err := b.ps.Subscribe(b.msgCh, b.opts.Channels...); err != nil {
+			return err
+		}
+	}
+	if len(b.opts.Patterns) > 0 {
+		if err := b.ps.PSubscribe(b.msgCh, b.opts.Patterns...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *PubSubToStream) spin() {
+	defer close(b.doneCh)
+	batch := make([]PubSubMessage, 0, b.opts.BatchSize)
+	for m := range b.msgCh {
+		batch = append(batch[:0], m)
+	fill:
+		for len(batch) < b.opts.BatchSize {
+			select {
+			case m, ok := <-b.msgCh:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, m)
+			default:
+				break fill
+			}
+		}
+		b.add(batch)
+	}
+}
+
+// add adds the batch of messages to their streams, retrying until it succeeds
+// or the PubSubToStream is closed.
+func (b *PubSubToStream) add(batch []PubSubMessage) {
+	cmds := make([]CmdAction, len(batch))
+	for i, m := range batch {
+		cmds[i] = b.xaddCmd(m)
+	}
+
+	for {
+		err := doBatch(b.c, cmds)
+		if err == nil {
+			return
+		}
+
+		err = errors.Errorf("adding %d messages to streams: %w", len(batch), err)
+		if b.ctx.Err() != nil {
+			err = errors.Errorf("dropped after close: %w", err)
+		}
+		if waitErr := waitRetry(b.ctx, b.opts.RetryAfter, b.opts.ErrCh, err); waitErr != nil {
+			return
+		}
+	}
+}
+
+func (b *PubSubToStream) xaddCmd(m PubSubMessage) CmdAction {
+	stream := b.opts.Stream
+	if stream == "" {
+		stream = m.Channel
+	}
+
+	args := make([]string, 0, 10)
+	args = append(args, stream)
+	if b.opts.MaxLen > 0 {
+		args = append(args, "MAXLEN", "~", strconv.FormatInt(b.opts.MaxLen, 10))
+	}
+	args = append(args, "*", "channel", m.Channel)
+	if m.Type == "pmessage" {
+		args = append(args, "pattern", m.Pattern)
+	}
+	args = append(args, "message", string(m.Message))
+	return Cmd(nil, "XADD", args...)
+}
+
+// Close unsubscribes from the channels and patterns and waits for the messages
+// already received to be added. Messages which fail to be added during Close
+// are dropped, with the error written to ErrCh, rather than retried.
+//
+// Close does not close the PubSubConn.
+func (b *PubSubToStream) Close() error {
+	var err error
+	b.closeOnce.Do(func() {
+		// cancelling first ensures spin keeps consuming messages, so that the
+		// PubSubConn isn't blocked while unsubscribing.
+		b.cancel()
+		if len(b.opts.Channels) > 0 {
+			err = b.ps.Unsubscribe(b.msgCh, b.opts.Channels...)
+		}
+		if len(b.opts.Patterns) > 0 {
+			if pErr := b.ps.PUnsubscribe(b.msgCh, b.opts.Patterns...); err == nil {
+				err = pErr
+			}
+		}
+		close(b.msgCh)
+	})
+	<-b.doneCh
+	return err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// StreamToPubSubOpts are the options given to NewStreamToPubSub.
+type StreamToPubSubOpts struct {
+	// StreamReaderOpts describes the streams to read and how to read them, as
+	// with NewStreamFanIn. Streams is required. If Group is set then each
+	// entry is acknowledged once it's been published.
+	StreamReaderOpts
+
+	// Channel is the channel which entries are published to. If it's empty
+	// then each entry is published to the channel named by its "channel"
+	// field, or, if it has none, to the channel with the same name as its
+	// stream.
+	Channel string
+
+	// RetryAfter is how long to wait before trying to read or publish again
+	// after doing so fails, e.g. due to a network error.
+	//
+	// The default, if RetryAfter is 0, is 1 second.
+	RetryAfter time.Duration
+
+	// ErrCh, if set, will have errors encountered while reading and
+	// publishing written to it. If the channel blocks the error will be
+	// dropped.
+	ErrCh chan<- error
+}
+
+// StreamToPubSub reads entries from a set of streams and publishes the
+// "message" field of each to a pubsub channel, e.g. to deliver entries added by
+// a PubSubToStream to subscribers once they've been made durable. Entries
+// without a "message" field are skipped.
+//
+// Each batch of entries read is published using a single pipeline before the
+// next is read, so a StreamToPubSub never reads further ahead than it can
+// publish.
+type StreamToPubSub struct {
+	c    Client
+	opts StreamToPubSubOpts
+	fi   *StreamFanIn
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	doneCh chan struct{}
+}
+
+// NewStreamToPubSub returns a StreamToPubSub which starts reading from the
+// streams described by opts, and publishing their entries, in the background.
+//
+// Any changes on opts after calling NewStreamToPubSub will have no effect.
+func NewStreamToPubSub(c Client, opts StreamToPubSubOpts) *StreamToPubSub {
+	if opts.RetryAfter == 0 {
+		opts.RetryAfter = 1 * time.Second
+	}
+
+	b := &StreamToPubSub{
+		c:    c,
+		opts: opts,
+		fi: NewStreamFanIn(c, StreamFanInOpts{
+			StreamReaderOpts: opts.StreamReaderOpts,
+			RetryAfter:       opts.RetryAfter,
+			ErrCh:            opts.ErrCh,
+		}),
+		doneCh: make(chan struct{}),
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	go b.spin()
+	return b
+}
+
+func (b *StreamToPubSub) spin() {
+	defer close(b.doneCh)
+	for {
+		batch, err := b.fi.Next(b.ctx)
+		if err != nil {
+			return
+		}
+
+		cmds := make([]CmdAction, 0, len(batch.Entries)+1)
+		ids := make([]string, 0, len(batch.Entries))
+		for _, entry := range batch.Entries {
+			ids = append(ids, entry.ID.String())
+			msg, ok := entry.Fields["message"]
+			if !ok {
+				continue
+			}
+			cmds = append(cmds, Cmd(nil, "PUBLISH", b.channel(batch.Stream, entry), msg))
+		}
+		if b.opts.Group != "" {
+			args := append([]string{batch.Stream, b.opts.Group}, ids...)
+			cmds = append(cmds, Cmd(nil, "XACK", args...))
+		}
+
+		for {
+			err := doBatch(b.c, cmds)
+			if err == nil {
+				break
+			} else if err := waitRetry(b.ctx, b.opts.RetryAfter, b.opts.ErrCh, err); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (b *StreamToPubSub) channel(stream string, entry StreamEntry) string {
+	if b.opts.Channel != "" {
+		return b.opts.Channel
+	} else if channel, ok := entry.Fields["channel"]; ok {
+		return channel
+	}
+	return stream
+}
+
+// Close stops the StreamToPubSub, waiting for the batch of entries currently
+// being published, if any. As with StreamFanIn, Close may block for up to the
+// Block duration given in the StreamReaderOpts.
+func (b *StreamToPubSub) Close() error {
+	b.cancel()
+	<-b.doneCh
+	return b.fi.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// doBatch performs the given commands using as few pipelines as possible. When
+// c is a Cluster the commands are split into a pipeline per slot, since a
+// single pipeline can only be performed on keys belonging to the same slot.
+func doBatch(c Client, cmds []CmdAction) error {
+	if len(cmds) == 0 {
+		return nil
+	} else if _, ok := c.(*Cluster); !ok {
+		return c.Do(Pipeline(cmds...))
+	}
+
+	var slots []uint16
+	bySlot := map[uint16][]CmdAction{}
+	for _, cmd := range cmds {
+		var slot uint16
+		if keys := cmd.Keys(); len(keys) > 0 {
+			slot = ClusterSlot([]byte(keys[0]))
+		}
+		if _, ok := bySlot[slot]; !ok {
+			slots = append(slots, slot)
+		}
+		bySlot[slot] = append(bySlot[slot], cmd)
+	}
+
+	for _, slot := range slots {
+		if err := c.Do(Pipeline(bySlot[slot]...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
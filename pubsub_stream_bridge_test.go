@@ -0,0 +1,114 @@
+package radix
+
+import (
+	"sync"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+)
+
+func TestPubSubToStream(t *T) {
+	var l sync.Mutex
+	var xadds [][]string
+	failCh := make(chan bool, 1)
+	failCh <- true
+	client := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		select {
+		case <-failCh:
+			return errors.New("LOADING")
+		default:
+		}
+		l.Lock()
+		defer l.Unlock()
+		xadds = append(xadds, args)
+		return "1-0"
+	})
+	getXAdds := func() [][]string {
+		l.Lock()
+		defer l.Unlock()
+		return append([][]string(nil), xadds...)
+	}
+
+	stubConn, pubCh := PubSubStub("tcp", "127.0.0.1:6379", nil)
+	ps := PubSub(stubConn)
+	defer ps.Close()
+
+	errCh := make(chan error, 1)
+	b, err := NewPubSubToStream(ps, client, PubSubToStreamOpts{
+		Channels:   []string{"foo"},
+		Patterns:   []string{"ba*"},
+		MaxLen:     10,
+		RetryAfter: time.Millisecond,
+		ErrCh:      errCh,
+	})
+	require.NoError(t, err)
+
+	pubCh <- PubSubMessage{Type: "message", Channel: "foo", Message: []byte("a")}
+	pubCh <- PubSubMessage{Type: "pmessage", Pattern: "ba*", Channel: "bar", Message: []byte("b")}
+	assert.Error(t, <-errCh)
+
+	for i := 0; i < 1000 && len(getXAdds()) < 2; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	require.NoError(t, b.Close())
+	assert.Equal(t, [][]string{
+		{"XADD", "foo", "MAXLEN", "~", "10", "*", "channel", "foo", "message", "a"},
+		{"XADD", "bar", "MAXLEN", "~", "10", "*", "channel", "bar", "pattern", "ba*", "message", "b"},
+	}, getXAdds())
+
+	_, err = NewPubSubToStream(ps, client, PubSubToStreamOpts{})
+	assert.Error(t, err)
+}
+
+func TestStreamToPubSub(t *T) {
+	var l sync.Mutex
+	var cmds [][]string
+	var read bool
+	client := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		l.Lock()
+		defer l.Unlock()
+		if args[0] != "XREADGROUP" {
+			cmds = append(cmds, args)
+			return 1
+		} else if read {
+			time.Sleep(time.Millisecond)
+			return nil
+		}
+		read = true
+		return []interface{}{[]interface{}{"s", []interface{}{
+			[]interface{}{"1-0", []string{"channel", "foo", "message", "a"}},
+			[]interface{}{"2-0", []string{"other", "b"}},
+			[]interface{}{"3-0", []string{"message", "c"}},
+		}}}
+	})
+
+	b := NewStreamToPubSub(client, StreamToPubSubOpts{
+		StreamReaderOpts: StreamReaderOpts{
+			Streams:  map[string]*StreamEntryID{"s": nil},
+			Group:    "g",
+			Consumer: "c",
+		},
+	})
+
+	for i := 0; i < 1000; i++ {
+		l.Lock()
+		n := len(cmds)
+		l.Unlock()
+		if n == 3 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	require.NoError(t, b.Close())
+
+	l.Lock()
+	defer l.Unlock()
+	assert.Equal(t, [][]string{
+		{"PUBLISH", "foo", "a"},
+		{"PUBLISH", "s", "c"},
+		{"XACK", "s", "g", "1-0", "2-0", "3-0"},
+	}, cmds)
+}
@@ -0,0 +1,390 @@
+package radix
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+// QuorumError is returned by QuorumClient when too few of its servers
+// successfully performed an Action for the quorum to be reached.
+type QuorumError struct {
+	// Acks is the number of servers which successfully performed the Action,
+	// and Quorum the number which were needed to.
+	Acks, Quorum int
+
+	// Errs are the errors returned by the servers which didn't successfully
+	// perform the Action, keyed by their address.
+	Errs map[string]error
+}
+
+func (e *QuorumError) Error() string {
+	addrs := make([]string, 0, len(e.Errs))
+	for addr := range e.Errs {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	var b strings.Builder
+	b.WriteString("quorum not reached, ")
+	b.WriteString(strconv.Itoa(e.Acks))
+	b.WriteString(" of ")
+	b.WriteString(strconv.Itoa(e.Quorum))
+	b.WriteString(" servers acknowledged")
+	for _, addr := range addrs {
+		b.WriteString(", ")
+		b.WriteString(addr)
+		b.WriteString(": ")
+		b.WriteString(e.Errs[addr].Error())
+	}
+	return b.String()
+}
+
+// Unwrap returns the error returned by the server with the lowest address, so
+// that errors.Is and errors.As may be used on a QuorumError, e.g. to check if
+// the servers returned a resp2.Error.
+func (e *QuorumError) Unwrap() error {
+	var first string
+	for addr := range e.Errs {
+		if first == "" || addr < first {
+			first = addr
+		}
+	}
+	return e.Errs[first]
+}
+
+type quorumClientOpts struct {
+	pf                      ClientFunc
+	writeQuorum, readQuorum int
+	readRepair              bool
+}
+
+// QuorumClientOpt is an optional behavior which can be applied to the
+// NewQuorumClient function to effect a QuorumClient's behavior.
+type QuorumClientOpt func(*quorumClientOpts)
+
+// QuorumClientPoolFunc tells the QuorumClient to use the given ClientFunc when
+// creating the pool of connections to each server.
+func QuorumClientPoolFunc(pf ClientFunc) QuorumClientOpt {
+	return func(qo *quorumClientOpts) {
+		qo.pf = pf
+	}
+}
+
+// QuorumClientWriteQuorum tells the QuorumClient how many servers must
+// successfully perform a write for it to succeed. A quorum of 0 or less means a
+// majority of the servers.
+func QuorumClientWriteQuorum(n int) QuorumClientOpt {
+	return func(qo *quorumClientOpts) {
+		qo.writeQuorum = n
+	}
+}
+
+// QuorumClientReadQuorum tells the QuorumClient how many servers must reply to
+// a read for it to succeed. A quorum of 0 or less means a majority of the
+// servers.
+//
+// If the read quorum plus the write quorum is greater than the number of
+// servers, then every read will see the result of every write which preceded
+// it, as at least one of the servers read from will have performed the write.
+func QuorumClientReadQuorum(n int) QuorumClientOpt {
+	return func(qo *quorumClientOpts) {
+		qo.readQuorum = n
+	}
+}
+
+// QuorumClientReadRepair tells the QuorumClient whether to perform read repair,
+// see QuorumClient.
+func QuorumClientReadRepair(readRepair bool) QuorumClientOpt {
+	return func(qo *quorumClientOpts) {
+		qo.readRepair = readRepair
+	}
+}
+
+// QuorumClient is a Client which performs Actions on a set of independent,
+// non-cluster redis instances (servers), each of which holds a full copy of the
+// dataset, for deployments which want a cache which remains available while a
+// minority of its servers are down, without using redis cluster or sentinel.
+//
+// Writes are performed on every server, and succeed once a quorum of them have
+// successfully performed the write. Reads are also performed on every server,
+// and succeed once a quorum of them have replied, the reply returned being the
+// one most of those servers agree on.
+//
+// With read repair enabled, a read of a single key whose replies don't all
+// agree causes the key to be copied, using DUMP and RESTORE, from a server
+// which returned the agreed on reply to those which didn't. This is done in the
+// background, after the read has returned.
+//
+// NOTE that QuorumClient is experimental. There is no ordering of writes
+// across servers, so concurrent writes to the same key may be applied in a
+// different order on each server, and a failed write may have been performed
+// on some servers. Only Actions created by Cmd or FlatCmd are supported;
+// Actions created by anything else, e.g. Pipeline, EvalScript or WithConn,
+// return an error.
+type QuorumClient struct {
+	qo quorumClientOpts
+
+	addrs   []string
+	clients map[string]Client
+
+	l      sync.RWMutex
+	closed bool
+
+	// Any errors encountered internally, e.g. while performing read repair,
+	// will be written to this channel. If nothing is reading the channel the
+	// errors will be dropped. The channel will be closed when the Close method
+	// is called.
+	ErrCh chan error
+}
+
+var _ Client = new(QuorumClient)
+
+// NewQuorumClient initializes and returns a QuorumClient for the given server
+// addresses, creating a Client for each.
+//
+// NewQuorumClient takes in a number of options which can overwrite its default
+// behavior. The default options NewQuorumClient uses are:
+//
+//	QuorumClientPoolFunc(DefaultClientFunc)
+//	QuorumClientWriteQuorum(0)
+//	QuorumClientReadQuorum(0)
+//	QuorumClientReadRepair(true)
+//
+func NewQuorumClient(addrs []string, opts ...QuorumClientOpt) (*QuorumClient, error) {
+	qc := &QuorumClient{
+		clients: make(map[string]Client, len(addrs)),
+		ErrCh:   make(chan error, 1),
+	}
+
+	defaultQuorumClientOpts := []QuorumClientOpt{
+		QuorumClientPoolFunc(DefaultClientFunc),
+		QuorumClientWriteQuorum(0),
+		QuorumClientReadQuorum(0),
+		QuorumClientReadRepair(true),
+	}
+	for _, opt := range append(defaultQuorumClientOpts, opts...) {
+		if opt != nil {
+			opt(&(qc.qo))
+		}
+	}
+
+	for _, addr := range addrs {
+		if _, ok := qc.clients[addr]; !ok {
+			qc.clients[addr] = nil
+			qc.addrs = append(qc.addrs, addr)
+		}
+	}
+
+	majority := len(qc.addrs)/2 + 1
+	if qc.qo.writeQuorum <= 0 {
+		qc.qo.writeQuorum = majority
+	}
+	if qc.qo.readQuorum <= 0 {
+		qc.qo.readQuorum = majority
+	}
+
+	if len(qc.addrs) == 0 {
+		return nil, errors.New("at least one server address is required")
+	} else if qc.qo.writeQuorum > len(qc.addrs) || qc.qo.readQuorum > len(qc.addrs) {
+		return nil, errors.New("quorum is greater than the number of servers")
+	}
+
+	for _, addr := range qc.addrs {
+		client, err := qc.qo.pf("tcp", addr)
+		if err != nil {
+			qc.Close()
+			return nil, errors.Errorf("error connecting to server %s: %w", addr, err)
+		}
+		qc.clients[addr] = client
+	}
+	return qc, nil
+}
+
+func (qc *QuorumClient) err(err error) {
+	qc.l.RLock()
+	defer qc.l.RUnlock()
+	if qc.closed {
+		return
+	}
+	select {
+	case qc.ErrCh <- err:
+	default:
+	}
+}
+
+type quorumReply struct {
+	addr string
+	raw  resp2.RawMessage
+	err  error
+}
+
+// doAll performs the command on every server, returning a channel which each
+// of their replies will be written to. The channel is buffered so that replies
+// which are never read don't block.
+func (qc *QuorumClient) doAll(args []string) <-chan quorumReply {
+	ch := make(chan quorumReply, len(qc.addrs))
+	for _, addr := range qc.addrs {
+		go func(addr string) {
+			r := quorumReply{addr: addr}
+			r.err = qc.clients[addr].Do(Cmd(&r.raw, args[0], args[1:]...))
+			ch <- r
+		}(addr)
+	}
+	return ch
+}
+
+// Do implements the method for the Client interface.
+func (qc *QuorumClient) Do(a Action) error {
+	qc.l.RLock()
+	closed := qc.closed
+	qc.l.RUnlock()
+	if closed {
+		return ErrClientClosed
+	}
+
+	cmdA, ok := a.(CmdAction)
+	if !ok || !isCmd(a) {
+		return errors.New("QuorumClient only supports Actions created by Cmd or FlatCmd")
+	}
+	cmds, err := unmarshalCmds(cmdA)
+	if err != nil {
+		return err
+	}
+	args := cmds[0]
+
+	quorum := qc.qo.writeQuorum
+	if isReadOnly(a) {
+		quorum = qc.qo.readQuorum
+	}
+
+	ch := qc.doAll(args)
+	var replies []quorumReply
+	errs := map[string]error{}
+	for len(replies) < quorum && len(errs) <= len(qc.addrs)-quorum {
+		if r := <-ch; r.err != nil {
+			errs[r.addr] = r.err
+		} else {
+			replies = append(replies, r)
+		}
+	}
+	if len(replies) < quorum {
+		return &QuorumError{Acks: len(replies), Quorum: quorum, Errs: errs}
+	}
+
+	agreed := quorumAgreed(replies)
+	if isReadOnly(a) && qc.qo.readRepair {
+		if keys := ActionProperties(a).Keys; len(keys) == 1 {
+			received := len(replies) + len(errs)
+			go qc.readRepair(keys[0], agreed, replies, ch, len(qc.addrs)-received)
+		}
+	}
+	return agreed.raw.UnmarshalInto(cmdA)
+}
+
+// isCmd returns whether the Action was created by Cmd or FlatCmd, possibly
+// wrapped by ReadOnly, WithPriority or WithMetadata.
+func isCmd(a Action) bool {
+	for {
+		switch aa := a.(type) {
+		case *cmdAction:
+			return true
+		case wrappedAction:
+			a = aa.unwrapAction()
+		default:
+			return false
+		}
+	}
+}
+
+// quorumAgreed returns the reply which most of the given replies are the same
+// as, favoring earlier replies in the case of a tie.
+func quorumAgreed(replies []quorumReply) quorumReply {
+	var agreed quorumReply
+	var agreedVotes int
+	for _, r := range replies {
+		var votes int
+		for _, rr := range replies {
+			if bytes.Equal(r.raw, rr.raw) {
+				votes++
+			}
+		}
+		if votes > agreedVotes {
+			agreed, agreedVotes = r, votes
+		}
+	}
+	return agreed
+}
+
+// readRepair copies the key from the server which returned the agreed reply to
+// every server which returned a different one, including those whose replies
+// are still to be read off ch.
+func (qc *QuorumClient) readRepair(key string, agreed quorumReply, replies []quorumReply, ch <-chan quorumReply, pending int) {
+	for ; pending > 0; pending-- {
+		if r := <-ch; r.err == nil {
+			replies = append(replies, r)
+		}
+	}
+
+	var stale []string
+	for _, r := range replies {
+		if !bytes.Equal(r.raw, agreed.raw) {
+			stale = append(stale, r.addr)
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+
+	var dump []byte
+	var pttl int64
+	from := qc.clients[agreed.addr]
+	if err := from.Do(Pipeline(
+		Cmd(&dump, "DUMP", key),
+		Cmd(&pttl, "PTTL", key),
+	)); err != nil {
+		qc.err(errors.Errorf("read repair of %q from %s: %w", key, agreed.addr, err))
+		return
+	} else if pttl < 0 {
+		pttl = 0
+	}
+
+	for _, addr := range stale {
+		var repair Action
+		if dump == nil {
+			repair = Cmd(nil, "DEL", key)
+		} else {
+			repair = FlatCmd(nil, "RESTORE", key, pttl, dump, "REPLACE")
+		}
+		if err := qc.clients[addr].Do(repair); err != nil {
+			qc.err(errors.Errorf("read repair of %q to %s: %w", key, addr, err))
+		}
+	}
+}
+
+// Close implements the method for the Client interface.
+func (qc *QuorumClient) Close() error {
+	qc.l.Lock()
+	defer qc.l.Unlock()
+	if qc.closed {
+		return ErrClientClosed
+	}
+	qc.closed = true
+	close(qc.ErrCh)
+
+	var closeErr error
+	for _, client := range qc.clients {
+		if client == nil {
+			continue
+		} else if err := client.Close(); closeErr == nil && err != nil {
+			closeErr = err
+		}
+	}
+	return closeErr
+}
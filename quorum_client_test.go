@@ -0,0 +1,123 @@
+package radix
+
+import (
+	"sync"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+// quorumStub is a server for QuorumClient tests which stores string keys, and
+// implements enough of DUMP and RESTORE for read repair.
+type quorumStub struct {
+	l    sync.Mutex
+	conn Conn
+	m    map[string]string
+	down bool
+}
+
+func newQuorumStub(addr string) *quorumStub {
+	qs := &quorumStub{m: map[string]string{}}
+	qs.conn = Stub("tcp", addr, func(args []string) interface{} {
+		if qs.down {
+			return errors.New("server down")
+		}
+		switch args[0] {
+		case "SET":
+			qs.m[args[1]] = args[2]
+			return resp2.SimpleString{S: "OK"}
+		case "GET", "DUMP":
+			if v, ok := qs.m[args[1]]; ok {
+				return v
+			}
+			return nil
+		case "PTTL":
+			return -1
+		case "RESTORE":
+			qs.m[args[1]] = args[3]
+			return resp2.SimpleString{S: "OK"}
+		case "DEL":
+			delete(qs.m, args[1])
+			return 1
+		}
+		return resp2.Error{E: errors.New("ERR unknown command")}
+	})
+	return qs
+}
+
+func (qs *quorumStub) Do(a Action) error {
+	qs.l.Lock()
+	defer qs.l.Unlock()
+	return qs.conn.Do(a)
+}
+
+func (qs *quorumStub) Close() error {
+	return qs.conn.Close()
+}
+
+func (qs *quorumStub) setDown(down bool) {
+	qs.l.Lock()
+	defer qs.l.Unlock()
+	qs.down = down
+}
+
+func (qs *quorumStub) get(key string) string {
+	qs.l.Lock()
+	defer qs.l.Unlock()
+	return qs.m[key]
+}
+
+func TestQuorumClient(t *T) {
+	stubs := map[string]*quorumStub{}
+	for _, addr := range []string{"127.0.0.1:6379", "127.0.0.2:6379", "127.0.0.3:6379"} {
+		stubs[addr] = newQuorumStub(addr)
+	}
+	qc, err := NewQuorumClient([]string{"127.0.0.1:6379", "127.0.0.2:6379", "127.0.0.3:6379"},
+		QuorumClientPoolFunc(func(network, addr string) (Client, error) {
+			return stubs[addr], nil
+		}),
+		QuorumClientReadQuorum(3),
+	)
+	require.NoError(t, err)
+	defer qc.Close()
+
+	// a write succeeds with one server down, and a read agrees with the
+	// majority.
+	stubs["127.0.0.3:6379"].setDown(true)
+	require.NoError(t, qc.Do(Cmd(nil, "SET", "foo", "bar")))
+	stubs["127.0.0.3:6379"].setDown(false)
+
+	// with a read quorum of 3 the stale server is always read from, but the
+	// majority is "bar".
+	stubs["127.0.0.3:6379"].l.Lock()
+	stubs["127.0.0.3:6379"].m["foo"] = "stale"
+	stubs["127.0.0.3:6379"].l.Unlock()
+	var foo string
+	require.NoError(t, qc.Do(Cmd(&foo, "GET", "foo")))
+	assert.Equal(t, "bar", foo)
+
+	// read repair should fix the stale server.
+	for i := 0; stubs["127.0.0.3:6379"].get("foo") != "bar"; i++ {
+		require.True(t, i < 100, "read repair didn't happen")
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// a write fails when a majority of servers are down.
+	stubs["127.0.0.2:6379"].setDown(true)
+	stubs["127.0.0.3:6379"].setDown(true)
+	err = qc.Do(Cmd(nil, "SET", "foo", "baz"))
+	var quorumErr *QuorumError
+	require.True(t, errors.As(err, &quorumErr), "err:%v", err)
+	// the failures may be read before the success, in which case it's not
+	// waited for.
+	assert.True(t, quorumErr.Acks <= 1)
+	assert.Equal(t, 2, quorumErr.Quorum)
+	assert.Len(t, quorumErr.Errs, 2)
+
+	assert.Error(t, qc.Do(Pipeline(Cmd(nil, "GET", "foo"))))
+}
@@ -14,7 +14,11 @@
 //	}
 //
 // If you're using sentinel or cluster you should use NewSentinel or NewCluster
-// (respectively) to create your client instead.
+// (respectively) to create your client instead. For a primary with a fixed set
+// of replicas, but neither sentinel nor cluster, use NewReplicaSet.
+//
+// Applications which would rather multiplex all commands over one or a few
+// connections, instead of using a pool, can use NewMuxClient.
 //
 // Commands
 //
@@ -142,6 +146,14 @@
 //
 // Use the golang.org/x/xerrors package if you're using an older version of go.
 //
+// The resp.Error interface, which resp2.Error implements, can be used in the
+// same way to inspect the prefix of a redis error (e.g. "WRONGTYPE") without
+// parsing the message.
+//
+// Other errors returned from radix can be checked for using errors.Is and
+// errors.As as well: ErrClientClosed, ErrConnClosed, ErrTimeout, ErrPoolEmpty,
+// and ClusterRedirectError.
+//
 // Implicit pipelining
 //
 // Implicit pipelining is an optimization implemented and enabled in the default
@@ -162,12 +174,6 @@
 //
 package radix
 
-import (
-	errors "golang.org/x/xerrors"
-)
-
-var errClientClosed = errors.New("client is closed")
-
 // Client describes an entity which can carry out Actions, e.g. a connection
 // pool for a single redis instance or the cluster client.
 //
@@ -0,0 +1,220 @@
+package radix
+
+import (
+	"bufio"
+	"strconv"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+// This file contains builders for the list and sorted set commands whose
+// optional arguments are easy to get wrong when given positionally.
+
+// LPosOpts are the optional arguments to LPos.
+type LPosOpts struct {
+	// Rank, if non-zero, is the match to start from, e.g. 2 skips the first
+	// match. A negative Rank searches from the tail of the list.
+	Rank int
+
+	// Count is the maximum number of matching positions returned. Zero returns
+	// all of them.
+	Count int
+
+	// MaxLen, if non-zero, limits the number of elements of the list which are
+	// compared against the element.
+	MaxLen int
+}
+
+// LPos returns a CmdAction which performs LPOS, unmarshaling the positions of
+// the elements in the list at key which match element into rcv, in the order
+// they were found. rcv will be empty if there are no matches.
+//
+// LPOS requires redis 6.0.6 or later.
+func LPos(rcv *[]int64, key, element string, opts LPosOpts) CmdAction {
+	args := []string{key, element}
+	if opts.Rank != 0 {
+		args = append(args, "RANK", strconv.Itoa(opts.Rank))
+	}
+	args = append(args, "COUNT", strconv.Itoa(opts.Count))
+	if opts.MaxLen != 0 {
+		args = append(args, "MAXLEN", strconv.Itoa(opts.MaxLen))
+	}
+	return Cmd(rcv, "LPOS", args...)
+}
+
+// ListPopResult is the result of LMPop, describing the elements which were
+// popped and the list they were popped from. If no elements were popped, because
+// all lists were empty, then Key will be empty and Elements nil.
+type ListPopResult struct {
+	Key      string
+	Elements []string
+}
+
+// UnmarshalRESP implements the method for the resp.Unmarshaler interface.
+func (r *ListPopResult) UnmarshalRESP(br *bufio.Reader) error {
+	*r = ListPopResult{}
+	mn := MaybeNil{Rcv: Tuple{&r.Key, &r.Elements}}
+	return mn.UnmarshalRESP(br)
+}
+
+// LMPopOpts are the optional arguments to LMPop.
+type LMPopOpts struct {
+	// Right causes elements to be popped from the tail of the list, rather
+	// than its head.
+	Right bool
+
+	// Count is the maximum number of elements which are popped. Defaults to 1.
+	Count int
+}
+
+// LMPop returns a CmdAction which performs LMPOP, popping elements from the
+// first non-empty list out of the given keys and unmarshaling them into rcv.
+//
+// LMPOP requires redis 7 or later.
+func LMPop(rcv *ListPopResult, keys []string, opts LMPopOpts) CmdAction {
+	args := make([]string, 0, len(keys)+4)
+	args = append(args, strconv.Itoa(len(keys)))
+	args = append(args, keys...)
+	if opts.Right {
+		args = append(args, "RIGHT")
+	} else {
+		args = append(args, "LEFT")
+	}
+	if opts.Count > 0 {
+		args = append(args, "COUNT", strconv.Itoa(opts.Count))
+	}
+	return Cmd(rcv, "LMPOP", args...)
+}
+
+// ZRangeBy describes how the start and stop arguments of ZRange and
+// ZRangeStore are interpreted.
+type ZRangeBy string
+
+// All possible values of ZRangeBy.
+const (
+	// ZRangeRank interprets start and stop as indexes into the sorted set,
+	// e.g. "0" and "-1".
+	ZRangeRank ZRangeBy = ""
+
+	// ZRangeScore interprets start and stop as scores, e.g. "(1" and
+	// "+inf".
+	ZRangeScore ZRangeBy = "BYSCORE"
+
+	// ZRangeLex interprets start and stop as lexicographical ranges, e.g.
+	// "[a" and "+".
+	ZRangeLex ZRangeBy = "BYLEX"
+)
+
+// ZRangeOpts are the optional arguments to ZRange, ZRangeWithScores,
+// ZRangeStore and ZRangeByLex.
+type ZRangeOpts struct {
+	// By describes how start and stop are interpreted, and defaults to
+	// ZRangeRank. It's ignored by ZRangeByLex.
+	By ZRangeBy
+
+	// Rev returns the range in descending order. NOTE that, as with redis,
+	// start and stop must then be given in descending order too, e.g. "+inf"
+	// and "-inf".
+	Rev bool
+
+	// Offset and Count, if Count is non-zero, limit the range to Count
+	// elements starting from Offset within the range. A negative Count
+	// returns all elements from Offset. They may not be used with
+	// ZRangeRank.
+	Offset, Count int
+}
+
+func (o ZRangeOpts) args(args []string, byLex bool) []string {
+	if o.By != ZRangeRank && !byLex {
+		args = append(args, string(o.By))
+	}
+	if o.Rev && !byLex {
+		args = append(args, "REV")
+	}
+	if o.Count != 0 {
+		if o.By == ZRangeRank && !byLex {
+			panic("LIMIT can't be used with ZRangeRank")
+		}
+		args = append(args, "LIMIT", strconv.Itoa(o.Offset), strconv.Itoa(o.Count))
+	}
+	return args
+}
+
+// ZRange returns a CmdAction which performs ZRANGE, unmarshaling the members
+// within the given range of the sorted set at key into rcv, which follows the
+// same rules as for Cmd.
+//
+// ZRange panics if opts.Count is set with ZRangeRank. The BYSCORE, BYLEX,
+// REV and LIMIT arguments of ZRANGE require redis 6.2 or later.
+func ZRange(rcv interface{}, key, start, stop string, opts ZRangeOpts) CmdAction {
+	return Cmd(rcv, "ZRANGE", opts.args([]string{key, start, stop}, false)...)
+}
+
+// ZMember is a member of a sorted set along with its score.
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+type zMembers struct {
+	rcv *[]ZMember
+}
+
+func (zm zMembers) UnmarshalRESP(br *bufio.Reader) error {
+	var ss []string
+	if err := (resp2.Any{I: &ss}).UnmarshalRESP(br); err != nil {
+		return err
+	} else if len(ss)%2 != 0 {
+		return errors.Errorf("expected even number of elements, got %d", len(ss))
+	}
+
+	members := (*zm.rcv)[:0]
+	for i := 0; i < len(ss); i += 2 {
+		score, err := strconv.ParseFloat(ss[i+1], 64)
+		if err != nil {
+			return errors.Errorf("parsing score of %q: %w", ss[i], err)
+		}
+		members = append(members, ZMember{Member: ss[i], Score: score})
+	}
+	*zm.rcv = members
+	return nil
+}
+
+// ZRangeWithScores is like ZRange, but also returns the score of each member by
+// passing WITHSCORES.
+func ZRangeWithScores(rcv *[]ZMember, key, start, stop string, opts ZRangeOpts) CmdAction {
+	args := opts.args([]string{key, start, stop}, false)
+	return Cmd(zMembers{rcv: rcv}, "ZRANGE", append(args, "WITHSCORES")...)
+}
+
+// ZRangeStore returns a CmdAction which performs ZRANGESTORE, storing the
+// members within the given range of the sorted set at src into the sorted set
+// at dst. rcv, which may be nil, will be set to the number of members stored.
+//
+// ZRangeStore panics if opts.Count is set with ZRangeRank. ZRANGESTORE
+// requires redis 6.2 or later.
+func ZRangeStore(rcv *int64, dst, src, start, stop string, opts ZRangeOpts) CmdAction {
+	var r interface{}
+	if rcv != nil {
+		r = rcv
+	}
+	return Cmd(r, "ZRANGESTORE", opts.args([]string{dst, src, start, stop}, false)...)
+}
+
+// ZRangeByLex returns a CmdAction which performs ZRANGEBYLEX, or ZREVRANGEBYLEX
+// if opts.Rev is set, unmarshaling the members within the given
+// lexicographical range (e.g. "[a" and "(c") of the sorted set at key into
+// rcv. Unlike ZREVRANGEBYLEX min and max are always given in that order; they
+// are swapped when opts.Rev is set. opts.By is ignored.
+//
+// This works with all versions of redis, unlike ZRange with ZRangeLex.
+func ZRangeByLex(rcv *[]string, key, min, max string, opts ZRangeOpts) CmdAction {
+	cmd := "ZRANGEBYLEX"
+	if opts.Rev {
+		cmd = "ZREVRANGEBYLEX"
+		min, max = max, min
+	}
+	return Cmd(rcv, cmd, opts.args([]string{key, min, max}, true)...)
+}
@@ -0,0 +1,74 @@
+package radix
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRangeCmds(t *T) {
+	var lastArgs []string
+	stub := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		lastArgs = args
+		switch args[0] {
+		case "LPOS":
+			return []int{1, 4}
+		case "LMPOP":
+			if args[2] == "empty" {
+				return nil
+			}
+			return []interface{}{args[2], []string{"a", "b"}}
+		case "ZRANGE":
+			if args[len(args)-1] == "WITHSCORES" {
+				return []string{"a", "1", "b", "2.5"}
+			}
+			return []string{"a", "b"}
+		case "ZRANGESTORE":
+			return 2
+		default:
+			return []string{"a"}
+		}
+	})
+
+	var positions []int64
+	require.NoError(t, stub.Do(LPos(&positions, "l", "x", LPosOpts{Rank: -1, MaxLen: 10})))
+	assert.Equal(t, []string{"LPOS", "l", "x", "RANK", "-1", "COUNT", "0", "MAXLEN", "10"}, lastArgs)
+	assert.Equal(t, []int64{1, 4}, positions)
+
+	var pop ListPopResult
+	cmd := LMPop(&pop, []string{"l1"}, LMPopOpts{Right: true, Count: 2})
+	assert.Equal(t, []string{"l1"}, cmd.Keys())
+	require.NoError(t, stub.Do(cmd))
+	assert.Equal(t, []string{"LMPOP", "1", "l1", "RIGHT", "COUNT", "2"}, lastArgs)
+	assert.Equal(t, ListPopResult{Key: "l1", Elements: []string{"a", "b"}}, pop)
+
+	require.NoError(t, stub.Do(LMPop(&pop, []string{"empty"}, LMPopOpts{})))
+	assert.Equal(t, []string{"LMPOP", "1", "empty", "LEFT"}, lastArgs)
+	assert.Equal(t, ListPopResult{}, pop)
+
+	var members []string
+	require.NoError(t, stub.Do(ZRange(&members, "z", "+inf", "1", ZRangeOpts{
+		By: ZRangeScore, Rev: true, Offset: 1, Count: 2,
+	})))
+	assert.Equal(t, []string{"ZRANGE", "z", "+inf", "1", "BYSCORE", "REV", "LIMIT", "1", "2"}, lastArgs)
+	assert.Equal(t, []string{"a", "b"}, members)
+
+	var zMembers []ZMember
+	require.NoError(t, stub.Do(ZRangeWithScores(&zMembers, "z", "0", "-1", ZRangeOpts{})))
+	assert.Equal(t, []string{"ZRANGE", "z", "0", "-1", "WITHSCORES"}, lastArgs)
+	assert.Equal(t, []ZMember{{Member: "a", Score: 1}, {Member: "b", Score: 2.5}}, zMembers)
+
+	var stored int64
+	cmd = ZRangeStore(&stored, "dst", "src", "[a", "+", ZRangeOpts{By: ZRangeLex})
+	assert.Equal(t, []string{"dst", "src"}, cmd.Keys())
+	require.NoError(t, stub.Do(cmd))
+	assert.Equal(t, []string{"ZRANGESTORE", "dst", "src", "[a", "+", "BYLEX"}, lastArgs)
+	assert.Equal(t, int64(2), stored)
+	require.NoError(t, stub.Do(ZRangeStore(nil, "dst", "src", "0", "1", ZRangeOpts{})))
+
+	require.NoError(t, stub.Do(ZRangeByLex(&members, "z", "[a", "(c", ZRangeOpts{Rev: true, Count: -1})))
+	assert.Equal(t, []string{"ZREVRANGEBYLEX", "z", "(c", "[a", "LIMIT", "0", "-1"}, lastArgs)
+
+	assert.Panics(t, func() { ZRange(nil, "z", "0", "1", ZRangeOpts{Count: 1}) })
+}
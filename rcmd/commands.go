@@ -0,0 +1,427 @@
+// Code generated by rcmd/internal/gen from commands.json; DO NOT EDIT.
+
+package rcmd
+
+import (
+	"strconv"
+
+	"github.com/mediocregopher/radix/v3"
+)
+
+// DelCmd is a builder for the DEL command, see Del.
+type DelCmd struct {
+	key []string
+}
+
+// Del returns a builder for the DEL command. Deletes one or more keys.
+func Del(key ...string) DelCmd {
+	return DelCmd{
+		key: key,
+	}
+}
+
+// Cmd returns a CmdAction which performs the DEL command built so far,
+// unmarshaling its reply into rcv as per radix.Cmd.
+func (c DelCmd) Cmd(rcv interface{}) radix.CmdAction {
+	args := make([]string, 0, len(c.key))
+	for _, v := range c.key {
+		args = append(args, v)
+	}
+	return radix.Cmd(rcv, "DEL", args...)
+}
+
+// ExpireCmd is a builder for the EXPIRE command, see Expire.
+type ExpireCmd struct {
+	key          string
+	seconds      int64
+	conditionArg []string
+}
+
+// Expire returns a builder for the EXPIRE command. Sets the expiration time of
+// a key in seconds.
+func Expire(key string, seconds int64) ExpireCmd {
+	return ExpireCmd{
+		key:     key,
+		seconds: seconds,
+	}
+}
+
+// Nx sets the NX option of EXPIRE.
+func (c ExpireCmd) Nx() ExpireCmd {
+	c.conditionArg = []string{"NX"}
+	return c
+}
+
+// Xx sets the XX option of EXPIRE.
+func (c ExpireCmd) Xx() ExpireCmd {
+	c.conditionArg = []string{"XX"}
+	return c
+}
+
+// Gt sets the GT option of EXPIRE.
+func (c ExpireCmd) Gt() ExpireCmd {
+	c.conditionArg = []string{"GT"}
+	return c
+}
+
+// Lt sets the LT option of EXPIRE.
+func (c ExpireCmd) Lt() ExpireCmd {
+	c.conditionArg = []string{"LT"}
+	return c
+}
+
+// Cmd returns a CmdAction which performs the EXPIRE command built so far,
+// unmarshaling its reply into rcv as per radix.Cmd.
+func (c ExpireCmd) Cmd(rcv interface{}) radix.CmdAction {
+	args := make([]string, 0, 4)
+	args = append(args, c.key)
+	args = append(args, strconv.FormatInt(c.seconds, 10))
+	args = append(args, c.conditionArg...)
+	return radix.Cmd(rcv, "EXPIRE", args...)
+}
+
+// GetCmd is a builder for the GET command, see Get.
+type GetCmd struct {
+	key string
+}
+
+// Get returns a builder for the GET command. Returns the string value of a key.
+func Get(key string) GetCmd {
+	return GetCmd{
+		key: key,
+	}
+}
+
+// Cmd returns a CmdAction which performs the GET command built so far,
+// unmarshaling its reply into rcv as per radix.Cmd.
+func (c GetCmd) Cmd(rcv interface{}) radix.CmdAction {
+	args := make([]string, 0, 1)
+	args = append(args, c.key)
+	return radix.Cmd(rcv, "GET", args...)
+}
+
+// GetexCmd is a builder for the GETEX command, see Getex.
+type GetexCmd struct {
+	key           string
+	expirationArg []string
+}
+
+// Getex returns a builder for the GETEX command. Returns the string value of a
+// key after setting its expiration time.
+func Getex(key string) GetexCmd {
+	return GetexCmd{
+		key: key,
+	}
+}
+
+// Ex sets the EX option of GETEX.
+func (c GetexCmd) Ex(seconds int64) GetexCmd {
+	c.expirationArg = []string{"EX", strconv.FormatInt(seconds, 10)}
+	return c
+}
+
+// Px sets the PX option of GETEX.
+func (c GetexCmd) Px(milliseconds int64) GetexCmd {
+	c.expirationArg = []string{"PX", strconv.FormatInt(milliseconds, 10)}
+	return c
+}
+
+// Exat sets the EXAT option of GETEX.
+func (c GetexCmd) Exat(unixTimeSeconds int64) GetexCmd {
+	c.expirationArg = []string{"EXAT", strconv.FormatInt(unixTimeSeconds, 10)}
+	return c
+}
+
+// Pxat sets the PXAT option of GETEX.
+func (c GetexCmd) Pxat(unixTimeMilliseconds int64) GetexCmd {
+	c.expirationArg = []string{"PXAT", strconv.FormatInt(unixTimeMilliseconds, 10)}
+	return c
+}
+
+// Persist sets the PERSIST option of GETEX.
+func (c GetexCmd) Persist() GetexCmd {
+	c.expirationArg = []string{"PERSIST"}
+	return c
+}
+
+// Cmd returns a CmdAction which performs the GETEX command built so far,
+// unmarshaling its reply into rcv as per radix.Cmd.
+func (c GetexCmd) Cmd(rcv interface{}) radix.CmdAction {
+	args := make([]string, 0, 3)
+	args = append(args, c.key)
+	args = append(args, c.expirationArg...)
+	return radix.Cmd(rcv, "GETEX", args...)
+}
+
+// IncrbyCmd is a builder for the INCRBY command, see Incrby.
+type IncrbyCmd struct {
+	key       string
+	increment int64
+}
+
+// Incrby returns a builder for the INCRBY command. Increments the integer value
+// of a key by a number.
+func Incrby(key string, increment int64) IncrbyCmd {
+	return IncrbyCmd{
+		key:       key,
+		increment: increment,
+	}
+}
+
+// Cmd returns a CmdAction which performs the INCRBY command built so far,
+// unmarshaling its reply into rcv as per radix.Cmd.
+func (c IncrbyCmd) Cmd(rcv interface{}) radix.CmdAction {
+	args := make([]string, 0, 2)
+	args = append(args, c.key)
+	args = append(args, strconv.FormatInt(c.increment, 10))
+	return radix.Cmd(rcv, "INCRBY", args...)
+}
+
+// IncrbyfloatCmd is a builder for the INCRBYFLOAT command, see Incrbyfloat.
+type IncrbyfloatCmd struct {
+	key       string
+	increment float64
+}
+
+// Incrbyfloat returns a builder for the INCRBYFLOAT command. Increment the
+// floating point value of a key by a number.
+func Incrbyfloat(key string, increment float64) IncrbyfloatCmd {
+	return IncrbyfloatCmd{
+		key:       key,
+		increment: increment,
+	}
+}
+
+// Cmd returns a CmdAction which performs the INCRBYFLOAT command built so far,
+// unmarshaling its reply into rcv as per radix.Cmd.
+func (c IncrbyfloatCmd) Cmd(rcv interface{}) radix.CmdAction {
+	args := make([]string, 0, 2)
+	args = append(args, c.key)
+	args = append(args, strconv.FormatFloat(c.increment, 'f', -1, 64))
+	return radix.Cmd(rcv, "INCRBYFLOAT", args...)
+}
+
+// LpushCmd is a builder for the LPUSH command, see Lpush.
+type LpushCmd struct {
+	key     string
+	element []string
+}
+
+// Lpush returns a builder for the LPUSH command. Prepends one or more elements
+// to a list.
+func Lpush(key string, element ...string) LpushCmd {
+	return LpushCmd{
+		key:     key,
+		element: element,
+	}
+}
+
+// Cmd returns a CmdAction which performs the LPUSH command built so far,
+// unmarshaling its reply into rcv as per radix.Cmd.
+func (c LpushCmd) Cmd(rcv interface{}) radix.CmdAction {
+	args := make([]string, 0, 1+len(c.element))
+	args = append(args, c.key)
+	for _, v := range c.element {
+		args = append(args, v)
+	}
+	return radix.Cmd(rcv, "LPUSH", args...)
+}
+
+// ScanCmd is a builder for the SCAN command, see Scan.
+type ScanCmd struct {
+	cursor     int64
+	patternArg []string
+	countArg   []string
+	argTypeArg []string
+}
+
+// Scan returns a builder for the SCAN command. Iterates over the key names in
+// the database.
+func Scan(cursor int64) ScanCmd {
+	return ScanCmd{
+		cursor: cursor,
+	}
+}
+
+// Match sets the MATCH option of SCAN.
+func (c ScanCmd) Match(pattern string) ScanCmd {
+	c.patternArg = []string{"MATCH", pattern}
+	return c
+}
+
+// Count sets the COUNT option of SCAN.
+func (c ScanCmd) Count(count int64) ScanCmd {
+	c.countArg = []string{"COUNT", strconv.FormatInt(count, 10)}
+	return c
+}
+
+// Type sets the TYPE option of SCAN.
+func (c ScanCmd) Type(argType string) ScanCmd {
+	c.argTypeArg = []string{"TYPE", argType}
+	return c
+}
+
+// Cmd returns a CmdAction which performs the SCAN command built so far,
+// unmarshaling its reply into rcv as per radix.Cmd.
+func (c ScanCmd) Cmd(rcv interface{}) radix.CmdAction {
+	args := make([]string, 0, 7)
+	args = append(args, strconv.FormatInt(c.cursor, 10))
+	args = append(args, c.patternArg...)
+	args = append(args, c.countArg...)
+	args = append(args, c.argTypeArg...)
+	return radix.Cmd(rcv, "SCAN", args...)
+}
+
+// SetCmd is a builder for the SET command, see Set.
+type SetCmd struct {
+	key           string
+	value         string
+	conditionArg  []string
+	getArg        []string
+	expirationArg []string
+}
+
+// Set returns a builder for the SET command. Sets the string value of a key,
+// ignoring its type.
+func Set(key string, value string) SetCmd {
+	return SetCmd{
+		key:   key,
+		value: value,
+	}
+}
+
+// Nx sets the NX option of SET.
+func (c SetCmd) Nx() SetCmd {
+	c.conditionArg = []string{"NX"}
+	return c
+}
+
+// Xx sets the XX option of SET.
+func (c SetCmd) Xx() SetCmd {
+	c.conditionArg = []string{"XX"}
+	return c
+}
+
+// Get sets the GET option of SET.
+func (c SetCmd) Get() SetCmd {
+	c.getArg = []string{"GET"}
+	return c
+}
+
+// Ex sets the EX option of SET.
+func (c SetCmd) Ex(seconds int64) SetCmd {
+	c.expirationArg = []string{"EX", strconv.FormatInt(seconds, 10)}
+	return c
+}
+
+// Px sets the PX option of SET.
+func (c SetCmd) Px(milliseconds int64) SetCmd {
+	c.expirationArg = []string{"PX", strconv.FormatInt(milliseconds, 10)}
+	return c
+}
+
+// Exat sets the EXAT option of SET.
+func (c SetCmd) Exat(unixTimeSeconds int64) SetCmd {
+	c.expirationArg = []string{"EXAT", strconv.FormatInt(unixTimeSeconds, 10)}
+	return c
+}
+
+// Pxat sets the PXAT option of SET.
+func (c SetCmd) Pxat(unixTimeMilliseconds int64) SetCmd {
+	c.expirationArg = []string{"PXAT", strconv.FormatInt(unixTimeMilliseconds, 10)}
+	return c
+}
+
+// Keepttl sets the KEEPTTL option of SET.
+func (c SetCmd) Keepttl() SetCmd {
+	c.expirationArg = []string{"KEEPTTL"}
+	return c
+}
+
+// Cmd returns a CmdAction which performs the SET command built so far,
+// unmarshaling its reply into rcv as per radix.Cmd.
+func (c SetCmd) Cmd(rcv interface{}) radix.CmdAction {
+	args := make([]string, 0, 8)
+	args = append(args, c.key)
+	args = append(args, c.value)
+	args = append(args, c.conditionArg...)
+	args = append(args, c.getArg...)
+	args = append(args, c.expirationArg...)
+	return radix.Cmd(rcv, "SET", args...)
+}
+
+// ZaddData is an element of the data argument of ZADD.
+type ZaddData struct {
+	Score  float64
+	Member string
+}
+
+// ZaddCmd is a builder for the ZADD command, see Zadd.
+type ZaddCmd struct {
+	key           string
+	conditionArg  []string
+	comparisonArg []string
+	changeArg     []string
+	incrementArg  []string
+	data          []ZaddData
+}
+
+// Zadd returns a builder for the ZADD command. Adds one or more members to a
+// sorted set, or updates their scores.
+func Zadd(key string, data ...ZaddData) ZaddCmd {
+	return ZaddCmd{
+		key:  key,
+		data: data,
+	}
+}
+
+// Nx sets the NX option of ZADD.
+func (c ZaddCmd) Nx() ZaddCmd {
+	c.conditionArg = []string{"NX"}
+	return c
+}
+
+// Xx sets the XX option of ZADD.
+func (c ZaddCmd) Xx() ZaddCmd {
+	c.conditionArg = []string{"XX"}
+	return c
+}
+
+// Gt sets the GT option of ZADD.
+func (c ZaddCmd) Gt() ZaddCmd {
+	c.comparisonArg = []string{"GT"}
+	return c
+}
+
+// Lt sets the LT option of ZADD.
+func (c ZaddCmd) Lt() ZaddCmd {
+	c.comparisonArg = []string{"LT"}
+	return c
+}
+
+// Ch sets the CH option of ZADD.
+func (c ZaddCmd) Ch() ZaddCmd {
+	c.changeArg = []string{"CH"}
+	return c
+}
+
+// Incr sets the INCR option of ZADD.
+func (c ZaddCmd) Incr() ZaddCmd {
+	c.incrementArg = []string{"INCR"}
+	return c
+}
+
+// Cmd returns a CmdAction which performs the ZADD command built so far,
+// unmarshaling its reply into rcv as per radix.Cmd.
+func (c ZaddCmd) Cmd(rcv interface{}) radix.CmdAction {
+	args := make([]string, 0, 9+2*len(c.data))
+	args = append(args, c.key)
+	args = append(args, c.conditionArg...)
+	args = append(args, c.comparisonArg...)
+	args = append(args, c.changeArg...)
+	args = append(args, c.incrementArg...)
+	for _, v := range c.data {
+		args = append(args, strconv.FormatFloat(v.Score, 'f', -1, 64), v.Member)
+	}
+	return radix.Cmd(rcv, "ZADD", args...)
+}
@@ -0,0 +1,314 @@
+// Command gen generates the rcmd package's command builders from a
+// commands.json file, in the format used by redis' own documentation (see
+// https://github.com/redis/redis-doc/blob/master/commands.json).
+//
+// Commands whose arguments can't be expressed by the builders (e.g. optional
+// arguments which may be given multiple times) are skipped, and a note is
+// written to stderr for each one.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+type arg struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Token     string `json:"token"`
+	Optional  bool   `json:"optional"`
+	Multiple  bool   `json:"multiple"`
+	Arguments []arg  `json:"arguments"`
+}
+
+type command struct {
+	Summary   string `json:"summary"`
+	Group     string `json:"group"`
+	Arguments []arg  `json:"arguments"`
+}
+
+// goTypes maps the simple argument types to the Go type which is used for
+// them, and formatters maps them to the expression which formats a value of
+// that type as a string.
+var (
+	goTypes = map[string]string{
+		"key":       "string",
+		"string":    "string",
+		"pattern":   "string",
+		"integer":   "int64",
+		"unix-time": "int64",
+		"double":    "float64",
+	}
+
+	formatters = map[string]string{
+		"string":  "%s",
+		"int64":   "strconv.FormatInt(%s, 10)",
+		"float64": "strconv.FormatFloat(%s, 'f', -1, 64)",
+	}
+)
+
+func camel(s string, upper bool) string {
+	parts := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return r == '-' || r == '_' || r == ' '
+	})
+	for i := range parts {
+		if i > 0 || upper {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+func paramName(s string) string {
+	name := camel(s, false)
+	if token.IsKeyword(name) {
+		name = "arg" + camel(s, true)
+	}
+	return name
+}
+
+func formatValue(typ, expr string) string {
+	return fmt.Sprintf(formatters[goTypes[typ]], expr)
+}
+
+type generator struct {
+	buf bytes.Buffer
+}
+
+func (g *generator) p(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+	g.buf.WriteString("\n")
+}
+
+// comment writes the given text as a comment, wrapped to 80 columns.
+func (g *generator) comment(text string) {
+	line := "//"
+	for _, word := range strings.Fields(text) {
+		if len(line)+1+len(word) > 80 {
+			g.p("%s", line)
+			line = "//"
+		}
+		line += " " + word
+	}
+	g.p("%s", line)
+}
+
+// genCommand generates the builder for a single command, or returns an error
+// describing why it can't be.
+func genCommand(name string, cmd command) ([]byte, error) {
+	words := strings.Fields(name)
+	goName := camel(name, true)
+	typeName := goName + "Cmd"
+
+	g := new(generator)
+	var params, fields, appends, extraCap []string
+	var types, methods bytes.Buffer
+	argCount := len(words) - 1
+	methodNames := map[string]bool{"Cmd": true}
+
+	for _, w := range words[1:] {
+		appends = append(appends, fmt.Sprintf("args = append(args, %q)", w))
+	}
+
+	for i, a := range cmd.Arguments {
+		if _, simple := goTypes[a.Type]; !a.Optional && simple {
+			if a.Token != "" {
+				appends = append(appends, fmt.Sprintf("args = append(args, %q)", a.Token))
+				argCount++
+			}
+			pName, goType := paramName(a.Name), goTypes[a.Type]
+			if a.Multiple {
+				if i != len(cmd.Arguments)-1 {
+					return nil, fmt.Errorf("multiple argument %q isn't last", a.Name)
+				}
+				params = append(params, fmt.Sprintf("%s ...%s", pName, goType))
+				fields = append(fields, fmt.Sprintf("%s []%s", pName, goType))
+				extraCap = append(extraCap, fmt.Sprintf("len(c.%s)", pName))
+				appends = append(appends, fmt.Sprintf("for _, v := range c.%s {\nargs = append(args, %s)\n}", pName, formatValue(a.Type, "v")))
+				continue
+			}
+			params = append(params, fmt.Sprintf("%s %s", pName, goType))
+			fields = append(fields, fmt.Sprintf("%s %s", pName, goType))
+			appends = append(appends, fmt.Sprintf("args = append(args, %s)", formatValue(a.Type, "c."+pName)))
+			argCount++
+			continue
+		}
+
+		switch {
+		case !a.Optional && a.Type == "pure-token":
+			appends = append(appends, fmt.Sprintf("args = append(args, %q)", a.Token))
+			argCount++
+
+		case !a.Optional && a.Type == "block" && a.Multiple:
+			if i != len(cmd.Arguments)-1 {
+				return nil, fmt.Errorf("multiple argument %q isn't last", a.Name)
+			}
+			elemType := goName + camel(a.Name, true)
+			fmt.Fprintf(&types, "// %s is an element of the %s argument of %s.\n", elemType, a.Name, name)
+			fmt.Fprintf(&types, "type %s struct {\n", elemType)
+			var elemAppends []string
+			for _, sub := range a.Arguments {
+				goType, ok := goTypes[sub.Type]
+				if !ok || sub.Optional || sub.Multiple || sub.Token != "" {
+					return nil, fmt.Errorf("unsupported element %q of block %q", sub.Name, a.Name)
+				}
+				fieldName := camel(sub.Name, true)
+				fmt.Fprintf(&types, "%s %s\n", fieldName, goType)
+				elemAppends = append(elemAppends, formatValue(sub.Type, "v."+fieldName))
+			}
+			fmt.Fprintf(&types, "}\n\n")
+
+			pName := paramName(a.Name)
+			params = append(params, fmt.Sprintf("%s ...%s", pName, elemType))
+			fields = append(fields, fmt.Sprintf("%s []%s", pName, elemType))
+			extraCap = append(extraCap, fmt.Sprintf("%d*len(c.%s)", len(a.Arguments), pName))
+			appends = append(appends, fmt.Sprintf("for _, v := range c.%s {\nargs = append(args, %s)\n}", pName, strings.Join(elemAppends, ", ")))
+
+		case a.Optional && !a.Multiple:
+			// every optional argument gets a slot, which is filled in by its
+			// method(s). For a oneof each option gets its own method, which all
+			// fill in the same slot, so only the last one called is used.
+			options := []arg{a}
+			if a.Type == "oneof" {
+				options = a.Arguments
+			}
+			slot := paramName(a.Name) + "Arg"
+			fields = append(fields, fmt.Sprintf("%s []string", slot))
+			appends = append(appends, fmt.Sprintf("args = append(args, c.%s...)", slot))
+			argCount += 2
+
+			for _, opt := range options {
+				methodName := camel(opt.Token, true)
+				if methodName == "" {
+					methodName = camel(opt.Name, true)
+				}
+				if methodNames[methodName] {
+					return nil, fmt.Errorf("duplicate method %q", methodName)
+				}
+				methodNames[methodName] = true
+
+				if opt.Multiple {
+					return nil, fmt.Errorf("multiple option %q", opt.Name)
+				} else if opt.Type == "pure-token" {
+					fmt.Fprintf(&methods, "// %s sets the %s option of %s.\n", methodName, opt.Token, name)
+					fmt.Fprintf(&methods, "func (c %s) %s() %s {\n", typeName, methodName, typeName)
+					fmt.Fprintf(&methods, "c.%s = []string{%q}\nreturn c\n}\n\n", slot, opt.Token)
+					continue
+				} else if _, simple := goTypes[opt.Type]; !simple {
+					return nil, fmt.Errorf("unsupported option %q of type %q", opt.Name, opt.Type)
+				}
+
+				pName := paramName(opt.Name)
+				var vals []string
+				if opt.Token != "" {
+					vals = append(vals, fmt.Sprintf("%q", opt.Token))
+					fmt.Fprintf(&methods, "// %s sets the %s option of %s.\n", methodName, opt.Token, name)
+				} else {
+					fmt.Fprintf(&methods, "// %s sets the optional %s argument of %s.\n", methodName, opt.Name, name)
+				}
+				vals = append(vals, formatValue(opt.Type, pName))
+				fmt.Fprintf(&methods, "func (c %s) %s(%s %s) %s {\n", typeName, methodName, pName, goTypes[opt.Type], typeName)
+				fmt.Fprintf(&methods, "c.%s = []string{%s}\nreturn c\n}\n\n", slot, strings.Join(vals, ", "))
+			}
+
+		default:
+			return nil, fmt.Errorf("unsupported argument %q of type %q", a.Name, a.Type)
+		}
+	}
+
+	g.buf.Write(types.Bytes())
+
+	fmt.Fprintf(&g.buf, "// %s is a builder for the %s command, see %s.\n", typeName, name, goName)
+	g.p("type %s struct {", typeName)
+	for _, f := range fields {
+		g.p("%s", f)
+	}
+	g.p("}\n")
+
+	var fieldNames []string
+	for _, prm := range params {
+		fieldNames = append(fieldNames, strings.Fields(prm)[0])
+	}
+	g.comment(fmt.Sprintf("%s returns a builder for the %s command. %s", goName, name, cmd.Summary))
+	g.p("func %s(%s) %s {", goName, strings.Join(params, ", "), typeName)
+	g.p("return %s{", typeName)
+	for _, f := range fieldNames {
+		g.p("%s: %s,", f, f)
+	}
+	g.p("}\n}\n")
+
+	g.buf.Write(methods.Bytes())
+
+	g.p("// Cmd returns a CmdAction which performs the %s command built so far,", name)
+	g.p("// unmarshaling its reply into rcv as per radix.Cmd.")
+	g.p("func (c %s) Cmd(rcv interface{}) radix.CmdAction {", typeName)
+	capExprs := extraCap
+	if argCount > 0 || len(capExprs) == 0 {
+		capExprs = append([]string{fmt.Sprint(argCount)}, capExprs...)
+	}
+	g.p("args := make([]string, 0, %s)", strings.Join(capExprs, "+"))
+	for _, a := range appends {
+		g.p("%s", a)
+	}
+	g.p("return radix.Cmd(rcv, %q, args...)\n}\n", words[0])
+	return g.buf.Bytes(), nil
+}
+
+func main() {
+	in := flag.String("in", "commands.json", "commands.json file to generate builders from")
+	out := flag.String("out", "commands.go", "file to write the generated builders to")
+	flag.Parse()
+
+	b, err := ioutil.ReadFile(*in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var cmds map[string]command
+	if err := json.Unmarshal(b, &cmds); err != nil {
+		log.Fatalf("decoding %q: %v", *in, err)
+	}
+
+	names := make([]string, 0, len(cmds))
+	for name := range cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var body bytes.Buffer
+	for _, name := range names {
+		src, err := genCommand(name, cmds[name])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping %s: %v\n", name, err)
+			continue
+		}
+		body.Write(src)
+	}
+
+	g := new(generator)
+	g.p("// Code generated by rcmd/internal/gen from %s; DO NOT EDIT.\n", *in)
+	g.p("package rcmd\n")
+	g.p("import (")
+	if bytes.Contains(body.Bytes(), []byte("strconv.")) {
+		g.p("%q\n", "strconv")
+	}
+	g.p("%q", "github.com/mediocregopher/radix/v3")
+	g.p(")\n")
+	g.buf.Write(body.Bytes())
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		log.Fatalf("formatting generated code: %v", err)
+	}
+	if err := ioutil.WriteFile(*out, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,17 @@
+// Package rcmd provides typed builders for redis commands, which are generated
+// from redis' commands.json. Required arguments are parameters of each
+// builder's constructor, and optional arguments are set using methods, so that
+// commands with missing arguments can't be built:
+//
+//	var prev string
+//	err := client.Do(rcmd.Set("foo", "bar").Ex(10).Nx().Get().Cmd(&prev))
+//
+// Where only one of a set of options may be given, e.g. NX or XX, each option
+// has its own method and only the one called last is used.
+//
+// The commands which have builders are those in this package's commands.json,
+// which is a subset of the one in redis' documentation. To add a command, add
+// its entry to commands.json and run go generate.
+package rcmd
+
+//go:generate go run ./internal/gen -in commands.json -out commands.go
@@ -0,0 +1,53 @@
+package rcmd
+
+import (
+	"bufio"
+	"bytes"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mediocregopher/radix/v3"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+func TestBuilders(t *T) {
+	tests := []struct {
+		cmd radix.CmdAction
+		exp []string
+	}{
+		{Get("foo").Cmd(nil), []string{"GET", "foo"}},
+		{Set("foo", "bar").Cmd(nil), []string{"SET", "foo", "bar"}},
+		{
+			Set("foo", "bar").Ex(10).Nx().Get().Cmd(nil),
+			[]string{"SET", "foo", "bar", "NX", "GET", "EX", "10"},
+		},
+		{
+			// only the last of a oneof is used
+			Set("foo", "bar").Nx().Xx().Px(5).Keepttl().Cmd(nil),
+			[]string{"SET", "foo", "bar", "XX", "KEEPTTL"},
+		},
+		{Del("a", "b").Cmd(nil), []string{"DEL", "a", "b"}},
+		{Expire("foo", 5).Gt().Cmd(nil), []string{"EXPIRE", "foo", "5", "GT"}},
+		{Incrbyfloat("foo", 1.5).Cmd(nil), []string{"INCRBYFLOAT", "foo", "1.5"}},
+		{
+			Scan(0).Match("foo*").Count(100).Cmd(nil),
+			[]string{"SCAN", "0", "MATCH", "foo*", "COUNT", "100"},
+		},
+		{
+			Zadd("foo", ZaddData{Score: 1, Member: "a"}, ZaddData{Score: 2.5, Member: "b"}).Gt().Ch().Cmd(nil),
+			[]string{"ZADD", "foo", "GT", "CH", "1", "a", "2.5", "b"},
+		},
+	}
+
+	for _, test := range tests {
+		buf := new(bytes.Buffer)
+		require.NoError(t, test.cmd.MarshalRESP(buf))
+		var got []string
+		require.NoError(t, (resp2.Any{I: &got}).UnmarshalRESP(bufio.NewReader(buf)))
+		assert.Equal(t, test.exp, got)
+	}
+
+	assert.Equal(t, []string{"foo"}, Get("foo").Cmd(nil).Keys())
+}
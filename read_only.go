@@ -0,0 +1,63 @@
+package radix
+
+// ReadOnlyViolationError is returned by Clients created with EnforceReadOnly
+// when an Action would perform a command which may modify the dataset.
+type ReadOnlyViolationError struct {
+	// Cmd is the uppercased name of the command.
+	Cmd string
+}
+
+func (e *ReadOnlyViolationError) Error() string {
+	return "command " + e.Cmd + " is not allowed on a read-only client"
+}
+
+// readOnlyConnCmds are the commands which don't read the dataset, and so aren't
+// in readOnlyCmds, but which don't modify it either.
+var readOnlyConnCmds = map[string]bool{
+	"AUTH":     true,
+	"HELLO":    true,
+	"ECHO":     true,
+	"PING":     true,
+	"SELECT":   true,
+	"READONLY": true,
+	"ASKING":   true,
+
+	"MULTI":   true,
+	"EXEC":    true,
+	"DISCARD": true,
+	"WATCH":   true,
+	"UNWATCH": true,
+
+	"TIME":     true,
+	"INFO":     true,
+	"ROLE":     true,
+	"LASTSAVE": true,
+	"COMMAND":  true,
+}
+
+func readOnlyCheck(props Properties) error {
+	for _, cmd := range props.Commands {
+		if !readOnlyCmds[cmd] && !readOnlyConnCmds[cmd] {
+			return &ReadOnlyViolationError{Cmd: cmd}
+		}
+	}
+	return nil
+}
+
+// EnforceReadOnly wraps the given Client so that Actions which would perform a
+// command that may modify the dataset return a *ReadOnlyViolationError rather
+// than being sent. This is useful for Clients to replicas, or for jobs which
+// must never modify the data they work with.
+//
+// Commands are allowed if they're known to only read the dataset, i.e. those
+// for which a Cmd would be a ReadOnlyAction, or if they're connection and
+// server commands which don't modify it, e.g. PING, INFO or MULTI. All other
+// commands are rejected, including EVAL and EVALSHA, since scripts may modify
+// the dataset; EVAL_RO and EVALSHA_RO can be used instead.
+//
+// Actions whose commands can't be known ahead of time, such as those created
+// by WithConn, are checked as each command is written to the connection. Note
+// that marking an Action using ReadOnly doesn't exempt it from being checked.
+func EnforceReadOnly(c Client) Client {
+	return checkedClient{Client: c, check: readOnlyCheck}
+}
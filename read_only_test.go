@@ -0,0 +1,49 @@
+package radix
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+func TestEnforceReadOnly(t *T) {
+	var cmds []string
+	client := EnforceReadOnly(Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		cmds = append(cmds, args[0])
+		return "OK"
+	}))
+
+	assertViolation := func(err error, cmd string) {
+		var violationErr *ReadOnlyViolationError
+		require.True(t, errors.As(err, &violationErr), "err:%v", err)
+		assert.Equal(t, cmd, violationErr.Cmd)
+	}
+
+	require.NoError(t, client.Do(Cmd(nil, "get", "foo")))
+	require.NoError(t, client.Do(Cmd(nil, "PING")))
+	assertViolation(client.Do(Cmd(nil, "set", "foo", "bar")), "SET")
+	assertViolation(client.Do(NewEvalScript(0, "return 1").Cmd(nil)), "EVALSHA")
+	assertViolation(client.Do(Pipeline(
+		Cmd(nil, "GET", "foo"),
+		Cmd(nil, "DEL", "foo"),
+	)), "DEL")
+
+	err := client.Do(WithConn("foo", func(c Conn) error {
+		if err := c.Do(Cmd(nil, "HGETALL", "foo")); err != nil {
+			return err
+		}
+		return c.Do(Cmd(nil, "HSET", "foo", "a", "b"))
+	}))
+	assertViolation(err, "HSET")
+
+	err = client.Do(WithConn("foo", func(c Conn) error {
+		return c.Encode(resp2.Any{I: []string{"flushall"}, MarshalBulkString: true})
+	}))
+	assertViolation(err, "FLUSHALL")
+
+	assert.Equal(t, []string{"get", "PING", "HGETALL"}, cmds)
+}
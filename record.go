@@ -0,0 +1,273 @@
+package radix
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+// ErrReplayMismatch is returned from a Conn created by a Replayer when a
+// command is performed which doesn't match the next command in the recording,
+// or when there are no more commands in the recording.
+var ErrReplayMismatch = errors.New("command does not match recording")
+
+// recordings are a sequence of RESP messages which alternate between a command
+// and its reply. Replies which weren't for any command (e.g. pubsub messages)
+// are recorded with a null array in place of the command.
+var recordNoCmd = []byte("*-1\r\n")
+
+// Recorder records all commands performed on the Conns it wraps, along with
+// their replies, to an io.Writer. The recording can later be given to
+// NewReplayer in order to replay the replies against the same commands, without
+// needing a redis instance.
+//
+// Replies are recorded as the raw RESP they were received as, so a replay will
+// unmarshal identically to the original. Commands which are performed while
+// dialing (e.g. AUTH, SELECT) are not recorded when using ConnFunc, since they
+// are performed before the Conn is wrapped.
+type Recorder struct {
+	l   sync.Mutex
+	w   io.Writer
+	err error
+}
+
+// NewRecorder initializes and returns a Recorder which will write its recording
+// to the given io.Writer.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// Err returns the first error encountered while writing to the Recorder's
+// io.Writer, if any. Once an error has been encountered nothing further is
+// written.
+func (r *Recorder) Err() error {
+	r.l.Lock()
+	defer r.l.Unlock()
+	return r.err
+}
+
+func (r *Recorder) write(cmd []string, reply resp2.RawMessage) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	if r.err != nil {
+		return
+	}
+
+	if cmd == nil {
+		_, r.err = r.w.Write(recordNoCmd)
+	} else {
+		r.err = resp2.Any{I: cmd, MarshalBulkString: true}.MarshalRESP(r.w)
+	}
+	if r.err == nil {
+		_, r.err = r.w.Write(reply)
+	}
+}
+
+// Wrap returns a Conn which performs all commands on the given Conn, recording
+// them and their replies.
+func (r *Recorder) Wrap(conn Conn) Conn {
+	return &recordConn{Conn: conn, r: r}
+}
+
+// ConnFunc wraps the given ConnFunc such that all Conns it creates are
+// wrapped using Wrap.
+func (r *Recorder) ConnFunc(cf ConnFunc) ConnFunc {
+	return func(network, addr string) (Conn, error) {
+		conn, err := cf(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return r.Wrap(conn), nil
+	}
+}
+
+type recordConn struct {
+	Conn
+	r *Recorder
+
+	// l protects pending, which are the commands which have been encoded but
+	// whose replies haven't been decoded yet.
+	l       sync.Mutex
+	pending [][]string
+}
+
+func (rc *recordConn) Do(a Action) error {
+	return a.Run(rc)
+}
+
+func (rc *recordConn) Encode(m resp.Marshaler) error {
+	cmds, err := unmarshalCmds(m)
+	if err != nil {
+		return err
+	} else if err := rc.Conn.Encode(m); err != nil {
+		return err
+	}
+
+	rc.l.Lock()
+	rc.pending = append(rc.pending, cmds...)
+	rc.l.Unlock()
+	return nil
+}
+
+func (rc *recordConn) Decode(u resp.Unmarshaler) error {
+	var raw resp2.RawMessage
+	err := rc.Conn.Decode(resp2.RawCapture{Raw: &raw, I: u})
+	if len(raw) == 0 {
+		// nothing was read, probably due to a network error
+		return err
+	}
+
+	var cmd []string
+	rc.l.Lock()
+	if len(rc.pending) > 0 {
+		cmd, rc.pending = rc.pending[0], rc.pending[1:]
+	}
+	rc.l.Unlock()
+
+	rc.r.write(cmd, raw)
+	return err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type replayEntry struct {
+	cmd   []string
+	reply resp2.RawMessage
+}
+
+// Replayer replays a recording created by a Recorder. Conns created by the
+// Replayer expect the commands performed on them to match those in the
+// recording, in order, and reply to each with the recorded reply.
+//
+// All Conns created by a Replayer share the same recording, so that a
+// recording made using a Pool can be replayed using a Pool. Commands from all
+// Conns must still be performed in the same order they were recorded in,
+// however, so concurrent use of a replay is not deterministic.
+type Replayer struct {
+	l       sync.Mutex
+	entries []replayEntry
+}
+
+// NewReplayer reads a recording created by a Recorder from the given
+// io.Reader, and returns a Replayer for it.
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	br := bufio.NewReader(r)
+	rp := new(Replayer)
+	for {
+		if _, err := br.Peek(1); err == io.EOF {
+			return rp, nil
+		}
+
+		var rawCmd resp2.RawMessage
+		var entry replayEntry
+		if err := rawCmd.UnmarshalRESP(br); err != nil {
+			return nil, errors.Errorf("reading recorded command: %w", err)
+		} else if !bytes.Equal(rawCmd, recordNoCmd) {
+			if err := rawCmd.UnmarshalInto(resp2.Any{I: &entry.cmd}); err != nil {
+				return nil, errors.Errorf("unmarshaling recorded command: %w", err)
+			}
+		}
+
+		if err := entry.reply.UnmarshalRESP(br); err != nil {
+			return nil, errors.Errorf("reading recorded reply: %w", err)
+		}
+		rp.entries = append(rp.entries, entry)
+	}
+}
+
+// Remaining returns the number of recorded replies which haven't yet been
+// replayed. It is useful for asserting that a test performed all the
+// commands which were recorded.
+func (rp *Replayer) Remaining() int {
+	rp.l.Lock()
+	defer rp.l.Unlock()
+	return len(rp.entries)
+}
+
+// Conn returns a new Conn which will replay the recording.
+func (rp *Replayer) Conn() Conn {
+	return &replayConn{buffer: newBuffer("", ""), rp: rp}
+}
+
+// ConnFunc implements the ConnFunc type, and can be used to create Clients
+// which will replay the recording. The Conns returned will use the given
+// network and addr as their RemoteAddr.
+func (rp *Replayer) ConnFunc(network, addr string) (Conn, error) {
+	return &replayConn{buffer: newBuffer(network, addr), rp: rp}, nil
+}
+
+// next returns the replies for the given command, along with any replies
+// which directly follow it that weren't for any command.
+func (rp *Replayer) next(cmd []string) ([]resp2.RawMessage, error) {
+	rp.l.Lock()
+	defer rp.l.Unlock()
+
+	if len(rp.entries) == 0 {
+		return nil, errors.Errorf("no more recorded commands, got %q: %w", cmd, ErrReplayMismatch)
+	} else if exp := rp.entries[0].cmd; !cmdsEqual(exp, cmd) {
+		return nil, errors.Errorf("expected %q, got %q: %w", exp, cmd, ErrReplayMismatch)
+	}
+
+	replies := []resp2.RawMessage{rp.entries[0].reply}
+	rp.entries = rp.entries[1:]
+	for len(rp.entries) > 0 && rp.entries[0].cmd == nil {
+		replies = append(replies, rp.entries[0].reply)
+		rp.entries = rp.entries[1:]
+	}
+	return replies, nil
+}
+
+func cmdsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if i == 0 && !strings.EqualFold(a[i], b[i]) {
+			return false
+		} else if i > 0 && a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type replayConn struct {
+	*buffer
+	rp *Replayer
+}
+
+func (rc *replayConn) Do(a Action) error {
+	return a.Run(rc)
+}
+
+func (rc *replayConn) Encode(m resp.Marshaler) error {
+	cmds, err := unmarshalCmds(m)
+	if err != nil {
+		return err
+	}
+
+	for _, cmd := range cmds {
+		replies, err := rc.rp.next(cmd)
+		if err != nil {
+			return err
+		}
+		for _, reply := range replies {
+			if err := rc.buffer.Encode(reply); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (rc *replayConn) NetConn() net.Conn {
+	return rc.buffer
+}
@@ -0,0 +1,68 @@
+package radix
+
+import (
+	"bytes"
+	. "testing"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+func TestRecordReplay(t *T) {
+	buf := new(bytes.Buffer)
+	rec := NewRecorder(buf)
+	m := map[string]string{}
+	conn := rec.Wrap(Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		switch args[0] {
+		case "SET":
+			m[args[1]] = args[2]
+			return resp2.SimpleString{S: "OK"}
+		case "GET":
+			return m[args[1]]
+		case "ECHO":
+			return args[1]
+		default:
+			return resp2.Error{E: errors.New("ERR unknown command")}
+		}
+	}))
+
+	// run is performed against both the recording and the replay, and so must
+	// produce the same results for both.
+	run := func(t *T, conn Conn) {
+		require.NoError(t, conn.Do(Cmd(nil, "SET", "foo", "1")))
+
+		var foo int
+		require.NoError(t, conn.Do(Cmd(&foo, "GET", "foo")))
+		assert.Equal(t, 1, foo)
+
+		var a, b string
+		require.NoError(t, conn.Do(Pipeline(
+			Cmd(&a, "ECHO", "a"),
+			Cmd(&b, "ECHO", "b"),
+		)))
+		assert.Equal(t, "a", a)
+		assert.Equal(t, "b", b)
+
+		err := conn.Do(Cmd(nil, "INCR", "foo"))
+		assert.True(t, errors.As(err, new(resp2.Error)))
+	}
+
+	run(t, conn)
+	require.NoError(t, rec.Err())
+
+	rp, err := NewReplayer(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, 5, rp.Remaining())
+	run(t, rp.Conn())
+	assert.Zero(t, rp.Remaining())
+
+	// replaying a different command should fail
+	rp, err = NewReplayer(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	err = rp.Conn().Do(Cmd(nil, "SET", "foo", "2"))
+	assert.True(t, errors.Is(err, ErrReplayMismatch))
+}
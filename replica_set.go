@@ -0,0 +1,448 @@
+package radix
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+type replicaSetOpts struct {
+	pf                  ClientFunc
+	healthCheckInterval time.Duration
+	readYourWrites      bool
+
+	hedgePercentile float64
+	hedgeMinDelay   time.Duration
+}
+
+// ReplicaSetOpt is an optional behavior which can be applied to the
+// NewReplicaSet function to effect a ReplicaSet's behavior.
+type ReplicaSetOpt func(*replicaSetOpts)
+
+// ReplicaSetPoolFunc tells the ReplicaSet to use the given ClientFunc when
+// creating pools of connections to the primary and replicas.
+func ReplicaSetPoolFunc(pf ClientFunc) ReplicaSetOpt {
+	return func(ro *replicaSetOpts) {
+		ro.pf = pf
+	}
+}
+
+// ReplicaSetHealthCheckInterval tells the ReplicaSet to check the health of
+// each replica at the given interval, by performing a PING on it. Replicas
+// which fail the check will not have read-only Actions performed on them until
+// they pass a later check.
+//
+// Replicas whose Client could not be created are retried on each check as
+// well.
+//
+// If the interval is 0 then health checks are disabled.
+func ReplicaSetHealthCheckInterval(d time.Duration) ReplicaSetOpt {
+	return func(ro *replicaSetOpts) {
+		ro.healthCheckInterval = d
+	}
+}
+
+// ReplicaSetReadYourWrites tells the ReplicaSet to only perform a read-only
+// Action on a replica if that replica has caught up with all writes which were
+// performed through the ReplicaSet prior to the Action. If the replica chosen
+// for the Action hasn't caught up then the Action is performed on the primary
+// instead.
+//
+// This is implemented by retrieving the primary's replication offset, using
+// INFO replication, after each write, and comparing it against the replication
+// offset of replicas. Replica offsets are retrieved during health checks, and
+// again whenever a replica's last known offset is behind. This adds an
+// additional round-trip to every write, and to reads on replicas which are
+// behind.
+//
+// NOTE that writes are tracked across the whole ReplicaSet, not per
+// go-routine, and so a read may be sent to the primary due to a write it
+// wasn't concerned with.
+func ReplicaSetReadYourWrites() ReplicaSetOpt {
+	return func(ro *replicaSetOpts) {
+		ro.readYourWrites = true
+	}
+}
+
+// ReplicaSetHedgedReads tells the ReplicaSet to hedge read-only commands
+// created by Cmd or FlatCmd: if a command performed on a replica hasn't
+// completed within a delay then a duplicate of it is performed on another
+// replica, or on the primary if there are no others, and whichever completes
+// first is used. This can significantly reduce tail latency, at the cost of
+// performing some commands twice.
+//
+// The delay is the given percentile (e.g. 95) of the latencies of recent
+// commands, but no less than minDelay. Until enough commands have been
+// performed to calculate the percentile, minDelay is used. The percentile must
+// be greater than 0 and no more than 100, otherwise ReplicaSetHedgedReads
+// panics.
+func ReplicaSetHedgedReads(percentile float64, minDelay time.Duration) ReplicaSetOpt {
+	if !(percentile > 0 && percentile <= 100) {
+		panic(fmt.Sprintf("ReplicaSetHedgedReads percentile %v is not within (0, 100]", percentile))
+	}
+	return func(ro *replicaSetOpts) {
+		ro.hedgePercentile = percentile
+		ro.hedgeMinDelay = minDelay
+	}
+}
+
+// ReplicaSet is a Client for a redis primary and a set of its replicas, for
+// deployments which use replication but neither cluster nor sentinel. The
+// addresses of the primary and replicas are given manually, and are not
+// expected to change.
+//
+// Actions which are read-only (see ReadOnlyAction) will be load-balanced across
+// all healthy replicas in a round-robin fashion. All other Actions, and
+// read-only Actions when there are no healthy replicas, are performed on the
+// primary.
+//
+// NOTE that replication is asynchronous, and so read-only Actions may not
+// observe the effects of recently performed writes, unless the
+// ReplicaSetReadYourWrites option is used.
+type ReplicaSet struct {
+	// Atomic fields must be at the beginning of the struct since they must be
+	// correctly aligned or else access may cause panics on 32-bit architectures
+	// See https://golang.org/pkg/sync/atomic/#pkg-note-BUG
+	next uint64 // atomic, used for round-robin selection of replicas
+
+	// atomic, the primary's replication offset as of the last write, only
+	// used with ReplicaSetReadYourWrites.
+	writeOffset int64
+
+	ro           replicaSetOpts
+	primAddr     string
+	replicaAddrs []string
+	prim         Client
+	hedger       *hedger
+
+	// l protects replicas, healthy, and offsets, as well as closed.
+	l        sync.RWMutex
+	replicas map[string]Client
+	healthy  []string
+	offsets  map[string]int64
+	closed   bool
+
+	closeCh   chan struct{}
+	closeWG   sync.WaitGroup
+	closeOnce sync.Once
+
+	// Any errors encountered internally will be written to this channel. If
+	// nothing is reading the channel the errors will be dropped. The channel
+	// will be closed when the Close method is called.
+	ErrCh chan error
+}
+
+// NewReplicaSet initializes and returns a ReplicaSet for the given primary and
+// replica addresses. A Client is created for the primary and for each replica;
+// an error is returned if the primary's Client can't be created, but replicas
+// which can't be connected to are simply considered unhealthy.
+//
+// NewReplicaSet takes in a number of options which can overwrite its default
+// behavior. The default options NewReplicaSet uses are:
+//
+//	ReplicaSetPoolFunc(DefaultClientFunc)
+//	ReplicaSetHealthCheckInterval(5 * time.Second)
+//
+func NewReplicaSet(primaryAddr string, replicaAddrs []string, opts ...ReplicaSetOpt) (*ReplicaSet, error) {
+	rs := &ReplicaSet{
+		primAddr:     primaryAddr,
+		replicaAddrs: replicaAddrs,
+		replicas:     make(map[string]Client, len(replicaAddrs)),
+		offsets:      make(map[string]int64, len(replicaAddrs)),
+		closeCh:      make(chan struct{}),
+		ErrCh:        make(chan error, 1),
+	}
+
+	defaultReplicaSetOpts := []ReplicaSetOpt{
+		ReplicaSetPoolFunc(DefaultClientFunc),
+		ReplicaSetHealthCheckInterval(5 * time.Second),
+	}
+
+	for _, opt := range append(defaultReplicaSetOpts, opts...) {
+		if opt != nil {
+			opt(&(rs.ro))
+		}
+	}
+
+	if rs.ro.hedgePercentile > 0 {
+		rs.hedger = newHedger(rs.ro.hedgePercentile, rs.ro.hedgeMinDelay)
+	}
+
+	var err error
+	if rs.prim, err = rs.ro.pf("tcp", primaryAddr); err != nil {
+		return nil, err
+	}
+
+	rs.healthCheck()
+
+	if rs.ro.healthCheckInterval > 0 {
+		rs.closeWG.Add(1)
+		go rs.healthCheckEvery(rs.ro.healthCheckInterval)
+	}
+
+	return rs, nil
+}
+
+// err may be called from the go-routines of Do and DoPrimary, and so it must
+// not write to ErrCh once Close has begun, since ErrCh may have been closed.
+func (rs *ReplicaSet) err(err error) {
+	rs.l.RLock()
+	defer rs.l.RUnlock()
+	if rs.closed {
+		return
+	}
+	select {
+	case rs.ErrCh <- err:
+	default:
+	}
+}
+
+func (rs *ReplicaSet) isClosed() bool {
+	rs.l.RLock()
+	defer rs.l.RUnlock()
+	return rs.closed
+}
+
+func (rs *ReplicaSet) healthCheckEvery(d time.Duration) {
+	defer rs.closeWG.Done()
+	t := time.NewTicker(d)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			rs.healthCheck()
+		case <-rs.closeCh:
+			return
+		}
+	}
+}
+
+// healthCheck creates any replica Clients which don't yet exist, PINGs all
+// replicas, and updates the set of healthy replicas accordingly.
+func (rs *ReplicaSet) healthCheck() {
+	healthy := make([]string, 0, len(rs.replicaAddrs))
+	for _, addr := range rs.replicaAddrs {
+		rs.l.RLock()
+		client := rs.replicas[addr]
+		rs.l.RUnlock()
+
+		if client == nil {
+			var err error
+			if client, err = rs.ro.pf("tcp", addr); err != nil {
+				rs.err(errors.Errorf("error connecting to replica %s: %w", addr, err))
+				continue
+			}
+
+			rs.l.Lock()
+			if rs.closed {
+				rs.l.Unlock()
+				client.Close()
+				return
+			}
+			rs.replicas[addr] = client
+			rs.l.Unlock()
+		}
+
+		if err := client.Do(Cmd(nil, "PING")); err != nil {
+			rs.err(errors.Errorf("replica %s failed health check: %w", addr, err))
+			continue
+		}
+		healthy = append(healthy, addr)
+
+		if rs.ro.readYourWrites {
+			rs.refreshOffset(addr, client)
+		}
+	}
+
+	rs.l.Lock()
+	rs.healthy = healthy
+	rs.l.Unlock()
+}
+
+// replOffset returns the replication offset found in the output of INFO
+// replication on the given Client, using the given field.
+func replOffset(client Client, field string) (int64, error) {
+	var info string
+	if err := client.Do(Cmd(&info, "INFO", "replication")); err != nil {
+		return 0, err
+	}
+
+	prefix := field + ":"
+	sc := bufio.NewScanner(strings.NewReader(info))
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); strings.HasPrefix(line, prefix) {
+			return strconv.ParseInt(line[len(prefix):], 10, 64)
+		}
+	}
+	return 0, errors.Errorf("field %q not found in INFO replication", field)
+}
+
+// refreshOffset retrieves and stores the replication offset of the replica at
+// the given address, and returns it.
+func (rs *ReplicaSet) refreshOffset(addr string, client Client) int64 {
+	offset, err := replOffset(client, "slave_repl_offset")
+	if err != nil {
+		rs.err(errors.Errorf("error retrieving replication offset of replica %s: %w", addr, err))
+		return -1
+	}
+
+	rs.l.Lock()
+	defer rs.l.Unlock()
+	if offset > rs.offsets[addr] {
+		rs.offsets[addr] = offset
+	}
+	return rs.offsets[addr]
+}
+
+// trackWrite retrieves and stores the primary's replication offset, which
+// replicas must reach before reads can be performed on them.
+func (rs *ReplicaSet) trackWrite() {
+	offset, err := replOffset(rs.prim, "master_repl_offset")
+	if err != nil {
+		rs.err(errors.Errorf("error retrieving replication offset of primary: %w", err))
+		return
+	}
+	for {
+		curr := atomic.LoadInt64(&rs.writeOffset)
+		if offset <= curr || atomic.CompareAndSwapInt64(&rs.writeOffset, curr, offset) {
+			return
+		}
+	}
+}
+
+// replica returns the address and Client of the next healthy replica which
+// reads can be performed on, or a nil Client if there isn't one.
+func (rs *ReplicaSet) replica() (string, Client) {
+	rs.l.RLock()
+	if len(rs.healthy) == 0 {
+		rs.l.RUnlock()
+		return "", nil
+	}
+	i := atomic.AddUint64(&rs.next, 1) % uint64(len(rs.healthy))
+	addr := rs.healthy[i]
+	client, offset := rs.replicas[addr], rs.offsets[addr]
+	rs.l.RUnlock()
+
+	if !rs.ro.readYourWrites {
+		return addr, client
+	}
+
+	writeOffset := atomic.LoadInt64(&rs.writeOffset)
+	if offset < writeOffset {
+		offset = rs.refreshOffset(addr, client)
+	}
+	if offset < writeOffset {
+		return "", nil
+	}
+	return addr, client
+}
+
+// Do implements the method for the Client interface. If the Action is
+// read-only it will be performed on a healthy replica, otherwise it will be
+// performed on the primary.
+func (rs *ReplicaSet) Do(a Action) error {
+	if rs.isClosed() {
+		return ErrClientClosed
+	}
+
+	readOnly := isReadOnly(a)
+	if readOnly {
+		if addr, client := rs.replica(); client == nil {
+			// fallthrough to the primary
+		} else if cmd, ok := a.(*cmdAction); ok && rs.hedger != nil {
+			// Clients are compared by address, since the Client interface's
+			// implementations aren't necessarily comparable.
+			secondAddr, second := rs.replica()
+			if second == nil || secondAddr == addr {
+				second = rs.prim
+			}
+			return rs.hedger.do(cmd, client, second)
+		} else {
+			return client.Do(a)
+		}
+	}
+
+	err := rs.prim.Do(a)
+	if !readOnly && rs.ro.readYourWrites {
+		// the write may have been applied even if there was an error
+		rs.trackWrite()
+	}
+	return err
+}
+
+// DoPrimary is like Do but always performs the Action on the primary, even if
+// it is read-only. This can be used when a read must observe the effects of
+// previous writes.
+func (rs *ReplicaSet) DoPrimary(a Action) error {
+	if rs.isClosed() {
+		return ErrClientClosed
+	}
+
+	// isReadOnly must be called before Do, since a cmdAction is returned to
+	// its pool once it's been performed.
+	readOnly := isReadOnly(a)
+	err := rs.prim.Do(a)
+	if rs.ro.readYourWrites && !readOnly {
+		rs.trackWrite()
+	}
+	return err
+}
+
+// Addrs returns the address of the primary and the addresses of the replicas
+// which are currently considered healthy.
+func (rs *ReplicaSet) Addrs() (string, []string) {
+	rs.l.RLock()
+	defer rs.l.RUnlock()
+	healthy := make([]string, len(rs.healthy))
+	copy(healthy, rs.healthy)
+	return rs.primAddr, healthy
+}
+
+// Client returns a Client for the given address, which could be either the
+// primary or one of the replicas.
+//
+// NOTE the Client should _not_ be closed.
+func (rs *ReplicaSet) Client(addr string) (Client, error) {
+	if addr == rs.primAddr {
+		return rs.prim, nil
+	}
+	rs.l.RLock()
+	defer rs.l.RUnlock()
+	if client := rs.replicas[addr]; client != nil {
+		return client, nil
+	}
+	return nil, errUnknownAddress
+}
+
+// Close implements the method for the Client interface.
+func (rs *ReplicaSet) Close() error {
+	closeErr := ErrClientClosed
+	rs.closeOnce.Do(func() {
+		// closed is set first so that nothing writes to ErrCh once it's
+		// closed, see err.
+		rs.l.Lock()
+		rs.closed = true
+		rs.l.Unlock()
+
+		close(rs.closeCh)
+		rs.closeWG.Wait()
+		close(rs.ErrCh)
+
+		rs.l.Lock()
+		defer rs.l.Unlock()
+		closeErr = rs.prim.Close()
+		for _, client := range rs.replicas {
+			if err := client.Close(); closeErr == nil && err != nil {
+				closeErr = err
+			}
+		}
+	})
+	return closeErr
+}
@@ -0,0 +1,246 @@
+package radix
+
+import (
+	"strconv"
+	"sync"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+)
+
+// replicaSetStub returns a ClientFunc which creates Stubs which record, per
+// address, which commands they've received. Addresses in downAddrs will fail
+// all commands.
+func replicaSetStub(downAddrs ...string) (ClientFunc, func(string) []string) {
+	var l sync.Mutex
+	cmds := map[string][]string{}
+	pf := func(network, addr string) (Client, error) {
+		return Stub(network, addr, func(args []string) interface{} {
+			for _, downAddr := range downAddrs {
+				if addr == downAddr {
+					return errors.New("connection refused")
+				}
+			}
+			l.Lock()
+			defer l.Unlock()
+			cmds[addr] = append(cmds[addr], args[0])
+			return "OK"
+		}), nil
+	}
+	get := func(addr string) []string {
+		l.Lock()
+		defer l.Unlock()
+		return cmds[addr]
+	}
+	return pf, get
+}
+
+func TestReplicaSet(t *T) {
+	pf, cmds := replicaSetStub("replica3:6379")
+	rs, err := NewReplicaSet("primary:6379",
+		[]string{"replica1:6379", "replica2:6379", "replica3:6379"},
+		ReplicaSetPoolFunc(pf),
+		ReplicaSetHealthCheckInterval(0),
+	)
+	require.NoError(t, err)
+	defer rs.Close()
+
+	primAddr, healthy := rs.Addrs()
+	assert.Equal(t, "primary:6379", primAddr)
+	assert.ElementsMatch(t, []string{"replica1:6379", "replica2:6379"}, healthy)
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, rs.Do(Cmd(nil, "GET", "foo")))
+	}
+	require.NoError(t, rs.Do(Cmd(nil, "SET", "foo", "bar")))
+	require.NoError(t, rs.Do(Cmd(nil, "GET", "foo")))
+	require.NoError(t, rs.Do(ReadOnly(WithConn("foo", func(c Conn) error {
+		return c.Do(Cmd(nil, "EVAL", "return 1", "0"))
+	}))))
+	require.NoError(t, rs.DoPrimary(Cmd(nil, "GET", "foo")))
+
+	assert.Equal(t, []string{"SET", "GET"}, cmds("primary:6379"))
+	// reads should be evenly spread across the healthy replicas
+	replica1Cmds, replica2Cmds := cmds("replica1:6379"), cmds("replica2:6379")
+	assert.Len(t, replica1Cmds, 4)
+	assert.Len(t, replica2Cmds, 4)
+	assert.ElementsMatch(t,
+		[]string{"PING", "PING", "GET", "GET", "GET", "GET", "GET", "EVAL"},
+		append(replica1Cmds, replica2Cmds...),
+	)
+	assert.Empty(t, cmds("replica3:6379"))
+}
+
+func TestReplicaSetNoHealthyReplicas(t *T) {
+	pf, cmds := replicaSetStub("replica1:6379")
+	rs, err := NewReplicaSet("primary:6379", []string{"replica1:6379"},
+		ReplicaSetPoolFunc(pf),
+		ReplicaSetHealthCheckInterval(0),
+	)
+	require.NoError(t, err)
+	defer rs.Close()
+
+	require.NoError(t, rs.Do(Cmd(nil, "GET", "foo")))
+	assert.Equal(t, []string{"GET"}, cmds("primary:6379"))
+}
+
+func TestReplicaSetReadYourWrites(t *T) {
+	var l sync.Mutex
+	offsets := map[string]int{}
+	reads := map[string]int{}
+	pf := func(network, addr string) (Client, error) {
+		return Stub(network, addr, func(args []string) interface{} {
+			l.Lock()
+			defer l.Unlock()
+			switch args[0] {
+			case "SET":
+				offsets[addr] += 10
+			case "GET":
+				reads[addr]++
+			case "INFO":
+				field := "slave_repl_offset"
+				if addr == "primary:6379" {
+					field = "master_repl_offset"
+				}
+				return "# Replication\r\nrole:x\r\n" + field + ":" + strconv.Itoa(offsets[addr]) + "\r\n"
+			}
+			return "OK"
+		}), nil
+	}
+	setOffset := func(addr string, offset int) {
+		l.Lock()
+		defer l.Unlock()
+		offsets[addr] = offset
+	}
+	getReads := func(addr string) int {
+		l.Lock()
+		defer l.Unlock()
+		n := reads[addr]
+		reads[addr] = 0
+		return n
+	}
+
+	rs, err := NewReplicaSet("primary:6379", []string{"replica:6379"},
+		ReplicaSetPoolFunc(pf),
+		ReplicaSetHealthCheckInterval(0),
+		ReplicaSetReadYourWrites(),
+	)
+	require.NoError(t, err)
+	defer rs.Close()
+
+	// no writes yet, replica is fine
+	require.NoError(t, rs.Do(Cmd(nil, "GET", "foo")))
+	assert.Equal(t, 1, getReads("replica:6379"))
+
+	// after a write the replica is behind, so the primary is used
+	require.NoError(t, rs.Do(Cmd(nil, "SET", "foo", "bar")))
+	require.NoError(t, rs.Do(Cmd(nil, "GET", "foo")))
+	assert.Equal(t, 0, getReads("replica:6379"))
+	assert.Equal(t, 1, getReads("primary:6379"))
+
+	// once the replica catches up it's used again
+	setOffset("replica:6379", 10)
+	require.NoError(t, rs.Do(Cmd(nil, "GET", "foo")))
+	assert.Equal(t, 1, getReads("replica:6379"))
+	assert.Equal(t, 0, getReads("primary:6379"))
+}
+
+func TestReplicaSetClose(t *T) {
+	pf := func(network, addr string) (Client, error) {
+		return Stub(network, addr, func(args []string) interface{} {
+			if args[0] == "INFO" {
+				return errors.New("INFO failed")
+			}
+			return "OK"
+		}), nil
+	}
+	rs, err := NewReplicaSet("primary:6379", []string{"replica:6379"},
+		ReplicaSetPoolFunc(pf),
+		ReplicaSetHealthCheckInterval(0),
+		ReplicaSetReadYourWrites(),
+	)
+	require.NoError(t, err)
+
+	// every write fails to retrieve the primary's replication offset, which
+	// mustn't cause a panic when it happens concurrently with Close.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rs.Do(Cmd(nil, "SET", "foo", "bar")) == nil {
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, rs.Close())
+	wg.Wait()
+
+	assert.Equal(t, ErrClientClosed, rs.Do(Cmd(nil, "SET", "foo", "bar")))
+	assert.Equal(t, ErrClientClosed, rs.DoPrimary(Cmd(nil, "SET", "foo", "bar")))
+	assert.Equal(t, ErrClientClosed, rs.Close())
+}
+
+func TestReplicaSetHedgedReads(t *T) {
+	pf := func(network, addr string) (Client, error) {
+		return Stub(network, addr, func(args []string) interface{} {
+			if args[0] == "GET" && addr == "slow:6379" {
+				time.Sleep(500 * time.Millisecond)
+			}
+			return addr
+		}), nil
+	}
+
+	rs, err := NewReplicaSet("primary:6379", []string{"slow:6379", "fast:6379"},
+		ReplicaSetPoolFunc(pf),
+		ReplicaSetHealthCheckInterval(0),
+		ReplicaSetHedgedReads(95, 10*time.Millisecond),
+	)
+	require.NoError(t, err)
+	defer rs.Close()
+
+	for i := 0; i < 4; i++ {
+		start := time.Now()
+		var res string
+		require.NoError(t, rs.Do(Cmd(&res, "GET", "foo")))
+		assert.Equal(t, "fast:6379", res)
+		assert.True(t, time.Since(start) < 250*time.Millisecond)
+	}
+
+	// the Clients returned by a ClientFunc needn't be comparable
+	type uncomparableClient struct {
+		Client
+		_ []int
+	}
+	ucpf := func(network, addr string) (Client, error) {
+		client, err := pf(network, addr)
+		return uncomparableClient{Client: client}, err
+	}
+	rs2, err := NewReplicaSet("primary:6379", []string{"fast:6379"},
+		ReplicaSetPoolFunc(ucpf),
+		ReplicaSetHealthCheckInterval(0),
+		ReplicaSetHedgedReads(95, 10*time.Millisecond),
+	)
+	require.NoError(t, err)
+	defer rs2.Close()
+	var res string
+	require.NoError(t, rs2.Do(Cmd(&res, "GET", "foo")))
+	assert.Equal(t, "fast:6379", res)
+
+	for _, percentile := range []float64{-1, 0, 100.5} {
+		assert.Panics(t, func() { ReplicaSetHedgedReads(percentile, 0) }, percentile)
+	}
+	assert.NotPanics(t, func() { ReplicaSetHedgedReads(100, 0) })
+}
+
+func TestHedgerDelay(t *T) {
+	h := newHedger(90, 5*time.Millisecond)
+	assert.Equal(t, 5*time.Millisecond, h.getDelay())
+	for i := 1; i <= hedgeRecalcEvery; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+	assert.Equal(t, 90*time.Millisecond, h.getDelay())
+}
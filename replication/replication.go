@@ -0,0 +1,426 @@
+// Package replication implements the replica side of redis' replication
+// protocol, allowing a program to receive the stream of write commands
+// performed on a redis instance as they happen. This is useful for building
+// change-data-capture, auditing and cache-warming tools.
+//
+// The replication stream is read from a radix.Conn, which should have been
+// created using radix.Dial (with any necessary AUTH performed by a DialOpt),
+// and which is consumed by Run. The server sees the Conn as a replica, and will
+// include it in the output of INFO replication.
+package replication
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+// Command is a single write command received on the replication stream.
+type Command struct {
+	// Args is the command and its arguments, e.g. ["SET", "foo", "bar"].
+	Args []string
+
+	// DB is the database the command was performed on.
+	DB int
+
+	// Offset is the replication offset once the command has been processed.
+	// It can be given as Opts.Offset, alongside the replication ID, to resume
+	// the stream after the command.
+	Offset int64
+}
+
+// Sync describes the start of the replication stream, as negotiated with the
+// server using PSYNC.
+type Sync struct {
+	// ReplID is the replication ID of the server.
+	ReplID string
+
+	// Offset is the replication offset at which the stream starts.
+	Offset int64
+
+	// Full is true if the server performed a full resync, in which case an RDB
+	// snapshot of the dataset precedes the stream. Otherwise the stream is a
+	// continuation of the one which left off at the ReplID and Offset given in
+	// Opts.
+	Full bool
+}
+
+// Opts are the options which may be given to Run. OnCommand is required.
+type Opts struct {
+	// ReplID and Offset are the position in the replication stream to resume
+	// from, as given by a previous Sync or Command. If ReplID is empty, or the
+	// server can no longer continue from the position, a full resync is
+	// performed.
+	ReplID string
+	Offset int64
+
+	// ListeningPort, if set, is reported to the server using REPLCONF
+	// listening-port, and will be shown as the replica's port in INFO
+	// replication.
+	ListeningPort int
+
+	// AckInterval is how often the replication offset is acknowledged to the
+	// server using REPLCONF ACK. Defaults to 1 second.
+	AckInterval time.Duration
+
+	// OnSync, if set, is called once the server has replied to PSYNC.
+	OnSync func(Sync) error
+
+	// OnRDB, if set, is called during a full resync with a Reader over the
+	// RDB snapshot the server sends, which it must read until io.EOF. If not
+	// set the snapshot is discarded.
+	OnRDB func(io.Reader) error
+
+	// OnCommand is called for each write command received on the replication
+	// stream. SELECT commands, PINGs and replication control commands are
+	// handled internally, and aren't passed to OnCommand.
+	OnCommand func(Command) error
+}
+
+// conn wraps the net.Conn, synchronizing writes between the reading and
+// acknowledging go-routines.
+type conn struct {
+	nc net.Conn
+	br *bufio.Reader
+
+	wl sync.Mutex
+}
+
+func (c *conn) write(args ...string) error {
+	c.wl.Lock()
+	defer c.wl.Unlock()
+	return radix.Cmd(nil, args[0], args[1:]...).MarshalRESP(c.nc)
+}
+
+func (c *conn) readLine() (string, error) {
+	line, err := c.br.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readReply reads a simple string reply, returning an error for an error
+// reply.
+func (c *conn) readReply() (string, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return "", err
+	} else if len(line) == 0 {
+		return "", errors.New("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return "", resp2.Error{E: errors.New(line[1:])}
+	default:
+		return "", errors.Errorf("unexpected reply %q", line)
+	}
+}
+
+// Run performs PSYNC on the given Conn and consumes the replication stream,
+// calling the callbacks given in Opts. It blocks until the Context is
+// canceled, an error is encountered, or a callback returns an error, and then
+// closes the Conn and returns the error.
+//
+// The Conn must not have been used for anything except connecting and
+// authenticating, as Run reads from its underlying net.Conn directly.
+func Run(ctx context.Context, rc radix.Conn, opts Opts) error {
+	if opts.OnCommand == nil {
+		return errors.New("OnCommand must be set")
+	}
+	if opts.AckInterval <= 0 {
+		opts.AckInterval = time.Second
+	}
+
+	c := &conn{nc: rc.NetConn(), br: bufio.NewReader(rc.NetConn())}
+	defer rc.Close()
+
+	// closing the Conn when the Context is canceled unblocks any reads, in
+	// which case the Context's error is returned instead of the read error.
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	go func() {
+		select {
+		case <-ctx.Done():
+			rc.Close()
+		case <-doneCh:
+		}
+	}()
+
+	err := run(c, opts)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+func run(c *conn, opts Opts) error {
+	if opts.ListeningPort > 0 {
+		if err := c.replconf("listening-port", strconv.Itoa(opts.ListeningPort)); err != nil {
+			return err
+		}
+	}
+	if err := c.replconf("capa", "eof", "capa", "psync2"); err != nil {
+		return err
+	}
+
+	ps, err := c.psync(opts.ReplID, opts.Offset)
+	if err != nil {
+		return err
+	} else if opts.OnSync != nil {
+		if err := opts.OnSync(ps); err != nil {
+			return err
+		}
+	}
+
+	if ps.Full {
+		onRDB := opts.OnRDB
+		if onRDB == nil {
+			onRDB = func(r io.Reader) error {
+				_, err := io.Copy(ioutil.Discard, r)
+				return err
+			}
+		}
+		if err := c.readRDB(onRDB); err != nil {
+			return err
+		}
+	}
+
+	s := &stream{conn: c, offset: ps.Offset}
+	ackDoneCh := make(chan struct{})
+	defer close(ackDoneCh)
+	go s.ackEvery(opts.AckInterval, ackDoneCh)
+	return s.read(opts.OnCommand)
+}
+
+func (c *conn) replconf(args ...string) error {
+	if err := c.write(append([]string{"REPLCONF"}, args...)...); err != nil {
+		return err
+	}
+	_, err := c.readReply()
+	return err
+}
+
+func (c *conn) psync(replID string, offset int64) (Sync, error) {
+	// PSYNC takes the offset of the next byte wanted, rather than the offset
+	// processed so far.
+	psyncID, psyncOffset := replID, strconv.FormatInt(offset+1, 10)
+	if replID == "" {
+		psyncID, psyncOffset = "?", "-1"
+	}
+	if err := c.write("PSYNC", psyncID, psyncOffset); err != nil {
+		return Sync{}, err
+	}
+
+	// the server may send newlines to keep the connection alive while it
+	// prepares its reply.
+	var reply string
+	for reply == "" {
+		line, err := c.readLine()
+		if err != nil {
+			return Sync{}, err
+		} else if line == "" {
+			continue
+		} else if line[0] == '-' {
+			return Sync{}, resp2.Error{E: errors.New(line[1:])}
+		} else if line[0] != '+' {
+			return Sync{}, errors.Errorf("unexpected reply to PSYNC %q", line)
+		}
+		reply = line[1:]
+	}
+
+	fields := strings.Fields(reply)
+	switch {
+	case len(fields) == 3 && fields[0] == "FULLRESYNC":
+		syncOffset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return Sync{}, errors.Errorf("malformed reply to PSYNC %q", reply)
+		}
+		return Sync{ReplID: fields[1], Offset: syncOffset, Full: true}, nil
+	case len(fields) > 0 && fields[0] == "CONTINUE":
+		// the server may have changed its replication ID, e.g. after a
+		// failover, in which case it gives the new one.
+		if len(fields) > 1 {
+			replID = fields[1]
+		}
+		return Sync{ReplID: replID, Offset: offset}, nil
+	default:
+		return Sync{}, errors.Errorf("unexpected reply to PSYNC %q", reply)
+	}
+}
+
+// readRDB reads the RDB snapshot sent by the server during a full resync. It is
+// sent either as a bulk string of known length, without the trailing CRLF, or
+// (for diskless replication) as "$EOF:<mark>" followed by the snapshot, which
+// ends with the 40 byte mark.
+func (c *conn) readRDB(fn func(io.Reader) error) error {
+	var header string
+	for header == "" {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		header = line
+	}
+	if header[0] != '$' {
+		return errors.Errorf("unexpected RDB header %q", header)
+	}
+
+	var r io.Reader
+	if strings.HasPrefix(header, "$EOF:") {
+		r = &eofMarkReader{br: c.br, mark: []byte(header[len("$EOF:"):])}
+	} else if size, err := strconv.ParseInt(header[1:], 10, 64); err != nil {
+		return errors.Errorf("malformed RDB header %q", header)
+	} else {
+		r = io.LimitReader(c.br, size)
+	}
+
+	if err := fn(r); err != nil {
+		return err
+	}
+	// make sure the whole snapshot is consumed, even if fn didn't read all of
+	// it, so that the stream which follows can be read.
+	_, err := io.Copy(ioutil.Discard, r)
+	return err
+}
+
+// eofMarkReader reads from br until the given mark is encountered, without
+// returning the mark itself.
+type eofMarkReader struct {
+	br     *bufio.Reader
+	mark   []byte
+	window []byte
+	done   bool
+}
+
+func (r *eofMarkReader) Read(p []byte) (int, error) {
+	if r.window == nil {
+		r.window = make([]byte, 0, len(r.mark))
+	}
+
+	var n int
+	for n < len(p) && !r.done {
+		b, err := r.br.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		r.window = append(r.window, b)
+		if len(r.window) < len(r.mark) {
+			continue
+		} else if bytes.Equal(r.window, r.mark) {
+			r.done = true
+			break
+		}
+		p[n] = r.window[0]
+		n++
+		copy(r.window, r.window[1:])
+		r.window = r.window[:len(r.window)-1]
+	}
+
+	if n == 0 && r.done {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	br *bufio.Reader
+	n  int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.br.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+type stream struct {
+	*conn
+	offset int64 // atomic
+	db     int
+}
+
+func (s *stream) ack() error {
+	return s.write("REPLCONF", "ACK", strconv.FormatInt(atomic.LoadInt64(&s.offset), 10))
+}
+
+func (s *stream) ackEvery(d time.Duration, doneCh <-chan struct{}) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// if this fails then so will reading, which will stop the stream.
+			_ = s.ack()
+		case <-doneCh:
+			return
+		}
+	}
+}
+
+func (s *stream) read(onCommand func(Command) error) error {
+	// the bytes of each command are counted so that the offset is kept in
+	// sync with the server's. Unmarshaling requires a bufio.Reader, so the
+	// bytes consumed are those read from the conn's bufio.Reader less those
+	// still buffered.
+	cr := &countingReader{br: s.br}
+	br := bufio.NewReader(cr)
+	for {
+		var args []string
+		startN := cr.n - int64(br.Buffered())
+		if err := (resp2.Any{I: &args}).UnmarshalRESP(br); err != nil {
+			return err
+		}
+		size := cr.n - int64(br.Buffered()) - startN
+
+		if err := s.handle(args, size, onCommand); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *stream) handle(args []string, size int64, onCommand func(Command) error) error {
+	if len(args) == 0 {
+		return nil
+	}
+
+	cmd := strings.ToUpper(args[0])
+	switch {
+	case cmd == "REPLCONF" && len(args) > 1 && strings.EqualFold(args[1], "GETACK"):
+		// the server expects the offset not to include the GETACK itself.
+		err := s.ack()
+		atomic.AddInt64(&s.offset, size)
+		return err
+	case cmd == "PING" || cmd == "REPLCONF":
+		atomic.AddInt64(&s.offset, size)
+		return nil
+	case cmd == "SELECT" && len(args) > 1:
+		db, err := strconv.Atoi(args[1])
+		if err != nil {
+			return errors.Errorf("malformed SELECT %q", args)
+		}
+		s.db = db
+		atomic.AddInt64(&s.offset, size)
+		return nil
+	}
+
+	offset := atomic.AddInt64(&s.offset, size)
+	return onCommand(Command{Args: args, DB: s.db, Offset: offset})
+}
@@ -0,0 +1,173 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mediocregopher/radix/v3"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+// fakeServer reads commands sent by the replica on the given net.Conn, passing
+// them to cmdCh, and writes whatever is sent on writeCh.
+func fakeServer(t *T, nc net.Conn) (<-chan []string, chan<- string) {
+	cmdCh, writeCh := make(chan []string, 16), make(chan string)
+	go func() {
+		br := bufio.NewReader(nc)
+		for {
+			var args []string
+			if err := (resp2.Any{I: &args}).UnmarshalRESP(br); err != nil {
+				close(cmdCh)
+				return
+			}
+			cmdCh <- args
+		}
+	}()
+	go func() {
+		for s := range writeCh {
+			if _, err := io.WriteString(nc, s); err != nil {
+				return
+			}
+		}
+	}()
+	return cmdCh, writeCh
+}
+
+func cmdStr(args ...string) string {
+	var sb strings.Builder
+	_ = radix.Cmd(nil, args[0], args[1:]...).MarshalRESP(&sb)
+	return sb.String()
+}
+
+func TestRun(t *T) {
+	const mark = "0123456789012345678901234567890123456789"
+	type test struct {
+		descr   string
+		opts    Opts
+		psync   []string
+		reply   string
+		rdb     string
+		expSync Sync
+		expRDB  string
+	}
+
+	tests := []test{
+		{
+			descr:   "full sized",
+			psync:   []string{"PSYNC", "?", "-1"},
+			reply:   "\n+FULLRESYNC abc 100\r\n",
+			rdb:     "$7\r\nREDIS00",
+			expSync: Sync{ReplID: "abc", Offset: 100, Full: true},
+			expRDB:  "REDIS00",
+		},
+		{
+			descr:   "full diskless",
+			psync:   []string{"PSYNC", "?", "-1"},
+			reply:   "+FULLRESYNC abc 100\r\n",
+			rdb:     "\n$EOF:" + mark + "\r\nREDIS00" + mark,
+			expSync: Sync{ReplID: "abc", Offset: 100, Full: true},
+			expRDB:  "REDIS00",
+		},
+		{
+			descr:   "continue",
+			opts:    Opts{ReplID: "abc", Offset: 100},
+			psync:   []string{"PSYNC", "abc", "101"},
+			reply:   "+CONTINUE def\r\n",
+			expSync: Sync{ReplID: "def", Offset: 100},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.descr, func(t *T) {
+			clientNC, serverNC := net.Pipe()
+			cmdCh, writeCh := fakeServer(t, serverNC)
+			defer serverNC.Close()
+
+			var gotSync Sync
+			var gotRDB string
+			commandCh := make(chan Command)
+			opts := test.opts
+			opts.AckInterval = time.Hour
+			opts.OnSync = func(s Sync) error {
+				gotSync = s
+				return nil
+			}
+			opts.OnRDB = func(r io.Reader) error {
+				b, err := ioutil.ReadAll(r)
+				gotRDB = string(b)
+				return err
+			}
+			opts.OnCommand = func(cmd Command) error {
+				commandCh <- cmd
+				return nil
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			errCh := make(chan error, 1)
+			go func() { errCh <- Run(ctx, radix.NewConn(clientNC), opts) }()
+
+			assert.Equal(t, []string{"REPLCONF", "capa", "eof", "capa", "psync2"}, <-cmdCh)
+			writeCh <- "+OK\r\n"
+			assert.Equal(t, test.psync, <-cmdCh)
+			writeCh <- test.reply + test.rdb
+
+			set := cmdStr("SET", "foo", "bar")
+			writeCh <- cmdStr("PING") + cmdStr("SELECT", "2") + set
+			assert.Equal(t, Command{
+				Args:   []string{"SET", "foo", "bar"},
+				DB:     2,
+				Offset: 100 + int64(len(cmdStr("PING")+cmdStr("SELECT", "2")+set)),
+			}, <-commandCh)
+
+			getAck := cmdStr("REPLCONF", "GETACK", "*")
+			writeCh <- getAck
+			ackOffset := 100 + int64(len(cmdStr("PING")+cmdStr("SELECT", "2")+set))
+			assert.Equal(t, []string{"REPLCONF", "ACK", strconv.FormatInt(ackOffset, 10)}, <-cmdCh)
+
+			writeCh <- cmdStr("DEL", "foo")
+			assert.Equal(t, Command{
+				Args:   []string{"DEL", "foo"},
+				DB:     2,
+				Offset: ackOffset + int64(len(getAck)+len(cmdStr("DEL", "foo"))),
+			}, <-commandCh)
+
+			assert.Equal(t, test.expSync, gotSync)
+			assert.Equal(t, test.expRDB, gotRDB)
+
+			cancel()
+			assert.Equal(t, context.Canceled, <-errCh)
+		})
+	}
+}
+
+func TestRunPSyncErr(t *T) {
+	clientNC, serverNC := net.Pipe()
+	cmdCh, writeCh := fakeServer(t, serverNC)
+	defer serverNC.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Run(context.Background(), radix.NewConn(clientNC), Opts{
+			OnCommand: func(Command) error { return nil },
+		})
+	}()
+
+	<-cmdCh
+	writeCh <- "+OK\r\n"
+	<-cmdCh
+	writeCh <- "-NOPERM this user has no permissions\r\n"
+	err := <-errCh
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "NOPERM")
+}
@@ -0,0 +1,331 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"strconv"
+
+	errors "golang.org/x/xerrors"
+)
+
+// This file contains decoders for the compact encodings redis uses for small
+// collections, which are serialized in RDB as a single string.
+
+func int24(b []byte) int64 {
+	return int64(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8)
+}
+
+// ziplistEntries decodes the entries of a ziplist, which is laid out as:
+//
+//	<zlbytes uint32> <zltail uint32> <zllen uint16> <entry>... <0xff>
+//
+// with each entry being:
+//
+//	<prevlen> <encoding> <data>
+func ziplistEntries(b []byte) ([]string, error) {
+	if len(b) < 11 {
+		return nil, errors.New("ziplist is too short")
+	}
+	d := &decoder{b: b, i: 10}
+
+	var entries []string
+	for {
+		prevLen, err := d.byte()
+		if err != nil {
+			return nil, err
+		} else if prevLen == 0xff {
+			break
+		} else if prevLen == 0xfe {
+			if _, err := d.next(4); err != nil {
+				return nil, err
+			}
+		}
+
+		enc, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+
+		var strLen int
+		switch enc >> 6 {
+		case 0:
+			strLen = int(enc & 0x3f)
+		case 1:
+			b2, err := d.byte()
+			if err != nil {
+				return nil, err
+			}
+			strLen = int(enc&0x3f)<<8 | int(b2)
+		case 2:
+			bb, err := d.next(4)
+			if err != nil {
+				return nil, err
+			}
+			strLen = int(binary.BigEndian.Uint32(bb))
+		default:
+			i, err := d.ziplistInt(enc)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, strconv.FormatInt(i, 10))
+			continue
+		}
+
+		s, err := d.next(strLen)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, string(s))
+	}
+	return entries, nil
+}
+
+func (d *decoder) ziplistInt(enc byte) (int64, error) {
+	var size int
+	switch enc {
+	case 0xc0:
+		size = 2
+	case 0xd0:
+		size = 4
+	case 0xe0:
+		size = 8
+	case 0xf0:
+		size = 3
+	case 0xfe:
+		size = 1
+	default:
+		// 4 bit immediate integers, 0001 to 1101, represent 0 to 12
+		if imm := enc & 0x0f; enc>>4 == 0xf && imm >= 1 && imm <= 13 {
+			return int64(imm) - 1, nil
+		}
+		return 0, errors.Errorf("unknown ziplist encoding 0x%x", enc)
+	}
+
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return int64(int8(b[0])), nil
+	case 2:
+		return int64(int16(binary.LittleEndian.Uint16(b))), nil
+	case 3:
+		return int24(b), nil
+	case 4:
+		return int64(int32(binary.LittleEndian.Uint32(b))), nil
+	default:
+		return int64(binary.LittleEndian.Uint64(b)), nil
+	}
+}
+
+// listpackEntries decodes the entries of a listpack, which is laid out as:
+//
+//	<total bytes uint32> <num elements uint16> <entry>... <0xff>
+//
+// with each entry being:
+//
+//	<encoding> <data> <backlen>
+func listpackEntries(b []byte) ([]string, error) {
+	if len(b) < 7 {
+		return nil, errors.New("listpack is too short")
+	}
+	d := &decoder{b: b, i: 6}
+
+	var entries []string
+	for {
+		start := d.i
+		enc, err := d.byte()
+		if err != nil {
+			return nil, err
+		} else if enc == 0xff {
+			break
+		}
+
+		var entry string
+		var strLen int
+		var isStr bool
+		switch {
+		case enc>>7 == 0:
+			entry = strconv.Itoa(int(enc & 0x7f))
+		case enc>>6 == 2:
+			strLen, isStr = int(enc&0x3f), true
+		case enc>>5 == 6:
+			b2, err := d.byte()
+			if err != nil {
+				return nil, err
+			}
+			// 13 bit signed integer
+			u := int(enc&0x1f)<<8 | int(b2)
+			if u >= 1<<12 {
+				u -= 1 << 13
+			}
+			entry = strconv.Itoa(u)
+		case enc>>4 == 0xe:
+			b2, err := d.byte()
+			if err != nil {
+				return nil, err
+			}
+			strLen, isStr = int(enc&0x0f)<<8|int(b2), true
+		case enc == 0xf0:
+			bb, err := d.next(4)
+			if err != nil {
+				return nil, err
+			}
+			strLen, isStr = int(binary.LittleEndian.Uint32(bb)), true
+		default:
+			i, err := d.listpackInt(enc)
+			if err != nil {
+				return nil, err
+			}
+			entry = strconv.FormatInt(i, 10)
+		}
+
+		if isStr {
+			s, err := d.next(strLen)
+			if err != nil {
+				return nil, err
+			}
+			entry = string(s)
+		}
+		entries = append(entries, entry)
+
+		// skip over the backlen, which is the size of the encoding and data
+		// encoded in 1 to 5 bytes.
+		if _, err := d.next(backlenSize(d.i - start)); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+func (d *decoder) listpackInt(enc byte) (int64, error) {
+	var size int
+	switch enc {
+	case 0xf1:
+		size = 2
+	case 0xf2:
+		size = 3
+	case 0xf3:
+		size = 4
+	case 0xf4:
+		size = 8
+	default:
+		return 0, errors.Errorf("unknown listpack encoding 0x%x", enc)
+	}
+
+	b, err := d.next(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 2:
+		return int64(int16(binary.LittleEndian.Uint16(b))), nil
+	case 3:
+		return int24(b), nil
+	case 4:
+		return int64(int32(binary.LittleEndian.Uint32(b))), nil
+	default:
+		return int64(binary.LittleEndian.Uint64(b)), nil
+	}
+}
+
+func backlenSize(l int) int {
+	switch {
+	case l <= 127:
+		return 1
+	case l < 16383:
+		return 2
+	case l < 2097151:
+		return 3
+	case l < 268435455:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// intsetEntries decodes the entries of an intset, which is laid out as:
+//
+//	<encoding uint32> <length uint32> <int>...
+//
+// where encoding is the size of each int in bytes.
+func intsetEntries(b []byte) ([]string, error) {
+	if len(b) < 8 {
+		return nil, errors.New("intset is too short")
+	}
+	size := int(binary.LittleEndian.Uint32(b[:4]))
+	n := int(binary.LittleEndian.Uint32(b[4:8]))
+	if size != 2 && size != 4 && size != 8 {
+		return nil, errors.Errorf("unknown intset encoding %d", size)
+	} else if len(b)-8 != n*size {
+		return nil, errors.New("intset length does not match its size")
+	}
+
+	entries := make([]string, n)
+	for i := range entries {
+		ib := b[8+i*size:]
+		var v int64
+		switch size {
+		case 2:
+			v = int64(int16(binary.LittleEndian.Uint16(ib)))
+		case 4:
+			v = int64(int32(binary.LittleEndian.Uint32(ib)))
+		default:
+			v = int64(binary.LittleEndian.Uint64(ib))
+		}
+		entries[i] = strconv.FormatInt(v, 10)
+	}
+	return entries, nil
+}
+
+// lzfDecompress decompresses LZF compressed data, which redis uses for long
+// strings when rdbcompression is enabled.
+func lzfDecompress(in []byte, outLen uint64) ([]byte, error) {
+	if outLen > uint64(len(in))*256 {
+		// LZF can't compress better than this, so the length must be wrong.
+		return nil, errors.New("invalid LZF uncompressed length")
+	}
+
+	out := make([]byte, 0, outLen)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+
+		if ctrl < 32 {
+			// literal run of ctrl+1 bytes
+			n := ctrl + 1
+			if i+n > len(in) {
+				return nil, errTruncated
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+
+		// back reference
+		length := ctrl >> 5
+		if length == 7 {
+			if i >= len(in) {
+				return nil, errTruncated
+			}
+			length += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errTruncated
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 {
+			return nil, errors.New("invalid LZF back reference")
+		}
+		for j := 0; j < length+2; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+
+	if uint64(len(out)) != outLen {
+		return nil, errors.New("LZF uncompressed length does not match")
+	}
+	return out, nil
+}
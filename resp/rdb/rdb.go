@@ -0,0 +1,505 @@
+// Package rdb implements decoding of the payloads returned by redis' DUMP
+// command, which use the same serialization as RDB files, into Go values. This
+// allows values to be inspected, audited or migrated without having to RESTORE
+// them into a redis instance.
+//
+// Strings, lists, sets, sorted sets and hashes are supported, in all of the
+// encodings redis has used for them up to and including redis 7 (e.g.
+// ziplist, listpack, intset and quicklist). Streams and module values are not
+// supported.
+package rdb
+
+import (
+	"encoding/binary"
+	"hash/crc64"
+	"math"
+	"strconv"
+
+	errors "golang.org/x/xerrors"
+)
+
+// Type describes the type of a Value.
+type Type int
+
+// All Types which a Value may have.
+const (
+	TypeString Type = iota
+	TypeList
+	TypeSet
+	TypeZSet
+	TypeHash
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeString:
+		return "string"
+	case TypeList:
+		return "list"
+	case TypeSet:
+		return "set"
+	case TypeZSet:
+		return "zset"
+	case TypeHash:
+		return "hash"
+	default:
+		return "Type(" + strconv.Itoa(int(t)) + ")"
+	}
+}
+
+// ZSetMember is a single member of a sorted set, along with its score.
+type ZSetMember struct {
+	Member string
+	Score  float64
+}
+
+// Value is a value decoded from a DUMP payload. Only the field corresponding to
+// its Type is set.
+type Value struct {
+	Type Type
+
+	String string
+	List   []string
+	Set    []string
+	ZSet   []ZSetMember
+	Hash   map[string]string
+
+	// Version is the RDB version of the payload, which depends on the version
+	// of redis which produced it (e.g. 9 for redis 5 and 6, 10 for 7.0, 11 for
+	// 7.2).
+	Version int
+}
+
+// the object types used in the RDB format.
+const (
+	rdbTypeString         = 0
+	rdbTypeList           = 1
+	rdbTypeSet            = 2
+	rdbTypeZSet           = 3
+	rdbTypeHash           = 4
+	rdbTypeZSet2          = 5
+	rdbTypeListZiplist    = 10
+	rdbTypeSetIntset      = 11
+	rdbTypeZSetZiplist    = 12
+	rdbTypeHashZiplist    = 13
+	rdbTypeListQuicklist  = 14
+	rdbTypeHashListpack   = 16
+	rdbTypeZSetListpack   = 17
+	rdbTypeListQuicklist2 = 18
+	rdbTypeSetListpack    = 20
+)
+
+// the container types of quicklist nodes in rdbTypeListQuicklist2.
+const (
+	quicklistNodePlain  = 1
+	quicklistNodePacked = 2
+)
+
+// maxSupportedRDBVersion is the latest RDB version which Decode knows about.
+const maxSupportedRDBVersion = 12
+
+// crcTable is the table for the "Jones" CRC-64 polynomial (in its reflected
+// form), which redis uses for the checksum of DUMP payloads.
+var crcTable = crc64.MakeTable(0x95ac9329ac4bc9b5)
+
+// checksum computes the CRC-64 of b as redis does. redis' implementation
+// uses no initial value or final xor, unlike the hash/crc64 package, which
+// applies both, so they're undone here.
+func checksum(b []byte) uint64 {
+	return ^crc64.Update(^uint64(0), crcTable, b)
+}
+
+// Decode decodes the given DUMP payload. The payload's checksum is verified, if
+// it has one (redis allows checksums to be disabled, in which case it's zero).
+func Decode(payload []byte) (Value, error) {
+	// the payload is followed by a 2 byte RDB version and 8 byte checksum,
+	// both little-endian.
+	if len(payload) < 11 {
+		return Value{}, errors.New("payload is too short")
+	}
+	footer := payload[len(payload)-10:]
+	version := int(binary.LittleEndian.Uint16(footer[:2]))
+	if version > maxSupportedRDBVersion {
+		return Value{}, errors.Errorf("unsupported RDB version %d", version)
+	}
+	if sum := binary.LittleEndian.Uint64(footer[2:]); sum != 0 && sum != checksum(payload[:len(payload)-8]) {
+		return Value{}, errors.New("payload checksum does not match")
+	}
+
+	d := &decoder{b: payload[:len(payload)-10]}
+	v, err := d.decodeObject()
+	if err != nil {
+		return Value{}, err
+	} else if d.i != len(d.b) {
+		return Value{}, errors.Errorf("%d unexpected trailing bytes in payload", len(d.b)-d.i)
+	}
+	v.Version = version
+	return v, nil
+}
+
+var errTruncated = errors.New("payload is truncated")
+
+// decoder reads the components of the RDB format from a byte slice.
+type decoder struct {
+	b []byte
+	i int
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || d.i+n > len(d.b) {
+		return nil, errTruncated
+	}
+	b := d.b[d.i : d.i+n]
+	d.i += n
+	return b, nil
+}
+
+func (d *decoder) byte() (byte, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// length decodes a length-encoded value. If the value is instead a specially
+// encoded string then special is true and the returned value is the kind of
+// encoding.
+func (d *decoder) length() (n uint64, special bool, err error) {
+	b, err := d.byte()
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3f), false, nil
+	case 1:
+		b2, err := d.byte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(b&0x3f)<<8 | uint64(b2), false, nil
+	case 3:
+		return uint64(b & 0x3f), true, nil
+	}
+
+	switch b {
+	case 0x80:
+		bb, err := d.next(4)
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(binary.BigEndian.Uint32(bb)), false, nil
+	case 0x81:
+		bb, err := d.next(8)
+		if err != nil {
+			return 0, false, err
+		}
+		return binary.BigEndian.Uint64(bb), false, nil
+	default:
+		return 0, false, errors.Errorf("unknown length encoding 0x%x", b)
+	}
+}
+
+// count decodes a length which is the number of elements of a collection.
+func (d *decoder) count() (int, error) {
+	n, special, err := d.length()
+	if err != nil {
+		return 0, err
+	} else if special {
+		return 0, errors.New("unexpected string encoding in place of length")
+	} else if n > uint64(len(d.b)) {
+		// every element takes at least a byte, so this can't be right.
+		return 0, errTruncated
+	}
+	return int(n), nil
+}
+
+func (d *decoder) string() (string, error) {
+	b, err := d.stringBytes()
+	return string(b), err
+}
+
+func (d *decoder) stringBytes() ([]byte, error) {
+	n, special, err := d.length()
+	if err != nil {
+		return nil, err
+	} else if !special {
+		if n > uint64(len(d.b)) {
+			return nil, errTruncated
+		}
+		return d.next(int(n))
+	}
+
+	switch n {
+	case 0:
+		b, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.AppendInt(nil, int64(int8(b[0])), 10), nil
+	case 1:
+		b, err := d.next(2)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.AppendInt(nil, int64(int16(binary.LittleEndian.Uint16(b))), 10), nil
+	case 2:
+		b, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.AppendInt(nil, int64(int32(binary.LittleEndian.Uint32(b))), 10), nil
+	case 3:
+		clen, err := d.count()
+		if err != nil {
+			return nil, err
+		}
+		ulen, _, err := d.length()
+		if err != nil {
+			return nil, err
+		}
+		compressed, err := d.next(clen)
+		if err != nil {
+			return nil, err
+		}
+		return lzfDecompress(compressed, ulen)
+	default:
+		return nil, errors.Errorf("unknown string encoding %d", n)
+	}
+}
+
+// float decodes a score in the old string format used by rdbTypeZSet.
+func (d *decoder) float() (float64, error) {
+	n, err := d.byte()
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	b, err := d.next(int(n))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(b), 64)
+}
+
+func (d *decoder) binaryFloat() (float64, error) {
+	b, err := d.next(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+}
+
+func (d *decoder) strings() ([]string, error) {
+	n, err := d.count()
+	if err != nil {
+		return nil, err
+	}
+	ss := make([]string, n)
+	for i := range ss {
+		if ss[i], err = d.string(); err != nil {
+			return nil, err
+		}
+	}
+	return ss, nil
+}
+
+func (d *decoder) decodeObject() (Value, error) {
+	typ, err := d.byte()
+	if err != nil {
+		return Value{}, err
+	}
+
+	switch typ {
+	case rdbTypeString:
+		s, err := d.string()
+		return Value{Type: TypeString, String: s}, err
+
+	case rdbTypeList:
+		l, err := d.strings()
+		return Value{Type: TypeList, List: l}, err
+
+	case rdbTypeSet:
+		s, err := d.strings()
+		return Value{Type: TypeSet, Set: s}, err
+
+	case rdbTypeZSet, rdbTypeZSet2:
+		n, err := d.count()
+		if err != nil {
+			return Value{}, err
+		}
+		zs := make([]ZSetMember, n)
+		for i := range zs {
+			if zs[i].Member, err = d.string(); err != nil {
+				return Value{}, err
+			} else if typ == rdbTypeZSet {
+				zs[i].Score, err = d.float()
+			} else {
+				zs[i].Score, err = d.binaryFloat()
+			}
+			if err != nil {
+				return Value{}, err
+			}
+		}
+		// skiplist encoded sorted sets are serialized from the highest score
+		// down, they're reversed to match the order of ziplist/listpack
+		// encoded ones.
+		reverseZSet(zs)
+		return Value{Type: TypeZSet, ZSet: zs}, nil
+
+	case rdbTypeHash:
+		n, err := d.count()
+		if err != nil {
+			return Value{}, err
+		}
+		h := make(map[string]string, n)
+		for i := 0; i < n; i++ {
+			k, err := d.string()
+			if err != nil {
+				return Value{}, err
+			}
+			if h[k], err = d.string(); err != nil {
+				return Value{}, err
+			}
+		}
+		return Value{Type: TypeHash, Hash: h}, nil
+
+	case rdbTypeListZiplist:
+		l, err := d.packed(ziplistEntries)
+		return Value{Type: TypeList, List: l}, err
+
+	case rdbTypeSetIntset:
+		b, err := d.stringBytes()
+		if err != nil {
+			return Value{}, err
+		}
+		s, err := intsetEntries(b)
+		return Value{Type: TypeSet, Set: s}, err
+
+	case rdbTypeSetListpack:
+		s, err := d.packed(listpackEntries)
+		return Value{Type: TypeSet, Set: s}, err
+
+	case rdbTypeZSetZiplist, rdbTypeZSetListpack:
+		entries, err := d.packed(packedEntriesFn(typ == rdbTypeZSetListpack))
+		if err != nil {
+			return Value{}, err
+		}
+		zs, err := zsetFromEntries(entries)
+		return Value{Type: TypeZSet, ZSet: zs}, err
+
+	case rdbTypeHashZiplist, rdbTypeHashListpack:
+		entries, err := d.packed(packedEntriesFn(typ == rdbTypeHashListpack))
+		if err != nil {
+			return Value{}, err
+		}
+		h, err := hashFromEntries(entries)
+		return Value{Type: TypeHash, Hash: h}, err
+
+	case rdbTypeListQuicklist, rdbTypeListQuicklist2:
+		l, err := d.quicklist(typ == rdbTypeListQuicklist2)
+		return Value{Type: TypeList, List: l}, err
+
+	default:
+		return Value{}, errors.Errorf("unsupported RDB object type %d", typ)
+	}
+}
+
+func packedEntriesFn(listpack bool) func([]byte) ([]string, error) {
+	if listpack {
+		return listpackEntries
+	}
+	return ziplistEntries
+}
+
+// packed decodes a ziplist or listpack, which is serialized as a string.
+func (d *decoder) packed(fn func([]byte) ([]string, error)) ([]string, error) {
+	b, err := d.stringBytes()
+	if err != nil {
+		return nil, err
+	}
+	return fn(b)
+}
+
+func (d *decoder) quicklist(v2 bool) ([]string, error) {
+	n, err := d.count()
+	if err != nil {
+		return nil, err
+	}
+
+	var l []string
+	for i := 0; i < n; i++ {
+		container := uint64(quicklistNodePacked)
+		if v2 {
+			if container, _, err = d.length(); err != nil {
+				return nil, err
+			}
+		}
+
+		b, err := d.stringBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case container == quicklistNodePlain:
+			l = append(l, string(b))
+		case container == quicklistNodePacked && v2:
+			entries, err := listpackEntries(b)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, entries...)
+		case container == quicklistNodePacked:
+			entries, err := ziplistEntries(b)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, entries...)
+		default:
+			return nil, errors.Errorf("unknown quicklist container %d", container)
+		}
+	}
+	return l, nil
+}
+
+func zsetFromEntries(entries []string) ([]ZSetMember, error) {
+	if len(entries)%2 != 0 {
+		return nil, errors.New("odd number of sorted set entries")
+	}
+	zs := make([]ZSetMember, len(entries)/2)
+	for i := range zs {
+		score, err := strconv.ParseFloat(entries[i*2+1], 64)
+		if err != nil {
+			return nil, errors.Errorf("parsing sorted set score: %w", err)
+		}
+		zs[i] = ZSetMember{Member: entries[i*2], Score: score}
+	}
+	return zs, nil
+}
+
+func hashFromEntries(entries []string) (map[string]string, error) {
+	if len(entries)%2 != 0 {
+		return nil, errors.New("odd number of hash entries")
+	}
+	h := make(map[string]string, len(entries)/2)
+	for i := 0; i < len(entries); i += 2 {
+		h[entries[i]] = entries[i+1]
+	}
+	return h, nil
+}
+
+func reverseZSet(zs []ZSetMember) {
+	for i, j := 0, len(zs)-1; i < j; i, j = i+1, j-1 {
+		zs[i], zs[j] = zs[j], zs[i]
+	}
+}
@@ -0,0 +1,174 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"math"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dump appends the version and checksum footer to the given serialized value.
+func dump(b []byte) []byte {
+	b = append(b, 10, 0)
+	sum := make([]byte, 8)
+	binary.LittleEndian.PutUint64(sum, checksum(b))
+	return append(b, sum...)
+}
+
+// str length-encodes a short string.
+func str(b []byte) []byte {
+	return append([]byte{byte(len(b))}, b...)
+}
+
+func listpack(entries ...[]byte) []byte {
+	var body []byte
+	for _, e := range entries {
+		body = append(body, e...)
+	}
+	body = append(body, 0xff)
+	b := make([]byte, 6, 6+len(body))
+	binary.LittleEndian.PutUint32(b, uint32(6+len(body)))
+	binary.LittleEndian.PutUint16(b[4:], uint16(len(entries)))
+	return append(b, body...)
+}
+
+// lpStr and lpInt encode short strings and small ints as listpack entries.
+func lpStr(s string) []byte {
+	return append(append([]byte{0x80 | byte(len(s))}, s...), byte(1+len(s)))
+}
+
+func lpInt(i byte) []byte {
+	return []byte{i, 1}
+}
+
+func TestChecksum(t *T) {
+	assert.Equal(t, uint64(0xe9c6d914c4b8d9ca), checksum([]byte("123456789")))
+}
+
+func TestDecode(t *T) {
+	type test struct {
+		descr   string
+		payload []byte
+		exp     Value
+	}
+
+	binaryFloat := func(f float64) []byte {
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint64(b, math.Float64bits(f))
+		return b
+	}
+
+	ziplist := []byte{
+		0, 0, 0, 0, 0, 0, 0, 0, 2, 0, // header, only zllen is read
+		0, 0x01, 'a', // 1 byte string
+		3, 0xfe, 0x85, // int8 -123
+		3, 0xf2, // immediate 1
+		0xff,
+	}
+
+	// the same ziplist without its last entry, so it has an even number of
+	// entries.
+	hashZiplist := append(append([]byte{}, ziplist[:len(ziplist)-3]...), 0xff)
+
+	intset := []byte{2, 0, 0, 0, 2, 0, 0, 0, 0xfe, 0xff, 0x01, 0x00}
+
+	tests := []test{
+		{
+			// taken from the DUMP command's documentation
+			descr:   "string int",
+			payload: []byte("\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n"),
+			exp:     Value{Type: TypeString, String: "10", Version: 9},
+		},
+		{
+			descr:   "string",
+			payload: dump(append([]byte{0}, str([]byte("bar"))...)),
+			exp:     Value{Type: TypeString, String: "bar", Version: 10},
+		},
+		{
+			descr:   "string lzf",
+			payload: dump([]byte{0, 0xc3, 5, 10, 0x00, 'a', 0xe0, 0x00, 0x00}),
+			exp:     Value{Type: TypeString, String: "aaaaaaaaaa", Version: 10},
+		},
+		{
+			descr:   "list quicklist2",
+			payload: dump(append([]byte{18, 1, 2}, str(listpack(lpStr("a"), lpInt(1)))...)),
+			exp:     Value{Type: TypeList, List: []string{"a", "1"}, Version: 10},
+		},
+		{
+			descr:   "list quicklist",
+			payload: dump(append([]byte{14, 1}, str(ziplist)...)),
+			exp:     Value{Type: TypeList, List: []string{"a", "-123", "1"}, Version: 10},
+		},
+		{
+			descr:   "list",
+			payload: dump(append(append([]byte{1, 2}, str([]byte("a"))...), str([]byte("b"))...)),
+			exp:     Value{Type: TypeList, List: []string{"a", "b"}, Version: 10},
+		},
+		{
+			descr:   "set intset",
+			payload: dump(append([]byte{11}, str(intset)...)),
+			exp:     Value{Type: TypeSet, Set: []string{"-2", "1"}, Version: 10},
+		},
+		{
+			descr:   "set listpack",
+			payload: dump(append([]byte{20}, str(listpack(lpStr("a"), lpStr("bc")))...)),
+			exp:     Value{Type: TypeSet, Set: []string{"a", "bc"}, Version: 10},
+		},
+		{
+			descr: "zset2",
+			payload: dump(append(append(append(append([]byte{5, 2},
+				str([]byte("b"))...), binaryFloat(2.5)...),
+				str([]byte("a"))...), binaryFloat(1)...)),
+			exp: Value{Type: TypeZSet, ZSet: []ZSetMember{{"a", 1}, {"b", 2.5}}, Version: 10},
+		},
+		{
+			descr:   "zset listpack",
+			payload: dump(append([]byte{17}, str(listpack(lpStr("a"), lpInt(1), lpStr("b"), lpStr("2.5")))...)),
+			exp:     Value{Type: TypeZSet, ZSet: []ZSetMember{{"a", 1}, {"b", 2.5}}, Version: 10},
+		},
+		{
+			descr:   "hash listpack",
+			payload: dump(append([]byte{16}, str(listpack(lpStr("f"), lpStr("v"), lpStr("g"), lpInt(7)))...)),
+			exp:     Value{Type: TypeHash, Hash: map[string]string{"f": "v", "g": "7"}, Version: 10},
+		},
+		{
+			descr:   "hash ziplist",
+			payload: dump(append([]byte{13}, str(hashZiplist)...)),
+			exp:     Value{Type: TypeHash, Hash: map[string]string{"a": "-123"}, Version: 10},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.descr, func(t *T) {
+			v, err := Decode(test.payload)
+			require.NoError(t, err)
+			assert.Equal(t, test.exp, v)
+		})
+	}
+}
+
+func TestDecodeErrors(t *T) {
+	good := dump(append([]byte{0}, str([]byte("bar"))...))
+
+	bad := append([]byte{}, good...)
+	bad[2] = 'x'
+	_, err := Decode(bad)
+	assert.EqualError(t, err, "payload checksum does not match")
+
+	_, err = Decode(dump([]byte{0, 5, 'a'}))
+	assert.Equal(t, errTruncated, err)
+
+	_, err = Decode(dump([]byte{15, 0}))
+	assert.EqualError(t, err, "unsupported RDB object type 15")
+
+	// checksums may be disabled
+	noSum := append([]byte{}, good...)
+	for i := len(noSum) - 8; i < len(noSum); i++ {
+		noSum[i] = 0
+	}
+	v, err := Decode(noSum)
+	require.NoError(t, err)
+	assert.Equal(t, "bar", v.String)
+}
@@ -1,6 +1,14 @@
 // Package resp is an umbrella package which covers both the old RESP protocol
 // (resp2) and the new one (resp3), allowing clients to choose which one they
 // care to use
+//
+// NOTE that currently only resp2 is implemented. Connections created by radix
+// never switch to RESP3 (via the HELLO command) themselves, and so redis will
+// never send RESP3-only frames to them unless HELLO 3 is sent explicitly. Of
+// those frames attributes are supported, see AttributesReceiver, as are maps,
+// verbatim strings, doubles, and big numbers, see resp2.Any; others, such as
+// sets and nulls, can only be received as raw bytes using radix's
+// DialLenientDecoding option.
 package resp
 
 import (
@@ -24,6 +32,30 @@ type Unmarshaler interface {
 	UnmarshalRESP(*bufio.Reader) error
 }
 
+// AttributesReceiver may be implemented by Unmarshalers which want to receive
+// the RESP3 attributes (e.g. key popularity, when using CLIENT TRACKING) which
+// preceded the reply they're unmarshaling. ReceiveAttributes is called with
+// the attributes before UnmarshalRESP is called, or with nil if the reply had
+// no attributes.
+//
+// The keys of the attributes map are the attributes' names, and its values are
+// one of string, int64, *big.Int, float64, bool, nil, error, []interface{}, or
+// map[string]interface{}, depending on the RESP3 type of the value.
+type AttributesReceiver interface {
+	ReceiveAttributes(map[string]interface{})
+}
+
+// Error is implemented by errors which were returned from redis itself, as
+// opposed to network or parsing errors. It can be used as the target of the
+// errors.As function to check for and inspect such errors.
+type Error interface {
+	error
+
+	// Prefix returns the first word of the error's message, which redis uses
+	// to denote the kind of error, e.g. "ERR", "WRONGTYPE", or "MOVED".
+	Prefix() string
+}
+
 // ErrDiscarded is used to wrap an error encountered while unmarshaling a
 // message. If an error was encountered during unmarshaling but the rest of the
 // message was successfully discarded off of the wire, then the error can be
@@ -3,6 +3,7 @@ package resp2
 import (
 	"bufio"
 	"fmt"
+	"io/ioutil"
 	"strings"
 	"testing"
 )
@@ -86,3 +87,20 @@ func BenchmarkAnyUnmarshalRESP(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkBulkStringMarshalRESP(b *testing.B) {
+	for _, size := range []int{8, 256, 4096, 1 << 20} {
+		str := strings.Repeat("a", size)
+		w := bufio.NewWriter(ioutil.Discard)
+
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				if err := (BulkString{S: str}).MarshalRESP(w); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -12,8 +12,10 @@ import (
 	"encoding"
 	"fmt"
 	"io"
+	"math/big"
 	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 
 	errors "golang.org/x/xerrors"
@@ -42,6 +44,16 @@ var (
 	ArrayPrefix        = []byte{'*'}
 )
 
+// RESP3 message types which Any and RawMessage can also unmarshal. radix never
+// switches a connection to RESP3 itself, but redis may still send these if
+// HELLO 3 is sent explicitly.
+var (
+	DoublePrefix         = []byte{','}
+	BigNumberPrefix      = []byte{'('}
+	MapPrefix            = []byte{'%'}
+	VerbatimStringPrefix = []byte{'='}
+)
+
 // String formats a prefix into a human-readable name for the type it denotes.
 func (p prefix) String() string {
 	pStr := string(p)
@@ -56,6 +68,14 @@ func (p prefix) String() string {
 		return "bulk-string"
 	case string(ArrayPrefix):
 		return "array"
+	case string(DoublePrefix):
+		return "double"
+	case string(BigNumberPrefix):
+		return "big-number"
+	case string(MapPrefix):
+		return "map"
+	case string(VerbatimStringPrefix):
+		return "verbatim-string"
 	default:
 		return pStr
 	}
@@ -87,6 +107,85 @@ func (e errUnexpectedPrefix) Error() string {
 	)
 }
 
+// UnmarshalError is returned, wrapped in a resp.ErrDiscarded, when a RESP
+// message could not be unmarshaled into a Go value by Any, e.g. because the
+// value is of the wrong type for the message.
+type UnmarshalError struct {
+	// Cmd is the name of the command whose reply was being unmarshaled, if
+	// known. It is filled in by the radix package when unmarshaling into the
+	// receiver of a Cmd or FlatCmd.
+	Cmd string
+
+	// RESPType is the type of the message which couldn't be unmarshaled, e.g.
+	// "bulk-string" or "array".
+	RESPType string
+
+	// GoType is the type of the value which was being unmarshaled into.
+	GoType reflect.Type
+
+	// Path contains the index of the message within each array it was nested
+	// within, outermost first. It is empty if the message was not within an
+	// array.
+	Path []int
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *UnmarshalError) Error() string {
+	var msg string
+	if e.Cmd != "" {
+		msg = e.Cmd + " reply: "
+	}
+	msg += fmt.Sprintf("can't unmarshal %s into %v", e.RESPType, e.GoType)
+	if len(e.Path) > 0 {
+		msg += fmt.Sprintf(" at index %v", e.Path)
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+// Unwrap implements the errors.Wrapper interface.
+func (e *UnmarshalError) Unwrap() error {
+	return e.Err
+}
+
+// wrapUnmarshalErr wraps the given error in an UnmarshalError, if it isn't
+// already, and only if it's an error which was discarded and isn't a RESP
+// error message.
+func wrapUnmarshalErr(err error, p byte, into interface{}) error {
+	var ue *UnmarshalError
+	if !errors.As(err, new(resp.ErrDiscarded)) {
+		return err
+	} else if errors.As(err, &ue) || errors.As(err, new(Error)) {
+		return err
+	}
+
+	goType := reflect.TypeOf(into)
+	if goType != nil && goType.Kind() == reflect.Ptr {
+		goType = goType.Elem()
+	}
+
+	innerErr := err
+	if ed := (resp.ErrDiscarded{}); errors.As(err, &ed) {
+		innerErr = ed.Err
+	}
+	return resp.ErrDiscarded{Err: &UnmarshalError{
+		RESPType: prefix{p}.String(),
+		GoType:   goType,
+		Err:      innerErr,
+	}}
+}
+
+// prependUnmarshalErrPath adds the given index to the front of the Path of the
+// UnmarshalError wrapped by err, if there is one.
+func prependUnmarshalErrPath(err error, i int) error {
+	var ue *UnmarshalError
+	if errors.As(err, &ue) {
+		ue.Path = append([]int{i}, ue.Path...)
+	}
+	return err
+}
+
 // peekAndAssertPrefix will peek at the next incoming redis message and assert
 // that it is of the type identified by the given RESP prefix (see the resp2
 // package for possible prefices).
@@ -172,6 +271,73 @@ func (e Error) Error() string {
 	return e.E.Error()
 }
 
+// Prefix implements the method for the resp.Error interface.
+func (e Error) Prefix() string {
+	if e.E == nil {
+		return ""
+	}
+	msg := e.E.Error()
+	if i := strings.IndexByte(msg, ' '); i >= 0 {
+		return msg[:i]
+	}
+	return msg
+}
+
+// ErrorKind classifies an Error based on its prefix, for the well-known
+// prefixes which redis uses.
+type ErrorKind int
+
+// Enumeration of the ErrorKinds which are recognized. ErrorKindOther is used
+// for all errors whose prefix isn't one of the others, e.g. "ERR".
+const (
+	ErrorKindOther ErrorKind = iota
+	ErrorKindLoading
+	ErrorKindBusy
+	ErrorKindReadOnly
+	ErrorKindMasterDown
+	ErrorKindClusterDown
+	ErrorKindNoPerm
+	ErrorKindWrongType
+	ErrorKindOOM
+)
+
+var errorKindPrefixes = map[string]ErrorKind{
+	"LOADING":     ErrorKindLoading,
+	"BUSY":        ErrorKindBusy,
+	"READONLY":    ErrorKindReadOnly,
+	"MASTERDOWN":  ErrorKindMasterDown,
+	"CLUSTERDOWN": ErrorKindClusterDown,
+	"NOPERM":      ErrorKindNoPerm,
+	"WRONGTYPE":   ErrorKindWrongType,
+	"OOM":         ErrorKindOOM,
+}
+
+func (k ErrorKind) String() string {
+	for prefix, kk := range errorKindPrefixes {
+		if k == kk {
+			return prefix
+		}
+	}
+	return "OTHER"
+}
+
+// Temporary returns true for the ErrorKinds which indicate a condition on the
+// server which is expected to resolve itself, such that the command which
+// caused the error can be retried after some delay.
+func (k ErrorKind) Temporary() bool {
+	switch k {
+	case ErrorKindLoading, ErrorKindBusy, ErrorKindMasterDown, ErrorKindClusterDown:
+		return true
+	default:
+		return false
+	}
+}
+
+// Kind returns the ErrorKind of the Error, based on its Prefix.
+func (e Error) Kind() ErrorKind {
+	return errorKindPrefixes[e.Prefix()]
+}
+
 // MarshalRESP implements the Marshaler method
 func (e Error) MarshalRESP(w io.Writer) error {
 	scratch := bytesutil.GetBytes()
@@ -236,6 +402,34 @@ func (i *Int) UnmarshalRESP(br *bufio.Reader) error {
 
 ////////////////////////////////////////////////////////////////////////////////
 
+// maxScratchCopy is the size above which bulk string values are written
+// directly to the io.Writer, rather than being copied into a scratch buffer
+// along with their header. This prevents large values from growing the
+// buffers in the scratch pool.
+const maxScratchCopy = 512
+
+// writeLargeBulk writes the header already in scratch, then the value (given
+// as either bytes or a string), then the trailing delimiter. scratch is put
+// back into the pool.
+func writeLargeBulk(w io.Writer, scratch *[]byte, b []byte, s string) error {
+	_, err := w.Write(*scratch)
+	bytesutil.PutBytes(scratch)
+	if err != nil {
+		return err
+	}
+
+	if b != nil {
+		_, err = w.Write(b)
+	} else {
+		_, err = io.WriteString(w, s)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(delim)
+	return err
+}
+
 // BulkStringBytes represents the bulk string type in the RESP protocol using a
 // go byte slice. A B value of nil indicates the nil bulk string message, versus
 // a B value of []byte{} which indicates a bulk string of length 0.
@@ -257,6 +451,9 @@ func (b BulkStringBytes) MarshalRESP(w io.Writer) error {
 	*scratch = append(*scratch, BulkStringPrefix...)
 	*scratch = strconv.AppendInt(*scratch, int64(len(b.B)), 10)
 	*scratch = append(*scratch, delim...)
+	if len(b.B) > maxScratchCopy {
+		return writeLargeBulk(w, scratch, b.B, "")
+	}
 	*scratch = append(*scratch, b.B...)
 	*scratch = append(*scratch, delim...)
 	_, err := w.Write(*scratch)
@@ -305,6 +502,9 @@ func (b BulkString) MarshalRESP(w io.Writer) error {
 	*scratch = append(*scratch, BulkStringPrefix...)
 	*scratch = strconv.AppendInt(*scratch, int64(len(b.S)), 10)
 	*scratch = append(*scratch, delim...)
+	if len(b.S) > maxScratchCopy {
+		return writeLargeBulk(w, scratch, nil, b.S)
+	}
 	*scratch = append(*scratch, b.S...)
 	*scratch = append(*scratch, delim...)
 	_, err := w.Write(*scratch)
@@ -476,6 +676,30 @@ func discardArrayAfterErr(br *bufio.Reader, left int, err error) error {
 // When using UnmarshalRESP the value of I must be a pointer or nil. If it is
 // nil then the RESP value will be read and discarded.
 //
+// Arrays of alternating keys/values, which is how RESP2 represents the replies
+// of commands like CONFIG GET, XINFO, and HGETALL, can be unmarshaled into maps
+// and structs. Struct fields are matched using their "redis" tag if they have
+// one, or their name otherwise.
+//
+// When unmarshaling into an integer type an error is returned if the value
+// doesn't fit within that type, rather than it being silently truncated.
+// Integers of arbitrary size can be unmarshaled into a *big.Int, which is an
+// encoding.TextUnmarshaler. When unmarshaling into a float type the values
+// "inf", "-inf", and "nan", as returned by redis for those special cases, are
+// supported.
+//
+// RESP3 doubles and big numbers are unmarshaled the same as simple strings are,
+// so they can be read into floats, integers (subject to the overflow check
+// above), strings, or a *big.Int. When unmarshaling into an *interface{} a
+// double becomes a float64 and a big number becomes a *big.Int.
+//
+// RESP3 maps are unmarshaled as if they were arrays of their alternating
+// keys/values, so they can be read into maps, structs, or slices (which receive
+// the flattened keys/values). When unmarshaling into an *interface{} a map
+// becomes a map[string]interface{}. RESP3 verbatim strings are unmarshaled like
+// bulk strings, but with their format prefix (e.g. "txt:") removed; into an
+// *interface{} they become a string.
+//
 // If an error type is read in the UnmarshalRESP method then a resp2.Error will
 // be returned with that error, and the value of I won't be touched.
 type Any struct {
@@ -514,6 +738,7 @@ func (a Any) NumElems() int {
 }
 
 var (
+	rawMessageT              = reflect.TypeOf(RawMessage(nil))
 	lenReaderT               = reflect.TypeOf(new(resp.LenReader)).Elem()
 	encodingTextMarshalerT   = reflect.TypeOf(new(encoding.TextMarshaler)).Elem()
 	encodingBinaryMarshalerT = reflect.TypeOf(new(encoding.BinaryMarshaler)).Elem()
@@ -526,6 +751,8 @@ func numElems(vv reflect.Value) int {
 
 	tt := vv.Type()
 	switch {
+	case tt == rawMessageT:
+		return 1
 	case tt.Implements(lenReaderT):
 		return 1
 	case tt.Implements(encodingTextMarshalerT):
@@ -609,6 +836,8 @@ func (a Any) MarshalRESP(w io.Writer) error {
 	switch at := a.I.(type) {
 	case []byte:
 		return marshalBulk(at)
+	case RawMessage:
+		return at.MarshalRESP(w)
 	case string:
 		if at == "" {
 			// special case, we never want string to be nil, but appending empty
@@ -785,6 +1014,15 @@ func saneDefault(prefix byte) interface{} {
 		return new(string)
 	case IntPrefix[0]:
 		return new(int64)
+	case DoublePrefix[0]:
+		return new(float64)
+	case BigNumberPrefix[0]:
+		return new(big.Int)
+	case MapPrefix[0]:
+		m := map[string]interface{}{}
+		return &m
+	case VerbatimStringPrefix[0]:
+		return new(string)
 	}
 	panic("should never get here")
 }
@@ -807,6 +1045,14 @@ var (
 	}
 )
 
+// ReceiveAttributes implements the method for the resp.AttributesReceiver
+// interface, passing the attributes on to I if it implements the interface too.
+func (a Any) ReceiveAttributes(attrs map[string]interface{}) {
+	if ar, ok := a.I.(resp.AttributesReceiver); ok {
+		ar.ReceiveAttributes(attrs)
+	}
+}
+
 // UnmarshalRESP implements the Unmarshaler method
 func (a Any) UnmarshalRESP(br *bufio.Reader) error {
 	// if I is itself an Unmarshaler just hit that directly
@@ -828,6 +1074,10 @@ func (a Any) UnmarshalRESP(br *bufio.Reader) error {
 		innerA := Any{I: saneDefault(prefix)}
 		if err := innerA.UnmarshalRESP(br); err != nil {
 			return err
+		} else if bi, ok := innerA.I.(*big.Int); ok {
+			// big.Int is only meant to be used as a pointer
+			*ai = bi
+			return nil
 		}
 		*ai = reflect.ValueOf(innerA.I).Elem().Interface()
 		return nil
@@ -849,8 +1099,16 @@ func (a Any) UnmarshalRESP(br *bufio.Reader) error {
 		} else if l == -1 {
 			return a.unmarshalNil()
 		}
-		return a.unmarshalArray(br, l)
-	case BulkStringPrefix[0]:
+		return a.unmarshalArray(br, prefix, l)
+	case MapPrefix[0]:
+		l, err := bytesutil.ParseInt(b)
+		if err != nil {
+			return err
+		} else if l == -1 {
+			return a.unmarshalNil()
+		}
+		return a.unmarshalArray(br, prefix, l*2)
+	case BulkStringPrefix[0], VerbatimStringPrefix[0]:
 		l, err := bytesutil.ParseInt(b) // fuck DRY
 		if err != nil {
 			return err
@@ -858,6 +1116,15 @@ func (a Any) UnmarshalRESP(br *bufio.Reader) error {
 			return a.unmarshalNil()
 		}
 
+		// verbatim strings are prefixed by their format, e.g. "txt:", which
+		// isn't part of the string itself.
+		if prefix == VerbatimStringPrefix[0] && l >= 4 {
+			if _, err := br.Discard(4); err != nil {
+				return err
+			}
+			l -= 4
+		}
+
 		// This is a bit of a clusterfuck. Basically:
 		// - If unmarshal returns a non-Discarded error, return that asap.
 		// - If discarding the last 2 bytes (in order to discard the full
@@ -871,13 +1138,13 @@ func (a Any) UnmarshalRESP(br *bufio.Reader) error {
 		if _, discardErr := br.Discard(2); discardErr != nil {
 			return discardErr
 		}
-		return err
-	case SimpleStringPrefix[0], IntPrefix[0]:
+		return wrapUnmarshalErr(err, prefix, a.I)
+	case SimpleStringPrefix[0], IntPrefix[0], DoublePrefix[0], BigNumberPrefix[0]:
 		reader := byteReaderPool.Get().(*bytes.Reader)
 		reader.Reset(b)
 		err := a.unmarshalSingle(reader, reader.Len())
 		byteReaderPool.Put(reader)
-		return err
+		return wrapUnmarshalErr(err, prefix, a.I)
 	default:
 		return errors.Errorf("unknown type prefix %q", b[0])
 	}
@@ -905,34 +1172,34 @@ func (a Any) unmarshalSingle(body io.Reader, n int) error {
 		ui, err = bytesutil.ReadUint(body, n)
 		*ai = ui > 0
 	case *int:
-		i, err = bytesutil.ReadInt(body, n)
+		i, err = readInt(body, n, strconv.IntSize)
 		*ai = int(i)
 	case *int8:
-		i, err = bytesutil.ReadInt(body, n)
+		i, err = readInt(body, n, 8)
 		*ai = int8(i)
 	case *int16:
-		i, err = bytesutil.ReadInt(body, n)
+		i, err = readInt(body, n, 16)
 		*ai = int16(i)
 	case *int32:
-		i, err = bytesutil.ReadInt(body, n)
+		i, err = readInt(body, n, 32)
 		*ai = int32(i)
 	case *int64:
-		i, err = bytesutil.ReadInt(body, n)
+		i, err = readInt(body, n, 64)
 		*ai = i
 	case *uint:
-		ui, err = bytesutil.ReadUint(body, n)
+		ui, err = readUint(body, n, strconv.IntSize)
 		*ai = uint(ui)
 	case *uint8:
-		ui, err = bytesutil.ReadUint(body, n)
+		ui, err = readUint(body, n, 8)
 		*ai = uint8(ui)
 	case *uint16:
-		ui, err = bytesutil.ReadUint(body, n)
+		ui, err = readUint(body, n, 16)
 		*ai = uint16(ui)
 	case *uint32:
-		ui, err = bytesutil.ReadUint(body, n)
+		ui, err = readUint(body, n, 32)
 		*ai = uint32(ui)
 	case *uint64:
-		ui, err = bytesutil.ReadUint(body, n)
+		ui, err = readUint(body, n, 64)
 		*ai = ui
 	case *float32:
 		var f float64
@@ -962,7 +1229,7 @@ func (a Any) unmarshalSingle(body io.Reader, n int) error {
 			break
 		}
 		err = resp.ErrDiscarded{
-			Err: errors.Errorf("can't unmarshal into %T, message body was: %q", a.I, *scratch),
+			Err: errors.Errorf("unsupported type, message body was: %q", *scratch),
 		}
 		bytesutil.PutBytes(scratch)
 	}
@@ -970,6 +1237,25 @@ func (a Any) unmarshalSingle(body io.Reader, n int) error {
 	return err
 }
 
+// readInt reads an integer of the given bit size from the next n bytes of body,
+// returning an error rather than truncating it if it doesn't fit.
+func readInt(body io.Reader, n, bits int) (int64, error) {
+	i, err := bytesutil.ReadInt(body, n)
+	if err == nil && bits < 64 && (i < -1<<(bits-1) || i > 1<<(bits-1)-1) {
+		return 0, resp.ErrDiscarded{Err: errors.Errorf("%d overflows int%d", i, bits)}
+	}
+	return i, err
+}
+
+// readUint is like readInt, but for unsigned integers.
+func readUint(body io.Reader, n, bits int) (uint64, error) {
+	ui, err := bytesutil.ReadUint(body, n)
+	if err == nil && bits < 64 && ui > 1<<bits-1 {
+		return 0, resp.ErrDiscarded{Err: errors.Errorf("%d overflows uint%d", ui, bits)}
+	}
+	return ui, err
+}
+
 func (a Any) unmarshalNil() error {
 	vv := reflect.ValueOf(a.I)
 	if vv.Kind() != reflect.Ptr || !vv.Elem().CanSet() {
@@ -983,7 +1269,9 @@ func (a Any) unmarshalNil() error {
 	return nil
 }
 
-func (a Any) unmarshalArray(br *bufio.Reader, l int64) error {
+// unmarshalArray unmarshals the l elements of an array, or of a map flattened
+// into its keys/values, whose header with the given prefix has been read.
+func (a Any) unmarshalArray(br *bufio.Reader, p byte, l int64) error {
 	if a.I == nil {
 		return discardArray(br, int(l))
 	}
@@ -991,10 +1279,8 @@ func (a Any) unmarshalArray(br *bufio.Reader, l int64) error {
 	size := int(l)
 	v := reflect.ValueOf(a.I)
 	if v.Kind() != reflect.Ptr {
-		err := resp.ErrDiscarded{
-			Err: errors.Errorf("can't unmarshal array into %T", a.I),
-		}
-		return discardArrayAfterErr(br, int(l), err)
+		err := resp.ErrDiscarded{Err: errors.New("not a pointer")}
+		return discardArrayAfterErr(br, int(l), wrapUnmarshalErr(err, p, a.I))
 	}
 	v = reflect.Indirect(v)
 
@@ -1014,15 +1300,15 @@ func (a Any) unmarshalArray(br *bufio.Reader, l int64) error {
 		for i := 0; i < size; i++ {
 			ai := Any{I: v.Index(i).Addr().Interface()}
 			if err := ai.UnmarshalRESP(br); err != nil {
-				return discardArrayAfterErr(br, int(l)-i-1, err)
+				return discardArrayAfterErr(br, int(l)-i-1, prependUnmarshalErrPath(err, i))
 			}
 		}
 		return nil
 
 	case reflect.Map:
 		if size%2 != 0 {
-			err := resp.ErrDiscarded{Err: errors.New("cannot decode redis array with odd number of elements into map")}
-			return discardArrayAfterErr(br, int(l), err)
+			err := resp.ErrDiscarded{Err: errors.New("odd number of elements")}
+			return discardArrayAfterErr(br, int(l), wrapUnmarshalErr(err, p, a.I))
 		} else if v.IsNil() {
 			v.Set(reflect.MakeMapWithSize(v.Type(), size/2))
 		}
@@ -1043,7 +1329,7 @@ func (a Any) unmarshalArray(br *bufio.Reader, l int64) error {
 				kv = reflect.New(v.Type().Key())
 			}
 			if err := (Any{I: kv.Interface()}).UnmarshalRESP(br); err != nil {
-				return discardArrayAfterErr(br, int(l)-i-1, err)
+				return discardArrayAfterErr(br, int(l)-i-1, prependUnmarshalErrPath(err, i))
 			}
 
 			vv := vvs
@@ -1051,7 +1337,7 @@ func (a Any) unmarshalArray(br *bufio.Reader, l int64) error {
 				vv = reflect.New(v.Type().Elem())
 			}
 			if err := (Any{I: vv.Interface()}).UnmarshalRESP(br); err != nil {
-				return discardArrayAfterErr(br, int(l)-i-2, err)
+				return discardArrayAfterErr(br, int(l)-i-2, prependUnmarshalErrPath(err, i+1))
 			}
 
 			v.SetMapIndex(kv.Elem(), vv.Elem())
@@ -1060,20 +1346,22 @@ func (a Any) unmarshalArray(br *bufio.Reader, l int64) error {
 
 	case reflect.Struct:
 		if size%2 != 0 {
-			err := resp.ErrDiscarded{Err: errors.New("cannot decode redis array with odd number of elements into struct")}
-			return discardArrayAfterErr(br, int(l), err)
+			err := resp.ErrDiscarded{Err: errors.New("odd number of elements")}
+			return discardArrayAfterErr(br, int(l), wrapUnmarshalErr(err, p, a.I))
 		}
 
 		structFields := getStructFields(v.Type())
-		var field BulkStringBytes
+		var field []byte
 
 		for i := 0; i < size; i += 2 {
-			if err := field.UnmarshalRESP(br); err != nil {
-				return discardArrayAfterErr(br, int(l)-i-1, err)
+			// RESP3 maps may use simple strings for their keys, so field names
+			// aren't required to be bulk strings.
+			if err := (Any{I: &field}).UnmarshalRESP(br); err != nil {
+				return discardArrayAfterErr(br, int(l)-i-1, prependUnmarshalErrPath(err, i))
 			}
 
 			var vv reflect.Value
-			structField, ok := structFields[string(field.B)] // no allocation, since Go 1.3
+			structField, ok := structFields[string(field)] // no allocation, since Go 1.3
 			if ok {
 				vv = getStructField(v, structField.indices)
 			}
@@ -1087,15 +1375,15 @@ func (a Any) unmarshalArray(br *bufio.Reader, l int64) error {
 			}
 
 			if err := (Any{I: vv.Interface()}).UnmarshalRESP(br); err != nil {
-				return discardArrayAfterErr(br, int(l)-i-2, err)
+				return discardArrayAfterErr(br, int(l)-i-2, prependUnmarshalErrPath(err, i+1))
 			}
 		}
 
 		return nil
 
 	default:
-		err := resp.ErrDiscarded{Err: errors.Errorf("cannot decode redis array into %v", v.Type())}
-		return discardArrayAfterErr(br, int(l), err)
+		err := resp.ErrDiscarded{Err: errors.New("unsupported type")}
+		return discardArrayAfterErr(br, int(l), wrapUnmarshalErr(err, p, a.I))
 	}
 }
 
@@ -1218,6 +1506,12 @@ func getStructField(v reflect.Value, ii []int) reflect.Value {
 // of a RESP message. When Marshaling the exact bytes of the RawMessage will be
 // written as-is. When Unmarshaling the bytes of a single RESP message will be
 // read into the RawMessage's bytes.
+//
+// When wrapped in an Any, for example when passed as an argument to
+// radix.FlatCmd, a RawMessage is also written as-is and counted as a single
+// element. This allows for writing values which have already been encoded,
+// but it's up to the caller to ensure the RawMessage contains exactly one valid
+// RESP message, and that it's a bulk string if used as a command argument.
 type RawMessage []byte
 
 // MarshalRESP implements the Marshaler method
@@ -1245,12 +1539,14 @@ func (rm *RawMessage) unmarshal(br *bufio.Reader) error {
 	body := b[1 : len(b)-2]
 
 	switch b[0] {
-	case ArrayPrefix[0]:
+	case ArrayPrefix[0], MapPrefix[0]:
 		l, err := bytesutil.ParseInt(body)
 		if err != nil {
 			return err
 		} else if l == -1 {
 			return nil
+		} else if b[0] == MapPrefix[0] {
+			l *= 2
 		}
 		for i := 0; i < int(l); i++ {
 			if err := rm.unmarshal(br); err != nil {
@@ -1258,7 +1554,7 @@ func (rm *RawMessage) unmarshal(br *bufio.Reader) error {
 			}
 		}
 		return nil
-	case BulkStringPrefix[0]:
+	case BulkStringPrefix[0], VerbatimStringPrefix[0]:
 		l, err := bytesutil.ParseInt(body) // fuck DRY
 		if err != nil {
 			return err
@@ -1267,13 +1563,33 @@ func (rm *RawMessage) unmarshal(br *bufio.Reader) error {
 		}
 		*rm, err = bytesutil.ReadNAppend(br, *rm, int(l+2))
 		return err
-	case ErrorPrefix[0], SimpleStringPrefix[0], IntPrefix[0]:
+	case ErrorPrefix[0], SimpleStringPrefix[0], IntPrefix[0], DoublePrefix[0], BigNumberPrefix[0]:
 		return nil
 	default:
 		return errors.Errorf("unknown type prefix %q", b[0])
 	}
 }
 
+// RawCapture is an Unmarshaler which reads a single RESP message, capturing its
+// raw bytes into Raw while also unmarshaling it into I, as Any would. This is
+// useful when a reply needs to be archived or forwarded as-is but also
+// inspected.
+//
+// If the message is a RESP error then the raw bytes are captured and a
+// resp2.Error is returned, the same as with Any.
+type RawCapture struct {
+	Raw *RawMessage
+	I   interface{}
+}
+
+// UnmarshalRESP implements the Unmarshaler method
+func (rc RawCapture) UnmarshalRESP(br *bufio.Reader) error {
+	if err := rc.Raw.UnmarshalRESP(br); err != nil {
+		return err
+	}
+	return rc.Raw.UnmarshalInto(Any{I: rc.I})
+}
+
 // UnmarshalInto is a shortcut for wrapping this RawMessage in a *bufio.Reader
 // and passing that into the given Unmarshaler's UnmarshalRESP method. Any error
 // from calling UnmarshalRESP is returned, and the RawMessage is unaffected in
@@ -3,6 +3,10 @@ package resp2
 import (
 	"bufio"
 	"bytes"
+	"io"
+	"math"
+	"math/big"
+	"net"
 	"reflect"
 	"strings"
 	. "testing"
@@ -62,6 +66,9 @@ func TestRESPTypes(t *T) {
 		errStr bool
 	}
 
+	// large enough to be written directly, rather than through a scratch buffer
+	largeStr := strings.Repeat("a", 1024)
+
 	encodeTests := func() []encodeTest {
 		return []encodeTest{
 			{in: &SimpleString{S: ""}, out: "+\r\n"},
@@ -78,6 +85,8 @@ func TestRESPTypes(t *T) {
 			{in: &BulkString{S: ""}, out: "$0\r\n\r\n"},
 			{in: &BulkString{S: "foo"}, out: "$3\r\nfoo\r\n"},
 			{in: &BulkString{S: "foo\r\nbar"}, out: "$8\r\nfoo\r\nbar\r\n"},
+			{in: &BulkString{S: largeStr}, out: "$1024\r\n" + largeStr + "\r\n"},
+			{in: &BulkStringBytes{B: []byte(largeStr)}, out: "$1024\r\n" + largeStr + "\r\n"},
 			{in: &BulkReader{LR: newLR("foo\r\nbar")}, out: "$8\r\nfoo\r\nbar\r\n"},
 			{in: &ArrayHeader{N: 5}, out: "*5\r\n"},
 			{in: &ArrayHeader{N: -1}, out: "*-1\r\n"},
@@ -718,6 +727,76 @@ func TestAnyConsumedOnErr(t *T) {
 	}
 }
 
+func TestAnyUnmarshalError(t *T) {
+	type test struct {
+		in   string
+		into interface{}
+		exp  UnmarshalError
+	}
+
+	tests := []test{
+		{
+			in:   "$3\r\nfoo\r\n",
+			into: new(int),
+			exp:  UnmarshalError{RESPType: "bulk-string", GoType: reflect.TypeOf(0)},
+		},
+		{
+			in:   "*2\r\n:1\r\n$3\r\nfoo\r\n",
+			into: new([]int),
+			exp:  UnmarshalError{RESPType: "bulk-string", GoType: reflect.TypeOf(0), Path: []int{1}},
+		},
+		{
+			in:   "*2\r\n*1\r\n:1\r\n*2\r\n:2\r\n+foo\r\n",
+			into: new([][]int),
+			exp:  UnmarshalError{RESPType: "simple-string", GoType: reflect.TypeOf(0), Path: []int{1, 1}},
+		},
+		{
+			in:   "*2\r\n$1\r\na\r\n$1\r\nb\r\n",
+			into: new(map[string]int),
+			exp:  UnmarshalError{RESPType: "bulk-string", GoType: reflect.TypeOf(0), Path: []int{1}},
+		},
+		{
+			in:   "*1\r\n$1\r\na\r\n",
+			into: new(map[string]int),
+			exp:  UnmarshalError{RESPType: "array", GoType: reflect.TypeOf(map[string]int{})},
+		},
+		{
+			in:   "*1\r\n$1\r\na\r\n",
+			into: new(int),
+			exp:  UnmarshalError{RESPType: "array", GoType: reflect.TypeOf(0)},
+		},
+	}
+
+	for i, test := range tests {
+		br := bufio.NewReader(strings.NewReader(test.in))
+		err := Any{I: test.into}.UnmarshalRESP(br)
+		assert.True(t, errors.As(err, new(resp.ErrDiscarded)), "test:%d", i)
+
+		var ue *UnmarshalError
+		if !assert.True(t, errors.As(err, &ue), "test:%d err:%v", i, err) {
+			continue
+		}
+		assert.Equal(t, test.exp.RESPType, ue.RESPType, "test:%d", i)
+		assert.Equal(t, test.exp.GoType, ue.GoType, "test:%d", i)
+		assert.Equal(t, test.exp.Path, ue.Path, "test:%d", i)
+		assert.Error(t, ue.Err, "test:%d", i)
+	}
+
+	// redis errors shouldn't be wrapped
+	br := bufio.NewReader(strings.NewReader("-ERR foo\r\n"))
+	err := Any{I: new(int)}.UnmarshalRESP(br)
+	assert.False(t, errors.As(err, new(*UnmarshalError)))
+
+	ue := &UnmarshalError{
+		Cmd:      "LRANGE",
+		RESPType: "bulk-string",
+		GoType:   reflect.TypeOf(0),
+		Path:     []int{2},
+		Err:      errors.New("bad int"),
+	}
+	assert.Equal(t, "LRANGE reply: can't unmarshal bulk-string into int at index [2]: bad int", ue.Error())
+}
+
 func TestErrorAs(t *T) {
 	{
 		err := Error{E: errors.New("foo")}
@@ -732,3 +811,403 @@ func TestErrorAs(t *T) {
 		assert.Equal(t, *err, errDiscarded.Err)
 	}
 }
+
+func TestErrorPrefix(t *T) {
+	assert.Equal(t, "", Error{}.Prefix())
+	assert.Equal(t, "ERR", Error{E: errors.New("ERR")}.Prefix())
+	assert.Equal(t, "WRONGTYPE", Error{E: errors.New("WRONGTYPE Operation against a key")}.Prefix())
+
+	var err error = errors.Errorf("wrapped: %w", Error{E: errors.New("MOVED 1 127.0.0.1:7000")})
+	var respErr resp.Error
+	assert.True(t, errors.As(err, &respErr))
+	assert.Equal(t, "MOVED", respErr.Prefix())
+}
+
+func TestErrorKind(t *T) {
+	tests := []struct {
+		msg  string
+		kind ErrorKind
+		temp bool
+	}{
+		{"ERR unknown command", ErrorKindOther, false},
+		{"LOADING Redis is loading the dataset in memory", ErrorKindLoading, true},
+		{"BUSY Redis is busy running a script", ErrorKindBusy, true},
+		{"READONLY You can't write against a read only replica.", ErrorKindReadOnly, false},
+		{"MASTERDOWN Link with MASTER is down", ErrorKindMasterDown, true},
+		{"CLUSTERDOWN Hash slot not served", ErrorKindClusterDown, true},
+		{"NOPERM this user has no permissions", ErrorKindNoPerm, false},
+		{"WRONGTYPE Operation against a key", ErrorKindWrongType, false},
+		{"OOM command not allowed", ErrorKindOOM, false},
+		{"BUSYKEY Target key name already exists.", ErrorKindOther, false},
+	}
+
+	for _, test := range tests {
+		kind := Error{E: errors.New(test.msg)}.Kind()
+		assert.Equal(t, test.kind, kind, test.msg)
+		assert.Equal(t, test.temp, kind.Temporary(), test.msg)
+	}
+	assert.Equal(t, "LOADING", ErrorKindLoading.String())
+	assert.Equal(t, "OTHER", ErrorKindOther.String())
+}
+
+func TestAnyUnmarshalNumbers(t *T) {
+	unmarshal := func(in string, into interface{}) error {
+		br := bufio.NewReader(bytes.NewBufferString(in))
+		err := Any{I: into}.UnmarshalRESP(br)
+		assert.Zero(t, br.Buffered(), in)
+		return err
+	}
+
+	{
+		i := new(big.Int)
+		require.NoError(t, unmarshal("$20\r\n12345678901234567890\r\n", i))
+		assert.Equal(t, "12345678901234567890", i.String())
+		require.NoError(t, unmarshal(":-5\r\n", i))
+		assert.Equal(t, int64(-5), i.Int64())
+	}
+
+	{
+		var f float64
+		require.NoError(t, unmarshal("$3\r\ninf\r\n", &f))
+		assert.True(t, math.IsInf(f, 1))
+		require.NoError(t, unmarshal("$4\r\n-inf\r\n", &f))
+		assert.True(t, math.IsInf(f, -1))
+		require.NoError(t, unmarshal("$3\r\nnan\r\n", &f))
+		assert.True(t, math.IsNaN(f))
+	}
+
+	// integers which don't fit should return a discarded error rather than
+	// being truncated
+	overflows := []struct {
+		in   string
+		into interface{}
+	}{
+		{":128\r\n", new(int8)},
+		{":-129\r\n", new(int8)},
+		{":70000\r\n", new(int16)},
+		{":4294967296\r\n", new(int32)},
+		{":256\r\n", new(uint8)},
+		{":-1\r\n", new(uint)},
+		{":9223372036854775808\r\n", new(int64)},
+		{"$20\r\n18446744073709551616\r\n", new(uint64)},
+	}
+	for _, o := range overflows {
+		err := unmarshal(o.in, o.into)
+		assert.Error(t, err, o.in)
+		assert.True(t, errors.As(err, new(resp.ErrDiscarded)), o.in)
+	}
+
+	var i8 int8
+	require.NoError(t, unmarshal(":-128\r\n", &i8))
+	assert.Equal(t, int8(-128), i8)
+}
+
+func TestAnyUnmarshalRESP3Numbers(t *T) {
+	unmarshal := func(in string, into interface{}) error {
+		br := bufio.NewReader(bytes.NewBufferString(in))
+		err := Any{I: into}.UnmarshalRESP(br)
+		assert.Zero(t, br.Buffered(), in)
+		return err
+	}
+
+	{
+		var f float64
+		require.NoError(t, unmarshal(",1.5\r\n", &f))
+		assert.Equal(t, 1.5, f)
+		require.NoError(t, unmarshal(",-1e3\r\n", &f))
+		assert.Equal(t, -1000.0, f)
+		require.NoError(t, unmarshal(",inf\r\n", &f))
+		assert.True(t, math.IsInf(f, 1))
+		require.NoError(t, unmarshal(",-inf\r\n", &f))
+		assert.True(t, math.IsInf(f, -1))
+		require.NoError(t, unmarshal(",nan\r\n", &f))
+		assert.True(t, math.IsNaN(f))
+
+		var f32 float32
+		require.NoError(t, unmarshal(",0.25\r\n", &f32))
+		assert.Equal(t, float32(0.25), f32)
+
+		var s string
+		require.NoError(t, unmarshal(",1.5\r\n", &s))
+		assert.Equal(t, "1.5", s)
+	}
+
+	{
+		i := new(big.Int)
+		require.NoError(t, unmarshal("(3492890328409238509324850943850943825024385\r\n", i))
+		assert.Equal(t, "3492890328409238509324850943850943825024385", i.String())
+		require.NoError(t, unmarshal("(-12\r\n", i))
+		assert.Equal(t, int64(-12), i.Int64())
+
+		var i64 int64
+		require.NoError(t, unmarshal("(12\r\n", &i64))
+		assert.Equal(t, int64(12), i64)
+
+		err := unmarshal("(18446744073709551616\r\n", &i64)
+		assert.True(t, errors.As(err, new(resp.ErrDiscarded)))
+		var ue *UnmarshalError
+		require.True(t, errors.As(err, &ue))
+		assert.Equal(t, "big-number", ue.RESPType)
+	}
+
+	{
+		var ii interface{}
+		require.NoError(t, unmarshal(",1.5\r\n", &ii))
+		assert.Equal(t, 1.5, ii)
+		require.NoError(t, unmarshal("(18446744073709551616\r\n", &ii))
+		require.IsType(t, new(big.Int), ii)
+		assert.Equal(t, "18446744073709551616", ii.(*big.Int).String())
+
+		var arr []interface{}
+		require.NoError(t, unmarshal("*3\r\n,2.5\r\n(7\r\n:1\r\n", &arr))
+		assert.Equal(t, []interface{}{2.5, big.NewInt(7), int64(1)}, arr)
+	}
+
+	// discarding, both directly and as part of an array
+	require.NoError(t, unmarshal(",1.5\r\n", nil))
+	require.NoError(t, unmarshal("*2\r\n(1\r\n,2\r\n", nil))
+
+	var rm RawMessage
+	require.NoError(t, unmarshal("*2\r\n(1\r\n,2\r\n", &rm))
+	assert.Equal(t, "*2\r\n(1\r\n,2\r\n", string(rm))
+}
+
+func TestAnyUnmarshalKeyValueArrays(t *T) {
+	// CONFIG GET
+	{
+		in := "*4\r\n$10\r\nmaxclients\r\n$5\r\n10000\r\n$7\r\ntimeout\r\n$1\r\n0\r\n"
+		var m map[string]int
+		require.NoError(t, Any{I: &m}.UnmarshalRESP(bufio.NewReader(strings.NewReader(in))))
+		assert.Equal(t, map[string]int{"maxclients": 10000, "timeout": 0}, m)
+	}
+
+	// XINFO GROUPS (a single group)
+	{
+		in := "*8\r\n" +
+			"$4\r\nname\r\n$6\r\ngroup1\r\n" +
+			"$9\r\nconsumers\r\n:2\r\n" +
+			"$7\r\npending\r\n:5\r\n" +
+			"$17\r\nlast-delivered-id\r\n$3\r\n1-0\r\n"
+		var group struct {
+			Name            string `redis:"name"`
+			Consumers       int    `redis:"consumers"`
+			Pending         int    `redis:"pending"`
+			LastDeliveredID string `redis:"last-delivered-id"`
+		}
+		require.NoError(t, Any{I: &group}.UnmarshalRESP(bufio.NewReader(strings.NewReader(in))))
+		assert.Equal(t, "group1", group.Name)
+		assert.Equal(t, 2, group.Consumers)
+		assert.Equal(t, 5, group.Pending)
+		assert.Equal(t, "1-0", group.LastDeliveredID)
+	}
+}
+
+func TestRawMessageArg(t *T) {
+	raw := RawMessage("$3\r\nbar\r\n")
+	a := Any{
+		I:                     []interface{}{"foo", raw, 1},
+		MarshalBulkString:     true,
+		MarshalNoArrayHeaders: true,
+	}
+	assert.Equal(t, 3, a.NumElems())
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, a.MarshalRESP(buf))
+	assert.Equal(t, "$3\r\nfoo\r\n$3\r\nbar\r\n$1\r\n1\r\n", buf.String())
+}
+
+func TestRawCapture(t *T) {
+	in := "*2\r\n$3\r\nfoo\r\n:1\r\n-ERR bad\r\n"
+	br := bufio.NewReader(strings.NewReader(in))
+
+	var raw RawMessage
+	var into []string
+	require.NoError(t, RawCapture{Raw: &raw, I: &into}.UnmarshalRESP(br))
+	assert.Equal(t, "*2\r\n$3\r\nfoo\r\n:1\r\n", string(raw))
+	assert.Equal(t, []string{"foo", "1"}, into)
+
+	err := RawCapture{Raw: &raw, I: &into}.UnmarshalRESP(br)
+	assert.True(t, errors.As(err, new(Error)))
+	assert.Equal(t, "-ERR bad\r\n", string(raw))
+}
+
+func TestReaderWriter(t *T) {
+	buf := new(bytes.Buffer)
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteArrayHeader(6))
+	require.NoError(t, w.WriteSimpleString("OK"))
+	require.NoError(t, w.WriteError("ERR bad"))
+	require.NoError(t, w.WriteInt(-5))
+	require.NoError(t, w.WriteBulkString([]byte("foo")))
+	require.NoError(t, w.WriteNil())
+	require.NoError(t, w.WriteArrayHeader(-1))
+	assert.Zero(t, buf.Len())
+	require.NoError(t, w.Flush())
+
+	exp := "*6\r\n+OK\r\n-ERR bad\r\n:-5\r\n$3\r\nfoo\r\n$-1\r\n*-1\r\n"
+	assert.Equal(t, exp, buf.String())
+
+	m, err := NewReader(buf).ReadAny()
+	require.NoError(t, err)
+	assert.Equal(t, Message{Type: TypeArray, Array: []Message{
+		{Type: TypeSimpleString, Str: []byte("OK")},
+		{Type: TypeError, Str: []byte("ERR bad")},
+		{Type: TypeInt, Int: -5},
+		{Type: TypeBulkString, Str: []byte("foo")},
+		{Type: TypeBulkString, Nil: true},
+		{Type: TypeArray, Nil: true},
+	}}, m)
+	assert.Equal(t, "array", m.Type.String())
+
+	// a Message should marshal back to exactly what was read
+	require.NoError(t, w.Write(m))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, exp, buf.String())
+
+	_, err = NewReader(strings.NewReader("*-2\r\n")).ReadAny()
+	assert.Error(t, err)
+}
+
+func TestServe(t *T) {
+	mux := NewServeMux()
+	mux.HandleFunc("PING", func(w *Writer, args [][]byte) {
+		w.WriteSimpleString("PONG")
+	})
+	mux.HandleFunc("echo", func(w *Writer, args [][]byte) {
+		if len(args) != 2 {
+			w.WriteError("ERR wrong number of arguments for 'echo' command")
+			return
+		}
+		w.WriteBulkString(args[1])
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go Serve(l, mux)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// pipeline commands in both the RESP and inline forms
+	_, err = conn.Write([]byte("*1\r\n$4\r\nping\r\nECHO hi\r\n\r\n*1\r\n$3\r\nFOO\r\n*1\r\n$4\r\nECHO\r\n"))
+	require.NoError(t, err)
+
+	r := NewReader(conn)
+	for _, exp := range []Message{
+		{Type: TypeSimpleString, Str: []byte("PONG")},
+		{Type: TypeBulkString, Str: []byte("hi")},
+		{Type: TypeError, Str: []byte("ERR unknown command 'FOO'")},
+		{Type: TypeError, Str: []byte("ERR wrong number of arguments for 'echo' command")},
+	} {
+		m, err := r.ReadAny()
+		require.NoError(t, err)
+		assert.Equal(t, exp, m)
+	}
+
+	_, err = conn.Write([]byte("*1\r\n:1\r\n"))
+	require.NoError(t, err)
+	m, err := r.ReadAny()
+	require.NoError(t, err)
+	assert.Equal(t, TypeError, m.Type)
+	assert.True(t, bytes.HasPrefix(m.Str, []byte("ERR Protocol error")))
+	_, err = r.ReadAny()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestAnyUnmarshalRESP3MapsVerbatim(t *T) {
+	unmarshal := func(in string, into interface{}) error {
+		br := bufio.NewReader(bytes.NewBufferString(in))
+		err := Any{I: into}.UnmarshalRESP(br)
+		assert.Zero(t, br.Buffered(), in)
+		return err
+	}
+
+	// CONFIG GET
+	{
+		in := "%2\r\n$10\r\nmaxclients\r\n$5\r\n10000\r\n$7\r\ntimeout\r\n$1\r\n0\r\n"
+		var m map[string]int
+		require.NoError(t, unmarshal(in, &m))
+		assert.Equal(t, map[string]int{"maxclients": 10000, "timeout": 0}, m)
+
+		var s []string
+		require.NoError(t, unmarshal(in, &s))
+		assert.Equal(t, []string{"maxclients", "10000", "timeout", "0"}, s)
+
+		var ii interface{}
+		require.NoError(t, unmarshal(in, &ii))
+		assert.Equal(t, map[string]interface{}{
+			"maxclients": []byte("10000"),
+			"timeout":    []byte("0"),
+		}, ii)
+	}
+
+	// XINFO GROUPS (a single group, nested in an array)
+	{
+		in := "*1\r\n%4\r\n" +
+			"+name\r\n$6\r\ngroup1\r\n" +
+			"+consumers\r\n:2\r\n" +
+			"+pending\r\n:5\r\n" +
+			"+last-delivered-id\r\n$3\r\n1-0\r\n"
+		type group struct {
+			Name            string `redis:"name"`
+			Consumers       int    `redis:"consumers"`
+			Pending         int    `redis:"pending"`
+			LastDeliveredID string `redis:"last-delivered-id"`
+		}
+		var groups []group
+		require.NoError(t, unmarshal(in, &groups))
+		assert.Equal(t, []group{{
+			Name:            "group1",
+			Consumers:       2,
+			Pending:         5,
+			LastDeliveredID: "1-0",
+		}}, groups)
+	}
+
+	// errors within a map are reported as being within it, and the rest of the
+	// map is discarded
+	{
+		var m map[string]int
+		err := unmarshal("%2\r\n+a\r\n+b\r\n+c\r\n:1\r\n", &m)
+		var ue *UnmarshalError
+		require.True(t, errors.As(err, &ue))
+		assert.True(t, errors.As(err, new(resp.ErrDiscarded)))
+		assert.Equal(t, []int{1}, ue.Path)
+
+		var i int
+		err = unmarshal("%1\r\n+a\r\n:1\r\n", &i)
+		require.True(t, errors.As(err, &ue))
+		assert.Equal(t, "map", ue.RESPType)
+	}
+
+	// LOLWUT
+	{
+		in := "=16\r\ntxt:Redis ver. 7\r\n"
+		var s string
+		require.NoError(t, unmarshal(in, &s))
+		assert.Equal(t, "Redis ver. 7", s)
+
+		var b []byte
+		require.NoError(t, unmarshal(in, &b))
+		assert.Equal(t, []byte("Redis ver. 7"), b)
+
+		var ii interface{}
+		require.NoError(t, unmarshal(in, &ii))
+		assert.Equal(t, "Redis ver. 7", ii)
+
+		var i int
+		require.NoError(t, unmarshal("=6\r\ntxt:42\r\n", &i))
+		assert.Equal(t, 42, i)
+	}
+
+	// discarding, both directly and as part of an array
+	require.NoError(t, unmarshal("%1\r\n+a\r\n=5\r\ntxt:b\r\n", nil))
+	require.NoError(t, unmarshal("*2\r\n%1\r\n+a\r\n:1\r\n=5\r\ntxt:b\r\n", nil))
+
+	var rm RawMessage
+	in := "*2\r\n%1\r\n+a\r\n:1\r\n=5\r\ntxt:b\r\n"
+	require.NoError(t, unmarshal(in, &rm))
+	assert.Equal(t, in, string(rm))
+}
@@ -0,0 +1,242 @@
+package resp2
+
+import (
+	"bufio"
+	"io"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/internal/bytesutil"
+	"github.com/mediocregopher/radix/v3/resp"
+)
+
+// Writer writes RESP messages to an underlying io.Writer. It's intended for
+// building proxies, fake servers, and other tooling which needs to speak RESP
+// directly, rather than via a radix Conn.
+//
+// Messages are buffered, Flush must be called to write them to the underlying
+// io.Writer. A Writer is not safe for concurrent use.
+type Writer struct {
+	bw *bufio.Writer
+}
+
+// NewWriter returns a Writer which writes to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{bw: bufio.NewWriter(w)}
+}
+
+// WriteSimpleString writes a simple string message.
+func (w *Writer) WriteSimpleString(s string) error {
+	return SimpleString{S: s}.MarshalRESP(w.bw)
+}
+
+// WriteError writes an error message. msg should not contain CR or LF.
+func (w *Writer) WriteError(msg string) error {
+	return Error{E: errors.New(msg)}.MarshalRESP(w.bw)
+}
+
+// WriteInt writes an integer message.
+func (w *Writer) WriteInt(i int64) error {
+	return Int{I: i}.MarshalRESP(w.bw)
+}
+
+// WriteBulkString writes a bulk string message. A nil b is written as an empty
+// bulk string, use WriteNil to write a nil bulk string.
+func (w *Writer) WriteBulkString(b []byte) error {
+	return BulkStringBytes{B: b, MarshalNotNil: true}.MarshalRESP(w.bw)
+}
+
+// WriteNil writes a nil bulk string message.
+func (w *Writer) WriteNil() error {
+	_, err := w.bw.Write(nilBulkString)
+	return err
+}
+
+// WriteArrayHeader writes the header of an array message with n elements,
+// which must then be written individually. An n of -1 writes a nil array.
+func (w *Writer) WriteArrayHeader(n int) error {
+	return ArrayHeader{N: n}.MarshalRESP(w.bw)
+}
+
+// Write writes the message marshaled by m, e.g. a Message returned from
+// Reader.ReadAny, or any of the other types in this package.
+func (w *Writer) Write(m resp.Marshaler) error {
+	return m.MarshalRESP(w.bw)
+}
+
+// Flush writes any buffered messages to the underlying io.Writer.
+func (w *Writer) Flush() error {
+	return w.bw.Flush()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Type is the type of a RESP message. Its value is the prefix denoting the type
+// on the wire.
+type Type byte
+
+// Enumeration of the possible values of Type.
+const (
+	TypeSimpleString Type = '+'
+	TypeError        Type = '-'
+	TypeInt          Type = ':'
+	TypeBulkString   Type = '$'
+	TypeArray        Type = '*'
+)
+
+// String returns a human-readable name for the Type.
+func (t Type) String() string {
+	return prefix{byte(t)}.String()
+}
+
+// Message is a single RESP message of any type, as returned by Reader.ReadAny.
+// Which of its fields are used depends on its Type.
+//
+// Message implements resp.Marshaler, and so can be written as-is using a
+// Writer, e.g. when forwarding it on as a proxy would.
+type Message struct {
+	Type Type
+
+	// Nil is true for a nil bulk string or nil array.
+	Nil bool
+
+	// Str is the value of a simple string, error, or bulk string.
+	Str []byte
+
+	// Int is the value of an integer.
+	Int int64
+
+	// Array is the elements of an array.
+	Array []Message
+}
+
+// MarshalRESP implements the Marshaler method.
+func (m Message) MarshalRESP(w io.Writer) error {
+	switch m.Type {
+	case TypeSimpleString:
+		return SimpleString{S: string(m.Str)}.MarshalRESP(w)
+	case TypeError:
+		return Error{E: errors.New(string(m.Str))}.MarshalRESP(w)
+	case TypeInt:
+		return Int{I: m.Int}.MarshalRESP(w)
+	case TypeBulkString:
+		if m.Nil {
+			_, err := w.Write(nilBulkString)
+			return err
+		}
+		return BulkStringBytes{B: m.Str, MarshalNotNil: true}.MarshalRESP(w)
+	case TypeArray:
+		if m.Nil {
+			_, err := w.Write(nilArray)
+			return err
+		} else if err := (ArrayHeader{N: len(m.Array)}).MarshalRESP(w); err != nil {
+			return err
+		}
+		for _, el := range m.Array {
+			if err := el.MarshalRESP(w); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return errors.Errorf("unknown message type %q", byte(m.Type))
+	}
+}
+
+// Reader reads RESP messages from an underlying io.Reader. It's the
+// counterpart of Writer.
+//
+// A Reader is not safe for concurrent use.
+type Reader struct {
+	br *bufio.Reader
+}
+
+// NewReader returns a Reader which reads from r. If r is a *bufio.Reader it's
+// used directly.
+func NewReader(r io.Reader) *Reader {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Reader{br: br}
+}
+
+// Read reads a single message into u, e.g. an Any or any of the other types in
+// this package.
+func (r *Reader) Read(u resp.Unmarshaler) error {
+	return u.UnmarshalRESP(r.br)
+}
+
+// ReadAny reads a single message of any type. Unlike Any, error messages are
+// returned as a Message of TypeError, rather than as an error, so that they can
+// be inspected or forwarded like any other message.
+func (r *Reader) ReadAny() (Message, error) {
+	var m Message
+	err := m.unmarshal(r.br)
+	return m, err
+}
+
+func (m *Message) unmarshal(br *bufio.Reader) error {
+	b, err := bytesutil.BufferedBytesDelim(br)
+	if err != nil {
+		return err
+	} else if len(b) == 0 {
+		return errors.New("malformed resp: empty line")
+	}
+
+	*m = Message{Type: Type(b[0])}
+	switch m.Type {
+	case TypeSimpleString, TypeError:
+		m.Str = append([]byte{}, b[1:]...)
+		return nil
+	case TypeInt:
+		m.Int, err = bytesutil.ParseInt(b[1:])
+		return err
+	case TypeBulkString:
+		n, err := bytesutil.ParseInt(b[1:])
+		if err != nil {
+			return err
+		} else if n == -1 {
+			m.Nil = true
+			return nil
+		} else if n < 0 {
+			return errors.Errorf("malformed resp: invalid length %d", n)
+		}
+		if m.Str, err = bytesutil.ReadNAppend(br, []byte{}, int(n)); err != nil {
+			return err
+		}
+		_, err = bytesutil.BufferedBytesDelim(br)
+		return err
+	case TypeArray:
+		n, err := bytesutil.ParseInt(b[1:])
+		if err != nil {
+			return err
+		} else if n == -1 {
+			m.Nil = true
+			return nil
+		} else if n < 0 {
+			return errors.Errorf("malformed resp: invalid length %d", n)
+		}
+
+		// the length comes off the wire, possibly from an untrusted client, so
+		// don't trust it when allocating.
+		m.Array = make([]Message, 0, minInt64(n, 128))
+		for i := int64(0); i < n; i++ {
+			var el Message
+			if err := el.unmarshal(br); err != nil {
+				return err
+			}
+			m.Array = append(m.Array, el)
+		}
+		return nil
+	default:
+		return errors.Errorf("unknown type prefix %q", b[0])
+	}
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
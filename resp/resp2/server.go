@@ -0,0 +1,215 @@
+package resp2
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	errors "golang.org/x/xerrors"
+)
+
+// ServerConn is the server side of a connection from a RESP client, e.g. a
+// radix Conn or redis-cli. It reads commands sent by the client, and writes
+// replies to them using its embedded Writer.
+//
+// ServerConn, along with ServeMux and Serve, allow services which speak the
+// redis protocol to be built, so that they can be used with any redis client.
+type ServerConn struct {
+	*Writer
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// NewServerConn wraps the given net.Conn, which should have been accepted from
+// a net.Listener, in a ServerConn.
+func NewServerConn(conn net.Conn) *ServerConn {
+	return &ServerConn{
+		Writer: NewWriter(conn),
+		conn:   conn,
+		br:     bufio.NewReader(conn),
+	}
+}
+
+// NetConn returns the underlying net.Conn.
+func (sc *ServerConn) NetConn() net.Conn {
+	return sc.conn
+}
+
+// Close closes the underlying net.Conn.
+func (sc *ServerConn) Close() error {
+	return sc.conn.Close()
+}
+
+// Buffered returns whether there is input from the client which has been
+// read off the connection but not yet returned from ReadCommand, i.e. whether
+// the client has pipelined further commands. Servers can use this to avoid
+// calling Flush until the replies to all pipelined commands have been written.
+func (sc *ServerConn) Buffered() bool {
+	return sc.br.Buffered() > 0
+}
+
+// ReadCommand reads the next command sent by the client, returning it as its
+// name followed by its arguments. Commands may be sent either as RESP arrays of
+// bulk strings, as clients normally send them, or as inline commands, i.e. a
+// line of space separated arguments, as is done when using telnet.
+//
+// Empty commands are skipped. If the client sends a malformed command an error
+// is returned, and the connection should be closed.
+func (sc *ServerConn) ReadCommand() ([][]byte, error) {
+	for {
+		b, err := sc.br.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+
+		var args [][]byte
+		if b[0] == ArrayPrefix[0] {
+			args, err = sc.readArrayCommand()
+		} else {
+			args, err = sc.readInlineCommand()
+		}
+		if err != nil {
+			return nil, err
+		} else if len(args) > 0 {
+			return args, nil
+		}
+	}
+}
+
+func (sc *ServerConn) readArrayCommand() ([][]byte, error) {
+	var ah ArrayHeader
+	if err := ah.UnmarshalRESP(sc.br); err != nil {
+		return nil, err
+	} else if ah.N < 0 {
+		return nil, nil
+	}
+
+	args := make([][]byte, 0, minInt64(int64(ah.N), 128))
+	for i := 0; i < ah.N; i++ {
+		var bs BulkStringBytes
+		if err := bs.UnmarshalRESP(sc.br); err != nil {
+			return nil, errors.Errorf("reading argument %d of command: %w", i, err)
+		}
+		args = append(args, bs.B)
+	}
+	return args, nil
+}
+
+func (sc *ServerConn) readInlineCommand() ([][]byte, error) {
+	line, err := sc.br.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, errors.New("inline command too long")
+	} else if err != nil {
+		return nil, err
+	}
+
+	var args [][]byte
+	for _, arg := range bytes.Fields(line) {
+		args = append(args, append([]byte{}, arg...))
+	}
+	return args, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// Handler responds to commands read by a ServerConn.
+//
+// ServeRESP is given the command, as returned by ServerConn.ReadCommand, and
+// must write exactly one reply to it using w. It need not call Flush.
+type Handler interface {
+	ServeRESP(w *Writer, args [][]byte)
+}
+
+// HandlerFunc is a function which implements the Handler interface.
+type HandlerFunc func(w *Writer, args [][]byte)
+
+// ServeRESP implements the method for the Handler interface.
+func (hf HandlerFunc) ServeRESP(w *Writer, args [][]byte) {
+	hf(w, args)
+}
+
+// ServeMux is a Handler which dispatches commands to other Handlers based on
+// their name, which is matched case-insensitively. Commands which have no
+// Handler get an error reply, as they would from redis.
+//
+// ServeMux is safe for concurrent use.
+type ServeMux struct {
+	l sync.RWMutex
+	m map[string]Handler
+}
+
+// NewServeMux returns an empty ServeMux.
+func NewServeMux() *ServeMux {
+	return &ServeMux{m: map[string]Handler{}}
+}
+
+// Handle registers the Handler for the given command, replacing any previously
+// registered one.
+func (mux *ServeMux) Handle(cmd string, h Handler) {
+	mux.l.Lock()
+	defer mux.l.Unlock()
+	mux.m[strings.ToUpper(cmd)] = h
+}
+
+// HandleFunc is like Handle, but takes a function.
+func (mux *ServeMux) HandleFunc(cmd string, fn func(w *Writer, args [][]byte)) {
+	mux.Handle(cmd, HandlerFunc(fn))
+}
+
+// ServeRESP implements the method for the Handler interface.
+func (mux *ServeMux) ServeRESP(w *Writer, args [][]byte) {
+	mux.l.RLock()
+	h, ok := mux.m[strings.ToUpper(string(args[0]))]
+	mux.l.RUnlock()
+	if !ok {
+		w.WriteError("ERR unknown command '" + string(args[0]) + "'")
+		return
+	}
+	h.ServeRESP(w, args)
+}
+
+// ServeConn reads commands off the given ServerConn and passes them to the
+// Handler until an error is encountered, which is returned. The ServerConn is
+// closed when ServeConn returns. Replies are flushed once all commands the
+// client has pipelined have been handled.
+//
+// If the client sends a malformed command an error reply is written to it
+// before the ServerConn is closed. A client closing its connection results in
+// io.EOF being returned.
+func ServeConn(sc *ServerConn, h Handler) error {
+	defer sc.Close()
+	for {
+		args, err := sc.ReadCommand()
+		if err != nil {
+			var netErr net.Error
+			if !errors.As(err, &netErr) && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				sc.WriteError("ERR Protocol error: " + err.Error())
+				sc.Flush()
+			}
+			return err
+		}
+
+		h.ServeRESP(sc.Writer, args)
+		if sc.Buffered() {
+			continue
+		} else if err := sc.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// Serve accepts connections from the given net.Listener, and serves each of
+// them using ServeConn in its own go-routine. It returns the error returned
+// from the net.Listener's Accept method, e.g. once the net.Listener is closed.
+func Serve(l net.Listener, h Handler) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go ServeConn(NewServerConn(conn), h)
+	}
+}
@@ -0,0 +1,127 @@
+package radix
+
+import (
+	"strconv"
+	"time"
+)
+
+// This file contains a library of EvalScripts which implement common atomic
+// operations which redis doesn't provide as a single command.
+
+func durationMS(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Millisecond), 10)
+}
+
+var compareAndSetScript = NewEvalScript(1, `
+	if redis.call("GET", KEYS[1]) == ARGV[1] then
+		redis.call("SET", KEYS[1], ARGV[2])
+		return 1
+	end
+	return 0
+`)
+
+// CompareAndSet returns an Action which atomically sets key to value, but only
+// if its current value is expected. rcv, which may be nil, will be set to
+// whether or not the value was set.
+func CompareAndSet(rcv *bool, key, expected, value string) Action {
+	return compareAndSetScript.Cmd(boolRcv(rcv), key, expected, value)
+}
+
+var compareAndDeleteScript = NewEvalScript(1, `
+	if redis.call("GET", KEYS[1]) == ARGV[1] then
+		return redis.call("DEL", KEYS[1])
+	end
+	return 0
+`)
+
+// CompareAndDelete returns an Action which atomically deletes key, but only if
+// its current value is expected. This is commonly used to release a lock only
+// if it's still held by the releaser. rcv, which may be nil, will be set to
+// whether or not the key was deleted.
+func CompareAndDelete(rcv *bool, key, expected string) Action {
+	return compareAndDeleteScript.Cmd(boolRcv(rcv), key, expected)
+}
+
+var getAndExpireScript = NewEvalScript(1, `
+	local v = redis.call("GET", KEYS[1])
+	if v then
+		redis.call("PEXPIRE", KEYS[1], ARGV[1])
+	end
+	return v
+`)
+
+// GetAndExpire returns an Action which atomically gets the value of key and
+// sets its expiration to the given TTL, if the key exists. The value is
+// unmarshaled into rcv, which follows the same rules as for Cmd. If the key
+// doesn't exist a nil value is returned, which can be detected using MaybeNil.
+//
+// This is equivalent to GETEX with the PX option, which requires redis 6.2 or
+// later.
+func GetAndExpire(rcv interface{}, key string, ttl time.Duration) Action {
+	return getAndExpireScript.Cmd(rcv, key, durationMS(ttl))
+}
+
+var popManyScript = NewEvalScript(1, `
+	local n = tonumber(ARGV[1])
+	if n <= 0 then
+		return {}
+	end
+	local vals = redis.call("LRANGE", KEYS[1], 0, n - 1)
+	redis.call("LTRIM", KEYS[1], n, -1)
+	return vals
+`)
+
+// PopMany returns an Action which atomically pops up to n elements from the
+// head of the list at key, unmarshaling them into rcv.
+//
+// This is equivalent to LPOP with a count, which requires redis 6.2 or later.
+func PopMany(rcv interface{}, key string, n int) Action {
+	return popManyScript.Cmd(rcv, key, strconv.Itoa(n))
+}
+
+var rateLimitedIncrScript = NewEvalScript(1, `
+	local n = tonumber(redis.call("GET", KEYS[1]) or "0")
+	if n >= tonumber(ARGV[1]) then
+		return 0
+	end
+	if redis.call("INCR", KEYS[1]) == 1 then
+		redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	end
+	return 1
+`)
+
+// RateLimitedIncr returns an Action which implements a fixed-window rate
+// limiter. The counter at key is incremented, but only if it is less than
+// limit, and is set to expire after the given window when it's first created.
+// rcv, which may be nil, will be set to whether or not the counter was
+// incremented, i.e. whether the operation being rate limited is allowed.
+func RateLimitedIncr(rcv *bool, key string, limit int, window time.Duration) Action {
+	return rateLimitedIncrScript.Cmd(boolRcv(rcv), key, strconv.Itoa(limit), durationMS(window))
+}
+
+var moveIfExistsScript = NewEvalScript(2, `
+	if redis.call("EXISTS", KEYS[1]) == 1 then
+		redis.call("RENAME", KEYS[1], KEYS[2])
+		return 1
+	end
+	return 0
+`)
+
+// MoveIfExists returns an Action which atomically renames src to dst, but only
+// if src exists, overwriting dst if it exists. Unlike RENAME it's not an error
+// for src not to exist. rcv, which may be nil, will be set to whether or not
+// src was renamed.
+//
+// NOTE that when using a Cluster both keys must belong to the same slot.
+func MoveIfExists(rcv *bool, src, dst string) Action {
+	return moveIfExistsScript.Cmd(boolRcv(rcv), src, dst)
+}
+
+// boolRcv prevents a nil *bool from being used as a receiver, since a typed nil
+// pointer can't be unmarshaled into.
+func boolRcv(rcv *bool) interface{} {
+	if rcv == nil {
+		return nil
+	}
+	return rcv
+}
@@ -0,0 +1,59 @@
+package radix
+
+import (
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScripts(t *T) {
+	c := dial()
+	defer c.Close()
+
+	key, key2 := randStr(), randStr()
+	var ok bool
+
+	require.NoError(t, c.Do(Cmd(nil, "SET", key, "a")))
+	require.NoError(t, c.Do(CompareAndSet(&ok, key, "b", "c")))
+	assert.False(t, ok)
+	require.NoError(t, c.Do(CompareAndSet(&ok, key, "a", "b")))
+	assert.True(t, ok)
+
+	var val string
+	require.NoError(t, c.Do(GetAndExpire(&val, key, time.Minute)))
+	assert.Equal(t, "b", val)
+	var pttl int
+	require.NoError(t, c.Do(Cmd(&pttl, "PTTL", key)))
+	assert.True(t, pttl > 0 && pttl <= 60000)
+
+	mn := MaybeNil{Rcv: &val}
+	require.NoError(t, c.Do(GetAndExpire(&mn, randStr(), time.Minute)))
+	assert.True(t, mn.Nil)
+
+	require.NoError(t, c.Do(MoveIfExists(&ok, key, key2)))
+	assert.True(t, ok)
+	require.NoError(t, c.Do(MoveIfExists(&ok, key, key2)))
+	assert.False(t, ok)
+
+	require.NoError(t, c.Do(CompareAndDelete(&ok, key2, "a")))
+	assert.False(t, ok)
+	require.NoError(t, c.Do(CompareAndDelete(&ok, key2, "b")))
+	assert.True(t, ok)
+
+	require.NoError(t, c.Do(Cmd(nil, "RPUSH", key, "1", "2", "3")))
+	var vals []string
+	require.NoError(t, c.Do(PopMany(&vals, key, 2)))
+	assert.Equal(t, []string{"1", "2"}, vals)
+	require.NoError(t, c.Do(PopMany(&vals, key, 0)))
+	assert.Empty(t, vals)
+	require.NoError(t, c.Do(PopMany(&vals, key, 5)))
+	assert.Equal(t, []string{"3"}, vals)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, c.Do(RateLimitedIncr(&ok, key2, 2, time.Minute)))
+		assert.Equal(t, i < 2, ok, "i:%d", i)
+	}
+	require.NoError(t, c.Do(RateLimitedIncr(nil, key2, 2, time.Minute)))
+}
@@ -10,8 +10,9 @@ import (
 )
 
 type sentinelOpts struct {
-	cf ConnFunc
-	pf ClientFunc
+	cf      ConnFunc
+	pf      ClientFunc
+	backoff Backoff
 }
 
 // SentinelOpt is an optional behavior which can be applied to the NewSentinel
@@ -40,6 +41,15 @@ func SentinelPoolFunc(pf ClientFunc) SentinelOpt {
 	}
 }
 
+// SentinelReconnectBackoff sets the Backoff used to determine how long the
+// Sentinel waits after failing to connect to a sentinel instance, or losing
+// its connection to one, before trying again.
+func SentinelReconnectBackoff(b Backoff) SentinelOpt {
+	return func(so *sentinelOpts) {
+		so.backoff = b
+	}
+}
+
 // Sentinel is a Client which, in the background, connects to an available
 // sentinel node and handles all of the following:
 //
@@ -93,6 +103,7 @@ type Sentinel struct {
 //
 //	SentinelConnFunc(DefaultConnFunc)
 //	SentinelPoolFunc(DefaultClientFunc)
+//	SentinelReconnectBackoff(ExponentialBackoff(1 * time.Second, 10 * time.Second, 0.5))
 //
 func NewSentinel(primaryName string, sentinelAddrs []string, opts ...SentinelOpt) (*Sentinel, error) {
 	addrs := map[string]bool{}
@@ -116,6 +127,7 @@ func NewSentinel(primaryName string, sentinelAddrs []string, opts ...SentinelOpt
 	sc.so.cf = wrapDefaultConnFunc(sentinelAddrs[0])
 	defaultSentinelOpts := []SentinelOpt{
 		SentinelPoolFunc(DefaultClientFunc),
+		SentinelReconnectBackoff(ExponentialBackoff(1*time.Second, 10*time.Second, 0.5)),
 	}
 
 	for _, opt := range append(defaultSentinelOpts, opts...) {
@@ -145,9 +157,12 @@ func NewSentinel(primaryName string, sentinelAddrs []string, opts ...SentinelOpt
 	}
 
 	// because we're using persistent these can't _really_ fail
-	sc.pconn = PersistentPubSub("", "", func(_, _ string) (Conn, error) {
-		return sc.dialSentinel()
-	})
+	sc.pconn, _ = PersistentPubSubWithOpts("", "",
+		PersistentPubSubConnFunc(func(_, _ string) (Conn, error) {
+			return sc.dialSentinel()
+		}),
+		PersistentPubSubReconnectBackoff(sc.so.backoff),
+	)
 	sc.pconn.Subscribe(sc.pconnCh, "switch-master")
 
 	sc.closeWG.Add(1)
@@ -313,7 +328,7 @@ func (sc *Sentinel) clientInner(addr string) (Client, error) {
 
 // Close implements the method for the Client interface.
 func (sc *Sentinel) Close() error {
-	closeErr := errClientClosed
+	closeErr := ErrClientClosed
 	sc.closeOnce.Do(func() {
 		close(sc.closeCh)
 		sc.closeWG.Wait()
@@ -451,11 +466,13 @@ func (sc *Sentinel) ensureSentinelAddrs(conn Conn) error {
 func (sc *Sentinel) spin() {
 	defer sc.closeWG.Done()
 	defer sc.pconn.Close()
+	var failures int
 	for {
-		if err := sc.innerSpin(); err != nil {
+		if err := sc.innerSpin(&failures); err != nil {
 			sc.err(err)
-			// sleep a second so we don't end up in a tight loop
-			time.Sleep(1 * time.Second)
+			// back off so we don't end up in a tight loop
+			failures++
+			time.Sleep(sc.so.backoff.Next(failures))
 		}
 		// This also gets checked within innerSpin to short-circuit that, but
 		// we also must check in here to short-circuit this
@@ -476,12 +493,15 @@ func (sc *Sentinel) spin() {
 // * Periodically re-ensuring that the list of sentinel addresses is up-to-date
 // * Periodically re-checking the current primary, in case the switch-master was
 //   missed somehow
-func (sc *Sentinel) innerSpin() error {
+//
+// failures is reset to zero once a connection has been made.
+func (sc *Sentinel) innerSpin(failures *int) error {
 	conn, err := sc.dialSentinel()
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
+	*failures = 0
 
 	tick := time.NewTicker(5 * time.Second)
 	defer tick.Stop()
@@ -0,0 +1,312 @@
+package radix
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+	errors "golang.org/x/xerrors"
+)
+
+// ServerFlavor describes which implementation of the redis protocol a server
+// is running.
+type ServerFlavor string
+
+// All ServerFlavors which can be detected by GetServerInfo.
+const (
+	ServerFlavorRedis     ServerFlavor = "redis"
+	ServerFlavorValkey    ServerFlavor = "valkey"
+	ServerFlavorKeyDB     ServerFlavor = "keydb"
+	ServerFlavorDragonfly ServerFlavor = "dragonfly"
+)
+
+// ServerFeature describes a feature of redis which isn't available on every
+// server, either because it was added in a later version or because a
+// particular ServerFlavor doesn't implement it.
+type ServerFeature string
+
+// All ServerFeatures which ServerInfo knows about.
+const (
+	// FeatureRESP3 is the RESP3 protocol, negotiated using HELLO.
+	FeatureRESP3 ServerFeature = "resp3"
+
+	// FeatureClientTracking is server-assisted client side caching, enabled
+	// using CLIENT TRACKING.
+	FeatureClientTracking ServerFeature = "client-tracking"
+
+	// FeatureShardedPubSub is sharded pubsub, i.e. SSUBSCRIBE, SPUBLISH and
+	// PUBSUB SHARDCHANNELS/SHARDNUMSUB.
+	FeatureShardedPubSub ServerFeature = "sharded-pubsub"
+
+	// FeatureGetEx is the GETEX command, see GetEx.
+	FeatureGetEx ServerFeature = "getex"
+
+	// FeatureObjectFreq is the OBJECT FREQ command, see ObjectFreq.
+	FeatureObjectFreq ServerFeature = "object-freq"
+
+	// FeatureFunctions is redis functions, i.e. the FUNCTION and FCALL
+	// commands, see FunctionLoad and FCall.
+	FeatureFunctions ServerFeature = "functions"
+)
+
+// moduleFeaturePrefix is the prefix of all ServerFeatures returned by
+// ModuleFeature.
+const moduleFeaturePrefix = "module:"
+
+// ModuleFeature returns the ServerFeature of the redis module with the given
+// name (as reported by MODULE LIST, e.g. "search" or "ReJSON"). The
+// ServerFeature is supported if the module is loaded.
+func ModuleFeature(name string) ServerFeature {
+	return ServerFeature(moduleFeaturePrefix + strings.ToLower(name))
+}
+
+// ServerInfo describes the server a Client is connected to, as reported by
+// INFO server.
+type ServerInfo struct {
+	Flavor ServerFlavor
+
+	// Version is the version of the server itself, e.g. the value of
+	// valkey_version for ServerFlavorValkey or dragonfly_version for
+	// ServerFlavorDragonfly.
+	Version string
+
+	// RedisVersion is the redis version which the server reports being
+	// compatible with, i.e. the value of redis_version. For ServerFlavorRedis
+	// this is the same as Version.
+	RedisVersion string
+
+	// Mode is the value of redis_mode, e.g. "standalone" or "cluster". It may
+	// be empty if the server doesn't report it.
+	Mode string
+
+	// Modules are the lowercased names of the modules loaded by the server,
+	// as reported by INFO modules.
+	Modules []string
+}
+
+// parseVersion parses a dotted version string into its numeric components.
+// Anything following the numeric components (e.g. "-rc1") is ignored.
+func parseVersion(v string) []int {
+	var res []int
+	for _, part := range strings.Split(v, ".") {
+		end := 0
+		for end < len(part) && part[end] >= '0' && part[end] <= '9' {
+			end++
+		}
+		n, err := strconv.Atoi(part[:end])
+		if err != nil {
+			break
+		}
+		res = append(res, n)
+		if end < len(part) {
+			break
+		}
+	}
+	return res
+}
+
+// versionAtLeast returns whether the version v is at least the version min.
+func versionAtLeast(v, min string) bool {
+	vv, mv := parseVersion(v), parseVersion(min)
+	for i := range mv {
+		if i >= len(vv) {
+			return false
+		} else if vv[i] != mv[i] {
+			return vv[i] > mv[i]
+		}
+	}
+	return true
+}
+
+// AtLeast returns whether the server's RedisVersion is at least the given
+// version, e.g. "6.2" or "7.0.0".
+func (si ServerInfo) AtLeast(version string) bool {
+	return versionAtLeast(si.RedisVersion, version)
+}
+
+// Supports returns whether the server supports the given ServerFeature. This is
+// decided based on the server's Flavor and version, so it's a best-effort
+// answer; the server may still have the feature disabled by its
+// configuration.
+func (si ServerInfo) Supports(f ServerFeature) bool {
+	if strings.HasPrefix(string(f), moduleFeaturePrefix) {
+		name := string(f[len(moduleFeaturePrefix):])
+		for _, mod := range si.Modules {
+			if mod == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch si.Flavor {
+	case ServerFlavorDragonfly:
+		// dragonfly implements RESP3, CLIENT TRACKING and GETEX, but none of
+		// the rest.
+		return f == FeatureRESP3 || f == FeatureClientTracking || f == FeatureGetEx
+	case ServerFlavorKeyDB:
+		// KeyDB forked from redis 6 and hasn't picked up CLIENT TRACKING, or
+		// anything added in redis 7.
+		switch f {
+		case FeatureClientTracking, FeatureShardedPubSub, FeatureFunctions:
+			return false
+		}
+	}
+
+	switch f {
+	case FeatureObjectFreq:
+		return si.AtLeast("4.0")
+	case FeatureRESP3, FeatureClientTracking:
+		return si.AtLeast("6.0")
+	case FeatureGetEx:
+		return si.AtLeast("6.2")
+	case FeatureShardedPubSub, FeatureFunctions:
+		return si.AtLeast("7.0")
+	default:
+		return false
+	}
+}
+
+// parseServerInfo parses the output of INFO server, optionally followed by the
+// output of INFO modules, into a ServerInfo.
+func parseServerInfo(info string) (ServerInfo, error) {
+	var si ServerInfo
+	fields := map[string]string{}
+	var keydb bool
+	sc := bufio.NewScanner(strings.NewReader(info))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			continue
+		}
+		k, v := line[:i], line[i+1:]
+		fields[k] = v
+
+		// INFO modules lists each module as e.g.
+		// "module:name=search,ver=20811,api=1,filters=0,..."
+		if k == "module" {
+			if name := strings.SplitN(v, ",", 2)[0]; strings.HasPrefix(name, "name=") {
+				si.Modules = append(si.Modules, strings.ToLower(name[len("name="):]))
+			}
+		}
+
+		// KeyDB doesn't report its own version field, so it's recognized by
+		// its executable or any keydb specific fields.
+		if strings.HasPrefix(k, "keydb") || (k == "executable" && strings.Contains(v, "keydb")) {
+			keydb = true
+		}
+	}
+
+	si.RedisVersion, si.Mode = fields["redis_version"], fields["redis_mode"]
+	if si.RedisVersion == "" {
+		return ServerInfo{}, errors.New("field \"redis_version\" not found in INFO server")
+	}
+
+	switch {
+	case fields["dragonfly_version"] != "":
+		si.Flavor, si.Version = ServerFlavorDragonfly, fields["dragonfly_version"]
+	case fields["valkey_version"] != "" || fields["server_name"] == "valkey":
+		si.Flavor, si.Version = ServerFlavorValkey, fields["valkey_version"]
+	case keydb:
+		si.Flavor, si.Version = ServerFlavorKeyDB, si.RedisVersion
+	default:
+		si.Flavor, si.Version = ServerFlavorRedis, si.RedisVersion
+	}
+	if si.Version == "" {
+		si.Version = si.RedisVersion
+	}
+
+	// dragonfly prefixes its version, e.g. "df-v1.14.1".
+	si.Version = strings.TrimPrefix(strings.TrimPrefix(si.Version, "df-"), "v")
+	return si, nil
+}
+
+// GetServerInfo performs INFO server and INFO modules using the given Client
+// and returns the ServerInfo parsed from their output. Servers which don't
+// support INFO modules are treated as having no modules loaded.
+//
+// Pool and Cluster cache the ServerInfo of the server(s) they're connected to,
+// see their ServerInfo methods; GetServerInfo always queries the server.
+func GetServerInfo(c Client) (ServerInfo, error) {
+	var info string
+	if err := c.Do(Cmd(&info, "INFO", "server")); err != nil {
+		return ServerInfo{}, err
+	}
+
+	var modules string
+	if err := c.Do(Cmd(&modules, "INFO", "modules")); err != nil && !errors.As(err, new(resp2.Error)) {
+		return ServerInfo{}, err
+	}
+	return parseServerInfo(info + "\r\n" + modules)
+}
+
+// serverInfoCache caches the ServerInfo of a Client. Errors aren't cached, so
+// that a server which was unreachable is queried again next time.
+type serverInfoCache struct {
+	l    sync.Mutex
+	info *ServerInfo
+}
+
+func (sic *serverInfoCache) get(c Client) (ServerInfo, error) {
+	sic.l.Lock()
+	defer sic.l.Unlock()
+	if sic.info != nil {
+		return *sic.info, nil
+	}
+	si, err := GetServerInfo(c)
+	if err != nil {
+		return ServerInfo{}, err
+	}
+	sic.info = &si
+	return si, nil
+}
+
+// serverInfoClient is implemented by Clients which cache the ServerInfo of the
+// server they're connected to.
+type serverInfoClient interface {
+	ServerInfo() (ServerInfo, error)
+}
+
+// Supports returns whether the server the given Client is connected to
+// supports the given ServerFeature, see ServerInfo.Supports.
+//
+// Pool and Cluster cache their ServerInfo, other Clients will have INFO
+// performed on them each time. If the ServerInfo can't be retrieved then the
+// feature is assumed to be supported, leaving it to the server to return an
+// error if it isn't.
+func Supports(c Client, f ServerFeature) bool {
+	var si ServerInfo
+	var err error
+	if sic, ok := c.(serverInfoClient); ok {
+		si, err = sic.ServerInfo()
+	} else {
+		si, err = GetServerInfo(c)
+	}
+	return err != nil || si.Supports(f)
+}
+
+// checkServerFeatures returns an *UnsupportedError if the Client is known not
+// to support any of the given ServerFeatures. Unlike Supports, only Clients
+// which cache their ServerInfo are checked.
+func checkServerFeatures(c Client, fs ...ServerFeature) error {
+	sic, ok := c.(serverInfoClient)
+	if !ok || len(fs) == 0 {
+		return nil
+	}
+	si, err := sic.ServerInfo()
+	if err != nil {
+		return nil
+	}
+	for _, f := range fs {
+		if !si.Supports(f) {
+			return &UnsupportedError{Feature: f, Server: si}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package radix
+
+import (
+	. "testing"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseServerInfo(t *T) {
+	type test struct {
+		descr, info string
+		exp         ServerInfo
+	}
+
+	tests := []test{
+		{
+			descr: "redis",
+			info:  "# Server\r\nredis_version:7.2.4\r\nredis_mode:standalone\r\nexecutable:/usr/bin/redis-server\r\n",
+			exp:   ServerInfo{Flavor: ServerFlavorRedis, Version: "7.2.4", RedisVersion: "7.2.4", Mode: "standalone"},
+		},
+		{
+			descr: "valkey",
+			info:  "# Server\r\nredis_version:7.2.4\r\nserver_name:valkey\r\nvalkey_version:8.0.1\r\nredis_mode:cluster\r\n",
+			exp:   ServerInfo{Flavor: ServerFlavorValkey, Version: "8.0.1", RedisVersion: "7.2.4", Mode: "cluster"},
+		},
+		{
+			descr: "keydb",
+			info:  "# Server\r\nredis_version:6.3.4\r\nredis_mode:standalone\r\nexecutable:/usr/local/bin/keydb-server\r\n",
+			exp:   ServerInfo{Flavor: ServerFlavorKeyDB, Version: "6.3.4", RedisVersion: "6.3.4", Mode: "standalone"},
+		},
+		{
+			descr: "dragonfly",
+			info:  "# Server\r\nredis_version:6.2.11\r\ndragonfly_version:df-v1.14.1\r\nredis_mode:standalone\r\n",
+			exp:   ServerInfo{Flavor: ServerFlavorDragonfly, Version: "1.14.1", RedisVersion: "6.2.11", Mode: "standalone"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.descr, func(t *T) {
+			si, err := parseServerInfo(test.info)
+			require.NoError(t, err)
+			assert.Equal(t, test.exp, si)
+		})
+	}
+
+	_, err := parseServerInfo("# Server\r\n")
+	assert.Error(t, err)
+}
+
+func TestServerInfoSupports(t *T) {
+	redis := func(v string) ServerInfo {
+		return ServerInfo{Flavor: ServerFlavorRedis, Version: v, RedisVersion: v}
+	}
+	assert.True(t, redis("7.0.0").AtLeast("6.2"))
+	assert.True(t, redis("6.2.0-rc1").AtLeast("6.2"))
+	assert.False(t, redis("6.2.14").AtLeast("7"))
+	assert.False(t, redis("6").AtLeast("6.2"))
+
+	assert.False(t, redis("5.0.7").Supports(FeatureRESP3))
+	assert.True(t, redis("6.0.0").Supports(FeatureClientTracking))
+	assert.False(t, redis("6.2.14").Supports(FeatureShardedPubSub))
+	assert.True(t, redis("7.0.0").Supports(FeatureShardedPubSub))
+
+	df := ServerInfo{Flavor: ServerFlavorDragonfly, Version: "1.14.1", RedisVersion: "7.2.0"}
+	assert.True(t, df.Supports(FeatureRESP3))
+	assert.False(t, df.Supports(FeatureShardedPubSub))
+
+	keydb := ServerInfo{Flavor: ServerFlavorKeyDB, Version: "6.3.4", RedisVersion: "6.3.4"}
+	assert.True(t, keydb.Supports(FeatureRESP3))
+	assert.False(t, keydb.Supports(FeatureClientTracking))
+}
+
+type serverInfoStub struct {
+	Conn
+	si ServerInfo
+}
+
+func (s serverInfoStub) ServerInfo() (ServerInfo, error) {
+	return s.si, nil
+}
+
+func TestGetServerInfo(t *T) {
+	var calls int
+	stub := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		calls++
+		if args[1] == "modules" {
+			return "# Modules\r\nmodule:name=ReJSON,ver=20609,api=1,filters=0\r\n"
+		}
+		return "# Server\r\nredis_version:6.2.14\r\n"
+	})
+
+	si, err := GetServerInfo(stub)
+	require.NoError(t, err)
+	assert.Equal(t, "6.2.14", si.Version)
+	assert.Equal(t, []string{"rejson"}, si.Modules)
+	assert.True(t, si.Supports(ModuleFeature("ReJSON")))
+	assert.False(t, si.Supports(ModuleFeature("search")))
+
+	var sic serverInfoCache
+	for i := 0; i < 2; i++ {
+		si, err = sic.get(stub)
+		require.NoError(t, err)
+		assert.Equal(t, ServerFlavorRedis, si.Flavor)
+	}
+	assert.Equal(t, 4, calls)
+
+	assert.True(t, Supports(stub, FeatureGetEx))
+	assert.False(t, Supports(stub, FeatureFunctions))
+
+	c := serverInfoStub{Conn: stub, si: si}
+	assert.NoError(t, checkServerFeatures(c, FeatureClientTracking))
+	assert.NoError(t, checkServerFeatures(stub, FeatureShardedPubSub))
+
+	err = checkServerFeatures(c, FeatureClientTracking, FeatureShardedPubSub)
+	assert.True(t, errors.Is(err, ErrUnsupported))
+	var uErr *UnsupportedError
+	require.True(t, errors.As(err, &uErr))
+	assert.Equal(t, FeatureShardedPubSub, uErr.Feature)
+}
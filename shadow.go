@@ -0,0 +1,278 @@
+package radix
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+type shadowOpts struct {
+	queueSize   int
+	concurrency int
+	reads       bool
+	errCh       chan<- error
+}
+
+// ShadowOpt is an optional behavior which can be applied to the NewShadowClient
+// function to effect a ShadowClient's behavior.
+type ShadowOpt func(*shadowOpts)
+
+// ShadowQueueSize sets the number of Actions which may be waiting to be
+// mirrored to the secondary. Once the queue is full further Actions are not
+// mirrored, and are counted in ShadowStats.Dropped, so that a slow or
+// unavailable secondary never slows down the primary.
+func ShadowQueueSize(size int) ShadowOpt {
+	return func(so *shadowOpts) {
+		so.queueSize = size
+	}
+}
+
+// ShadowConcurrency sets the number of Actions which may be performed on the
+// secondary at the same time. With a concurrency of 1 Actions are performed on
+// the secondary in the same order they were performed on the primary, which
+// is generally required for the secondary to end up with the same data.
+func ShadowConcurrency(n int) ShadowOpt {
+	return func(so *shadowOpts) {
+		so.concurrency = n
+	}
+}
+
+// ShadowReads tells the ShadowClient to mirror read-only Actions as well as
+// writes, e.g. to compare the performance of the secondary under real traffic.
+// The results of mirrored Actions are always discarded.
+func ShadowReads() ShadowOpt {
+	return func(so *shadowOpts) {
+		so.reads = true
+	}
+}
+
+// ShadowErrCh sets a channel which errors returned by the secondary will be
+// written to. If the channel blocks the error will be dropped.
+func ShadowErrCh(errCh chan<- error) ShadowOpt {
+	return func(so *shadowOpts) {
+		so.errCh = errCh
+	}
+}
+
+// ShadowStats describes the Actions a ShadowClient has mirrored to its
+// secondary.
+type ShadowStats struct {
+	// Mirrored is the number of Actions which were performed successfully on
+	// the secondary, and Failed the number which returned an error.
+	Mirrored, Failed uint64
+
+	// Dropped is the number of Actions which weren't mirrored because the
+	// queue was full.
+	Dropped uint64
+
+	// Skipped is the number of Actions which weren't mirrored because they
+	// can't be performed more than once, e.g. WithConn.
+	Skipped uint64
+
+	// Queued is the number of Actions currently waiting to be mirrored.
+	Queued int
+
+	// Lag is the time between the most recently mirrored Action completing on
+	// the primary and completing on the secondary.
+	Lag time.Duration
+}
+
+type shadowAction struct {
+	a        Action
+	queuedAt time.Time
+}
+
+// ShadowClient is a Client which performs Actions on a primary Client, and
+// mirrors the writes among them to a secondary Client in the background. This
+// can be used to keep a new deployment (e.g. a new cluster, or one in another
+// region) up to date with a live one during a migration, or to test new
+// infrastructure under real traffic.
+//
+// Errors from the secondary are never returned to the caller; they are counted
+// in the ShadowClient's Stats, and written to the channel given to ShadowErrCh.
+//
+// Only Actions which were performed successfully on the primary are mirrored.
+// Actions created using Cmd, FlatCmd, EvalScript and Pipeline can be mirrored,
+// as can those Actions wrapped by ReadOnly, WithPriority or WithMetadata.
+// Other Actions, such as WithConn, and FlatCmds with io.Reader arguments, are
+// performed on the primary only.
+type ShadowClient struct {
+	// Atomic fields must be at the beginning of the struct since they must be
+	// correctly aligned or else access may cause panics on 32-bit architectures
+	// See https://golang.org/pkg/sync/atomic/#pkg-note-BUG
+	mirrored, failed, dropped, skipped uint64
+	lag                                int64
+
+	so                 shadowOpts
+	primary, secondary Client
+
+	// l protects closed, so that nothing is written to queue once it's
+	// closed.
+	l      sync.RWMutex
+	closed bool
+	queue  chan shadowAction
+	wg     sync.WaitGroup
+}
+
+var _ Client = new(ShadowClient)
+
+// NewShadowClient initializes and returns a ShadowClient which performs
+// Actions on primary and mirrors them to secondary. Both Clients are closed
+// when the ShadowClient is closed.
+//
+// NewShadowClient takes in a number of options which can overwrite its default
+// behavior. The default options NewShadowClient uses are:
+//
+//	ShadowQueueSize(1024)
+//	ShadowConcurrency(1)
+//
+func NewShadowClient(primary, secondary Client, opts ...ShadowOpt) *ShadowClient {
+	sc := &ShadowClient{primary: primary, secondary: secondary}
+
+	defaultShadowOpts := []ShadowOpt{
+		ShadowQueueSize(1024),
+		ShadowConcurrency(1),
+	}
+	for _, opt := range append(defaultShadowOpts, opts...) {
+		if opt != nil {
+			opt(&(sc.so))
+		}
+	}
+
+	sc.queue = make(chan shadowAction, sc.so.queueSize)
+	for i := 0; i < sc.so.concurrency; i++ {
+		sc.wg.Add(1)
+		go func() {
+			defer sc.wg.Done()
+			sc.mirror()
+		}()
+	}
+	return sc
+}
+
+// Do implements the method for the Client interface. The Action is performed
+// on the primary, and then queued to be performed on the secondary.
+func (sc *ShadowClient) Do(a Action) error {
+	if !sc.so.reads && isReadOnly(a) {
+		return sc.primary.Do(a)
+	}
+
+	// the Action must be copied before being performed, since Actions created
+	// by Cmd are reused once performed.
+	cp, ok := shadowCopy(a)
+	if err := sc.primary.Do(a); err != nil {
+		return err
+	} else if !ok {
+		atomic.AddUint64(&sc.skipped, 1)
+		return nil
+	}
+
+	sc.l.RLock()
+	defer sc.l.RUnlock()
+	if sc.closed {
+		return nil
+	}
+	select {
+	case sc.queue <- shadowAction{a: cp, queuedAt: time.Now()}:
+	default:
+		atomic.AddUint64(&sc.dropped, 1)
+	}
+	return nil
+}
+
+func (sc *ShadowClient) mirror() {
+	for sa := range sc.queue {
+		err := sc.secondary.Do(sa.a)
+		atomic.StoreInt64(&sc.lag, int64(time.Since(sa.queuedAt)))
+		if err == nil {
+			atomic.AddUint64(&sc.mirrored, 1)
+			continue
+		}
+
+		atomic.AddUint64(&sc.failed, 1)
+		if sc.so.errCh != nil {
+			select {
+			case sc.so.errCh <- errors.Errorf("mirroring to secondary: %w", err):
+			default:
+			}
+		}
+	}
+}
+
+// shadowCopy returns a copy of the Action which discards its results, or false
+// if the Action can't be copied.
+func shadowCopy(a Action) (Action, bool) {
+	switch a := a.(type) {
+	case *cmdAction:
+		cp := new(cmdAction)
+		*cp = *a
+		cp.rcv = nil
+		if cp.flat {
+			for _, arg := range cp.flatArgs {
+				if _, ok := arg.(io.Reader); ok {
+					return nil, false
+				}
+			}
+			cp.flatArgs = append([]interface{}(nil), cp.flatArgs...)
+		} else {
+			cp.args = append([]string(nil), cp.args...)
+		}
+		return cp, true
+	case *evalAction:
+		cp := new(evalAction)
+		*cp = *a
+		cp.rcv = nil
+		cp.eval = false
+		return cp, true
+	case pipeline:
+		cp := make(pipeline, len(a))
+		for i, cmd := range a {
+			cmdCp, ok := shadowCopy(cmd)
+			if !ok {
+				return nil, false
+			} else if cp[i], ok = cmdCp.(CmdAction); !ok {
+				return nil, false
+			}
+		}
+		return cp, true
+	case wrappedAction:
+		return shadowCopy(a.unwrapAction())
+	default:
+		return nil, false
+	}
+}
+
+// Stats returns the ShadowStats of the ShadowClient.
+func (sc *ShadowClient) Stats() ShadowStats {
+	return ShadowStats{
+		Mirrored: atomic.LoadUint64(&sc.mirrored),
+		Failed:   atomic.LoadUint64(&sc.failed),
+		Dropped:  atomic.LoadUint64(&sc.dropped),
+		Skipped:  atomic.LoadUint64(&sc.skipped),
+		Queued:   len(sc.queue),
+		Lag:      time.Duration(atomic.LoadInt64(&sc.lag)),
+	}
+}
+
+// Close implements the method for the Client interface. Actions which are
+// already queued are mirrored before the secondary is closed.
+func (sc *ShadowClient) Close() error {
+	sc.l.Lock()
+	if sc.closed {
+		sc.l.Unlock()
+		return ErrClientClosed
+	}
+	sc.closed = true
+	close(sc.queue)
+	sc.l.Unlock()
+
+	sc.wg.Wait()
+	err := sc.primary.Close()
+	if secErr := sc.secondary.Close(); err == nil {
+		err = secErr
+	}
+	return err
+}
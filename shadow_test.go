@@ -0,0 +1,81 @@
+package radix
+
+import (
+	"sync"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+)
+
+func TestShadowClient(t *T) {
+	type cmds struct {
+		sync.Mutex
+		cmds [][]string
+	}
+	record := func(c *cmds, fn func(args []string) interface{}) Client {
+		return Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+			c.Lock()
+			c.cmds = append(c.cmds, args)
+			c.Unlock()
+			return fn(args)
+		})
+	}
+
+	var primCmds, secCmds cmds
+	prim := record(&primCmds, func(args []string) interface{} {
+		if args[0] == "INCR" {
+			return errors.New("ERR not an integer")
+		}
+		return "foo"
+	})
+	unblockCh := make(chan struct{})
+	sec := record(&secCmds, func(args []string) interface{} {
+		<-unblockCh
+		if args[0] == "DEL" {
+			return errors.New("ERR secondary")
+		}
+		return "bar"
+	})
+
+	errCh := make(chan error, 1)
+	sc := NewShadowClient(prim, sec, ShadowQueueSize(3), ShadowErrCh(errCh))
+
+	var res string
+	require.NoError(t, sc.Do(Cmd(&res, "SET", "a", "1")))
+	assert.Equal(t, "foo", res)
+	for i := 0; i < 1000 && sc.Stats().Queued > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	require.NoError(t, sc.Do(Cmd(&res, "GET", "a")))
+	require.NoError(t, sc.Do(Pipeline(Cmd(nil, "SET", "b", "2"), Cmd(&res, "DEL", "c"))))
+	require.Error(t, sc.Do(Cmd(nil, "INCR", "a")))
+	require.NoError(t, sc.Do(FlatCmd(nil, "SET", "c", 3)))
+	require.NoError(t, sc.Do(WithConn("d", func(c Conn) error {
+		return c.Do(Cmd(nil, "SET", "d", "4"))
+	})))
+	// the first mirrored SET is blocked on the secondary, so the queue fills
+	require.NoError(t, sc.Do(EvalScript{}.Cmd(nil)))
+	require.NoError(t, sc.Do(Cmd(nil, "SET", "e", "5")))
+	assert.Equal(t, "foo", res)
+
+	close(unblockCh)
+	assert.Error(t, <-errCh)
+	require.NoError(t, sc.Close())
+
+	assert.Equal(t, [][]string{
+		{"SET", "a", "1"},
+		{"SET", "b", "2"},
+		{"DEL", "c"},
+		{"SET", "c", "3"},
+		{"EVALSHA", "", "0"},
+	}, secCmds.cmds)
+	stats := sc.Stats()
+	assert.Equal(t, uint64(3), stats.Mirrored)
+	assert.Equal(t, uint64(1), stats.Failed)
+	assert.Equal(t, uint64(1), stats.Dropped)
+	assert.Equal(t, uint64(1), stats.Skipped)
+	assert.NotZero(t, stats.Lag)
+}
@@ -0,0 +1,529 @@
+package radix
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+// ShardHasher decides which shard each key belongs to, out of a fixed set of
+// shards. A ShardHasher must be safe for concurrent use.
+type ShardHasher interface {
+	// Shard returns the address of the shard which the given key belongs to.
+	// The key given is the key's hash tag, if it has one, so that keys with
+	// the same hash tag always belong to the same shard, as in redis cluster.
+	Shard(key []byte) string
+}
+
+// ShardHasherFunc returns a ShardHasher for the given set of shard addresses,
+// which will always be non-empty.
+type ShardHasherFunc func(addrs []string) ShardHasher
+
+type rendezvousShard struct {
+	addr string
+	hash uint64
+}
+
+type rendezvousHasher []rendezvousShard
+
+// RendezvousHasher is a ShardHasherFunc which uses rendezvous (highest random
+// weight) hashing. When a shard is added only the keys which then belong to it
+// are moved, and when one is removed only the keys which belonged to it are
+// moved.
+//
+// Finding a key's shard takes time proportional to the number of shards, which
+// for the small number of shards ShardedClient is generally used with is
+// faster than KetamaHasher.
+func RendezvousHasher(addrs []string) ShardHasher {
+	rh := make(rendezvousHasher, len(addrs))
+	for i, addr := range addrs {
+		rh[i] = rendezvousShard{addr: addr, hash: fnv64a([]byte(addr))}
+	}
+	return rh
+}
+
+func (rh rendezvousHasher) Shard(key []byte) string {
+	keyHash := fnv64a(key)
+	var best rendezvousShard
+	var bestWeight uint64
+	for i, shard := range rh {
+		weight := mix64(keyHash ^ shard.hash)
+		if i == 0 || weight > bestWeight || (weight == bestWeight && shard.addr < best.addr) {
+			best, bestWeight = shard, weight
+		}
+	}
+	return best.addr
+}
+
+func fnv64a(b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
+}
+
+// mix64 is the finalizer of splitmix64, which ensures that the weights of
+// similar keys and addresses aren't correlated.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+type ketamaPoint struct {
+	hash uint32
+	addr string
+}
+
+type ketamaHasher []ketamaPoint
+
+// KetamaHasher returns a ShardHasherFunc which uses ketama consistent hashing,
+// placing each shard at the given number of points on a hash ring, and each
+// key on the shard at the next point on the ring. The ring is compatible with
+// that of other ketama implementations, e.g. those of memcached clients, which
+// generally use 160 points per shard. If pointsPerShard is 0 or less then 160
+// is used.
+//
+// Few keys are moved when a shard is added or removed, though how few depends
+// on the number of points used. Finding a key's shard takes time proportional
+// to the logarithm of the number of points.
+func KetamaHasher(pointsPerShard int) ShardHasherFunc {
+	if pointsPerShard <= 0 {
+		pointsPerShard = 160
+	}
+	return func(addrs []string) ShardHasher {
+		kh := make(ketamaHasher, 0, len(addrs)*pointsPerShard)
+		for _, addr := range addrs {
+			// each md5 digest provides 4 points.
+			for i, n := 0, 0; n < pointsPerShard; i++ {
+				digest := md5.Sum([]byte(addr + "-" + strconv.Itoa(i)))
+				for j := 0; j < 4 && n < pointsPerShard; j, n = j+1, n+1 {
+					kh = append(kh, ketamaPoint{
+						hash: binary.LittleEndian.Uint32(digest[j*4:]),
+						addr: addr,
+					})
+				}
+			}
+		}
+		sort.Slice(kh, func(i, j int) bool {
+			if kh[i].hash != kh[j].hash {
+				return kh[i].hash < kh[j].hash
+			}
+			return kh[i].addr < kh[j].addr
+		})
+		return kh
+	}
+}
+
+func (kh ketamaHasher) Shard(key []byte) string {
+	digest := md5.Sum(key)
+	hash := binary.LittleEndian.Uint32(digest[:4])
+	i := sort.Search(len(kh), func(i int) bool { return kh[i].hash >= hash })
+	if i == len(kh) {
+		i = 0
+	}
+	return kh[i].addr
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// ShardChange describes a shard being added to or removed from a
+// ShardedClient.
+type ShardChange struct {
+	// Addr is the address of the shard which was added or removed.
+	Addr string
+
+	// Removed is true if the shard was removed, false if it was added.
+	Removed bool
+
+	// Prev and Next are the ShardHashers from before and after the change.
+	// They can be used to determine which keys need to be migrated, see
+	// Moved.
+	Prev, Next ShardHasher
+}
+
+// Moved returns the shards the given key belonged to before and after the
+// change, and whether those are different, i.e. whether the key needs to be
+// migrated. If the last shard was removed Next is nil, and every key is
+// considered moved to "".
+func (sc ShardChange) Moved(key string) (from, to string, moved bool) {
+	tag := keyHashTag([]byte(key))
+	if sc.Prev != nil {
+		from = sc.Prev.Shard(tag)
+	}
+	if sc.Next != nil {
+		to = sc.Next.Shard(tag)
+	}
+	return from, to, from != to
+}
+
+type shardedClientOpts struct {
+	pf       ClientFunc
+	hasherFn ShardHasherFunc
+	onChange func(ShardChange)
+}
+
+// ShardedClientOpt is an optional behavior which can be applied to the
+// NewShardedClient function to effect a ShardedClient's behavior.
+type ShardedClientOpt func(*shardedClientOpts)
+
+// ShardedClientPoolFunc tells the ShardedClient to use the given ClientFunc
+// when creating the pool of connections to each shard.
+func ShardedClientPoolFunc(pf ClientFunc) ShardedClientOpt {
+	return func(so *shardedClientOpts) {
+		so.pf = pf
+	}
+}
+
+// ShardedClientHasher tells the ShardedClient to use the given ShardHasherFunc
+// to decide which shard each key belongs to.
+//
+// NOTE that every process sharing the same set of shards must use the same
+// ShardHasherFunc, and the same shard addresses, for keys to be found.
+func ShardedClientHasher(fn ShardHasherFunc) ShardedClientOpt {
+	return func(so *shardedClientOpts) {
+		so.hasherFn = fn
+	}
+}
+
+// ShardedClientOnChange tells the ShardedClient to call the given callback
+// each time a shard is added or removed, after the change has taken effect.
+// The callback is called synchronously, and may be used to migrate the keys
+// affected by the change.
+func ShardedClientOnChange(fn func(ShardChange)) ShardedClientOpt {
+	return func(so *shardedClientOpts) {
+		so.onChange = fn
+	}
+}
+
+// ShardedClient is a Client which spreads keys across a set of independent,
+// non-cluster redis instances (shards) using consistent hashing, for
+// deployments which need more capacity than a single instance but can't use
+// redis cluster. Each shard has its own pool of connections.
+//
+// Actions are performed on the shard which their keys belong to. Keys with the
+// same hash tag, e.g. "{user1}.name" and "{user1}.email", always belong to the
+// same shard. An Action with no keys, or whose keys belong to different
+// shards, can't be performed, with the exception of the following commands
+// when created using Cmd: MGET, MSET, DEL, UNLINK, EXISTS and TOUCH. These are
+// split into a command per shard, and their results merged, so that they
+// behave as if they were performed on a single instance, except that they
+// aren't atomic.
+//
+// Shards may be added or removed at runtime. Keys aren't migrated
+// automatically, but ShardedClientOnChange can be used to do so.
+type ShardedClient struct {
+	so shardedClientOpts
+
+	l       sync.RWMutex
+	addrs   []string
+	clients map[string]Client
+	hasher  ShardHasher
+	closed  bool
+}
+
+// NewShardedClient initializes and returns a ShardedClient for the given shard
+// addresses, creating a Client for each.
+//
+// NewShardedClient takes in a number of options which can overwrite its
+// default behavior. The default options NewShardedClient uses are:
+//
+//	ShardedClientPoolFunc(DefaultClientFunc)
+//	ShardedClientHasher(RendezvousHasher)
+//
+func NewShardedClient(addrs []string, opts ...ShardedClientOpt) (*ShardedClient, error) {
+	if len(addrs) == 0 {
+		return nil, errors.New("at least one shard address is required")
+	}
+
+	sc := &ShardedClient{clients: make(map[string]Client, len(addrs))}
+	defaultShardedClientOpts := []ShardedClientOpt{
+		ShardedClientPoolFunc(DefaultClientFunc),
+		ShardedClientHasher(RendezvousHasher),
+	}
+	for _, opt := range append(defaultShardedClientOpts, opts...) {
+		if opt != nil {
+			opt(&(sc.so))
+		}
+	}
+
+	for _, addr := range addrs {
+		if _, ok := sc.clients[addr]; ok {
+			continue
+		}
+		client, err := sc.so.pf("tcp", addr)
+		if err != nil {
+			sc.Close()
+			return nil, errors.Errorf("error connecting to shard %s: %w", addr, err)
+		}
+		sc.clients[addr] = client
+		sc.addrs = append(sc.addrs, addr)
+	}
+	sc.hasher = sc.so.hasherFn(sc.addrs)
+	return sc, nil
+}
+
+// Shard returns the address of the shard which the given key belongs to.
+func (sc *ShardedClient) Shard(key string) string {
+	sc.l.RLock()
+	defer sc.l.RUnlock()
+	if sc.hasher == nil {
+		return ""
+	}
+	return sc.hasher.Shard(keyHashTag([]byte(key)))
+}
+
+// Shards returns the addresses of all shards.
+func (sc *ShardedClient) Shards() []string {
+	sc.l.RLock()
+	defer sc.l.RUnlock()
+	return append([]string(nil), sc.addrs...)
+}
+
+// Client returns the Client for the shard with the given address, e.g. to
+// perform an Action which has no keys on it.
+//
+// NOTE the Client should _not_ be closed.
+func (sc *ShardedClient) Client(addr string) (Client, error) {
+	sc.l.RLock()
+	defer sc.l.RUnlock()
+	if client := sc.clients[addr]; client != nil {
+		return client, nil
+	}
+	return nil, errUnknownAddress
+}
+
+// AddShard creates a Client for the shard with the given address and adds it
+// to the set of shards, so that the keys which now belong to it are performed
+// on it. Nothing is done if the shard already exists.
+func (sc *ShardedClient) AddShard(addr string) error {
+	client, err := sc.so.pf("tcp", addr)
+	if err != nil {
+		return errors.Errorf("error connecting to shard %s: %w", addr, err)
+	}
+
+	sc.l.Lock()
+	if sc.closed {
+		sc.l.Unlock()
+		client.Close()
+		return ErrClientClosed
+	} else if _, ok := sc.clients[addr]; ok {
+		sc.l.Unlock()
+		return client.Close()
+	}
+	sc.clients[addr] = client
+	sc.addrs = append(sc.addrs, addr)
+	change := sc.rehash(addr, false)
+	sc.l.Unlock()
+
+	sc.changed(change)
+	return nil
+}
+
+// RemoveShard removes the shard with the given address from the set of shards
+// and closes its Client. Nothing is done if the shard doesn't exist.
+//
+// Actions already being performed on the shard may fail once its Client is
+// closed.
+func (sc *ShardedClient) RemoveShard(addr string) error {
+	sc.l.Lock()
+	client, ok := sc.clients[addr]
+	if sc.closed {
+		sc.l.Unlock()
+		return ErrClientClosed
+	} else if !ok {
+		sc.l.Unlock()
+		return nil
+	}
+	delete(sc.clients, addr)
+	for i := range sc.addrs {
+		if sc.addrs[i] == addr {
+			sc.addrs = append(sc.addrs[:i:i], sc.addrs[i+1:]...)
+			break
+		}
+	}
+	change := sc.rehash(addr, true)
+	sc.l.Unlock()
+
+	sc.changed(change)
+	return client.Close()
+}
+
+// rehash must be called with l held.
+func (sc *ShardedClient) rehash(addr string, removed bool) ShardChange {
+	change := ShardChange{Addr: addr, Removed: removed, Prev: sc.hasher}
+	sc.hasher = nil
+	if len(sc.addrs) > 0 {
+		sc.hasher = sc.so.hasherFn(sc.addrs)
+	}
+	change.Next = sc.hasher
+	return change
+}
+
+func (sc *ShardedClient) changed(change ShardChange) {
+	if sc.so.onChange != nil {
+		sc.so.onChange(change)
+	}
+}
+
+var errNoShards = errors.New("ShardedClient has no shards")
+
+// shardClient returns the shard, and its Client, which all of the given keys
+// belong to.
+func (sc *ShardedClient) shardClient(keys []string) (string, Client, error) {
+	sc.l.RLock()
+	defer sc.l.RUnlock()
+	if sc.closed {
+		return "", nil, ErrClientClosed
+	} else if sc.hasher == nil {
+		return "", nil, errNoShards
+	} else if len(keys) == 0 {
+		return "", nil, errors.New("ShardedClient can't perform an Action with no keys, use Client to perform it on a specific shard")
+	}
+
+	addr := sc.hasher.Shard(keyHashTag([]byte(keys[0])))
+	for _, key := range keys[1:] {
+		if keyAddr := sc.hasher.Shard(keyHashTag([]byte(key))); keyAddr != addr {
+			return "", nil, errors.Errorf("keys %q and %q belong to different shards", keys[0], key)
+		}
+	}
+	return addr, sc.clients[addr], nil
+}
+
+// Do implements the method for the Client interface.
+func (sc *ShardedClient) Do(a Action) error {
+	if cmdA, ok := a.(*cmdAction); ok && !cmdA.flat {
+		if split, ok := shardSplitCmds[strings.ToUpper(cmdA.cmd)]; ok {
+			return sc.doSplit(cmdA, split)
+		}
+	}
+
+	_, client, err := sc.shardClient(ActionProperties(a).Keys)
+	if err != nil {
+		return err
+	}
+	return client.Do(a)
+}
+
+// shardSplit describes how a multi-key command is split across shards.
+type shardSplit struct {
+	// step is the number of arguments per key, e.g. 2 for MSET.
+	step int
+
+	// sum is true if the command returns an integer which should be summed
+	// across shards, false if it returns an array with an element per key.
+	// Commands which return neither (i.e. MSET) have step > 1 and return OK.
+	sum bool
+}
+
+var shardSplitCmds = map[string]shardSplit{
+	"MGET":   {step: 1},
+	"MSET":   {step: 2},
+	"DEL":    {step: 1, sum: true},
+	"UNLINK": {step: 1, sum: true},
+	"EXISTS": {step: 1, sum: true},
+	"TOUCH":  {step: 1, sum: true},
+}
+
+func (sc *ShardedClient) doSplit(cmdA *cmdAction, split shardSplit) error {
+	if len(cmdA.args) == 0 || len(cmdA.args)%split.step != 0 {
+		return errors.Errorf("wrong number of arguments for %s", cmdA.cmd)
+	}
+
+	// args and positions of each key, by shard, in the order shards are first
+	// encountered.
+	var addrs []string
+	args := map[string][]string{}
+	positions := map[string][]int{}
+	sc.l.RLock()
+	if sc.closed {
+		sc.l.RUnlock()
+		return ErrClientClosed
+	} else if sc.hasher == nil {
+		sc.l.RUnlock()
+		return errNoShards
+	}
+	for i := 0; i < len(cmdA.args); i += split.step {
+		addr := sc.hasher.Shard(keyHashTag([]byte(cmdA.args[i])))
+		if _, ok := args[addr]; !ok {
+			addrs = append(addrs, addr)
+		}
+		args[addr] = append(args[addr], cmdA.args[i:i+split.step]...)
+		positions[addr] = append(positions[addr], i/split.step)
+	}
+	clients := make(map[string]Client, len(addrs))
+	for _, addr := range addrs {
+		clients[addr] = sc.clients[addr]
+	}
+	sc.l.RUnlock()
+
+	var sum int64
+	elems := make([]resp2.RawMessage, len(cmdA.args)/split.step)
+	for _, addr := range addrs {
+		var rcv interface{}
+		var shardSum int64
+		var shardElems []resp2.RawMessage
+		if split.sum {
+			rcv = &shardSum
+		} else if split.step == 1 {
+			rcv = &shardElems
+		}
+
+		if err := clients[addr].Do(Cmd(rcv, cmdA.cmd, args[addr]...)); err != nil {
+			return err
+		} else if split.step == 1 && !split.sum && len(shardElems) != len(positions[addr]) {
+			return errors.Errorf("%s on shard %s returned %d elements, expected %d",
+				cmdA.cmd, addr, len(shardElems), len(positions[addr]))
+		}
+
+		sum += shardSum
+		for i, pos := range positions[addr] {
+			if shardElems != nil {
+				elems[pos] = shardElems[i]
+			}
+		}
+	}
+
+	var res []byte
+	switch {
+	case split.sum:
+		res = append(append([]byte(":"), strconv.FormatInt(sum, 10)...), "\r\n"...)
+	case split.step > 1:
+		res = []byte("+OK\r\n")
+	default:
+		res = append(append([]byte("*"), strconv.Itoa(len(elems))...), "\r\n"...)
+		for _, elem := range elems {
+			res = append(res, elem...)
+		}
+	}
+	return resp2.RawMessage(res).UnmarshalInto(resp2.Any{I: cmdA.rcv})
+}
+
+// Close implements the method for the Client interface, closing the Client of
+// every shard.
+func (sc *ShardedClient) Close() error {
+	sc.l.Lock()
+	defer sc.l.Unlock()
+	if sc.closed {
+		return ErrClientClosed
+	}
+	sc.closed = true
+
+	var closeErr error
+	for _, client := range sc.clients {
+		if err := client.Close(); closeErr == nil && err != nil {
+			closeErr = err
+		}
+	}
+	return closeErr
+}
@@ -0,0 +1,164 @@
+package radix
+
+import (
+	"strconv"
+	"sync"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardHashers(t *T) {
+	hasherFns := map[string]ShardHasherFunc{
+		"rendezvous": RendezvousHasher,
+		"ketama":     KetamaHasher(0),
+	}
+	for name, hasherFn := range hasherFns {
+		t.Run(name, func(t *T) {
+			addrs := []string{"a:6379", "b:6379", "c:6379"}
+			prev := hasherFn(addrs)
+			next := hasherFn(append(addrs, "d:6379"))
+
+			const n = 10000
+			counts := map[string]int{}
+			for i := 0; i < n; i++ {
+				key := []byte(strconv.Itoa(i))
+				from, to := prev.Shard(key), next.Shard(key)
+				counts[to]++
+				// keys only ever move to the new shard.
+				if from != to {
+					assert.Equal(t, "d:6379", to)
+				}
+			}
+			for _, addr := range append(addrs, "d:6379") {
+				assert.InDelta(t, n/4, counts[addr], n/10, addr)
+			}
+		})
+	}
+}
+
+func TestShardedClient(t *T) {
+	var l sync.Mutex
+	stores := map[string]map[string]string{}
+	pf := func(network, addr string) (Client, error) {
+		l.Lock()
+		defer l.Unlock()
+		store := map[string]string{}
+		stores[addr] = store
+		return Stub(network, addr, func(args []string) interface{} {
+			l.Lock()
+			defer l.Unlock()
+			switch args[0] {
+			case "SET", "MSET":
+				for i := 1; i < len(args); i += 2 {
+					store[args[i]] = args[i+1]
+				}
+				return "OK"
+			case "GET":
+				if v, ok := store[args[1]]; ok {
+					return v
+				}
+				return nil
+			case "MGET":
+				res := make([]interface{}, 0, len(args)-1)
+				for _, k := range args[1:] {
+					if v, ok := store[k]; ok {
+						res = append(res, v)
+					} else {
+						res = append(res, nil)
+					}
+				}
+				return res
+			case "DEL":
+				var n int
+				for _, k := range args[1:] {
+					if _, ok := store[k]; ok {
+						delete(store, k)
+						n++
+					}
+				}
+				return n
+			}
+			return "PONG"
+		}), nil
+	}
+
+	var changes []ShardChange
+	sc, err := NewShardedClient([]string{"a:6379", "b:6379"},
+		ShardedClientPoolFunc(pf),
+		ShardedClientOnChange(func(c ShardChange) { changes = append(changes, c) }),
+	)
+	require.NoError(t, err)
+	defer sc.Close()
+
+	keys := make([]string, 20)
+	args := make([]string, 0, 40)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		args = append(args, keys[i], "val"+strconv.Itoa(i))
+	}
+
+	require.NoError(t, sc.Do(Cmd(nil, "MSET", args...)))
+	for _, key := range keys {
+		l.Lock()
+		_, ok := stores[sc.Shard(key)][key]
+		l.Unlock()
+		assert.True(t, ok, key)
+	}
+	l.Lock()
+	assert.NotEmpty(t, stores["a:6379"])
+	assert.NotEmpty(t, stores["b:6379"])
+	l.Unlock()
+
+	var gotStrs []string
+	require.NoError(t, sc.Do(Cmd(&gotStrs, "MGET", append(keys, "missing")...)))
+	require.Len(t, gotStrs, 21)
+	for i := range keys {
+		assert.Equal(t, "val"+strconv.Itoa(i), gotStrs[i])
+	}
+	assert.Equal(t, "", gotStrs[20])
+
+	var v string
+	require.NoError(t, sc.Do(Cmd(&v, "GET", "key3")))
+	assert.Equal(t, "val3", v)
+
+	// keys with the same hash tag belong to the same shard
+	require.NoError(t, sc.Do(Cmd(nil, "SET", "{user}.name", "x")))
+	assert.Equal(t, sc.Shard("{user}.name"), sc.Shard("{user}.email"))
+
+	var n int
+	require.NoError(t, sc.Do(Cmd(&n, "DEL", "key0", "key1", "missing")))
+	assert.Equal(t, 2, n)
+
+	assert.Error(t, sc.Do(Cmd(nil, "PING")))
+
+	// an Action whose keys belong to different shards can't be performed
+	var a, b string
+	for _, key := range keys {
+		if sc.Shard(key) == "a:6379" {
+			a = key
+		} else {
+			b = key
+		}
+	}
+	assert.Error(t, sc.Do(Pipeline(Cmd(nil, "GET", a), Cmd(nil, "GET", b))))
+
+	require.NoError(t, sc.AddShard("c:6379"))
+	assert.Equal(t, []string{"a:6379", "b:6379", "c:6379"}, sc.Shards())
+	require.Len(t, changes, 1)
+	assert.Equal(t, "c:6379", changes[0].Addr)
+	for _, key := range keys {
+		if from, to, moved := changes[0].Moved(key); moved {
+			assert.Equal(t, "c:6379", to)
+			assert.NotEqual(t, from, to)
+		}
+		assert.Equal(t, sc.Shard(key), changes[0].Next.Shard([]byte(key)))
+	}
+
+	require.NoError(t, sc.RemoveShard("c:6379"))
+	require.Len(t, changes, 2)
+	assert.True(t, changes[1].Removed)
+	_, err = sc.Client("c:6379")
+	assert.Error(t, err)
+}
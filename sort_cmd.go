@@ -0,0 +1,193 @@
+package radix
+
+import (
+	"bufio"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+// SortOpts are the optional arguments to Sort and SortStructs.
+type SortOpts struct {
+	// By, if set, is the pattern of the keys whose values the elements are
+	// sorted by, e.g. "weight_*". "nosort" skips sorting.
+	By string
+
+	// Offset and Count, if Count is non-zero, limit the result to Count
+	// elements starting from Offset.
+	Offset, Count int
+
+	// Get, if set, are the patterns of the keys whose values are returned
+	// instead of the elements themselves, e.g. "#" (the element itself),
+	// "obj_*" or "obj_*->field". For every element one value is returned per
+	// pattern, in the order given. It's ignored by SortStructs.
+	Get []string
+
+	// Desc sorts the elements in descending order.
+	Desc bool
+
+	// Alpha sorts the elements lexicographically rather than numerically.
+	Alpha bool
+
+	// Store, if set, is the key the result is stored at, as a list, instead
+	// of being returned. The reply is then the number of elements stored.
+	Store string
+
+	// ReadOnly uses SORT_RO, rather than SORT, which may be performed on a
+	// replica. It may not be used with Store, and requires redis 7 or later.
+	ReadOnly bool
+}
+
+func (o SortOpts) cmd(key string, get []string) (string, []string) {
+	cmd := "SORT"
+	if o.ReadOnly {
+		if o.Store != "" {
+			panic("Store can't be used with ReadOnly")
+		}
+		cmd = "SORT_RO"
+	}
+
+	args := []string{key}
+	if o.By != "" {
+		args = append(args, "BY", o.By)
+	}
+	if o.Count != 0 {
+		args = append(args, "LIMIT", strconv.Itoa(o.Offset), strconv.Itoa(o.Count))
+	}
+	for _, pattern := range get {
+		args = append(args, "GET", pattern)
+	}
+	if o.Desc {
+		args = append(args, "DESC")
+	}
+	if o.Alpha {
+		args = append(args, "ALPHA")
+	}
+	if o.Store != "" {
+		args = append(args, "STORE", o.Store)
+	}
+	return cmd, args
+}
+
+// Sort returns a CmdAction which performs SORT, or SORT_RO, on the list, set
+// or sorted set at key, unmarshaling the result into rcv, which follows the
+// same rules as for Cmd. Values returned for opts.Get patterns whose keys
+// don't exist are nil, so a []MaybeNil rcv can be used to detect them.
+//
+// Sort panics if both opts.Store and opts.ReadOnly are set.
+//
+// NOTE that when using a Cluster the keys matched by opts.By and opts.Get
+// patterns, as well as opts.Store, must belong to the same slot as key.
+func Sort(rcv interface{}, key string, opts SortOpts) CmdAction {
+	cmd, args := opts.cmd(key, opts.Get)
+	return Cmd(rcv, cmd, args...)
+}
+
+// sortFields describes the fields of a struct which are unmarshaled into by
+// SortStructs, along with the GET pattern of each.
+type sortFields struct {
+	idx      [][]int
+	patterns []string
+}
+
+func getSortFields(t reflect.Type) sortFields {
+	var sf sortFields
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		pattern, ok := f.Tag.Lookup("sort")
+		if !ok || pattern == "-" {
+			continue
+		}
+		sf.idx = append(sf.idx, f.Index)
+		sf.patterns = append(sf.patterns, pattern)
+	}
+	return sf
+}
+
+type sortStructsRcv struct {
+	v      reflect.Value // the slice
+	fields sortFields
+}
+
+func (r sortStructsRcv) UnmarshalRESP(br *bufio.Reader) error {
+	var vals []resp2.RawMessage
+	if err := (resp2.Any{I: &vals}).UnmarshalRESP(br); err != nil {
+		return err
+	}
+
+	n := len(r.fields.patterns)
+	if len(vals)%n != 0 {
+		return errors.Errorf("expected a multiple of %d values, got %d", n, len(vals))
+	}
+
+	slice := reflect.MakeSlice(r.v.Type(), len(vals)/n, len(vals)/n)
+	for i, val := range vals {
+		if val.IsNil() {
+			continue
+		}
+		elem := slice.Index(i / n)
+		if elem.Kind() == reflect.Ptr {
+			if elem.IsNil() {
+				elem.Set(reflect.New(elem.Type().Elem()))
+			}
+			elem = elem.Elem()
+		}
+		field := elem.FieldByIndex(r.fields.idx[i%n])
+		if err := val.UnmarshalInto(resp2.Any{I: field.Addr().Interface()}); err != nil {
+			return errors.Errorf("unmarshaling value of %q: %w", r.fields.patterns[i%n], err)
+		}
+	}
+	r.v.Set(slice)
+	return nil
+}
+
+// SortStructs is like Sort, but unmarshals the result into a slice of structs,
+// with one struct per sorted element. rcv must be a pointer to a slice of
+// structs, or of pointers to structs.
+//
+// The values returned for each element are determined by the struct's fields
+// which are tagged with "sort", whose tag is the GET pattern of that field's
+// value. For example:
+//
+//	type User struct {
+//		ID   string `sort:"#"`
+//		Name string `sort:"user_*->name"`
+//		Age  int    `sort:"user_*->age"`
+//	}
+//
+//	var users []User
+//	err := client.Do(radix.SortStructs(&users, "user_ids", radix.SortOpts{
+//		By: "user_*->age",
+//	}))
+//
+// Fields whose values don't exist are left as their zero value. opts.Get and
+// opts.Store are ignored.
+//
+// SortStructs panics if rcv isn't a pointer to a slice of structs, or if the
+// struct has no fields tagged with "sort".
+func SortStructs(rcv interface{}, key string, opts SortOpts) CmdAction {
+	v := reflect.ValueOf(rcv)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		panic(fmt.Sprintf("SortStructs rcv must be a pointer to a slice, not %T", rcv))
+	}
+	elemType := v.Elem().Type().Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("SortStructs rcv must be a pointer to a slice of structs, not %T", rcv))
+	}
+
+	fields := getSortFields(elemType)
+	if len(fields.patterns) == 0 {
+		panic(fmt.Sprintf("%s has no fields tagged with \"sort\"", elemType))
+	}
+
+	opts.Store = ""
+	cmd, args := opts.cmd(key, fields.patterns)
+	return Cmd(sortStructsRcv{v: v.Elem(), fields: fields}, cmd, args...)
+}
@@ -0,0 +1,61 @@
+package radix
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSort(t *T) {
+	var lastArgs []string
+	stub := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		lastArgs = args
+		if len(args) > 2 && args[len(args)-2] == "STORE" {
+			return 2
+		}
+		return []interface{}{"1", "alice", "30", "2", nil, nil}
+	})
+
+	var vals []MaybeNil
+	require.NoError(t, stub.Do(Sort(&vals, "ids", SortOpts{
+		By:     "user_*->age",
+		Offset: 0, Count: 2,
+		Get:   []string{"#", "user_*->name", "user_*->age"},
+		Desc:  true,
+		Alpha: true,
+	})))
+	assert.Equal(t, []string{
+		"SORT", "ids", "BY", "user_*->age", "LIMIT", "0", "2",
+		"GET", "#", "GET", "user_*->name", "GET", "user_*->age", "DESC", "ALPHA",
+	}, lastArgs)
+	require.Len(t, vals, 6)
+	assert.False(t, vals[1].Nil)
+	assert.True(t, vals[4].Nil)
+
+	var n int
+	require.NoError(t, stub.Do(Sort(&n, "ids", SortOpts{Store: "dst"})))
+	assert.Equal(t, []string{"SORT", "ids", "STORE", "dst"}, lastArgs)
+	assert.Equal(t, 2, n)
+
+	type user struct {
+		ID      int    `sort:"#"`
+		Name    string `sort:"user_*->name"`
+		Age     int    `sort:"user_*->age"`
+		Ignored string
+	}
+	var users []user
+	require.NoError(t, stub.Do(SortStructs(&users, "ids", SortOpts{ReadOnly: true, Get: []string{"ignored"}})))
+	assert.Equal(t, []string{
+		"SORT_RO", "ids", "GET", "#", "GET", "user_*->name", "GET", "user_*->age",
+	}, lastArgs)
+	assert.Equal(t, []user{{ID: 1, Name: "alice", Age: 30}, {ID: 2}}, users)
+
+	var userPtrs []*user
+	require.NoError(t, stub.Do(SortStructs(&userPtrs, "ids", SortOpts{})))
+	assert.Equal(t, []*user{{ID: 1, Name: "alice", Age: 30}, {ID: 2}}, userPtrs)
+
+	assert.Panics(t, func() { Sort(nil, "ids", SortOpts{ReadOnly: true, Store: "dst"}) })
+	assert.Panics(t, func() { SortStructs(&vals, "ids", SortOpts{}) })
+	assert.Panics(t, func() { SortStructs(&[]struct{ A string }{}, "ids", SortOpts{}) })
+}
@@ -0,0 +1,193 @@
+package radix
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// StreamFanInOpts are the options given to NewStreamFanIn.
+type StreamFanInOpts struct {
+	// StreamReaderOpts describes the streams to read and how to read them, as
+	// with NewStreamReader. Streams is required. NoBlock is ignored, since
+	// reads are always done in the background.
+	StreamReaderOpts
+
+	// RetryAfter is how long to wait before reading from a group of streams
+	// again after doing so fails, e.g. due to a network error. Other groups
+	// continue to be read in the meantime.
+	//
+	// The default, if RetryAfter is 0, is 1 second.
+	RetryAfter time.Duration
+
+	// ErrCh, if set, will have errors encountered while reading written to it.
+	// If the channel blocks the error will be dropped.
+	ErrCh chan<- error
+}
+
+// StreamFanInEntries is a batch of entries read from a single stream by a
+// StreamFanIn.
+type StreamFanInEntries struct {
+	Stream  string
+	Entries []StreamEntry
+}
+
+// StreamFanIn reads from many streams concurrently, merging the entries read
+// from all of them into a single sequence.
+//
+// When used with a Cluster, streams are grouped by the slot they belong to,
+// since a single XREAD can only read streams belonging to the same slot, and
+// each group is read using its own blocking command. A group whose node is
+// slow or unreachable therefore doesn't hold up the others. With any other
+// Client all streams are read using a single XREAD(GROUP), as with
+// NewStreamReader.
+//
+// Each group of streams keeps its own cursor for each stream, so that reading
+// resumes from the last entry returned when a group has to be read again after
+// an error.
+//
+// Batches of entries are handed out by Next in the order their groups read
+// them, with each group waiting for its batch to be taken before reading
+// again. This way a group with a constant stream of entries can't starve the
+// others.
+type StreamFanIn struct {
+	c    Client
+	opts StreamFanInOpts
+
+	entriesCh chan StreamFanInEntries
+
+	// ctx is cancelled when Close is called.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewStreamFanIn returns a StreamFanIn which starts reading from the streams
+// described by opts in the background.
+//
+// Any changes on opts after calling NewStreamFanIn will have no effect.
+func NewStreamFanIn(c Client, opts StreamFanInOpts) *StreamFanIn {
+	if opts.RetryAfter == 0 {
+		opts.RetryAfter = 1 * time.Second
+	}
+	opts.NoBlock = false
+
+	fi := &StreamFanIn{
+		c:         c,
+		opts:      opts,
+		entriesCh: make(chan StreamFanInEntries),
+	}
+	fi.ctx, fi.cancel = context.WithCancel(context.Background())
+
+	for _, group := range fi.groupStreams() {
+		fi.wg.Add(1)
+		go func(group map[string]*StreamEntryID) {
+			defer fi.wg.Done()
+			fi.readGroup(group)
+		}(group)
+	}
+	return fi
+}
+
+// groupStreams splits the streams into groups which can each be read using a
+// single command.
+func (fi *StreamFanIn) groupStreams() []map[string]*StreamEntryID {
+	if _, ok := fi.c.(*Cluster); !ok {
+		group := make(map[string]*StreamEntryID, len(fi.opts.Streams))
+		for stream, id := range fi.opts.Streams {
+			group[stream] = id
+		}
+		return []map[string]*StreamEntryID{group}
+	}
+
+	bySlot := map[uint16]map[string]*StreamEntryID{}
+	for stream, id := range fi.opts.Streams {
+		slot := ClusterSlot([]byte(stream))
+		if bySlot[slot] == nil {
+			bySlot[slot] = map[string]*StreamEntryID{}
+		}
+		bySlot[slot][stream] = id
+	}
+
+	slots := make([]int, 0, len(bySlot))
+	for slot := range bySlot {
+		slots = append(slots, int(slot))
+	}
+	sort.Ints(slots)
+
+	groups := make([]map[string]*StreamEntryID, 0, len(slots))
+	for _, slot := range slots {
+		groups = append(groups, bySlot[uint16(slot)])
+	}
+	return groups
+}
+
+// readGroup reads from the given group of streams until the StreamFanIn is
+// closed, recreating its StreamReader, from the last entries read, whenever
+// reading fails.
+func (fi *StreamFanIn) readGroup(group map[string]*StreamEntryID) {
+	for {
+		opts := fi.opts.StreamReaderOpts
+		opts.Streams = group
+		sr := NewStreamReader(fi.c, opts)
+
+		for {
+			stream, entries, ok := sr.Next()
+			if !ok {
+				break
+			} else if len(entries) == 0 {
+				select {
+				case <-fi.ctx.Done():
+					return
+				default:
+					continue
+				}
+			}
+
+			// the StreamReader only resumes from the last entry read for
+			// streams which it was given an ID for, see NewStreamReader.
+			if group[stream] != nil || opts.Group == "" {
+				lastID := entries[len(entries)-1].ID
+				group[stream] = &lastID
+			}
+
+			batch := StreamFanInEntries{
+				Stream:  stream,
+				Entries: append([]StreamEntry(nil), entries...),
+			}
+			select {
+			case fi.entriesCh <- batch:
+			case <-fi.ctx.Done():
+				return
+			}
+		}
+
+		if err := waitRetry(fi.ctx, fi.opts.RetryAfter, fi.opts.ErrCh, sr.Err()); err != nil {
+			return
+		}
+	}
+}
+
+// Next blocks until a batch of entries has been read from one of the streams,
+// and returns it. If ctx is done first then ctx.Err() is returned. If the
+// StreamFanIn is closed then ErrClientClosed is returned.
+func (fi *StreamFanIn) Next(ctx context.Context) (StreamFanInEntries, error) {
+	select {
+	case entries := <-fi.entriesCh:
+		return entries, nil
+	case <-ctx.Done():
+		return StreamFanInEntries{}, ctx.Err()
+	case <-fi.ctx.Done():
+		return StreamFanInEntries{}, ErrClientClosed
+	}
+}
+
+// Close stops the StreamFanIn from reading. Since any blocking commands in
+// progress must complete first, Close may block for up to the Block duration
+// given in the StreamReaderOpts.
+func (fi *StreamFanIn) Close() error {
+	fi.cancel()
+	fi.wg.Wait()
+	return nil
+}
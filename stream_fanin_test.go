@@ -0,0 +1,82 @@
+package radix
+
+import (
+	"context"
+	"sync"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+)
+
+func TestStreamFanIn(t *T) {
+	t.Run("groupStreams", func(t *T) {
+		streams := map[string]*StreamEntryID{"{a}1": nil, "{a}2": nil, "{b}1": nil}
+		fi := &StreamFanIn{c: new(Cluster), opts: StreamFanInOpts{
+			StreamReaderOpts: StreamReaderOpts{Streams: streams},
+		}}
+		groups := fi.groupStreams()
+		require.Len(t, groups, 2)
+		assert.ElementsMatch(t, []map[string]*StreamEntryID{
+			{"{a}1": nil, "{a}2": nil},
+			{"{b}1": nil},
+		}, groups)
+
+		fi.c = Stub("tcp", "127.0.0.1:6379", nil)
+		assert.Equal(t, []map[string]*StreamEntryID{streams}, fi.groupStreams())
+	})
+
+	var l sync.Mutex
+	var ids [][]string
+	fail := true
+	client := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		l.Lock()
+		defer l.Unlock()
+		ids = append(ids, args[len(args)-2:])
+		if fail {
+			fail = false
+			return []interface{}{[]interface{}{"a", []interface{}{
+				[]interface{}{"1-0", []string{"k", "v"}},
+			}}}
+		} else if len(ids) == 2 {
+			return errors.New("network error")
+		}
+		time.Sleep(time.Millisecond)
+		return []interface{}{[]interface{}{"b", []interface{}{
+			[]interface{}{"2-0", []string{"k", "v"}},
+		}}}
+	})
+
+	errCh := make(chan error, 1)
+	id := StreamEntryID{}
+	fi := NewStreamFanIn(client, StreamFanInOpts{
+		StreamReaderOpts: StreamReaderOpts{
+			Streams: map[string]*StreamEntryID{"a": &id, "b": &id},
+		},
+		RetryAfter: time.Millisecond,
+		ErrCh:      errCh,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := fi.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "a", res.Stream)
+	assert.Equal(t, StreamEntryID{Time: 1}, res.Entries[0].ID)
+
+	res, err = fi.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "b", res.Stream)
+	assert.Error(t, <-errCh)
+
+	// after the error reading resumed from the last entry read from "a"
+	l.Lock()
+	assert.ElementsMatch(t, []string{"1-0", "0-0"}, ids[2])
+	l.Unlock()
+
+	require.NoError(t, fi.Close())
+	_, err = fi.Next(ctx)
+	assert.Equal(t, ErrClientClosed, err)
+}
@@ -0,0 +1,466 @@
+package radix
+
+import (
+	"bufio"
+	"strconv"
+	"time"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+// unmarshalInfoFields reads a RESP array of alternating field names and
+// values, as returned by the XINFO commands. For each field fn is called with
+// the field's name, and returns the receiver to unmarshal the value into, as
+// with resp2.Any. If fn returns nil then the value is discarded, so that
+// fields added in later versions of redis are ignored.
+func unmarshalInfoFields(br *bufio.Reader, fn func(field string) interface{}) error {
+	var ah resp2.ArrayHeader
+	if err := ah.UnmarshalRESP(br); err != nil {
+		return err
+	} else if ah.N%2 != 0 {
+		return errors.Errorf("invalid XINFO response: odd number of elements (%d)", ah.N)
+	}
+
+	var field resp2.BulkString
+	for i := 0; i < ah.N; i += 2 {
+		if err := field.UnmarshalRESP(br); err != nil {
+			return err
+		} else if err := (resp2.Any{I: fn(field.S)}).UnmarshalRESP(br); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// msTime converts a unix timestamp in milliseconds, as used by XINFO, into a
+// time.Time. Negative timestamps, which redis uses for events which haven't
+// happened, result in the zero time.Time.
+func msTime(ms int64) time.Time {
+	if ms < 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+// maybeStreamEntry unmarshals a stream entry into *e, setting it to nil if the
+// value is nil.
+type maybeStreamEntry struct {
+	e **StreamEntry
+}
+
+func (m maybeStreamEntry) UnmarshalRESP(br *bufio.Reader) error {
+	var entry StreamEntry
+	mn := MaybeNil{Rcv: &entry}
+	if err := mn.UnmarshalRESP(br); err != nil {
+		return err
+	} else if mn.Nil || mn.EmptyArray {
+		*m.e = nil
+	} else {
+		*m.e = &entry
+	}
+	return nil
+}
+
+// maybeInt64 unmarshals an integer into *i, setting it to nil if the value is
+// nil.
+type maybeInt64 struct {
+	i **int64
+}
+
+func (m maybeInt64) UnmarshalRESP(br *bufio.Reader) error {
+	var i int64
+	mn := MaybeNil{Rcv: &i}
+	if err := mn.UnmarshalRESP(br); err != nil {
+		return err
+	} else if mn.Nil {
+		*m.i = nil
+	} else {
+		*m.i = &i
+	}
+	return nil
+}
+
+// StreamInfoCommon contains the fields common to StreamInfo and
+// StreamInfoFull, i.e. the replies of XINFO STREAM with and without the FULL
+// option.
+type StreamInfoCommon struct {
+	// Length is the number of entries in the stream.
+	Length int64
+
+	// RadixTreeKeys and RadixTreeNodes describe the stream's underlying data
+	// structure.
+	RadixTreeKeys, RadixTreeNodes int64
+
+	// LastGeneratedID is the ID of the entry most recently added to the
+	// stream, which may since have been deleted.
+	LastGeneratedID StreamEntryID
+
+	// MaxDeletedEntryID is the largest ID of any entry deleted from the
+	// stream. It's only reported by redis 7.0 or later.
+	MaxDeletedEntryID StreamEntryID
+
+	// EntriesAdded is the number of entries ever added to the stream. It's only
+	// reported by redis 7.0 or later.
+	EntriesAdded int64
+
+	// RecordedFirstEntryID is the ID of the first entry in the stream. It's
+	// only reported by redis 7.0 or later.
+	RecordedFirstEntryID StreamEntryID
+}
+
+func (s *StreamInfoCommon) field(field string) interface{} {
+	switch field {
+	case "length":
+		return &s.Length
+	case "radix-tree-keys":
+		return &s.RadixTreeKeys
+	case "radix-tree-nodes":
+		return &s.RadixTreeNodes
+	case "last-generated-id":
+		return &s.LastGeneratedID
+	case "max-deleted-entry-id":
+		return &s.MaxDeletedEntryID
+	case "entries-added":
+		return &s.EntriesAdded
+	case "recorded-first-entry-id":
+		return &s.RecordedFirstEntryID
+	default:
+		return nil
+	}
+}
+
+// StreamInfo is the reply of XINFO STREAM, see XInfoStream.
+type StreamInfo struct {
+	StreamInfoCommon
+
+	// Groups is the number of consumer groups of the stream.
+	Groups int64
+
+	// FirstEntry and LastEntry are the first and last entries in the stream,
+	// or nil if the stream is empty.
+	FirstEntry, LastEntry *StreamEntry
+}
+
+var _ resp.Unmarshaler = (*StreamInfo)(nil)
+
+// UnmarshalRESP implements the resp.Unmarshaler interface.
+func (s *StreamInfo) UnmarshalRESP(br *bufio.Reader) error {
+	*s = StreamInfo{}
+	return unmarshalInfoFields(br, func(field string) interface{} {
+		switch field {
+		case "groups":
+			return &s.Groups
+		case "first-entry":
+			return maybeStreamEntry{&s.FirstEntry}
+		case "last-entry":
+			return maybeStreamEntry{&s.LastEntry}
+		default:
+			return s.StreamInfoCommon.field(field)
+		}
+	})
+}
+
+// StreamInfoFull is the reply of XINFO STREAM with the FULL option, see
+// XInfoStreamFull.
+type StreamInfoFull struct {
+	StreamInfoCommon
+
+	// Entries are the entries in the stream, in ascending order of ID, and
+	// limited by the count given to XInfoStreamFull.
+	Entries []StreamEntry
+
+	// Groups are the consumer groups of the stream.
+	Groups []StreamGroupInfoFull
+}
+
+var _ resp.Unmarshaler = (*StreamInfoFull)(nil)
+
+// UnmarshalRESP implements the resp.Unmarshaler interface.
+func (s *StreamInfoFull) UnmarshalRESP(br *bufio.Reader) error {
+	*s = StreamInfoFull{}
+	return unmarshalInfoFields(br, func(field string) interface{} {
+		switch field {
+		case "entries":
+			return &s.Entries
+		case "groups":
+			return &s.Groups
+		default:
+			return s.StreamInfoCommon.field(field)
+		}
+	})
+}
+
+// StreamGroupInfo is an element of the reply of XINFO GROUPS, see XInfoGroups.
+type StreamGroupInfo struct {
+	// Name is the name of the consumer group.
+	Name string
+
+	// Consumers is the number of consumers in the group.
+	Consumers int64
+
+	// Pending is the length of the group's pending entries list (PEL), i.e.
+	// the number of entries which have been delivered but not acknowledged.
+	Pending int64
+
+	// LastDeliveredID is the ID of the last entry delivered to the group.
+	LastDeliveredID StreamEntryID
+
+	// EntriesRead is the logical read counter of the group. It's only reported
+	// by redis 7.0 or later.
+	EntriesRead int64
+
+	// Lag is the number of entries in the stream which are yet to be delivered
+	// to the group. It's nil if redis can't determine the lag, or doesn't
+	// report it (prior to 7.0).
+	Lag *int64
+}
+
+var _ resp.Unmarshaler = (*StreamGroupInfo)(nil)
+
+// UnmarshalRESP implements the resp.Unmarshaler interface.
+func (g *StreamGroupInfo) UnmarshalRESP(br *bufio.Reader) error {
+	*g = StreamGroupInfo{}
+	return unmarshalInfoFields(br, func(field string) interface{} {
+		switch field {
+		case "name":
+			return &g.Name
+		case "consumers":
+			return &g.Consumers
+		case "pending":
+			return &g.Pending
+		case "last-delivered-id":
+			return &g.LastDeliveredID
+		case "entries-read":
+			return &g.EntriesRead
+		case "lag":
+			return maybeInt64{&g.Lag}
+		default:
+			return nil
+		}
+	})
+}
+
+// StreamGroupInfoFull describes a consumer group as part of the reply of XINFO
+// STREAM with the FULL option.
+type StreamGroupInfoFull struct {
+	// Name, LastDeliveredID, EntriesRead and Lag are the same as the fields of
+	// StreamGroupInfo.
+	Name            string
+	LastDeliveredID StreamEntryID
+	EntriesRead     int64
+	Lag             *int64
+
+	// PELCount is the length of the group's pending entries list (PEL).
+	PELCount int64
+
+	// Pending is the group's pending entries list, limited by the count given
+	// to XInfoStreamFull.
+	Pending []StreamPendingEntry
+
+	// Consumers are the consumers in the group.
+	Consumers []StreamConsumerInfoFull
+}
+
+var _ resp.Unmarshaler = (*StreamGroupInfoFull)(nil)
+
+// UnmarshalRESP implements the resp.Unmarshaler interface.
+func (g *StreamGroupInfoFull) UnmarshalRESP(br *bufio.Reader) error {
+	*g = StreamGroupInfoFull{}
+	return unmarshalInfoFields(br, func(field string) interface{} {
+		switch field {
+		case "name":
+			return &g.Name
+		case "last-delivered-id":
+			return &g.LastDeliveredID
+		case "entries-read":
+			return &g.EntriesRead
+		case "lag":
+			return maybeInt64{&g.Lag}
+		case "pel-count":
+			return &g.PELCount
+		case "pending":
+			return &g.Pending
+		case "consumers":
+			return &g.Consumers
+		default:
+			return nil
+		}
+	})
+}
+
+// StreamConsumerInfo is an element of the reply of XINFO CONSUMERS, see
+// XInfoConsumers.
+type StreamConsumerInfo struct {
+	// Name is the name of the consumer.
+	Name string
+
+	// Pending is the number of entries which have been delivered to the
+	// consumer but not acknowledged.
+	Pending int64
+
+	// Idle is the time since the consumer last attempted an interaction, e.g.
+	// XREADGROUP, XCLAIM or XAUTOCLAIM.
+	Idle time.Duration
+
+	// Inactive is the time since the consumer last successfully interacted,
+	// i.e. actually read or claimed entries. It's -1 if the consumer never
+	// has, and zero if redis doesn't report it (prior to 7.2).
+	Inactive time.Duration
+}
+
+var _ resp.Unmarshaler = (*StreamConsumerInfo)(nil)
+
+// UnmarshalRESP implements the resp.Unmarshaler interface.
+func (c *StreamConsumerInfo) UnmarshalRESP(br *bufio.Reader) error {
+	*c = StreamConsumerInfo{}
+	var idleMS, inactiveMS int64
+	err := unmarshalInfoFields(br, func(field string) interface{} {
+		switch field {
+		case "name":
+			return &c.Name
+		case "pending":
+			return &c.Pending
+		case "idle":
+			return &idleMS
+		case "inactive":
+			return &inactiveMS
+		default:
+			return nil
+		}
+	})
+	c.Idle = time.Duration(idleMS) * time.Millisecond
+	if c.Inactive = time.Duration(inactiveMS) * time.Millisecond; inactiveMS < 0 {
+		c.Inactive = -1
+	}
+	return err
+}
+
+// StreamConsumerInfoFull describes a consumer as part of the reply of XINFO
+// STREAM with the FULL option.
+type StreamConsumerInfoFull struct {
+	// Name is the name of the consumer.
+	Name string
+
+	// SeenTime is when the consumer last attempted an interaction.
+	SeenTime time.Time
+
+	// ActiveTime is when the consumer last successfully interacted. It's the
+	// zero time.Time if the consumer never has, or if redis doesn't report it
+	// (prior to 7.2).
+	ActiveTime time.Time
+
+	// PELCount is the number of entries which have been delivered to the
+	// consumer but not acknowledged.
+	PELCount int64
+
+	// Pending is the consumer's pending entries, limited by the count given to
+	// XInfoStreamFull. The Consumer field of each is set to Name.
+	Pending []StreamPendingEntry
+}
+
+var _ resp.Unmarshaler = (*StreamConsumerInfoFull)(nil)
+
+// UnmarshalRESP implements the resp.Unmarshaler interface.
+func (c *StreamConsumerInfoFull) UnmarshalRESP(br *bufio.Reader) error {
+	*c = StreamConsumerInfoFull{}
+	seenMS, activeMS := int64(-1), int64(-1)
+	err := unmarshalInfoFields(br, func(field string) interface{} {
+		switch field {
+		case "name":
+			return &c.Name
+		case "seen-time":
+			return &seenMS
+		case "active-time":
+			return &activeMS
+		case "pel-count":
+			return &c.PELCount
+		case "pending":
+			return &c.Pending
+		default:
+			return nil
+		}
+	})
+	c.SeenTime, c.ActiveTime = msTime(seenMS), msTime(activeMS)
+	for i := range c.Pending {
+		c.Pending[i].Consumer = c.Name
+	}
+	return err
+}
+
+// StreamPendingEntry is an entry in the pending entries list (PEL) of a
+// consumer group, as returned by XINFO STREAM with the FULL option.
+type StreamPendingEntry struct {
+	// ID is the ID of the entry.
+	ID StreamEntryID
+
+	// Consumer is the name of the consumer the entry was delivered to.
+	Consumer string
+
+	// DeliveredAt is when the entry was last delivered.
+	DeliveredAt time.Time
+
+	// Deliveries is the number of times the entry has been delivered.
+	Deliveries int64
+}
+
+var _ resp.Unmarshaler = (*StreamPendingEntry)(nil)
+
+// UnmarshalRESP implements the resp.Unmarshaler interface.
+//
+// The entries of a group's PEL are arrays of the ID, consumer, delivery time
+// and delivery count, while those of a consumer's PEL omit the consumer.
+func (p *StreamPendingEntry) UnmarshalRESP(br *bufio.Reader) error {
+	*p = StreamPendingEntry{}
+	var ah resp2.ArrayHeader
+	if err := ah.UnmarshalRESP(br); err != nil {
+		return err
+	} else if ah.N != 3 && ah.N != 4 {
+		return errors.Errorf("invalid pending entry: expected 3 or 4 elements, got %d", ah.N)
+	} else if err := p.ID.UnmarshalRESP(br); err != nil {
+		return err
+	}
+
+	if ah.N == 4 {
+		if err := (resp2.Any{I: &p.Consumer}).UnmarshalRESP(br); err != nil {
+			return err
+		}
+	}
+
+	var deliveredMS int64
+	if err := (resp2.Any{I: &deliveredMS}).UnmarshalRESP(br); err != nil {
+		return err
+	} else if err := (resp2.Any{I: &p.Deliveries}).UnmarshalRESP(br); err != nil {
+		return err
+	}
+	p.DeliveredAt = msTime(deliveredMS)
+	return nil
+}
+
+// XInfoStream returns a CmdAction which performs XINFO STREAM on the given
+// stream, unmarshaling the reply into rcv.
+func XInfoStream(rcv *StreamInfo, stream string) CmdAction {
+	return Cmd(rcv, "XINFO", "STREAM", stream)
+}
+
+// XInfoStreamFull returns a CmdAction which performs XINFO STREAM with the
+// FULL option on the given stream, unmarshaling the reply into rcv. count
+// limits the number of entries, as well as PEL entries of each group and
+// consumer, which are returned. If count is zero then all are returned.
+func XInfoStreamFull(rcv *StreamInfoFull, stream string, count int) CmdAction {
+	return Cmd(rcv, "XINFO", "STREAM", stream, "FULL", "COUNT", strconv.Itoa(count))
+}
+
+// XInfoGroups returns a CmdAction which performs XINFO GROUPS on the given
+// stream, unmarshaling the reply into rcv.
+func XInfoGroups(rcv *[]StreamGroupInfo, stream string) CmdAction {
+	return Cmd(rcv, "XINFO", "GROUPS", stream)
+}
+
+// XInfoConsumers returns a CmdAction which performs XINFO CONSUMERS on the
+// given stream and consumer group, unmarshaling the reply into rcv.
+func XInfoConsumers(rcv *[]StreamConsumerInfo, stream, group string) CmdAction {
+	return Cmd(rcv, "XINFO", "CONSUMERS", stream, group)
+}
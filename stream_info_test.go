@@ -0,0 +1,147 @@
+package radix
+
+import (
+	"bufio"
+	"bytes"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mediocregopher/radix/v3/resp"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+func unmarshalFrom(t *T, reply interface{}, rcv resp.Unmarshaler) {
+	buf := new(bytes.Buffer)
+	require.NoError(t, resp2.Any{I: reply}.MarshalRESP(buf))
+	require.NoError(t, rcv.UnmarshalRESP(bufio.NewReader(buf)))
+	assert.Zero(t, buf.Len())
+}
+
+func TestStreamInfo(t *T) {
+	entry := func(id string, kv ...string) []interface{} {
+		return []interface{}{id, kv}
+	}
+
+	t.Run("stream", func(t *T) {
+		var info StreamInfo
+		unmarshalFrom(t, []interface{}{
+			"length", 2,
+			"radix-tree-keys", 1,
+			"radix-tree-nodes", 2,
+			"last-generated-id", "2-0",
+			"max-deleted-entry-id", "0-0",
+			"entries-added", 2,
+			"recorded-first-entry-id", "1-0",
+			"groups", 1,
+			"first-entry", entry("1-0", "a", "1"),
+			"last-entry", entry("2-0", "b", "2"),
+			"some-future-field", []interface{}{"x", 1},
+		}, &info)
+		assert.Equal(t, int64(2), info.Length)
+		assert.Equal(t, int64(1), info.RadixTreeKeys)
+		assert.Equal(t, StreamEntryID{Time: 2}, info.LastGeneratedID)
+		assert.Equal(t, StreamEntryID{Time: 1}, info.RecordedFirstEntryID)
+		assert.Equal(t, int64(1), info.Groups)
+		assert.Equal(t, &StreamEntry{ID: StreamEntryID{Time: 1}, Fields: map[string]string{"a": "1"}}, info.FirstEntry)
+		assert.Equal(t, &StreamEntry{ID: StreamEntryID{Time: 2}, Fields: map[string]string{"b": "2"}}, info.LastEntry)
+
+		// an empty stream has nil first and last entries
+		unmarshalFrom(t, []interface{}{
+			"length", 0, "first-entry", nil, "last-entry", nil,
+		}, &info)
+		assert.Zero(t, info.Length)
+		assert.Nil(t, info.FirstEntry)
+		assert.Nil(t, info.LastEntry)
+	})
+
+	t.Run("groups", func(t *T) {
+		var groups []StreamGroupInfo
+		unmarshalFrom(t, []interface{}{
+			[]interface{}{
+				"name", "g1", "consumers", 2, "pending", 3,
+				"last-delivered-id", "5-1", "entries-read", 5, "lag", 1,
+			},
+			[]interface{}{
+				"name", "g2", "consumers", 0, "pending", 0,
+				"last-delivered-id", "0-0", "entries-read", nil, "lag", nil,
+			},
+		}, resp2.Any{I: &groups})
+		require.Len(t, groups, 2)
+		lag := int64(1)
+		assert.Equal(t, StreamGroupInfo{
+			Name: "g1", Consumers: 2, Pending: 3,
+			LastDeliveredID: StreamEntryID{Time: 5, Seq: 1},
+			EntriesRead:     5, Lag: &lag,
+		}, groups[0])
+		assert.Equal(t, StreamGroupInfo{Name: "g2"}, groups[1])
+	})
+
+	t.Run("consumers", func(t *T) {
+		var consumers []StreamConsumerInfo
+		unmarshalFrom(t, []interface{}{
+			[]interface{}{"name", "c1", "pending", 2, "idle", 1500, "inactive", 2500},
+			[]interface{}{"name", "c2", "pending", 0, "idle", 10, "inactive", -1},
+			[]interface{}{"name", "c3", "pending", 0, "idle", 10},
+		}, resp2.Any{I: &consumers})
+		assert.Equal(t, []StreamConsumerInfo{
+			{Name: "c1", Pending: 2, Idle: 1500 * time.Millisecond, Inactive: 2500 * time.Millisecond},
+			{Name: "c2", Idle: 10 * time.Millisecond, Inactive: -1},
+			{Name: "c3", Idle: 10 * time.Millisecond},
+		}, consumers)
+	})
+
+	t.Run("full", func(t *T) {
+		var info StreamInfoFull
+		unmarshalFrom(t, []interface{}{
+			"length", 1,
+			"last-generated-id", "1-0",
+			"entries", []interface{}{entry("1-0", "a", "1")},
+			"groups", []interface{}{
+				[]interface{}{
+					"name", "g1",
+					"last-delivered-id", "1-0",
+					"entries-read", 1,
+					"lag", 0,
+					"pel-count", 1,
+					"pending", []interface{}{
+						[]interface{}{"1-0", "c1", 1000, 2},
+					},
+					"consumers", []interface{}{
+						[]interface{}{
+							"name", "c1",
+							"seen-time", 1000,
+							"active-time", -1,
+							"pel-count", 1,
+							"pending", []interface{}{
+								[]interface{}{"1-0", 1000, 2},
+							},
+						},
+					},
+				},
+			},
+		}, &info)
+
+		assert.Equal(t, int64(1), info.Length)
+		assert.Equal(t, []StreamEntry{{ID: StreamEntryID{Time: 1}, Fields: map[string]string{"a": "1"}}}, info.Entries)
+		require.Len(t, info.Groups, 1)
+		g := info.Groups[0]
+		assert.Equal(t, "g1", g.Name)
+		assert.Equal(t, int64(0), *g.Lag)
+		assert.Equal(t, int64(1), g.PELCount)
+
+		pending := StreamPendingEntry{
+			ID: StreamEntryID{Time: 1}, Consumer: "c1",
+			DeliveredAt: time.Unix(1, 0), Deliveries: 2,
+		}
+		assert.Equal(t, []StreamPendingEntry{pending}, g.Pending)
+		assert.Equal(t, []StreamConsumerInfoFull{{
+			Name:     "c1",
+			SeenTime: time.Unix(1, 0),
+			PELCount: 1,
+			Pending:  []StreamPendingEntry{pending},
+		}}, g.Consumers)
+	})
+}
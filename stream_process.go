@@ -0,0 +1,223 @@
+package radix
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+// StreamProcessorOpts are the options given to ProcessStream.
+//
+// Stream, Group and Consumer are required.
+type StreamProcessorOpts struct {
+	// Stream, Group and Consumer are the stream, consumer group and consumer
+	// which entries are read using XREADGROUP. The group must already exist.
+	Stream, Group, Consumer string
+
+	// DedupeKey is the key of the sorted set used to record which entries
+	// have been processed. When using a Cluster it must belong to the same
+	// slot as Stream, e.g. by giving both the same hash tag.
+	//
+	// The default, if DedupeKey is empty, is Stream suffixed with ":processed".
+	DedupeKey string
+
+	// IdempotencyField is the field of each entry whose value identifies it
+	// for the purpose of deduplication. This allows entries which producers
+	// added more than once, e.g. because they retried an XADD, to be
+	// recognized as duplicates. Entries which don't have the field are
+	// identified by their ID.
+	//
+	// If IdempotencyField is empty then entries are identified by their ID.
+	IdempotencyField string
+
+	// DedupeTTL is how long entries are recorded as being processed for.
+	// Duplicates of an entry which are processed after this time aren't
+	// recognized as such.
+	//
+	// The default, if DedupeTTL is 0, is 24 hours.
+	DedupeTTL time.Duration
+
+	// Count is the maximum number of entries read by each XREADGROUP.
+	//
+	// The default, if Count is 0, is 10.
+	Count int
+
+	// Block is the longest time each XREADGROUP will block waiting for new
+	// entries. As with ListConsumerOpts.Block, it's shortened to fit within
+	// the deadline of the context given to ProcessStream.
+	//
+	// The default, if Block is 0, is 5 seconds.
+	Block time.Duration
+
+	// RetryAfter is how long to wait before trying again after a command
+	// fails, e.g. due to a network error.
+	//
+	// The default, if RetryAfter is 0, is 1 second.
+	RetryAfter time.Duration
+
+	// ErrCh, if set, will have errors which ProcessStream recovers from
+	// written to it. If the channel blocks the error will be dropped.
+	ErrCh chan<- error
+}
+
+func (opts StreamProcessorOpts) withDefaults() StreamProcessorOpts {
+	if opts.DedupeKey == "" {
+		opts.DedupeKey = opts.Stream + ":processed"
+	}
+	if opts.DedupeTTL == 0 {
+		opts.DedupeTTL = 24 * time.Hour
+	}
+	if opts.Count == 0 {
+		opts.Count = 10
+	}
+	if opts.Block == 0 {
+		opts.Block = 5 * time.Second
+	}
+	if opts.RetryAfter == 0 {
+		opts.RetryAfter = 1 * time.Second
+	}
+	return opts
+}
+
+// streamCommitScript records an entry as processed and acknowledges it, so
+// that an entry is never acknowledged without being recorded. Entries recorded
+// longer ago than the TTL are removed.
+//
+//	KEYS: stream, dedupe key
+//	ARGV: group, entry ID, idempotency key, now (ms), TTL (ms)
+var streamCommitScript = NewEvalScript(2, `
+	redis.call("ZADD", KEYS[2], "NX", ARGV[4], ARGV[3])
+	redis.call("ZREMRANGEBYSCORE", KEYS[2], "-inf", "(" .. (tonumber(ARGV[4]) - tonumber(ARGV[5])))
+	return redis.call("XACK", KEYS[1], ARGV[1], ARGV[2])
+`)
+
+// ProcessStream reads entries from a stream as part of a consumer group, as
+// described by StreamProcessorOpts, and calls fn with each one. Once fn returns
+// nil for an entry, the entry is recorded as processed and acknowledged
+// atomically. Entries which were already recorded as processed, e.g. because
+// they were added to the stream twice, are acknowledged without fn being
+// called.
+//
+// This doesn't make processing exactly-once: if the process dies after fn
+// returns but before the entry is recorded, the entry will be processed again.
+// It does however prevent duplicates in all other cases, e.g. an entry being
+// reclaimed by another consumer (see StreamReclaimer) once this one has
+// processed it.
+//
+// When ProcessStream starts it first processes any entries which are pending
+// for the Consumer, i.e. which were delivered to it previously but not
+// acknowledged, before reading new entries.
+//
+// ProcessStream blocks until ctx is done, in which case ctx.Err() is returned,
+// or until fn returns an error, in which case that error is returned and the
+// entry is left pending. Errors returned when performing commands are written
+// to opts.ErrCh, if set, and retried after opts.RetryAfter.
+func ProcessStream(ctx context.Context, c Client, opts StreamProcessorOpts, fn func(ctx context.Context, entry StreamEntry) error) error {
+	opts = opts.withDefaults()
+	if opts.Stream == "" || opts.Group == "" || opts.Consumer == "" {
+		return errors.New("StreamProcessorOpts.Stream, Group and Consumer are required")
+	}
+
+	// "0" reads the Consumer's pending entries, which are read until there are
+	// none left, after which new entries are read.
+	id := "0"
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var res []StreamEntries
+		if err := c.Do(streamProcessorCmd(ctx, &res, opts, id)); err != nil {
+			if err := waitRetry(ctx, opts.RetryAfter, opts.ErrCh, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var entries []StreamEntry
+		if len(res) > 0 {
+			entries = res[0].Entries
+		}
+		if id != ">" {
+			if len(entries) == 0 {
+				id = ">"
+				continue
+			}
+			id = entries[len(entries)-1].ID.String()
+		}
+
+		for _, entry := range entries {
+			if err := processStreamEntry(ctx, c, opts, entry, fn); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func streamProcessorCmd(ctx context.Context, rcv interface{}, opts StreamProcessorOpts, id string) CmdAction {
+	args := []string{"GROUP", opts.Group, opts.Consumer, "COUNT", strconv.Itoa(opts.Count)}
+
+	// pending entries are returned immediately, so there's no need to block.
+	if id == ">" {
+		block := opts.Block
+		if deadline, ok := ctx.Deadline(); ok {
+			if untilDeadline := time.Until(deadline); untilDeadline < block {
+				block = untilDeadline
+			}
+		}
+		if block < time.Millisecond {
+			block = time.Millisecond
+		}
+		args = append(args, "BLOCK", durationMS(block))
+	}
+
+	args = append(args, "STREAMS", opts.Stream, id)
+	return Cmd(rcv, "XREADGROUP", args...)
+}
+
+func processStreamEntry(
+	ctx context.Context, c Client, opts StreamProcessorOpts, entry StreamEntry,
+	fn func(ctx context.Context, entry StreamEntry) error,
+) error {
+	key := entry.ID.String()
+	if v, ok := entry.Fields[opts.IdempotencyField]; ok && opts.IdempotencyField != "" {
+		key = v
+	}
+
+	// an entry which was deleted from the stream since being delivered is
+	// returned with no fields, and can't be processed.
+	var processed bool
+	if entry.Fields != nil {
+		for {
+			var score MaybeNil
+			err := c.Do(Cmd(&score, "ZSCORE", opts.DedupeKey, key))
+			if err == nil {
+				processed = !score.Nil
+				break
+			} else if err := waitRetry(ctx, opts.RetryAfter, opts.ErrCh, err); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !processed && entry.Fields != nil {
+		if err := fn(ctx, entry); err != nil {
+			return err
+		}
+	}
+
+	for {
+		now := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+		err := c.Do(streamCommitScript.Cmd(nil,
+			opts.Stream, opts.DedupeKey,
+			opts.Group, entry.ID.String(), key, now, durationMS(opts.DedupeTTL),
+		))
+		if err == nil {
+			return nil
+		} else if err := waitRetry(ctx, opts.RetryAfter, opts.ErrCh, err); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package radix
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+func TestProcessStream(t *T) {
+	var l sync.Mutex
+	pending := []interface{}{
+		[]interface{}{"1-0", []string{"key", "a"}},
+		[]interface{}{"2-0", "DELETED"}, // deleted since being delivered
+	}
+	fresh := []interface{}{
+		[]interface{}{"3-0", []string{"key", "b"}},
+		[]interface{}{"4-0", []string{"key", "a"}}, // duplicate of 1-0
+		[]interface{}{"5-0", []string{"other", "c"}},
+	}
+	processed := map[string]bool{}
+	var acked []string
+	var reads []string
+	client := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		l.Lock()
+		defer l.Unlock()
+		switch args[0] {
+		case "XREADGROUP":
+			reads = append(reads, strings.Join(args[1:], " "))
+			var entries []interface{}
+			switch id := args[len(args)-1]; id {
+			case "0":
+				entries = pending
+			case ">":
+				entries, fresh = fresh, nil
+			}
+			if len(entries) == 0 {
+				return nil
+			}
+			// entries which were deleted have nil fields, which Stub can't
+			// produce on its own.
+			buf := new(bytes.Buffer)
+			resp2.Any{I: []interface{}{[]interface{}{"s", entries}}}.MarshalRESP(buf)
+			return resp2.RawMessage(bytes.Replace(buf.Bytes(), []byte("$7\r\nDELETED\r\n"), []byte("*-1\r\n"), -1))
+		case "ZSCORE":
+			if processed[args[2]] {
+				return 1
+			}
+			return nil
+		case "EVALSHA":
+			// KEYS: stream, dedupe key ARGV: group, id, key, now, ttl
+			processed[args[7]] = true
+			acked = append(acked, args[6])
+			return 1
+		}
+		return errors.New("unexpected command")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var got []string
+	err := ProcessStream(ctx, client, StreamProcessorOpts{
+		Stream:           "s",
+		Group:            "g",
+		Consumer:         "c",
+		IdempotencyField: "key",
+	}, func(_ context.Context, e StreamEntry) error {
+		if got = append(got, e.ID.String()); len(got) == 3 {
+			cancel()
+		}
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, []string{"1-0", "3-0", "5-0"}, got)
+
+	l.Lock()
+	assert.Equal(t, []string{"1-0", "2-0", "3-0", "4-0", "5-0"}, acked)
+	assert.Equal(t, map[string]bool{"a": true, "b": true, "5-0": true, "2-0": true}, processed)
+	// pending entries are read after the last one returned until there are
+	// none, and without blocking.
+	assert.Equal(t, "GROUP g c COUNT 10 STREAMS s 0", reads[0])
+	assert.Equal(t, "GROUP g c COUNT 10 STREAMS s 2-0", reads[1])
+	assert.Contains(t, reads[2], "BLOCK")
+	l.Unlock()
+
+	// an error from fn leaves the entry unacknowledged
+	l.Lock()
+	fresh = []interface{}{[]interface{}{"6-0", []string{"key", "d"}}}
+	pending = nil
+	l.Unlock()
+	errFn := errors.New("fn failed")
+	err = ProcessStream(context.Background(), client, StreamProcessorOpts{
+		Stream: "s", Group: "g", Consumer: "c",
+	}, func(context.Context, StreamEntry) error { return errFn })
+	assert.Equal(t, errFn, err)
+	l.Lock()
+	assert.Len(t, acked, 5)
+	l.Unlock()
+}
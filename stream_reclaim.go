@@ -0,0 +1,300 @@
+package radix
+
+import (
+	"bufio"
+	"strconv"
+	"sync"
+	"time"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp"
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+)
+
+// StreamReclaimerOpts contains the options given to NewStreamReclaimer.
+//
+// Stream, Group, Consumer and MinIdle are required.
+type StreamReclaimerOpts struct {
+	// Stream and Group are the stream and consumer group whose pending entries
+	// are reclaimed.
+	Stream, Group string
+
+	// Consumer is the consumer which reclaimed entries are reassigned to.
+	Consumer string
+
+	// MinIdle is how long an entry must have gone unacknowledged since it was
+	// last delivered before it's reclaimed.
+	MinIdle time.Duration
+
+	// Interval is how often pending entries are checked.
+	//
+	// The default, if Interval is 0, is 30 seconds.
+	Interval time.Duration
+
+	// Count is the maximum number of entries which are read by each XPENDING
+	// and XAUTOCLAIM performed.
+	//
+	// The default, if Count is 0, is 100.
+	Count int
+
+	// MaxDeliveries, if greater than zero, is the number of times an entry may
+	// be delivered before it's considered to be failing repeatedly. Such
+	// entries, once idle for MinIdle, are added to DeadLetterStream and
+	// acknowledged, rather than being reclaimed.
+	MaxDeliveries int
+
+	// DeadLetterStream is the stream which entries exceeding MaxDeliveries are
+	// added to, with the same fields as the original entry. It's required if
+	// MaxDeliveries is set.
+	DeadLetterStream string
+
+	// OnClaim, if set, is called with the entries reclaimed by each XAUTOCLAIM
+	// performed, which are now pending for Consumer. If not set the entries
+	// can still be read by Consumer using XREADGROUP with an ID of 0.
+	OnClaim func(entries []StreamEntry)
+
+	// OnDeadLetter, if set, is called with each entry added to
+	// DeadLetterStream and the number of times it was delivered.
+	OnDeadLetter func(entry StreamEntry, deliveries int64)
+
+	// ErrCh, if set, will have errors encountered in the background written
+	// to it. If the channel blocks the error will be dropped.
+	ErrCh chan<- error
+}
+
+// StreamReclaimResult describes the outcome of a call to Reclaim on a
+// StreamReclaimer.
+type StreamReclaimResult struct {
+	// Claimed is the number of entries which were reassigned to the Consumer.
+	Claimed int
+
+	// DeadLettered is the number of entries which were added to the
+	// DeadLetterStream and acknowledged.
+	DeadLettered int
+}
+
+// StreamReclaimer periodically reclaims the entries of a consumer group which
+// have been delivered to a consumer but not acknowledged within some time,
+// e.g. because the consumer died while processing them. Reclaimed entries are
+// reassigned to another consumer using XAUTOCLAIM. Entries which have been
+// delivered too many times can optionally be moved to a dead-letter stream
+// instead, so that an entry which always fails to be processed doesn't get
+// reclaimed forever.
+//
+// XAUTOCLAIM, and the IDLE option of XPENDING, require redis 6.2 or later.
+type StreamReclaimer struct {
+	c    Client
+	opts StreamReclaimerOpts
+
+	closeOnce sync.Once
+	closeCh   chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewStreamReclaimer returns a StreamReclaimer for the given Client, which
+// starts checking for pending entries in the background after
+// opts.Interval.
+//
+// Any changes on opts after calling NewStreamReclaimer will have no effect.
+func NewStreamReclaimer(c Client, opts StreamReclaimerOpts) (*StreamReclaimer, error) {
+	if opts.Stream == "" || opts.Group == "" || opts.Consumer == "" || opts.MinIdle <= 0 {
+		return nil, errors.New("StreamReclaimerOpts.Stream, Group, Consumer and MinIdle are required")
+	} else if opts.MaxDeliveries > 0 && opts.DeadLetterStream == "" {
+		return nil, errors.New("StreamReclaimerOpts.DeadLetterStream is required if MaxDeliveries is set")
+	}
+	if opts.Interval == 0 {
+		opts.Interval = 30 * time.Second
+	}
+	if opts.Count == 0 {
+		opts.Count = 100
+	}
+
+	sr := &StreamReclaimer{c: c, opts: opts, closeCh: make(chan struct{})}
+	sr.wg.Add(1)
+	go func() {
+		defer sr.wg.Done()
+		sr.spin()
+	}()
+	return sr, nil
+}
+
+func (sr *StreamReclaimer) spin() {
+	t := time.NewTicker(sr.opts.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if _, err := sr.Reclaim(); err != nil && sr.opts.ErrCh != nil {
+				select {
+				case sr.opts.ErrCh <- err:
+				default:
+				}
+			}
+		case <-sr.closeCh:
+			return
+		}
+	}
+}
+
+// Reclaim checks for idle pending entries immediately, rather than waiting for
+// the next interval, dead-lettering and reclaiming them as configured.
+func (sr *StreamReclaimer) Reclaim() (StreamReclaimResult, error) {
+	var res StreamReclaimResult
+	if sr.opts.MaxDeliveries > 0 {
+		n, err := sr.deadLetter()
+		res.DeadLettered = n
+		if err != nil {
+			return res, err
+		}
+	}
+
+	n, err := sr.claim()
+	res.Claimed = n
+	return res, err
+}
+
+// deadLetter moves idle pending entries which have exceeded MaxDeliveries to
+// the DeadLetterStream.
+func (sr *StreamReclaimer) deadLetter() (int, error) {
+	minIdle := strconv.FormatInt(sr.opts.MinIdle.Milliseconds(), 10)
+	count := strconv.Itoa(sr.opts.Count)
+
+	var n int
+	start := "-"
+	for {
+		// each pending entry is an array of its ID, consumer, idle time and
+		// number of deliveries.
+		var pending [][]string
+		err := sr.c.Do(Cmd(&pending, "XPENDING", sr.opts.Stream, sr.opts.Group,
+			"IDLE", minIdle, start, "+", count))
+		if err != nil {
+			return n, err
+		}
+
+		for _, p := range pending {
+			if len(p) != 4 {
+				return n, errors.Errorf("invalid XPENDING entry: %q", p)
+			}
+			deliveries, err := strconv.ParseInt(p[3], 10, 64)
+			if err != nil {
+				return n, errors.Errorf("invalid XPENDING delivery count %q: %w", p[3], err)
+			} else if deliveries <= int64(sr.opts.MaxDeliveries) {
+				continue
+			} else if err := sr.deadLetterEntry(p[0], deliveries); err != nil {
+				return n, err
+			}
+			n++
+		}
+
+		if len(pending) < sr.opts.Count {
+			return n, nil
+		}
+		start = "(" + pending[len(pending)-1][0]
+	}
+}
+
+func (sr *StreamReclaimer) deadLetterEntry(id string, deliveries int64) error {
+	var entries []StreamEntry
+	if err := sr.c.Do(Cmd(&entries, "XRANGE", sr.opts.Stream, id, id)); err != nil {
+		return err
+	}
+
+	// if the entry has since been deleted from the stream there's nothing to
+	// dead-letter, but it still needs to be acknowledged.
+	if len(entries) > 0 {
+		entry := entries[0]
+		args := make([]string, 0, 2+len(entry.Fields)*2)
+		args = append(args, sr.opts.DeadLetterStream, "*")
+		for k, v := range entry.Fields {
+			args = append(args, k, v)
+		}
+		if err := sr.c.Do(Cmd(nil, "XADD", args...)); err != nil {
+			return err
+		} else if sr.opts.OnDeadLetter != nil {
+			sr.opts.OnDeadLetter(entry, deliveries)
+		}
+	}
+
+	return sr.c.Do(Cmd(nil, "XACK", sr.opts.Stream, sr.opts.Group, id))
+}
+
+// claim reassigns idle pending entries to the Consumer using XAUTOCLAIM.
+func (sr *StreamReclaimer) claim() (int, error) {
+	minIdle := strconv.FormatInt(sr.opts.MinIdle.Milliseconds(), 10)
+	count := strconv.Itoa(sr.opts.Count)
+
+	var n int
+	cursor := "0-0"
+	for {
+		var res xautoclaimResult
+		err := sr.c.Do(Cmd(&res, "XAUTOCLAIM", sr.opts.Stream, sr.opts.Group,
+			sr.opts.Consumer, minIdle, cursor, "COUNT", count))
+		if err != nil {
+			return n, err
+		}
+
+		n += len(res.entries)
+		if len(res.entries) > 0 && sr.opts.OnClaim != nil {
+			sr.opts.OnClaim(res.entries)
+		}
+		if cursor = res.cursor; cursor == "0-0" {
+			return n, nil
+		}
+	}
+}
+
+// Close stops the StreamReclaimer's background checks, waiting for any which
+// is in progress to complete.
+func (sr *StreamReclaimer) Close() error {
+	sr.closeOnce.Do(func() { close(sr.closeCh) })
+	sr.wg.Wait()
+	return nil
+}
+
+// xautoclaimResult is the reply of XAUTOCLAIM, which is an array of the next
+// cursor, the claimed entries, and (since redis 7.0) the IDs of entries which
+// no longer exist. In redis 6.2 entries which no longer exist are returned as
+// nil, and are skipped.
+type xautoclaimResult struct {
+	cursor  string
+	entries []StreamEntry
+}
+
+var _ resp.Unmarshaler = (*xautoclaimResult)(nil)
+
+func (r *xautoclaimResult) UnmarshalRESP(br *bufio.Reader) error {
+	var ah resp2.ArrayHeader
+	if err := ah.UnmarshalRESP(br); err != nil {
+		return err
+	} else if ah.N < 2 {
+		return errors.Errorf("invalid XAUTOCLAIM response: expected at least 2 elements, got %d", ah.N)
+	}
+
+	if err := (resp2.Any{I: &r.cursor}).UnmarshalRESP(br); err != nil {
+		return err
+	}
+
+	var entriesAH resp2.ArrayHeader
+	if err := entriesAH.UnmarshalRESP(br); err != nil {
+		return err
+	}
+	r.entries = r.entries[:0]
+	for i := 0; i < entriesAH.N; i++ {
+		var entry StreamEntry
+		mn := MaybeNil{Rcv: &entry}
+		if err := mn.UnmarshalRESP(br); err != nil {
+			return err
+		} else if !mn.Nil {
+			r.entries = append(r.entries, entry)
+		}
+	}
+
+	// discard the deleted IDs, if any.
+	for i := 2; i < ah.N; i++ {
+		if err := (resp2.Any{}).UnmarshalRESP(br); err != nil {
+			return err
+		}
+	}
+	return nil
+}
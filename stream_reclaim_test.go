@@ -0,0 +1,102 @@
+package radix
+
+import (
+	"strings"
+	"sync"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+)
+
+func TestStreamReclaimer(t *T) {
+	var l sync.Mutex
+	var cmds []string
+	client := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		l.Lock()
+		cmds = append(cmds, strings.Join(args, " "))
+		l.Unlock()
+		switch args[0] {
+		case "XPENDING":
+			// the first page is full, the second is the last.
+			if args[5] == "-" {
+				return [][]interface{}{{"1-0", "dead", 5000, 2}, {"2-0", "dead", 5000, 4}}
+			}
+			return [][]interface{}{{"3-0", "dead", 5000, 5}}
+		case "XRANGE":
+			if args[2] == "3-0" {
+				// deleted from the stream
+				return []interface{}{}
+			}
+			return []interface{}{[]interface{}{args[2], []string{"k", "v"}}}
+		case "XADD":
+			return "100-0"
+		case "XACK":
+			return 1
+		case "XAUTOCLAIM":
+			if args[5] == "0-0" {
+				return []interface{}{"1-0", []interface{}{
+					[]interface{}{"1-0", []string{"k", "v"}},
+					nil,
+				}, []interface{}{}}
+			}
+			return []interface{}{"0-0", []interface{}{
+				[]interface{}{"5-0", []string{"k", "v"}},
+			}}
+		}
+		return errors.New("unexpected command")
+	})
+
+	_, err := NewStreamReclaimer(client, StreamReclaimerOpts{Stream: "s", Group: "g"})
+	assert.Error(t, err)
+	_, err = NewStreamReclaimer(client, StreamReclaimerOpts{
+		Stream: "s", Group: "g", Consumer: "c", MinIdle: time.Second, MaxDeliveries: 1,
+	})
+	assert.Error(t, err)
+
+	var claimed []StreamEntryID
+	var deadLettered []StreamEntryID
+	sr, err := NewStreamReclaimer(client, StreamReclaimerOpts{
+		Stream:           "s",
+		Group:            "g",
+		Consumer:         "c",
+		MinIdle:          time.Second,
+		Interval:         time.Hour,
+		Count:            2,
+		MaxDeliveries:    3,
+		DeadLetterStream: "s-dead",
+		OnClaim: func(entries []StreamEntry) {
+			for _, e := range entries {
+				claimed = append(claimed, e.ID)
+			}
+		},
+		OnDeadLetter: func(e StreamEntry, deliveries int64) {
+			deadLettered = append(deadLettered, e.ID)
+			assert.Equal(t, int64(4), deliveries)
+		},
+	})
+	require.NoError(t, err)
+	defer sr.Close()
+
+	res, err := sr.Reclaim()
+	require.NoError(t, err)
+	assert.Equal(t, StreamReclaimResult{Claimed: 2, DeadLettered: 2}, res)
+	assert.Equal(t, []StreamEntryID{{Time: 1}, {Time: 5}}, claimed)
+	assert.Equal(t, []StreamEntryID{{Time: 2}}, deadLettered)
+
+	l.Lock()
+	assert.Equal(t, []string{
+		"XPENDING s g IDLE 1000 - + 2",
+		"XRANGE s 2-0 2-0",
+		"XADD s-dead * k v",
+		"XACK s g 2-0",
+		"XPENDING s g IDLE 1000 (2-0 + 2",
+		"XRANGE s 3-0 3-0",
+		"XACK s g 3-0",
+		"XAUTOCLAIM s g c 1000 0-0 COUNT 2",
+		"XAUTOCLAIM s g c 1000 1-0 COUNT 2",
+	}, cmds)
+	l.Unlock()
+}
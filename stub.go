@@ -138,13 +138,13 @@ func (b *buffer) SetReadDeadline(t time.Time) error {
 }
 
 func (b *buffer) err(op string, err error) error {
-	return &net.OpError{
+	return wrapNetErr(&net.OpError{
 		Op:     op,
 		Net:    "tcp",
 		Source: nil,
 		Addr:   b.remoteAddr,
 		Err:    err,
-	}
+	})
 }
 
 var errClosed = errors.New("use of closed network connection")
@@ -189,33 +189,48 @@ func (s *stub) Do(a Action) error {
 	return a.Run(s)
 }
 
-func (s *stub) Encode(m resp.Marshaler) error {
+// unmarshalCmds marshals the given value and unmarshals the result into the
+// []string of each command it contains.
+func unmarshalCmds(m resp.Marshaler) ([][]string, error) {
 	// first marshal into a RawMessage
 	buf := new(bytes.Buffer)
 	if err := m.MarshalRESP(buf); err != nil {
-		return err
+		return nil, err
 	}
 	br := bufio.NewReader(buf)
 
+	var cmds [][]string
 	var rm resp2.RawMessage
 	for {
 		if buf.Len() == 0 && br.Buffered() == 0 {
-			break
+			return cmds, nil
 		} else if err := rm.UnmarshalRESP(br); err != nil {
-			return err
+			return nil, err
 		}
 		// unmarshal that into a string slice
 		var ss []string
 		if err := rm.UnmarshalInto(resp2.Any{I: &ss}); err != nil {
-			return err
+			return nil, err
 		}
+		cmds = append(cmds, ss)
+	}
+}
+
+func (s *stub) Encode(m resp.Marshaler) error {
+	cmds, err := unmarshalCmds(m)
+	if err != nil {
+		return err
+	}
 
+	for _, ss := range cmds {
 		// get return from callback. Results implementing resp.Marshaler are
 		// assumed to be wanting to be written in all cases, otherwise if the
 		// result is an error it is assumed to want to be returned directly.
 		ret := s.fn(ss)
 		if m, ok := ret.(resp.Marshaler); ok {
-			return s.buffer.Encode(m)
+			if err := s.buffer.Encode(m); err != nil {
+				return err
+			}
 		} else if err, _ := ret.(error); err != nil {
 			return err
 		} else if err = s.buffer.Encode(resp2.Any{I: ret}); err != nil {
@@ -64,6 +64,26 @@ func TestStubPipeline(t *T) {
 	assert.Equal(t, "bar", out)
 }
 
+func TestStubPipelineMarshaler(t *T) {
+	// replies implementing resp.Marshaler are written as-is, and mustn't
+	// prevent the replies to later commands in the pipeline being written.
+	stub := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		if args[0] == "PING" {
+			return resp2.SimpleString{S: "PONG"}
+		}
+		return args[1]
+	})
+	var pong, out string
+	err := stub.Do(Pipeline(
+		Cmd(&pong, "PING"),
+		Cmd(&out, "ECHO", "foo"),
+	))
+
+	require.Nil(t, err)
+	assert.Equal(t, "PONG", pong)
+	assert.Equal(t, "foo", out)
+}
+
 func TestStubLockingTimeout(t *T) {
 	stub := testStub()
 	wg := new(sync.WaitGroup)
@@ -103,6 +123,7 @@ func TestStubLockingTimeout(t *T) {
 	nerr, ok := err.(*net.OpError)
 	assert.True(t, ok)
 	assert.True(t, nerr.Timeout())
+	assert.True(t, errors.Is(err, ErrTimeout))
 }
 
 func ExampleStub() {
@@ -0,0 +1,239 @@
+package radix
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// TimeCounterBucket describes one of the sizes of time bucket a TimeCounter
+// counts in.
+type TimeCounterBucket struct {
+	// Size is the period of time covered by each bucket, e.g. a minute. It
+	// must be a whole number of seconds. Buckets are aligned to the zero time,
+	// so e.g. day buckets start at midnight UTC.
+	Size time.Duration
+
+	// TTL is how long a bucket is kept for once its period has ended.
+	TTL time.Duration
+}
+
+// TimeCounterOpts are the options given to NewTimeCounter.
+type TimeCounterOpts struct {
+	// Buckets are the sizes of bucket counted in, from smallest to largest.
+	// Each Size must be a multiple of the one before it.
+	//
+	// The default, if Buckets is empty, is minute buckets kept for a day, hour
+	// buckets kept for 30 days, and day buckets kept for a year.
+	Buckets []TimeCounterBucket
+
+	// Rollup, if set, causes increments to only be made to the smallest
+	// buckets, with larger buckets being computed from the smaller ones by
+	// Rollup. This reduces the cost of each increment, at the cost of Sum
+	// requiring more round-trips for periods which haven't yet been rolled up.
+	Rollup bool
+}
+
+var defaultTimeCounterBuckets = []TimeCounterBucket{
+	{Size: time.Minute, TTL: 24 * time.Hour},
+	{Size: time.Hour, TTL: 30 * 24 * time.Hour},
+	{Size: 24 * time.Hour, TTL: 365 * 24 * time.Hour},
+}
+
+// TimeCounter counts events in buckets of time, e.g. per minute, hour and day,
+// using a string key per bucket which expires once the bucket is no longer
+// needed. It's intended for metrics and quotas, where the number of events
+// over some period of time needs to be known.
+//
+// The keys for a TimeCounter all share the hash tag "{key}", so that they all
+// belong to the same slot when used with a Cluster.
+//
+// A TimeCounter is safe for concurrent use.
+type TimeCounter struct {
+	c    Client
+	key  string
+	opts TimeCounterOpts
+}
+
+// NewTimeCounter returns a TimeCounter which keeps its buckets in keys
+// prefixed by the given key. It panics if opts.Buckets is invalid.
+func NewTimeCounter(c Client, key string, opts TimeCounterOpts) *TimeCounter {
+	if len(opts.Buckets) == 0 {
+		opts.Buckets = defaultTimeCounterBuckets
+	}
+	for i, b := range opts.Buckets {
+		if b.Size < time.Second || b.Size%time.Second != 0 {
+			panic(fmt.Sprintf("TimeCounterBucket Size %v is not a whole number of seconds", b.Size))
+		} else if i > 0 && b.Size%opts.Buckets[i-1].Size != 0 {
+			panic(fmt.Sprintf("TimeCounterBucket Size %v is not a multiple of %v", b.Size, opts.Buckets[i-1].Size))
+		}
+	}
+	return &TimeCounter{c: c, key: key, opts: opts}
+}
+
+// bucketKey returns the key of the bucket of the given size starting at start.
+func (tc *TimeCounter) bucketKey(b TimeCounterBucket, start time.Time) string {
+	return "{" + tc.key + "}:" +
+		strconv.FormatInt(int64(b.Size/time.Second), 10) + ":" +
+		strconv.FormatInt(start.Unix(), 10)
+}
+
+// bucketExpireAt returns the unix time, in milliseconds, at which the bucket
+// starting at start should expire.
+func bucketExpireAt(b TimeCounterBucket, start time.Time) string {
+	expireAt := start.Add(b.Size + b.TTL)
+	return strconv.FormatInt(expireAt.UnixNano()/int64(time.Millisecond), 10)
+}
+
+// Incr increments the counter by delta at the current time, and returns the
+// new count of the current smallest bucket.
+func (tc *TimeCounter) Incr(delta int64) (int64, error) {
+	return tc.IncrAt(time.Now(), delta)
+}
+
+// IncrAt increments the counter by delta at the given time, and returns the
+// new count of the smallest bucket containing that time. Each bucket
+// containing the time is incremented, or only the smallest if Rollup is set,
+// using a single pipeline.
+func (tc *TimeCounter) IncrAt(t time.Time, delta int64) (int64, error) {
+	buckets := tc.opts.Buckets
+	if tc.opts.Rollup {
+		buckets = buckets[:1]
+	}
+
+	var count int64
+	deltaStr := strconv.FormatInt(delta, 10)
+	cmds := make([]CmdAction, 0, len(buckets)*2)
+	for i, b := range buckets {
+		start := t.Truncate(b.Size)
+		key := tc.bucketKey(b, start)
+		var rcv interface{}
+		if i == 0 {
+			rcv = &count
+		}
+		cmds = append(cmds,
+			Cmd(rcv, "INCRBY", key, deltaStr),
+			Cmd(nil, "PEXPIREAT", key, bucketExpireAt(b, start)),
+		)
+	}
+	err := tc.c.Do(Pipeline(cmds...))
+	return count, err
+}
+
+// Sum returns the total count of the counter between from and to. The sum
+// covers all smallest buckets which overlap the range [from, to), using the
+// largest buckets possible so as to read as few keys as possible. Buckets
+// which have expired are counted as zero.
+func (tc *TimeCounter) Sum(from, to time.Time) (int64, error) {
+	if !from.Before(to) {
+		return 0, nil
+	}
+	size := tc.opts.Buckets[0].Size
+	from = from.Truncate(size)
+	if to.Truncate(size) != to {
+		to = to.Truncate(size).Add(size)
+	}
+	return tc.sum(len(tc.opts.Buckets)-1, from, to)
+}
+
+// sum returns the total count of the counter between from and to, both of
+// which are aligned to the smallest bucket, using buckets of the given level
+// or smaller.
+func (tc *TimeCounter) sum(level int, from, to time.Time) (int64, error) {
+	if !from.Before(to) {
+		return 0, nil
+	}
+
+	b := tc.opts.Buckets[level]
+	start := from.Truncate(b.Size)
+	if start.Before(from) {
+		start = start.Add(b.Size)
+	}
+	end := to.Truncate(b.Size)
+	if level > 0 && !start.Before(end) {
+		return tc.sum(level-1, from, to)
+	}
+
+	// the parts of the range not covered by whole buckets at this level are
+	// summed using smaller buckets.
+	var total int64
+	if level > 0 {
+		for _, r := range [][2]time.Time{{from, start}, {end, to}} {
+			n, err := tc.sum(level-1, r[0], r[1])
+			if err != nil {
+				return 0, err
+			}
+			total += n
+		}
+	}
+
+	var keys []string
+	var starts []time.Time
+	for s := start; s.Before(end); s = s.Add(b.Size) {
+		keys = append(keys, tc.bucketKey(b, s))
+		starts = append(starts, s)
+	}
+	counts := make([]int64, len(keys))
+	mns := make(Tuple, len(keys))
+	for i := range counts {
+		mns[i] = &MaybeNil{Rcv: &counts[i]}
+	}
+	if err := tc.c.Do(Cmd(mns, "MGET", keys...)); err != nil {
+		return 0, err
+	}
+
+	for i, count := range counts {
+		// buckets larger than the smallest which haven't been rolled up yet
+		// are computed from the smaller ones.
+		if tc.opts.Rollup && level > 0 && mns[i].(*MaybeNil).Nil {
+			var err error
+			if count, err = tc.sum(level-1, starts[i], starts[i].Add(b.Size)); err != nil {
+				return 0, err
+			}
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// timeCounterRollupScript sums the keys after the first into the first. Its
+// number of keys varies, and so is set when it's used.
+var timeCounterRollupScript = NewEvalScript(0, `
+	local sum = 0
+	for i = 2, #KEYS do
+		local n = redis.call("GET", KEYS[i])
+		if n then sum = sum + tonumber(n) end
+	end
+	redis.call("SET", KEYS[1], sum)
+	redis.call("PEXPIREAT", KEYS[1], ARGV[1])
+	return sum
+`)
+
+// Rollup is used when Rollup is set in TimeCounterOpts. For each bucket size
+// but the smallest, it computes the count of the most recent bucket which
+// ended at or before t from the buckets of the next smaller size, using a Lua
+// script, and stores it.
+//
+// Rollup should be called periodically, at least as often as the second
+// smallest bucket Size, e.g. every hour for minute, hour and day buckets, and
+// the smallest buckets' TTL must be long enough for them to still exist when
+// they're rolled up. Until a bucket has been rolled up Sum computes its count
+// from the smaller buckets.
+func (tc *TimeCounter) Rollup(t time.Time) error {
+	for i := 1; i < len(tc.opts.Buckets); i++ {
+		b, sub := tc.opts.Buckets[i], tc.opts.Buckets[i-1]
+		start := t.Truncate(b.Size).Add(-b.Size)
+
+		keysAndArgs := []string{tc.bucketKey(b, start)}
+		for s := start; s.Before(start.Add(b.Size)); s = s.Add(sub.Size) {
+			keysAndArgs = append(keysAndArgs, tc.bucketKey(sub, s))
+		}
+		script := timeCounterRollupScript
+		script.numKeys = len(keysAndArgs)
+		keysAndArgs = append(keysAndArgs, bucketExpireAt(b, start))
+		if err := tc.c.Do(script.Cmd(nil, keysAndArgs...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
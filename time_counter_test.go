@@ -0,0 +1,130 @@
+package radix
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	. "testing"
+	"time"
+
+	errors "golang.org/x/xerrors"
+
+	"github.com/mediocregopher/radix/v3/resp/resp2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTimeCounterStub returns a Stub which implements the commands used by
+// TimeCounter, including its rollup script, along with the map of keys it
+// stores.
+func newTimeCounterStub() (Client, map[string]int64, *sync.Mutex) {
+	var l sync.Mutex
+	m := map[string]int64{}
+	return Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		l.Lock()
+		defer l.Unlock()
+		switch args[0] {
+		case "INCRBY":
+			n, _ := strconv.ParseInt(args[2], 10, 64)
+			m[args[1]] += n
+			return m[args[1]]
+		case "PEXPIREAT":
+			return 1
+		case "MGET":
+			res := make([]interface{}, len(args)-1)
+			for i, k := range args[1:] {
+				if n, ok := m[k]; ok {
+					res[i] = strconv.FormatInt(n, 10)
+				}
+			}
+			return res
+		case "EVALSHA":
+			if args[1] != timeCounterRollupScript.sum {
+				return resp2.Error{E: errors.New("NOSCRIPT")}
+			}
+			numKeys, _ := strconv.Atoi(args[2])
+			keys := args[3 : 3+numKeys]
+			var sum int64
+			for _, k := range keys[1:] {
+				sum += m[k]
+			}
+			m[keys[0]] = sum
+			return sum
+		}
+		return resp2.Error{E: errors.Errorf("unexpected command %q", args)}
+	}), m, &l
+}
+
+func TestTimeCounter(t *T) {
+	buckets := []TimeCounterBucket{
+		{Size: time.Minute, TTL: time.Hour},
+		{Size: time.Hour, TTL: 24 * time.Hour},
+	}
+	hour := time.Date(2021, 3, 4, 5, 0, 0, 0, time.UTC)
+
+	t.Run("Incr", func(t *T) {
+		c, m, _ := newTimeCounterStub()
+		tc := NewTimeCounter(c, "tc", TimeCounterOpts{Buckets: buckets})
+		for _, d := range []time.Duration{-time.Minute, 0, 30 * time.Second, time.Hour + time.Minute} {
+			_, err := tc.IncrAt(hour.Add(d), 1)
+			require.NoError(t, err)
+		}
+		n, err := tc.IncrAt(hour, 2)
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), n)
+
+		hourKey := "{tc}:3600:" + strconv.FormatInt(hour.Unix(), 10)
+		assert.Equal(t, int64(4), m[hourKey])
+
+		for _, test := range []struct {
+			from, to time.Duration
+			exp      int64
+		}{
+			{-time.Hour, 2 * time.Hour, 6},
+			{0, time.Hour, 4},
+			{0, time.Minute, 4},
+			{time.Second, 2 * time.Second, 4},
+			{time.Second, time.Second, 0},
+			{-time.Minute, time.Hour + time.Minute, 5},
+			{time.Minute, time.Hour, 0},
+		} {
+			n, err := tc.Sum(hour.Add(test.from), hour.Add(test.to))
+			require.NoError(t, err)
+			assert.Equal(t, test.exp, n, "from:%v to:%v", test.from, test.to)
+		}
+	})
+
+	t.Run("Rollup", func(t *T) {
+		c, m, l := newTimeCounterStub()
+		tc := NewTimeCounter(c, "tc", TimeCounterOpts{Buckets: buckets, Rollup: true})
+		for _, d := range []time.Duration{0, time.Minute, 59 * time.Minute} {
+			_, err := tc.IncrAt(hour.Add(d), 1)
+			require.NoError(t, err)
+		}
+		assert.Len(t, m, 3)
+
+		n, err := tc.Sum(hour, hour.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), n)
+
+		// once rolled up the hour bucket is used, even if the minute buckets
+		// have expired.
+		require.NoError(t, tc.Rollup(hour.Add(time.Hour)))
+		l.Lock()
+		for k := range m {
+			if strings.HasPrefix(k, "{tc}:60:") {
+				delete(m, k)
+			}
+		}
+		l.Unlock()
+		n, err = tc.Sum(hour, hour.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), n)
+	})
+
+	assert.Panics(t, func() {
+		NewTimeCounter(nil, "tc", TimeCounterOpts{Buckets: []TimeCounterBucket{
+			{Size: time.Minute}, {Size: 90 * time.Second},
+		}})
+	})
+}
@@ -46,4 +46,9 @@ type ClusterRedirected struct {
 	// If true, then the MOVED/ASK error which was received will not be honored,
 	// and the call to Do will be returning the MOVED/ASK error.
 	Final bool
+
+	// Metadata is the metadata attached to the Action which was redirected,
+	// see radix.WithMetadata. It's nil if there was none, and must not be
+	// modified.
+	Metadata map[string]string
 }
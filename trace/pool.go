@@ -22,6 +22,10 @@ type PoolTrace struct {
 
 	// InitCompleted is called after pool fills its connections
 	InitCompleted func(PoolInitCompleted)
+
+	// ConnReplaced is called when the Pool replaces a connection which was
+	// discarded due to errors. See radix.PoolErrorBudget.
+	ConnReplaced func(PoolConnReplaced)
 }
 
 // PoolCommon contains information which is passed into all Pool-related
@@ -54,6 +58,25 @@ const (
 	// because the Pool was empty and an Action requires one. See the
 	// radix.PoolOnEmpty options.
 	PoolConnCreatedReasonPoolEmpty PoolConnCreatedReason = "pool empty"
+
+	// PoolConnCreatedReasonBlocking indicates a connection was being created
+	// to perform a blocking command on. See radix.PoolBlockingConns.
+	PoolConnCreatedReasonBlocking PoolConnCreatedReason = "blocking"
+
+	// PoolConnCreatedReasonReplacement indicates a connection was being
+	// created to replace one which was discarded due to errors. See
+	// radix.PoolErrorBudget.
+	PoolConnCreatedReasonReplacement PoolConnCreatedReason = "replacement"
+
+	// PoolConnCreatedReasonReauth indicates a connection was being created to
+	// retry an Action which failed because its connection had lost its
+	// authentication. See radix.PoolReauthRetry.
+	PoolConnCreatedReasonReauth PoolConnCreatedReason = "reauth"
+
+	// PoolConnCreatedReasonAffinity indicates a connection was being created
+	// to perform Actions with a particular affinity key on. See
+	// radix.PoolKeyAffinity.
+	PoolConnCreatedReasonAffinity PoolConnCreatedReason = "affinity"
 )
 
 // PoolConnCreated is passed into the PoolTrace.ConnCreated callback whenever
@@ -88,6 +111,10 @@ const (
 	// PoolConnClosedReasonPoolFull indicates a connection was closed due to
 	// the Pool already being full. See The radix.PoolOnFullClose options.
 	PoolConnClosedReasonPoolFull PoolConnClosedReason = "pool full"
+
+	// PoolConnClosedReasonErrorBudget indicates a connection was closed
+	// because it produced too many errors. See radix.PoolErrorBudget.
+	PoolConnClosedReasonErrorBudget PoolConnClosedReason = "error budget exceeded"
 )
 
 // PoolConnClosed is passed into the PoolTrace.ConnClosed callback whenever the
@@ -117,6 +144,11 @@ type PoolDoCompleted struct {
 
 	// This is the error returned from redis.
 	Err error
+
+	// Metadata is the metadata attached to the Action which was performed,
+	// see radix.WithMetadata. It's nil if there was none, and must not be
+	// modified.
+	Metadata map[string]string
 }
 
 // PoolInitCompleted is passed into the PoolTrace.InitCompleted callback whenever Pool initialized.
@@ -131,3 +163,16 @@ type PoolInitCompleted struct {
 	// How long it took to fill all connections.
 	ElapsedTime time.Duration
 }
+
+// PoolConnReplaced is passed into the PoolTrace.ConnReplaced callback whenever
+// the Pool replaces a connection which was discarded due to errors.
+type PoolConnReplaced struct {
+	PoolCommon
+
+	// Err is the error which caused the replaced connection to be discarded.
+	Err error
+
+	// Replacements is the total number of connections the Pool has replaced,
+	// including this one.
+	Replacements int64
+}
@@ -0,0 +1,41 @@
+//go:build go1.18
+// +build go1.18
+
+package radix
+
+// DoTyped performs the given command on the Client, unmarshaling the result
+// into a newly allocated T and returning it. The unmarshaling follows the same
+// rules as for Cmd. This saves declaring a receiver for one-off commands:
+//
+//	members, err := radix.DoTyped[[]string](client, "SMEMBERS", "foo")
+//
+// Generics require go1.18 or later.
+func DoTyped[T any](c Client, cmd string, args ...string) (T, error) {
+	var rcv T
+	err := c.Do(Cmd(&rcv, cmd, args...))
+	return rcv, err
+}
+
+// FlatDoTyped is like DoTyped, but performs the command using FlatCmd.
+func FlatDoTyped[T any](c Client, cmd, key string, args ...interface{}) (T, error) {
+	var rcv T
+	err := c.Do(FlatCmd(&rcv, cmd, key, args...))
+	return rcv, err
+}
+
+// Get performs a GET on the given key, unmarshaling the value into a newly
+// allocated T and returning it. If the key doesn't exist then the zero value of
+// T is returned; use GetMaybe to distinguish a missing key from an empty value.
+func Get[T any](c Client, key string) (T, error) {
+	return DoTyped[T](c, "GET", key)
+}
+
+// GetMaybe is like Get, but also returns whether the key exists.
+func GetMaybe[T any](c Client, key string) (T, bool, error) {
+	var rcv T
+	mn := MaybeNil{Rcv: &rcv}
+	if err := c.Do(Cmd(&mn, "GET", key)); err != nil {
+		return rcv, false, err
+	}
+	return rcv, !mn.Nil, nil
+}
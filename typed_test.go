@@ -0,0 +1,50 @@
+//go:build go1.18
+// +build go1.18
+
+package radix
+
+import (
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoTyped(t *T) {
+	stub := Stub("tcp", "127.0.0.1:6379", func(args []string) interface{} {
+		switch args[0] {
+		case "GET":
+			if args[1] == "missing" {
+				return nil
+			}
+			return "5"
+		case "SMEMBERS":
+			return []string{"a", "b"}
+		case "HSET":
+			return len(args[2:]) / 2
+		}
+		return nil
+	})
+
+	members, err := DoTyped[[]string](stub, "SMEMBERS", "foo")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, members)
+
+	n, err := FlatDoTyped[int](stub, "HSET", "foo", map[string]int{"a": 1, "b": 2})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	i, err := Get[int64](stub, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), i)
+
+	s, ok, err := GetMaybe[string](stub, "foo")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "5", s)
+
+	s, ok, err = GetMaybe[string](stub, "missing")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "", s)
+}
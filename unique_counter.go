@@ -0,0 +1,163 @@
+package radix
+
+import (
+	"strconv"
+	"strings"
+)
+
+// UniqueCounterOpts are the options given to NewUniqueCounter.
+type UniqueCounterOpts struct {
+	// Threshold is the number of unique members above which a UniqueCounter
+	// converts from a set to a HyperLogLog.
+	//
+	// The default, if Threshold is 0, is 1000.
+	Threshold int
+}
+
+// UniqueCounter counts the number of unique members added to it, e.g. unique
+// visitors to a page. While it has few members it keeps them in a set, so its
+// count is exact, and once it has more than opts.Threshold members they're
+// converted to a HyperLogLog, whose memory usage is fixed but whose count is
+// an estimate with a standard error of 0.81%.
+//
+// The set and the HyperLogLog are kept in the keys "{key}:set" and "{key}:hll"
+// respectively, or "key:set" and "key:hll" if key already contains a hash tag,
+// and the existence of the latter marks the UniqueCounter as having been
+// converted. All operations are performed atomically using Lua scripts.
+//
+// A UniqueCounter is safe for concurrent use.
+type UniqueCounter struct {
+	c    Client
+	key  string
+	opts UniqueCounterOpts
+}
+
+// NewUniqueCounter returns a UniqueCounter which keeps its members in keys
+// derived from the given key.
+func NewUniqueCounter(c Client, key string, opts UniqueCounterOpts) *UniqueCounter {
+	if opts.Threshold <= 0 {
+		opts.Threshold = 1000
+	}
+	return &UniqueCounter{c: c, key: key, opts: opts}
+}
+
+// hashTagged returns the key wrapped in braces, so that it's used as the hash
+// tag of keys it prefixes, unless it already contains a hash tag.
+func hashTagged(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key
+		}
+	}
+	return "{" + key + "}"
+}
+
+func (uc *UniqueCounter) setKey() string { return hashTagged(uc.key) + ":set" }
+
+func (uc *UniqueCounter) hllKey() string { return hashTagged(uc.key) + ":hll" }
+
+// uniqueCounterLuaLib is prepended to the UniqueCounter scripts. callChunked
+// calls a variadic command with the elements of a table starting at the given
+// index, in chunks, so as not to exceed the limit on the number of values
+// which can be unpacked at once.
+const uniqueCounterLuaLib = `
+	local function callChunked(cmd, key, members, from)
+		for i = from, #members, 1000 do
+			redis.call(cmd, key, unpack(members, i, math.min(i + 999, #members)))
+		end
+	end
+`
+
+var uniqueCounterAddScript = NewEvalScript(2, uniqueCounterLuaLib+`
+	if redis.call("EXISTS", KEYS[2]) == 1 then
+		callChunked("PFADD", KEYS[2], ARGV, 2)
+		return
+	end
+	callChunked("SADD", KEYS[1], ARGV, 2)
+	if redis.call("SCARD", KEYS[1]) > tonumber(ARGV[1]) then
+		callChunked("PFADD", KEYS[2], redis.call("SMEMBERS", KEYS[1]), 1)
+		redis.call("DEL", KEYS[1])
+	end
+`)
+
+// Add adds the given members to the UniqueCounter, converting it to a
+// HyperLogLog if it has more than the threshold number of members as a
+// result.
+func (uc *UniqueCounter) Add(members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	keysAndArgs := make([]string, 0, 3+len(members))
+	keysAndArgs = append(keysAndArgs, uc.setKey(), uc.hllKey(), strconv.Itoa(uc.opts.Threshold))
+	keysAndArgs = append(keysAndArgs, members...)
+	return uc.c.Do(uniqueCounterAddScript.Cmd(nil, keysAndArgs...))
+}
+
+var uniqueCounterCountScript = NewEvalScript(2, `
+	if redis.call("EXISTS", KEYS[2]) == 1 then
+		return redis.call("PFCOUNT", KEYS[2])
+	end
+	return redis.call("SCARD", KEYS[1])
+`)
+
+// Count returns the number of unique members which have been added to the
+// UniqueCounter, which is an estimate if it's been converted to a HyperLogLog.
+func (uc *UniqueCounter) Count() (int64, error) {
+	var n int64
+	err := uc.c.Do(uniqueCounterCountScript.Cmd(&n, uc.setKey(), uc.hllKey()))
+	return n, err
+}
+
+// uniqueCounterMergeScript merges the UniqueCounters whose set and HyperLogLog
+// keys follow the first pair of keys into the first. Its number of keys
+// varies, and so is set when it's used.
+var uniqueCounterMergeScript = NewEvalScript(0, uniqueCounterLuaLib+`
+	local hlls = {}
+	for i = 4, #KEYS, 2 do
+		if redis.call("EXISTS", KEYS[i]) == 1 then
+			table.insert(hlls, KEYS[i])
+		end
+	end
+
+	if #hlls == 0 and redis.call("EXISTS", KEYS[2]) == 0 then
+		local sets = {}
+		for i = 1, #KEYS, 2 do
+			table.insert(sets, KEYS[i])
+		end
+		redis.call("SUNIONSTORE", KEYS[1], unpack(sets))
+		if redis.call("SCARD", KEYS[1]) <= tonumber(ARGV[1]) then
+			return
+		end
+	end
+
+	for i = 1, #KEYS, 2 do
+		callChunked("PFADD", KEYS[2], redis.call("SMEMBERS", KEYS[i]), 1)
+	end
+	redis.call("DEL", KEYS[1])
+	if #hlls > 0 then
+		redis.call("PFMERGE", KEYS[2], unpack(hlls))
+	end
+`)
+
+// Merge adds all members of the given UniqueCounters to this one, which is
+// converted to a HyperLogLog if any of them have been, or if it has more than
+// the threshold number of members as a result. The given UniqueCounters are
+// not modified.
+//
+// When used with a Cluster all of the UniqueCounters' keys must belong to the
+// same slot, which can be done by giving them keys containing the same hash
+// tag, e.g. "{visitors}:2021-03-04" and "{visitors}:2021-03-05".
+func (uc *UniqueCounter) Merge(others ...*UniqueCounter) error {
+	if len(others) == 0 {
+		return nil
+	}
+	keysAndArgs := make([]string, 0, 3+len(others)*2)
+	keysAndArgs = append(keysAndArgs, uc.setKey(), uc.hllKey())
+	for _, other := range others {
+		keysAndArgs = append(keysAndArgs, other.setKey(), other.hllKey())
+	}
+	script := uniqueCounterMergeScript
+	script.numKeys = len(keysAndArgs)
+	keysAndArgs = append(keysAndArgs, strconv.Itoa(uc.opts.Threshold))
+	return uc.c.Do(script.Cmd(nil, keysAndArgs...))
+}
@@ -0,0 +1,58 @@
+package radix
+
+import (
+	"strconv"
+	. "testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUniqueCounter(t *T) {
+	c := dial()
+	defer c.Close()
+
+	assertCount := func(uc *UniqueCounter, exp int64, converted bool) {
+		n, err := uc.Count()
+		require.NoError(t, err)
+		if converted {
+			// HyperLogLog counts are estimates, but are very accurate for
+			// small numbers of members.
+			assert.InDelta(t, exp, n, float64(exp)*0.05)
+		} else {
+			assert.Equal(t, exp, n)
+		}
+
+		var exists int
+		require.NoError(t, c.Do(Cmd(&exists, "EXISTS", uc.hllKey())))
+		assert.Equal(t, converted, exists == 1)
+	}
+
+	tag := "{" + randStr() + "}"
+	uc := NewUniqueCounter(c, tag+"a", UniqueCounterOpts{Threshold: 10})
+	require.NoError(t, uc.Add("a", "b", "c", "a"))
+	assertCount(uc, 3, false)
+
+	var members []string
+	for i := 0; i < 20; i++ {
+		members = append(members, strconv.Itoa(i))
+	}
+	require.NoError(t, uc.Add(members[:10]...))
+	assertCount(uc, 13, true)
+	require.NoError(t, uc.Add(members...))
+	assertCount(uc, 23, true)
+
+	// merging sets stays a set while under the threshold.
+	uc2 := NewUniqueCounter(c, tag+"b", UniqueCounterOpts{Threshold: 10})
+	uc3 := NewUniqueCounter(c, tag+"c", UniqueCounterOpts{Threshold: 10})
+	require.NoError(t, uc2.Add("a", "b"))
+	require.NoError(t, uc3.Add("b", "c"))
+	require.NoError(t, uc2.Merge(uc3))
+	assertCount(uc2, 3, false)
+	assertCount(uc3, 2, false)
+
+	// merging a converted counter converts the destination.
+	require.NoError(t, uc2.Merge(uc))
+	assertCount(uc2, 23, true)
+	assertCount(uc, 23, true)
+}
@@ -0,0 +1,113 @@
+package radix
+
+import (
+	"context"
+	"time"
+
+	"github.com/mediocregopher/radix/v3/resp"
+)
+
+// withConnCtx holds the state of a withConn created by WithConnContext.
+type withConnCtx struct {
+	ctx context.Context
+
+	// canceled is set if ctx was canceled by the time the callback returned.
+	canceled bool
+}
+
+// WithConnContext is like WithConn, but the callback is given a Context, and
+// the Conn given to it is discarded rather than reused if the Context is
+// canceled before the callback returns.
+//
+// Once the Context is canceled any command being written or read on the Conn
+// is interrupted, on a best-effort basis, and all further commands performed
+// on the Conn given to the callback return the Context's error. Since a
+// command may have been only partially written, or its reply not yet read, the
+// Conn can't be safely reused, and so once the callback returns it's marked as
+// having errored, so that Clients which manage their own Conns, e.g. Pool or
+// MuxClient, close it rather than returning it to be used by another Action.
+// If the Action is performed directly on a Conn, that Conn is closed.
+//
+// If the Context is already canceled the callback isn't called and the
+// Context's error is returned.
+func WithConnContext(ctx context.Context, key string, fn func(context.Context, Conn) error) Action {
+	wcc := &withConnCtx{ctx: ctx}
+	return &withConn{
+		key: [1]string{key},
+		ctx: wcc,
+		fn: func(c Conn) error {
+			return wcc.run(c, fn)
+		},
+	}
+}
+
+func (wcc *withConnCtx) run(c Conn, fn func(context.Context, Conn) error) error {
+	if err := wcc.ctx.Err(); err != nil {
+		return err
+	}
+
+	stopCh, doneCh := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		select {
+		case <-wcc.ctx.Done():
+			if netConn := c.NetConn(); netConn != nil {
+				netConn.SetDeadline(time.Now())
+			}
+		case <-stopCh:
+		}
+	}()
+
+	err := fn(wcc.ctx, &ctxConn{Conn: c, ctx: wcc.ctx})
+	close(stopCh)
+	<-doneCh
+
+	if wcc.canceled = wcc.ctx.Err() != nil; wcc.canceled {
+		discardConn(c, wcc.ctx.Err())
+	}
+	return err
+}
+
+// withConnCanceled returns the Context's error if the Action was created by
+// WithConnContext, possibly wrapped, and its Context was canceled while its
+// callback was running. Otherwise nil is returned.
+func withConnCanceled(a Action) error {
+	for {
+		switch aa := a.(type) {
+		case *withConn:
+			if aa.ctx == nil || !aa.ctx.canceled {
+				return nil
+			}
+			return aa.ctx.ctx.Err()
+		case wrappedAction:
+			a = aa.unwrapAction()
+		default:
+			return nil
+		}
+	}
+}
+
+// ctxConn wraps a Conn such that, once its Context is canceled, all commands
+// performed on it return the Context's error.
+type ctxConn struct {
+	Conn
+	ctx context.Context
+}
+
+func (cc *ctxConn) Do(a Action) error {
+	return a.Run(cc)
+}
+
+func (cc *ctxConn) Encode(m resp.Marshaler) error {
+	if err := cc.ctx.Err(); err != nil {
+		return err
+	}
+	return cc.Conn.Encode(m)
+}
+
+func (cc *ctxConn) Decode(u resp.Unmarshaler) error {
+	if err := cc.ctx.Err(); err != nil {
+		return err
+	}
+	return cc.Conn.Decode(u)
+}
@@ -0,0 +1,79 @@
+package radix
+
+import (
+	"context"
+	. "testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	errors "golang.org/x/xerrors"
+)
+
+func TestWithConnContext(t *T) {
+	newPool := func() *Pool {
+		connFunc := func(network, addr string) (Conn, error) {
+			return Stub(network, addr, func(args []string) interface{} {
+				return "OK"
+			}), nil
+		}
+		pool, err := NewPool("tcp", "127.0.0.1:6379", 1,
+			PoolConnFunc(connFunc),
+			PoolPipelineWindow(0, 0),
+			PoolOnEmptyCreateAfter(0),
+			PoolRefillInterval(time.Hour),
+		)
+		require.NoError(t, err)
+		<-pool.initDone
+		return pool
+	}
+
+	t.Run("NotCanceled", func(t *T) {
+		pool := newPool()
+		defer pool.Close()
+
+		var calls int
+		require.NoError(t, pool.Do(WithConnContext(context.Background(), "", func(ctx context.Context, conn Conn) error {
+			calls++
+			return conn.Do(Cmd(nil, "SET", "foo", "bar"))
+		})))
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, uint64(0), pool.Stats().TotalClosed)
+	})
+
+	t.Run("Canceled", func(t *T) {
+		pool := newPool()
+		defer pool.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		err := pool.Do(WithConnContext(ctx, "", func(ctx context.Context, conn Conn) error {
+			if err := conn.Do(Cmd(nil, "SET", "foo", "bar")); err != nil {
+				return err
+			}
+			cancel()
+			<-ctx.Done()
+			return conn.Do(Cmd(nil, "SET", "foo", "baz"))
+		}))
+		assert.True(t, errors.Is(err, context.Canceled))
+		assert.Equal(t, uint64(1), pool.Stats().TotalClosed)
+
+		// the pool still works, using a new connection
+		require.NoError(t, pool.Do(Cmd(nil, "SET", "foo", "bar")))
+	})
+
+	t.Run("AlreadyCanceled", func(t *T) {
+		pool := newPool()
+		defer pool.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var calls int
+		err := pool.Do(WithConnContext(ctx, "", func(context.Context, Conn) error {
+			calls++
+			return nil
+		}))
+		assert.True(t, errors.Is(err, context.Canceled))
+		assert.Equal(t, 0, calls)
+		assert.Equal(t, uint64(0), pool.Stats().TotalClosed)
+	})
+}